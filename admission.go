@@ -0,0 +1,58 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+// AdmissionCheck indicates at which point an AdmissionPolicy is consulted.
+type AdmissionCheck byte
+
+const (
+	// AdmissionNew is used when a state is submitted via Consensus.Propose.
+	AdmissionNew AdmissionCheck = iota
+	// AdmissionRecheck is used when the unconfirmed queue is re-examined right
+	// before a state is picked up for a <roundchange> or <select> proposal,
+	// states which fail the recheck will be evicted from the queue.
+	AdmissionRecheck
+)
+
+// AdmissionPolicy is an application defined CheckTx-style validator for the
+// unconfirmed queue, it allows stateful validation(nonces, fees, etc.) on locally
+// proposed states without modifying the consensus core.
+//
+// NOTE: states carried by <select> messages or collected from <roundchange>
+// messages by the leader are not subject to AdmissionNew, as they have been
+// proposed by other participants, they're rechecked before proposing though,
+// except for the states carried in <roundchange> proofs of a <select>, as B'
+// must be no less than any of them.
+type AdmissionPolicy interface {
+	// CheckState returns nil if the state is acceptable, the error returned
+	// on AdmissionNew will be passed back to the caller of Propose.
+	CheckState(s State, check AdmissionCheck) error
+}
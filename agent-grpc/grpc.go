@@ -0,0 +1,489 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package grpcagent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	agent "github.com/yonggewang/bdls/agent-tcp"
+	"github.com/yonggewang/bdls/internal/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ServiceName is the gRPC service name of consensus streams
+	ServiceName = "bdls.Agent"
+	// FullMethod is the gRPC method of consensus streams
+	FullMethod = "/" + ServiceName + "/Stream"
+	// PublicKeyMetadata is the metadata key to announce the transport public key
+	PublicKeyMetadata = "bdls-public-key"
+
+	// codecName is the content-subtype of consensus streams, frames are
+	// passed through without protobuf encoding
+	codecName = "bdls"
+)
+
+var (
+	// ErrFrameLength indicates the length prefix of a frame exceeds the maximum
+	ErrFrameLength = errors.New("frame length exceeded maximum")
+	// ErrPublicKey indicates the announced public key in metadata is invalid
+	ErrPublicKey = errors.New("invalid public key in stream metadata")
+)
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// frame is a |MessageLength|Message| frame of agent-tcp
+type frame []byte
+
+// codec passes frames through, it's selected by content-subtype, so it
+// won't affect other services registered on the same grpc.Server.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	f, ok := v.(*frame)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "unexpected message type %T", v)
+	}
+	// the message can't be retained after SendMsg returns
+	return append([]byte(nil), *f...), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	f, ok := v.(*frame)
+	if !ok {
+		return status.Errorf(codes.Internal, "unexpected message type %T", v)
+	}
+	*f = append((*f)[:0], data...)
+	return nil
+}
+
+func (codec) Name() string { return codecName }
+
+// streamServer is the handler type of the consensus stream service
+type streamServer interface {
+	serve(stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*streamServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       func(srv interface{}, stream grpc.ServerStream) error { return srv.(streamServer).serve(stream) },
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+// stream is the common part of grpc.ClientStream & grpc.ServerStream
+type stream interface {
+	SendMsg(m interface{}) error
+	RecvMsg(m interface{}) error
+}
+
+// Conn adapts a consensus stream into a net.Conn, writes are buffered until
+// a whole |MessageLength|Message| frame has been written, then sent as one
+// stream message, reads are concatenated from stream messages.
+type Conn struct {
+	stream stream
+	cancel context.CancelFunc // (optional) cancels the client stream
+	local  net.Addr
+	remote net.Addr
+	pubkey *ecdsa.PublicKey // the announced public key
+
+	rbuf     []byte        // unread part of current incoming frame
+	chFrames chan frame    // incoming frames
+	chRecv   chan struct{} // closed when receiving stopped
+	recvErr  error         // the error to stop receiving
+	wbuf     []byte        // partial outgoing frame
+	wmu      sync.Mutex
+
+	readDeadline  deadline
+	writeDeadline deadline
+
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+// newConn creates a Conn and starts receiving
+func newConn(s stream, cancel context.CancelFunc, local net.Addr, remote net.Addr, pubkey *ecdsa.PublicKey) *Conn {
+	c := new(Conn)
+	c.stream = s
+	c.cancel = cancel
+	c.local = local
+	c.remote = remote
+	c.pubkey = pubkey
+	c.chFrames = make(chan frame)
+	c.chRecv = make(chan struct{})
+	c.readDeadline = makeDeadline()
+	c.writeDeadline = makeDeadline()
+	c.die = make(chan struct{})
+	go c.recvLoop()
+	return c
+}
+
+// recvLoop receives frames from the stream
+func (c *Conn) recvLoop() {
+	defer close(c.chRecv)
+	for {
+		var f frame
+		if err := c.stream.RecvMsg(&f); err != nil {
+			c.recvErr = err
+			return
+		}
+
+		select {
+		case c.chFrames <- f:
+		case <-c.die:
+			c.recvErr = net.ErrClosed
+			return
+		}
+	}
+}
+
+// AnnouncedPublicKey returns the public key announced by the client in stream
+// metadata, it's nil on the client side. The key must be compared with the
+// key authenticated by KEY_AUTH handshake before being trusted.
+func (c *Conn) AnnouncedPublicKey() *ecdsa.PublicKey { return c.pubkey }
+
+// Read implements net.Conn
+func (c *Conn) Read(b []byte) (int, error) {
+	for len(c.rbuf) == 0 {
+		select {
+		case f := <-c.chFrames:
+			c.rbuf = f
+		case <-c.chRecv:
+			return 0, c.recvErr
+		case <-c.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		case <-c.die:
+			return 0, net.ErrClosed
+		}
+	}
+
+	n := copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// Write implements net.Conn, a stream blocked by flow control beyond the write
+// deadline will be closed, as a message can't be withdrawn once being sent.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.wbuf = append(c.wbuf, b...)
+	for len(c.wbuf) >= agent.MessageLength {
+		length := binary.LittleEndian.Uint32(c.wbuf)
+		if length > agent.MaxMessageLength {
+			return 0, ErrFrameLength
+		}
+
+		size := agent.MessageLength + int(length)
+		if len(c.wbuf) < size {
+			break
+		}
+
+		select {
+		case <-c.writeDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		case <-c.die:
+			return 0, net.ErrClosed
+		default:
+		}
+
+		f := frame(c.wbuf[:size])
+		chErr := make(chan error, 1)
+		go func() { chErr <- c.stream.SendMsg(&f) }()
+
+		select {
+		case err := <-chErr:
+			if err != nil {
+				return 0, err
+			}
+		case <-c.writeDeadline.wait():
+			c.Close()
+			return 0, os.ErrDeadlineExceeded
+		case <-c.die:
+			return 0, net.ErrClosed
+		}
+		c.wbuf = c.wbuf[:copy(c.wbuf, c.wbuf[size:])]
+	}
+	return len(b), nil
+}
+
+// Close implements net.Conn
+func (c *Conn) Close() error {
+	c.dieOnce.Do(func() {
+		close(c.die)
+		if c.cancel != nil {
+			c.cancel()
+		}
+	})
+	return nil
+}
+
+// LocalAddr implements net.Conn
+func (c *Conn) LocalAddr() net.Addr { return c.local }
+
+// RemoteAddr implements net.Conn
+func (c *Conn) RemoteAddr() net.Addr { return c.remote }
+
+// SetDeadline implements net.Conn
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// SetReadDeadline implements net.Conn
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline implements net.Conn
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// Dial opens a consensus stream on cc, pubkey is the transport public key of
+// the local agent to announce in metadata, and could be nil if the server
+// doesn't require it. The stream lives until the conn is closed or ctx is
+// done.
+func Dial(ctx context.Context, cc grpc.ClientConnInterface, pubkey *ecdsa.PublicKey) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	if pubkey != nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, PublicKeyMetadata, identity.Encode(pubkey))
+	}
+
+	s, err := cc.NewStream(ctx, &serviceDesc.Streams[0], FullMethod, grpc.CallContentSubtype(codecName))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// wait for the server to accept the stream
+	md, err := s.Header()
+	if err == nil && md == nil {
+		// terminated without headers, the status is returned by RecvMsg
+		if err = s.RecvMsg(new(frame)); err == nil {
+			err = status.Error(codes.Internal, "unexpected message before headers")
+		}
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	p, ok := peer.FromContext(s.Context())
+	if !ok {
+		cancel()
+		return nil, status.Error(codes.Internal, "unknown peer of the stream")
+	}
+	return newConn(s, cancel, p.LocalAddr, p.Addr, nil), nil
+}
+
+// Listener accepts consensus streams, it implements net.Listener to accept
+// the streams as connections, and should be registered to a grpc.Server
+// with Register.
+type Listener struct {
+	addr      net.Addr
+	authorize func(pubkey *ecdsa.PublicKey) bool
+	chConns   chan net.Conn
+
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+// NewListener creates a Listener, addr is the address of the gRPC server
+// it will be registered to, and will be returned by Addr().
+func NewListener(addr net.Addr) *Listener {
+	l := new(Listener)
+	l.addr = addr
+	l.chConns = make(chan net.Conn)
+	l.die = make(chan struct{})
+	return l
+}
+
+// Register registers the consensus stream service to a gRPC server
+func (l *Listener) Register(s grpc.ServiceRegistrar) {
+	s.RegisterService(&serviceDesc, l)
+}
+
+// SetAuthorizer sets a function to authorize the announced public key of
+// streams before they're accepted, streams without a public key will be
+// rejected once it's set. It must be called before Register.
+func (l *Listener) SetAuthorizer(authorize func(pubkey *ecdsa.PublicKey) bool) {
+	l.authorize = authorize
+}
+
+// serve implements streamServer
+func (l *Listener) serve(s grpc.ServerStream) error {
+	ctx := s.Context()
+	var pubkey *ecdsa.PublicKey
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(PublicKeyMetadata); len(values) > 0 {
+			var err error
+			if pubkey, err = identity.Decode(values[0]); err != nil {
+				return status.Error(codes.InvalidArgument, ErrPublicKey.Error())
+			}
+		}
+	}
+
+	if l.authorize != nil && (pubkey == nil || !l.authorize(pubkey)) {
+		return status.Error(codes.PermissionDenied, "public key not authorized")
+	}
+
+	var local, remote net.Addr = l.addr, nil
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr
+		if p.LocalAddr != nil {
+			local = p.LocalAddr
+		}
+	}
+
+	// the stream is accepted
+	if err := s.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	conn := newConn(s, nil, local, remote, pubkey)
+	select {
+	case l.chConns <- conn:
+	case <-l.die:
+		return status.Error(codes.Unavailable, "listener closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// the stream ends when the handler returns
+	select {
+	case <-conn.die:
+	case <-ctx.Done():
+		conn.Close()
+	}
+	return nil
+}
+
+// Accept implements net.Listener
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.chConns:
+		return conn, nil
+	case <-l.die:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener, the gRPC server has to be stopped separately.
+func (l *Listener) Close() error {
+	l.dieOnce.Do(func() { close(l.die) })
+	return nil
+}
+
+// Addr implements net.Listener
+func (l *Listener) Addr() net.Addr { return l.addr }
+
+// deadline is a resettable deadline signalled by closing a channel
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{} // closed when the deadline exceeded
+}
+
+func makeDeadline() deadline {
+	return deadline{cancel: make(chan struct{})}
+}
+
+// set sets the deadline, a zero time means no deadline
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // wait for the timer to close
+	}
+	d.timer = nil
+
+	closed := isClosed(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait returns a channel closed when the deadline exceeded
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,160 @@
+package grpcagent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	agent "github.com/yonggewang/bdls/agent-tcp"
+	"github.com/yonggewang/bdls/transport/transporttest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func newTestAgent(t *testing.T, privateKey *ecdsa.PrivateKey, participants []bdls.Identity) *agent.TCPAgent {
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = privateKey
+	config.Participants = participants
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	return agent.NewTCPAgent(consensus, privateKey)
+}
+
+// newTestServer starts a gRPC server with a consensus stream Listener
+func newTestServer(t *testing.T, authorize func(*ecdsa.PublicKey) bool) (*Listener, *grpc.ClientConn) {
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	s := grpc.NewServer()
+	l := NewListener(tl.Addr())
+	if authorize != nil {
+		l.SetAuthorizer(authorize)
+	}
+	l.Register(s)
+	go s.Serve(tl)
+
+	cc, err := grpc.NewClient(tl.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+
+	t.Cleanup(func() {
+		cc.Close()
+		l.Close()
+		s.Stop()
+	})
+	return l, cc
+}
+
+func TestGRPCPeerAuthentication(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	server := newTestAgent(t, keys[0], participants)
+	defer server.Close()
+	client := newTestAgent(t, keys[1], participants)
+	defer client.Close()
+
+	l, cc := newTestServer(t, func(pubkey *ecdsa.PublicKey) bool {
+		return pubkey.X.Cmp(keys[1].PublicKey.X) == 0 && pubkey.Y.Cmp(keys[1].PublicKey.Y) == 0
+	})
+
+	c1, err := Dial(context.Background(), cc, &keys[1].PublicKey)
+	assert.Nil(t, err)
+	p1 := agent.NewTCPPeer(c1, client)
+	assert.True(t, client.AddPeer(p1))
+	assert.Nil(t, p1.InitiatePublicKeyAuthentication())
+
+	c2, err := l.Accept()
+	assert.Nil(t, err)
+	p2 := agent.NewTCPPeer(c2, server)
+	assert.True(t, server.AddPeer(p2))
+	assert.Nil(t, p2.InitiatePublicKeyAuthentication())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for (p1.GetPublicKey() == nil || p2.GetPublicKey() == nil) && time.Now().Before(deadline) {
+		<-time.After(20 * time.Millisecond)
+	}
+
+	assert.Equal(t, &keys[0].PublicKey, p1.GetPublicKey())
+	assert.Equal(t, &keys[1].PublicKey, p2.GetPublicKey())
+	assert.Equal(t, p2.GetTransportPublicKey(), c2.(*Conn).AnnouncedPublicKey())
+}
+
+func TestGRPCAuthorizer(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	_, cc := newTestServer(t, func(*ecdsa.PublicKey) bool { return false })
+
+	// rejected key
+	_, err = Dial(context.Background(), cc, &key.PublicKey)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// no key
+	_, err = Dial(context.Background(), cc, nil)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestGRPCFraming(t *testing.T) {
+	l, cc := newTestServer(t, nil)
+
+	c1, err := Dial(context.Background(), cc, nil)
+	assert.Nil(t, err)
+	defer c1.Close()
+	c2, err := l.Accept()
+	assert.Nil(t, err)
+	defer c2.Close()
+
+	// a frame written in pieces is received as a whole
+	frame := make([]byte, agent.MessageLength+3)
+	frame[0] = 3
+	copy(frame[agent.MessageLength:], []byte{1, 2, 3})
+	_, err = c1.Write(frame[:agent.MessageLength])
+	assert.Nil(t, err)
+	_, err = c1.Write(frame[agent.MessageLength:])
+	assert.Nil(t, err)
+
+	buf := make([]byte, len(frame))
+	n, err := c2.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, frame, buf[:n])
+
+	// read deadline
+	c2.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = c2.Read(buf)
+	assert.Equal(t, os.ErrDeadlineExceeded, err)
+
+	// oversized frames are rejected
+	oversized := make([]byte, agent.MessageLength)
+	oversized[3] = 0xff
+	_, err = c1.Write(oversized)
+	assert.Equal(t, ErrFrameLength, err)
+
+	// closing the client ends the stream on the server
+	c1.Close()
+	c2.SetReadDeadline(time.Time{})
+	_, err = c2.Read(buf)
+	assert.NotNil(t, err)
+}
+
+func TestTransportConformance(t *testing.T) {
+	suite := &transporttest.Suite{Transport: new(Transport), Addr: "127.0.0.1:0"}
+	suite.Run(t)
+}
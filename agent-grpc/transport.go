@@ -0,0 +1,141 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package grpcagent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"net"
+
+	"github.com/yonggewang/bdls/transport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var _ transport.Transport = (*Transport)(nil)
+
+// Transport implements transport.Transport over gRPC, it dials a client
+// connection per stream, and listens with it's own gRPC server.
+type Transport struct {
+	// DialOptions for grpc.NewClient, defaults to insecure credentials as
+	// peers are authenticated by the KEY_AUTH challenge-response.
+	DialOptions []grpc.DialOption
+	// ServerOptions for grpc.NewServer
+	ServerOptions []grpc.ServerOption
+	// PublicKey (optional) to announce on dialing
+	PublicKey *ecdsa.PublicKey
+	// Authorize (optional) is set to the listeners by SetAuthorizer
+	Authorize func(pubkey *ecdsa.PublicKey) bool
+}
+
+// Dial implements transport.Transport
+func (t *Transport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	opts := t.DialOptions
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+
+	cc, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// the stream outlives ctx, which only bounds the dialing
+	streamCtx, cancel := context.WithCancel(context.Background())
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	chResult := make(chan result, 1)
+	go func() {
+		conn, err := Dial(streamCtx, cc, t.PublicKey)
+		chResult <- result{conn, err}
+	}()
+
+	select {
+	case r := <-chResult:
+		if r.err != nil {
+			cancel()
+			cc.Close()
+			return nil, r.err
+		}
+		return &clientConn{Conn: r.conn, cc: cc, cancel: cancel}, nil
+	case <-ctx.Done():
+		cancel()
+		cc.Close()
+		return nil, ctx.Err()
+	}
+}
+
+// Listen implements transport.Transport
+func (t *Transport) Listen(addr string) (net.Listener, error) {
+	tl, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := grpc.NewServer(t.ServerOptions...)
+	l := NewListener(tl.Addr())
+	if t.Authorize != nil {
+		l.SetAuthorizer(t.Authorize)
+	}
+	l.Register(s)
+	go s.Serve(tl)
+	return &serverListener{Listener: l, server: s}, nil
+}
+
+// clientConn closes the client connection along with the stream
+type clientConn struct {
+	net.Conn
+	cc     *grpc.ClientConn
+	cancel context.CancelFunc
+}
+
+// Close implements net.Conn
+func (c *clientConn) Close() error {
+	err := c.Conn.Close()
+	c.cancel()
+	c.cc.Close()
+	return err
+}
+
+// serverListener stops the gRPC server along with the Listener
+type serverListener struct {
+	*Listener
+	server *grpc.Server
+}
+
+// Close implements net.Listener
+func (l *serverListener) Close() error {
+	err := l.Listener.Close()
+	l.server.Stop()
+	return err
+}
@@ -0,0 +1,191 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package p2pagent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/yonggewang/bdls"
+)
+
+// ProtocolID is the libp2p protocol of consensus streams
+const ProtocolID protocol.ID = "/bdls/consensus/1.0.0"
+
+var (
+	// ErrKeyType indicates a libp2p key is not secp256k1
+	ErrKeyType = errors.New("the libp2p key is not secp256k1")
+)
+
+// PrivateKey converts a secp256k1 libp2p private key to be used as the
+// transport key of an agent.
+func PrivateKey(k crypto.PrivKey) (*ecdsa.PrivateKey, error) {
+	if k.Type() != crypto.Secp256k1 {
+		return nil, ErrKeyType
+	}
+
+	raw, err := k.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	priv := new(ecdsa.PrivateKey)
+	priv.PublicKey.Curve = bdls.S256Curve
+	priv.D = new(big.Int).SetBytes(raw)
+	priv.PublicKey.X, priv.PublicKey.Y = bdls.S256Curve.ScalarBaseMult(raw)
+	return priv, nil
+}
+
+// PublicKey converts a secp256k1 libp2p public key to compare with the key
+// authenticated by the KEY_AUTH handshake.
+func PublicKey(k crypto.PubKey) (*ecdsa.PublicKey, error) {
+	if k.Type() != crypto.Secp256k1 {
+		return nil, ErrKeyType
+	}
+
+	raw, err := k.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	pk, err := secp256k1.ParsePubKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: bdls.S256Curve, X: pk.X(), Y: pk.Y()}, nil
+}
+
+// addr is the address of a libp2p stream endpoint
+type addr string
+
+func (addr) Network() string  { return "libp2p" }
+func (a addr) String() string { return string(a) }
+
+// Conn adapts a libp2p stream into a net.Conn, it's addresses are the
+// multiaddrs of the underlying connection with peer IDs.
+type Conn struct {
+	network.Stream
+}
+
+// NewConn creates a net.Conn from a libp2p stream
+func NewConn(s network.Stream) *Conn { return &Conn{s} }
+
+// LocalAddr implements net.Conn
+func (c *Conn) LocalAddr() net.Addr {
+	conn := c.Stream.Conn()
+	return addr(fmt.Sprintf("%v/p2p/%v", conn.LocalMultiaddr(), conn.LocalPeer()))
+}
+
+// RemoteAddr implements net.Conn
+func (c *Conn) RemoteAddr() net.Addr {
+	conn := c.Stream.Conn()
+	return addr(fmt.Sprintf("%v/p2p/%v", conn.RemoteMultiaddr(), conn.RemotePeer()))
+}
+
+// RemotePublicKey returns the public key of the remote peer ID, which must
+// be secp256k1.
+func (c *Conn) RemotePublicKey() (*ecdsa.PublicKey, error) {
+	return PublicKey(c.Stream.Conn().RemotePublicKey())
+}
+
+// Dial opens a consensus stream to the peer id, the host must know the
+// addresses of the peer or be able to discover them.
+func Dial(ctx context.Context, h host.Host, id peer.ID) (net.Conn, error) {
+	s, err := h.NewStream(ctx, id, ProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(s), nil
+}
+
+// Listener accepts consensus streams of a libp2p host, it implements
+// net.Listener.
+type Listener struct {
+	host    host.Host
+	chConns chan net.Conn
+
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+// NewListener creates a Listener and sets the stream handler of ProtocolID
+// on the host.
+func NewListener(h host.Host) *Listener {
+	l := new(Listener)
+	l.host = h
+	l.chConns = make(chan net.Conn)
+	l.die = make(chan struct{})
+	h.SetStreamHandler(ProtocolID, l.handleStream)
+	return l
+}
+
+// handleStream implements network.StreamHandler
+func (l *Listener) handleStream(s network.Stream) {
+	select {
+	case l.chConns <- NewConn(s):
+	case <-l.die:
+		s.Reset()
+	}
+}
+
+// Accept implements net.Listener
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.chConns:
+		return conn, nil
+	case <-l.die:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener, and removes the stream handler, the host
+// has to be closed separately.
+func (l *Listener) Close() error {
+	l.dieOnce.Do(func() {
+		l.host.RemoveStreamHandler(ProtocolID)
+		close(l.die)
+	})
+	return nil
+}
+
+// Addr implements net.Listener, returns the peer ID of the host
+func (l *Listener) Addr() net.Addr { return addr("/p2p/" + l.host.ID().String()) }
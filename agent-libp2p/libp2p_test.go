@@ -0,0 +1,122 @@
+package p2pagent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	agent "github.com/yonggewang/bdls/agent-tcp"
+	"github.com/yonggewang/bdls/transport/transporttest"
+)
+
+func newTestAgent(t *testing.T, privateKey *ecdsa.PrivateKey, participants []bdls.Identity) *agent.TCPAgent {
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = privateKey
+	config.Participants = participants
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	return agent.NewTCPAgent(consensus, privateKey)
+}
+
+// newTestHost creates a libp2p host on loopback with a secp256k1 identity
+func newTestHost(t *testing.T) (host.Host, *ecdsa.PrivateKey) {
+	k, _, err := crypto.GenerateSecp256k1Key(rand.Reader)
+	assert.Nil(t, err)
+	h, err := libp2p.New(libp2p.Identity(k), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	assert.Nil(t, err)
+	t.Cleanup(func() { h.Close() })
+
+	priv, err := PrivateKey(k)
+	assert.Nil(t, err)
+	return h, priv
+}
+
+func TestLibp2pPeerAuthentication(t *testing.T) {
+	h1, k1 := newTestHost(t)
+	h2, k2 := newTestHost(t)
+
+	var participants []bdls.Identity
+	for _, k := range []*ecdsa.PrivateKey{k1, k2} {
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&k.PublicKey))
+	}
+	for len(participants) < bdls.ConfigMinimumParticipants {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	server := newTestAgent(t, k1, participants)
+	defer server.Close()
+	client := newTestAgent(t, k2, participants)
+	defer client.Close()
+
+	l := NewListener(h1)
+	defer l.Close()
+
+	h2.Peerstore().AddAddrs(h1.ID(), h1.Addrs(), time.Minute)
+	c1, err := Dial(context.Background(), h2, h1.ID())
+	assert.Nil(t, err)
+	p1 := agent.NewTCPPeer(c1, client)
+	assert.True(t, client.AddPeer(p1))
+	assert.Nil(t, p1.InitiatePublicKeyAuthentication())
+
+	c2, err := l.Accept()
+	assert.Nil(t, err)
+	p2 := agent.NewTCPPeer(c2, server)
+	assert.True(t, server.AddPeer(p2))
+	assert.Nil(t, p2.InitiatePublicKeyAuthentication())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for (p1.GetPublicKey() == nil || p2.GetPublicKey() == nil) && time.Now().Before(deadline) {
+		<-time.After(20 * time.Millisecond)
+	}
+
+	// the authenticated keys are the libp2p identities
+	assert.Equal(t, &k1.PublicKey, p1.GetPublicKey())
+	assert.Equal(t, &k2.PublicKey, p2.GetPublicKey())
+	remote, err := c2.(*Conn).RemotePublicKey()
+	assert.Nil(t, err)
+	assert.Equal(t, &k2.PublicKey, remote)
+	assert.Equal(t, "libp2p", c1.RemoteAddr().Network())
+}
+
+func TestKeyType(t *testing.T) {
+	k, pk, err := crypto.GenerateEd25519Key(rand.Reader)
+	assert.Nil(t, err)
+	_, err = PrivateKey(k)
+	assert.Equal(t, ErrKeyType, err)
+	_, err = PublicKey(pk)
+	assert.Equal(t, ErrKeyType, err)
+
+	k, _, err = crypto.GenerateSecp256k1Key(rand.Reader)
+	assert.Nil(t, err)
+	priv, err := PrivateKey(k)
+	assert.Nil(t, err)
+	id, err := peer.IDFromPrivateKey(k)
+	assert.Nil(t, err)
+	pubkey, err := id.ExtractPublicKey()
+	assert.Nil(t, err)
+	pub, err := PublicKey(pubkey)
+	assert.Nil(t, err)
+	assert.Equal(t, &priv.PublicKey, pub)
+}
+
+func TestTransportConformance(t *testing.T) {
+	h1, _ := newTestHost(t)
+	h2, _ := newTestHost(t)
+	suite := &transporttest.Suite{Transport: &Transport{Host: h1}, Dialer: &Transport{Host: h2}}
+	suite.Run(t)
+}
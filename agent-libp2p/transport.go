@@ -0,0 +1,93 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package p2pagent
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/yonggewang/bdls/transport"
+)
+
+var _ transport.Transport = (*Transport)(nil)
+
+// Transport implements transport.Transport over a libp2p host, addresses
+// are multiaddrs with peer IDs like /ip4/10.0.0.1/tcp/4001/p2p/<id>, or
+// just /p2p/<id> if the host can find the addresses of the peer.
+type Transport struct {
+	Host host.Host
+}
+
+// Dial implements transport.Transport
+func (t *Transport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	info, err := peer.AddrInfoFromString(addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.Addrs) > 0 {
+		t.Host.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.TempAddrTTL)
+	}
+	return Dial(ctx, t.Host, info.ID)
+}
+
+// Listen implements transport.Transport, the host listens on it's own
+// addresses, so addr must be empty or one of the host's multiaddrs.
+func (t *Transport) Listen(addr string) (net.Listener, error) {
+	if addr != "" {
+		found := false
+		for _, a := range t.Host.Addrs() {
+			found = found || a.String() == addr
+		}
+		if !found {
+			return nil, fmt.Errorf("libp2p host is not listening on %v", addr)
+		}
+	}
+	return &hostListener{Listener: NewListener(t.Host)}, nil
+}
+
+// hostListener returns the full multiaddr of the host as Addr, so it's
+// dialable by hosts without a peer discovery
+type hostListener struct {
+	*Listener
+}
+
+// Addr implements net.Listener
+func (l *hostListener) Addr() net.Addr {
+	addrs := l.host.Addrs()
+	if len(addrs) == 0 {
+		return l.Listener.Addr()
+	}
+	return addr(fmt.Sprintf("%v/p2p/%v", addrs[0], l.host.ID()))
+}
@@ -0,0 +1,5 @@
+// Package quicagent carries the agent-tcp protocol over QUIC streams,
+// connections from Dial and Listen can be used with agent.NewTCPPeer, so
+// consensus messages ride on a multiplexed transport with 0-RTT resumption
+// and connection migration.
+package quicagent
@@ -0,0 +1,258 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package quicagent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// NextProto is the ALPN protocol id negotiated for consensus connections
+	NextProto = "bdls"
+
+	// default keepalive period for a quic connection
+	defaultKeepAlivePeriod = 15 * time.Second
+)
+
+// DefaultConfig returns a quic config suitable for consensus connections,
+// with 0-RTT enabled and keepalive on.
+func DefaultConfig() *quic.Config {
+	return &quic.Config{
+		Allow0RTT:       true,
+		KeepAlivePeriod: defaultKeepAlivePeriod,
+	}
+}
+
+// NewServerTLSConfig creates a TLS config with an ephemeral self-signed
+// certificate for a listener.
+//
+// NOTE: TLS is only used to set up the QUIC connection, peers are still
+// authenticated by the KEY_AUTH challenge-response of agent-tcp, so the
+// certificate doesn't have to be trusted by the other side.
+func NewServerTLSConfig() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: NextProto},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{NextProto},
+	}, nil
+}
+
+// NewClientTLSConfig creates a TLS config for dialing, certificates are not
+// verified as peers are authenticated by the KEY_AUTH challenge-response,
+// session tickets are cached to resume connections with 0-RTT.
+func NewClientTLSConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{NextProto},
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+}
+
+// StreamConn adapts a quic stream along with the connection it belongs to
+// into a net.Conn, so it can be passed to agent.NewTCPPeer.
+type StreamConn struct {
+	conn   *quic.Conn
+	stream *quic.Stream
+}
+
+// NewStreamConn creates a net.Conn from the given quic connection and stream
+func NewStreamConn(conn *quic.Conn, stream *quic.Stream) *StreamConn {
+	return &StreamConn{conn: conn, stream: stream}
+}
+
+// Read implements net.Conn
+func (c *StreamConn) Read(b []byte) (int, error) { return c.stream.Read(b) }
+
+// Write implements net.Conn
+func (c *StreamConn) Write(b []byte) (int, error) { return c.stream.Write(b) }
+
+// Close implements net.Conn, it closes both the stream and the connection,
+// as there's only one stream for each connection.
+func (c *StreamConn) Close() error {
+	c.stream.CancelRead(0)
+	c.stream.Close()
+	return c.conn.CloseWithError(0, "")
+}
+
+// LocalAddr implements net.Conn, returns the local address of the connection
+func (c *StreamConn) LocalAddr() net.Addr { return c.conn.LocalAddr() }
+
+// RemoteAddr implements net.Conn, returns the remote address of the connection,
+// which may change after a connection migration.
+func (c *StreamConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// SetDeadline implements net.Conn
+func (c *StreamConn) SetDeadline(t time.Time) error { return c.stream.SetDeadline(t) }
+
+// SetReadDeadline implements net.Conn
+func (c *StreamConn) SetReadDeadline(t time.Time) error { return c.stream.SetReadDeadline(t) }
+
+// SetWriteDeadline implements net.Conn
+func (c *StreamConn) SetWriteDeadline(t time.Time) error { return c.stream.SetWriteDeadline(t) }
+
+// Dial connects to a quic listener at addr, and opens the stream for consensus
+// messages. The stream will only be visible to the listener after the first
+// write, agent.TCPPeer.InitiatePublicKeyAuthentication should be called on the
+// returned connection.
+func Dial(ctx context.Context, addr string, tlsConf *tls.Config, config *quic.Config) (net.Conn, error) {
+	if tlsConf == nil {
+		tlsConf = NewClientTLSConfig()
+	}
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	conn, err := quic.DialAddrEarly(ctx, addr, tlsConf, config)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return nil, err
+	}
+	return NewStreamConn(conn, stream), nil
+}
+
+// Listener implements net.Listener over quic, each accepted connection
+// is the first stream opened by the dialer.
+type Listener struct {
+	listener *quic.EarlyListener
+	chConns  chan net.Conn // connections with stream accepted
+	chErr    chan error    // error from the underlying listener
+
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+// Listen announces on the local UDP address for quic connections.
+func Listen(addr string, tlsConf *tls.Config, config *quic.Config) (*Listener, error) {
+	if tlsConf == nil {
+		var err error
+		tlsConf, err = NewServerTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	listener, err := quic.ListenAddrEarly(addr, tlsConf, config)
+	if err != nil {
+		return nil, err
+	}
+
+	l := new(Listener)
+	l.listener = listener
+	l.chConns = make(chan net.Conn)
+	l.chErr = make(chan error, 1)
+	l.die = make(chan struct{})
+	go l.acceptLoop()
+	return l, nil
+}
+
+// acceptLoop accepts quic connections, and waits for their first streams
+// concurrently, so a silent dialer cannot block others.
+func (l *Listener) acceptLoop() {
+	for {
+		conn, err := l.listener.Accept(context.Background())
+		if err != nil {
+			l.chErr <- err
+			return
+		}
+
+		go func() {
+			stream, err := conn.AcceptStream(conn.Context())
+			if err != nil {
+				conn.CloseWithError(0, "")
+				return
+			}
+
+			select {
+			case l.chConns <- NewStreamConn(conn, stream):
+			case <-l.die:
+				conn.CloseWithError(0, "")
+			}
+		}()
+	}
+}
+
+// Accept implements net.Listener, it waits for the next connection which
+// has opened it's stream.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.chConns:
+		return conn, nil
+	case err := <-l.chErr:
+		l.chErr <- err // keep the error for subsequent calls
+		return nil, err
+	case <-l.die:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener
+func (l *Listener) Close() error {
+	l.dieOnce.Do(func() { close(l.die) })
+	return l.listener.Close()
+}
+
+// Addr implements net.Listener
+func (l *Listener) Addr() net.Addr { return l.listener.Addr() }
@@ -0,0 +1,193 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"net"
+	"strings"
+
+	"github.com/yonggewang/bdls"
+)
+
+// AllowNetwork restricts the peers to the IP addresses in the network, as
+// an IP or a CIDR like 10.0.0.0/8, any address is allowed if no networks
+// have been allowed. Addresses without an IP, like unix sockets, are not
+// restricted by networks.
+func (agent *TCPAgent) AllowNetwork(network string) error {
+	ipnet, err := parseNetwork(network)
+	if err != nil {
+		return err
+	}
+	agent.Lock()
+	defer agent.Unlock()
+	agent.allowNets = append(agent.allowNets, ipnet)
+	return nil
+}
+
+// DenyNetwork rejects the peers from the IP addresses in the network, as an
+// IP or a CIDR, it takes precedence over AllowNetwork.
+func (agent *TCPAgent) DenyNetwork(network string) error {
+	ipnet, err := parseNetwork(network)
+	if err != nil {
+		return err
+	}
+	agent.Lock()
+	defer agent.Unlock()
+	agent.denyNets = append(agent.denyNets, ipnet)
+	return nil
+}
+
+// AllowPublicKey restricts the peers to the public keys allowed, either the
+// transport key or the validator key it links, any key is allowed if no
+// keys have been allowed.
+func (agent *TCPAgent) AllowPublicKey(pubkey *ecdsa.PublicKey) {
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.allowKeys == nil {
+		agent.allowKeys = make(map[bdls.Identity]bool)
+	}
+	agent.allowKeys[bdls.DefaultPubKeyToIdentity(pubkey)] = true
+}
+
+// DenyPublicKey rejects the peers authenticating the public key, as the
+// transport key or the validator key it links, it takes precedence over
+// AllowPublicKey.
+func (agent *TCPAgent) DenyPublicKey(pubkey *ecdsa.PublicKey) {
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.denyKeys == nil {
+		agent.denyKeys = make(map[bdls.Identity]bool)
+	}
+	agent.denyKeys[bdls.DefaultPubKeyToIdentity(pubkey)] = true
+}
+
+// ResetACL clears the networks and public keys allowed and denied, the
+// connected peers are not affected.
+func (agent *TCPAgent) ResetACL() {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.allowNets, agent.denyNets = nil, nil
+	agent.allowKeys, agent.denyKeys = nil, nil
+}
+
+// parseNetwork parses an IP or a CIDR to a network
+func parseNetwork(network string) (*net.IPNet, error) {
+	if strings.Contains(network, "/") {
+		_, ipnet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, ErrACLNetwork
+		}
+		return ipnet, nil
+	}
+
+	ip := net.ParseIP(network)
+	if ip == nil {
+		return nil, ErrACLNetwork
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// addrIP returns the IP of addr, or nil if it has no IP.
+func addrIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.IPAddr:
+		return addr.IP
+	}
+	return net.ParseIP(addrHost(addr))
+}
+
+// permitsAddr checks addr against the networks allowed and denied, before
+// any handshake.
+func (agent *TCPAgent) permitsAddr(addr net.Addr) bool {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.permitsAddrLocked(addr)
+}
+
+// permitsAddrLocked is permitsAddr without the agent lock.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) permitsAddrLocked(addr net.Addr) bool {
+	ip := addrIP(addr)
+	if ip == nil {
+		return true
+	}
+
+	for _, ipnet := range agent.denyNets {
+		if ipnet.Contains(ip) {
+			return false
+		}
+	}
+	if len(agent.allowNets) == 0 {
+		return true
+	}
+	for _, ipnet := range agent.allowNets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// deniesKey checks if the public key has been denied
+func (agent *TCPAgent) deniesKey(pubkey *ecdsa.PublicKey) bool {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.denyKeys[bdls.DefaultPubKeyToIdentity(pubkey)]
+}
+
+// permitsKeys checks the keys authenticated by a peer, none of them is
+// denied, and one of them is allowed if any keys have been allowed, nil
+// keys are skipped.
+func (agent *TCPAgent) permitsKeys(keys ...*ecdsa.PublicKey) bool {
+	agent.Lock()
+	defer agent.Unlock()
+
+	allowed := len(agent.allowKeys) == 0
+	for _, key := range keys {
+		if key == nil {
+			continue
+		}
+		id := bdls.DefaultPubKeyToIdentity(key)
+		if agent.denyKeys[id] {
+			return false
+		}
+		allowed = allowed || agent.allowKeys[id]
+	}
+	return allowed
+}
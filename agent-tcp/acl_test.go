@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestACL(t *testing.T) {
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+	l, err := server.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+
+	assert.Equal(t, ErrACLNetwork, server.AllowNetwork("localhost"))
+	assert.Equal(t, ErrACLNetwork, server.DenyNetwork("10.0.0.0/33"))
+
+	// rejected before any handshake
+	rejected := func() bool {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		assert.Nil(t, err)
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _ := io.Copy(io.Discard, conn)
+		return n == 0
+	}
+	assert.Nil(t, server.DenyNetwork("127.0.0.0/8"))
+	assert.True(t, rejected())
+	server.ResetACL()
+	assert.Nil(t, server.AllowNetwork("10.0.0.0/8"))
+	assert.True(t, rejected())
+	// denied networks take precedence
+	assert.Nil(t, server.AllowNetwork("127.0.0.1"))
+	assert.Nil(t, server.DenyNetwork("127.0.0.1/32"))
+	assert.True(t, rejected())
+
+	server.ResetACL()
+	assert.Nil(t, server.AllowNetwork("::1"))
+	assert.Nil(t, server.AllowNetwork("127.0.0.1"))
+	assert.False(t, rejected())
+
+	// addresses without IP are not restricted by networks
+	c1, c2 := net.Pipe()
+	p := NewTCPPeer(c1, server)
+	assert.True(t, server.AddPeer(p))
+	p.Close()
+	c2.Close()
+
+	// public keys
+	allowedKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	otherKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	server.AllowPublicKey(&allowedKey.PublicKey)
+
+	connect := func(key *ecdsa.PrivateKey) bool {
+		client := newTestAgent(t, key)
+		defer client.Close()
+		p, err := client.Connect(context.Background(), l.Addr().String(), &serverKey.PublicKey)
+		if err != nil {
+			return false
+		}
+		// the server may close before or after the client has authenticated it
+		select {
+		case <-p.die:
+			return false
+		case <-time.After(500 * time.Millisecond):
+			return true
+		}
+	}
+	assert.False(t, connect(otherKey))
+	assert.True(t, connect(allowedKey))
+	server.DenyPublicKey(&allowedKey.PublicKey)
+	assert.False(t, connect(allowedKey))
+
+	// either the transport key or the validator key it links
+	server.ResetACL()
+	server.AllowPublicKey(&allowedKey.PublicKey)
+	assert.True(t, server.permitsKeys(&otherKey.PublicKey, &allowedKey.PublicKey))
+	assert.False(t, server.permitsKeys(&otherKey.PublicKey, nil))
+	server.DenyPublicKey(&otherKey.PublicKey)
+	assert.False(t, server.permitsKeys(&otherKey.PublicKey, &allowedKey.PublicKey))
+}
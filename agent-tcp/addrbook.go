@@ -0,0 +1,261 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yonggewang/bdls/internal/identity"
+)
+
+const (
+	// DefaultAddressMaxAge is the default time a peer address not seen is
+	// kept in the address book
+	DefaultAddressMaxAge = 7 * 24 * time.Hour
+)
+
+// AddressBookEntry is the address of a peer this agent has dialed
+type AddressBookEntry struct {
+	Address   string    `json:"address"`
+	PublicKey string    `json:"pubkey,omitempty"` // hex encoded X|Y of the identity authenticated
+	LastSeen  time.Time `json:"last_seen"`        // the last time the peer was connected
+
+	// the result of the last handshake, the error is empty if it succeeded
+	LastHandshake  time.Time `json:"last_handshake,omitempty"`
+	HandshakeError string    `json:"handshake_error,omitempty"`
+}
+
+// addressBookFile is the on-disk format of the address book
+type addressBookFile struct {
+	Peers []AddressBookEntry `json:"peers"`
+	Bans  []Ban              `json:"bans"`
+}
+
+// addressBook records the peer addresses & bans from the peer events
+type addressBook struct {
+	path    string
+	maxAge  time.Duration
+	entries map[string]*AddressBookEntry
+	sync.Mutex
+
+	saveLock sync.Mutex    // serializes the saves
+	done     chan struct{} // closed after the last save once the agent is closed
+}
+
+// SetAddressBook keeps the addresses dialed by this agent, the identities
+// they have authenticated, the results of the handshakes and the bans in
+// the file at path, so a restarted node can reconnect to the network and
+// keep honoring the bans. If the file exists, the bans in effect are
+// restored, and the addresses which have authenticated in their last
+// handshake and have been seen within maxAge are re-dialed as persistent
+// peers expecting the same identities. The file is rewritten atomically on
+// the peer events, Unban, and when the agent is closed. It's set once.
+func (agent *TCPAgent) SetAddressBook(path string, maxAge time.Duration) error {
+	book := &addressBook{path: path, maxAge: maxAge, entries: make(map[string]*AddressBookEntry), done: make(chan struct{})}
+	if err := book.load(agent); err != nil {
+		return err
+	}
+
+	agent.Lock()
+	agent.addressBook = book
+	agent.Unlock()
+	go book.run(agent)
+	return nil
+}
+
+// AddressBook returns the entries of the address book, in the order last
+// seen, or nil if it's not set.
+func (agent *TCPAgent) AddressBook() []AddressBookEntry {
+	agent.Lock()
+	book := agent.addressBook
+	agent.Unlock()
+	if book == nil {
+		return nil
+	}
+	return book.list()
+}
+
+// load restores the bans & persistent peers of the address book file, a
+// missing file is an empty book.
+func (book *addressBook) load(agent *TCPAgent) error {
+	bts, err := os.ReadFile(book.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var file addressBookFile
+	if err := json.Unmarshal(bts, &file); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	agent.Lock()
+	for k := range file.Bans {
+		if ban := file.Bans[k]; ban.Until.After(now) {
+			agent.bans[ban.Host] = &ban
+		}
+	}
+	agent.Unlock()
+
+	for k := range file.Peers {
+		entry := file.Peers[k]
+		if now.Sub(entry.LastSeen) > book.maxAge {
+			continue
+		}
+		book.entries[entry.Address] = &entry
+		if entry.PublicKey == "" || entry.HandshakeError != "" {
+			continue
+		}
+		pubkey, err := identity.Decode(entry.PublicKey)
+		if err != nil {
+			log.Println("address book:", entry.Address, err)
+			continue
+		}
+		agent.addPersistentPeer(entry.Address, nil, pubkey, nil)
+	}
+	return nil
+}
+
+// run records the peer events until the agent is closed
+func (book *addressBook) run(agent *TCPAgent) {
+	defer close(book.done)
+	for {
+		sub := agent.SubscribePeerEvents()
+		for e := range sub.C {
+			if book.record(e) {
+				book.save(agent)
+			}
+		}
+		book.save(agent)
+		// resubscribe if it fell behind
+		if sub.Err() == nil {
+			return
+		}
+	}
+}
+
+// record updates the entry of an outbound peer from an event, and returns
+// true if the book should be saved.
+func (book *addressBook) record(e PeerEvent) bool {
+	if e.Type == PeerBanned {
+		return true
+	}
+	if !e.Outbound {
+		return false
+	}
+
+	book.Lock()
+	defer book.Unlock()
+	entry, ok := book.entries[e.Address]
+	if !ok {
+		entry = &AddressBookEntry{Address: e.Address}
+		book.entries[e.Address] = entry
+	}
+	entry.LastSeen = e.Time
+	switch e.Type {
+	case PeerAuthenticated:
+		entry.PublicKey = e.PublicKey
+		entry.LastHandshake = e.Time
+		entry.HandshakeError = ""
+	case PeerHandshakeFailed:
+		entry.LastHandshake = e.Time
+		entry.HandshakeError = e.Error
+	case PeerConnected:
+		return false
+	}
+	return true
+}
+
+// list returns the entries in the order last seen
+func (book *addressBook) list() []AddressBookEntry {
+	book.Lock()
+	defer book.Unlock()
+	entries := make([]AddressBookEntry, 0, len(book.entries))
+	for _, entry := range book.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastSeen.After(entries[j].LastSeen) })
+	return entries
+}
+
+// save writes the entries seen within the max age and the bans in effect
+// to the file, atomically.
+func (book *addressBook) save(agent *TCPAgent) {
+	book.saveLock.Lock()
+	defer book.saveLock.Unlock()
+
+	now := time.Now()
+	book.Lock()
+	for addr, entry := range book.entries {
+		if now.Sub(entry.LastSeen) > book.maxAge {
+			delete(book.entries, addr)
+		}
+	}
+	book.Unlock()
+
+	bts, err := json.MarshalIndent(&addressBookFile{Peers: book.list(), Bans: agent.Bans()}, "", "  ")
+	if err != nil {
+		log.Println("address book:", err)
+		return
+	}
+	if err := writeFileAtomic(book.path, bts); err != nil {
+		log.Println("address book:", err)
+	}
+}
+
+// writeFileAtomic replaces the file at path with data
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/internal/identity"
+)
+
+func TestAddressBook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "addrbook.json")
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+	lb, err := b.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+
+	a := newTestAgent(t, keyA)
+	assert.Nil(t, a.SetAddressBook(path, DefaultAddressMaxAge))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = a.Connect(ctx, lb.Addr().String(), &keyB.PublicKey)
+	assert.Nil(t, err)
+	a.Ban("192.0.2.1", time.Hour)
+
+	// the dialed address, it's identity & the ban are kept on disk
+	var file addressBookFile
+	assert.Eventually(t, func() bool {
+		bts, err := os.ReadFile(path)
+		return err == nil && json.Unmarshal(bts, &file) == nil && len(file.Peers) == 1 && len(file.Bans) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, lb.Addr().String(), file.Peers[0].Address)
+	assert.Equal(t, identity.Encode(&keyB.PublicKey), file.Peers[0].PublicKey)
+	assert.Equal(t, "", file.Peers[0].HandshakeError)
+	assert.Equal(t, "192.0.2.1", file.Bans[0].Host)
+	a.Close()
+	<-a.addressBook.done
+
+	// a restarted node reconnects and keeps the bans
+	a2 := newTestAgent(t, keyA)
+	assert.Nil(t, a2.SetAddressBook(path, DefaultAddressMaxAge))
+	defer func() {
+		a2.Close()
+		<-a2.addressBook.done
+	}()
+	assert.True(t, a2.hostBanned("192.0.2.1"))
+	assert.Eventually(t, func() bool { return a2.NumPeers() == 1 }, 5*time.Second, 10*time.Millisecond)
+	entries := a2.AddressBook()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, lb.Addr().String(), entries[0].Address)
+	}
+
+	// unbanning is kept too
+	a2.Unban("192.0.2.1")
+	assert.Eventually(t, func() bool {
+		bts, err := os.ReadFile(path)
+		file.Bans = nil
+		return err == nil && json.Unmarshal(bts, &file) == nil && len(file.Bans) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
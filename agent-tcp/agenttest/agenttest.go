@@ -0,0 +1,235 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package agenttest provides a test double of the consensus core for the
+// tests of the transport.
+package agenttest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/crypto/blake2b"
+)
+
+// MockConsensus implements agent.Consensus without keys, participants or
+// rounds, it records the messages delivered by the agent and the peers
+// joined, so framing & queueing can be tested in isolation. It's safe for
+// concurrent use.
+type MockConsensus struct {
+	participants []bdls.Identity
+	height       uint64
+	round        uint64
+	state        bdls.State
+	proposals    []bdls.State
+	messages     [][]byte
+	peers        []bdls.PeerInterface
+	updates      int
+	verified     int
+	receiveErr   error
+	sync.Mutex
+}
+
+// NewMockConsensus creates a MockConsensus of the participants, which only
+// matter for the quorum and to the agent checking them.
+func NewMockConsensus(participants ...bdls.Identity) *MockConsensus {
+	return &MockConsensus{participants: participants}
+}
+
+// Update counts the calls, see Updates
+func (m *MockConsensus) Update(now time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	m.updates++
+	return nil
+}
+
+// ReceiveMessage records the message, and returns the error set by
+// SetReceiveError.
+func (m *MockConsensus) ReceiveMessage(bts []byte, now time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	m.messages = append(m.messages, append([]byte(nil), bts...))
+	return m.receiveErr
+}
+
+// ReceiveAuthenticatedMessage is ReceiveMessage, the sender is ignored
+func (m *MockConsensus) ReceiveAuthenticatedMessage(bts []byte, sender *ecdsa.PublicKey, now time.Time) error {
+	return m.ReceiveMessage(bts, now)
+}
+
+// ApplyDecide is ReceiveMessage, the messages are not propagated anyway
+func (m *MockConsensus) ApplyDecide(bts []byte, now time.Time) error {
+	return m.ReceiveMessage(bts, now)
+}
+
+// VerifyMessages does nothing, the messages are not verified
+func (m *MockConsensus) VerifyMessages(msgs [][]byte) {}
+
+// VerifySignature counts the calls, see Verified, the signatures are valid
+func (m *MockConsensus) VerifySignature(signed *bdls.SignedProto) bool {
+	m.Lock()
+	defer m.Unlock()
+	m.verified++
+	return true
+}
+
+// Join adds a peer, identified by its address
+func (m *MockConsensus) Join(p bdls.PeerInterface) bool {
+	m.Lock()
+	defer m.Unlock()
+	for k := range m.peers {
+		if p.RemoteAddr().String() == m.peers[k].RemoteAddr().String() {
+			return false
+		}
+	}
+	m.peers = append(m.peers, p)
+	return true
+}
+
+// Leave removes a peer, identified by its address
+func (m *MockConsensus) Leave(addr net.Addr) bool {
+	m.Lock()
+	defer m.Unlock()
+	for k := range m.peers {
+		if addr.String() == m.peers[k].RemoteAddr().String() {
+			copy(m.peers[k:], m.peers[k+1:])
+			m.peers = m.peers[:len(m.peers)-1]
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentState returns the state set by SetState
+func (m *MockConsensus) CurrentState() (height uint64, round uint64, data bdls.State) {
+	m.Lock()
+	defer m.Unlock()
+	return m.height, m.round, m.state
+}
+
+// CurrentProof returns nil, there are no proofs without rounds
+func (m *MockConsensus) CurrentProof() *bdls.SignedProto { return nil }
+
+// Propose records the state, see HasProposed
+func (m *MockConsensus) Propose(s bdls.State) error {
+	m.Lock()
+	defer m.Unlock()
+	m.proposals = append(m.proposals, append(bdls.State(nil), s...))
+	return nil
+}
+
+// HasProposed checks whether the state has been proposed
+func (m *MockConsensus) HasProposed(s bdls.State) bool {
+	m.Lock()
+	defer m.Unlock()
+	for _, p := range m.proposals {
+		if bytes.Equal(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// StateHash returns the blake2b-256 of the state, the default of the core
+func (m *MockConsensus) StateHash(s bdls.State) bdls.StateHash { return blake2b.Sum256(s) }
+
+// Participants returns the participants of NewMockConsensus
+func (m *MockConsensus) Participants() []bdls.Identity { return m.participants }
+
+// Quorum returns 2t+1 of the participants
+func (m *MockConsensus) Quorum() int { return 2*((len(m.participants)-1)/3) + 1 }
+
+// Weight returns 1, the participants are not weighted
+func (m *MockConsensus) Weight(id bdls.Identity) uint64 { return 1 }
+
+// LeaderGone does nothing
+func (m *MockConsensus) LeaderGone(id bdls.Identity) {}
+
+// CurrentBeacon returns bdls.ErrBeaconNotFound, there are no proofs
+func (m *MockConsensus) CurrentBeacon() (*bdls.Beacon, error) { return nil, bdls.ErrBeaconNotFound }
+
+// Profiler returns nil, profiling is disabled
+func (m *MockConsensus) Profiler() *bdls.Profiler { return nil }
+
+// SetState sets the latest height decided & it's state
+func (m *MockConsensus) SetState(height uint64, round uint64, data bdls.State) {
+	m.Lock()
+	defer m.Unlock()
+	m.height, m.round, m.state = height, round, data
+}
+
+// SetReceiveError sets the error returned by ReceiveMessage, like the
+// errors of the consensus core rejecting a message.
+func (m *MockConsensus) SetReceiveError(err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.receiveErr = err
+}
+
+// Messages returns the messages received, in order
+func (m *MockConsensus) Messages() [][]byte {
+	m.Lock()
+	defer m.Unlock()
+	return append([][]byte(nil), m.messages...)
+}
+
+// Peers returns the peers joined
+func (m *MockConsensus) Peers() []bdls.PeerInterface {
+	m.Lock()
+	defer m.Unlock()
+	return append([]bdls.PeerInterface(nil), m.peers...)
+}
+
+// Updates returns the number of calls to Update
+func (m *MockConsensus) Updates() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.updates
+}
+
+// Verified returns the number of calls to VerifySignature
+func (m *MockConsensus) Verified() int {
+	m.Lock()
+	defer m.Unlock()
+	return m.verified
+}
+
+// Broadcast sends msg to all the peers joined, like the consensus core
+// broadcasting a message.
+func (m *MockConsensus) Broadcast(msg []byte) {
+	for _, p := range m.Peers() {
+		p.Send(msg)
+	}
+}
@@ -0,0 +1,94 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/yonggewang/bdls"
+)
+
+// BeaconStatus is the randomness beacon of the latest height, along with the
+// <decide> message to verify it by bdls.Consensus.ValidateBeacon
+type BeaconStatus struct {
+	Height       uint64   `json:"height"`
+	Randomness   string   `json:"randomness"`
+	Contributors []string `json:"contributors"`
+	Proof        string   `json:"proof"`
+}
+
+// CurrentBeacon returns the randomness beacon of the latest height decided,
+// the consensus must be configured with bdls.Config.EnableBeacon.
+func (agent *TCPAgent) CurrentBeacon() (*bdls.Beacon, error) {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.consensus.CurrentBeacon()
+}
+
+// BeaconHandler serves the randomness beacon of the latest height as JSON,
+// with the <decide> message proving it in hex.
+func (agent *TCPAgent) BeaconHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		agent.Lock()
+		beacon, err := agent.consensus.CurrentBeacon()
+		proof := agent.consensus.CurrentProof()
+		agent.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		bts, err := proto.Marshal(proof)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		status := BeaconStatus{
+			Height:     beacon.Height,
+			Randomness: hex.EncodeToString(beacon.Randomness[:]),
+			Proof:      hex.EncodeToString(bts),
+		}
+		for _, id := range beacon.Contributors {
+			status.Contributors = append(status.Contributors, hex.EncodeToString(id[:]))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	})
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	io "io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestBeaconHandler(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	agents := make([]*TCPAgent, len(participants))
+	for i := range participants {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = participants[i]
+		config.Participants = coords
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		config.EnableBeacon = true
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		consensus.SetLatency(200 * time.Millisecond)
+		agents[i] = NewTCPAgent(consensus, participants[i])
+		defer agents[i].Close()
+	}
+
+	// nothing decided yet
+	rec := httptest.NewRecorder()
+	agents[0].BeaconHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/beacon", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	for i := 0; i < len(agents); i++ {
+		for j := i + 1; j < len(agents); j++ {
+			c1, c2 := net.Pipe()
+			p1 := NewTCPPeer(c1, agents[i])
+			p2 := NewTCPPeer(c2, agents[j])
+			assert.True(t, agents[i].AddPeer(p1))
+			assert.True(t, agents[j].AddPeer(p2))
+			p1.InitiatePublicKeyAuthentication()
+			p2.InitiatePublicKeyAuthentication()
+		}
+	}
+	for i := range agents {
+		agents[i].Update()
+		data := make([]byte, 1024)
+		io.ReadFull(rand.Reader, data)
+		agents[i].Propose(data)
+	}
+	assert.Eventually(t, func() bool { h, _, _ := agents[0].GetLatestState(); return h > 0 }, 20*time.Second, 20*time.Millisecond)
+
+	// the beacon is served with the <decide> message proving it
+	rec = httptest.NewRecorder()
+	agents[0].BeaconHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/beacon", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var status BeaconStatus
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	beacon, err := agents[0].CurrentBeacon()
+	assert.Nil(t, err)
+	assert.Equal(t, beacon.Height, status.Height)
+	assert.Equal(t, hex.EncodeToString(beacon.Randomness[:]), status.Randomness)
+	assert.Equal(t, len(beacon.Contributors), len(status.Contributors))
+	proof, err := hex.DecodeString(status.Proof)
+	assert.Nil(t, err)
+	sp, err := bdls.DecodeSignedMessage(proof)
+	assert.Nil(t, err)
+	m, err := bdls.DecodeMessage(sp.Message)
+	assert.Nil(t, err)
+	assert.Equal(t, beacon.Height, m.Height)
+
+	rec = httptest.NewRecorder()
+	agents[0].BeaconHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/beacon", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,112 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/hex"
+	"math/bits"
+
+	"github.com/yonggewang/bdls"
+)
+
+// Bitmap is the participation of the participants in a height, bit i of
+// byte i/8 is set if the i-th participant, in order of Config.Participants,
+// has signed a <commit> message in the proof. It's encoded as hex in json.
+type Bitmap []byte
+
+// Participation returns the participation bitmap of a marshalled <decide>
+// message, the proof must have been verified, like the ones delivered in
+// Decision or by standby nodes after Consensus.ReceiveMessage.
+func Participation(proof []byte, participants []bdls.Identity) (Bitmap, error) {
+	_, m := decodeMessage(proof)
+	if m == nil || m.Type != bdls.MessageType_Decide {
+		return nil, ErrProofMalformed
+	}
+
+	// the signers of an aggregated BLS signature, or of the partials combined
+	// into a threshold signature, are in the same order
+	bitmap := make(Bitmap, (len(participants)+7)/8)
+	if len(m.Signers) > 0 {
+		copy(bitmap, m.Signers)
+		return bitmap, nil
+	}
+
+	index := make(map[bdls.Identity]int, len(participants))
+	for i, id := range participants {
+		index[id] = i
+	}
+	for _, commit := range m.Proof {
+		if i, ok := index[bdls.DefaultPubKeyToIdentity(commit.PublicKey(bdls.S256Curve))]; ok {
+			bitmap[i/8] |= 1 << (i % 8)
+		}
+	}
+	return bitmap, nil
+}
+
+// Has returns if the i-th participant has participated
+func (b Bitmap) Has(i int) bool {
+	return i >= 0 && i/8 < len(b) && b[i/8]&(1<<(i%8)) != 0
+}
+
+// Count returns the number of participants that have participated
+func (b Bitmap) Count() int {
+	n := 0
+	for _, x := range b {
+		n += bits.OnesCount8(x)
+	}
+	return n
+}
+
+// Signers returns the participants that have participated
+func (b Bitmap) Signers(participants []bdls.Identity) []bdls.Identity {
+	var signers []bdls.Identity
+	for i, id := range participants {
+		if b.Has(i) {
+			signers = append(signers, id)
+		}
+	}
+	return signers
+}
+
+// MarshalText implements encoding.TextMarshaler, as hex
+func (b Bitmap) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (b *Bitmap) UnmarshalText(text []byte) error {
+	bts, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*b = bts
+	return nil
+}
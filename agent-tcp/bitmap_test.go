@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestParticipationBitmap(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < 10; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, key)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+
+	// commits of participants 1, 8 & 9, and a key not in the participants
+	outsider, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	decide := bdls.Message{Type: bdls.MessageType_Decide, Height: 1, State: []byte("state")}
+	for _, key := range []*ecdsa.PrivateKey{keys[1], keys[8], keys[9], outsider} {
+		signed := new(bdls.SignedProto)
+		signed.Sign(&bdls.Message{Type: bdls.MessageType_Commit, Height: 1, State: decide.State}, key)
+		decide.Proof = append(decide.Proof, signed)
+	}
+	signed := new(bdls.SignedProto)
+	signed.Sign(&decide, keys[0])
+	proof, err := proto.Marshal(signed)
+	assert.Nil(t, err)
+
+	bitmap, err := Participation(proof, participants)
+	assert.Nil(t, err)
+	assert.Equal(t, Bitmap{0x02, 0x03}, bitmap)
+	assert.Equal(t, 3, bitmap.Count())
+	assert.True(t, bitmap.Has(8))
+	assert.False(t, bitmap.Has(0))
+	assert.False(t, bitmap.Has(16))
+	assert.Equal(t, []bdls.Identity{participants[1], participants[8], participants[9]}, bitmap.Signers(participants))
+
+	// encoded as hex in json
+	bts, err := json.Marshal(&Decision{Participation: bitmap})
+	assert.Nil(t, err)
+	assert.Contains(t, string(bts), `"participation":"0203"`)
+	var d Decision
+	assert.Nil(t, json.Unmarshal(bts, &d))
+	assert.Equal(t, bitmap, d.Participation)
+
+	// only <decide> messages
+	commit, err := proto.Marshal(decide.Proof[0])
+	assert.Nil(t, err)
+	_, err = Participation(commit, participants)
+	assert.Equal(t, ErrProofMalformed, err)
+	_, err = Participation([]byte("proof"), participants)
+	assert.Equal(t, ErrProofMalformed, err)
+}
+
+func TestParticipationThreshold(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < 4; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, key)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+	pk, shares, err := bdls.GenerateThresholdKeys(3, len(keys), rand.Reader)
+	assert.Nil(t, err)
+
+	epoch := time.Now()
+	var consensus []*bdls.Consensus
+	var peers []*bdls.IPCPeer
+	for i := range keys {
+		config := new(bdls.Config)
+		config.Epoch = epoch
+		config.PrivateKey = keys[i]
+		config.Participants = participants
+		config.ExperimentalBN256 = true
+		config.ThresholdKey = shares[i]
+		config.ThresholdPublicKey = pk
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		c, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		c.SetLatency(50 * time.Millisecond)
+		consensus = append(consensus, c)
+		peers = append(peers, bdls.NewIPCPeer(c, 10*time.Millisecond))
+	}
+	for i := range peers {
+		for j := range peers {
+			if i != j {
+				assert.True(t, consensus[i].Join(peers[j]))
+			}
+		}
+	}
+	defer func() {
+		for i := range peers {
+			peers[i].Close()
+		}
+	}()
+	for i := range peers {
+		peers[i].Update()
+		assert.Nil(t, peers[i].Propose([]byte{byte(i)}))
+	}
+	assert.Eventually(t, func() bool { h, _, _ := peers[0].GetLatestState(); return h > 0 }, 20*time.Second, 20*time.Millisecond)
+
+	// the signers of the partials combined into the threshold signature
+	peers[0].Lock()
+	proof, err := proto.Marshal(consensus[0].CurrentProof())
+	peers[0].Unlock()
+	assert.Nil(t, err)
+	bitmap, err := Participation(proof, participants)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, bitmap.Count())
+	assert.Len(t, bitmap.Signers(participants), 3)
+}
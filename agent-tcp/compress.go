@@ -0,0 +1,142 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// DefaultCompressionThreshold is the min size of messages to compress
+	DefaultCompressionThreshold = 1024
+)
+
+var (
+	// encoder & decoder are safe for concurrent EncodeAll & DecodeAll
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxMessageLength), zstd.WithDecoderConcurrency(0))
+
+	// the compressions supported, in order of preference
+	defaultCompressions = []CompressionType{CompressionType_ZSTD, CompressionType_SNAPPY}
+)
+
+// SetCompression sets the compression algorithms offered to peers in the
+// handshake, in order of preference, the first one supported by a peer is
+// used for the messages sent to it above threshold bytes. No algorithms to
+// disable the compression. Both ZSTD and SNAPPY are offered by default.
+//
+// It applies to the connections authenticated afterwards.
+func (agent *TCPAgent) SetCompression(threshold int, compressions ...CompressionType) error {
+	for _, c := range compressions {
+		if c != CompressionType_ZSTD && c != CompressionType_SNAPPY {
+			return ErrCompressionType
+		}
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	agent.compressions = compressions
+	agent.compressionThreshold = threshold
+	return nil
+}
+
+// getCompression returns the compressions offered and the threshold
+func (agent *TCPAgent) getCompression() ([]CompressionType, int) {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.compressions, agent.compressionThreshold
+}
+
+// negotiateCompression returns the first algorithm of local supported by
+// remote
+func negotiateCompression(local []CompressionType, remote []CompressionType) CompressionType {
+	for _, l := range local {
+		for _, r := range remote {
+			if l == r {
+				return l
+			}
+		}
+	}
+	return CompressionType_NONE
+}
+
+// compress compresses the message of a gossip, and keeps it as is if it's
+// not smaller.
+func compress(msg *Gossip, compression CompressionType) {
+	var out []byte
+	switch compression {
+	case CompressionType_ZSTD:
+		out = zstdEncoder.EncodeAll(msg.Message, nil)
+	case CompressionType_SNAPPY:
+		out = snappy.Encode(nil, msg.Message)
+	default:
+		return
+	}
+
+	if len(out) < len(msg.Message) {
+		msg.Message = out
+		msg.Compression = compression
+	}
+}
+
+// decompress restores the message of a gossip, the decompressed size is
+// limited to MaxMessageLength.
+func decompress(msg *Gossip) error {
+	var out []byte
+	var err error
+	switch msg.Compression {
+	case CompressionType_NONE:
+		return nil
+	case CompressionType_ZSTD:
+		out, err = zstdDecoder.DecodeAll(msg.Message, nil)
+	case CompressionType_SNAPPY:
+		var n int
+		if n, err = snappy.DecodedLen(msg.Message); err == nil {
+			if n > MaxMessageLength {
+				return ErrMessageLengthExceed
+			}
+			out, err = snappy.Decode(nil, msg.Message)
+		}
+	default:
+		return ErrCompressionType
+	}
+	if err != nil {
+		return err
+	}
+	if len(out) > MaxMessageLength {
+		return ErrMessageLengthExceed
+	}
+
+	msg.Message = out
+	msg.Compression = CompressionType_NONE
+	return nil
+}
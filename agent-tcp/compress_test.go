@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestCompress(t *testing.T) {
+	data := bytes.Repeat([]byte("commit proof "), 1024)
+	for _, compression := range []CompressionType{CompressionType_ZSTD, CompressionType_SNAPPY} {
+		msg := Gossip{Command: CommandType_CONSENSUS, Message: data}
+		compress(&msg, compression)
+		assert.Equal(t, compression, msg.Compression)
+		assert.Less(t, len(msg.Message), len(data))
+
+		assert.Nil(t, decompress(&msg))
+		assert.Equal(t, CompressionType_NONE, msg.Compression)
+		assert.Equal(t, data, msg.Message)
+	}
+
+	// incompressible messages are kept as is
+	random := make([]byte, 1024)
+	io.ReadFull(rand.Reader, random)
+	msg := Gossip{Message: random}
+	compress(&msg, CompressionType_ZSTD)
+	assert.Equal(t, CompressionType_NONE, msg.Compression)
+	assert.Equal(t, random, msg.Message)
+
+	// decompressed size is limited
+	msg = Gossip{Message: snappy.Encode(nil, make([]byte, MaxMessageLength+1)), Compression: CompressionType_SNAPPY}
+	assert.Equal(t, ErrMessageLengthExceed, decompress(&msg))
+	msg = Gossip{Message: zstdEncoder.EncodeAll(make([]byte, MaxMessageLength+1), nil), Compression: CompressionType_ZSTD}
+	assert.NotNil(t, decompress(&msg))
+	msg = Gossip{Message: random, Compression: CompressionType(100)}
+	assert.Equal(t, ErrCompressionType, decompress(&msg))
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	connect := func(a1, a2 *TCPAgent) (*TCPPeer, *TCPPeer) {
+		c1, c2 := net.Pipe()
+		p1 := NewTCPPeer(c1, a1)
+		p2 := NewTCPPeer(c2, a2)
+		p1.InitiatePublicKeyAuthentication()
+		p2.InitiatePublicKeyAuthentication()
+		assert.Nil(t, a1.waitAuthenticated(p1, nil, time.Second, nil))
+		assert.Nil(t, a2.waitAuthenticated(p2, nil, time.Second, nil))
+		return p1, p2
+	}
+
+	newAgent := func() *TCPAgent {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		agent := newTestAgent(t, key)
+		t.Cleanup(func() { agent.Close() })
+		return agent
+	}
+
+	// both prefer zstd by default
+	a1, a2 := newAgent(), newAgent()
+	p1, p2 := connect(a1, a2)
+	assert.Equal(t, CompressionType_ZSTD, p1.compression)
+	assert.Equal(t, CompressionType_ZSTD, p2.compression)
+
+	// snappy only on one side
+	a3 := newAgent()
+	assert.Nil(t, a3.SetCompression(DefaultCompressionThreshold, CompressionType_SNAPPY))
+	p1, p3 := connect(a1, a3)
+	assert.Equal(t, CompressionType_SNAPPY, p1.compression)
+	assert.Equal(t, CompressionType_SNAPPY, p3.compression)
+
+	// disabled on one side
+	a4 := newAgent()
+	assert.Nil(t, a4.SetCompression(0))
+	p1, p4 := connect(a1, a4)
+	assert.Equal(t, CompressionType_NONE, p1.compression)
+	assert.Equal(t, CompressionType_NONE, p4.compression)
+
+	assert.Equal(t, ErrCompressionType, a4.SetCompression(0, CompressionType_NONE))
+
+	// compressed frames are restored by the receiver, the connection would
+	// be closed otherwise
+	p1, p2 = connect(a1, a2)
+	assert.Nil(t, p1.Send(bytes.Repeat([]byte("commit proof "), 1024)))
+	select {
+	case <-p2.die:
+		t.Fatal("connection closed")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
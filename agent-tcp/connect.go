@@ -0,0 +1,155 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"time"
+
+	"github.com/yonggewang/bdls/transport"
+)
+
+const (
+	// default timeout for the peer to authenticate
+	defaultHandshakeTimeout = 10 * time.Second
+)
+
+// Connect dials addr over TCP, or the transport set by SetDialer, authenticates this agent to the peer, and
+// waits for the peer to authenticate as expected, the identity to expect
+// is the validator key if the peer links it's transport key. The peer
+// joins the consensus only after it has been verified.
+//
+// The peer must initiate it's own authentication once connected, as in
+// Serve. If ctx has no deadline, the handshake times out after the timeout
+// set by SetHandshakeTimeout.
+func (agent *TCPAgent) Connect(ctx context.Context, addr string, expected *ecdsa.PublicKey) (*TCPPeer, error) {
+	return agent.ConnectTransport(ctx, agent.getDialer(), addr, expected)
+}
+
+// SetDialer sets the transport for Connect and persistent peers to dial
+// through, e.g. a transport.SOCKS5 proxy, nil to dial TCP directly.
+func (agent *TCPAgent) SetDialer(tr transport.Transport) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.dialer = tr
+}
+
+// getDialer returns the transport set by SetDialer, or TCP, from the punch
+// port if set
+func (agent *TCPAgent) getDialer() transport.Transport {
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.dialer == nil {
+		if tr := agent.punchTransport(); tr != nil {
+			return tr
+		}
+		return new(transport.TCP)
+	}
+	return agent.dialer
+}
+
+// ConnectTransport is like Connect, but dials addr with tr, so the peer
+// could be on any transport, the listening side should Serve the listener
+// of the same transport.
+func (agent *TCPAgent) ConnectTransport(ctx context.Context, tr transport.Transport, addr string, expected *ecdsa.PublicKey) (*TCPPeer, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, agent.getHandshakeTimeout())
+		defer cancel()
+	}
+
+	conn, err := tr.Dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := agent.NewPeer(conn, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.InitiatePublicKeyAuthentication(); err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	if err := agent.waitAuthenticated(p, expected, 0, ctx.Done()); err != nil {
+		p.Close()
+		if err == errHandshakeCanceled {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	if !agent.AddPeer(p) {
+		p.Close()
+		return nil, ErrPeerJoin
+	}
+	return p, nil
+}
+
+// waitAuthenticated waits for the peer to authenticate itself, and verifies
+// the identity if expected is not nil. It times out after timeout, or never
+// if it's 0, and returns errHandshakeCanceled once cancel is closed.
+func (agent *TCPAgent) waitAuthenticated(p *TCPPeer, expected *ecdsa.PublicKey, timeout time.Duration, cancel <-chan struct{}) error {
+	var chTimeout <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		chTimeout = timer.C
+	}
+
+	select {
+	case <-p.chAuthenticated:
+	case <-p.die:
+		select {
+		case <-p.chAuthenticated: // closed after authentication
+		default:
+			p.reportHandshakeFailure(ErrPeerAuthenticatedFailed)
+		}
+		return ErrPeerAuthenticatedFailed
+	case <-chTimeout:
+		p.reportHandshakeFailure(ErrHandshakeTimeout)
+		return ErrHandshakeTimeout
+	case <-cancel:
+		return errHandshakeCanceled
+	case <-agent.die:
+		return errHandshakeCanceled
+	}
+
+	if expected != nil {
+		if pubkey := p.GetPublicKey(); pubkey.X.Cmp(expected.X) != 0 || pubkey.Y.Cmp(expected.Y) != 0 {
+			p.reportHandshakeFailure(ErrPeerPublicKeyMismatch)
+			return ErrPeerPublicKeyMismatch
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/transport"
+)
+
+func TestConnect(t *testing.T) {
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	clientKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+	client := newTestAgent(t, clientKey)
+	defer client.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	// a silent listener never authenticates itself
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer silent.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			p := NewTCPPeer(conn, server)
+			server.AddPeer(p)
+			p.InitiatePublicKeyAuthentication()
+		}
+	}()
+
+	p, err := client.Connect(context.Background(), l.Addr().String(), &serverKey.PublicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, &serverKey.PublicKey, p.GetPublicKey())
+	client.Lock()
+	assert.Equal(t, 1, len(client.peers))
+	client.Unlock()
+
+	// unexpected identity, the server may replace the first connection with
+	// this one before it's rejected, but it never joins
+	_, err = client.Connect(context.Background(), l.Addr().String(), &clientKey.PublicKey)
+	assert.Equal(t, ErrPeerPublicKeyMismatch, err)
+	client.Lock()
+	for _, other := range client.peers {
+		assert.Equal(t, p, other)
+	}
+	client.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = client.Connect(ctx, silent.Addr().String(), &serverKey.PublicKey)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestConnectTransport(t *testing.T) {
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	clientKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+	client := newTestAgent(t, clientKey)
+	defer client.Close()
+
+	memory := transport.NewMemory()
+	l, err := memory.Listen("server")
+	assert.Nil(t, err)
+	go server.Serve(l)
+
+	p, err := client.ConnectTransport(context.Background(), memory, "server", &serverKey.PublicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, &serverKey.PublicKey, p.GetPublicKey())
+
+	_, err = client.ConnectTransport(context.Background(), memory, "nobody", nil)
+	assert.Equal(t, transport.ErrConnectionRefused, err)
+}
+
+func TestSetDialer(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a := newTestAgent(t, keyA)
+	defer a.Close()
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+
+	// the address is only reachable by the dialer set
+	network := transport.NewMemory()
+	l, err := network.Listen("b")
+	assert.Nil(t, err)
+	go b.Serve(l)
+
+	_, err = a.Connect(context.Background(), "b", &keyB.PublicKey)
+	assert.NotNil(t, err)
+
+	a.SetDialer(network)
+	p, err := a.Connect(context.Background(), "b", &keyB.PublicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, &keyB.PublicKey, p.GetPublicKey())
+
+	// persistent peers dial with it too
+	waitPeers := func(n int) bool {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			b.Lock()
+			m := len(b.peers)
+			b.Unlock()
+			if m == n {
+				return true
+			}
+			<-time.After(20 * time.Millisecond)
+		}
+		return false
+	}
+	p.Close()
+	assert.True(t, waitPeers(0))
+	assert.True(t, a.AddPersistentPeer("b", nil))
+	assert.True(t, waitPeers(1))
+}
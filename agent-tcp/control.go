@@ -0,0 +1,459 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/crypto/blake2b"
+)
+
+const (
+	// ControlAuthPrefix is the prefix of the digests signed in ControlAuth,
+	// followed by the role of the signer
+	ControlAuthPrefix = "BDLS_CONTROL_AUTH"
+)
+
+// SetOperators sets the keys of the operators allowed on the control
+// channel, none by default.
+func (agent *TCPAgent) SetOperators(keys ...*ecdsa.PublicKey) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.operators = make(map[bdls.Identity]bool)
+	for _, key := range keys {
+		agent.operators[bdls.DefaultPubKeyToIdentity(key)] = true
+	}
+}
+
+// isOperator returns true if key is allowed on the control channel
+func (agent *TCPAgent) isOperator(key *ecdsa.PublicKey) bool {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.operators[bdls.DefaultPubKeyToIdentity(key)]
+}
+
+// ServeControl serves the control channel on l, the operators set by
+// SetOperators connect with a ControlClient, and their requests are served
+// by handler, typically the admin API, so it needn't be exposed to the
+// network. Both sides prove their static keys, the node's is the key of
+// the agent, and the requests and responses are encrypted by keys derived
+// from ephemeral ECDH secrets. ServeControl returns when l fails, or nil
+// when the agent has been closed.
+func (agent *TCPAgent) ServeControl(l net.Listener, handler http.Handler) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-agent.die:
+			l.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-agent.die:
+				return nil
+			default:
+				return err
+			}
+		}
+		go agent.serveControl(conn, handler)
+	}
+}
+
+// serveControl authenticates an operator, and serves it's requests until
+// the connection is closed.
+func (agent *TCPAgent) serveControl(conn net.Conn, handler http.Handler) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-agent.die:
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	conn.SetDeadline(time.Now().Add(agent.getHandshakeTimeout()))
+	c, _, err := controlHandshake(conn, agent.privateKey, false, agent.isOperator)
+	if err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	for {
+		var m ControlMessage
+		if err := c.read(CommandType_CONTROL_REQUEST, &m); err != nil {
+			return
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(m.HTTP)))
+		if err != nil {
+			return
+		}
+		req.RemoteAddr = conn.RemoteAddr().String()
+
+		w := &controlResponseWriter{header: make(http.Header)}
+		handler.ServeHTTP(w, req)
+		if err := c.write(CommandType_CONTROL_RESPONSE, &ControlMessage{HTTP: w.bytes()}); err != nil {
+			return
+		}
+	}
+}
+
+// controlResponseWriter buffers the response to a control request
+type controlResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header implements http.ResponseWriter
+func (w *controlResponseWriter) Header() http.Header { return w.header }
+
+// Write implements http.ResponseWriter
+func (w *controlResponseWriter) Write(bts []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.body.Write(bts)
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *controlResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// bytes returns the response in HTTP/1.1 wire format
+func (w *controlResponseWriter) bytes() []byte {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.header.Set("Content-Length", strconv.Itoa(w.body.Len()))
+	resp := &http.Response{
+		StatusCode:    w.status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header,
+		Body:          io.NopCloser(&w.body),
+		ContentLength: int64(w.body.Len()),
+	}
+
+	var out bytes.Buffer
+	resp.Write(&out)
+	return out.Bytes()
+}
+
+// ControlClient is the connection of an operator to the control channel of
+// a node, it implements http.RoundTripper to send requests to the handler
+// of ServeControl, one at a time, the host of the urls is ignored:
+//
+//	client := &http.Client{Transport: cc}
+//	resp, err := client.Get("http://node/stats")
+type ControlClient struct {
+	conn net.Conn
+	c    *controlConn
+	sync.Mutex
+}
+
+// DialControl connects to the control channel of a node at addr over TCP,
+// and authenticates as the operator of key, the node must authenticate as
+// node.
+func DialControl(ctx context.Context, addr string, key *ecdsa.PrivateKey, node *ecdsa.PublicKey) (*ControlClient, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	cc, err := NewControlClient(conn, key, node)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return cc, nil
+}
+
+// NewControlClient authenticates as the operator of key on conn, a
+// connection to the control channel of a node, the node must authenticate
+// as node.
+func NewControlClient(conn net.Conn, key *ecdsa.PrivateKey, node *ecdsa.PublicKey) (*ControlClient, error) {
+	verify := func(peer *ecdsa.PublicKey) bool {
+		return peer.X.Cmp(node.X) == 0 && peer.Y.Cmp(node.Y) == 0
+	}
+	c, _, err := controlHandshake(conn, key, true, verify)
+	if err != nil {
+		return nil, err
+	}
+	return &ControlClient{conn: conn, c: c}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (cc *ControlClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	var buf bytes.Buffer
+	if err := req.Write(&buf); err != nil {
+		return nil, err
+	}
+
+	cc.Lock()
+	defer cc.Unlock()
+	if deadline, ok := req.Context().Deadline(); ok {
+		cc.conn.SetDeadline(deadline)
+		defer cc.conn.SetDeadline(time.Time{})
+	}
+	if err := cc.c.write(CommandType_CONTROL_REQUEST, &ControlMessage{HTTP: buf.Bytes()}); err != nil {
+		return nil, err
+	}
+	var m ControlMessage
+	if err := cc.c.read(CommandType_CONTROL_RESPONSE, &m); err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(m.HTTP)), req)
+}
+
+// Close closes the connection to the node
+func (cc *ControlClient) Close() error {
+	return cc.conn.Close()
+}
+
+// controlConn reads & writes the |MessageLength|Message| frames of a
+// control channel, sealed once the session keys are derived
+type controlConn struct {
+	conn   net.Conn
+	sealer *sessionCipher
+	opener *sessionCipher
+}
+
+// write sends a message of the command
+func (c *controlConn) write(command CommandType, m proto.Message) error {
+	bts, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	frame, err := proto.Marshal(&Gossip{Command: command, Message: bts})
+	if err != nil {
+		return err
+	}
+	if c.sealer != nil {
+		frame = c.sealer.seal(frame)
+	}
+	if len(frame) > MaxMessageLength+sealOverhead {
+		return ErrMessageLengthExceed
+	}
+
+	out := make([]byte, MessageLength+len(frame))
+	binary.LittleEndian.PutUint32(out, uint32(len(frame)))
+	copy(out[MessageLength:], frame)
+	_, err = c.conn.Write(out)
+	return err
+}
+
+// read receives a message of the command into m
+func (c *controlConn) read(command CommandType, m proto.Message) error {
+	header := make([]byte, MessageLength)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return err
+	}
+	length := binary.LittleEndian.Uint32(header)
+	if length > MaxMessageLength+sealOverhead {
+		return ErrMessageLengthExceed
+	}
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, frame); err != nil {
+		return err
+	}
+
+	var msg Gossip
+	if err := proto.Unmarshal(frame, &msg); err != nil {
+		return err
+	}
+	if c.opener != nil {
+		if msg.Command != CommandType_SEALED {
+			return ErrSessionPlaintext
+		}
+		bts, err := c.opener.open(msg.Message)
+		if err != nil {
+			return err
+		}
+		msg = Gossip{}
+		if err := proto.Unmarshal(bts, &msg); err != nil {
+			return err
+		}
+	}
+	if msg.Command != command {
+		return ErrControlCommand
+	}
+	return proto.Unmarshal(msg.Message, m)
+}
+
+// controlHandshake authenticates both sides of a control channel on conn,
+// the operator sends first. The hellos exchange the static & ephemeral keys
+// and nonces, the session keys are derived from the ECDH secret of the
+// ephemeral keys, salted by the transcript of the hellos, then both sides
+// prove their static keys by signing the transcript, sealed. verify checks
+// the static key of the other side, which is returned.
+func controlHandshake(conn net.Conn, key *ecdsa.PrivateKey, operator bool, verify func(*ecdsa.PublicKey) bool) (*controlConn, *ecdsa.PublicKey, error) {
+	ephemeral, err := ecdsa.GenerateKey(key.Curve, rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := newNonce()
+	hello := &ControlHello{
+		X:          key.PublicKey.X.Bytes(),
+		Y:          key.PublicKey.Y.Bytes(),
+		EphemeralX: ephemeral.PublicKey.X.Bytes(),
+		EphemeralY: ephemeral.PublicKey.Y.Bytes(),
+		Nonce:      nonce,
+	}
+
+	c := &controlConn{conn: conn}
+	var peerHello ControlHello
+	if operator {
+		if err := c.write(CommandType_CONTROL_HELLO, hello); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := c.read(CommandType_CONTROL_HELLO, &peerHello); err != nil {
+		return nil, nil, err
+	}
+
+	peerKey := unmarshalKey(key.Curve, peerHello.X, peerHello.Y)
+	peerEphemeral := unmarshalKey(key.Curve, peerHello.EphemeralX, peerHello.EphemeralY)
+	if peerKey == nil || peerEphemeral == nil {
+		return nil, nil, ErrKeyNotOnCurve
+	}
+	if len(peerHello.Nonce) != nonceSize {
+		return nil, nil, ErrHandshakeNonce
+	}
+	if !verify(peerKey) {
+		return nil, nil, ErrControlKey
+	}
+	if !operator {
+		if err := c.write(CommandType_CONTROL_HELLO, hello); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// the transcript orders the hellos by role, the operator's first
+	operatorHello, nodeHello := hello, &peerHello
+	operatorKey, nodeKey := &key.PublicKey, peerKey
+	operatorEphemeral, nodeEphemeral := &ephemeral.PublicKey, peerEphemeral
+	if !operator {
+		operatorHello, nodeHello = nodeHello, operatorHello
+		operatorKey, nodeKey = nodeKey, operatorKey
+		operatorEphemeral, nodeEphemeral = nodeEphemeral, operatorEphemeral
+	}
+	transcript := controlTranscript(operatorKey, operatorEphemeral, operatorHello.Nonce, nodeKey, nodeEphemeral, nodeHello.Nonce)
+
+	secret := secretBytes(ECDH(peerEphemeral, ephemeral))
+	c.sealer = newSessionCipher(deriveKey(secret, transcript, ControlKeyLabel+string(nonce)))
+	c.opener = newSessionCipher(deriveKey(secret, transcript, ControlKeyLabel+string(peerHello.Nonce)))
+
+	// prove the static keys, each side signs for it's own role, so a proof
+	// can't be reflected
+	r, s, err := ecdsa.Sign(rand.Reader, key, controlAuthDigest(transcript, operator))
+	if err != nil {
+		return nil, nil, err
+	}
+	auth := &ControlAuth{R: r.Bytes(), S: s.Bytes()}
+	var peerAuth ControlAuth
+	if operator {
+		if err := c.write(CommandType_CONTROL_AUTH, auth); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := c.read(CommandType_CONTROL_AUTH, &peerAuth); err != nil {
+		return nil, nil, err
+	}
+	if !ecdsa.Verify(peerKey, controlAuthDigest(transcript, !operator), new(big.Int).SetBytes(peerAuth.R), new(big.Int).SetBytes(peerAuth.S)) {
+		return nil, nil, ErrControlAuth
+	}
+	if !operator {
+		if err := c.write(CommandType_CONTROL_AUTH, auth); err != nil {
+			return nil, nil, err
+		}
+	}
+	return c, peerKey, nil
+}
+
+// controlTranscript computes the digest of the hellos of a control channel:
+// blake2b(operator.X + operator.Y + operatorEphemeral.X + operatorEphemeral.Y + operatorNonce + node.X + node.Y + nodeEphemeral.X + nodeEphemeral.Y + nodeNonce)
+func controlTranscript(operator, operatorEphemeral *ecdsa.PublicKey, operatorNonce []byte, node, nodeEphemeral *ecdsa.PublicKey, nodeNonce []byte) []byte {
+	hash, err := blake2b.New256(nil)
+	if err != nil {
+		panic(err)
+	}
+	writeKey(hash, operator)
+	writeKey(hash, operatorEphemeral)
+	hash.Write(operatorNonce)
+	writeKey(hash, node)
+	writeKey(hash, nodeEphemeral)
+	hash.Write(nodeNonce)
+	return hash.Sum(nil)
+}
+
+// controlAuthDigest computes the digest signed in ControlAuth by the side
+// of the role: blake2b(ControlAuthPrefix + role + transcript)
+func controlAuthDigest(transcript []byte, operator bool) []byte {
+	role := "node"
+	if operator {
+		role = "operator"
+	}
+	hash, err := blake2b.New256(nil)
+	if err != nil {
+		panic(err)
+	}
+	hash.Write([]byte(ControlAuthPrefix))
+	hash.Write([]byte(role))
+	hash.Write(transcript)
+	return hash.Sum(nil)
+}
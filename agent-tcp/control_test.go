@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+// recordConn records the bytes written
+type recordConn struct {
+	net.Conn
+	mu      sync.Mutex
+	written bytes.Buffer
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	c.written.Write(b)
+	c.mu.Unlock()
+	return c.Conn.Write(b)
+}
+
+// bytes returns a copy of the bytes written so far
+func (c *recordConn) bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.written.Bytes()...)
+}
+
+func TestControlChannel(t *testing.T) {
+	nodeKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	operatorKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	strangerKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	agent := newTestAgent(t, nodeKey)
+	defer agent.Close()
+	agent.SetOperators(&operatorKey.PublicKey)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		w.WriteHeader(http.StatusAccepted)
+		io.Copy(w, r.Body)
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go agent.ServeControl(l, mux)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	rec := &recordConn{Conn: conn}
+	cc, err := NewControlClient(rec, operatorKey, &nodeKey.PublicKey)
+	assert.Nil(t, err)
+	defer cc.Close()
+
+	// the requests are served by the handler, encrypted on the wire
+	client := &http.Client{Transport: cc}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post("http://node/echo", "text/plain", strings.NewReader("confidential"))
+		assert.Nil(t, err)
+		body, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, "POST", resp.Header.Get("X-Method"))
+		assert.Equal(t, "confidential", string(body))
+	}
+	resp, err := client.Get("http://node/missing")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.False(t, bytes.Contains(rec.bytes(), []byte("confidential")))
+	assert.False(t, bytes.Contains(rec.bytes(), []byte("/echo")))
+
+	// keys other than the operators' are refused
+	_, err = DialControl(ctx, l.Addr().String(), strangerKey, &nodeKey.PublicKey)
+	assert.NotNil(t, err)
+
+	// the node must authenticate as expected
+	_, err = DialControl(ctx, l.Addr().String(), operatorKey, &strangerKey.PublicKey)
+	assert.Equal(t, ErrControlKey, err)
+}
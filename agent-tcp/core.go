@@ -0,0 +1,101 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"net"
+	"time"
+
+	"github.com/yonggewang/bdls"
+)
+
+// Consensus is the consensus core driven by a TCPAgent, it's implemented by
+// *bdls.Consensus, and by agenttest.MockConsensus for the tests of the
+// transport which don't need real keys, participants and rounds. The
+// methods are called with the agent lock held, except Profiler.
+type Consensus interface {
+	// Update drives the timeouts of the consensus core
+	Update(now time.Time) error
+
+	// ReceiveMessage verifies & processes a consensus message, and
+	// ReceiveAuthenticatedMessage does the same for a message delivered by
+	// the connection its signer authenticated.
+	ReceiveMessage(bts []byte, now time.Time) error
+	ReceiveAuthenticatedMessage(bts []byte, sender *ecdsa.PublicKey, now time.Time) error
+
+	// ApplyDecide fast-forwards to the height of a <decide> message fetched
+	// to catch up, without propagating it.
+	ApplyDecide(bts []byte, now time.Time) error
+
+	// VerifyMessages verifies the signatures of the messages about to be
+	// received in parallel, so they're not verified one by one again.
+	VerifyMessages(msgs [][]byte)
+
+	// VerifySignature verifies the signature of a message by the Verifier
+	// of the consensus core.
+	VerifySignature(signed *bdls.SignedProto) bool
+
+	// Join adds a peer for the consensus messages to be sent to, and Leave
+	// removes it by it's address.
+	Join(p bdls.PeerInterface) bool
+	Leave(addr net.Addr) bool
+
+	// CurrentState returns the latest height decided & it's state, along
+	// with CurrentProof, the <decide> message of it, or nil.
+	CurrentState() (height uint64, round uint64, data bdls.State)
+	CurrentProof() *bdls.SignedProto
+
+	// Propose & HasProposed are for the states proposed by this node
+	Propose(s bdls.State) error
+	HasProposed(s bdls.State) bool
+
+	// StateHash returns the hash identifying a state in the proofs
+	StateHash(s bdls.State) bdls.StateHash
+
+	// Participants returns the identities of the participants, Quorum the
+	// number of them to reach agreement, or their weight if they're
+	// weighted, and Weight the weight of one, 1 if not weighted.
+	Participants() []bdls.Identity
+	Quorum() int
+	Weight(id bdls.Identity) uint64
+
+	// LeaderGone hints the participant is gone for the rounds to come
+	LeaderGone(id bdls.Identity)
+
+	// CurrentBeacon returns the randomness beacon of the latest height
+	CurrentBeacon() (*bdls.Beacon, error)
+
+	// Profiler returns the profiler of the phases, or nil if disabled
+	Profiler() *bdls.Profiler
+}
+
+var _ Consensus = (*bdls.Consensus)(nil)
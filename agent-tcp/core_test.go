@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	mrand "math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/agent-tcp/agenttest"
+)
+
+func TestMockConsensus(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	ma := agenttest.NewMockConsensus()
+	mb := agenttest.NewMockConsensus()
+	a := NewTCPAgent(ma, keyA)
+	defer a.Close()
+	b := NewTCPAgent(mb, keyB)
+	defer b.Close()
+
+	c1, c2 := net.Pipe()
+	pa := NewTCPPeer(c1, a)
+	pb := NewTCPPeer(c2, b)
+	assert.True(t, a.AddPeer(pa))
+	assert.True(t, b.AddPeer(pb))
+	assert.Equal(t, 1, len(ma.Peers()))
+	pa.InitiatePublicKeyAuthentication()
+	pb.InitiatePublicKeyAuthentication()
+	assert.Nil(t, a.waitAuthenticated(pa, &keyB.PublicKey, time.Second, nil))
+
+	// the messages broadcast by the core are delivered in order, even the
+	// ones rejected
+	mb.SetReceiveError(bdls.ErrRoundChangeHeightMismatch)
+	var sent [][]byte
+	for i := 0; i < 10; i++ {
+		msg := make([]byte, 1+mrand.Intn(1024))
+		io.ReadFull(rand.Reader, msg)
+		sent = append(sent, msg)
+		ma.Broadcast(msg)
+	}
+	assert.Eventually(t, func() bool { return len(mb.Messages()) == len(sent) }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, sent, mb.Messages())
+
+	a.Update()
+	assert.True(t, ma.Updates() >= 1)
+	assert.True(t, a.RemovePeer(pa))
+	assert.Equal(t, 0, len(ma.Peers()))
+}
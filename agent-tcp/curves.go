@@ -0,0 +1,135 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"math/big"
+
+	"github.com/yonggewang/bdls"
+)
+
+// Curve is the name of the curve of a key used in the handshake
+type Curve string
+
+const (
+	// CurveSecp256k1 is the curve of the validator keys, it's announced as
+	// empty for nodes of older versions
+	CurveSecp256k1 Curve = "secp256k1"
+	// CurveP256 is NIST P-256, for transport keys kept in HSMs or FIPS
+	// modules, linked to the validator keys by SetKeyLinkage
+	CurveP256 Curve = "P-256"
+)
+
+// supportedCurves are the curves a handshake can use
+var supportedCurves = map[Curve]elliptic.Curve{
+	CurveSecp256k1: bdls.S256Curve,
+	CurveP256:      elliptic.P256(),
+}
+
+// curveByName returns the curve announced in KeyAuthInit, empty is
+// secp256k1
+func curveByName(name string) (elliptic.Curve, error) {
+	if name == "" {
+		name = string(CurveSecp256k1)
+	}
+	curve, ok := supportedCurves[Curve(name)]
+	if !ok {
+		return nil, ErrCurveNotSupported
+	}
+	return curve, nil
+}
+
+// curveName returns the name of a curve to announce in KeyAuthInit, empty
+// for secp256k1 so nodes of older versions can verify the transcript.
+func curveName(curve elliptic.Curve) string {
+	for name, c := range supportedCurves {
+		if c == curve {
+			if name == CurveSecp256k1 {
+				return ""
+			}
+			return string(name)
+		}
+	}
+	return curve.Params().Name
+}
+
+// SetCurves restricts the curves of the keys accepted from peers, all
+// supported curves are accepted by default. The curve of this agent's own
+// key doesn't have to be in the list.
+func (agent *TCPAgent) SetCurves(curves ...Curve) error {
+	for _, c := range curves {
+		if _, ok := supportedCurves[c]; !ok {
+			return ErrCurveNotSupported
+		}
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	agent.curves = make(map[Curve]bool)
+	for _, c := range curves {
+		agent.curves[c] = true
+	}
+	return nil
+}
+
+// peerCurve returns the curve a peer has announced if it's accepted
+func (agent *TCPAgent) peerCurve(name string) (elliptic.Curve, error) {
+	curve, err := curveByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.curves != nil {
+		if name == "" {
+			name = string(CurveSecp256k1)
+		}
+		if !agent.curves[Curve(name)] {
+			return nil, ErrCurveNotSupported
+		}
+	}
+	return curve, nil
+}
+
+// unmarshalKey returns the public key of the coordinates on curve, or nil
+// if it's not on the curve. The coordinates are checked to be in the field
+// first, as secp256k1 panics on the ones wider than it.
+func unmarshalKey(curve elliptic.Curve, x []byte, y []byte) *ecdsa.PublicKey {
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	p := curve.Params().P
+	if key.X.Cmp(p) >= 0 || key.Y.Cmp(p) >= 0 || !curve.IsOnCurve(key.X, key.Y) {
+		return nil
+	}
+	return key
+}
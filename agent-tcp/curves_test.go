@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestHandshakeCurves(t *testing.T) {
+	// a P-256 transport key linked to a secp256k1 validator key
+	validatorKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	transportKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	validator := newTestAgent(t, validatorKey)
+	client := NewTCPAgent(validator.consensus, transportKey)
+	defer client.Close()
+	assert.Nil(t, client.SetKeyLinkage(newTestLinkage(t, validatorKey, &transportKey.PublicKey, 1)))
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+	// rotate the keys on every frame, the ephemeral keys are on the curve
+	// of the receiver
+	client.SetRekey(0, 1)
+	server.SetRekey(0, 1)
+
+	c1, c2 := net.Pipe()
+	p1 := NewTCPPeer(c1, client)
+	p2 := NewTCPPeer(c2, server)
+	assert.True(t, client.AddPeer(p1))
+	assert.True(t, server.AddPeer(p2))
+	assert.Nil(t, p1.InitiatePublicKeyAuthentication())
+	assert.Nil(t, p2.InitiatePublicKeyAuthentication())
+	assert.Eventually(t, func() bool { return p1.SessionEncrypted() && p2.SessionEncrypted() }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, &validatorKey.PublicKey, p2.GetPublicKey())
+	assert.Equal(t, elliptic.P256(), p2.GetTransportPublicKey().Curve)
+	assert.Equal(t, bdls.S256Curve, p1.GetPublicKey().Curve)
+
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	assert.Nil(t, client.ScheduleMaintenance(start, start.Add(time.Hour)))
+	assert.Nil(t, server.ScheduleMaintenance(start, start.Add(time.Hour)))
+	assert.Eventually(t, func() bool { return len(client.Maintenance()) == 1 && len(server.Maintenance()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// the curves accepted can be restricted
+	assert.Equal(t, ErrCurveNotSupported, server.SetCurves(Curve("P-384")))
+	assert.Nil(t, server.SetCurves(CurveSecp256k1))
+	init := func(key *ecdsa.PublicKey, curve string) error {
+		c1, _ := net.Pipe()
+		p := NewTCPPeer(c1, server)
+		auth := KeyAuthInit{X: key.X.Bytes(), Y: key.Y.Bytes(), Curve: curve, Nonce: newNonce(), Timestamp: time.Now().Unix()}
+		return p.handleKeyAuthInit(&auth)
+	}
+	assert.Equal(t, ErrCurveNotSupported, init(&transportKey.PublicKey, string(CurveP256)))
+	assert.Equal(t, ErrCurveNotSupported, init(&transportKey.PublicKey, "P-384"))
+	assert.Nil(t, init(&validatorKey.PublicKey, ""))
+	assert.Nil(t, server.SetCurves(CurveSecp256k1, CurveP256))
+	assert.Nil(t, init(&transportKey.PublicKey, string(CurveP256)))
+	// the key must be on the curve announced
+	assert.Equal(t, ErrKeyNotOnCurve, init(&validatorKey.PublicKey, string(CurveP256)))
+	assert.Equal(t, ErrKeyNotOnCurve, init(&transportKey.PublicKey, ""))
+}
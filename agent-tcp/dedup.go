@@ -0,0 +1,280 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"bytes"
+	"container/list"
+	"log"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/internal/identity"
+)
+
+const (
+	// the number of digests of the consensus messages processed, which are
+	// remembered to drop the duplicates
+	receivedCacheSize = 8192
+)
+
+// DuplicatePolicy selects the connection kept of the ones authenticated to
+// the same public key, the others are closed so the consensus core doesn't
+// receive the traffic of one identity twice.
+type DuplicatePolicy int
+
+const (
+	// KeepNewest keeps the newest connection, as the older ones are likely
+	// stale after the peer reconnected
+	KeepNewest DuplicatePolicy = iota
+	// KeepOldest keeps the oldest connection, so a copied key can't take
+	// over the connection of a validator
+	KeepOldest
+	// KeepLowestLatency keeps the connection of the lowest round trip time
+	// measured by ReportLatency, or the newest if it's not measured
+	KeepLowestLatency
+)
+
+func (d DuplicatePolicy) String() string {
+	switch d {
+	case KeepNewest:
+		return "newest"
+	case KeepOldest:
+		return "oldest"
+	case KeepLowestLatency:
+		return "lowest-latency"
+	}
+	return "unknown"
+}
+
+// SetDuplicatePolicy sets the connection kept of the ones authenticated to
+// the same transport or validator key, KeepNewest by default. It doesn't
+// apply to the connections both sides dialed simultaneously, or the ones of
+// unknown direction, see dedupPeer.
+func (agent *TCPAgent) SetDuplicatePolicy(policy DuplicatePolicy) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.duplicatePolicy = policy
+}
+
+// dedupPeer closes the duplicated connections to the same peer as p, the
+// ones authenticated to the same transport key, or linked to the same
+// validator key. Of an outbound and an inbound connection of the same
+// transport key, which happens when both sides dial each other
+// simultaneously, the one dialed by the side with the lower public key is
+// kept, so both sides keep the same connection. Of the connections of the
+// same transport key created by NewTCPPeer, whose direction is unknown, the
+// one of the lower handshake nonces is kept, which both sides agree on as
+// well. The others are kept by the DuplicatePolicy.
+//
+// The state of the closed connection is moved to the kept one.
+func (agent *TCPAgent) dedupPeer(p *TCPPeer) {
+	key := p.GetTransportPublicKey()
+	if key == nil {
+		return
+	}
+	id := p.GetPublicKey()
+
+	var dups []*TCPPeer
+	found := false
+	order := make(map[*TCPPeer]int) // the order added
+	agent.Lock()
+	policy := agent.duplicatePolicy
+	for k, other := range agent.peers {
+		order[other] = k
+		if other == p {
+			found = true
+		} else if identity.Equal(other.GetTransportPublicKey(), key) || identity.Equal(other.GetPublicKey(), id) {
+			dups = append(dups, other)
+		}
+	}
+	agent.Unlock()
+	if !found {
+		return
+	}
+
+	local := bdls.DefaultPubKeyToIdentity(&agent.privateKey.PublicKey)
+	remote := bdls.DefaultPubKeyToIdentity(key)
+	dialedByLower := bytes.Compare(local[:], remote[:]) < 0
+
+	keep := p
+	for _, other := range dups {
+		var keepOther bool
+		sameKey := identity.Equal(other.GetTransportPublicKey(), key)
+		directed, outbound := keep.direction()
+		otherDirected, otherOutbound := other.direction()
+		if sameKey && directed && otherDirected && outbound != otherOutbound {
+			keepOther = otherOutbound == dialedByLower
+		} else if id, otherID := keep.connectionID(dialedByLower), other.connectionID(dialedByLower); sameKey && !(directed && otherDirected) && id != nil && otherID != nil {
+			keepOther = bytes.Compare(otherID, id) < 0
+		} else {
+			log.Println("duplicate identity:", keep.RemoteAddr(), other.RemoteAddr(), "keep", policy)
+			newer := order[other] > order[keep]
+			switch policy {
+			case KeepOldest:
+				keepOther = !newer
+			case KeepLowestLatency:
+				if rtt, otherRTT := keep.getRTT(), other.getRTT(); rtt > 0 && otherRTT > 0 {
+					keepOther = otherRTT < rtt
+				} else {
+					keepOther = newer
+				}
+			default:
+				keepOther = newer
+			}
+		}
+
+		drop := other
+		if keepOther {
+			keep, drop = other, keep
+		}
+		drop.handOver(keep)
+		drop.Close()
+	}
+}
+
+// isOutbound returns true if the connection was dialed by this agent
+func (p *TCPPeer) isOutbound() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.outbound
+}
+
+// direction returns if the direction of the connection is known, and if it
+// was dialed by this agent
+func (p *TCPPeer) direction() (directed bool, outbound bool) {
+	p.Lock()
+	defer p.Unlock()
+	return p.directed, p.outbound
+}
+
+// setDirection sets the direction of the connection
+func (p *TCPPeer) setDirection(outbound bool) {
+	p.Lock()
+	defer p.Unlock()
+	p.directed = true
+	p.outbound = outbound
+}
+
+// connectionID identifies the connection the same on both sides, by the
+// handshake nonces of the sides ordered by their keys, or nil before the
+// nonce of the peer has been received.
+func (p *TCPPeer) connectionID(localFirst bool) []byte {
+	p.Lock()
+	defer p.Unlock()
+	if len(p.nonce) == 0 || len(p.peerNonce) == 0 {
+		return nil
+	}
+	if localFirst {
+		return append(append([]byte{}, p.nonce...), p.peerNonce...)
+	}
+	return append(append([]byte{}, p.peerNonce...), p.nonce...)
+}
+
+// handOver moves the state to another connection of the same peer
+func (p *TCPPeer) handOver(to *TCPPeer) {
+	if state := p.detachState(); state != nil {
+		to.adoptState(state)
+	}
+}
+
+// duplicateMessage returns true if the consensus message of the digest has
+// been processed, so the copies relayed by flooding peers or delivered over
+// redundant links are dropped before the signatures are verified. The
+// copies of an invalid message still count as misbehavior of their senders.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) duplicateMessage(digest [32]byte, from *TCPPeer) bool {
+	invalid, ok := agent.received.seen(digest)
+	if !ok {
+		return false
+	}
+	agent.duplicates++
+	if invalid && from != nil {
+		agent.misbehaveLocked(from, penaltyInvalidMessage)
+	}
+	return true
+}
+
+// processedMessage remembers the digest of a consensus message once the
+// consensus core has accepted it, or rejected it regardless of the timing,
+// the messages rejected as early or late may be accepted later.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) processedMessage(digest [32]byte, err error) {
+	if err == nil || invalidMessage(err) {
+		agent.received.add(digest, err != nil)
+	}
+}
+
+// digestEntry is a message digest & whether the message is invalid
+type digestEntry struct {
+	digest  [32]byte
+	invalid bool
+}
+
+// digestCache is a set of message digests bounded by capacity, the least
+// recently seen ones are evicted first.
+type digestCache struct {
+	capacity int
+	entries  map[[32]byte]*list.Element
+	order    *list.List // front is the most recent
+}
+
+// newDigestCache creates a digestCache of capacity digests
+func newDigestCache(capacity int) *digestCache {
+	return &digestCache{capacity: capacity, entries: make(map[[32]byte]*list.Element), order: list.New()}
+}
+
+// seen returns true if the digest is in the cache along with whether the
+// message is invalid, and makes it the most recent one.
+func (c *digestCache) seen(digest [32]byte) (invalid bool, ok bool) {
+	elem, ok := c.entries[digest]
+	if !ok {
+		return false, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*digestEntry).invalid, true
+}
+
+// add inserts a digest as the most recent one, returns false if it's been
+// in the cache.
+func (c *digestCache) add(digest [32]byte, invalid bool) bool {
+	if elem, ok := c.entries[digest]; ok {
+		c.order.MoveToFront(elem)
+		return false
+	}
+
+	c.entries[digest] = c.order.PushFront(&digestEntry{digest, invalid})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*digestEntry).digest)
+	}
+	return true
+}
@@ -0,0 +1,344 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestDedupSimultaneousDial(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+
+		a := newTestAgent(t, keyA)
+		b := newTestAgent(t, keyB)
+		la, err := a.Listen("127.0.0.1:0")
+		assert.Nil(t, err)
+		lb, err := b.Listen("127.0.0.1:0")
+		assert.Nil(t, err)
+
+		// both sides dial each other simultaneously
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			a.Connect(context.Background(), lb.Addr().String(), &keyB.PublicKey)
+		}()
+		go func() {
+			defer wg.Done()
+			b.Connect(context.Background(), la.Addr().String(), &keyA.PublicKey)
+		}()
+		wg.Wait()
+
+		// single returns the only peer alive, or nil
+		single := func(agent *TCPAgent) *TCPPeer {
+			agent.Lock()
+			defer agent.Unlock()
+			var alive []*TCPPeer
+			for _, p := range agent.peers {
+				select {
+				case <-p.die:
+				default:
+					alive = append(alive, p)
+				}
+			}
+			if len(alive) == 1 {
+				return alive[0]
+			}
+			return nil
+		}
+
+		// wait until both sides settled on the same connection
+		var pa, pb *TCPPeer
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			pa, pb = single(a), single(b)
+			if pa != nil && pb != nil && pa.conn.LocalAddr().String() == pb.conn.RemoteAddr().String() {
+				break
+			}
+			<-time.After(20 * time.Millisecond)
+		}
+
+		if assert.NotNil(t, pa) && assert.NotNil(t, pb) {
+			assert.Equal(t, pa.conn.LocalAddr().String(), pb.conn.RemoteAddr().String())
+			assert.Equal(t, pa.conn.RemoteAddr().String(), pb.conn.LocalAddr().String())
+
+			// dialed by the lower key
+			idA, idB := bdls.DefaultPubKeyToIdentity(&keyA.PublicKey), bdls.DefaultPubKeyToIdentity(&keyB.PublicKey)
+			assert.Equal(t, bytes.Compare(idA[:], idB[:]) < 0, pa.isOutbound())
+		}
+		a.Close()
+		b.Close()
+	}
+}
+
+func TestDedupUnknownDirection(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		a := newTestAgent(t, keyA)
+		b := newTestAgent(t, keyB)
+
+		// two connections of unknown direction between the same keys, added
+		// in different orders on each side
+		ends := make(map[net.Conn]net.Conn)
+		var pas, pbs []*TCPPeer
+		for k := 0; k < 2; k++ {
+			c1, c2 := net.Pipe()
+			ends[c1], ends[c2] = c2, c1
+			pas = append(pas, NewTCPPeer(c1, a))
+			pbs = append(pbs, NewTCPPeer(c2, b))
+		}
+		for k := range pas {
+			assert.True(t, a.AddPeer(pas[k]))
+			assert.True(t, b.AddPeer(pbs[len(pbs)-1-k]))
+		}
+		for k := range pas {
+			pas[k].InitiatePublicKeyAuthentication()
+			pbs[k].InitiatePublicKeyAuthentication()
+		}
+
+		// single returns the only peer alive, or nil
+		single := func(agent *TCPAgent) *TCPPeer {
+			agent.Lock()
+			defer agent.Unlock()
+			var alive []*TCPPeer
+			for _, p := range agent.peers {
+				select {
+				case <-p.die:
+				default:
+					alive = append(alive, p)
+				}
+			}
+			if len(alive) == 1 {
+				return alive[0]
+			}
+			return nil
+		}
+
+		// both sides keep the same connection
+		var pa, pb *TCPPeer
+		assert.Eventually(t, func() bool {
+			pa, pb = single(a), single(b)
+			return pa != nil && pb != nil
+		}, 5*time.Second, 20*time.Millisecond)
+		if pa != nil && pb != nil {
+			assert.Equal(t, ends[pa.conn], pb.conn)
+
+			// which both sides identify the same
+			idA, idB := bdls.DefaultPubKeyToIdentity(&keyA.PublicKey), bdls.DefaultPubKeyToIdentity(&keyB.PublicKey)
+			aFirst := bytes.Compare(idA[:], idB[:]) < 0
+			assert.NotNil(t, pa.connectionID(aFirst))
+			assert.Equal(t, pa.connectionID(aFirst), pb.connectionID(!aFirst))
+		}
+		a.Close()
+		b.Close()
+	}
+}
+
+func TestDedupReconnect(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+	lb, err := b.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+
+	// alive returns the peers of b not closed yet
+	alive := func() []*TCPPeer {
+		b.Lock()
+		defer b.Unlock()
+		var peers []*TCPPeer
+		for _, p := range b.peers {
+			select {
+			case <-p.die:
+			default:
+				peers = append(peers, p)
+			}
+		}
+		return peers
+	}
+
+	a1 := newTestAgent(t, keyA)
+	defer a1.Close()
+	_, err = a1.Connect(context.Background(), lb.Addr().String(), &keyB.PublicKey)
+	assert.Nil(t, err)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(alive()) != 1 && time.Now().Before(deadline) {
+		<-time.After(20 * time.Millisecond)
+	}
+	old := alive()
+	if !assert.Len(t, old, 1) {
+		return
+	}
+
+	// the same peer reconnects from a restarted process, the older inbound
+	// connection is closed
+	a2 := newTestAgent(t, keyA)
+	defer a2.Close()
+	p2, err := a2.Connect(context.Background(), lb.Addr().String(), &keyB.PublicKey)
+	assert.Nil(t, err)
+	select {
+	case <-old[0].die:
+	case <-time.After(5 * time.Second):
+		t.Fatal("older connection not closed")
+	}
+
+	peers := alive()
+	if assert.Len(t, peers, 1) {
+		assert.Equal(t, p2.conn.LocalAddr().String(), peers[0].conn.RemoteAddr().String())
+	}
+}
+
+func TestDuplicatePolicy(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+	lb, err := b.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+
+	// alive returns the peers of b not closed yet, once settled to one
+	alive := func() *TCPPeer {
+		var peers []*TCPPeer
+		assert.Eventually(t, func() bool {
+			b.Lock()
+			defer b.Unlock()
+			peers = nil
+			for _, p := range b.peers {
+				select {
+				case <-p.die:
+				default:
+					peers = append(peers, p)
+				}
+			}
+			return len(peers) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+		if len(peers) != 1 {
+			t.FailNow()
+		}
+		return peers[0]
+	}
+	connect := func() *TCPPeer {
+		a := newTestAgent(t, keyA)
+		t.Cleanup(a.Close)
+		p, err := a.Connect(context.Background(), lb.Addr().String(), &keyB.PublicKey)
+		assert.Nil(t, err)
+		return p
+	}
+
+	// the oldest connection of the same key is kept
+	b.SetDuplicatePolicy(KeepOldest)
+	p1 := connect()
+	old := alive()
+	p2 := connect()
+	select {
+	case <-p2.die:
+	case <-time.After(5 * time.Second):
+		t.Fatal("newer connection not closed")
+	}
+	assert.Equal(t, old, alive())
+	assert.Equal(t, p1.conn.LocalAddr().String(), old.conn.RemoteAddr().String())
+
+	// the lowest latency is kept, the newest if unknown
+	b.SetDuplicatePolicy(KeepLowestLatency)
+	old.Lock()
+	old.rtt = 50 * time.Millisecond
+	old.Unlock()
+	p3 := connect()
+	select {
+	case <-old.die:
+	case <-time.After(5 * time.Second):
+		t.Fatal("older connection not closed")
+	}
+	assert.Equal(t, p3.conn.LocalAddr().String(), alive().conn.RemoteAddr().String())
+}
+
+func TestReceiveDedup(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = participants[0]
+	config.Participants = coords
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	agent := NewTCPAgent(consensus, participants[0])
+	defer agent.Close()
+
+	roundChange := func(height uint64) []byte {
+		m := bdls.Message{Type: bdls.MessageType_RoundChange, Height: height, State: []byte("state")}
+		signed := new(bdls.SignedProto)
+		signed.Sign(&m, participants[1])
+		bts, err := proto.Marshal(signed)
+		assert.Nil(t, err)
+		return bts
+	}
+	// waits until the messages delivered so far are processed
+	processed := func() uint64 {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			agent.Lock()
+			pending := len(agent.consensusMessages)
+			agent.Unlock()
+			if pending == 0 {
+				break
+			}
+			<-time.After(10 * time.Millisecond)
+		}
+		<-time.After(50 * time.Millisecond)
+		return agent.Stats().Duplicates
+	}
+
+	// the copies of an accepted message are dropped
+	accepted := roundChange(1)
+	agent.handleConsensusMessage(accepted, nil, nil)
+	assert.Equal(t, uint64(0), processed())
+	agent.handleConsensusMessage(accepted, nil, nil)
+	agent.handleConsensusMessage(accepted, nil, nil)
+	assert.Equal(t, uint64(2), processed())
+
+	// as well as forged ones
+	forged := roundChange(1)
+	forged[len(forged)-1] ^= 1
+	agent.handleConsensusMessage(forged, nil, nil)
+	agent.handleConsensusMessage(forged, nil, nil)
+	assert.Equal(t, uint64(3), processed())
+
+	// but not the early ones, which may be accepted later
+	early := roundChange(5)
+	agent.handleConsensusMessage(early, nil, nil)
+	agent.handleConsensusMessage(early, nil, nil)
+	assert.Equal(t, uint64(3), processed())
+}
+
+// The fuzz targets below are run with go test -fuzz, the inputs found
+// crashing or expanding the coverage are kept in testdata/fuzz, which are
+// replayed on every test run against regressions.
@@ -1,3 +1,33 @@
 // Package agent-tcp implements a TCP based agent to participate in consensus
-// Challenge-Response scheme has been adopted to do interactive authentication
+// Challenge-Response scheme has been adopted to do interactive authentication,
+// the replies are bound to per connection nonces and signed, so recorded
+// handshakes can't be replayed. Both sides authenticate, and the consensus
+// messages of a peer are accepted only after both have. The frames are then
+// encrypted with AES-GCM, by keys derived from the secrets of the handshake
+// with HKDF-SHA256, separately for each direction.
+// The keys authenticating the peers can be on secp256k1 or P-256, the curve
+// is announced in the handshake, see SetCurves.
+// Each side sends a HELLO with it's protocol version first, commands the
+// peer's version doesn't know are not sent to it, so agents of different
+// versions can talk during rolling upgrades.
+// Connections can be multiplexed by yamux, see NewMuxPeer, the consensus
+// messages are then one of the streams.
+// Peers tell each other the address they observe, and agents behind NAT can
+// connect by hole punching through a common peer, see ListenNAT and Punch,
+// or have the gateway map the ports listened on, see SetPortMapper. The
+// consensus messages can be relayed in partial meshes, see SetFlood, and
+// the rest of the traffic is shed under overload, see SetLoadShedder.
+// The inbound connections can be capped, see SetMaxConnections.
+// The sizes of the encrypted frames can be padded against traffic
+// analysis, see SetPadding. Nodes outside of the validator set can follow
+// the consensus read-only as observers, see NewObserverAgent.
+// Participants lagging behind catch up by requesting the decisions of the
+// heights missed from their peers, see SetStateSync.
+// The deadlines & the max frame size of the connections are set by the
+// Options of NewTCPAgent & NewTCPPeer. The telemetry of the transport can
+// be exported by a MetricsSink, see SetMetricsSink.
+// Operators administer a node over an encrypted control channel apart from
+// the peers, authenticated by their keys, see ServeControl.
+// The consensus core is driven through the Consensus interface, the tests
+// of the transport can use agenttest.MockConsensus instead of real rounds.
 package agent
@@ -0,0 +1,110 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"context"
+	"time"
+)
+
+// Shutdown stops accepting new messages and proposals, then waits for the
+// messages pending to each peer to be written, so the final round messages
+// of a restarting validator are not dropped. The agent is closed once all
+// peers have been flushed, or ctx is done, in which case ctx.Err() is
+// returned. Unlike Close, the consensus is not updated while draining.
+func (agent *TCPAgent) Shutdown(ctx context.Context) error {
+	agent.Lock()
+	agent.draining = true
+	peers := make([]*TCPPeer, len(agent.peers))
+	copy(peers, agent.peers)
+	agent.Unlock()
+	defer agent.Close()
+
+	for _, p := range peers {
+		for !p.outboundSent() {
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// DrainPeer removes a TCPPeer from the consensus, so no more messages are
+// queued to it, then waits for the messages pending to it to be written
+// before removing it like RemovePeer. If ctx is done first, the peer is
+// removed anyway and ctx.Err() is returned.
+func (agent *TCPAgent) DrainPeer(ctx context.Context, p *TCPPeer) error {
+	agent.Lock()
+	agent.consensus.Leave(p.RemoteAddr())
+	agent.Unlock()
+	defer agent.RemovePeer(p)
+
+	for !p.outboundSent() {
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// outboundSent returns true if all messages to the peer have been written,
+// or the connection has been closed.
+func (p *TCPPeer) outboundSent() bool {
+	select {
+	case <-p.die:
+		return true
+	default:
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if p.writing || len(p.agentMessages) > 0 {
+		return false
+	}
+	for lane := range p.lanes {
+		if p.lanes[lane].len() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// doneWriting marks the messages taken from the queues as written
+func (p *TCPPeer) doneWriting() {
+	p.Lock()
+	p.writing = false
+	p.Unlock()
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+// slowReader reads the connection slowly, counting the bytes
+type slowReader struct {
+	sync.Mutex
+	n int
+}
+
+func (r *slowReader) read(conn net.Conn) {
+	buf := make([]byte, 4096)
+	for {
+		<-time.After(time.Millisecond)
+		n, err := conn.Read(buf)
+		r.Lock()
+		r.n += n
+		r.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *slowReader) bytes() int {
+	r.Lock()
+	defer r.Unlock()
+	return r.n
+}
+
+func TestShutdownDrain(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a := newTestAgent(t, key)
+	defer a.Close()
+
+	// the messages pending are written before the connection is closed
+	c1, c2 := net.Pipe()
+	p := NewTCPPeer(c1, a)
+	assert.True(t, a.AddPeer(p))
+	reader := new(slowReader)
+	go reader.read(c2)
+	msg := make([]byte, 1024)
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, p.Send(msg))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.Nil(t, a.Shutdown(ctx))
+	assert.True(t, reader.bytes() >= 200*len(msg))
+	<-p.die
+
+	// no new messages, proposals or peers are accepted while draining
+	assert.Equal(t, ErrAgentShuttingDown, a.Propose([]byte("state")))
+	c3, _ := net.Pipe()
+	assert.False(t, a.AddPeer(NewTCPPeer(c3, a)))
+
+	// the drain is bounded by the context
+	b := newTestAgent(t, key)
+	defer b.Close()
+	c4, _ := net.Pipe()
+	p = NewTCPPeer(c4, b)
+	assert.True(t, b.AddPeer(p))
+	assert.Nil(t, p.Send(msg))
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, b.Shutdown(ctx))
+	<-p.die
+}
@@ -40,4 +40,55 @@ var (
 	ErrPeerKeyAuthChallengeResponse = errors.New("incorrect state for peer KeyAuthChallengeResponse message")
 	ErrPeerAuthenticatedFailed      = errors.New("public key authentication failed for peer")
 	ErrMessageLengthExceed          = errors.New("message size exceeded maximum")
+	ErrKeyLinkage                   = errors.New("the key linkage statement cannot be verified")
+	ErrKeyLinkageEmpty              = errors.New("the key linkage statement is nil")
+	ErrKeyLinkageExpired            = errors.New("the key linkage statement is out of it's validity window")
+	ErrKeyLinkageRevoked            = errors.New("the key linkage statement has been superseded by a higher sequence")
+	ErrReplicaNotAuthenticated      = errors.New("replica subscription from an unauthenticated peer")
+	ErrReplicaNotAllowed            = errors.New("replica subscription from a peer not allowed")
+	ErrReplicaFull                  = errors.New("replica subscription exceeds the max replicas with no relay to redirect to")
+	ErrSyncNotAuthenticated         = errors.New("sync request from an unauthenticated peer")
+	ErrUnixSocketInUse              = errors.New("the unix socket is in use by another process")
+	ErrPeerPublicKeyMismatch        = errors.New("the peer authenticated a public key other than expected")
+	ErrPeerJoin                     = errors.New("the peer cannot be added to the agent")
+	ErrHandshakeTimeout             = errors.New("the peer didn't authenticate in time")
+	ErrStaticPeerAddress            = errors.New("the static peer has an empty or duplicated address")
+	ErrStaticPeerPublicKey          = errors.New("the static peer has an invalid public key")
+	ErrStaticPeerProxy              = errors.New("the static peer has an invalid proxy url")
+	ErrCompressionType              = errors.New("unsupported compression type")
+	ErrProposalTooLarge             = errors.New("the proposal exceeds the max size")
+	ErrProposalEmpty                = errors.New("the proposal is empty")
+	ErrHeightPruned                 = errors.New("the decisions from the height are no longer kept")
+	ErrSubscriptionOverflow         = errors.New("the subscriber fell behind the decisions")
+	ErrMaintenanceWindow            = errors.New("the maintenance window must end after it starts")
+	ErrPeerDead                     = errors.New("the peer has missed the keepalives")
+	ErrPeerBanned                   = errors.New("the peer is banned for misbehavior")
+	ErrPeerNotAllowed               = errors.New("the peer is not allowed by the access control lists")
+	ErrACLNetwork                   = errors.New("the network is neither an IP nor a CIDR")
+	ErrHandshakeNonce               = errors.New("the handshake nonce is missing or malformed")
+	ErrHandshakeReplay              = errors.New("the handshake has been replayed or is out of the time window")
+	ErrPeerKeyAuthConfirm           = errors.New("incorrect state for peer KeyAuthConfirm message")
+	ErrKeyAuthConfirm               = errors.New("the confirmation of the key authentication is invalid")
+	ErrSessionOpen                  = errors.New("the sealed frame cannot be opened by the session key")
+	ErrSessionPlaintext             = errors.New("a plaintext frame in the encrypted session")
+	ErrSessionNotEstablished        = errors.New("a sealed frame before the session keys are derived")
+	ErrAgentClosed                  = errors.New("the agent has been closed")
+	ErrCurveNotSupported            = errors.New("the curve of the public key is not supported")
+	ErrAgentShuttingDown            = errors.New("the agent is shutting down")
+	ErrProofMalformed               = errors.New("the proof is not a <decide> message")
+	ErrNotMultiplexed               = errors.New("the peer is not multiplexed")
+	ErrChannelReserved              = errors.New("the channel is reserved for the consensus stream")
+	ErrProtocolVersion              = errors.New("the protocol version of the peer is not supported")
+	ErrNoPunchPort                  = errors.New("hole punching requires a punch port")
+	ErrPunchUnreachable             = errors.New("the rendezvous cannot reach the target of the hole punch")
+	ErrNoPortMapper                 = errors.New("no port mapper is set")
+	ErrControlKey                   = errors.New("the key is not allowed on the control channel")
+	ErrControlAuth                  = errors.New("the control channel authentication failed")
+	ErrControlCommand               = errors.New("unexpected command on the control channel")
+	ErrOverloaded                   = errors.New("the node is shedding load")
+	ErrObserverNotAllowed           = errors.New("the observer is not allowed")
+	ErrPeerEventsOverflow           = errors.New("the subscriber fell behind the peer events")
+
+	// internal errors
+	errHandshakeCanceled = errors.New("the handshake has been canceled")
 )
@@ -0,0 +1,223 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/internal/identity"
+)
+
+const (
+	// DefaultPeerEventBuffer is the number of peer events buffered for a
+	// subscriber, a subscriber falling behind further is dropped.
+	DefaultPeerEventBuffer = 256
+)
+
+// PeerEventType is the type of a peer lifecycle event
+type PeerEventType int
+
+const (
+	// PeerConnected is published when a peer is added to the agent
+	PeerConnected PeerEventType = iota
+	// PeerAuthenticated is published when a peer has authenticated
+	PeerAuthenticated
+	// PeerHandshakeFailed is published when a peer failed to authenticate,
+	// or didn't authenticate in time
+	PeerHandshakeFailed
+	// PeerDisconnected is published when a peer is removed from the agent
+	PeerDisconnected
+	// PeerBanned is published when a host is banned, by it's score or Ban
+	PeerBanned
+)
+
+var peerEventTypeNames = [...]string{"connected", "authenticated", "handshake_failed", "disconnected", "banned"}
+
+func (t PeerEventType) String() string {
+	if t < 0 || int(t) >= len(peerEventTypeNames) {
+		return "unknown"
+	}
+	return peerEventTypeNames[t]
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (t PeerEventType) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
+
+// PeerEvent is a lifecycle event of a peer delivered to subscribers
+type PeerEvent struct {
+	Type      PeerEventType `json:"type"`
+	Time      time.Time     `json:"time"`
+	Address   string        `json:"address"`            // the host for PeerBanned
+	Identity  string        `json:"identity,omitempty"` // hex encoded, empty if not authenticated
+	PublicKey string        `json:"pubkey,omitempty"`   // hex encoded X|Y of the identity
+	Outbound  bool          `json:"outbound,omitempty"` // the connection was dialed by this agent
+	Error     string        `json:"error,omitempty"`    // why the handshake failed
+}
+
+// PeerEventSubscription delivers the peer events in order, C is closed when
+// the subscription ends.
+type PeerEventSubscription struct {
+	C <-chan PeerEvent
+
+	c     chan PeerEvent
+	agent *TCPAgent
+	err   error
+	once  sync.Once
+}
+
+// SubscribePeerEvents delivers the peer events published from now on, for
+// dashboards and automatic peer operations. The subscriber must keep up, or
+// the subscription ends with ErrPeerEventsOverflow.
+func (agent *TCPAgent) SubscribePeerEvents() *PeerEventSubscription {
+	sub := &PeerEventSubscription{agent: agent}
+	sub.c = make(chan PeerEvent, DefaultPeerEventBuffer)
+	sub.C = sub.c
+
+	agent.eventsLock.Lock()
+	defer agent.eventsLock.Unlock()
+	select {
+	case <-agent.die:
+		sub.end(nil)
+	default:
+		agent.peerEventSubs[sub] = true
+	}
+	return sub
+}
+
+// Err returns why the subscription ended after C has been closed, nil if
+// it was closed, or ErrPeerEventsOverflow if the subscriber fell behind.
+func (sub *PeerEventSubscription) Err() error { return sub.err }
+
+// Close ends the subscription
+func (sub *PeerEventSubscription) Close() {
+	sub.agent.eventsLock.Lock()
+	defer sub.agent.eventsLock.Unlock()
+	delete(sub.agent.peerEventSubs, sub)
+	sub.end(nil)
+}
+
+// end closes C with err.
+// NOTE: events lock must be held.
+func (sub *PeerEventSubscription) end(err error) {
+	sub.once.Do(func() {
+		sub.err = err
+		close(sub.c)
+	})
+}
+
+// publishPeerEvent delivers an event to subscribers, the ones whose buffer
+// is full are dropped rather than blocking the peers. It only takes the
+// events lock, so it can be called with the agent or peer lock held.
+func (agent *TCPAgent) publishPeerEvent(e PeerEvent) {
+	agent.eventsLock.Lock()
+	defer agent.eventsLock.Unlock()
+	for sub := range agent.peerEventSubs {
+		select {
+		case sub.c <- e:
+		default:
+			delete(agent.peerEventSubs, sub)
+			sub.end(ErrPeerEventsOverflow)
+		}
+	}
+}
+
+// closePeerEvents ends all subscriptions to peer events
+func (agent *TCPAgent) closePeerEvents() {
+	agent.eventsLock.Lock()
+	defer agent.eventsLock.Unlock()
+	for sub := range agent.peerEventSubs {
+		delete(agent.peerEventSubs, sub)
+		sub.end(nil)
+	}
+}
+
+// peerEvent returns an event of the peer, with the key it has authenticated
+func (p *TCPPeer) peerEvent(t PeerEventType) PeerEvent {
+	p.Lock()
+	defer p.Unlock()
+	return p.peerEventLocked(t)
+}
+
+// peerEventLocked returns an event of the peer, with the key it has
+// authenticated.
+// NOTE: peer lock must be held.
+func (p *TCPPeer) peerEventLocked(t PeerEventType) PeerEvent {
+	e := PeerEvent{Type: t, Time: time.Now(), Address: p.RemoteAddr().String(), Outbound: p.outbound}
+	if p.peerAuthStatus == peerAuthenticated {
+		key := p.peerPublicKey
+		if p.peerValidatorKey != nil {
+			key = p.peerValidatorKey
+		}
+		id := bdls.DefaultPubKeyToIdentity(key)
+		e.Identity = hex.EncodeToString(id[:])
+		e.PublicKey = identity.Encode(key)
+	}
+	return e
+}
+
+// PeerEventsHandler streams the peer events as json lines for the admin API,
+// see SubscribePeerEvents.
+func (agent *TCPAgent) PeerEventsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub := agent.SubscribePeerEvents()
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		enc := json.NewEncoder(w)
+		for {
+			select {
+			case e, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if err := enc.Encode(e); err != nil {
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
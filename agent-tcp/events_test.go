@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestPeerEvents(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a := newTestAgent(t, keyA)
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+	sub := a.SubscribePeerEvents()
+
+	next := func() PeerEvent {
+		select {
+		case e := <-sub.C:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("no peer event")
+		}
+		return PeerEvent{}
+	}
+
+	c1, c2 := net.Pipe()
+	pa := NewTCPPeer(c1, a)
+	pb := NewTCPPeer(c2, b)
+	assert.True(t, a.AddPeer(pa))
+	assert.True(t, b.AddPeer(pb))
+	e := next()
+	assert.Equal(t, PeerConnected, e.Type)
+	assert.Equal(t, pa.RemoteAddr().String(), e.Address)
+	assert.Equal(t, "", e.Identity)
+
+	pa.InitiatePublicKeyAuthentication()
+	pb.InitiatePublicKeyAuthentication()
+	id := bdls.DefaultPubKeyToIdentity(&keyB.PublicKey)
+	e = next()
+	assert.Equal(t, PeerAuthenticated, e.Type)
+	assert.Equal(t, hex.EncodeToString(id[:]), e.Identity)
+
+	assert.True(t, a.RemovePeer(pa))
+	e = next()
+	assert.Equal(t, PeerDisconnected, e.Type)
+	assert.Equal(t, hex.EncodeToString(id[:]), e.Identity)
+
+	// a connection not authenticating in time
+	c3, c4 := net.Pipe()
+	defer c4.Close()
+	NewTCPPeer(c3, a, WithHandshakeTimeout(100*time.Millisecond))
+	e = next()
+	assert.Equal(t, PeerHandshakeFailed, e.Type)
+	assert.Equal(t, ErrHandshakeTimeout.Error(), e.Error)
+
+	a.Ban("192.0.2.1", time.Minute)
+	e = next()
+	assert.Equal(t, PeerBanned, e.Type)
+	assert.Equal(t, "192.0.2.1", e.Address)
+	bts, err := json.Marshal(e)
+	assert.Nil(t, err)
+	assert.Contains(t, string(bts), `"type":"banned"`)
+
+	// the subscription ends with the agent
+	a.Close()
+	for range sub.C {
+	}
+	assert.Nil(t, sub.Err())
+}
@@ -0,0 +1,163 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// EvictionPolicy selects the inbound connection to close to make room for a
+// new one, once the max of inbound connections is reached.
+type EvictionPolicy int
+
+const (
+	// EvictNone refuses the new connections
+	EvictNone EvictionPolicy = iota
+	// EvictOldestUnauthenticated closes the oldest connection which hasn't
+	// authenticated yet, the new one is refused if all have.
+	EvictOldestUnauthenticated
+	// EvictLowestScore closes the connection of the host with the worst
+	// misbehavior score, then the oldest unauthenticated one at equal
+	// scores. Authenticated peers are evicted only if they have misbehaved,
+	// the new one is refused otherwise.
+	EvictLowestScore
+)
+
+func (e EvictionPolicy) String() string {
+	switch e {
+	case EvictNone:
+		return "none"
+	case EvictOldestUnauthenticated:
+		return "oldest-unauthenticated"
+	case EvictLowestScore:
+		return "lowest-score"
+	}
+	return "unknown"
+}
+
+// SetMaxConnections caps the concurrent inbound connections, authenticated
+// or not, so an agent exposed to the internet can't be exhausted by floods
+// of connections. Once max is reached, a connection is evicted by policy to
+// make room for a new one, or the new one is refused. 0 max disables it.
+func (agent *TCPAgent) SetMaxConnections(max int, policy EvictionPolicy) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.maxConns = max
+	agent.eviction = policy
+}
+
+// NumConnections returns the number of inbound connections, including the
+// ones not authenticated yet.
+func (agent *TCPAgent) NumConnections() int {
+	agent.Lock()
+	defer agent.Unlock()
+	return len(agent.inbound)
+}
+
+// admitConnection tracks an inbound connection until it's closed, and
+// returns false if it's refused, after evicting another one if required.
+func (agent *TCPAgent) admitConnection(p *TCPPeer) bool {
+	agent.Lock()
+	if agent.maxConns > 0 && len(agent.inbound) >= agent.maxConns {
+		victim := agent.evictionCandidate()
+		if victim == nil {
+			agent.Unlock()
+			log.Println("connection refused, too many connections:", p.RemoteAddr())
+			return false
+		}
+		delete(agent.inbound, victim)
+		log.Println("connection evicted:", victim.RemoteAddr(), agent.eviction)
+		defer victim.Close()
+	}
+	agent.inbound[p] = time.Now()
+	agent.Unlock()
+
+	go func() {
+		select {
+		case <-p.die:
+		case <-agent.die:
+		}
+		agent.Lock()
+		delete(agent.inbound, p)
+		agent.Unlock()
+	}()
+	return true
+}
+
+// evictionCandidate returns the inbound connection to evict by the policy,
+// or nil if none is.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) evictionCandidate() *TCPPeer {
+	type candidate struct {
+		p             *TCPPeer
+		since         time.Time
+		score         int
+		authenticated bool
+	}
+	var candidates []candidate
+	for p, since := range agent.inbound {
+		c := candidate{p: p, since: since, authenticated: p.GetPublicKey() != nil}
+		if score, ok := agent.scores[peerHost(p)]; ok {
+			c.score = score.score
+		}
+
+		switch agent.eviction {
+		case EvictOldestUnauthenticated:
+			if c.authenticated {
+				continue
+			}
+		case EvictLowestScore:
+			if c.authenticated && c.score <= 0 {
+				continue
+			}
+		default:
+			return nil
+		}
+		candidates = append(candidates, c)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.authenticated != b.authenticated {
+			return !a.authenticated
+		}
+		return a.since.Before(b.since)
+	})
+	return candidates[0].p
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestMaxConnections(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a := newTestAgent(t, key)
+	defer a.Close()
+	l, err := a.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+
+	// closed waits for the agent to close the connection
+	closed := func(conn net.Conn) bool {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err := io.Copy(io.Discard, conn)
+		return err == nil
+	}
+	dial := func() net.Conn {
+		n := a.NumConnections()
+		conn, err := net.Dial("tcp", l.Addr().String())
+		assert.Nil(t, err)
+		assert.Eventually(t, func() bool { return a.NumConnections() > n }, 5*time.Second, 10*time.Millisecond)
+		return conn
+	}
+
+	// the oldest unauthenticated connection makes room
+	a.SetMaxConnections(2, EvictOldestUnauthenticated)
+	c1 := dial()
+	c2 := dial()
+	defer c2.Close()
+	c3, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	defer c3.Close()
+	assert.True(t, closed(c1))
+	assert.Equal(t, 2, a.NumConnections())
+
+	// or the new one is refused
+	a.SetMaxConnections(2, EvictNone)
+	c4, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	assert.True(t, closed(c4))
+	assert.Equal(t, 2, a.NumConnections())
+
+	// authenticated peers are kept unless they misbehave
+	c2.Close()
+	c3.Close()
+	assert.Eventually(t, func() bool { return a.NumConnections() == 0 }, 5*time.Second, 10*time.Millisecond)
+	a.SetMaxConnections(1, EvictLowestScore)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = b.Connect(ctx, l.Addr().String(), &key.PublicKey)
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return a.NumPeers() == 1 }, 5*time.Second, 10*time.Millisecond)
+	c5, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	assert.True(t, closed(c5))
+	assert.Equal(t, 1, a.NumPeers())
+
+	a.SetBanPolicy(DefaultBanThreshold, DefaultBanDuration)
+	a.Lock()
+	a.scores["127.0.0.1"] = &peerScore{score: penaltyInvalidMessage, updated: time.Now()}
+	a.Unlock()
+	c6, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	defer c6.Close()
+	assert.Eventually(t, func() bool { return a.NumPeers() == 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, a.NumConnections())
+}
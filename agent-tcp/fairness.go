@@ -0,0 +1,275 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/big"
+	"net/http"
+	"sort"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/crypto/blake2b"
+)
+
+const (
+	// DefaultFairnessEpoch is the default number of heights of an epoch of
+	// the proposer fairness audit
+	DefaultFairnessEpoch = 100
+
+	// DefaultFairnessThreshold is the default z-score beyond which the
+	// share of decided proposals of a validator is flagged
+	DefaultFairnessThreshold = 3.0
+
+	// maxFairnessEpochs is the number of epochs kept, the current one
+	// included
+	maxFairnessEpochs = 8
+)
+
+// ProposerShare is the decided proposals of a validator in an epoch,
+// against it's expected share under the proposer policy: the leader
+// decides the maximal state of the <roundchange> messages, so each
+// validator proposing at a height is expected to have 1/k of it decided,
+// for k validators proposing.
+type ProposerShare struct {
+	Identity string  `json:"identity"` // hex encoded
+	Proposed int     `json:"proposed"` // the heights it has proposed at
+	Decided  float64 `json:"decided"`  // the heights it's proposals were decided at, shared if proposed by several
+	Expected float64 `json:"expected"`
+
+	// the deviation of Decided from Expected in standard deviations,
+	// flagged beyond the threshold, negative ones may indicate
+	// censorship, positive ones targeting of the others
+	ZScore  float64 `json:"z_score"`
+	Flagged bool    `json:"flagged"`
+}
+
+// FairnessEpoch is the proposer fairness audit of an epoch of heights
+type FairnessEpoch struct {
+	Epoch        uint64          `json:"epoch"`
+	FromHeight   uint64          `json:"from_height"`
+	ToHeight     uint64          `json:"to_height"`
+	Decided      int             `json:"decided"`      // the heights attributed to their proposers
+	Unattributed int             `json:"unattributed"` // the heights decided without their proposals seen, like those synced
+	Proposers    []ProposerShare `json:"proposers"`
+}
+
+// proposerTally accumulates a validator's share in an epoch
+type proposerTally struct {
+	proposed int
+	decided  float64
+	expected float64
+	variance float64
+}
+
+// fairnessEpoch accumulates an epoch
+type fairnessEpoch struct {
+	epoch        uint64
+	decided      int
+	unattributed int
+	tallies      map[bdls.Identity]*proposerTally
+}
+
+// SetFairnessAudit sets the number of heights of the epochs of the
+// proposer fairness audit, and the z-score beyond which a validator is
+// flagged, the epochs recorded so far are reset.
+func (agent *TCPAgent) SetFairnessAudit(epoch uint64, threshold float64) {
+	agent.Lock()
+	defer agent.Unlock()
+	if epoch > 0 {
+		agent.fairnessEpoch = epoch
+	}
+	if threshold > 0 {
+		agent.fairnessThreshold = threshold
+	}
+	agent.fairness = nil
+}
+
+// recordProposal records the state proposed by a validator in a verified
+// <roundchange> message, or proposed by this node, for the next height.
+// The validators are at most the participants, so a height is bounded.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) recordProposal(id bdls.Identity, height uint64, state bdls.State) {
+	if state == nil {
+		return
+	}
+	if height < agent.proposalHeight {
+		return
+	}
+	if height > agent.proposalHeight || agent.proposals == nil {
+		agent.proposalHeight = height
+		agent.proposals = make(map[bdls.StateHash]map[bdls.Identity]bool)
+	}
+
+	// a validator counts once a height, with the first state, as the
+	// <roundchange> messages of later rounds carry the maximal states
+	// seen, proposed by others
+	for _, ids := range agent.proposals {
+		if ids[id] {
+			return
+		}
+	}
+	hash := bdls.StateHash(blake2b.Sum256(state))
+	if agent.proposals[hash] == nil {
+		agent.proposals[hash] = make(map[bdls.Identity]bool)
+	}
+	agent.proposals[hash][id] = true
+}
+
+// identity returns the validator identity of this node, the validator key
+// of the key linkage if there is any.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) identity() bdls.Identity {
+	if agent.linkage != nil {
+		return bdls.DefaultPubKeyToIdentity(&ecdsa.PublicKey{X: new(big.Int).SetBytes(agent.linkage.X), Y: new(big.Int).SetBytes(agent.linkage.Y)})
+	}
+	return bdls.DefaultPubKeyToIdentity(&agent.privateKey.PublicKey)
+}
+
+// auditDecision attributes a decided height to the proposers of it's state
+// and accounts the expected shares of the validators proposing at it, the
+// proposers of the state are returned.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) auditDecision(height uint64, state bdls.State) map[bdls.Identity]bool {
+	if height == 0 {
+		return nil
+	}
+	epoch := agent.fairnessEpochOf(height)
+
+	proposers := make(map[bdls.Identity]bool)
+	var authors map[bdls.Identity]bool
+	if height == agent.proposalHeight {
+		for _, ids := range agent.proposals {
+			for id := range ids {
+				proposers[id] = true
+			}
+		}
+		authors = agent.proposals[bdls.StateHash(blake2b.Sum256(state))]
+	}
+	agent.proposals = nil
+	agent.proposalHeight = height + 1
+
+	if len(authors) == 0 {
+		epoch.unattributed++
+		return nil
+	}
+	epoch.decided++
+
+	p := 1 / float64(len(proposers))
+	for id := range proposers {
+		tally := epoch.tallies[id]
+		if tally == nil {
+			tally = new(proposerTally)
+			epoch.tallies[id] = tally
+		}
+		tally.proposed++
+		tally.expected += p
+		tally.variance += p * (1 - p)
+		if authors[id] {
+			tally.decided += 1 / float64(len(authors))
+		}
+	}
+	return authors
+}
+
+// fairnessEpochOf returns the epoch of a height, the oldest epochs are
+// dropped beyond maxFairnessEpochs.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) fairnessEpochOf(height uint64) *fairnessEpoch {
+	n := (height - 1) / agent.fairnessEpoch
+	if len(agent.fairness) > 0 && agent.fairness[len(agent.fairness)-1].epoch == n {
+		return agent.fairness[len(agent.fairness)-1]
+	}
+	epoch := &fairnessEpoch{epoch: n, tallies: make(map[bdls.Identity]*proposerTally)}
+	agent.fairness = append(agent.fairness, epoch)
+	if len(agent.fairness) > maxFairnessEpochs {
+		agent.fairness[0] = nil // avoid memory leak
+		agent.fairness = agent.fairness[1:]
+	}
+	return epoch
+}
+
+// Fairness returns the proposer fairness audit of the recent epochs, the
+// current one last, the validators in order of z-score, lowest first.
+func (agent *TCPAgent) Fairness() []FairnessEpoch {
+	agent.Lock()
+	defer agent.Unlock()
+
+	epochs := make([]FairnessEpoch, 0, len(agent.fairness))
+	for _, e := range agent.fairness {
+		epoch := FairnessEpoch{
+			Epoch:        e.epoch,
+			FromHeight:   e.epoch*agent.fairnessEpoch + 1,
+			ToHeight:     (e.epoch + 1) * agent.fairnessEpoch,
+			Decided:      e.decided,
+			Unattributed: e.unattributed,
+			Proposers:    make([]ProposerShare, 0, len(e.tallies)),
+		}
+		for id, tally := range e.tallies {
+			share := ProposerShare{
+				Identity: hex.EncodeToString(id[:]),
+				Proposed: tally.proposed,
+				Decided:  tally.decided,
+				Expected: tally.expected,
+			}
+			if tally.variance > 0 {
+				share.ZScore = (tally.decided - tally.expected) / math.Sqrt(tally.variance)
+				share.Flagged = math.Abs(share.ZScore) >= agent.fairnessThreshold
+			}
+			epoch.Proposers = append(epoch.Proposers, share)
+		}
+		sort.Slice(epoch.Proposers, func(i, j int) bool {
+			if epoch.Proposers[i].ZScore != epoch.Proposers[j].ZScore {
+				return epoch.Proposers[i].ZScore < epoch.Proposers[j].ZScore
+			}
+			return epoch.Proposers[i].Identity < epoch.Proposers[j].Identity
+		})
+		epochs = append(epochs, epoch)
+	}
+	return epochs
+}
+
+// FairnessHandler serves Fairness as json for the admin API
+func (agent *TCPAgent) FairnessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agent.Fairness())
+	})
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestFairnessAudit(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a := newTestAgent(t, key)
+	defer a.Close()
+	a.SetFairnessAudit(100, 3)
+
+	var ids []bdls.Identity
+	for i := 0; i < 4; i++ {
+		ids = append(ids, bdls.Identity{byte(i + 1)})
+	}
+	censored := ids[0]
+
+	// all propose at every height, the proposals of the censored one are
+	// never decided, the others take turns
+	a.Lock()
+	for h := uint64(1); h <= 100; h++ {
+		for i, id := range ids {
+			a.recordProposal(id, h, []byte{byte(h), byte(i)})
+		}
+		winner := 1 + int(h)%3
+		a.auditDecision(h, []byte{byte(h), byte(winner)})
+	}
+	// a height synced without the proposals seen, and proposals of a lower
+	// height are ignored
+	a.recordProposal(ids[1], 100, []byte{1})
+	a.auditDecision(101, []byte{1})
+	a.Unlock()
+
+	epochs := a.Fairness()
+	assert.Equal(t, 2, len(epochs))
+	epoch := epochs[0]
+	assert.Equal(t, uint64(1), epoch.FromHeight)
+	assert.Equal(t, uint64(100), epoch.ToHeight)
+	assert.Equal(t, 100, epoch.Decided)
+	assert.Equal(t, 0, epoch.Unattributed)
+	assert.Equal(t, 4, len(epoch.Proposers))
+	assert.Equal(t, hex.EncodeToString(censored[:]), epoch.Proposers[0].Identity)
+	assert.Equal(t, 100, epoch.Proposers[0].Proposed)
+	assert.Equal(t, 0.0, epoch.Proposers[0].Decided)
+	assert.InDelta(t, 25.0, epoch.Proposers[0].Expected, 1e-9)
+	assert.True(t, epoch.Proposers[0].ZScore < -3)
+	assert.True(t, epoch.Proposers[0].Flagged)
+	for _, share := range epoch.Proposers[1:] {
+		assert.InDelta(t, 33.3, share.Decided, 1)
+		assert.False(t, share.Flagged)
+	}
+	assert.Equal(t, uint64(1), epochs[1].Epoch)
+	assert.Equal(t, 0, epochs[1].Decided)
+	assert.Equal(t, 1, epochs[1].Unattributed)
+
+	// a state proposed by several is shared
+	a.Lock()
+	a.recordProposal(ids[1], 102, []byte("same"))
+	a.recordProposal(ids[2], 102, []byte("same"))
+	a.recordProposal(ids[3], 102, []byte("other"))
+	a.auditDecision(102, []byte("same"))
+	a.Unlock()
+	epochs = a.Fairness()
+	shares := make(map[string]ProposerShare)
+	for _, share := range epochs[1].Proposers {
+		shares[share.Identity] = share
+	}
+	assert.Equal(t, 3, len(shares))
+	assert.Equal(t, 0.5, shares[hex.EncodeToString(ids[1][:])].Decided)
+	assert.Equal(t, 0.0, shares[hex.EncodeToString(ids[3][:])].Decided)
+	assert.InDelta(t, 1.0/3, shares[hex.EncodeToString(ids[3][:])].Expected, 1e-9)
+
+	// this node's proposals are recorded
+	b := newTestAgent(t, key)
+	defer b.Close()
+	assert.Nil(t, b.Propose([]byte("mine")))
+	b.Lock()
+	b.auditDecision(1, []byte("mine"))
+	b.Unlock()
+	self := bdls.DefaultPubKeyToIdentity(&key.PublicKey)
+	epochs = b.Fairness()
+	assert.Equal(t, 1, len(epochs[0].Proposers))
+	assert.Equal(t, hex.EncodeToString(self[:]), epochs[0].Proposers[0].Identity)
+	assert.Equal(t, 1.0, epochs[0].Proposers[0].Decided)
+
+	// the oldest epochs are dropped
+	a.Lock()
+	for h := uint64(200); h <= 2000; h += 100 {
+		a.auditDecision(h, []byte{1})
+	}
+	a.Unlock()
+	assert.Equal(t, maxFairnessEpochs, len(a.Fairness()))
+
+	w := httptest.NewRecorder()
+	a.FairnessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fairness", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var served []FairnessEpoch
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&served))
+	assert.Equal(t, maxFairnessEpochs, len(served))
+}
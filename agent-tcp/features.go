@@ -0,0 +1,245 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/yonggewang/bdls"
+)
+
+// Feature is an optional capability of the protocol, advertised to peers in
+// the handshake.
+type Feature string
+
+const (
+	// FeatureCompression compresses large gossip payloads, see SetCompression
+	FeatureCompression Feature = "compression"
+	// FeatureRelay announces this standby node as a relay to the primaries,
+	// and redirects standby nodes to relays, see SetRelay & SetMaxReplicas
+	FeatureRelay Feature = "relay"
+	// FeatureEncryption encrypts the frames to a peer once both sides have
+	// authenticated, with keys derived from the secrets of the handshake
+	FeatureEncryption Feature = "encryption"
+	// FeatureObserver announces this node as an observer, which only
+	// receives the consensus messages & decisions, see NewObserverAgent
+	FeatureObserver Feature = "observer"
+)
+
+var (
+	// the features supported by default
+	defaultFeatures = []Feature{FeatureCompression, FeatureRelay, FeatureEncryption}
+)
+
+// FeatureStatus is the status of a feature for the admin API
+type FeatureStatus struct {
+	Name      Feature `json:"name"`
+	Supported bool    `json:"supported"` // supported & advertised by this node
+	Gated     bool    `json:"gated"`     // activated by a quorum
+	Active    bool    `json:"active"`
+	Support   int     `json:"support"` // the participants advertising support, this node included, or their weight
+	Quorum    int     `json:"quorum"`
+}
+
+// SetFeatures sets the features this agent supports, they're advertised to
+// the peers authenticating afterwards. All features are supported by default,
+// a feature not supported is never used, even if the peers support it.
+func (agent *TCPAgent) SetFeatures(features ...Feature) {
+	agent.Lock()
+	agent.features = make(map[Feature]bool)
+	for _, f := range features {
+		agent.features[f] = true
+	}
+	agent.Unlock()
+	agent.updateFeatures()
+}
+
+// SetFeatureGate gates a feature to be activated only after a quorum of the
+// participants, this node included, have advertised support for it, so a
+// feature can be rolled out incrementally without breaking a network with
+// nodes of older versions. A gated feature stays active once activated,
+// features are not gated by default.
+func (agent *TCPAgent) SetFeatureGate(feature Feature, gated bool) {
+	agent.Lock()
+	if gated {
+		agent.featureGates[feature] = true
+	} else {
+		delete(agent.featureGates, feature)
+	}
+	agent.Unlock()
+	agent.updateFeatures()
+}
+
+// FeatureActive returns true if a feature is supported by this node, and
+// activated by a quorum if it's gated.
+func (agent *TCPAgent) FeatureActive(feature Feature) bool {
+	active, _ := agent.activeFeatures.Load().(map[Feature]bool)
+	return active[feature]
+}
+
+// getFeatures returns the features advertised in the handshake
+func (agent *TCPAgent) getFeatures() []string {
+	agent.Lock()
+	defer agent.Unlock()
+	features := make([]string, 0, len(agent.features))
+	for f := range agent.features {
+		features = append(features, string(f))
+	}
+	sort.Strings(features)
+	return features
+}
+
+// featureSupport counts the participants advertising support for each
+// feature, or sums their weights if weighted, this node included, peers
+// connected more than once count once.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) featureSupport() map[Feature]int {
+	participants := make(map[bdls.Identity]bool)
+	for _, id := range agent.consensus.Participants() {
+		participants[id] = true
+	}
+
+	supporters := make(map[Feature]map[bdls.Identity]bool)
+	support := func(f Feature, id bdls.Identity) {
+		if !participants[id] {
+			return
+		}
+		if supporters[f] == nil {
+			supporters[f] = make(map[bdls.Identity]bool)
+		}
+		supporters[f][id] = true
+	}
+
+	for f := range agent.features {
+		support(f, bdls.DefaultPubKeyToIdentity(&agent.privateKey.PublicKey))
+	}
+	for _, p := range agent.peers {
+		p.Lock()
+		if p.peerAuthStatus == peerAuthenticated {
+			key := p.peerPublicKey
+			if p.peerValidatorKey != nil {
+				key = p.peerValidatorKey
+			}
+			id := bdls.DefaultPubKeyToIdentity(key)
+			for _, f := range p.peerFeatures {
+				support(f, id)
+			}
+		}
+		p.Unlock()
+	}
+
+	counts := make(map[Feature]int)
+	for f, ids := range supporters {
+		for id := range ids {
+			counts[f] += int(agent.consensus.Weight(id))
+		}
+	}
+	return counts
+}
+
+// updateFeatures activates the gated features supported by a quorum, and
+// publishes the active features.
+func (agent *TCPAgent) updateFeatures() {
+	agent.Lock()
+	defer agent.Unlock()
+
+	support := agent.featureSupport()
+	quorum := agent.consensus.Quorum()
+	active := make(map[Feature]bool)
+	for f := range agent.features {
+		if agent.featureGates[f] && !agent.activated[f] {
+			if support[f] < quorum {
+				continue
+			}
+			agent.activated[f] = true
+			log.Println("feature activated:", f)
+		}
+		active[f] = true
+	}
+	agent.activeFeatures.Store(active)
+}
+
+// Features returns the status of the features known to this node, the ones
+// supported or gated, in order of name.
+func (agent *TCPAgent) Features() []FeatureStatus {
+	agent.Lock()
+	defer agent.Unlock()
+
+	support := agent.featureSupport()
+	quorum := agent.consensus.Quorum()
+	names := make(map[Feature]bool)
+	for f := range agent.features {
+		names[f] = true
+	}
+	for f := range agent.featureGates {
+		names[f] = true
+	}
+
+	statuses := make([]FeatureStatus, 0, len(names))
+	for f := range names {
+		statuses = append(statuses, FeatureStatus{
+			Name:      f,
+			Supported: agent.features[f],
+			Gated:     agent.featureGates[f],
+			Active:    agent.features[f] && (!agent.featureGates[f] || agent.activated[f]),
+			Support:   support[f],
+			Quorum:    quorum,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// FeaturesHandler serves Features as json for the admin API
+func (agent *TCPAgent) FeaturesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agent.Features())
+	})
+}
+
+// toFeatures converts the features advertised by a peer
+func toFeatures(names []string) []Feature {
+	features := make([]Feature, 0, len(names))
+	for _, name := range names {
+		features = append(features, Feature(name))
+	}
+	return features
+}
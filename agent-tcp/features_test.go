@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestFeatureGate(t *testing.T) {
+	// 4 participants, a quorum of 3
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < 4; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, key)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+	agents := make([]*TCPAgent, len(keys))
+	for i, key := range keys {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = key
+		config.Participants = participants
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		agents[i] = NewTCPAgent(consensus, key)
+		defer agents[i].Close()
+	}
+
+	// connect connects agents[0] & agents[i], and waits for the support
+	// counted by agents[0]
+	connect := func(i int, support int) *TCPPeer {
+		c1, c2 := net.Pipe()
+		p1 := NewTCPPeer(c1, agents[0])
+		p2 := NewTCPPeer(c2, agents[i])
+		assert.True(t, agents[0].AddPeer(p1))
+		assert.True(t, agents[i].AddPeer(p2))
+		p1.InitiatePublicKeyAuthentication()
+		p2.InitiatePublicKeyAuthentication()
+		assert.Eventually(t, func() bool {
+			for _, status := range agents[0].Features() {
+				if status.Name == FeatureCompression {
+					return status.Support == support
+				}
+			}
+			return false
+		}, 5*time.Second, 10*time.Millisecond)
+		return p1
+	}
+
+	// not gated by default
+	assert.True(t, agents[0].FeatureActive(FeatureCompression))
+	assert.True(t, agents[0].FeatureActive(FeatureRelay))
+	assert.False(t, agents[0].FeatureActive(Feature("unknown")))
+
+	agents[0].SetFeatureGate(FeatureCompression, true)
+	assert.False(t, agents[0].FeatureActive(FeatureCompression))
+	assert.True(t, agents[0].FeatureActive(FeatureRelay))
+
+	// a peer of an older version advertises nothing
+	agents[2].SetFeatures()
+	connect(1, 2)
+	connect(2, 2)
+	assert.False(t, agents[0].FeatureActive(FeatureCompression))
+	p3 := connect(3, 3)
+	assert.True(t, agents[0].FeatureActive(FeatureCompression))
+
+	// stays active once activated
+	p3.Close()
+	assert.Eventually(t, func() bool { return agents[0].NumPeers() == 2 }, time.Second, 10*time.Millisecond)
+	agents[0].updateFeatures()
+	assert.True(t, agents[0].FeatureActive(FeatureCompression))
+
+	// features not supported are never active
+	agents[0].SetFeatures(FeatureCompression)
+	assert.False(t, agents[0].FeatureActive(FeatureRelay))
+	agents[0].SetRelay("127.0.0.1:4680", 1)
+	assert.Nil(t, agents[0].getRelay())
+
+	statuses := agents[0].Features()
+	assert.Equal(t, 1, len(statuses))
+	assert.Equal(t, FeatureStatus{Name: FeatureCompression, Supported: true, Gated: true, Active: true, Support: 2, Quorum: 3}, statuses[0])
+}
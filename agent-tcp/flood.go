@@ -0,0 +1,69 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"github.com/yonggewang/bdls"
+)
+
+// SetFlood enables relaying the consensus messages received to the other
+// peers, so the messages reach the participants not connected to their
+// signers, and the consensus stays live in a partial mesh. Each message is
+// relayed once, only after the consensus core has accepted it, and neither
+// back to the peer it came from, nor to it's signer. Disabled by default.
+func (agent *TCPAgent) SetFlood(enable bool) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.flood = enable
+}
+
+// floodMessage relays a consensus message accepted by the consensus core to
+// the authenticated peers, it's accepted once as the duplicates are dropped
+// before the core, the messages of this agent are broadcasted by the core
+// itself.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) floodMessage(signed *bdls.SignedProto, bts []byte, from *TCPPeer) {
+	if !agent.flood || agent.replica {
+		return
+	}
+	signer := bdls.DefaultPubKeyToIdentity(signed.PublicKey(bdls.S256Curve))
+	if signer == bdls.DefaultPubKeyToIdentity(&agent.privateKey.PublicKey) {
+		return
+	}
+	for _, p := range agent.peers {
+		if p == from {
+			continue
+		}
+		if key := p.GetPublicKey(); key != nil && bdls.DefaultPubKeyToIdentity(key) != signer {
+			p.Send(bts)
+		}
+	}
+}
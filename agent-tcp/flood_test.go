@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/agent-tcp/agenttest"
+)
+
+func TestSignatureOffloadFlood(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = keys[0]
+	config.Participants = coords
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	agent := NewTCPAgent(consensus, keys[0])
+	defer agent.Close()
+	agent.SetFlood(true)
+	agent.SetSignatureOffload(true)
+
+	// an authenticated peer to relay to
+	c1, c2 := net.Pipe()
+	p := NewTCPPeer(c1, agent)
+	defer p.Close()
+	p.Lock()
+	p.peerAuthStatus = peerAuthenticated
+	p.peerPublicKey = &keys[3].PublicKey
+	p.Unlock()
+
+	roundChange := func(signer *ecdsa.PrivateKey, forge bool) []byte {
+		sp := new(bdls.SignedProto)
+		sp.Sign(&bdls.Message{Type: bdls.MessageType_RoundChange, Height: 1}, signer)
+		if forge {
+			sp.S[0] ^= 0xff
+		}
+		bts, err := proto.Marshal(sp)
+		assert.Nil(t, err)
+		return bts
+	}
+
+	// the forged message accepted from the signer's connection is not
+	// relayed, the valid one is
+	forged := roundChange(keys[1], true)
+	valid := roundChange(keys[2], false)
+	agent.Lock()
+	agent.peers = append(agent.peers, p)
+	agent.processConsensusMessage(inboundMessage{bts: forged, sender: &keys[1].PublicKey})
+	agent.processConsensusMessage(inboundMessage{bts: valid, sender: &keys[2].PublicKey})
+	agent.Unlock()
+	assert.Equal(t, valid, readGossip(t, c2, CommandType_CONSENSUS))
+
+	// the signatures are left to the consensus core if the messages are
+	// not relayed
+	mock := agenttest.NewMockConsensus(coords...)
+	quiet := NewTCPAgent(mock, keys[0])
+	defer quiet.Close()
+	quiet.SetSignatureOffload(true)
+	quiet.Lock()
+	quiet.processConsensusMessage(inboundMessage{bts: valid, sender: &keys[2].PublicKey})
+	quiet.Unlock()
+	assert.Equal(t, 1, len(mock.Messages()))
+	assert.Equal(t, 0, mock.Verified())
+}
+
+func TestFlood(t *testing.T) {
+	// the participants are connected in a line, 0-1-2-3, so the messages of
+	// the ends must be relayed to reach each other
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, key)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+
+	epoch := time.Now()
+	var agents []*TCPAgent
+	for i := range keys {
+		config := new(bdls.Config)
+		config.Epoch = epoch
+		config.PrivateKey = keys[i]
+		config.Participants = participants
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		consensus.SetLatency(100 * time.Millisecond)
+		agent := NewTCPAgent(consensus, keys[i])
+		agent.SetFlood(true)
+		defer agent.Close()
+		agents = append(agents, agent)
+	}
+
+	for i := 0; i+1 < len(agents); i++ {
+		c1, c2 := net.Pipe()
+		p1 := NewTCPPeer(c1, agents[i])
+		p2 := NewTCPPeer(c2, agents[i+1])
+		assert.True(t, agents[i].AddPeer(p1))
+		assert.True(t, agents[i+1].AddPeer(p2))
+		p1.InitiatePublicKeyAuthentication()
+		p2.InitiatePublicKeyAuthentication()
+	}
+	for _, agent := range agents {
+		assert.Eventually(t, func() bool {
+			agent.Lock()
+			defer agent.Unlock()
+			for _, p := range agent.peers {
+				if !p.MutuallyAuthenticated() {
+					return false
+				}
+			}
+			return true
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	for _, agent := range agents {
+		agent.Update()
+		data := make([]byte, 1024)
+		io.ReadFull(rand.Reader, data)
+		agent.Propose(data)
+	}
+	for i, agent := range agents {
+		assert.Eventually(t, func() bool {
+			height, _, _ := agent.GetLatestState()
+			return height > 0
+		}, 30*time.Second, 20*time.Millisecond, "participant %v", i)
+	}
+}
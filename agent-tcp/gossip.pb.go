@@ -31,14 +31,56 @@ const (
 	CommandType_KEY_AUTH_CHALLENGE       CommandType = 2
 	CommandType_KEY_AUTH_CHALLENGE_REPLY CommandType = 3
 	CommandType_CONSENSUS                CommandType = 4
+	CommandType_REPLICA_SUBSCRIBE        CommandType = 5
+	CommandType_REPLICA_DECISION         CommandType = 6
+	CommandType_LATENCY_PING             CommandType = 7
+	CommandType_LATENCY_PONG             CommandType = 8
+	CommandType_LATENCY_STATUS           CommandType = 9
+	CommandType_LEAVING                  CommandType = 10
+	CommandType_MAINTENANCE              CommandType = 11
+	CommandType_REPLICA_REDIRECT         CommandType = 12
+	CommandType_KEY_AUTH_CONFIRM         CommandType = 13
+	CommandType_SEALED                   CommandType = 14
+	CommandType_REKEY                    CommandType = 15
+	CommandType_OBSERVED_ADDR            CommandType = 16
+	CommandType_PUNCH_REQUEST            CommandType = 17
+	CommandType_PUNCH                    CommandType = 18
+	// the commands of control channels, never sent to peers
+	CommandType_CONTROL_HELLO    CommandType = 19
+	CommandType_CONTROL_AUTH     CommandType = 20
+	CommandType_CONTROL_REQUEST  CommandType = 21
+	CommandType_CONTROL_RESPONSE CommandType = 22
+	// height catch-up from peers
+	CommandType_SYNC_REQUEST  CommandType = 23
+	CommandType_SYNC_DECISION CommandType = 24
 )
 
 var CommandType_name = map[int32]string{
-	0: "NOP",
-	1: "KEY_AUTH_INIT",
-	2: "KEY_AUTH_CHALLENGE",
-	3: "KEY_AUTH_CHALLENGE_REPLY",
-	4: "CONSENSUS",
+	0:  "NOP",
+	1:  "KEY_AUTH_INIT",
+	2:  "KEY_AUTH_CHALLENGE",
+	3:  "KEY_AUTH_CHALLENGE_REPLY",
+	4:  "CONSENSUS",
+	5:  "REPLICA_SUBSCRIBE",
+	6:  "REPLICA_DECISION",
+	7:  "LATENCY_PING",
+	8:  "LATENCY_PONG",
+	9:  "LATENCY_STATUS",
+	10: "LEAVING",
+	11: "MAINTENANCE",
+	12: "REPLICA_REDIRECT",
+	13: "KEY_AUTH_CONFIRM",
+	14: "SEALED",
+	15: "REKEY",
+	16: "OBSERVED_ADDR",
+	17: "PUNCH_REQUEST",
+	18: "PUNCH",
+	19: "CONTROL_HELLO",
+	20: "CONTROL_AUTH",
+	21: "CONTROL_REQUEST",
+	22: "CONTROL_RESPONSE",
+	23: "SYNC_REQUEST",
+	24: "SYNC_DECISION",
 }
 
 var CommandType_value = map[string]int32{
@@ -47,6 +89,26 @@ var CommandType_value = map[string]int32{
 	"KEY_AUTH_CHALLENGE":       2,
 	"KEY_AUTH_CHALLENGE_REPLY": 3,
 	"CONSENSUS":                4,
+	"REPLICA_SUBSCRIBE":        5,
+	"REPLICA_DECISION":         6,
+	"LATENCY_PING":             7,
+	"LATENCY_PONG":             8,
+	"LATENCY_STATUS":           9,
+	"LEAVING":                  10,
+	"MAINTENANCE":              11,
+	"REPLICA_REDIRECT":         12,
+	"KEY_AUTH_CONFIRM":         13,
+	"SEALED":                   14,
+	"REKEY":                    15,
+	"OBSERVED_ADDR":            16,
+	"PUNCH_REQUEST":            17,
+	"PUNCH":                    18,
+	"CONTROL_HELLO":            19,
+	"CONTROL_AUTH":             20,
+	"CONTROL_REQUEST":          21,
+	"CONTROL_RESPONSE":         22,
+	"SYNC_REQUEST":             23,
+	"SYNC_DECISION":            24,
 }
 
 func (x CommandType) String() string {
@@ -57,13 +119,46 @@ func (CommandType) EnumDescriptor() ([]byte, []int) {
 	return fileDescriptor_878fa4887b90140c, []int{0}
 }
 
-// Gossip defines a stream based protocol
+// CompressionType is the algorithm compressing Gossip.Message
+type CompressionType int32
+
+const (
+	CompressionType_NONE   CompressionType = 0
+	CompressionType_SNAPPY CompressionType = 1
+	CompressionType_ZSTD   CompressionType = 2
+)
+
+var CompressionType_name = map[int32]string{
+	0: "NONE",
+	1: "SNAPPY",
+	2: "ZSTD",
+}
+
+var CompressionType_value = map[string]int32{
+	"NONE":   0,
+	"SNAPPY": 1,
+	"ZSTD":   2,
+}
+
+func (x CompressionType) String() string {
+	return proto.EnumName(CompressionType_name, int32(x))
+}
+
+func (CompressionType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{1}
+}
+
+// Gossip defines a stream based protocol, after both sides have
+// authenticated, the frames may be encrypted as the Message of SEALED ones
 type Gossip struct {
-	Command              CommandType `protobuf:"varint,1,opt,name=Command,proto3,enum=agent.CommandType" json:"Command,omitempty"`
-	Message              []byte      `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
-	XXX_unrecognized     []byte      `json:"-"`
-	XXX_sizecache        int32       `json:"-"`
+	Command     CommandType     `protobuf:"varint,1,opt,name=Command,proto3,enum=agent.CommandType" json:"Command,omitempty"`
+	Message     []byte          `protobuf:"bytes,2,opt,name=Message,proto3" json:"Message,omitempty"`
+	Compression CompressionType `protobuf:"varint,3,opt,name=Compression,proto3,enum=agent.CompressionType" json:"Compression,omitempty"`
+	// (optional) ignored, pads sealed frames to their size buckets
+	Padding              []byte   `protobuf:"bytes,4,opt,name=Padding,proto3" json:"Padding,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *Gossip) Reset()         { *m = Gossip{} }
@@ -113,10 +208,36 @@ func (m *Gossip) GetMessage() []byte {
 	return nil
 }
 
+func (m *Gossip) GetCompression() CompressionType {
+	if m != nil {
+		return m.Compression
+	}
+	return CompressionType_NONE
+}
+
+func (m *Gossip) GetPadding() []byte {
+	if m != nil {
+		return m.Padding
+	}
+	return nil
+}
+
 type KeyAuthInit struct {
 	// client public key
-	X                    []byte   `protobuf:"bytes,1,opt,name=X,proto3" json:"X,omitempty"`
-	Y                    []byte   `protobuf:"bytes,2,opt,name=Y,proto3" json:"Y,omitempty"`
+	X []byte `protobuf:"bytes,1,opt,name=X,proto3" json:"X,omitempty"`
+	Y []byte `protobuf:"bytes,2,opt,name=Y,proto3" json:"Y,omitempty"`
+	// (optional) the statement to link this key to a validator key
+	Linkage *KeyLinkage `protobuf:"bytes,3,opt,name=Linkage,proto3" json:"Linkage,omitempty"`
+	// the compression algorithms the sender can decompress
+	Compressions []CompressionType `protobuf:"varint,4,rep,packed,name=Compressions,proto3,enum=agent.CompressionType" json:"Compressions,omitempty"`
+	// random per connection, the challenge reply is bound to it
+	Nonce []byte `protobuf:"bytes,5,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	// unix seconds of sending, stale or repeated nonces are rejected
+	Timestamp int64 `protobuf:"varint,6,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"`
+	// the optional features the sender supports
+	Features []string `protobuf:"bytes,7,rep,name=Features,proto3" json:"Features,omitempty"`
+	// the curve of the public key, empty for secp256k1
+	Curve                string   `protobuf:"bytes,8,opt,name=Curve,proto3" json:"Curve,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -169,12 +290,158 @@ func (m *KeyAuthInit) GetY() []byte {
 	return nil
 }
 
+func (m *KeyAuthInit) GetLinkage() *KeyLinkage {
+	if m != nil {
+		return m.Linkage
+	}
+	return nil
+}
+
+func (m *KeyAuthInit) GetCompressions() []CompressionType {
+	if m != nil {
+		return m.Compressions
+	}
+	return nil
+}
+
+func (m *KeyAuthInit) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
+func (m *KeyAuthInit) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *KeyAuthInit) GetFeatures() []string {
+	if m != nil {
+		return m.Features
+	}
+	return nil
+}
+
+func (m *KeyAuthInit) GetCurve() string {
+	if m != nil {
+		return m.Curve
+	}
+	return ""
+}
+
+// KeyLinkage is a statement signed by a validator key, to delegate
+// a transport key to act on behalf of the validator
+type KeyLinkage struct {
+	// validator public key
+	X []byte `protobuf:"bytes,1,opt,name=X,proto3" json:"X,omitempty"`
+	Y []byte `protobuf:"bytes,2,opt,name=Y,proto3" json:"Y,omitempty"`
+	// signature r,s for prefix+transport key+sequence+validity window
+	R []byte `protobuf:"bytes,3,opt,name=R,proto3" json:"R,omitempty"`
+	S []byte `protobuf:"bytes,4,opt,name=S,proto3" json:"S,omitempty"`
+	// sequence number of the statement, a statement with higher sequence
+	// supersedes all lower ones from the same validator
+	Sequence uint64 `protobuf:"varint,5,opt,name=Sequence,proto3" json:"Sequence,omitempty"`
+	// validity window of the statement in unix seconds
+	NotBefore            int64    `protobuf:"varint,6,opt,name=NotBefore,proto3" json:"NotBefore,omitempty"`
+	NotAfter             int64    `protobuf:"varint,7,opt,name=NotAfter,proto3" json:"NotAfter,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *KeyLinkage) Reset()         { *m = KeyLinkage{} }
+func (m *KeyLinkage) String() string { return proto.CompactTextString(m) }
+func (*KeyLinkage) ProtoMessage()    {}
+func (*KeyLinkage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{2}
+}
+func (m *KeyLinkage) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *KeyLinkage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_KeyLinkage.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *KeyLinkage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_KeyLinkage.Merge(m, src)
+}
+func (m *KeyLinkage) XXX_Size() int {
+	return m.Size()
+}
+func (m *KeyLinkage) XXX_DiscardUnknown() {
+	xxx_messageInfo_KeyLinkage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_KeyLinkage proto.InternalMessageInfo
+
+func (m *KeyLinkage) GetX() []byte {
+	if m != nil {
+		return m.X
+	}
+	return nil
+}
+
+func (m *KeyLinkage) GetY() []byte {
+	if m != nil {
+		return m.Y
+	}
+	return nil
+}
+
+func (m *KeyLinkage) GetR() []byte {
+	if m != nil {
+		return m.R
+	}
+	return nil
+}
+
+func (m *KeyLinkage) GetS() []byte {
+	if m != nil {
+		return m.S
+	}
+	return nil
+}
+
+func (m *KeyLinkage) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *KeyLinkage) GetNotBefore() int64 {
+	if m != nil {
+		return m.NotBefore
+	}
+	return 0
+}
+
+func (m *KeyLinkage) GetNotAfter() int64 {
+	if m != nil {
+		return m.NotAfter
+	}
+	return 0
+}
+
 type KeyAuthChallenge struct {
 	// server ephermal publickey for client authentication
 	X []byte `protobuf:"bytes,1,opt,name=X,proto3" json:"X,omitempty"`
 	Y []byte `protobuf:"bytes,2,opt,name=Y,proto3" json:"Y,omitempty"`
 	// the challenge message, the peer can create the correct HMAC with this message
-	Challenge            []byte   `protobuf:"bytes,3,opt,name=Challenge,proto3" json:"Challenge,omitempty"`
+	Challenge []byte `protobuf:"bytes,3,opt,name=Challenge,proto3" json:"Challenge,omitempty"`
+	// the challenger's nonce of the connection
+	Nonce                []byte   `protobuf:"bytes,4,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -184,7 +451,7 @@ func (m *KeyAuthChallenge) Reset()         { *m = KeyAuthChallenge{} }
 func (m *KeyAuthChallenge) String() string { return proto.CompactTextString(m) }
 func (*KeyAuthChallenge) ProtoMessage()    {}
 func (*KeyAuthChallenge) Descriptor() ([]byte, []int) {
-	return fileDescriptor_878fa4887b90140c, []int{2}
+	return fileDescriptor_878fa4887b90140c, []int{3}
 }
 func (m *KeyAuthChallenge) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -234,8 +501,18 @@ func (m *KeyAuthChallenge) GetChallenge() []byte {
 	return nil
 }
 
+func (m *KeyAuthChallenge) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
 type KeyAuthChallengeReply struct {
+	// HMAC & signature r,s for the transcript of the handshake
 	HMAC                 []byte   `protobuf:"bytes,1,opt,name=HMAC,proto3" json:"HMAC,omitempty"`
+	R                    []byte   `protobuf:"bytes,2,opt,name=R,proto3" json:"R,omitempty"`
+	S                    []byte   `protobuf:"bytes,3,opt,name=S,proto3" json:"S,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -245,7 +522,7 @@ func (m *KeyAuthChallengeReply) Reset()         { *m = KeyAuthChallengeReply{} }
 func (m *KeyAuthChallengeReply) String() string { return proto.CompactTextString(m) }
 func (*KeyAuthChallengeReply) ProtoMessage()    {}
 func (*KeyAuthChallengeReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_878fa4887b90140c, []int{3}
+	return fileDescriptor_878fa4887b90140c, []int{4}
 }
 func (m *KeyAuthChallengeReply) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -281,297 +558,4938 @@ func (m *KeyAuthChallengeReply) GetHMAC() []byte {
 	return nil
 }
 
-func init() {
-	proto.RegisterEnum("agent.CommandType", CommandType_name, CommandType_value)
-	proto.RegisterType((*Gossip)(nil), "agent.Gossip")
-	proto.RegisterType((*KeyAuthInit)(nil), "agent.KeyAuthInit")
-	proto.RegisterType((*KeyAuthChallenge)(nil), "agent.KeyAuthChallenge")
-	proto.RegisterType((*KeyAuthChallengeReply)(nil), "agent.KeyAuthChallengeReply")
-}
-
-func init() { proto.RegisterFile("gossip.proto", fileDescriptor_878fa4887b90140c) }
-
-var fileDescriptor_878fa4887b90140c = []byte{
-	// 285 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x91, 0xcd, 0x6a, 0x83, 0x50,
-	0x10, 0x85, 0x7b, 0x63, 0x1a, 0xc9, 0xc4, 0x94, 0xdb, 0x81, 0x16, 0x17, 0x41, 0x82, 0xab, 0xf4,
-	0x07, 0x17, 0xed, 0x13, 0x58, 0x91, 0x28, 0x31, 0x46, 0xd4, 0x40, 0x5c, 0x89, 0xa5, 0x17, 0x13,
-	0x30, 0x2a, 0xd5, 0x2e, 0x7c, 0xc3, 0x2e, 0xfb, 0x08, 0xc5, 0x27, 0x29, 0xbd, 0x98, 0xb4, 0xb4,
-	0x90, 0xdd, 0x9c, 0x8f, 0x6f, 0x0e, 0x0c, 0x03, 0x52, 0x5a, 0x54, 0xd5, 0xae, 0xd4, 0xca, 0xd7,
-	0xa2, 0x2e, 0xf0, 0x3c, 0x49, 0x59, 0x5e, 0xab, 0x1e, 0x0c, 0xe6, 0x1c, 0xe3, 0x3d, 0x88, 0x46,
-	0xb1, 0xdf, 0x27, 0xf9, 0x8b, 0x4c, 0xa6, 0x64, 0x76, 0xf1, 0x80, 0x1a, 0x57, 0xb4, 0x8e, 0x86,
-	0x4d, 0xc9, 0xfc, 0x83, 0x82, 0x32, 0x88, 0x4b, 0x56, 0x55, 0x49, 0xca, 0xe4, 0xde, 0x94, 0xcc,
-	0x24, 0xff, 0x10, 0xd5, 0x1b, 0x18, 0x2d, 0x58, 0xa3, 0xbf, 0xd5, 0x5b, 0x3b, 0xdf, 0xd5, 0x28,
-	0x01, 0xd9, 0xf0, 0x42, 0xc9, 0x27, 0x9b, 0xef, 0x14, 0x75, 0x0b, 0x24, 0x52, 0x1d, 0xa0, 0x9d,
-	0x6a, 0x6c, 0x93, 0x2c, 0x63, 0x79, 0xca, 0x4e, 0xf9, 0x38, 0x81, 0xe1, 0x51, 0x94, 0x05, 0x4e,
-	0x7f, 0x80, 0x7a, 0x07, 0x57, 0x7f, 0xdb, 0x7c, 0x56, 0x66, 0x0d, 0x22, 0xf4, 0xad, 0xa5, 0x6e,
-	0x74, 0xad, 0x7c, 0xbe, 0xcd, 0x61, 0xf4, 0xeb, 0x2e, 0x14, 0x41, 0x70, 0x57, 0x1e, 0x3d, 0xc3,
-	0x4b, 0x18, 0x2f, 0xcc, 0x28, 0xd6, 0xd7, 0xa1, 0x15, 0xdb, 0xae, 0x1d, 0x52, 0x82, 0xd7, 0x80,
-	0x47, 0x64, 0x58, 0xba, 0xe3, 0x98, 0xee, 0xdc, 0xa4, 0x3d, 0x9c, 0x80, 0xfc, 0x9f, 0xc7, 0xbe,
-	0xe9, 0x39, 0x11, 0x15, 0x70, 0x0c, 0x43, 0x63, 0xe5, 0x06, 0xa6, 0x1b, 0xac, 0x03, 0xda, 0x7f,
-	0x92, 0xde, 0x5b, 0x85, 0x7c, 0xb4, 0x0a, 0xf9, 0x6c, 0x15, 0xf2, 0x3c, 0xe0, 0x3f, 0x78, 0xfc,
-	0x0a, 0x00, 0x00, 0xff, 0xff, 0x96, 0x66, 0x6e, 0x1f, 0x93, 0x01, 0x00, 0x00,
+func (m *KeyAuthChallengeReply) GetR() []byte {
+	if m != nil {
+		return m.R
+	}
+	return nil
 }
 
-func (m *Gossip) Marshal() (dAtA []byte, err error) {
-	size := m.Size()
-	dAtA = make([]byte, size)
-	n, err := m.MarshalToSizedBuffer(dAtA[:size])
-	if err != nil {
-		return nil, err
+func (m *KeyAuthChallengeReply) GetS() []byte {
+	if m != nil {
+		return m.S
 	}
-	return dAtA[:n], nil
+	return nil
 }
 
-func (m *Gossip) MarshalTo(dAtA []byte) (int, error) {
-	size := m.Size()
-	return m.MarshalToSizedBuffer(dAtA[:size])
+// KeyAuthConfirm is sent by the challenger once it has accepted the reply,
+// so the peer knows it's authenticated
+type KeyAuthConfirm struct {
+	// HMAC of the transcript with the confirmation prefix
+	HMAC                 []byte   `protobuf:"bytes,1,opt,name=HMAC,proto3" json:"HMAC,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *Gossip) MarshalToSizedBuffer(dAtA []byte) (int, error) {
-	i := len(dAtA)
-	_ = i
-	var l int
-	_ = l
-	if m.XXX_unrecognized != nil {
-		i -= len(m.XXX_unrecognized)
-		copy(dAtA[i:], m.XXX_unrecognized)
-	}
-	if len(m.Message) > 0 {
-		i -= len(m.Message)
-		copy(dAtA[i:], m.Message)
-		i = encodeVarintGossip(dAtA, i, uint64(len(m.Message)))
-		i--
-		dAtA[i] = 0x12
-	}
-	if m.Command != 0 {
-		i = encodeVarintGossip(dAtA, i, uint64(m.Command))
-		i--
-		dAtA[i] = 0x8
+func (m *KeyAuthConfirm) Reset()         { *m = KeyAuthConfirm{} }
+func (m *KeyAuthConfirm) String() string { return proto.CompactTextString(m) }
+func (*KeyAuthConfirm) ProtoMessage()    {}
+func (*KeyAuthConfirm) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{5}
+}
+func (m *KeyAuthConfirm) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *KeyAuthConfirm) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_KeyAuthConfirm.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
 	}
-	return len(dAtA) - i, nil
+}
+func (m *KeyAuthConfirm) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_KeyAuthConfirm.Merge(m, src)
+}
+func (m *KeyAuthConfirm) XXX_Size() int {
+	return m.Size()
+}
+func (m *KeyAuthConfirm) XXX_DiscardUnknown() {
+	xxx_messageInfo_KeyAuthConfirm.DiscardUnknown(m)
 }
 
-func (m *KeyAuthInit) Marshal() (dAtA []byte, err error) {
-	size := m.Size()
-	dAtA = make([]byte, size)
-	n, err := m.MarshalToSizedBuffer(dAtA[:size])
-	if err != nil {
-		return nil, err
+var xxx_messageInfo_KeyAuthConfirm proto.InternalMessageInfo
+
+func (m *KeyAuthConfirm) GetHMAC() []byte {
+	if m != nil {
+		return m.HMAC
 	}
-	return dAtA[:n], nil
+	return nil
 }
 
-func (m *KeyAuthInit) MarshalTo(dAtA []byte) (int, error) {
-	size := m.Size()
-	return m.MarshalToSizedBuffer(dAtA[:size])
+// Hello is the first frame on a connection, framed as a NOP so agents of
+// version 1 take it as a keepalive
+type Hello struct {
+	// the newest protocol version of the sender
+	Version uint32 `protobuf:"varint,1,opt,name=Version,proto3" json:"Version,omitempty"`
+	// the oldest protocol version the sender talks
+	MinVersion uint32 `protobuf:"varint,2,opt,name=MinVersion,proto3" json:"MinVersion,omitempty"`
+	// the optional features of the sender
+	Features             []string `protobuf:"bytes,3,rep,name=Features,proto3" json:"Features,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *KeyAuthInit) MarshalToSizedBuffer(dAtA []byte) (int, error) {
-	i := len(dAtA)
-	_ = i
-	var l int
-	_ = l
-	if m.XXX_unrecognized != nil {
-		i -= len(m.XXX_unrecognized)
-		copy(dAtA[i:], m.XXX_unrecognized)
-	}
-	if len(m.Y) > 0 {
-		i -= len(m.Y)
-		copy(dAtA[i:], m.Y)
-		i = encodeVarintGossip(dAtA, i, uint64(len(m.Y)))
-		i--
-		dAtA[i] = 0x12
-	}
-	if len(m.X) > 0 {
-		i -= len(m.X)
-		copy(dAtA[i:], m.X)
-		i = encodeVarintGossip(dAtA, i, uint64(len(m.X)))
-		i--
-		dAtA[i] = 0xa
+func (m *Hello) Reset()         { *m = Hello{} }
+func (m *Hello) String() string { return proto.CompactTextString(m) }
+func (*Hello) ProtoMessage()    {}
+func (*Hello) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{6}
+}
+func (m *Hello) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *Hello) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_Hello.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
 	}
-	return len(dAtA) - i, nil
+}
+func (m *Hello) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Hello.Merge(m, src)
+}
+func (m *Hello) XXX_Size() int {
+	return m.Size()
+}
+func (m *Hello) XXX_DiscardUnknown() {
+	xxx_messageInfo_Hello.DiscardUnknown(m)
 }
 
-func (m *KeyAuthChallenge) Marshal() (dAtA []byte, err error) {
-	size := m.Size()
-	dAtA = make([]byte, size)
-	n, err := m.MarshalToSizedBuffer(dAtA[:size])
-	if err != nil {
-		return nil, err
+var xxx_messageInfo_Hello proto.InternalMessageInfo
+
+func (m *Hello) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
 	}
-	return dAtA[:n], nil
+	return 0
 }
 
-func (m *KeyAuthChallenge) MarshalTo(dAtA []byte) (int, error) {
-	size := m.Size()
-	return m.MarshalToSizedBuffer(dAtA[:size])
+func (m *Hello) GetMinVersion() uint32 {
+	if m != nil {
+		return m.MinVersion
+	}
+	return 0
 }
 
-func (m *KeyAuthChallenge) MarshalToSizedBuffer(dAtA []byte) (int, error) {
-	i := len(dAtA)
-	_ = i
-	var l int
-	_ = l
-	if m.XXX_unrecognized != nil {
-		i -= len(m.XXX_unrecognized)
-		copy(dAtA[i:], m.XXX_unrecognized)
-	}
-	if len(m.Challenge) > 0 {
-		i -= len(m.Challenge)
-		copy(dAtA[i:], m.Challenge)
-		i = encodeVarintGossip(dAtA, i, uint64(len(m.Challenge)))
-		i--
-		dAtA[i] = 0x1a
+func (m *Hello) GetFeatures() []string {
+	if m != nil {
+		return m.Features
 	}
-	if len(m.Y) > 0 {
-		i -= len(m.Y)
-		copy(dAtA[i:], m.Y)
-		i = encodeVarintGossip(dAtA, i, uint64(len(m.Y)))
-		i--
-		dAtA[i] = 0x12
+	return nil
+}
+
+// SessionRekey rotates the key of the frames from the sender, sealed with
+// the current key
+type SessionRekey struct {
+	// the ephemeral public key of the sender, the new key is derived from
+	// it's ECDH secret with the static key of the receiver
+	X                    []byte   `protobuf:"bytes,1,opt,name=X,proto3" json:"X,omitempty"`
+	Y                    []byte   `protobuf:"bytes,2,opt,name=Y,proto3" json:"Y,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SessionRekey) Reset()         { *m = SessionRekey{} }
+func (m *SessionRekey) String() string { return proto.CompactTextString(m) }
+func (*SessionRekey) ProtoMessage()    {}
+func (*SessionRekey) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{7}
+}
+func (m *SessionRekey) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *SessionRekey) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_SessionRekey.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
 	}
-	if len(m.X) > 0 {
-		i -= len(m.X)
-		copy(dAtA[i:], m.X)
-		i = encodeVarintGossip(dAtA, i, uint64(len(m.X)))
-		i--
-		dAtA[i] = 0xa
+}
+func (m *SessionRekey) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SessionRekey.Merge(m, src)
+}
+func (m *SessionRekey) XXX_Size() int {
+	return m.Size()
+}
+func (m *SessionRekey) XXX_DiscardUnknown() {
+	xxx_messageInfo_SessionRekey.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SessionRekey proto.InternalMessageInfo
+
+func (m *SessionRekey) GetX() []byte {
+	if m != nil {
+		return m.X
 	}
-	return len(dAtA) - i, nil
+	return nil
 }
 
-func (m *KeyAuthChallengeReply) Marshal() (dAtA []byte, err error) {
-	size := m.Size()
-	dAtA = make([]byte, size)
-	n, err := m.MarshalToSizedBuffer(dAtA[:size])
-	if err != nil {
-		return nil, err
+func (m *SessionRekey) GetY() []byte {
+	if m != nil {
+		return m.Y
 	}
-	return dAtA[:n], nil
+	return nil
 }
 
-func (m *KeyAuthChallengeReply) MarshalTo(dAtA []byte) (int, error) {
-	size := m.Size()
-	return m.MarshalToSizedBuffer(dAtA[:size])
+// ReplicaSubscribe is sent by a standby node to tail decisions of the primary
+type ReplicaSubscribe struct {
+	// the first height to stream decisions from
+	FromHeight uint64 `protobuf:"varint,1,opt,name=FromHeight,proto3" json:"FromHeight,omitempty"`
+	// (optional) the address the standby node re-serves decisions at
+	RelayAddr string `protobuf:"bytes,2,opt,name=RelayAddr,proto3" json:"RelayAddr,omitempty"`
+	// the max number of standby nodes the relay serves
+	RelayCapacity        uint32   `protobuf:"varint,3,opt,name=RelayCapacity,proto3" json:"RelayCapacity,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *KeyAuthChallengeReply) MarshalToSizedBuffer(dAtA []byte) (int, error) {
-	i := len(dAtA)
-	_ = i
-	var l int
-	_ = l
-	if m.XXX_unrecognized != nil {
-		i -= len(m.XXX_unrecognized)
-		copy(dAtA[i:], m.XXX_unrecognized)
-	}
-	if len(m.HMAC) > 0 {
-		i -= len(m.HMAC)
-		copy(dAtA[i:], m.HMAC)
-		i = encodeVarintGossip(dAtA, i, uint64(len(m.HMAC)))
-		i--
-		dAtA[i] = 0xa
+func (m *ReplicaSubscribe) Reset()         { *m = ReplicaSubscribe{} }
+func (m *ReplicaSubscribe) String() string { return proto.CompactTextString(m) }
+func (*ReplicaSubscribe) ProtoMessage()    {}
+func (*ReplicaSubscribe) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{8}
+}
+func (m *ReplicaSubscribe) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ReplicaSubscribe) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ReplicaSubscribe.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
 	}
-	return len(dAtA) - i, nil
+}
+func (m *ReplicaSubscribe) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReplicaSubscribe.Merge(m, src)
+}
+func (m *ReplicaSubscribe) XXX_Size() int {
+	return m.Size()
+}
+func (m *ReplicaSubscribe) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReplicaSubscribe.DiscardUnknown(m)
 }
 
-func encodeVarintGossip(dAtA []byte, offset int, v uint64) int {
-	offset -= sovGossip(v)
-	base := offset
-	for v >= 1<<7 {
-		dAtA[offset] = uint8(v&0x7f | 0x80)
-		v >>= 7
-		offset++
+var xxx_messageInfo_ReplicaSubscribe proto.InternalMessageInfo
+
+func (m *ReplicaSubscribe) GetFromHeight() uint64 {
+	if m != nil {
+		return m.FromHeight
 	}
-	dAtA[offset] = uint8(v)
-	return base
+	return 0
 }
-func (m *Gossip) Size() (n int) {
-	if m == nil {
-		return 0
-	}
-	var l int
-	_ = l
-	if m.Command != 0 {
-		n += 1 + sovGossip(uint64(m.Command))
-	}
-	l = len(m.Message)
-	if l > 0 {
-		n += 1 + l + sovGossip(uint64(l))
-	}
-	if m.XXX_unrecognized != nil {
-		n += len(m.XXX_unrecognized)
+
+func (m *ReplicaSubscribe) GetRelayAddr() string {
+	if m != nil {
+		return m.RelayAddr
 	}
-	return n
+	return ""
 }
 
-func (m *KeyAuthInit) Size() (n int) {
-	if m == nil {
-		return 0
-	}
-	var l int
-	_ = l
-	l = len(m.X)
-	if l > 0 {
-		n += 1 + l + sovGossip(uint64(l))
-	}
-	l = len(m.Y)
-	if l > 0 {
-		n += 1 + l + sovGossip(uint64(l))
+func (m *ReplicaSubscribe) GetRelayCapacity() uint32 {
+	if m != nil {
+		return m.RelayCapacity
 	}
-	if m.XXX_unrecognized != nil {
-		n += len(m.XXX_unrecognized)
+	return 0
+}
+
+// ReplicaRelay is a standby node re-serving decisions to other standby nodes
+type ReplicaRelay struct {
+	Addr string `protobuf:"bytes,1,opt,name=Addr,proto3" json:"Addr,omitempty"`
+	// the relay is sampled with probability proportional to the weight
+	Weight               uint32   `protobuf:"varint,2,opt,name=Weight,proto3" json:"Weight,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReplicaRelay) Reset()         { *m = ReplicaRelay{} }
+func (m *ReplicaRelay) String() string { return proto.CompactTextString(m) }
+func (*ReplicaRelay) ProtoMessage()    {}
+func (*ReplicaRelay) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{9}
+}
+func (m *ReplicaRelay) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ReplicaRelay) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ReplicaRelay.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
 	}
-	return n
+}
+func (m *ReplicaRelay) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReplicaRelay.Merge(m, src)
+}
+func (m *ReplicaRelay) XXX_Size() int {
+	return m.Size()
+}
+func (m *ReplicaRelay) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReplicaRelay.DiscardUnknown(m)
 }
 
-func (m *KeyAuthChallenge) Size() (n int) {
-	if m == nil {
-		return 0
+var xxx_messageInfo_ReplicaRelay proto.InternalMessageInfo
+
+func (m *ReplicaRelay) GetAddr() string {
+	if m != nil {
+		return m.Addr
 	}
-	var l int
-	_ = l
-	l = len(m.X)
-	if l > 0 {
-		n += 1 + l + sovGossip(uint64(l))
+	return ""
+}
+
+func (m *ReplicaRelay) GetWeight() uint32 {
+	if m != nil {
+		return m.Weight
 	}
-	l = len(m.Y)
-	if l > 0 {
-		n += 1 + l + sovGossip(uint64(l))
+	return 0
+}
+
+// ReplicaRedirect is sent instead of decisions to a standby node the primary
+// has no capacity for, to subscribe to one of the relays.
+type ReplicaRedirect struct {
+	Relays               []*ReplicaRelay `protobuf:"bytes,1,rep,name=Relays,proto3" json:"Relays,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *ReplicaRedirect) Reset()         { *m = ReplicaRedirect{} }
+func (m *ReplicaRedirect) String() string { return proto.CompactTextString(m) }
+func (*ReplicaRedirect) ProtoMessage()    {}
+func (*ReplicaRedirect) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{10}
+}
+func (m *ReplicaRedirect) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ReplicaRedirect) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ReplicaRedirect.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
 	}
-	l = len(m.Challenge)
-	if l > 0 {
-		n += 1 + l + sovGossip(uint64(l))
+}
+func (m *ReplicaRedirect) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReplicaRedirect.Merge(m, src)
+}
+func (m *ReplicaRedirect) XXX_Size() int {
+	return m.Size()
+}
+func (m *ReplicaRedirect) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReplicaRedirect.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReplicaRedirect proto.InternalMessageInfo
+
+func (m *ReplicaRedirect) GetRelays() []*ReplicaRelay {
+	if m != nil {
+		return m.Relays
 	}
-	if m.XXX_unrecognized != nil {
-		n += len(m.XXX_unrecognized)
+	return nil
+}
+
+// LatencyPing is sent to measure the round trip time to a peer
+type LatencyPing struct {
+	// echoed back in LATENCY_PONG to match the ping
+	Nonce                uint64   `protobuf:"varint,1,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LatencyPing) Reset()         { *m = LatencyPing{} }
+func (m *LatencyPing) String() string { return proto.CompactTextString(m) }
+func (*LatencyPing) ProtoMessage()    {}
+func (*LatencyPing) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{11}
+}
+func (m *LatencyPing) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *LatencyPing) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_LatencyPing.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
 	}
-	return n
+}
+func (m *LatencyPing) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LatencyPing.Merge(m, src)
+}
+func (m *LatencyPing) XXX_Size() int {
+	return m.Size()
+}
+func (m *LatencyPing) XXX_DiscardUnknown() {
+	xxx_messageInfo_LatencyPing.DiscardUnknown(m)
 }
 
-func (m *KeyAuthChallengeReply) Size() (n int) {
-	if m == nil {
-		return 0
+var xxx_messageInfo_LatencyPing proto.InternalMessageInfo
+
+func (m *LatencyPing) GetNonce() uint64 {
+	if m != nil {
+		return m.Nonce
 	}
-	var l int
-	_ = l
-	l = len(m.HMAC)
+	return 0
+}
+
+// PeerLatency is the round trip time to a peer
+type PeerLatency struct {
+	// the identity of the peer
+	Identity []byte `protobuf:"bytes,1,opt,name=Identity,proto3" json:"Identity,omitempty"`
+	// the smoothed round trip time in nanoseconds
+	RTT                  int64    `protobuf:"varint,2,opt,name=RTT,proto3" json:"RTT,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PeerLatency) Reset()         { *m = PeerLatency{} }
+func (m *PeerLatency) String() string { return proto.CompactTextString(m) }
+func (*PeerLatency) ProtoMessage()    {}
+func (*PeerLatency) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{12}
+}
+func (m *PeerLatency) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *PeerLatency) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_PeerLatency.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *PeerLatency) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerLatency.Merge(m, src)
+}
+func (m *PeerLatency) XXX_Size() int {
+	return m.Size()
+}
+func (m *PeerLatency) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerLatency.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerLatency proto.InternalMessageInfo
+
+func (m *PeerLatency) GetIdentity() []byte {
+	if m != nil {
+		return m.Identity
+	}
+	return nil
+}
+
+func (m *PeerLatency) GetRTT() int64 {
+	if m != nil {
+		return m.RTT
+	}
+	return 0
+}
+
+// LatencyStatus advertises the round trip times of the sender
+type LatencyStatus struct {
+	// the round trip times measured by the sender to it's peers
+	Peers                []*PeerLatency `protobuf:"bytes,1,rep,name=Peers,proto3" json:"Peers,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *LatencyStatus) Reset()         { *m = LatencyStatus{} }
+func (m *LatencyStatus) String() string { return proto.CompactTextString(m) }
+func (*LatencyStatus) ProtoMessage()    {}
+func (*LatencyStatus) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{13}
+}
+func (m *LatencyStatus) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *LatencyStatus) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_LatencyStatus.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *LatencyStatus) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LatencyStatus.Merge(m, src)
+}
+func (m *LatencyStatus) XXX_Size() int {
+	return m.Size()
+}
+func (m *LatencyStatus) XXX_DiscardUnknown() {
+	xxx_messageInfo_LatencyStatus.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LatencyStatus proto.InternalMessageInfo
+
+func (m *LatencyStatus) GetPeers() []*PeerLatency {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+// MaintenanceWindow announces the planned downtime of the sender, in unix
+// nanoseconds, an empty window cancels it.
+type MaintenanceWindow struct {
+	Start                int64    `protobuf:"varint,1,opt,name=Start,proto3" json:"Start,omitempty"`
+	End                  int64    `protobuf:"varint,2,opt,name=End,proto3" json:"End,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MaintenanceWindow) Reset()         { *m = MaintenanceWindow{} }
+func (m *MaintenanceWindow) String() string { return proto.CompactTextString(m) }
+func (*MaintenanceWindow) ProtoMessage()    {}
+func (*MaintenanceWindow) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{14}
+}
+func (m *MaintenanceWindow) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *MaintenanceWindow) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_MaintenanceWindow.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *MaintenanceWindow) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MaintenanceWindow.Merge(m, src)
+}
+func (m *MaintenanceWindow) XXX_Size() int {
+	return m.Size()
+}
+func (m *MaintenanceWindow) XXX_DiscardUnknown() {
+	xxx_messageInfo_MaintenanceWindow.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MaintenanceWindow proto.InternalMessageInfo
+
+func (m *MaintenanceWindow) GetStart() int64 {
+	if m != nil {
+		return m.Start
+	}
+	return 0
+}
+
+func (m *MaintenanceWindow) GetEnd() int64 {
+	if m != nil {
+		return m.End
+	}
+	return 0
+}
+
+// ObservedAddr is the address a connection comes from as seen by the
+// sender, for the peer to discover it's public address behind NAT
+type ObservedAddr struct {
+	Addr                 string   `protobuf:"bytes,1,opt,name=Addr,proto3" json:"Addr,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ObservedAddr) Reset()         { *m = ObservedAddr{} }
+func (m *ObservedAddr) String() string { return proto.CompactTextString(m) }
+func (*ObservedAddr) ProtoMessage()    {}
+func (*ObservedAddr) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{15}
+}
+func (m *ObservedAddr) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ObservedAddr) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ObservedAddr.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ObservedAddr) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ObservedAddr.Merge(m, src)
+}
+func (m *ObservedAddr) XXX_Size() int {
+	return m.Size()
+}
+func (m *ObservedAddr) XXX_DiscardUnknown() {
+	xxx_messageInfo_ObservedAddr.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ObservedAddr proto.InternalMessageInfo
+
+func (m *ObservedAddr) GetAddr() string {
+	if m != nil {
+		return m.Addr
+	}
+	return ""
+}
+
+// PunchRequest asks a rendezvous peer to coordinate a hole punch to target
+type PunchRequest struct {
+	// the identity of the peer to punch to
+	Target []byte `protobuf:"bytes,1,opt,name=Target,proto3" json:"Target,omitempty"`
+	// echoed back in PUNCH
+	Nonce                uint64   `protobuf:"varint,2,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PunchRequest) Reset()         { *m = PunchRequest{} }
+func (m *PunchRequest) String() string { return proto.CompactTextString(m) }
+func (*PunchRequest) ProtoMessage()    {}
+func (*PunchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{16}
+}
+func (m *PunchRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *PunchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_PunchRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *PunchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PunchRequest.Merge(m, src)
+}
+func (m *PunchRequest) XXX_Size() int {
+	return m.Size()
+}
+func (m *PunchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PunchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PunchRequest proto.InternalMessageInfo
+
+func (m *PunchRequest) GetTarget() []byte {
+	if m != nil {
+		return m.Target
+	}
+	return nil
+}
+
+func (m *PunchRequest) GetNonce() uint64 {
+	if m != nil {
+		return m.Nonce
+	}
+	return 0
+}
+
+// Punch is sent by the rendezvous to both sides of a hole punch, to dial
+// each other simultaneously
+type Punch struct {
+	// the identity of the other side, empty if it's not connected to the
+	// rendezvous
+	Identity []byte `protobuf:"bytes,1,opt,name=Identity,proto3" json:"Identity,omitempty"`
+	// the address of the other side as seen by the rendezvous
+	Addr                 string   `protobuf:"bytes,2,opt,name=Addr,proto3" json:"Addr,omitempty"`
+	Nonce                uint64   `protobuf:"varint,3,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Punch) Reset()         { *m = Punch{} }
+func (m *Punch) String() string { return proto.CompactTextString(m) }
+func (*Punch) ProtoMessage()    {}
+func (*Punch) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{17}
+}
+func (m *Punch) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *Punch) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_Punch.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *Punch) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Punch.Merge(m, src)
+}
+func (m *Punch) XXX_Size() int {
+	return m.Size()
+}
+func (m *Punch) XXX_DiscardUnknown() {
+	xxx_messageInfo_Punch.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Punch proto.InternalMessageInfo
+
+func (m *Punch) GetIdentity() []byte {
+	if m != nil {
+		return m.Identity
+	}
+	return nil
+}
+
+func (m *Punch) GetAddr() string {
+	if m != nil {
+		return m.Addr
+	}
+	return ""
+}
+
+func (m *Punch) GetNonce() uint64 {
+	if m != nil {
+		return m.Nonce
+	}
+	return 0
+}
+
+// ControlHello opens a control channel, it's sent by both the operator and
+// the node
+type ControlHello struct {
+	// the static key of the sender
+	X []byte `protobuf:"bytes,1,opt,name=X,proto3" json:"X,omitempty"`
+	Y []byte `protobuf:"bytes,2,opt,name=Y,proto3" json:"Y,omitempty"`
+	// the ephemeral key of the channel, the session keys are derived from
+	// the ECDH secret of the ephemeral keys of both sides
+	EphemeralX           []byte   `protobuf:"bytes,3,opt,name=EphemeralX,proto3" json:"EphemeralX,omitempty"`
+	EphemeralY           []byte   `protobuf:"bytes,4,opt,name=EphemeralY,proto3" json:"EphemeralY,omitempty"`
+	Nonce                []byte   `protobuf:"bytes,5,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ControlHello) Reset()         { *m = ControlHello{} }
+func (m *ControlHello) String() string { return proto.CompactTextString(m) }
+func (*ControlHello) ProtoMessage()    {}
+func (*ControlHello) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{18}
+}
+func (m *ControlHello) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ControlHello) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ControlHello.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ControlHello) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ControlHello.Merge(m, src)
+}
+func (m *ControlHello) XXX_Size() int {
+	return m.Size()
+}
+func (m *ControlHello) XXX_DiscardUnknown() {
+	xxx_messageInfo_ControlHello.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ControlHello proto.InternalMessageInfo
+
+func (m *ControlHello) GetX() []byte {
+	if m != nil {
+		return m.X
+	}
+	return nil
+}
+
+func (m *ControlHello) GetY() []byte {
+	if m != nil {
+		return m.Y
+	}
+	return nil
+}
+
+func (m *ControlHello) GetEphemeralX() []byte {
+	if m != nil {
+		return m.EphemeralX
+	}
+	return nil
+}
+
+func (m *ControlHello) GetEphemeralY() []byte {
+	if m != nil {
+		return m.EphemeralY
+	}
+	return nil
+}
+
+func (m *ControlHello) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
+// ControlAuth proves the static key of the sender, it's sealed by the
+// session key
+type ControlAuth struct {
+	// signature of the transcript of the hellos
+	R                    []byte   `protobuf:"bytes,1,opt,name=R,proto3" json:"R,omitempty"`
+	S                    []byte   `protobuf:"bytes,2,opt,name=S,proto3" json:"S,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ControlAuth) Reset()         { *m = ControlAuth{} }
+func (m *ControlAuth) String() string { return proto.CompactTextString(m) }
+func (*ControlAuth) ProtoMessage()    {}
+func (*ControlAuth) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{19}
+}
+func (m *ControlAuth) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ControlAuth) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ControlAuth.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ControlAuth) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ControlAuth.Merge(m, src)
+}
+func (m *ControlAuth) XXX_Size() int {
+	return m.Size()
+}
+func (m *ControlAuth) XXX_DiscardUnknown() {
+	xxx_messageInfo_ControlAuth.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ControlAuth proto.InternalMessageInfo
+
+func (m *ControlAuth) GetR() []byte {
+	if m != nil {
+		return m.R
+	}
+	return nil
+}
+
+func (m *ControlAuth) GetS() []byte {
+	if m != nil {
+		return m.S
+	}
+	return nil
+}
+
+// ControlMessage is an HTTP/1.1 request to the admin API, or the response
+type ControlMessage struct {
+	HTTP                 []byte   `protobuf:"bytes,1,opt,name=HTTP,proto3" json:"HTTP,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ControlMessage) Reset()         { *m = ControlMessage{} }
+func (m *ControlMessage) String() string { return proto.CompactTextString(m) }
+func (*ControlMessage) ProtoMessage()    {}
+func (*ControlMessage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{20}
+}
+func (m *ControlMessage) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ControlMessage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ControlMessage.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ControlMessage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ControlMessage.Merge(m, src)
+}
+func (m *ControlMessage) XXX_Size() int {
+	return m.Size()
+}
+func (m *ControlMessage) XXX_DiscardUnknown() {
+	xxx_messageInfo_ControlMessage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ControlMessage proto.InternalMessageInfo
+
+func (m *ControlMessage) GetHTTP() []byte {
+	if m != nil {
+		return m.HTTP
+	}
+	return nil
+}
+
+// SyncRequest requests the decisions of the heights missed by a lagging
+// node, the <decide> messages are sent back one by one in SYNC_DECISION
+type SyncRequest struct {
+	// the first height to send decisions from
+	FromHeight uint64 `protobuf:"varint,1,opt,name=FromHeight,proto3" json:"FromHeight,omitempty"`
+	// the max number of decisions to send
+	Limit                uint32   `protobuf:"varint,2,opt,name=Limit,proto3" json:"Limit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SyncRequest) Reset()         { *m = SyncRequest{} }
+func (m *SyncRequest) String() string { return proto.CompactTextString(m) }
+func (*SyncRequest) ProtoMessage()    {}
+func (*SyncRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_878fa4887b90140c, []int{21}
+}
+func (m *SyncRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *SyncRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_SyncRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *SyncRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SyncRequest.Merge(m, src)
+}
+func (m *SyncRequest) XXX_Size() int {
+	return m.Size()
+}
+func (m *SyncRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SyncRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SyncRequest proto.InternalMessageInfo
+
+func (m *SyncRequest) GetFromHeight() uint64 {
+	if m != nil {
+		return m.FromHeight
+	}
+	return 0
+}
+
+func (m *SyncRequest) GetLimit() uint32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterEnum("agent.CommandType", CommandType_name, CommandType_value)
+	proto.RegisterEnum("agent.CompressionType", CompressionType_name, CompressionType_value)
+	proto.RegisterType((*Gossip)(nil), "agent.Gossip")
+	proto.RegisterType((*KeyAuthInit)(nil), "agent.KeyAuthInit")
+	proto.RegisterType((*KeyLinkage)(nil), "agent.KeyLinkage")
+	proto.RegisterType((*KeyAuthChallenge)(nil), "agent.KeyAuthChallenge")
+	proto.RegisterType((*KeyAuthChallengeReply)(nil), "agent.KeyAuthChallengeReply")
+	proto.RegisterType((*KeyAuthConfirm)(nil), "agent.KeyAuthConfirm")
+	proto.RegisterType((*Hello)(nil), "agent.Hello")
+	proto.RegisterType((*SessionRekey)(nil), "agent.SessionRekey")
+	proto.RegisterType((*ReplicaSubscribe)(nil), "agent.ReplicaSubscribe")
+	proto.RegisterType((*ReplicaRelay)(nil), "agent.ReplicaRelay")
+	proto.RegisterType((*ReplicaRedirect)(nil), "agent.ReplicaRedirect")
+	proto.RegisterType((*LatencyPing)(nil), "agent.LatencyPing")
+	proto.RegisterType((*PeerLatency)(nil), "agent.PeerLatency")
+	proto.RegisterType((*LatencyStatus)(nil), "agent.LatencyStatus")
+	proto.RegisterType((*MaintenanceWindow)(nil), "agent.MaintenanceWindow")
+	proto.RegisterType((*ObservedAddr)(nil), "agent.ObservedAddr")
+	proto.RegisterType((*PunchRequest)(nil), "agent.PunchRequest")
+	proto.RegisterType((*Punch)(nil), "agent.Punch")
+	proto.RegisterType((*ControlHello)(nil), "agent.ControlHello")
+	proto.RegisterType((*ControlAuth)(nil), "agent.ControlAuth")
+	proto.RegisterType((*ControlMessage)(nil), "agent.ControlMessage")
+	proto.RegisterType((*SyncRequest)(nil), "agent.SyncRequest")
+}
+
+func init() { proto.RegisterFile("gossip.proto", fileDescriptor_878fa4887b90140c) }
+
+var fileDescriptor_878fa4887b90140c = []byte{
+	// 1165 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x56, 0xcd, 0x6e, 0xdb, 0x46,
+	0x10, 0x0e, 0x45, 0xfd, 0x58, 0x23, 0xca, 0x5e, 0x6f, 0x1c, 0x97, 0x28, 0x02, 0x43, 0x60, 0x73,
+	0x50, 0x93, 0x22, 0x40, 0xd3, 0x4b, 0x9b, 0x14, 0x05, 0x68, 0x6a, 0x63, 0x09, 0x96, 0x28, 0x76,
+	0x49, 0x27, 0x51, 0x81, 0x42, 0xa0, 0xa5, 0x8d, 0x4c, 0x44, 0x22, 0x55, 0x92, 0x4a, 0xa1, 0x5b,
+	0x9f, 0xa3, 0xe7, 0x3e, 0x4c, 0x8f, 0x3d, 0xf7, 0x54, 0xe4, 0x29, 0x7a, 0x2c, 0x76, 0xb9, 0xa4,
+	0xa8, 0xd4, 0x70, 0x6e, 0x9a, 0x6f, 0xfe, 0xbe, 0xf9, 0x76, 0x87, 0x2b, 0xd0, 0x16, 0x51, 0x92,
+	0x04, 0xeb, 0xa7, 0xeb, 0x38, 0x4a, 0x23, 0x5c, 0xf3, 0x17, 0x2c, 0x4c, 0x8d, 0x3f, 0x14, 0xa8,
+	0x5f, 0x08, 0x1c, 0x7f, 0x05, 0x0d, 0x2b, 0x5a, 0xad, 0xfc, 0x70, 0xae, 0x2b, 0x1d, 0xa5, 0x7b,
+	0xf8, 0x0c, 0x3f, 0x15, 0x31, 0x4f, 0x25, 0xea, 0x6d, 0xd7, 0x8c, 0xe6, 0x21, 0x58, 0x87, 0xc6,
+	0x88, 0x25, 0x89, 0xbf, 0x60, 0x7a, 0xa5, 0xa3, 0x74, 0x35, 0x9a, 0x9b, 0xf8, 0x5b, 0x68, 0x59,
+	0xd1, 0x6a, 0x1d, 0xb3, 0x24, 0x09, 0xa2, 0x50, 0x57, 0x45, 0xad, 0xd3, 0x5d, 0xad, 0xdc, 0x23,
+	0xea, 0x95, 0x43, 0x79, 0x4d, 0xc7, 0x9f, 0xcf, 0x83, 0x70, 0xa1, 0x57, 0xb3, 0x9a, 0xd2, 0x34,
+	0xfe, 0x55, 0xa0, 0x75, 0xc9, 0xb6, 0xe6, 0x26, 0xbd, 0x19, 0x84, 0x41, 0x8a, 0x35, 0x50, 0xde,
+	0x08, 0x96, 0x1a, 0x55, 0xde, 0x70, 0x6b, 0x22, 0x59, 0x28, 0x13, 0xfc, 0x04, 0x1a, 0xc3, 0x20,
+	0x7c, 0xc7, 0x99, 0xf1, 0xde, 0xad, 0x67, 0xc7, 0xb2, 0xf7, 0x25, 0xdb, 0x4a, 0x07, 0xcd, 0x23,
+	0xf0, 0x73, 0xd0, 0x4a, 0x0c, 0x12, 0xbd, 0xda, 0x51, 0xef, 0x60, 0xbb, 0x17, 0x8b, 0x4f, 0xa0,
+	0x66, 0x47, 0xe1, 0x8c, 0xe9, 0x35, 0xd1, 0x3a, 0x33, 0xf0, 0x43, 0x68, 0x7a, 0xc1, 0x8a, 0x25,
+	0xa9, 0xbf, 0x5a, 0xeb, 0xf5, 0x8e, 0xd2, 0x55, 0xe9, 0x0e, 0xc0, 0x9f, 0xc3, 0xc1, 0x4b, 0xe6,
+	0xa7, 0x9b, 0x98, 0x25, 0x7a, 0xa3, 0xa3, 0x76, 0x9b, 0xb4, 0xb0, 0x79, 0x3d, 0x6b, 0x13, 0xbf,
+	0x67, 0xfa, 0x41, 0x47, 0xe9, 0x36, 0x69, 0x66, 0x18, 0xbf, 0x2b, 0x00, 0x3b, 0xe6, 0x77, 0x4e,
+	0xae, 0x81, 0x42, 0xc5, 0xcc, 0x1a, 0x55, 0x28, 0xb7, 0x5c, 0xa9, 0xa3, 0xe2, 0xf2, 0xc6, 0x2e,
+	0xfb, 0x65, 0xc3, 0x72, 0xbe, 0x55, 0x5a, 0xd8, 0x9c, 0xb2, 0x1d, 0xa5, 0xe7, 0xec, 0x6d, 0x14,
+	0xb3, 0x9c, 0x72, 0x01, 0xf0, 0x4c, 0x3b, 0x4a, 0xcd, 0xb7, 0x29, 0x8b, 0xf5, 0x86, 0x70, 0x16,
+	0xb6, 0x71, 0x0d, 0x48, 0x1e, 0x8b, 0x75, 0xe3, 0x2f, 0x97, 0x2c, 0xfc, 0x04, 0xc3, 0x87, 0xd0,
+	0x2c, 0x02, 0x25, 0xd3, 0x1d, 0xb0, 0x13, 0xb4, 0x5a, 0x12, 0xd4, 0xb8, 0x80, 0x07, 0x1f, 0xf7,
+	0xa0, 0x6c, 0xbd, 0xdc, 0x62, 0x0c, 0xd5, 0xfe, 0xc8, 0xb4, 0x64, 0x2f, 0xf1, 0x3b, 0x93, 0xa0,
+	0xb2, 0x27, 0x81, 0x14, 0xc4, 0x35, 0x1e, 0xc1, 0x61, 0x5e, 0x28, 0x0a, 0xdf, 0x06, 0xf1, 0xea,
+	0xb6, 0x0a, 0xc6, 0xcf, 0x50, 0xeb, 0xb3, 0xe5, 0x32, 0xe2, 0xb7, 0xf1, 0x15, 0x8b, 0xc5, 0x1d,
+	0xe6, 0xfe, 0x36, 0xcd, 0x4d, 0x7c, 0x06, 0x30, 0x0a, 0xc2, 0xdc, 0x59, 0x11, 0xce, 0x12, 0xb2,
+	0x77, 0xc8, 0xea, 0xfe, 0x21, 0x1b, 0x8f, 0x41, 0x73, 0xb3, 0x0b, 0x44, 0xd9, 0x3b, 0xb6, 0xbd,
+	0x4b, 0x2d, 0xe3, 0x3d, 0x20, 0x3e, 0x69, 0x30, 0xf3, 0xdd, 0xcd, 0x75, 0x32, 0x8b, 0x83, 0x6b,
+	0xc6, 0x7b, 0xbf, 0x8c, 0xa3, 0x55, 0x9f, 0x05, 0x8b, 0x9b, 0x54, 0x24, 0x56, 0x69, 0x09, 0xe1,
+	0x0a, 0x53, 0xb6, 0xf4, 0xb7, 0xe6, 0x7c, 0x1e, 0x8b, 0x4a, 0x4d, 0xba, 0x03, 0xf0, 0x23, 0x68,
+	0x0b, 0xc3, 0xf2, 0xd7, 0xfe, 0x2c, 0x48, 0xb7, 0x42, 0x9c, 0x36, 0xdd, 0x07, 0x8d, 0xe7, 0xa0,
+	0xc9, 0xbe, 0x02, 0xe7, 0x32, 0x89, 0x72, 0x8a, 0x28, 0x27, 0x7e, 0xe3, 0x53, 0xa8, 0xbf, 0xce,
+	0x38, 0x64, 0xf3, 0x4b, 0xcb, 0xf8, 0x01, 0x8e, 0x8a, 0xdc, 0x79, 0x10, 0xb3, 0x59, 0x8a, 0x9f,
+	0x40, 0x5d, 0xd4, 0x49, 0x74, 0xa5, 0xa3, 0x76, 0x5b, 0xcf, 0xee, 0xcb, 0xed, 0x2a, 0xf7, 0xa0,
+	0x32, 0xc4, 0xf8, 0x02, 0x5a, 0x43, 0x3f, 0x65, 0xe1, 0x6c, 0xeb, 0x04, 0xe1, 0x62, 0x77, 0x25,
+	0xb2, 0x49, 0xe5, 0x95, 0x78, 0x01, 0x2d, 0x87, 0xb1, 0x58, 0x06, 0x72, 0xbd, 0x07, 0x73, 0x16,
+	0xa6, 0x7c, 0xa0, 0x4c, 0xca, 0xc2, 0xc6, 0x08, 0x54, 0xea, 0x79, 0x82, 0xa4, 0x4a, 0xf9, 0x4f,
+	0xe3, 0x3b, 0x68, 0xcb, 0x44, 0x37, 0xf5, 0xd3, 0x4d, 0x82, 0xbb, 0x50, 0xe3, 0xd5, 0x72, 0x7a,
+	0xf9, 0x67, 0xaf, 0xd4, 0x81, 0x66, 0x01, 0xc6, 0x0b, 0x38, 0x1e, 0xf9, 0x41, 0x98, 0xb2, 0xd0,
+	0x0f, 0x67, 0xec, 0x75, 0x10, 0xce, 0xa3, 0x5f, 0x39, 0x45, 0x37, 0xf5, 0xe3, 0xec, 0x30, 0x54,
+	0x9a, 0x19, 0xbc, 0x2f, 0x09, 0xe7, 0x79, 0x5f, 0x12, 0xce, 0x0d, 0x03, 0xb4, 0xf1, 0x75, 0xc2,
+	0xe2, 0xf7, 0x6c, 0x2e, 0x14, 0xbc, 0x45, 0x55, 0xe3, 0x7b, 0xd0, 0x9c, 0x4d, 0x38, 0xbb, 0xa1,
+	0x7c, 0x35, 0x93, 0x94, 0xab, 0xec, 0xf9, 0xf1, 0x82, 0xa5, 0x72, 0x2e, 0x69, 0xed, 0x64, 0xa9,
+	0x94, 0x65, 0x19, 0x41, 0x4d, 0x64, 0xdf, 0x29, 0x48, 0xde, 0xb6, 0x52, 0x3a, 0xcc, 0xa2, 0x9c,
+	0x5a, 0x2e, 0xf7, 0x9b, 0xc2, 0x3f, 0x8e, 0x61, 0x1a, 0x47, 0xcb, 0x6c, 0x23, 0xee, 0xda, 0xec,
+	0x33, 0x00, 0xb2, 0xbe, 0x61, 0x2b, 0x16, 0xfb, 0xcb, 0x37, 0x72, 0xe7, 0x4a, 0xc8, 0x9e, 0x7f,
+	0x22, 0x17, 0xbc, 0x84, 0xdc, 0xfe, 0x31, 0x35, 0xbe, 0x84, 0x96, 0x64, 0xc0, 0xd7, 0x36, 0xdb,
+	0x6e, 0x65, 0x6f, 0xbb, 0x2b, 0xa5, 0xed, 0x96, 0xa1, 0xf9, 0x43, 0xc4, 0xb7, 0xdb, 0xf3, 0x9c,
+	0x62, 0xbb, 0x3d, 0xcf, 0x31, 0x2c, 0x68, 0xb9, 0xdb, 0x70, 0x96, 0xeb, 0xfb, 0xa9, 0x6d, 0x3a,
+	0x81, 0xda, 0x30, 0x58, 0x05, 0xf9, 0x25, 0xcf, 0x8c, 0xc7, 0x7f, 0xab, 0xd0, 0x92, 0xef, 0x20,
+	0x7f, 0x16, 0x70, 0x03, 0x54, 0x7b, 0xec, 0xa0, 0x7b, 0xf8, 0x18, 0xda, 0x97, 0x64, 0x32, 0x35,
+	0xaf, 0xbc, 0xfe, 0x74, 0x60, 0x0f, 0x3c, 0xa4, 0xe0, 0x53, 0xc0, 0x05, 0x64, 0xf5, 0xcd, 0xe1,
+	0x90, 0xd8, 0x17, 0x04, 0x55, 0xf0, 0x43, 0xd0, 0xff, 0x8f, 0x4f, 0x29, 0x71, 0x86, 0x13, 0xa4,
+	0xe2, 0x36, 0x34, 0xad, 0xb1, 0xed, 0x12, 0xdb, 0xbd, 0x72, 0x51, 0x15, 0x3f, 0x80, 0x63, 0xee,
+	0x19, 0x58, 0xe6, 0xd4, 0xbd, 0x3a, 0x77, 0x2d, 0x3a, 0x38, 0x27, 0xa8, 0x86, 0x4f, 0x00, 0xe5,
+	0x70, 0x8f, 0x58, 0x03, 0x77, 0x30, 0xb6, 0x51, 0x1d, 0x23, 0xd0, 0x86, 0xa6, 0x47, 0x6c, 0x6b,
+	0x32, 0x75, 0x06, 0xf6, 0x05, 0x6a, 0xec, 0x21, 0x63, 0xfb, 0x02, 0x1d, 0x60, 0x0c, 0x87, 0x39,
+	0xe2, 0x7a, 0xa6, 0x77, 0xe5, 0xa2, 0x26, 0x6e, 0x41, 0x63, 0x48, 0xcc, 0x57, 0x3c, 0x05, 0xf0,
+	0x11, 0xb4, 0x46, 0xe6, 0xc0, 0xf6, 0x88, 0x6d, 0xda, 0x16, 0x41, 0xad, 0x72, 0x2f, 0x4a, 0x7a,
+	0x03, 0x4a, 0x2c, 0x0f, 0x69, 0x1c, 0xdd, 0x4d, 0x31, 0xb6, 0x5f, 0x0e, 0xe8, 0x08, 0xb5, 0x31,
+	0x40, 0xdd, 0x25, 0xe6, 0x90, 0xf4, 0xd0, 0x21, 0x6e, 0x42, 0x8d, 0x92, 0x4b, 0x32, 0x41, 0x47,
+	0x5c, 0x9d, 0xf1, 0xb9, 0x4b, 0xe8, 0x2b, 0xd2, 0x9b, 0x9a, 0xbd, 0x1e, 0x45, 0x88, 0x43, 0xce,
+	0x95, 0x6d, 0xf5, 0xa7, 0x94, 0xfc, 0x78, 0x45, 0x5c, 0x0f, 0x1d, 0xf3, 0x04, 0x01, 0x21, 0xcc,
+	0xbd, 0xd6, 0xd8, 0xf6, 0xe8, 0x78, 0x38, 0xed, 0x93, 0xe1, 0x70, 0x8c, 0xee, 0xf3, 0x51, 0x72,
+	0x88, 0x37, 0x45, 0x27, 0xf8, 0x3e, 0x1c, 0xe5, 0x48, 0x5e, 0xe4, 0x01, 0xe7, 0xb5, 0x03, 0x5d,
+	0x87, 0x4b, 0x89, 0x4e, 0x79, 0xb2, 0x3b, 0xb1, 0xad, 0x22, 0xee, 0x33, 0xde, 0x41, 0x20, 0x85,
+	0x7c, 0xfa, 0xe3, 0xaf, 0xe1, 0xe8, 0xa3, 0x67, 0x1f, 0x1f, 0x40, 0xd5, 0x1e, 0xdb, 0x04, 0xdd,
+	0x13, 0x93, 0xd9, 0xa6, 0xe3, 0x4c, 0x90, 0xc2, 0xd1, 0x9f, 0x5c, 0xaf, 0x87, 0x2a, 0xe7, 0xda,
+	0x9f, 0x1f, 0xce, 0x94, 0xbf, 0x3e, 0x9c, 0x29, 0xff, 0x7c, 0x38, 0x53, 0xae, 0xeb, 0xe2, 0x0f,
+	0xd6, 0x37, 0xff, 0x0d, 0x00, 0x57, 0xcb, 0x6e, 0x5c, 0x70, 0x09, 0x00, 0x00,
+}
+
+func (m *Gossip) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Gossip) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *Gossip) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Padding) > 0 {
+		i -= len(m.Padding)
+		copy(dAtA[i:], m.Padding)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Padding)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if m.Compression != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Compression))
+		i--
+		dAtA[i] = 0x18
+	}
+	if len(m.Message) > 0 {
+		i -= len(m.Message)
+		copy(dAtA[i:], m.Message)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Message)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if m.Command != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Command))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *KeyAuthInit) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *KeyAuthInit) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *KeyAuthInit) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Curve) > 0 {
+		i -= len(m.Curve)
+		copy(dAtA[i:], m.Curve)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Curve)))
+		i--
+		dAtA[i] = 0x42
+	}
+	if len(m.Features) > 0 {
+		for iNdEx := len(m.Features) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Features[iNdEx])
+			copy(dAtA[i:], m.Features[iNdEx])
+			i = encodeVarintGossip(dAtA, i, uint64(len(m.Features[iNdEx])))
+			i--
+			dAtA[i] = 0x3a
+		}
+	}
+	if m.Timestamp != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Timestamp))
+		i--
+		dAtA[i] = 0x30
+	}
+	if len(m.Nonce) > 0 {
+		i -= len(m.Nonce)
+		copy(dAtA[i:], m.Nonce)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Nonce)))
+		i--
+		dAtA[i] = 0x2a
+	}
+	if len(m.Compressions) > 0 {
+		dAtA2 := make([]byte, len(m.Compressions)*10)
+		var j1 int
+		for _, num := range m.Compressions {
+			for num >= 1<<7 {
+				dAtA2[j1] = uint8(uint64(num)&0x7f | 0x80)
+				num >>= 7
+				j1++
+			}
+			dAtA2[j1] = uint8(num)
+			j1++
+		}
+		i -= j1
+		copy(dAtA[i:], dAtA2[:j1])
+		i = encodeVarintGossip(dAtA, i, uint64(j1))
+		i--
+		dAtA[i] = 0x22
+	}
+	if m.Linkage != nil {
+		{
+			size, err := m.Linkage.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintGossip(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.Y) > 0 {
+		i -= len(m.Y)
+		copy(dAtA[i:], m.Y)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Y)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.X) > 0 {
+		i -= len(m.X)
+		copy(dAtA[i:], m.X)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.X)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *KeyLinkage) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *KeyLinkage) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *KeyLinkage) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.NotAfter != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.NotAfter))
+		i--
+		dAtA[i] = 0x38
+	}
+	if m.NotBefore != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.NotBefore))
+		i--
+		dAtA[i] = 0x30
+	}
+	if m.Sequence != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Sequence))
+		i--
+		dAtA[i] = 0x28
+	}
+	if len(m.S) > 0 {
+		i -= len(m.S)
+		copy(dAtA[i:], m.S)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.S)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.R) > 0 {
+		i -= len(m.R)
+		copy(dAtA[i:], m.R)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.R)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.Y) > 0 {
+		i -= len(m.Y)
+		copy(dAtA[i:], m.Y)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Y)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.X) > 0 {
+		i -= len(m.X)
+		copy(dAtA[i:], m.X)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.X)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *KeyAuthChallenge) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *KeyAuthChallenge) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *KeyAuthChallenge) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Nonce) > 0 {
+		i -= len(m.Nonce)
+		copy(dAtA[i:], m.Nonce)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Nonce)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.Challenge) > 0 {
+		i -= len(m.Challenge)
+		copy(dAtA[i:], m.Challenge)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Challenge)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.Y) > 0 {
+		i -= len(m.Y)
+		copy(dAtA[i:], m.Y)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Y)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.X) > 0 {
+		i -= len(m.X)
+		copy(dAtA[i:], m.X)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.X)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *KeyAuthChallengeReply) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *KeyAuthChallengeReply) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *KeyAuthChallengeReply) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.S) > 0 {
+		i -= len(m.S)
+		copy(dAtA[i:], m.S)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.S)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.R) > 0 {
+		i -= len(m.R)
+		copy(dAtA[i:], m.R)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.R)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.HMAC) > 0 {
+		i -= len(m.HMAC)
+		copy(dAtA[i:], m.HMAC)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.HMAC)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *KeyAuthConfirm) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *KeyAuthConfirm) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *KeyAuthConfirm) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.HMAC) > 0 {
+		i -= len(m.HMAC)
+		copy(dAtA[i:], m.HMAC)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.HMAC)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *Hello) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Hello) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *Hello) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Features) > 0 {
+		for iNdEx := len(m.Features) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Features[iNdEx])
+			copy(dAtA[i:], m.Features[iNdEx])
+			i = encodeVarintGossip(dAtA, i, uint64(len(m.Features[iNdEx])))
+			i--
+			dAtA[i] = 0x1a
+		}
+	}
+	if m.MinVersion != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.MinVersion))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.Version != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Version))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *SessionRekey) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *SessionRekey) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *SessionRekey) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Y) > 0 {
+		i -= len(m.Y)
+		copy(dAtA[i:], m.Y)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Y)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.X) > 0 {
+		i -= len(m.X)
+		copy(dAtA[i:], m.X)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.X)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ReplicaSubscribe) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ReplicaSubscribe) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ReplicaSubscribe) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.RelayCapacity != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.RelayCapacity))
+		i--
+		dAtA[i] = 0x18
+	}
+	if len(m.RelayAddr) > 0 {
+		i -= len(m.RelayAddr)
+		copy(dAtA[i:], m.RelayAddr)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.RelayAddr)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if m.FromHeight != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.FromHeight))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ReplicaRelay) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ReplicaRelay) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ReplicaRelay) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.Weight != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Weight))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Addr) > 0 {
+		i -= len(m.Addr)
+		copy(dAtA[i:], m.Addr)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Addr)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ReplicaRedirect) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ReplicaRedirect) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ReplicaRedirect) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Relays) > 0 {
+		for iNdEx := len(m.Relays) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Relays[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintGossip(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *LatencyPing) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *LatencyPing) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *LatencyPing) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.Nonce != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Nonce))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *PeerLatency) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *PeerLatency) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *PeerLatency) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.RTT != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.RTT))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Identity) > 0 {
+		i -= len(m.Identity)
+		copy(dAtA[i:], m.Identity)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Identity)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *LatencyStatus) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *LatencyStatus) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *LatencyStatus) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Peers) > 0 {
+		for iNdEx := len(m.Peers) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Peers[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintGossip(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *MaintenanceWindow) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *MaintenanceWindow) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *MaintenanceWindow) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.End != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.End))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.Start != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Start))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ObservedAddr) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ObservedAddr) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ObservedAddr) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Addr) > 0 {
+		i -= len(m.Addr)
+		copy(dAtA[i:], m.Addr)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Addr)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *PunchRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *PunchRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *PunchRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.Nonce != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Nonce))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.Target) > 0 {
+		i -= len(m.Target)
+		copy(dAtA[i:], m.Target)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Target)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *Punch) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *Punch) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *Punch) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.Nonce != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Nonce))
+		i--
+		dAtA[i] = 0x18
+	}
+	if len(m.Addr) > 0 {
+		i -= len(m.Addr)
+		copy(dAtA[i:], m.Addr)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Addr)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.Identity) > 0 {
+		i -= len(m.Identity)
+		copy(dAtA[i:], m.Identity)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Identity)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ControlHello) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ControlHello) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ControlHello) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.Nonce) > 0 {
+		i -= len(m.Nonce)
+		copy(dAtA[i:], m.Nonce)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Nonce)))
+		i--
+		dAtA[i] = 0x2a
+	}
+	if len(m.EphemeralY) > 0 {
+		i -= len(m.EphemeralY)
+		copy(dAtA[i:], m.EphemeralY)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.EphemeralY)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.EphemeralX) > 0 {
+		i -= len(m.EphemeralX)
+		copy(dAtA[i:], m.EphemeralX)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.EphemeralX)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.Y) > 0 {
+		i -= len(m.Y)
+		copy(dAtA[i:], m.Y)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.Y)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.X) > 0 {
+		i -= len(m.X)
+		copy(dAtA[i:], m.X)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.X)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ControlAuth) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ControlAuth) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ControlAuth) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.S) > 0 {
+		i -= len(m.S)
+		copy(dAtA[i:], m.S)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.S)))
+		i--
+		dAtA[i] = 0x12
+	}
+	if len(m.R) > 0 {
+		i -= len(m.R)
+		copy(dAtA[i:], m.R)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.R)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ControlMessage) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ControlMessage) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ControlMessage) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if len(m.HTTP) > 0 {
+		i -= len(m.HTTP)
+		copy(dAtA[i:], m.HTTP)
+		i = encodeVarintGossip(dAtA, i, uint64(len(m.HTTP)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *SyncRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *SyncRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *SyncRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.Limit != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.Limit))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.FromHeight != 0 {
+		i = encodeVarintGossip(dAtA, i, uint64(m.FromHeight))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func encodeVarintGossip(dAtA []byte, offset int, v uint64) int {
+	offset -= sovGossip(v)
+	base := offset
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return base
+}
+func (m *Gossip) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Command != 0 {
+		n += 1 + sovGossip(uint64(m.Command))
+	}
+	l = len(m.Message)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.Compression != 0 {
+		n += 1 + sovGossip(uint64(m.Compression))
+	}
+	l = len(m.Padding)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *KeyAuthInit) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.X)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.Y)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.Linkage != nil {
+		l = m.Linkage.Size()
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if len(m.Compressions) > 0 {
+		l = 0
+		for _, e := range m.Compressions {
+			l += sovGossip(uint64(e))
+		}
+		n += 1 + sovGossip(uint64(l)) + l
+	}
+	l = len(m.Nonce)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.Timestamp != 0 {
+		n += 1 + sovGossip(uint64(m.Timestamp))
+	}
+	if len(m.Features) > 0 {
+		for _, s := range m.Features {
+			l = len(s)
+			n += 1 + l + sovGossip(uint64(l))
+		}
+	}
+	l = len(m.Curve)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *KeyLinkage) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.X)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.Y)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.R)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.S)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.Sequence != 0 {
+		n += 1 + sovGossip(uint64(m.Sequence))
+	}
+	if m.NotBefore != 0 {
+		n += 1 + sovGossip(uint64(m.NotBefore))
+	}
+	if m.NotAfter != 0 {
+		n += 1 + sovGossip(uint64(m.NotAfter))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *KeyAuthChallenge) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.X)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.Y)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.Challenge)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.Nonce)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *KeyAuthChallengeReply) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.HMAC)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.R)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.S)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *KeyAuthConfirm) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.HMAC)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *Hello) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Version != 0 {
+		n += 1 + sovGossip(uint64(m.Version))
+	}
+	if m.MinVersion != 0 {
+		n += 1 + sovGossip(uint64(m.MinVersion))
+	}
+	if len(m.Features) > 0 {
+		for _, s := range m.Features {
+			l = len(s)
+			n += 1 + l + sovGossip(uint64(l))
+		}
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *SessionRekey) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.X)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.Y)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *ReplicaSubscribe) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.FromHeight != 0 {
+		n += 1 + sovGossip(uint64(m.FromHeight))
+	}
+	l = len(m.RelayAddr)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.RelayCapacity != 0 {
+		n += 1 + sovGossip(uint64(m.RelayCapacity))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *ReplicaRelay) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Addr)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.Weight != 0 {
+		n += 1 + sovGossip(uint64(m.Weight))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *ReplicaRedirect) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Relays) > 0 {
+		for _, e := range m.Relays {
+			l = e.Size()
+			n += 1 + l + sovGossip(uint64(l))
+		}
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *LatencyPing) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Nonce != 0 {
+		n += 1 + sovGossip(uint64(m.Nonce))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *PeerLatency) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Identity)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.RTT != 0 {
+		n += 1 + sovGossip(uint64(m.RTT))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *LatencyStatus) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Peers) > 0 {
+		for _, e := range m.Peers {
+			l = e.Size()
+			n += 1 + l + sovGossip(uint64(l))
+		}
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *MaintenanceWindow) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Start != 0 {
+		n += 1 + sovGossip(uint64(m.Start))
+	}
+	if m.End != 0 {
+		n += 1 + sovGossip(uint64(m.End))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *ObservedAddr) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Addr)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *PunchRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Target)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.Nonce != 0 {
+		n += 1 + sovGossip(uint64(m.Nonce))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *Punch) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.Identity)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.Addr)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.Nonce != 0 {
+		n += 1 + sovGossip(uint64(m.Nonce))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *ControlHello) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.X)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.Y)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.EphemeralX)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.EphemeralY)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.Nonce)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *ControlAuth) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.R)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	l = len(m.S)
+	if l > 0 {
+		n += 1 + l + sovGossip(uint64(l))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *ControlMessage) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.HTTP)
 	if l > 0 {
 		n += 1 + l + sovGossip(uint64(l))
 	}
-	if m.XXX_unrecognized != nil {
-		n += len(m.XXX_unrecognized)
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *SyncRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.FromHeight != 0 {
+		n += 1 + sovGossip(uint64(m.FromHeight))
+	}
+	if m.Limit != 0 {
+		n += 1 + sovGossip(uint64(m.Limit))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func sovGossip(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozGossip(x uint64) (n int) {
+	return sovGossip(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *Gossip) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Gossip: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Gossip: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Command", wireType)
+			}
+			m.Command = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Command |= CommandType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Message", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Message = append(m.Message[:0], dAtA[iNdEx:postIndex]...)
+			if m.Message == nil {
+				m.Message = []byte{}
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Compression", wireType)
+			}
+			m.Compression = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Compression |= CompressionType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Padding", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Padding = append(m.Padding[:0], dAtA[iNdEx:postIndex]...)
+			if m.Padding == nil {
+				m.Padding = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *KeyAuthInit) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: KeyAuthInit: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: KeyAuthInit: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field X", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.X = append(m.X[:0], dAtA[iNdEx:postIndex]...)
+			if m.X == nil {
+				m.X = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Y", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Y = append(m.Y[:0], dAtA[iNdEx:postIndex]...)
+			if m.Y == nil {
+				m.Y = []byte{}
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Linkage", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Linkage == nil {
+				m.Linkage = &KeyLinkage{}
+			}
+			if err := m.Linkage.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType == 0 {
+				var v CompressionType
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowGossip
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					v |= CompressionType(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				m.Compressions = append(m.Compressions, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowGossip
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= int(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthGossip
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex < 0 {
+					return ErrInvalidLengthGossip
+				}
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				var elementCount int
+				if elementCount != 0 && len(m.Compressions) == 0 {
+					m.Compressions = make([]CompressionType, 0, elementCount)
+				}
+				for iNdEx < postIndex {
+					var v CompressionType
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowGossip
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						v |= CompressionType(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					m.Compressions = append(m.Compressions, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field Compressions", wireType)
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Nonce", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Nonce = append(m.Nonce[:0], dAtA[iNdEx:postIndex]...)
+			if m.Nonce == nil {
+				m.Nonce = []byte{}
+			}
+			iNdEx = postIndex
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Timestamp", wireType)
+			}
+			m.Timestamp = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Timestamp |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Features", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Features = append(m.Features, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Curve", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Curve = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *KeyLinkage) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: KeyLinkage: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: KeyLinkage: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field X", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.X = append(m.X[:0], dAtA[iNdEx:postIndex]...)
+			if m.X == nil {
+				m.X = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Y", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Y = append(m.Y[:0], dAtA[iNdEx:postIndex]...)
+			if m.Y == nil {
+				m.Y = []byte{}
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field R", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.R = append(m.R[:0], dAtA[iNdEx:postIndex]...)
+			if m.R == nil {
+				m.R = []byte{}
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field S", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.S = append(m.S[:0], dAtA[iNdEx:postIndex]...)
+			if m.S == nil {
+				m.S = []byte{}
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Sequence", wireType)
+			}
+			m.Sequence = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Sequence |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field NotBefore", wireType)
+			}
+			m.NotBefore = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.NotBefore |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field NotAfter", wireType)
+			}
+			m.NotAfter = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.NotAfter |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *KeyAuthChallenge) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: KeyAuthChallenge: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: KeyAuthChallenge: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field X", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.X = append(m.X[:0], dAtA[iNdEx:postIndex]...)
+			if m.X == nil {
+				m.X = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Y", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Y = append(m.Y[:0], dAtA[iNdEx:postIndex]...)
+			if m.Y == nil {
+				m.Y = []byte{}
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Challenge", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Challenge = append(m.Challenge[:0], dAtA[iNdEx:postIndex]...)
+			if m.Challenge == nil {
+				m.Challenge = []byte{}
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Nonce", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Nonce = append(m.Nonce[:0], dAtA[iNdEx:postIndex]...)
+			if m.Nonce == nil {
+				m.Nonce = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *KeyAuthChallengeReply) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: KeyAuthChallengeReply: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: KeyAuthChallengeReply: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field HMAC", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.HMAC = append(m.HMAC[:0], dAtA[iNdEx:postIndex]...)
+			if m.HMAC == nil {
+				m.HMAC = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field R", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.R = append(m.R[:0], dAtA[iNdEx:postIndex]...)
+			if m.R == nil {
+				m.R = []byte{}
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field S", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.S = append(m.S[:0], dAtA[iNdEx:postIndex]...)
+			if m.S == nil {
+				m.S = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *KeyAuthConfirm) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: KeyAuthConfirm: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: KeyAuthConfirm: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field HMAC", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.HMAC = append(m.HMAC[:0], dAtA[iNdEx:postIndex]...)
+			if m.HMAC == nil {
+				m.HMAC = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *Hello) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Hello: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Hello: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			}
+			m.Version = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Version |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MinVersion", wireType)
+			}
+			m.MinVersion = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MinVersion |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Features", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Features = append(m.Features, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *SessionRekey) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: SessionRekey: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: SessionRekey: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field X", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.X = append(m.X[:0], dAtA[iNdEx:postIndex]...)
+			if m.X == nil {
+				m.X = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Y", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Y = append(m.Y[:0], dAtA[iNdEx:postIndex]...)
+			if m.Y == nil {
+				m.Y = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ReplicaSubscribe) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ReplicaSubscribe: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ReplicaSubscribe: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FromHeight", wireType)
+			}
+			m.FromHeight = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.FromHeight |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RelayAddr", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.RelayAddr = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RelayCapacity", wireType)
+			}
+			m.RelayCapacity = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.RelayCapacity |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ReplicaRelay) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ReplicaRelay: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ReplicaRelay: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Addr", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Addr = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Weight", wireType)
+			}
+			m.Weight = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Weight |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ReplicaRedirect) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ReplicaRedirect: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ReplicaRedirect: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Relays", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Relays = append(m.Relays, &ReplicaRelay{})
+			if err := m.Relays[len(m.Relays)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *LatencyPing) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: LatencyPing: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: LatencyPing: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Nonce", wireType)
+			}
+			m.Nonce = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Nonce |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *PeerLatency) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: PeerLatency: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: PeerLatency: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Identity", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Identity = append(m.Identity[:0], dAtA[iNdEx:postIndex]...)
+			if m.Identity == nil {
+				m.Identity = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RTT", wireType)
+			}
+			m.RTT = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.RTT |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *LatencyStatus) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: LatencyStatus: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: LatencyStatus: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Peers", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Peers = append(m.Peers, &PeerLatency{})
+			if err := m.Peers[len(m.Peers)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *MaintenanceWindow) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: MaintenanceWindow: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: MaintenanceWindow: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Start", wireType)
+			}
+			m.Start = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Start |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field End", wireType)
+			}
+			m.End = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.End |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ObservedAddr) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ObservedAddr: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ObservedAddr: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Addr", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Addr = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *PunchRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: PunchRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: PunchRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Target", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Target = append(m.Target[:0], dAtA[iNdEx:postIndex]...)
+			if m.Target == nil {
+				m.Target = []byte{}
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Nonce", wireType)
+			}
+			m.Nonce = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Nonce |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
 	}
-	return n
-}
 
-func sovGossip(x uint64) (n int) {
-	return (math_bits.Len64(x|1) + 6) / 7
-}
-func sozGossip(x uint64) (n int) {
-	return sovGossip(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
 }
-func (m *Gossip) Unmarshal(dAtA []byte) error {
+func (m *Punch) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -594,17 +5512,17 @@ func (m *Gossip) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: Gossip: wiretype end group for non-group")
+			return fmt.Errorf("proto: Punch: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: Gossip: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: Punch: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Command", wireType)
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Identity", wireType)
 			}
-			m.Command = 0
+			var byteLen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowGossip
@@ -614,16 +5532,31 @@ func (m *Gossip) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				m.Command |= CommandType(b&0x7F) << shift
+				byteLen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Identity = append(m.Identity[:0], dAtA[iNdEx:postIndex]...)
+			if m.Identity == nil {
+				m.Identity = []byte{}
+			}
+			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Message", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Addr", wireType)
 			}
-			var byteLen int
+			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowGossip
@@ -633,26 +5566,43 @@ func (m *Gossip) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				byteLen |= int(b&0x7F) << shift
+				stringLen |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if byteLen < 0 {
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
 				return ErrInvalidLengthGossip
 			}
-			postIndex := iNdEx + byteLen
+			postIndex := iNdEx + intStringLen
 			if postIndex < 0 {
 				return ErrInvalidLengthGossip
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Message = append(m.Message[:0], dAtA[iNdEx:postIndex]...)
-			if m.Message == nil {
-				m.Message = []byte{}
-			}
+			m.Addr = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Nonce", wireType)
+			}
+			m.Nonce = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Nonce |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipGossip(dAtA[iNdEx:])
@@ -678,7 +5628,7 @@ func (m *Gossip) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *KeyAuthInit) Unmarshal(dAtA []byte) error {
+func (m *ControlHello) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -701,10 +5651,10 @@ func (m *KeyAuthInit) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: KeyAuthInit: wiretype end group for non-group")
+			return fmt.Errorf("proto: ControlHello: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: KeyAuthInit: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: ControlHello: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
@@ -775,6 +5725,108 @@ func (m *KeyAuthInit) Unmarshal(dAtA []byte) error {
 				m.Y = []byte{}
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EphemeralX", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.EphemeralX = append(m.EphemeralX[:0], dAtA[iNdEx:postIndex]...)
+			if m.EphemeralX == nil {
+				m.EphemeralX = []byte{}
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EphemeralY", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.EphemeralY = append(m.EphemeralY[:0], dAtA[iNdEx:postIndex]...)
+			if m.EphemeralY == nil {
+				m.EphemeralY = []byte{}
+			}
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Nonce", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthGossip
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Nonce = append(m.Nonce[:0], dAtA[iNdEx:postIndex]...)
+			if m.Nonce == nil {
+				m.Nonce = []byte{}
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipGossip(dAtA[iNdEx:])
@@ -800,7 +5852,7 @@ func (m *KeyAuthInit) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *KeyAuthChallenge) Unmarshal(dAtA []byte) error {
+func (m *ControlAuth) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -823,15 +5875,15 @@ func (m *KeyAuthChallenge) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: KeyAuthChallenge: wiretype end group for non-group")
+			return fmt.Errorf("proto: ControlAuth: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: KeyAuthChallenge: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: ControlAuth: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field X", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field R", wireType)
 			}
 			var byteLen int
 			for shift := uint(0); ; shift += 7 {
@@ -858,14 +5910,14 @@ func (m *KeyAuthChallenge) Unmarshal(dAtA []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.X = append(m.X[:0], dAtA[iNdEx:postIndex]...)
-			if m.X == nil {
-				m.X = []byte{}
+			m.R = append(m.R[:0], dAtA[iNdEx:postIndex]...)
+			if m.R == nil {
+				m.R = []byte{}
 			}
 			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Y", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field S", wireType)
 			}
 			var byteLen int
 			for shift := uint(0); ; shift += 7 {
@@ -892,14 +5944,68 @@ func (m *KeyAuthChallenge) Unmarshal(dAtA []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Y = append(m.Y[:0], dAtA[iNdEx:postIndex]...)
-			if m.Y == nil {
-				m.Y = []byte{}
+			m.S = append(m.S[:0], dAtA[iNdEx:postIndex]...)
+			if m.S == nil {
+				m.S = []byte{}
 			}
 			iNdEx = postIndex
-		case 3:
+		default:
+			iNdEx = preIndex
+			skippy, err := skipGossip(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthGossip
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ControlMessage) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowGossip
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ControlMessage: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ControlMessage: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Challenge", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field HTTP", wireType)
 			}
 			var byteLen int
 			for shift := uint(0); ; shift += 7 {
@@ -926,9 +6032,9 @@ func (m *KeyAuthChallenge) Unmarshal(dAtA []byte) error {
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			m.Challenge = append(m.Challenge[:0], dAtA[iNdEx:postIndex]...)
-			if m.Challenge == nil {
-				m.Challenge = []byte{}
+			m.HTTP = append(m.HTTP[:0], dAtA[iNdEx:postIndex]...)
+			if m.HTTP == nil {
+				m.HTTP = []byte{}
 			}
 			iNdEx = postIndex
 		default:
@@ -956,7 +6062,7 @@ func (m *KeyAuthChallenge) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *KeyAuthChallengeReply) Unmarshal(dAtA []byte) error {
+func (m *SyncRequest) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
 	iNdEx := 0
 	for iNdEx < l {
@@ -979,17 +6085,17 @@ func (m *KeyAuthChallengeReply) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: KeyAuthChallengeReply: wiretype end group for non-group")
+			return fmt.Errorf("proto: SyncRequest: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: KeyAuthChallengeReply: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: SyncRequest: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field HMAC", wireType)
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FromHeight", wireType)
 			}
-			var byteLen int
+			m.FromHeight = 0
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowGossip
@@ -999,26 +6105,30 @@ func (m *KeyAuthChallengeReply) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				byteLen |= int(b&0x7F) << shift
+				m.FromHeight |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if byteLen < 0 {
-				return ErrInvalidLengthGossip
-			}
-			postIndex := iNdEx + byteLen
-			if postIndex < 0 {
-				return ErrInvalidLengthGossip
-			}
-			if postIndex > l {
-				return io.ErrUnexpectedEOF
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Limit", wireType)
 			}
-			m.HMAC = append(m.HMAC[:0], dAtA[iNdEx:postIndex]...)
-			if m.HMAC == nil {
-				m.HMAC = []byte{}
+			m.Limit = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowGossip
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Limit |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
 			}
-			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipGossip(dAtA[iNdEx:])
@@ -0,0 +1,225 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/crypto/blake2b"
+)
+
+const (
+	// KeyAuthPrefix is the prefix of the handshake transcript signed by the
+	// responder of a challenge
+	KeyAuthPrefix = "BDLS_KEY_AUTH"
+
+	// MaxHandshakeSkew is the max difference between the timestamp of a
+	// KeyAuthInit and the local clock, the nonces are remembered for as
+	// long to reject replays.
+	MaxHandshakeSkew = 2 * time.Minute
+
+	// nonceSize is the size of the per connection nonces
+	nonceSize = 32
+
+	// maxHeldMessages is the max consensus messages held from a peer
+	// before both sides have authenticated, the others are dropped
+	maxHeldMessages = 128
+)
+
+// newNonce creates a random nonce for a connection
+func newNonce() []byte {
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic(err)
+	}
+	return nonce
+}
+
+// keyAuthTranscript computes the digest the responder of a challenge proves
+// with the HMAC and signs, it binds the reply to both nonces of the
+// connection, the responder's key, curve, timestamp and features announced
+// in KeyAuthInit, so they can't be downgraded, and the challenge:
+// blake2b(KeyAuthPrefix + challengerNonce + responderNonce + responder.X + responder.Y + curve + timestamp + features + ephemeral.X + ephemeral.Y + challenge)
+// where features and the curve are the length prefixed names, the curve is
+// left out if empty, i.e. secp256k1.
+func keyAuthTranscript(challengerNonce []byte, responderNonce []byte, responderKey *ecdsa.PublicKey, curve string, timestamp int64, features []string, ephemeral *ecdsa.PublicKey, challenge []byte) []byte {
+	hash, err := blake2b.New256(nil)
+	if err != nil {
+		panic(err)
+	}
+	hash.Write([]byte(KeyAuthPrefix))
+	hash.Write(challengerNonce)
+	hash.Write(responderNonce)
+	writeKey(hash, responderKey)
+	var buf [8]byte
+	if curve != "" {
+		binary.LittleEndian.PutUint64(buf[:], uint64(len(curve)))
+		hash.Write(buf[:])
+		hash.Write([]byte(curve))
+	}
+	binary.LittleEndian.PutUint64(buf[:], uint64(timestamp))
+	hash.Write(buf[:])
+	for _, f := range features {
+		binary.LittleEndian.PutUint64(buf[:], uint64(len(f)))
+		hash.Write(buf[:])
+		hash.Write([]byte(f))
+	}
+	writeKey(hash, ephemeral)
+	hash.Write(challenge)
+	return hash.Sum(nil)
+}
+
+// keyAuthHMAC computes the HMAC of the transcript, keyed by the key derived
+// from the ECDH secret of the handshake with the label, the reply and the
+// confirmation use different labels, so one can't stand in for the other:
+// blake2b(key: HKDF(secret, salt: transcript, label), transcript)
+func keyAuthHMAC(secret *big.Int, label string, transcript []byte) []byte {
+	hmac, err := blake2b.New256(deriveKey(secretBytes(secret), transcript, label))
+	if err != nil {
+		panic(err)
+	}
+	hmac.Write(transcript)
+	return hmac.Sum(nil)
+}
+
+// writeKey writes the coordinates of a public key on curve, padded
+func writeKey(w io.Writer, key *ecdsa.PublicKey) {
+	var X, Y bdls.PubKeyAxis
+	key.X.FillBytes(X[:])
+	key.Y.FillBytes(Y[:])
+	w.Write(X[:])
+	w.Write(Y[:])
+}
+
+// checkReplay verifies the nonce and timestamp of a KeyAuthInit, a nonce
+// is accepted once within MaxHandshakeSkew of it's timestamp.
+func (agent *TCPAgent) checkReplay(nonce []byte, timestamp int64, now time.Time) error {
+	if len(nonce) != nonceSize {
+		return ErrHandshakeNonce
+	}
+
+	sent := time.Unix(timestamp, 0)
+	if sent.Before(now.Add(-MaxHandshakeSkew)) || sent.After(now.Add(MaxHandshakeSkew)) {
+		return ErrHandshakeReplay
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	for k, expiry := range agent.authNonces {
+		if now.After(expiry) {
+			delete(agent.authNonces, k)
+		}
+	}
+	if _, ok := agent.authNonces[string(nonce)]; ok {
+		return ErrHandshakeReplay
+	}
+	agent.authNonces[string(nonce)] = sent.Add(MaxHandshakeSkew)
+	return nil
+}
+
+// SetMutualAuthentication sets whether a peer is authenticated only after
+// both sides have proved their keys, enabled by default. When enabled, the
+// consensus messages of a peer are held until then, and the peers which
+// don't authenticate to us in turn never complete the handshake.
+func (agent *TCPAgent) SetMutualAuthentication(enable bool) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.mutualAuth = enable
+}
+
+// getMutualAuthentication returns the setting of SetMutualAuthentication
+func (agent *TCPAgent) getMutualAuthentication() bool {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.mutualAuth
+}
+
+// MutuallyAuthenticated returns true if both sides have authenticated, the
+// peer has proved it's key to us, and accepted the proof of ours.
+func (p *TCPPeer) MutuallyAuthenticated() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.peerAuthStatus == peerAuthenticated && p.localAuthState == localAuthConfirmed
+}
+
+// holdConsensusMessage holds a consensus message received before both
+// sides have authenticated, returns false if it can be delivered now.
+func (p *TCPPeer) holdConsensusMessage(bts []byte) bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.peerAuthStatus == peerAuthenticated && p.localAuthState == localAuthConfirmed {
+		return false
+	}
+	if len(p.heldMessages) < maxHeldMessages {
+		p.heldMessages = append(p.heldMessages, bts)
+	}
+	return true
+}
+
+// onAuthenticated is called once the peer has been authenticated
+func (p *TCPPeer) onAuthenticated() error {
+	if p.agent.checkBanned(p) {
+		return ErrPeerBanned
+	}
+
+	// the peer may have reconnected, or been connected by another
+	// connection
+	p.agent.restoreState(p)
+	p.agent.dedupPeer(p)
+	// the features advertised by the peer may activate gated ones
+	p.agent.updateFeatures()
+	return nil
+}
+
+// onMutuallyAuthenticated is called once both sides have authenticated,
+// the consensus messages held are delivered.
+func (p *TCPPeer) onMutuallyAuthenticated() {
+	p.startSealing()
+	p.agent.announceMaintenance(p)
+	p.agent.announceObservedAddr(p)
+	p.agent.acceptObserver(p)
+
+	p.Lock()
+	held := p.heldMessages
+	p.heldMessages = nil
+	p.Unlock()
+
+	sender := p.GetPublicKey()
+	for _, bts := range held {
+		p.agent.handleConsensusMessage(bts, sender, p)
+	}
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestHandshakeReplay(t *testing.T) {
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	clientKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+	client := newTestAgent(t, clientKey)
+	defer client.Close()
+	// only the client authenticates in the handshakes below
+	server.SetMutualAuthentication(false)
+
+	now := time.Now()
+	assert.Equal(t, ErrHandshakeNonce, server.checkReplay(nil, now.Unix(), now))
+	assert.Equal(t, ErrHandshakeReplay, server.checkReplay(newNonce(), now.Add(-2*MaxHandshakeSkew).Unix(), now))
+	assert.Equal(t, ErrHandshakeReplay, server.checkReplay(newNonce(), now.Add(2*MaxHandshakeSkew).Unix(), now))
+	nonce := newNonce()
+	assert.Nil(t, server.checkReplay(nonce, now.Unix(), now))
+	assert.Equal(t, ErrHandshakeReplay, server.checkReplay(nonce, now.Unix(), now))
+	// forgotten once out of the window
+	later := now.Add(2*MaxHandshakeSkew + time.Second)
+	assert.Nil(t, server.checkReplay(newNonce(), later.Unix(), later))
+	server.Lock()
+	assert.Equal(t, 1, len(server.authNonces))
+	server.Unlock()
+
+	// handshake runs a challenge from the server peer to the client peer,
+	// and returns the challenge & the reply captured
+	handshake := func(init *KeyAuthInit, q *TCPPeer, qconn net.Conn) (*TCPPeer, *KeyAuthChallenge, *KeyAuthChallengeReply, error) {
+		c1, c2 := net.Pipe()
+		p := NewTCPPeer(c1, server)
+		if err := p.handleKeyAuthInit(init); err != nil {
+			return p, nil, nil, err
+		}
+		var challenge KeyAuthChallenge
+		assert.Nil(t, proto.Unmarshal(readGossip(t, c2, CommandType_KEY_AUTH_CHALLENGE), &challenge))
+		if err := q.handleKeyAuthChallenge(&challenge); err != nil {
+			return p, &challenge, nil, err
+		}
+		var reply KeyAuthChallengeReply
+		assert.Nil(t, proto.Unmarshal(readGossip(t, qconn, CommandType_KEY_AUTH_CHALLENGE_REPLY), &reply))
+		return p, &challenge, &reply, p.handleKeyAuthChallengeReply(&reply)
+	}
+	newClientPeer := func() (*TCPPeer, net.Conn, *KeyAuthInit) {
+		c1, c2 := net.Pipe()
+		q := NewTCPPeer(c1, client)
+		assert.Nil(t, q.InitiatePublicKeyAuthentication())
+		var init KeyAuthInit
+		assert.Nil(t, proto.Unmarshal(readGossip(t, c2, CommandType_KEY_AUTH_INIT), &init))
+		return q, c2, &init
+	}
+
+	q, qconn, init := newClientPeer()
+	p, challenge, reply, err := handshake(init, q, qconn)
+	assert.Nil(t, err)
+	assert.Equal(t, &clientKey.PublicKey, p.GetPublicKey())
+
+	// the captured KeyAuthInit is rejected on another connection
+	_, _, _, err = handshake(init, q, qconn)
+	assert.Equal(t, ErrHandshakeReplay, err)
+
+	// the captured reply fails a fresh challenge
+	fresh := *init
+	fresh.Nonce = newNonce()
+	c1, c2 := net.Pipe()
+	p = NewTCPPeer(c1, server)
+	assert.Nil(t, p.handleKeyAuthInit(&fresh))
+	readGossip(t, c2, CommandType_KEY_AUTH_CHALLENGE)
+	assert.Equal(t, ErrPeerAuthenticatedFailed, p.handleKeyAuthChallengeReply(reply))
+
+	// a challenge relayed to another connection of the client is answered
+	// for that connection's nonce
+	q, qconn, _ = newClientPeer()
+	fresh.Nonce = newNonce()
+	_, _, _, err = handshake(&fresh, q, qconn)
+	assert.Equal(t, ErrPeerAuthenticatedFailed, err)
+
+	// a challenge reflecting the client's own nonce is refused
+	q, _, _ = newClientPeer()
+	reflected := *challenge
+	reflected.Nonce = q.nonce
+	assert.Equal(t, ErrHandshakeReplay, q.handleKeyAuthChallenge(&reflected))
+}
+
+func TestMutualAuthentication(t *testing.T) {
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	clientKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+	client := newTestAgent(t, clientKey)
+	defer client.Close()
+
+	c1, c2 := net.Pipe()
+	p := NewTCPPeer(c1, server)
+	q := NewTCPPeer(c2, client)
+	defer p.Close()
+	defer q.Close()
+
+	// the client has proved it's key, but the server hasn't
+	assert.Nil(t, q.InitiatePublicKeyAuthentication())
+	assert.Eventually(t, func() bool {
+		p.Lock()
+		defer p.Unlock()
+		return p.peerAuthStatus == peerAuthVerified
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, p.GetPublicKey())
+	assert.False(t, p.MutuallyAuthenticated())
+	assert.False(t, q.MutuallyAuthenticated())
+
+	// consensus messages are held meanwhile
+	assert.Nil(t, p.handleGossip(&Gossip{Command: CommandType_CONSENSUS, Message: []byte{1}}))
+	p.Lock()
+	assert.Equal(t, 1, len(p.heldMessages))
+	p.Unlock()
+
+	// the server proves it's key in turn
+	assert.Nil(t, p.InitiatePublicKeyAuthentication())
+	select {
+	case <-p.chAuthenticated:
+	case <-time.After(time.Second):
+		t.Fatal("server side not authenticated")
+	}
+	select {
+	case <-q.chAuthenticated:
+	case <-time.After(time.Second):
+		t.Fatal("client side not authenticated")
+	}
+	assert.Equal(t, &clientKey.PublicKey, p.GetPublicKey())
+	assert.Equal(t, &serverKey.PublicKey, q.GetPublicKey())
+	assert.Eventually(t, func() bool { return p.MutuallyAuthenticated() && q.MutuallyAuthenticated() }, time.Second, 10*time.Millisecond)
+	p.Lock()
+	assert.Nil(t, p.heldMessages)
+	p.Unlock()
+
+	// confirmations are accepted once, and must match the transcript
+	assert.Equal(t, ErrPeerKeyAuthConfirm, q.handleKeyAuthConfirm(&KeyAuthConfirm{}))
+	c3, _ := net.Pipe()
+	r := NewTCPPeer(c3, client)
+	defer r.Close()
+	r.Lock()
+	r.localAuthState = localChallengeAccepted
+	r.expectedConfirm = []byte{1, 2, 3}
+	r.Unlock()
+	assert.Equal(t, ErrKeyAuthConfirm, r.handleKeyAuthConfirm(&KeyAuthConfirm{HMAC: []byte{1, 2, 4}}))
+	assert.Equal(t, penaltyAuthFailed, misbehaviorPenalty(ErrKeyAuthConfirm))
+}
@@ -0,0 +1,266 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/yonggewang/bdls"
+)
+
+const (
+	// DefaultMaxSyncLag is the default number of heights a node may lag
+	// behind the network and still be ready
+	DefaultMaxSyncLag = 2
+
+	// DefaultMaxStall is the default time the consensus updater may not
+	// run before the node is no longer live
+	DefaultMaxStall = 5 * time.Second
+
+	// readyPollInterval is the interval WaitReady checks Ready at
+	readyPollInterval = 100 * time.Millisecond
+)
+
+// Health is the liveness and readiness of a node, a node is live while it's
+// consensus updater runs, and ready once it's synced with the network and
+// connected to a quorum of participants.
+type Health struct {
+	Live       bool      `json:"live"`
+	Ready      bool      `json:"ready"`
+	LastUpdate time.Time `json:"last_update"` // the last run of the consensus updater
+
+	// the height decided by this node, and the height the network is
+	// deciding, seen in the messages of t+1 participants
+	Height        uint64 `json:"height"`
+	NetworkHeight uint64 `json:"network_height"`
+	Synced        bool   `json:"synced"`
+
+	// the participants connected and authenticated, this node included, or
+	// their weight if the participants are weighted
+	Participants int `json:"participants"`
+	Quorum       int `json:"quorum"`
+}
+
+// SetHealthPolicy sets the max heights this node may lag behind the network
+// to be ready, and the max time the consensus updater may stall to be live.
+// They're DefaultMaxSyncLag and DefaultMaxStall by default.
+func (agent *TCPAgent) SetHealthPolicy(maxSyncLag uint64, maxStall time.Duration) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.maxSyncLag = maxSyncLag
+	if maxStall > 0 {
+		atomic.StoreInt64(&agent.maxStall, int64(maxStall))
+	}
+}
+
+// markUpdated records a run of the consensus updater
+func (agent *TCPAgent) markUpdated(now time.Time) {
+	atomic.StoreInt64(&agent.lastUpdate, now.UnixNano())
+}
+
+// Live returns true if the consensus updater has run within the max stall
+// of SetHealthPolicy. It doesn't take the agent lock, so it answers even if
+// the event loop is stuck.
+func (agent *TCPAgent) Live() bool {
+	last := time.Unix(0, atomic.LoadInt64(&agent.lastUpdate))
+	return time.Since(last) < time.Duration(atomic.LoadInt64(&agent.maxStall))
+}
+
+// decodeMessage decodes a consensus message without verifying it, or
+// returns nil
+func decodeMessage(bts []byte) (*bdls.SignedProto, *bdls.Message) {
+	signed := new(bdls.SignedProto)
+	if err := proto.Unmarshal(bts, signed); err != nil {
+		return nil, nil
+	}
+	m := new(bdls.Message)
+	if err := proto.Unmarshal(signed.Message, m); err != nil {
+		return nil, nil
+	}
+	return signed, m
+}
+
+// observeHeight records the height of a consensus message by it's signer,
+// the ones beyond the next height are the evidence of this node lagging
+// behind, so their signers must be participants and the signatures are
+// verified, the others are ignored.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) observeHeight(signed *bdls.SignedProto, m *bdls.Message) {
+	height, _, _ := agent.consensus.CurrentState()
+	if m.Height <= height+1 {
+		return
+	}
+	id := bdls.DefaultPubKeyToIdentity(signed.PublicKey(bdls.S256Curve))
+	if m.Height <= agent.peerHeights[id] || !agent.isParticipant(id) || !signed.Verify(bdls.S256Curve) {
+		return
+	}
+	agent.peerHeights[id] = m.Height
+}
+
+// isParticipant returns true if id is a participant of the consensus
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) isParticipant(id bdls.Identity) bool {
+	for _, p := range agent.consensus.Participants() {
+		if p == id {
+			return true
+		}
+	}
+	return false
+}
+
+// networkHeight returns the height the network is deciding, the highest
+// one seen from t+1 participants, or t+1 of the weight if weighted, so a
+// byzantine participant can't make the node lag, or the next height of this
+// node if it's higher.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) networkHeight() uint64 {
+	type peerHeight struct {
+		height uint64
+		weight uint64
+	}
+	height, _, _ := agent.consensus.CurrentState()
+	next := height + 1
+	heights := make([]peerHeight, 0, len(agent.peerHeights))
+	for id, h := range agent.peerHeights {
+		if h <= next {
+			delete(agent.peerHeights, id)
+			continue
+		}
+		heights = append(heights, peerHeight{h, agent.consensus.Weight(id)})
+	}
+
+	t := uint64(agent.consensus.Quorum()-1) / 2
+	sort.Slice(heights, func(i, j int) bool { return heights[i].height > heights[j].height })
+	var weight uint64
+	for _, h := range heights {
+		if weight += h.weight; weight > t {
+			return h.height
+		}
+	}
+	return next
+}
+
+// connectedParticipants counts the participants authenticated by the peers,
+// or sums their weights if weighted, this node included if it's a
+// participant, peers connected more than once count once.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) connectedParticipants() int {
+	connected := make(map[bdls.Identity]bool)
+	connected[bdls.DefaultPubKeyToIdentity(&agent.privateKey.PublicKey)] = true
+	for _, p := range agent.peers {
+		p.Lock()
+		if p.peerAuthStatus == peerAuthenticated {
+			key := p.peerPublicKey
+			if p.peerValidatorKey != nil {
+				key = p.peerValidatorKey
+			}
+			connected[bdls.DefaultPubKeyToIdentity(key)] = true
+		}
+		p.Unlock()
+	}
+
+	var n int
+	for _, id := range agent.consensus.Participants() {
+		if connected[id] {
+			n += int(agent.consensus.Weight(id))
+			delete(connected, id)
+		}
+	}
+	return n
+}
+
+// Health returns the liveness and readiness of this node
+func (agent *TCPAgent) Health() *Health {
+	live := agent.Live()
+	last := time.Unix(0, atomic.LoadInt64(&agent.lastUpdate))
+
+	agent.Lock()
+	defer agent.Unlock()
+	health := &Health{Live: live, LastUpdate: last, Quorum: agent.consensus.Quorum()}
+	health.Height, _, _ = agent.consensus.CurrentState()
+	health.NetworkHeight = agent.networkHeight()
+	health.Synced = health.NetworkHeight <= health.Height+1+agent.maxSyncLag
+	health.Participants = agent.connectedParticipants()
+	health.Ready = live && health.Synced && health.Participants >= health.Quorum
+	return health
+}
+
+// Ready returns true if this node is live, lags no more than the max sync
+// lag of SetHealthPolicy behind the network, and is connected to a quorum
+// of participants.
+func (agent *TCPAgent) Ready() bool { return agent.Health().Ready }
+
+// WaitReady blocks until this node is ready, or ctx is done.
+func (agent *TCPAgent) WaitReady(ctx context.Context) error {
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+	for !agent.Ready() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-agent.die:
+			return ErrAgentClosed
+		}
+	}
+	return nil
+}
+
+// LivenessHandler serves Live for liveness probes, 200 if live, 503
+// otherwise, it doesn't take the agent lock.
+func (agent *TCPAgent) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !agent.Live() {
+			http.Error(w, "consensus updater stalled", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// ReadinessHandler serves Health as json for readiness probes, 200 if
+// ready, 503 otherwise.
+func (agent *TCPAgent) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := agent.Health()
+		w.Header().Set("Content-Type", "application/json")
+		if !health.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(health)
+	})
+}
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestHealth(t *testing.T) {
+	// 4 participants, a quorum of 3, t = 1
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < 4; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, key)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+	agents := make([]*TCPAgent, len(keys))
+	for i, key := range keys {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = key
+		config.Participants = participants
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		agents[i] = NewTCPAgent(consensus, key)
+		defer agents[i].Close()
+	}
+	a := agents[0]
+
+	// not live until the updater runs
+	a.SetHealthPolicy(1, 100*time.Millisecond)
+	assert.Eventually(t, func() bool { return !a.Live() }, 5*time.Second, 10*time.Millisecond)
+	w := httptest.NewRecorder()
+	a.LivenessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	a.Update()
+	assert.True(t, a.Live())
+	w = httptest.NewRecorder()
+	a.LivenessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// ready once connected to a quorum
+	health := a.Health()
+	assert.True(t, health.Synced)
+	assert.Equal(t, 1, health.Participants)
+	assert.False(t, health.Ready)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, a.WaitReady(ctx))
+
+	for i := 1; i < 3; i++ {
+		c1, c2 := net.Pipe()
+		p1 := NewTCPPeer(c1, a)
+		p2 := NewTCPPeer(c2, agents[i])
+		assert.True(t, a.AddPeer(p1))
+		assert.True(t, agents[i].AddPeer(p2))
+		p1.InitiatePublicKeyAuthentication()
+		p2.InitiatePublicKeyAuthentication()
+	}
+	assert.Nil(t, a.WaitReady(context.Background()))
+	w = httptest.NewRecorder()
+	a.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	health = new(Health)
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(health))
+	assert.Equal(t, 3, health.Participants)
+	assert.Equal(t, 3, health.Quorum)
+
+	// messages from far heights, by a non-participant, with a forged
+	// signature, or by t participants, don't make the node lag
+	message := func(key *ecdsa.PrivateKey, height uint64) []byte {
+		sp := new(bdls.SignedProto)
+		sp.Sign(&bdls.Message{Type: bdls.MessageType_RoundChange, Height: height, Round: 1}, key)
+		bts, err := proto.Marshal(sp)
+		assert.Nil(t, err)
+		return bts
+	}
+	outsider, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a.handleConsensusMessage(message(outsider, 10), nil, nil)
+	forged := new(bdls.SignedProto)
+	assert.Nil(t, proto.Unmarshal(message(keys[2], 10), forged))
+	forged.S = forged.R
+	bts, err := proto.Marshal(forged)
+	assert.Nil(t, err)
+	a.handleConsensusMessage(bts, nil, nil)
+	a.handleConsensusMessage(message(keys[1], 10), nil, nil)
+	<-time.After(100 * time.Millisecond)
+	assert.True(t, a.Ready())
+
+	// t+1 participants
+	a.handleConsensusMessage(message(keys[3], 10), nil, nil)
+	assert.Eventually(t, func() bool { return !a.Ready() }, 5*time.Second, 10*time.Millisecond)
+	health = a.Health()
+	assert.False(t, health.Synced)
+	assert.Equal(t, uint64(10), health.NetworkHeight)
+	w = httptest.NewRecorder()
+	a.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	a.Close()
+	assert.Equal(t, ErrAgentClosed, a.WaitReady(context.Background()))
+}
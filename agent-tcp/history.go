@@ -0,0 +1,207 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/yonggewang/bdls"
+)
+
+const (
+	// DefaultMaxHistory is the default number of heights of metrics kept in
+	// memory, the store keeps all of them
+	DefaultMaxHistory = 10000
+
+	// historyQueueSize is the number of metrics records pending to the store
+	historyQueueSize = 256
+)
+
+// HeightMetrics is the performance of a decided height, kept in the
+// history of the agent and persisted in the store set by SetMetricsStore.
+type HeightMetrics struct {
+	Height    uint64        `json:"height"`
+	Round     uint64        `json:"round"`
+	DecidedAt int64         `json:"decided_at"` // unix nanoseconds
+	Latency   time.Duration `json:"latency"`    // since the previous height was decided, zero for the first one after start
+
+	// the validators which proposed the decided state, hex encoded, empty
+	// if their proposals have not been seen, like the heights synced
+	Proposers []string `json:"proposers"`
+
+	// the participants whose <commit> messages are in the proof
+	Participation Bitmap `json:"participation"`
+	Committed     int    `json:"committed"` // the number of bits set
+}
+
+// MetricsStore persists the metrics of the decided heights, a node.WAL
+// can be used.
+type MetricsStore interface {
+	Append(data []byte) error
+}
+
+// SetMetricsStore makes the agent append the metrics of each height decided
+// afterwards to store as json, the records are written in the background,
+// and dropped if the store falls behind. The records replayed from the
+// store should be loaded with RestoreMetrics first.
+func (agent *TCPAgent) SetMetricsStore(store MetricsStore) {
+	ch := make(chan []byte, historyQueueSize)
+	agent.Lock()
+	agent.metricsQueue = ch
+	agent.Unlock()
+
+	go func() {
+		for {
+			select {
+			case data := <-ch:
+				if err := store.Append(data); err != nil {
+					log.Println("metrics store:", err)
+				}
+			case <-agent.die:
+				return
+			}
+		}
+	}()
+}
+
+// SetMetricsHistory sets the number of recent heights of metrics kept in
+// memory.
+func (agent *TCPAgent) SetMetricsHistory(n int) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.maxHistory = n
+}
+
+// RestoreMetrics loads a record replayed from the store into the history,
+// records not after the latest height kept are ignored.
+func (agent *TCPAgent) RestoreMetrics(data []byte) error {
+	var m HeightMetrics
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	if n := len(agent.history); n > 0 && m.Height <= agent.history[n-1].Height {
+		return nil
+	}
+	agent.appendHistory(&m)
+	return nil
+}
+
+// recordMetrics records the metrics of a decided height, authors are the
+// validators which proposed the state.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) recordMetrics(height, round uint64, participation Bitmap, authors map[bdls.Identity]bool) {
+	now := time.Now()
+	m := &HeightMetrics{Height: height, Round: round, DecidedAt: now.UnixNano(), Proposers: []string{}}
+	if !agent.lastDecided.IsZero() {
+		m.Latency = now.Sub(agent.lastDecided)
+	}
+	agent.lastDecided = now
+
+	for id := range authors {
+		m.Proposers = append(m.Proposers, hex.EncodeToString(id[:]))
+	}
+	sort.Strings(m.Proposers)
+
+	m.Participation = participation
+	m.Committed = participation.Count()
+	agent.appendHistory(m)
+
+	if agent.metricsQueue != nil {
+		data, err := json.Marshal(m)
+		if err != nil {
+			panic(err)
+		}
+		select {
+		case agent.metricsQueue <- data:
+		default:
+			log.Println("metrics store: the record of height", height, "is dropped")
+		}
+	}
+}
+
+// appendHistory keeps the metrics of a height, up to maxHistory.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) appendHistory(m *HeightMetrics) {
+	agent.history = append(agent.history, *m)
+	if n := len(agent.history) - agent.maxHistory; n > 0 {
+		agent.history = append(agent.history[:0], agent.history[n:]...)
+	}
+}
+
+// MetricsHistory returns the metrics of the heights kept in [from, to], to
+// 0 is the latest height.
+func (agent *TCPAgent) MetricsHistory(from, to uint64) []HeightMetrics {
+	agent.Lock()
+	defer agent.Unlock()
+
+	history := make([]HeightMetrics, 0)
+	for _, m := range agent.history {
+		if m.Height >= from && (to == 0 || m.Height <= to) {
+			history = append(history, m)
+		}
+	}
+	return history
+}
+
+// MetricsHistoryHandler serves MetricsHistory as json for the admin API,
+// the heights are selected by the query parameters from & to.
+func (agent *TCPAgent) MetricsHistoryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var bounds [2]uint64
+		for k, name := range []string{"from", "to"} {
+			if v := r.URL.Query().Get(name); v != "" {
+				var err error
+				if bounds[k], err = strconv.ParseUint(v, 10, 64); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agent.MetricsHistory(bounds[0], bounds[1]))
+	})
+}
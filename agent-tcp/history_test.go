@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+// memoryStore is a MetricsStore in memory
+type memoryStore struct {
+	sync.Mutex
+	records [][]byte
+}
+
+func (s *memoryStore) Append(data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	s.records = append(s.records, data)
+	return nil
+}
+
+func (s *memoryStore) Records() [][]byte {
+	s.Lock()
+	defer s.Unlock()
+	return append([][]byte(nil), s.records...)
+}
+
+func TestMetricsHistory(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, key)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+	newAgent := func() *TCPAgent {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = keys[0]
+		config.Participants = participants
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		return NewTCPAgent(consensus, keys[0])
+	}
+
+	// a <decide> message with the <commit> messages of participants 0, 2 & 3
+	state := []byte("state")
+	decide := bdls.Message{Type: bdls.MessageType_Decide, Height: 1, State: state}
+	for _, i := range []int{0, 2, 3, 2} {
+		signed := new(bdls.SignedProto)
+		signed.Sign(&bdls.Message{Type: bdls.MessageType_Commit, Height: 1, State: state}, keys[i])
+		decide.Proof = append(decide.Proof, signed)
+	}
+	signed := new(bdls.SignedProto)
+	signed.Sign(&decide, keys[0])
+	proof, err := proto.Marshal(signed)
+	assert.Nil(t, err)
+	participation, err := Participation(proof, participants)
+	assert.Nil(t, err)
+
+	a := newAgent()
+	defer a.Close()
+	store := new(memoryStore)
+	a.SetMetricsStore(store)
+	a.Lock()
+	a.recordProposal(participants[1], 1, state)
+	a.recordMetrics(1, 0, participation, a.auditDecision(1, state))
+	a.recordMetrics(2, 1, participation, a.auditDecision(2, state))
+	a.Unlock()
+
+	history := a.MetricsHistory(0, 0)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, []string{hex.EncodeToString(participants[1][:])}, history[0].Proposers)
+	assert.Equal(t, Bitmap{0x0d}, history[0].Participation)
+	assert.Equal(t, 3, history[0].Committed)
+	assert.Equal(t, time.Duration(0), history[0].Latency)
+	assert.Equal(t, uint64(1), history[1].Round)
+	assert.Equal(t, []string{}, history[1].Proposers)
+	assert.True(t, history[1].Latency > 0)
+	assert.Equal(t, history[1:], a.MetricsHistory(2, 0))
+	assert.Equal(t, history[:1], a.MetricsHistory(0, 1))
+
+	// the store is replayed into the history of a restarted agent
+	assert.Eventually(t, func() bool { return len(store.Records()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	b := newAgent()
+	defer b.Close()
+	b.SetMetricsHistory(1)
+	for _, data := range append(store.Records(), store.Records()...) {
+		assert.Nil(t, b.RestoreMetrics(data))
+	}
+	assert.Equal(t, history[1:], b.MetricsHistory(0, 0))
+	assert.NotNil(t, b.RestoreMetrics([]byte("{")))
+
+	// served as json by the admin API
+	srv := httptest.NewServer(a.MetricsHistoryHandler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "?from=2")
+	assert.Nil(t, err)
+	var served []HeightMetrics
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&served))
+	resp.Body.Close()
+	assert.Equal(t, history[1:], served)
+	resp, err = http.Get(srv.URL + "?to=x")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
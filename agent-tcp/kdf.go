@@ -0,0 +1,81 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"math/big"
+)
+
+const (
+	// KeyAuthReplyLabel is the HKDF label of the key of the HMAC in
+	// KeyAuthReply
+	KeyAuthReplyLabel = "BDLS_KEY_AUTH_REPLY"
+
+	// KeyAuthConfirmLabel is the HKDF label of the key of the HMAC in
+	// KeyAuthConfirm
+	KeyAuthConfirmLabel = "BDLS_KEY_AUTH_CONFIRM"
+
+	// SessionKeyLabel is the HKDF label of the session keys, followed by
+	// the nonce of the sending side, so each direction has it's own key
+	SessionKeyLabel = "BDLS_SESSION_KEY"
+
+	// SessionRekeyLabel is the HKDF label of the rotated session keys
+	SessionRekeyLabel = "BDLS_SESSION_REKEY"
+
+	// ControlKeyLabel is the HKDF label of the keys of control channels,
+	// followed by the nonce of the sending side
+	ControlKeyLabel = "BDLS_CONTROL_KEY"
+
+	// derivedKeySize is the size of the keys derived, for AES-256 and
+	// blake2b-256 HMACs
+	derivedKeySize = 32
+)
+
+// deriveKey derives a key from the ECDH secret with HKDF-SHA256, the label
+// separates the keys for different uses of the same secret, the salt binds
+// it to the context the secret was agreed in, it can be nil.
+func deriveKey(secret []byte, salt []byte, label string) []byte {
+	key, err := hkdf.Key(sha256.New, secret, salt, label, derivedKeySize)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// secretBytes returns the X coordinate of an ECDH secret padded to 32 bytes,
+// big.Int.Bytes() strips the leading zeros.
+func secretBytes(secret *big.Int) []byte {
+	var s [32]byte
+	secret.FillBytes(s[:])
+	return s[:]
+}
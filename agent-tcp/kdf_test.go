@@ -0,0 +1,29 @@
+package agent
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeriveKey(t *testing.T) {
+	// short secrets are padded, the keys are always 32 bytes
+	small := big.NewInt(1)
+	large := new(big.Int).Lsh(big.NewInt(1), 255)
+	assert.Equal(t, 32, len(secretBytes(small)))
+	assert.Equal(t, 32, len(deriveKey(secretBytes(small), nil, SessionKeyLabel)))
+
+	// labels and salts separate the keys of the same secret
+	secret := secretBytes(large)
+	assert.NotEqual(t, deriveKey(secret, nil, KeyAuthReplyLabel), deriveKey(secret, nil, KeyAuthConfirmLabel))
+	assert.NotEqual(t, deriveKey(secret, nil, SessionKeyLabel), deriveKey(secret, []byte("salt"), SessionKeyLabel))
+	transcript := []byte("transcript")
+	assert.NotEqual(t, keyAuthHMAC(large, KeyAuthReplyLabel, transcript), keyAuthHMAC(large, KeyAuthConfirmLabel, transcript))
+
+	// both sides derive the same key for a direction, each direction has
+	// it's own key
+	nonce1, nonce2 := newNonce(), newNonce()
+	assert.Equal(t, sessionKey(small, large, nonce1), sessionKey(large, small, nonce1))
+	assert.NotEqual(t, sessionKey(small, large, nonce1), sessionKey(small, large, nonce2))
+}
@@ -0,0 +1,100 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"sync/atomic"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+)
+
+const (
+	// DefaultKeepaliveInterval is the default interval of keepalives on idle
+	// connections.
+	DefaultKeepaliveInterval = 5 * time.Second
+	// DefaultKeepaliveMisses is the default number of intervals without any
+	// frame from a peer to declare it dead.
+	DefaultKeepaliveMisses = 3
+)
+
+// keepaliveFrame is a marshalled NOP, with a byte of message, as an empty
+// Gossip would marshal to a zero length frame.
+var keepaliveFrame = func() []byte {
+	bts, err := proto.Marshal(&Gossip{Command: CommandType_NOP, Message: []byte{0}})
+	if err != nil {
+		panic(err)
+	}
+	return bts
+}()
+
+// SetKeepalive makes the peers connected afterwards send a NOP on
+// connections idle for half of interval, and closes the peers without any
+// frame received in misses intervals, instead of waiting for the read
+// timeout. Persistent peers are re-dialed once closed. The peers must have
+// keepalives enabled with an interval no longer than this one, as idle
+// peers are not told apart from dead ones. 0 interval disables keepalives.
+func (agent *TCPAgent) SetKeepalive(interval time.Duration, misses int) {
+	agent.Lock()
+	defer agent.Unlock()
+	if misses < 1 {
+		misses = DefaultKeepaliveMisses
+	}
+	agent.keepaliveInterval = interval
+	agent.keepaliveMisses = misses
+}
+
+// getKeepalive returns the keepalive interval and misses
+func (agent *TCPAgent) getKeepalive() (time.Duration, int) {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.keepaliveInterval, agent.keepaliveMisses
+}
+
+// touchReceived records a frame received from the peer
+func (p *TCPPeer) touchReceived(now time.Time) {
+	atomic.StoreInt64(&p.lastReceived, now.UnixNano())
+}
+
+// touchSent records frames sent to the peer
+func (p *TCPPeer) touchSent(now time.Time) {
+	atomic.StoreInt64(&p.lastSent, now.UnixNano())
+}
+
+// keepalive checks the peer at every interval, it returns true if the
+// connection is idle and a NOP should be sent, or ErrPeerDead if no frame
+// has been received in misses intervals.
+func (p *TCPPeer) keepalive(now time.Time, interval time.Duration, misses int) (bool, error) {
+	if now.Sub(time.Unix(0, atomic.LoadInt64(&p.lastReceived))) >= time.Duration(misses)*interval {
+		return false, ErrPeerDead
+	}
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&p.lastSent))) >= interval/2, nil
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestKeepalive(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a := newTestAgent(t, keyA)
+	defer a.Close()
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+	a.SetKeepalive(50*time.Millisecond, 3)
+	b.SetKeepalive(50*time.Millisecond, 3)
+
+	// idle peers are kept alive by NOPs
+	c1, c2 := net.Pipe()
+	pa := NewTCPPeer(c1, a)
+	pb := NewTCPPeer(c2, b)
+	assert.True(t, a.AddPeer(pa))
+	assert.True(t, b.AddPeer(pb))
+	pa.InitiatePublicKeyAuthentication()
+	pb.InitiatePublicKeyAuthentication()
+	<-time.After(500 * time.Millisecond)
+	select {
+	case <-pa.die:
+		t.Fatal("an idle peer is closed")
+	case <-pb.die:
+		t.Fatal("an idle peer is closed")
+	default:
+	}
+	assert.True(t, a.Stats().Commands["NOP"].ReceivedMessages > 0)
+
+	// a peer sending nothing is dead
+	c3, c4 := net.Pipe()
+	go io.Copy(io.Discard, c4)
+	defer c4.Close()
+	pc := NewTCPPeer(c3, a)
+	assert.True(t, a.AddPeer(pc))
+	select {
+	case <-pc.die:
+	case <-time.After(time.Second):
+		t.Fatal("a dead peer is not closed")
+	}
+}
@@ -0,0 +1,188 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/yonggewang/bdls"
+)
+
+// lanes of outgoing consensus messages, drained in this order, so the small
+// messages critical to the progress of rounds are not delayed behind bulk
+// proposal data and proofs under bandwidth pressure.
+const (
+	laneCritical = iota // <roundchange>, <commit>, <lock-release>
+	laneBulk            // <lock>, <select>, <decide>, <resync> carrying proofs
+	numLanes
+)
+
+// messageLane returns the lane of a marshalled SignedProto
+func messageLane(bts []byte) int {
+	switch messageType(bts) {
+	case bdls.MessageType_RoundChange, bdls.MessageType_Commit, bdls.MessageType_LockRelease:
+		return laneCritical
+	default:
+		return laneBulk
+	}
+}
+
+// messageType returns the type of a marshalled SignedProto without decoding
+// the state and proofs, or Nop if it cannot be parsed.
+func messageType(bts []byte) bdls.MessageType {
+	var b proto.Buffer
+	b.SetBuf(bts)
+	wire, ok := scanField(&b, 2) // SignedProto.Message
+	if !ok || wire != proto.WireBytes {
+		return bdls.MessageType_Nop
+	}
+	message, err := b.DecodeRawBytes(false)
+	if err != nil {
+		return bdls.MessageType_Nop
+	}
+
+	b.SetBuf(message)
+	wire, ok = scanField(&b, 1) // Message.Type
+	if !ok || wire != proto.WireVarint {
+		return bdls.MessageType_Nop
+	}
+	t, err := b.DecodeVarint()
+	if err != nil {
+		return bdls.MessageType_Nop
+	}
+	return bdls.MessageType(t)
+}
+
+// scanField skips the fields of the marshalled message in b until field
+// num, and returns the wire type with b positioned at it's value. b is
+// passed by the caller to parse without allocations.
+func scanField(b *proto.Buffer, num uint64) (uint64, bool) {
+	for {
+		key, err := b.DecodeVarint()
+		if err != nil {
+			return 0, false
+		}
+		if key>>3 == num {
+			return key & 7, true
+		}
+
+		switch key & 7 {
+		case proto.WireVarint:
+			_, err = b.DecodeVarint()
+		case proto.WireFixed64:
+			_, err = b.DecodeFixed64()
+		case proto.WireBytes:
+			_, err = b.DecodeRawBytes(false)
+		case proto.WireFixed32:
+			_, err = b.DecodeFixed32()
+		default:
+			return 0, false
+		}
+		if err != nil {
+			return 0, false
+		}
+	}
+}
+
+// messageQueue is a FIFO of messages, the buffer is reused once drained, so
+// queueing messages doesn't allocate in steady state.
+type messageQueue struct {
+	msgs [][]byte
+	head int // the index of the first message
+}
+
+// push appends a message, the popped ones are compacted before the buffer
+// grows.
+func (q *messageQueue) push(bts []byte) {
+	if q.head > 0 && len(q.msgs) == cap(q.msgs) {
+		n := copy(q.msgs, q.msgs[q.head:])
+		for k := n; k < len(q.msgs); k++ {
+			q.msgs[k] = nil // avoid memory leak
+		}
+		q.msgs = q.msgs[:n]
+		q.head = 0
+	}
+	q.msgs = append(q.msgs, bts)
+}
+
+// pop removes the first message
+func (q *messageQueue) pop() ([]byte, bool) {
+	if q.head == len(q.msgs) {
+		return nil, false
+	}
+	bts := q.msgs[q.head]
+	q.msgs[q.head] = nil // avoid memory leak
+	q.head++
+	if q.head == len(q.msgs) {
+		q.msgs = q.msgs[:0]
+		q.head = 0
+	}
+	return bts, true
+}
+
+// len returns the number of messages queued
+func (q *messageQueue) len() int {
+	return len(q.msgs) - q.head
+}
+
+// take removes all messages
+func (q *messageQueue) take() [][]byte {
+	msgs := q.msgs[q.head:]
+	*q = messageQueue{}
+	return msgs
+}
+
+// enqueueConsensusMessage appends a consensus message to it's lane.
+// NOTE: peer lock must be held.
+func (p *TCPPeer) enqueueConsensusMessage(bts []byte) {
+	p.lanes[messageLane(bts)].push(bts)
+}
+
+// nextConsensusMessage pops the first message of the highest priority lane.
+// NOTE: peer lock must be held.
+func (p *TCPPeer) nextConsensusMessage() ([]byte, bool) {
+	for lane := range p.lanes {
+		if bts, ok := p.lanes[lane].pop(); ok {
+			return bts, true
+		}
+	}
+	return nil, false
+}
+
+// takeConsensusMessages removes all pending consensus messages, in the
+// order of lanes.
+// NOTE: peer lock must be held.
+func (p *TCPPeer) takeConsensusMessages() [][]byte {
+	var all [][]byte
+	for lane := range p.lanes {
+		all = append(all, p.lanes[lane].take()...)
+	}
+	return all
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestMessageLanes(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	signed := func(mt bdls.MessageType) []byte {
+		m := &bdls.Message{Type: mt, Height: 1, Round: 1, State: make([]byte, 1024)}
+		sp := new(bdls.SignedProto)
+		sp.Sign(m, key)
+		bts, err := proto.Marshal(sp)
+		assert.Nil(t, err)
+		return bts
+	}
+
+	for mt, lane := range map[bdls.MessageType]int{
+		bdls.MessageType_RoundChange: laneCritical,
+		bdls.MessageType_Commit:      laneCritical,
+		bdls.MessageType_LockRelease: laneCritical,
+		bdls.MessageType_Lock:        laneBulk,
+		bdls.MessageType_Select:      laneBulk,
+		bdls.MessageType_Decide:      laneBulk,
+		bdls.MessageType_Resync:      laneBulk,
+	} {
+		bts := signed(mt)
+		assert.Equal(t, mt, messageType(bts))
+		assert.Equal(t, lane, messageLane(bts), mt.String())
+	}
+	assert.Equal(t, bdls.MessageType_Nop, messageType([]byte{0xff, 0xff}))
+	assert.Equal(t, laneBulk, messageLane(nil))
+
+	// critical messages overtake bulk ones, in order within a lane
+	p := new(TCPPeer)
+	lock, commit, decide, roundChange := signed(bdls.MessageType_Lock), signed(bdls.MessageType_Commit), signed(bdls.MessageType_Decide), signed(bdls.MessageType_RoundChange)
+	for _, bts := range [][]byte{lock, commit, decide, roundChange} {
+		p.enqueueConsensusMessage(bts)
+	}
+	for _, expected := range [][]byte{commit, roundChange, lock, decide} {
+		bts, ok := p.nextConsensusMessage()
+		assert.True(t, ok)
+		assert.Equal(t, expected, bts)
+	}
+	_, ok := p.nextConsensusMessage()
+	assert.False(t, ok)
+}
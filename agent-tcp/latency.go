@@ -0,0 +1,248 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/yonggewang/bdls"
+)
+
+// latencyRow is the round trip times advertised by a validator
+type latencyRow struct {
+	rtts    map[bdls.Identity]time.Duration
+	updated time.Time
+}
+
+// LatencyMatrix is the pairwise round trip times between validators,
+// RTT[i][j] is the round trip time in milliseconds measured by
+// Validators[i] to Validators[j], or -1 if unknown.
+type LatencyMatrix struct {
+	Validators []string    `json:"validators"` // hex encoded identities
+	RTT        [][]float64 `json:"rtt_ms"`
+}
+
+// ReportLatency measures the round trip times to the authenticated peers by
+// pings, and advertises them to the peers at every interval, until stop is
+// called or the agent is closed. The advertised round trip times of peers
+// are aggregated in LatencyMatrix, rows not updated in 3 intervals are
+// dropped.
+func (agent *TCPAgent) ReportLatency(interval time.Duration) (stop func()) {
+	chStop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				agent.Lock()
+				agent.latencyTTL = 3 * interval
+				peers := append([]*TCPPeer(nil), agent.peers...)
+				agent.Unlock()
+
+				status := agent.latencyStatus(peers)
+				for _, p := range peers {
+					if p.GetPublicKey() != nil {
+						p.ping()
+						p.sendAgentMessage(CommandType_LATENCY_STATUS, status)
+					}
+				}
+			case <-chStop:
+				return
+			case <-agent.die:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(chStop) }) }
+}
+
+// latencyStatus collects the round trip times to peers
+func (agent *TCPAgent) latencyStatus(peers []*TCPPeer) *LatencyStatus {
+	status := new(LatencyStatus)
+	for _, p := range peers {
+		if key := p.GetPublicKey(); key != nil {
+			if rtt := p.getRTT(); rtt > 0 {
+				id := bdls.DefaultPubKeyToIdentity(key)
+				status.Peers = append(status.Peers, &PeerLatency{Identity: id[:], RTT: int64(rtt)})
+			}
+		}
+	}
+	return status
+}
+
+// handleLatencyStatus records the round trip times advertised by a peer
+func (agent *TCPAgent) handleLatencyStatus(p *TCPPeer, status *LatencyStatus) {
+	key := p.GetPublicKey()
+	if key == nil {
+		return
+	}
+
+	row := &latencyRow{rtts: make(map[bdls.Identity]time.Duration), updated: time.Now()}
+	for _, pl := range status.Peers {
+		var id bdls.Identity
+		if len(pl.Identity) != len(id) || pl.RTT <= 0 {
+			continue
+		}
+		copy(id[:], pl.Identity)
+		row.rtts[id] = time.Duration(pl.RTT)
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	agent.latencies[bdls.DefaultPubKeyToIdentity(key)] = row
+}
+
+// LatencyMatrix returns the pairwise round trip times between this agent,
+// it's peers, and the peers of the peers.
+func (agent *TCPAgent) LatencyMatrix() *LatencyMatrix {
+	agent.Lock()
+	peers := append([]*TCPPeer(nil), agent.peers...)
+	rows := make(map[bdls.Identity]*latencyRow)
+	for id, row := range agent.latencies {
+		if agent.latencyTTL == 0 || time.Since(row.updated) < agent.latencyTTL {
+			rows[id] = row
+		}
+	}
+	agent.Unlock()
+
+	// this agent's own row
+	self := &latencyRow{rtts: make(map[bdls.Identity]time.Duration)}
+	for _, pl := range agent.latencyStatus(peers).Peers {
+		var id bdls.Identity
+		copy(id[:], pl.Identity)
+		self.rtts[id] = time.Duration(pl.RTT)
+	}
+	rows[bdls.DefaultPubKeyToIdentity(&agent.privateKey.PublicKey)] = self
+
+	// all validators known, in order
+	known := make(map[bdls.Identity]bool)
+	for from, row := range rows {
+		known[from] = true
+		for to := range row.rtts {
+			known[to] = true
+		}
+	}
+	ids := make([]bdls.Identity, 0, len(known))
+	for id := range known {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return string(ids[i][:]) < string(ids[j][:]) })
+
+	m := new(LatencyMatrix)
+	for i, from := range ids {
+		m.Validators = append(m.Validators, hex.EncodeToString(from[:]))
+		m.RTT = append(m.RTT, make([]float64, len(ids)))
+		for j, to := range ids {
+			m.RTT[i][j] = -1
+			if row, ok := rows[from]; ok {
+				if rtt, ok := row.rtts[to]; ok {
+					m.RTT[i][j] = float64(rtt) / float64(time.Millisecond)
+				}
+			}
+		}
+	}
+	return m
+}
+
+// LatencyHandler serves LatencyMatrix as json, for the admin API
+func (agent *TCPAgent) LatencyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agent.LatencyMatrix())
+	})
+}
+
+// ping sends a LATENCY_PING to the peer
+func (p *TCPPeer) ping() {
+	var nonce [8]byte
+	rand.Read(nonce[:])
+
+	p.Lock()
+	p.pingNonce = binary.LittleEndian.Uint64(nonce[:])
+	p.pingSent = time.Now()
+	ping := &LatencyPing{Nonce: p.pingNonce}
+	p.Unlock()
+
+	p.sendAgentMessage(CommandType_LATENCY_PING, ping)
+}
+
+// handlePong updates the smoothed round trip time if the pong matches the
+// last ping, as in TCP with a gain of 1/8.
+func (p *TCPPeer) handlePong(pong *LatencyPing) {
+	p.Lock()
+	defer p.Unlock()
+	if p.pingSent.IsZero() || pong.Nonce != p.pingNonce {
+		return
+	}
+
+	sample := time.Since(p.pingSent)
+	p.pingSent = time.Time{}
+	if p.rtt == 0 {
+		p.rtt = sample
+	} else {
+		p.rtt += (sample - p.rtt) / 8
+	}
+}
+
+// getRTT returns the smoothed round trip time, or 0 if not measured
+func (p *TCPPeer) getRTT() time.Duration {
+	p.Lock()
+	defer p.Unlock()
+	return p.rtt
+}
+
+// sendAgentMessage encapsulates and enqueues a message to agent messages
+func (p *TCPPeer) sendAgentMessage(command CommandType, m proto.Message) {
+	bts, err := proto.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	out, err := proto.Marshal(&Gossip{Command: command, Message: bts})
+	if err != nil {
+		panic(err)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.agentMessages = append(p.agentMessages, out)
+	p.notifyAgentMessage()
+}
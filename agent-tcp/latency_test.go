@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestLatencyMatrix(t *testing.T) {
+	const n = 3
+	agents := make([]*TCPAgent, n)
+	for i := range agents {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		agents[i] = newTestAgent(t, key)
+		defer agents[i].Close()
+	}
+
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			c1, c2 := net.Pipe()
+			p1 := NewTCPPeer(c1, agents[i])
+			p2 := NewTCPPeer(c2, agents[j])
+			assert.True(t, agents[i].AddPeer(p1))
+			assert.True(t, agents[j].AddPeer(p2))
+			p1.InitiatePublicKeyAuthentication()
+			p2.InitiatePublicKeyAuthentication()
+		}
+	}
+	for i := range agents {
+		defer agents[i].ReportLatency(20 * time.Millisecond)()
+	}
+
+	// complete returns true if all pairs have been measured
+	complete := func(m *LatencyMatrix) bool {
+		if len(m.Validators) != n {
+			return false
+		}
+		for i := range m.RTT {
+			for j := range m.RTT[i] {
+				if i != j && m.RTT[i][j] < 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	var m *LatencyMatrix
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if m = agents[0].LatencyMatrix(); complete(m) {
+			break
+		}
+		<-time.After(20 * time.Millisecond)
+	}
+	assert.True(t, complete(m))
+	for i := range m.RTT {
+		assert.Equal(t, float64(-1), m.RTT[i][i])
+	}
+
+	// served as json by the admin API
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	go http.Serve(l, agents[0].LatencyHandler())
+	resp, err := http.Get("http://" + l.Addr().String())
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	var served LatencyMatrix
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&served))
+	assert.Equal(t, m.Validators, served.Validators)
+}
@@ -0,0 +1,95 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/yonggewang/bdls"
+)
+
+// Leave announces to the peers that this node is shutting down, so the
+// rounds led by it won't wait for it's proposal, see Consensus.LeaderGone.
+// It returns once the announcement has been handed to all connections, or
+// timeout, the agent should be closed afterwards.
+func (agent *TCPAgent) Leave(timeout time.Duration) {
+	out, err := proto.Marshal(&Gossip{Command: CommandType_LEAVING})
+	if err != nil {
+		panic(err)
+	}
+
+	agent.Lock()
+	peers := make([]*TCPPeer, len(agent.peers))
+	copy(peers, agent.peers)
+	agent.Unlock()
+
+	for _, p := range peers {
+		p.Lock()
+		p.agentMessages = append(p.agentMessages, out)
+		p.notifyAgentMessage()
+		p.Unlock()
+	}
+
+	deadline := time.Now().Add(timeout)
+	for _, p := range peers {
+		for !p.agentMessagesSent() && time.Now().Before(deadline) {
+			<-time.After(10 * time.Millisecond)
+		}
+	}
+}
+
+// agentMessagesSent returns true if there's no agent messages pending to
+// send, or the connection has been closed.
+func (p *TCPPeer) agentMessagesSent() bool {
+	select {
+	case <-p.die:
+		return true
+	default:
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	return len(p.agentMessages) == 0
+}
+
+// handleLeaving marks the peer as gone for the consensus, the announcement
+// is only accepted from authenticated peers.
+func (agent *TCPAgent) handleLeaving(p *TCPPeer) {
+	pubkey := p.GetPublicKey()
+	if pubkey == nil {
+		return
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	agent.consensus.LeaderGone(bdls.DefaultPubKeyToIdentity(pubkey))
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestLeave(t *testing.T) {
+	key1, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	key2, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a1 := newTestAgent(t, key1)
+	defer a1.Close()
+	a2 := newTestAgent(t, key2)
+	defer a2.Close()
+
+	c1, c2 := net.Pipe()
+	p1 := NewTCPPeer(c1, a1)
+	p2 := NewTCPPeer(c2, a2)
+	assert.True(t, a1.AddPeer(p1))
+	assert.True(t, a2.AddPeer(p2))
+	p1.InitiatePublicKeyAuthentication()
+	p2.InitiatePublicKeyAuthentication()
+	assert.Nil(t, a1.waitAuthenticated(p1, nil, time.Second, nil))
+	assert.Nil(t, a2.waitAuthenticated(p2, nil, time.Second, nil))
+
+	// returns once the announcement has been sent
+	start := time.Now()
+	a1.Leave(5 * time.Second)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.True(t, p1.agentMessagesSent())
+
+	// the announcement is handled by the peer without closing the connection
+	select {
+	case <-p2.die:
+		t.Fatal("connection closed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// a closed connection never blocks
+	p1.Close()
+	start = time.Now()
+	a1.Leave(5 * time.Second)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
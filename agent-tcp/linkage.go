@@ -0,0 +1,124 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"math/big"
+	"time"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/crypto/blake2b"
+)
+
+const (
+	// KeyLinkagePrefix is the prefix for signing a key linkage statement
+	KeyLinkagePrefix = "BDLS_KEY_LINKAGE"
+)
+
+// keyLinkageHash computes the digest to be signed by a validator key:
+// blake2b(KeyLinkagePrefix + transport.X + transport.Y + Sequence + NotBefore + NotAfter)
+func keyLinkageHash(transportKey *ecdsa.PublicKey, sequence uint64, notBefore int64, notAfter int64) []byte {
+	var X, Y bdls.PubKeyAxis
+	if err := X.Unmarshal(transportKey.X.Bytes()); err != nil {
+		panic(err)
+	}
+	if err := Y.Unmarshal(transportKey.Y.Bytes()); err != nil {
+		panic(err)
+	}
+
+	hash, err := blake2b.New256(nil)
+	if err != nil {
+		panic(err)
+	}
+	var buf [8]byte
+	hash.Write([]byte(KeyLinkagePrefix))
+	hash.Write(X[:])
+	hash.Write(Y[:])
+	binary.LittleEndian.PutUint64(buf[:], sequence)
+	hash.Write(buf[:])
+	binary.LittleEndian.PutUint64(buf[:], uint64(notBefore))
+	hash.Write(buf[:])
+	binary.LittleEndian.PutUint64(buf[:], uint64(notAfter))
+	hash.Write(buf[:])
+	return hash.Sum(nil)
+}
+
+// NewKeyLinkage creates a statement signed by validatorKey to delegate
+// transportKey to authenticate connections on behalf of the validator
+// within [notBefore, notAfter]. The statement can be created offline, so
+// the validator key can stay offline while transport keys rotate freely,
+// a statement with higher sequence supersedes all lower ones once seen
+// by a peer.
+func NewKeyLinkage(validatorKey *ecdsa.PrivateKey, transportKey *ecdsa.PublicKey, sequence uint64, notBefore time.Time, notAfter time.Time) (*KeyLinkage, error) {
+	linkage := new(KeyLinkage)
+	linkage.Sequence = sequence
+	linkage.NotBefore = notBefore.Unix()
+	linkage.NotAfter = notAfter.Unix()
+
+	r, s, err := ecdsa.Sign(rand.Reader, validatorKey, keyLinkageHash(transportKey, linkage.Sequence, linkage.NotBefore, linkage.NotAfter))
+	if err != nil {
+		return nil, err
+	}
+
+	linkage.X = validatorKey.PublicKey.X.Bytes()
+	linkage.Y = validatorKey.PublicKey.Y.Bytes()
+	linkage.R = r.Bytes()
+	linkage.S = s.Bytes()
+	return linkage, nil
+}
+
+// VerifyKeyLinkage verifies the statement against the transport key at
+// the given time, and returns the validator's public key if the statement
+// is authentic.
+func VerifyKeyLinkage(linkage *KeyLinkage, transportKey *ecdsa.PublicKey, now time.Time) (*ecdsa.PublicKey, error) {
+	if linkage == nil {
+		return nil, ErrKeyLinkageEmpty
+	}
+
+	validatorKey := unmarshalKey(bdls.S256Curve, linkage.X, linkage.Y)
+	if validatorKey == nil {
+		return nil, ErrKeyNotOnCurve
+	}
+
+	r := big.NewInt(0).SetBytes(linkage.R)
+	s := big.NewInt(0).SetBytes(linkage.S)
+	if !ecdsa.Verify(validatorKey, keyLinkageHash(transportKey, linkage.Sequence, linkage.NotBefore, linkage.NotAfter), r, s) {
+		return nil, ErrKeyLinkage
+	}
+
+	if unix := now.Unix(); unix < linkage.NotBefore || unix > linkage.NotAfter {
+		return nil, ErrKeyLinkageExpired
+	}
+	return validatorKey, nil
+}
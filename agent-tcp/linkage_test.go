@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+// newTestLinkage creates a key linkage valid for an hour
+func newTestLinkage(t *testing.T, validatorKey *ecdsa.PrivateKey, transportKey *ecdsa.PublicKey, sequence uint64) *KeyLinkage {
+	linkage, err := NewKeyLinkage(validatorKey, transportKey, sequence, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	assert.Nil(t, err)
+	return linkage
+}
+
+// testKeyAuthInit feeds a KeyAuthInit for transportKey with linkage to a fresh peer
+func testKeyAuthInit(t *testing.T, transportKey *ecdsa.PublicKey, linkage *KeyLinkage) (*TCPPeer, error) {
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	server := newTestAgent(t, serverKey)
+	c1, _ := net.Pipe()
+	p := NewTCPPeer(c1, server)
+
+	auth := KeyAuthInit{X: transportKey.X.Bytes(), Y: transportKey.Y.Bytes(), Linkage: linkage, Nonce: newNonce(), Timestamp: time.Now().Unix()}
+	return p, p.handleKeyAuthInit(&auth)
+}
+
+func TestKeyLinkageAuthenticated(t *testing.T) {
+	validatorKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	transportKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	client := newTestAgent(t, transportKey)
+	defer client.Close()
+	assert.Nil(t, client.SetKeyLinkage(newTestLinkage(t, validatorKey, &transportKey.PublicKey, 1)))
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+
+	c1, c2 := net.Pipe()
+	p1 := NewTCPPeer(c1, client)
+	p2 := NewTCPPeer(c2, server)
+	assert.Nil(t, p1.InitiatePublicKeyAuthentication())
+	assert.Nil(t, p2.InitiatePublicKeyAuthentication())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p2.GetPublicKey() == nil && time.Now().Before(deadline) {
+		<-time.After(20 * time.Millisecond)
+	}
+
+	// the validator key identifies the peer, while the connection
+	// is still authenticated by the transport key.
+	assert.Equal(t, &validatorKey.PublicKey, p2.GetPublicKey())
+	assert.Equal(t, &transportKey.PublicKey, p2.GetTransportPublicKey())
+}
+
+func TestKeyLinkageMismatched(t *testing.T) {
+	validatorKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	transportKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	otherKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	// linkage for another transport key
+	p, err := testKeyAuthInit(t, &transportKey.PublicKey, newTestLinkage(t, validatorKey, &otherKey.PublicKey, 1))
+	assert.Equal(t, ErrKeyLinkage, err)
+	assert.Equal(t, peerAuthenticatedFailed, p.peerAuthStatus)
+
+	// forged signature
+	linkage := newTestLinkage(t, validatorKey, &transportKey.PublicKey, 1)
+	linkage.Sequence++
+	p, err = testKeyAuthInit(t, &transportKey.PublicKey, linkage)
+	assert.Equal(t, ErrKeyLinkage, err)
+	assert.Equal(t, peerAuthenticatedFailed, p.peerAuthStatus)
+}
+
+func TestKeyLinkageNotOnCurve(t *testing.T) {
+	validatorKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	transportKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	linkage := newTestLinkage(t, validatorKey, &transportKey.PublicKey, 1)
+	linkage.Y = big.NewInt(0).Add(validatorKey.PublicKey.Y, big.NewInt(1)).Bytes()
+	p, err := testKeyAuthInit(t, &transportKey.PublicKey, linkage)
+	assert.Equal(t, ErrKeyNotOnCurve, err)
+	assert.Equal(t, peerAuthenticatedFailed, p.peerAuthStatus)
+}
+
+func TestKeyLinkageValidity(t *testing.T) {
+	validatorKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	transportKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	_, err = VerifyKeyLinkage(nil, &transportKey.PublicKey, time.Now())
+	assert.Equal(t, ErrKeyLinkageEmpty, err)
+	assert.Equal(t, ErrKeyLinkageEmpty, newTestAgent(t, transportKey).SetKeyLinkage(nil))
+
+	linkage, err := NewKeyLinkage(validatorKey, &transportKey.PublicKey, 1, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+	_, err = VerifyKeyLinkage(linkage, &transportKey.PublicKey, time.Now())
+	assert.Equal(t, ErrKeyLinkageExpired, err)
+}
+
+func TestKeyLinkageRevoked(t *testing.T) {
+	validatorKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	oldKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	newKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	agent := newTestAgent(t, validatorKey)
+	defer agent.Close()
+
+	// a higher sequence supersedes the lower one
+	_, err = agent.verifyKeyLinkage(newTestLinkage(t, validatorKey, &newKey.PublicKey, 2), &newKey.PublicKey)
+	assert.Nil(t, err)
+	_, err = agent.verifyKeyLinkage(newTestLinkage(t, validatorKey, &oldKey.PublicKey, 1), &oldKey.PublicKey)
+	assert.Equal(t, ErrKeyLinkageRevoked, err)
+
+	// explicit revocation
+	agent.RevokeKeyLinkage(&validatorKey.PublicKey, 3)
+	_, err = agent.verifyKeyLinkage(newTestLinkage(t, validatorKey, &newKey.PublicKey, 2), &newKey.PublicKey)
+	assert.Equal(t, ErrKeyLinkageRevoked, err)
+}
@@ -0,0 +1,130 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"net"
+	"time"
+)
+
+// SetHandshakeTimeout sets the time for peers to authenticate, before
+// connections accepted by Serve are closed. It's also the default timeout
+// of Connect.
+func (agent *TCPAgent) SetHandshakeTimeout(timeout time.Duration) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.options.handshakeTimeout = timeout
+}
+
+// getHandshakeTimeout returns the handshake timeout
+func (agent *TCPAgent) getHandshakeTimeout() time.Duration {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.options.handshakeTimeout
+}
+
+// getTransportOptions returns the options of the connections
+func (agent *TCPAgent) getTransportOptions() transportOptions {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.options
+}
+
+// Listen announces on the TCP address addr, and serves the connections in
+// background, the listener will be closed along with the agent. The port is
+// mapped by the gateway if a port mapper is set.
+func (agent *TCPAgent) Listen(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go agent.serveMapped(l)
+	return l, nil
+}
+
+// Serve accepts connections on l, each connection authenticates to the peer,
+// and joins the consensus once the peer has authenticated itself within the
+// handshake timeout. Serve returns when l fails, or nil when the agent has
+// been closed.
+func (agent *TCPAgent) Serve(l net.Listener) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-agent.die:
+			l.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-agent.die:
+				return nil
+			default:
+				return err
+			}
+		}
+		go agent.accept(conn)
+	}
+}
+
+// accept runs the key authentication for an inbound connection
+func (agent *TCPAgent) accept(conn net.Conn) {
+	if agent.hostBanned(addrHost(conn.RemoteAddr())) || !agent.permitsAddr(conn.RemoteAddr()) || agent.shedLevel() >= ShedUnauthenticated {
+		conn.Close()
+		return
+	}
+
+	p, err := agent.NewPeer(conn, false)
+	if err != nil {
+		return
+	}
+	if !agent.admitConnection(p) {
+		p.Close()
+		return
+	}
+	if err := p.InitiatePublicKeyAuthentication(); err != nil {
+		p.Close()
+		return
+	}
+
+	if err := agent.waitAuthenticated(p, nil, agent.getHandshakeTimeout(), nil); err != nil {
+		p.Close()
+		return
+	}
+
+	if !agent.AddPeer(p) {
+		p.Close()
+	}
+}
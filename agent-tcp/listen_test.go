@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestListen(t *testing.T) {
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	clientKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	server := newTestAgent(t, serverKey)
+	server.SetHandshakeTimeout(200 * time.Millisecond)
+	client := newTestAgent(t, clientKey)
+	defer client.Close()
+
+	l, err := server.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+
+	_, err = client.Connect(context.Background(), l.Addr().String(), &serverKey.PublicKey)
+	assert.Nil(t, err)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		server.Lock()
+		n := len(server.peers)
+		server.Unlock()
+		if n == 1 {
+			break
+		}
+		<-time.After(20 * time.Millisecond)
+	}
+	server.Lock()
+	assert.Equal(t, 1, len(server.peers))
+	assert.Equal(t, &clientKey.PublicKey, server.peers[0].GetPublicKey())
+	server.Unlock()
+
+	// connections not authenticated in time are closed
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.Copy(io.Discard, conn)
+	assert.Nil(t, err) // EOF
+	server.Lock()
+	assert.Equal(t, 1, len(server.peers))
+	server.Unlock()
+
+	// the listener is closed along with the agent
+	server.Close()
+	<-time.After(100 * time.Millisecond)
+	_, err = net.Dial("tcp", l.Addr().String())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,196 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/yonggewang/bdls"
+)
+
+const (
+	// DefaultMaintenanceLead is how long before a maintenance window the
+	// validator stops being waited for as the leader of rounds
+	DefaultMaintenanceLead = 10 * time.Second
+)
+
+// maintenanceWindow is the planned downtime of a validator
+type maintenanceWindow struct {
+	start time.Time
+	end   time.Time
+}
+
+// Maintenance is a maintenance window for the admin API
+type Maintenance struct {
+	Validator string    `json:"validator"` // hex encoded identity
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+}
+
+// ScheduleMaintenance announces the planned downtime of this node to the
+// peers, from DefaultMaintenanceLead before start until end, the peers will
+// not wait for this node's <lock> or <select> in the rounds it leads, see
+// Consensus.LeaderGone, so planned operations won't cost timed-out rounds.
+// It's announced to the peers connecting later too, until end.
+func (agent *TCPAgent) ScheduleMaintenance(start time.Time, end time.Time) error {
+	if !end.After(start) {
+		return ErrMaintenanceWindow
+	}
+	agent.setMaintenance(&maintenanceWindow{start: start, end: end})
+	return nil
+}
+
+// CancelMaintenance cancels the maintenance window announced
+func (agent *TCPAgent) CancelMaintenance() { agent.setMaintenance(nil) }
+
+// setMaintenance sets and announces the maintenance window of this node,
+// nil to cancel.
+func (agent *TCPAgent) setMaintenance(window *maintenanceWindow) {
+	agent.Lock()
+	self := bdls.DefaultPubKeyToIdentity(&agent.privateKey.PublicKey)
+	if window != nil {
+		agent.maintenance[self] = window
+	} else {
+		delete(agent.maintenance, self)
+	}
+	peers := append([]*TCPPeer(nil), agent.peers...)
+	agent.Unlock()
+
+	announcement := window.announcement()
+	for _, p := range peers {
+		if p.GetPublicKey() != nil {
+			p.sendAgentMessage(CommandType_MAINTENANCE, announcement)
+		}
+	}
+}
+
+// announceMaintenance sends the maintenance window of this node to a peer
+// once both sides have authenticated, if there is any.
+func (agent *TCPAgent) announceMaintenance(p *TCPPeer) {
+	agent.Lock()
+	window := agent.maintenance[bdls.DefaultPubKeyToIdentity(&agent.privateKey.PublicKey)]
+	agent.Unlock()
+
+	if window != nil && time.Now().Before(window.end) {
+		p.sendAgentMessage(CommandType_MAINTENANCE, window.announcement())
+	}
+}
+
+// announcement returns the gossip message of the window, an empty one if nil
+func (window *maintenanceWindow) announcement() *MaintenanceWindow {
+	if window == nil {
+		return new(MaintenanceWindow)
+	}
+	return &MaintenanceWindow{Start: window.start.UnixNano(), End: window.end.UnixNano()}
+}
+
+// handleMaintenance records the maintenance window announced by a peer
+func (agent *TCPAgent) handleMaintenance(p *TCPPeer, m *MaintenanceWindow) {
+	key := p.GetPublicKey()
+	if key == nil {
+		return
+	}
+
+	id := bdls.DefaultPubKeyToIdentity(key)
+	agent.Lock()
+	defer agent.Unlock()
+	if m.End > m.Start {
+		agent.maintenance[id] = &maintenanceWindow{start: time.Unix(0, m.Start), end: time.Unix(0, m.End)}
+	} else {
+		delete(agent.maintenance, id)
+	}
+}
+
+// applyMaintenance hints the consensus about the validators in maintenance,
+// and removes the windows ended.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) applyMaintenance(now time.Time) {
+	for id, window := range agent.maintenance {
+		if !now.Before(window.end) {
+			delete(agent.maintenance, id)
+		} else if !now.Before(window.start.Add(-DefaultMaintenanceLead)) {
+			agent.consensus.LeaderGone(id)
+		}
+	}
+}
+
+// Maintenance returns the maintenance windows of this node and it's peers,
+// in order of start.
+func (agent *TCPAgent) Maintenance() []Maintenance {
+	agent.Lock()
+	defer agent.Unlock()
+
+	windows := make([]Maintenance, 0, len(agent.maintenance))
+	for id, window := range agent.maintenance {
+		windows = append(windows, Maintenance{Validator: hex.EncodeToString(id[:]), Start: window.start, End: window.end})
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Start.Before(windows[j].Start) })
+	return windows
+}
+
+// MaintenanceHandler serves the maintenance windows for the admin API, GET
+// returns them as json, POST schedules the window of this node from the
+// RFC3339 times in the query parameters "start" and "end", DELETE cancels it.
+func (agent *TCPAgent) MaintenanceHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			start, err := time.Parse(time.RFC3339, r.URL.Query().Get("start"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			end, err := time.Parse(time.RFC3339, r.URL.Query().Get("end"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := agent.ScheduleMaintenance(start, end); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			agent.CancelMaintenance()
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agent.Maintenance())
+	})
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestMaintenance(t *testing.T) {
+	key1, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	key2, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a1 := newTestAgent(t, key1)
+	defer a1.Close()
+	a2 := newTestAgent(t, key2)
+	defer a2.Close()
+
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	end := start.Add(time.Hour)
+	assert.Equal(t, ErrMaintenanceWindow, a1.ScheduleMaintenance(end, start))
+	assert.Nil(t, a1.ScheduleMaintenance(start, end))
+	id1 := bdls.DefaultPubKeyToIdentity(&key1.PublicKey)
+
+	// waitWindows waits for a2 to know n windows
+	waitWindows := func(n int) []Maintenance {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if windows := a2.Maintenance(); len(windows) == n {
+				return windows
+			}
+			<-time.After(10 * time.Millisecond)
+		}
+		return a2.Maintenance()
+	}
+
+	// announced to the peers connected later
+	c1, c2 := net.Pipe()
+	p1 := NewTCPPeer(c1, a1)
+	p2 := NewTCPPeer(c2, a2)
+	assert.True(t, a1.AddPeer(p1))
+	assert.True(t, a2.AddPeer(p2))
+	p1.InitiatePublicKeyAuthentication()
+	p2.InitiatePublicKeyAuthentication()
+	windows := waitWindows(1)
+	assert.Equal(t, 1, len(windows))
+	assert.Equal(t, hex.EncodeToString(id1[:]), windows[0].Validator)
+	assert.True(t, start.Equal(windows[0].Start))
+	assert.True(t, end.Equal(windows[0].End))
+
+	// cancelled
+	a1.CancelMaintenance()
+	assert.Equal(t, 0, len(waitWindows(0)))
+	assert.Equal(t, 0, len(a1.Maintenance()))
+
+	// ended windows are removed
+	assert.Nil(t, a1.ScheduleMaintenance(start, end))
+	assert.Equal(t, 1, len(waitWindows(1)))
+	a2.Lock()
+	a2.applyMaintenance(end)
+	a2.Unlock()
+	assert.Equal(t, 0, len(a2.Maintenance()))
+
+	// scheduled by the admin API
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	go http.Serve(l, a1.MaintenanceHandler())
+	url := "http://" + l.Addr().String()
+
+	resp, err := http.Post(url+"?start="+start.Format(time.RFC3339)+"&end="+end.Format(time.RFC3339), "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var served []Maintenance
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&served))
+	resp.Body.Close()
+	assert.Equal(t, 1, len(served))
+	assert.True(t, start.Equal(served[0].Start))
+
+	resp, err = http.Post(url+"?start=now", "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	assert.Nil(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+	assert.Equal(t, 0, len(a1.Maintenance()))
+}
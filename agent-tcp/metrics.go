@@ -0,0 +1,126 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsSink receives the telemetry of the transport, so operators can
+// export it to their own monitoring systems. The methods are called
+// synchronously from the I/O goroutines of the peers, sometimes with locks
+// held, so they must return quickly and must not call back into the agent.
+type MetricsSink interface {
+	// FrameSent is called for each frame written to a peer, n is the bytes
+	// on the wire, including the length prefix.
+	FrameSent(peer net.Addr, command CommandType, n int)
+
+	// FrameReceived is called for each frame read from a peer, n is the
+	// bytes on the wire, including the length prefix, before decompression.
+	FrameReceived(peer net.Addr, command CommandType, n int)
+
+	// HandshakeFailed is called once for a connection which failed to
+	// authenticate, or didn't authenticate in time.
+	HandshakeFailed(peer net.Addr, err error)
+
+	// QueueDepth is called when the messages pending to a peer are picked
+	// up for sending, with the number of consensus & agent messages queued.
+	QueueDepth(peer net.Addr, consensus int, agent int)
+
+	// ReceiveQueueDepth is called when the consensus messages received from
+	// all peers are picked up for processing, with the number queued.
+	ReceiveQueueDepth(n int)
+
+	// WriteLatency is called after each write of coalesced frames to a peer,
+	// with the bytes written and the time it took, on error too.
+	WriteLatency(peer net.Addr, n int, latency time.Duration)
+}
+
+// NopMetricsSink is a MetricsSink which discards everything, it can be
+// embedded to implement a subset of the methods.
+type NopMetricsSink struct{}
+
+func (NopMetricsSink) FrameSent(net.Addr, CommandType, int)      {}
+func (NopMetricsSink) FrameReceived(net.Addr, CommandType, int)  {}
+func (NopMetricsSink) HandshakeFailed(net.Addr, error)           {}
+func (NopMetricsSink) QueueDepth(net.Addr, int, int)             {}
+func (NopMetricsSink) ReceiveQueueDepth(int)                     {}
+func (NopMetricsSink) WriteLatency(net.Addr, int, time.Duration) {}
+
+// metricsSinkValue boxes a MetricsSink for atomic.Value, which requires
+// the same concrete type for all the values stored.
+type metricsSinkValue struct{ sink MetricsSink }
+
+// SetMetricsSink makes the agent report the telemetry of the transport to
+// sink, nil stops the reporting.
+func (agent *TCPAgent) SetMetricsSink(sink MetricsSink) {
+	agent.metricsSink.Store(metricsSinkValue{sink})
+}
+
+// getMetricsSink returns the sink of the telemetry, or nil if not set, it's
+// read without the lock.
+func (agent *TCPAgent) getMetricsSink() MetricsSink {
+	v, _ := agent.metricsSink.Load().(metricsSinkValue)
+	return v.sink
+}
+
+// reportHandshakeFailure reports the failed authentication of the peer to
+// the sink & the subscribers of peer events, only once for a connection
+// waited by several goroutines.
+func (p *TCPPeer) reportHandshakeFailure(err error) {
+	if !atomic.CompareAndSwapInt32(&p.handshakeFailed, 0, 1) {
+		return
+	}
+	if sink := p.agent.getMetricsSink(); sink != nil {
+		sink.HandshakeFailed(p.RemoteAddr(), err)
+	}
+	e := p.peerEvent(PeerHandshakeFailed)
+	e.Error = err.Error()
+	p.agent.publishPeerEvent(e)
+}
+
+// reportQueueDepth reports the number of messages pending to the peer
+func (p *TCPPeer) reportQueueDepth() {
+	sink := p.agent.getMetricsSink()
+	if sink == nil {
+		return
+	}
+	p.Lock()
+	consensus := 0
+	for lane := range p.lanes {
+		consensus += p.lanes[lane].len()
+	}
+	agent := len(p.agentMessages)
+	p.Unlock()
+	sink.QueueDepth(p.RemoteAddr(), consensus, agent)
+}
@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+// testMetricsSink records the telemetry reported by an agent
+type testMetricsSink struct {
+	NopMetricsSink
+	sent, received  map[CommandType]int
+	handshakeErrors []error
+	queueDepths     int
+	receiveDepths   int
+	writes, written int
+	sync.Mutex
+}
+
+func newTestMetricsSink() *testMetricsSink {
+	return &testMetricsSink{sent: make(map[CommandType]int), received: make(map[CommandType]int)}
+}
+
+func (s *testMetricsSink) FrameSent(peer net.Addr, command CommandType, n int) {
+	s.Lock()
+	defer s.Unlock()
+	s.sent[command] += n
+}
+
+func (s *testMetricsSink) FrameReceived(peer net.Addr, command CommandType, n int) {
+	s.Lock()
+	defer s.Unlock()
+	s.received[command] += n
+}
+
+func (s *testMetricsSink) HandshakeFailed(peer net.Addr, err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.handshakeErrors = append(s.handshakeErrors, err)
+}
+
+func (s *testMetricsSink) QueueDepth(peer net.Addr, consensus int, agent int) {
+	s.Lock()
+	defer s.Unlock()
+	s.queueDepths++
+}
+
+func (s *testMetricsSink) ReceiveQueueDepth(n int) {
+	s.Lock()
+	defer s.Unlock()
+	s.receiveDepths++
+}
+
+func (s *testMetricsSink) WriteLatency(peer net.Addr, n int, latency time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.writes++
+	s.written += n
+}
+
+func TestMetricsSink(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a := newTestAgent(t, keyA)
+	defer a.Close()
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+	sinkA, sinkB := newTestMetricsSink(), newTestMetricsSink()
+	a.SetMetricsSink(sinkA)
+	b.SetMetricsSink(sinkB)
+
+	c1, c2 := net.Pipe()
+	pa := NewTCPPeer(c1, a)
+	pb := NewTCPPeer(c2, b)
+	assert.True(t, a.AddPeer(pa))
+	assert.True(t, b.AddPeer(pb))
+	pa.InitiatePublicKeyAuthentication()
+	pb.InitiatePublicKeyAuthentication()
+	assert.Nil(t, a.waitAuthenticated(pa, &keyB.PublicKey, time.Second, nil))
+	assert.Nil(t, b.waitAuthenticated(pb, &keyA.PublicKey, time.Second, nil))
+
+	// a consensus message from a is queued to the consensus of b
+	m := &bdls.Message{Type: bdls.MessageType_RoundChange, Height: 1, Round: 1, State: []byte("metrics")}
+	sp := new(bdls.SignedProto)
+	sp.Sign(m, keyA)
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, pa.Send(bts))
+	pa.ping()
+
+	// the frames reported agree with the stats
+	assert.Eventually(t, func() bool {
+		sa, sb := a.Stats(), b.Stats()
+		sinkA.Lock()
+		defer sinkA.Unlock()
+		sinkB.Lock()
+		defer sinkB.Unlock()
+		sent, received := 0, 0
+		for _, n := range sinkA.sent {
+			sent += n
+		}
+		for _, n := range sinkB.received {
+			received += n
+		}
+		return sa.Commands["LATENCY_PONG"].ReceivedMessages == 1 &&
+			sinkB.receiveDepths > 0 &&
+			uint64(sent) == sa.SentBytes && uint64(received) == sb.ReceivedBytes &&
+			sa.SentBytes == sb.ReceivedBytes
+	}, time.Second, 10*time.Millisecond)
+
+	sinkA.Lock()
+	assert.Equal(t, int(a.Stats().Commands["CONSENSUS"].SentBytes), sinkA.sent[CommandType_CONSENSUS])
+	assert.Equal(t, int(a.Stats().SentBytes), sinkA.written)
+	assert.True(t, sinkA.writes > 0)
+	assert.True(t, sinkA.queueDepths > 0)
+	assert.Equal(t, 0, len(sinkA.handshakeErrors))
+	sinkA.Unlock()
+
+	// a connection not authenticating in time is reported once
+	c3, c4 := net.Pipe()
+	defer c4.Close()
+	pc := NewTCPPeer(c3, a, WithHandshakeTimeout(100*time.Millisecond))
+	<-pc.die
+	assert.Equal(t, ErrPeerAuthenticatedFailed, a.waitAuthenticated(pc, nil, time.Second, nil))
+	sinkA.Lock()
+	assert.Equal(t, []error{ErrHandshakeTimeout}, sinkA.handshakeErrors)
+	sinkA.Unlock()
+
+	// nil stops the reporting
+	a.SetMetricsSink(nil)
+	assert.Nil(t, a.getMetricsSink())
+}
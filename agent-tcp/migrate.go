@@ -0,0 +1,159 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"time"
+
+	"github.com/yonggewang/bdls"
+)
+
+const (
+	// DefaultMigrationTimeout is the default time the state of a closed
+	// peer is kept for the peer to reconnect
+	DefaultMigrationTimeout = 30 * time.Second
+)
+
+// peerState is the state of an authenticated peer which survives it's
+// connection, so a peer reconnecting from another address, e.g. after a
+// failover, will pick up where it left off.
+type peerState struct {
+	consensusMessages [][]byte         // pending outgoing consensus messages
+	replicaSubscribed bool             // the peer has subscribed to decisions
+	relay             *ReplicaRelay    // the relay announced in the subscription
+	validatorKey      *ecdsa.PublicKey // the validator key pinned by key linkage
+	expires           time.Time        // the state is dropped after this time
+}
+
+// SetMigrationTimeout sets the time the state of a closed peer is kept, a
+// peer which authenticates with the same key from any address in this time
+// adopts the state, 0 to disable.
+func (agent *TCPAgent) SetMigrationTimeout(timeout time.Duration) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.migrationTimeout = timeout
+	if timeout <= 0 {
+		agent.migrations = make(map[bdls.Identity]*peerState)
+	}
+}
+
+// saveState keeps the state of a closed peer for it to reconnect, must be
+// called with the agent lock held.
+func (agent *TCPAgent) saveState(p *TCPPeer) {
+	if agent.migrationTimeout <= 0 {
+		return
+	}
+
+	key := p.GetTransportPublicKey()
+	if key == nil {
+		return
+	}
+
+	state := p.detachState()
+	if state == nil {
+		return
+	}
+
+	now := time.Now()
+	for id, s := range agent.migrations {
+		if now.After(s.expires) {
+			delete(agent.migrations, id)
+		}
+	}
+	state.expires = now.Add(agent.migrationTimeout)
+	agent.migrations[bdls.DefaultPubKeyToIdentity(key)] = state
+}
+
+// restoreState hands the state kept for the peer's key over to a newly
+// authenticated peer.
+func (agent *TCPAgent) restoreState(p *TCPPeer) {
+	key := p.GetTransportPublicKey()
+	if key == nil {
+		return
+	}
+
+	id := bdls.DefaultPubKeyToIdentity(key)
+	agent.Lock()
+	state, ok := agent.migrations[id]
+	delete(agent.migrations, id)
+	agent.Unlock()
+
+	if ok && time.Now().Before(state.expires) {
+		p.adoptState(state)
+	}
+}
+
+// detachState moves the state out of this peer, it returns nil if the state
+// has been moved already.
+func (p *TCPPeer) detachState() *peerState {
+	p.Lock()
+	defer p.Unlock()
+	if p.migrated {
+		return nil
+	}
+	p.migrated = true
+
+	state := &peerState{
+		consensusMessages: p.takeConsensusMessages(),
+		replicaSubscribed: p.replicaSubscribed,
+		relay:             p.relay,
+		validatorKey:      p.peerValidatorKey,
+	}
+	return state
+}
+
+// adoptState merges the state of another connection of the same peer, the
+// adopted messages are sent before the messages of this connection. The
+// validator key is pinned if this connection has announced none.
+func (p *TCPPeer) adoptState(state *peerState) {
+	p.Lock()
+	defer p.Unlock()
+	if len(state.consensusMessages) > 0 {
+		pending := p.takeConsensusMessages()
+		for _, bts := range state.consensusMessages {
+			p.enqueueConsensusMessage(bts)
+		}
+		for _, bts := range pending {
+			p.enqueueConsensusMessage(bts)
+		}
+		p.notifyConsensusMessage()
+	}
+	if state.replicaSubscribed {
+		p.replicaSubscribed = true
+		if p.relay == nil {
+			p.relay = state.relay
+		}
+	}
+	if p.peerValidatorKey == nil {
+		p.peerValidatorKey = state.validatorKey
+	}
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestMigration(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+	lb, err := b.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+
+	// waitPeers waits for b to have n peers
+	waitPeers := func(n int) []*TCPPeer {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			b.Lock()
+			peers := append([]*TCPPeer(nil), b.peers...)
+			b.Unlock()
+			if len(peers) == n {
+				return peers
+			}
+			<-time.After(20 * time.Millisecond)
+		}
+		t.Fatal("timeout waiting for peers")
+		return nil
+	}
+
+	// connect returns the peer of b after a new process of a connected
+	connect := func() *TCPPeer {
+		a := newTestAgent(t, keyA)
+		t.Cleanup(a.Close)
+		_, err := a.Connect(context.Background(), lb.Addr().String(), &keyB.PublicKey)
+		assert.Nil(t, err)
+		peers := waitPeers(1)
+		return peers[0]
+	}
+
+	old := connect()
+	old.Lock()
+	old.replicaSubscribed = true
+	old.Unlock()
+
+	// the peer fails over to another address
+	old.Close()
+	waitPeers(0)
+	p := connect()
+	assert.NotEqual(t, old.RemoteAddr().String(), p.RemoteAddr().String())
+	p.Lock()
+	assert.True(t, p.replicaSubscribed)
+	p.Unlock()
+
+	// no state is kept with migration disabled
+	p.Close()
+	waitPeers(0)
+	b.SetMigrationTimeout(0)
+	p = connect()
+	p.Lock()
+	assert.False(t, p.replicaSubscribed)
+	p.Unlock()
+}
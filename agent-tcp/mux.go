@@ -0,0 +1,235 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/libp2p/go-yamux/v5"
+)
+
+// Channel is the kind of a stream of a multiplexed connection, it's sent
+// as the first byte of the stream.
+type Channel byte
+
+const (
+	// ChannelConsensus is the stream of the consensus & agent messages,
+	// opened first by the dialing side
+	ChannelConsensus Channel = iota
+	// ChannelStateSync is for transferring states to nodes catching up
+	ChannelStateSync
+	// ChannelAdmin is for operators' traffic
+	ChannelAdmin
+)
+
+// StreamHandler serves an inbound stream from an authenticated peer, the
+// stream is closed by the handler.
+type StreamHandler func(stream net.Conn, p *TCPPeer)
+
+// SetMux makes the connections accepted by Serve, dialed by Connect and to
+// persistent peers multiplexed by yamux, see NewMuxPeer. All nodes have to
+// enable it, as the sessions start from the first byte of the connection.
+func (agent *TCPAgent) SetMux(enable bool) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.mux = enable
+}
+
+// HandleStream sets the handler of the inbound streams of a channel from
+// multiplexed peers, streams of the channels without a handler are closed.
+func (agent *TCPAgent) HandleStream(ch Channel, handler StreamHandler) error {
+	if ch == ChannelConsensus {
+		return ErrChannelReserved
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.streamHandlers == nil {
+		agent.streamHandlers = make(map[Channel]StreamHandler)
+	}
+	agent.streamHandlers[ch] = handler
+	return nil
+}
+
+// NewPeer creates a TCPPeer over conn, multiplexed if SetMux is enabled,
+// outbound is set if the connection was dialed by this agent.
+func (agent *TCPAgent) NewPeer(conn net.Conn, outbound bool) (*TCPPeer, error) {
+	agent.Lock()
+	mux := agent.mux
+	agent.Unlock()
+	if mux {
+		return NewMuxPeer(conn, agent, outbound)
+	}
+
+	p := NewTCPPeer(conn, agent)
+	p.setDirection(outbound)
+	return p, nil
+}
+
+// NewMuxPeer starts a yamux session over conn, and creates a TCPPeer over
+// the consensus stream of it. The other channels share the connection as
+// separate streams with independent flow control, they're opened by
+// TCPPeer.OpenStream, and served by the handlers set by HandleStream once
+// the peer has authenticated. The dialing side is the client of the
+// session, which opens the consensus stream, the other side waits for it
+// up to the handshake timeout.
+func NewMuxPeer(conn net.Conn, agent *TCPAgent, outbound bool) (*TCPPeer, error) {
+	config := yamux.DefaultConfig()
+	config.EnableKeepAlive = false // keepalives of TCPPeer
+	config.LogOutput = io.Discard
+
+	timeout := agent.getHandshakeTimeout()
+	var session *yamux.Session
+	var stream *yamux.Stream
+	var err error
+	if outbound {
+		if session, err = yamux.Client(conn, config, nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if stream, err = session.OpenStream(ctx); err == nil {
+			_, err = stream.Write([]byte{byte(ChannelConsensus)})
+		}
+	} else {
+		if session, err = yamux.Server(conn, config, nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		timer := time.AfterFunc(timeout, func() { session.Close() })
+		if stream, err = session.AcceptStream(); err == nil {
+			var ch Channel
+			if ch, err = readChannel(stream, timeout); err == nil && ch != ChannelConsensus {
+				err = ErrChannelReserved
+			}
+		}
+		timer.Stop()
+	}
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	p := NewTCPPeer(stream, agent)
+	p.session = session
+	p.setDirection(outbound)
+	go p.serveStreams()
+	return p, nil
+}
+
+// readChannel reads the channel of an inbound stream
+func readChannel(stream net.Conn, timeout time.Duration) (Channel, error) {
+	var ch [1]byte
+	stream.SetReadDeadline(time.Now().Add(timeout))
+	defer stream.SetReadDeadline(time.Time{})
+	if _, err := io.ReadFull(stream, ch[:]); err != nil {
+		return 0, err
+	}
+	return Channel(ch[0]), nil
+}
+
+// serveStreams accepts the streams from the peer until the session is
+// closed, the session is closed along with the peer.
+func (p *TCPPeer) serveStreams() {
+	go func() {
+		<-p.die
+		p.session.Close()
+	}()
+
+	for {
+		stream, err := p.session.AcceptStream()
+		if err != nil {
+			p.Close()
+			return
+		}
+		go p.serveStream(stream)
+	}
+}
+
+// serveStream dispatches an inbound stream to the handler of it's channel
+func (p *TCPPeer) serveStream(stream net.Conn) {
+	timeout := p.agent.getHandshakeTimeout()
+	ch, err := readChannel(stream, timeout)
+	if err != nil {
+		stream.Close()
+		return
+	}
+
+	p.agent.Lock()
+	handler := p.agent.streamHandlers[ch]
+	p.agent.Unlock()
+	if handler == nil || ch == ChannelConsensus || p.agent.waitAuthenticated(p, nil, timeout, nil) != nil {
+		stream.Close()
+		return
+	}
+	// state sync waits for the voting path under overload
+	if ch == ChannelStateSync && !p.deferSync() {
+		stream.Close()
+		return
+	}
+	handler(stream, p)
+}
+
+// OpenStream opens a stream of the channel to a multiplexed peer, once the
+// peer has authenticated.
+func (p *TCPPeer) OpenStream(ctx context.Context, ch Channel) (net.Conn, error) {
+	if p.session == nil {
+		return nil, ErrNotMultiplexed
+	}
+	if ch == ChannelConsensus {
+		return nil, ErrChannelReserved
+	}
+
+	select {
+	case <-p.chAuthenticated:
+	case <-p.die:
+		return nil, ErrPeerAuthenticatedFailed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	stream, err := p.session.OpenStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stream.Write([]byte{byte(ch)}); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Multiplexed returns if the peer is over a yamux session
+func (p *TCPPeer) Multiplexed() bool { return p.session != nil }
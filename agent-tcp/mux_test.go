@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestMux(t *testing.T) {
+	key1, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	key2, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a1 := newTestAgent(t, key1)
+	defer a1.Close()
+	a2 := newTestAgent(t, key2)
+	defer a2.Close()
+
+	// state sync streams are echoed, admin streams have no handler
+	assert.Equal(t, ErrChannelReserved, a2.HandleStream(ChannelConsensus, nil))
+	assert.Nil(t, a2.HandleStream(ChannelStateSync, func(stream net.Conn, p *TCPPeer) {
+		defer stream.Close()
+		assert.NotNil(t, p.GetPublicKey())
+		io.Copy(stream, stream)
+	}))
+
+	c1, c2 := net.Pipe()
+	chPeer := make(chan *TCPPeer)
+	go func() {
+		p2, err := NewMuxPeer(c2, a2, false)
+		assert.Nil(t, err)
+		chPeer <- p2
+	}()
+	p1, err := NewMuxPeer(c1, a1, true)
+	assert.Nil(t, err)
+	p2 := <-chPeer
+	assert.True(t, p1.Multiplexed())
+	assert.True(t, a1.AddPeer(p1))
+	assert.True(t, a2.AddPeer(p2))
+	assert.Nil(t, p1.InitiatePublicKeyAuthentication())
+	assert.Nil(t, p2.InitiatePublicKeyAuthentication())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := p1.OpenStream(ctx, ChannelStateSync)
+	assert.Nil(t, err)
+	_, err = stream.Write([]byte("state"))
+	assert.Nil(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(stream, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("state"), buf)
+	assert.NotNil(t, p1.GetPublicKey())
+	assert.NotNil(t, p2.GetPublicKey())
+
+	stream.Close()
+
+	// the consensus stream keeps flowing while a stream is stalled, the
+	// echoes are not read
+	stalled, err := p1.OpenStream(ctx, ChannelStateSync)
+	assert.Nil(t, err)
+	go stalled.Write(make([]byte, 4<<20))
+	<-time.After(100 * time.Millisecond)
+	assert.Nil(t, p1.Send(make([]byte, 1024)))
+	assert.Eventually(t, func() bool { return a2.Stats().Commands["CONSENSUS"].ReceivedMessages > 0 }, 5*time.Second, 10*time.Millisecond)
+	stalled.Close()
+
+	admin, err := p1.OpenStream(ctx, ChannelAdmin)
+	assert.Nil(t, err)
+	_, err = admin.Read(buf)
+	assert.NotNil(t, err)
+	_, err = p1.OpenStream(ctx, ChannelConsensus)
+	assert.Equal(t, ErrChannelReserved, err)
+
+	// peers without a session
+	c3, _ := net.Pipe()
+	_, err = NewTCPPeer(c3, a1).OpenStream(ctx, ChannelStateSync)
+	assert.Equal(t, ErrNotMultiplexed, err)
+
+	// the session ends with the peer
+	p1.Close()
+	<-p2.die
+
+	// connections are multiplexed by Serve & Connect once enabled
+	a1.SetMux(true)
+	a2.SetMux(true)
+	l, err := a2.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	p, err := a1.Connect(ctx, l.Addr().String(), &key2.PublicKey)
+	assert.Nil(t, err)
+	assert.True(t, p.Multiplexed())
+	stream, err = p.OpenStream(ctx, ChannelStateSync)
+	assert.Nil(t, err)
+	defer stream.Close()
+	_, err = stream.Write([]byte("again"))
+	assert.Nil(t, err)
+	_, err = io.ReadFull(stream, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("again"), buf)
+}
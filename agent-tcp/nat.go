@@ -0,0 +1,373 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/transport"
+)
+
+const (
+	// the interval of the dial attempts of a hole punch
+	punchInterval = 200 * time.Millisecond
+	// the timeout of a dial attempt, the SYNs are dropped until the NAT of
+	// the other side has mapped it's own
+	punchDialTimeout = time.Second
+)
+
+// pendingPunch is a hole punch awaiting the address of the target from the
+// rendezvous
+type pendingPunch struct {
+	rendezvous *TCPPeer
+	chPunch    chan *Punch
+}
+
+// SetPunchPort makes the outbound TCP connections, and the hole punches,
+// originate from port, the port of a listener with port reuse, see
+// ListenNAT. Behind a NAT mapping a local port to the same public port for
+// every destination, the address the peers observe is then the one to punch
+// to. 0 dials from ephemeral ports.
+func (agent *TCPAgent) SetPunchPort(port int) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.punchPort = port
+}
+
+// ListenNAT is like Listen, but listens with port reuse, and sets the punch
+// port to the port listened on, so the node is reachable by hole punching.
+func (agent *TCPAgent) ListenNAT(addr string) (net.Listener, error) {
+	l, err := (&transport.TCP{ReusePort: true}).Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	agent.SetPunchPort(l.Addr().(*net.TCPAddr).Port)
+	go agent.serveMapped(l)
+	return l, nil
+}
+
+// punchTransport returns the transport dialing from the punch port, the
+// lock must be held. It's nil if no punch port is set.
+func (agent *TCPAgent) punchTransport() *transport.TCP {
+	if agent.punchPort == 0 {
+		return nil
+	}
+	return &transport.TCP{ReusePort: true, Dialer: net.Dialer{LocalAddr: &net.TCPAddr{Port: agent.punchPort}}}
+}
+
+// announceObservedAddr tells the peer the address it's connection comes
+// from, the peers of other transports have no address to discover.
+func (agent *TCPAgent) announceObservedAddr(p *TCPPeer) {
+	if addr, ok := p.conn.RemoteAddr().(*net.TCPAddr); ok {
+		p.sendAgentMessage(CommandType_OBSERVED_ADDR, &ObservedAddr{Addr: addr.String()})
+	}
+}
+
+// handleObservedAddr records the address of this agent observed by the peer
+func (p *TCPPeer) handleObservedAddr(m *ObservedAddr) {
+	if p.GetPublicKey() == nil {
+		return
+	}
+	if addr, err := net.ResolveTCPAddr("tcp", m.Addr); err != nil || addr.IP == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.observedAddr = m.Addr
+}
+
+// ObservedAddr returns the public address of this agent as observed by the
+// peers, like STUN does, the one reported by most of the peers, ties broken
+// by the order of addresses. Behind NAT it's the mapping of the local port
+// of the connections, empty if no peer has reported yet.
+func (agent *TCPAgent) ObservedAddr() string {
+	agent.Lock()
+	peers := append([]*TCPPeer(nil), agent.peers...)
+	agent.Unlock()
+
+	votes := make(map[string]int)
+	for _, p := range peers {
+		p.Lock()
+		if p.observedAddr != "" {
+			votes[p.observedAddr]++
+		}
+		p.Unlock()
+	}
+
+	var observed string
+	for addr, n := range votes {
+		if n > votes[observed] || (n == votes[observed] && addr < observed) {
+			observed = addr
+		}
+	}
+	return observed
+}
+
+// NATStatus is the NAT traversal status for the admin API
+type NATStatus struct {
+	ObservedAddr string   `json:"observed_addr"`
+	PunchPort    int      `json:"punch_port"`
+	MappedAddrs  []string `json:"mapped_addrs"` // the addresses mapped by the gateway
+}
+
+// NATHandler returns an http.Handler reporting the observed address, the
+// punch port and the port mappings of this agent as JSON.
+func (agent *TCPAgent) NATHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent.Lock()
+		status := NATStatus{PunchPort: agent.punchPort}
+		agent.Unlock()
+		status.ObservedAddr = agent.ObservedAddr()
+		status.MappedAddrs = agent.MappedAddrs()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+// Punch connects to the peer authenticating as target through NAT, with the
+// help of the rendezvous, a peer both sides are connected to. The rendezvous
+// tells each side the address of the other as it observes it, and both dial
+// each other simultaneously from their punch ports, so each NAT takes the
+// SYN of the other side as the reply to it's own. Both sides must have set a
+// punch port, and be behind NATs mapping it to the same public port for
+// every destination. If ctx has no deadline, Punch times out after the
+// handshake timeout.
+func (agent *TCPAgent) Punch(ctx context.Context, rendezvous *TCPPeer, target *ecdsa.PublicKey) (*TCPPeer, error) {
+	agent.Lock()
+	tr := agent.punchTransport()
+	agent.Unlock()
+	if tr == nil {
+		return nil, ErrNoPunchPort
+	}
+	if !commandSupported(rendezvous.ProtocolVersion(), CommandType_PUNCH) {
+		return nil, ErrProtocolVersion
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, agent.getHandshakeTimeout())
+		defer cancel()
+	}
+
+	id := bdls.DefaultPubKeyToIdentity(target)
+	nonce := rand.Uint64()
+	pending := &pendingPunch{rendezvous: rendezvous, chPunch: make(chan *Punch, 1)}
+	agent.Lock()
+	agent.punches[nonce] = pending
+	agent.Unlock()
+	defer func() {
+		agent.Lock()
+		delete(agent.punches, nonce)
+		agent.Unlock()
+	}()
+
+	rendezvous.sendAgentMessage(CommandType_PUNCH_REQUEST, &PunchRequest{Target: id[:], Nonce: nonce})
+
+	var punch *Punch
+	select {
+	case punch = <-pending.chPunch:
+	case <-rendezvous.die:
+		return nil, ErrPunchUnreachable
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-agent.die:
+		return nil, ErrAgentClosed
+	}
+	if len(punch.Identity) == 0 {
+		return nil, ErrPunchUnreachable
+	}
+	return agent.punch(ctx, tr, punch.Addr, id, true)
+}
+
+// handlePunchRequest coordinates a hole punch as the rendezvous, both sides
+// are told the address of the other, or the requester is told the target
+// can't be reached.
+func (agent *TCPAgent) handlePunchRequest(p *TCPPeer, m *PunchRequest) {
+	key := p.GetPublicKey()
+	if key == nil {
+		return
+	}
+	requester := bdls.DefaultPubKeyToIdentity(key)
+
+	agent.Lock()
+	peers := append([]*TCPPeer(nil), agent.peers...)
+	agent.Unlock()
+
+	var target *TCPPeer
+	for _, other := range peers {
+		if other == p {
+			continue
+		}
+		if key := other.GetPublicKey(); key != nil {
+			if id := bdls.DefaultPubKeyToIdentity(key); bytes.Equal(id[:], m.Target) {
+				target = other
+				break
+			}
+		}
+	}
+
+	requesterAddr, ok1 := p.conn.RemoteAddr().(*net.TCPAddr)
+	if target == nil || !ok1 || !commandSupported(target.ProtocolVersion(), CommandType_PUNCH) {
+		p.sendAgentMessage(CommandType_PUNCH, &Punch{Nonce: m.Nonce})
+		return
+	}
+	targetAddr, ok2 := target.conn.RemoteAddr().(*net.TCPAddr)
+	if !ok2 {
+		p.sendAgentMessage(CommandType_PUNCH, &Punch{Nonce: m.Nonce})
+		return
+	}
+
+	// the target is told first, it has the longer way to go
+	target.sendAgentMessage(CommandType_PUNCH, &Punch{Identity: requester[:], Addr: requesterAddr.String(), Nonce: m.Nonce})
+	p.sendAgentMessage(CommandType_PUNCH, &Punch{Identity: m.Target, Addr: targetAddr.String(), Nonce: m.Nonce})
+}
+
+// handlePunch receives the address to punch to from the rendezvous, either
+// for a hole punch of this agent, or one requested by another participant.
+func (agent *TCPAgent) handlePunch(p *TCPPeer, m *Punch) {
+	agent.Lock()
+	pending := agent.punches[m.Nonce]
+	if pending != nil && pending.rendezvous == p {
+		delete(agent.punches, m.Nonce)
+		agent.Unlock()
+		pending.chPunch <- m
+		return
+	}
+	tr := agent.punchTransport()
+	agent.Unlock()
+
+	// punch back only to the participants introduced by an authenticated
+	// peer, from the address the rendezvous observed
+	var id bdls.Identity
+	if tr == nil || p.GetPublicKey() == nil || len(m.Identity) != len(id) {
+		return
+	}
+	copy(id[:], m.Identity)
+	agent.Lock()
+	participant := agent.isParticipant(id)
+	agent.Unlock()
+	if !participant {
+		return
+	}
+	addr, err := net.ResolveTCPAddr("tcp", m.Addr)
+	if err != nil || addr.IP == nil || agent.hostBanned(addr.IP.String()) || !agent.permitsAddr(addr) {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), agent.getHandshakeTimeout())
+		defer cancel()
+		agent.punch(ctx, tr, m.Addr, id, false)
+	}()
+}
+
+// punch dials addr from the punch port until connected to the peer of id,
+// either by a dial, or by the dial of the other side, accepted by the
+// listener if it's SYN came before ours.
+func (agent *TCPAgent) punch(ctx context.Context, tr transport.Transport, addr string, id bdls.Identity, outbound bool) (*TCPPeer, error) {
+	ticker := time.NewTicker(punchInterval)
+	defer ticker.Stop()
+	for {
+		if p := agent.authenticatedPeer(id); p != nil {
+			return p, nil
+		}
+
+		dialCtx, cancel := context.WithTimeout(ctx, punchDialTimeout)
+		conn, err := tr.Dial(dialCtx, addr)
+		cancel()
+		if err == nil {
+			return agent.punched(ctx, conn, id, outbound)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-agent.die:
+			return nil, ErrAgentClosed
+		}
+	}
+}
+
+// punched authenticates the connection of a hole punch, the peer joins the
+// consensus once it has authenticated as id.
+func (agent *TCPAgent) punched(ctx context.Context, conn net.Conn, id bdls.Identity, outbound bool) (*TCPPeer, error) {
+	p, err := agent.NewPeer(conn, outbound)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.InitiatePublicKeyAuthentication(); err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	if err := agent.waitAuthenticated(p, nil, 0, ctx.Done()); err != nil {
+		p.Close()
+		if err == errHandshakeCanceled {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if bdls.DefaultPubKeyToIdentity(p.GetPublicKey()) != id {
+		p.Close()
+		return nil, ErrPeerPublicKeyMismatch
+	}
+
+	if !agent.AddPeer(p) {
+		p.Close()
+		return nil, ErrPeerJoin
+	}
+	return p, nil
+}
+
+// authenticatedPeer returns a connected peer authenticated as id, or nil
+func (agent *TCPAgent) authenticatedPeer(id bdls.Identity) *TCPPeer {
+	agent.Lock()
+	peers := append([]*TCPPeer(nil), agent.peers...)
+	agent.Unlock()
+
+	for _, p := range peers {
+		if key := p.GetPublicKey(); key != nil && bdls.DefaultPubKeyToIdentity(key) == id {
+			return p
+		}
+	}
+	return nil
+}
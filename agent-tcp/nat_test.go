@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestHolePunch(t *testing.T) {
+	// the sides of the punch are participants of the same consensus
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, key)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+	var agents []*TCPAgent
+	for i := 0; i < 3; i++ {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = keys[i]
+		config.Participants = participants
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		agent := NewTCPAgent(consensus, keys[i])
+		defer agent.Close()
+		agents = append(agents, agent)
+	}
+	a, b, rendezvous := agents[0], agents[1], agents[2]
+
+	la, err := a.ListenNAT("127.0.0.1:0")
+	assert.Nil(t, err)
+	_, err = b.ListenNAT("127.0.0.1:0")
+	assert.Nil(t, err)
+	lr, err := rendezvous.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	pa, err := a.Connect(ctx, lr.Addr().String(), &keys[2].PublicKey)
+	assert.Nil(t, err)
+	_, err = b.Connect(ctx, lr.Addr().String(), &keys[2].PublicKey)
+	assert.Nil(t, err)
+	// the rendezvous adds the peers on it's side of the handshakes
+	assert.Eventually(t, func() bool { return rendezvous.NumPeers() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// the connections originate from the punch port, as observed
+	assert.Eventually(t, func() bool { return a.ObservedAddr() == la.Addr().String() }, 5*time.Second, 10*time.Millisecond)
+	w := httptest.NewRecorder()
+	a.NATHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nat", nil))
+	var status NATStatus
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, la.Addr().String(), status.ObservedAddr)
+	assert.Equal(t, la.Addr().(*net.TCPAddr).Port, status.PunchPort)
+
+	// both sides dial each other, as introduced by the rendezvous
+	p, err := a.Punch(ctx, pa, &keys[1].PublicKey)
+	assert.Nil(t, err)
+	assert.Equal(t, bdls.DefaultPubKeyToIdentity(&keys[1].PublicKey), bdls.DefaultPubKeyToIdentity(p.GetPublicKey()))
+	assert.Eventually(t, func() bool { return b.authenticatedPeer(participants[0]) != nil }, 5*time.Second, 10*time.Millisecond)
+
+	// the target must be connected to the rendezvous
+	_, err = a.Punch(ctx, pa, &keys[3].PublicKey)
+	assert.Equal(t, ErrPunchUnreachable, err)
+
+	// no punch port to dial from
+	_, err = rendezvous.Punch(ctx, pa, &keys[1].PublicKey)
+	assert.Equal(t, ErrNoPunchPort, err)
+}
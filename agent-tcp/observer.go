@@ -0,0 +1,100 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+	"log"
+
+	"github.com/yonggewang/bdls"
+)
+
+// NewObserverAgent creates a TCPAgent for an observer, a node outside of
+// the validator set following the protocol read-only, like explorers and
+// monitoring nodes. It advertises FeatureObserver in the handshake, so the
+// validators stream it their decisions along with the consensus messages
+// once authenticated, and never take consensus messages from it.
+//
+// Like NewReplicaAgent, the consensus object is only used to verify the
+// messages and track the latest state, it must be configured with the same
+// participants as the validators, but it's PrivateKey doesn't have to be a
+// validator key. Peers of an observer agent will not join the consensus.
+// FeatureObserver must be kept if the features are set by SetFeatures.
+func NewObserverAgent(consensus Consensus, privateKey *ecdsa.PrivateKey, opts ...Option) *TCPAgent {
+	agent := NewReplicaAgent(consensus, privateKey, opts...)
+	agent.SetFeatures(append(append([]Feature(nil), defaultFeatures...), FeatureObserver)...)
+	return agent
+}
+
+// AllowObserver restricts the observers to the given public keys, any
+// authenticated peer can observe if no keys have been allowed.
+func (agent *TCPAgent) AllowObserver(pubkey *ecdsa.PublicKey) {
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.observerKeys == nil {
+		agent.observerKeys = make(map[bdls.Identity]bool)
+	}
+	agent.observerKeys[bdls.DefaultPubKeyToIdentity(pubkey)] = true
+}
+
+// Observer returns true if the peer has authenticated as an observer
+func (p *TCPPeer) Observer() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.peerAuthStatus == peerAuthenticated && p.peerFeature(FeatureObserver)
+}
+
+// acceptObserver streams the decisions to an observer once it has
+// authenticated, starting with the latest one, the observers not allowed
+// are closed. Standby nodes don't serve observers.
+func (agent *TCPAgent) acceptObserver(p *TCPPeer) {
+	if !p.Observer() {
+		return
+	}
+	pubkey := p.GetPublicKey()
+
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.replica {
+		return
+	}
+	if agent.observerKeys != nil && !agent.observerKeys[bdls.DefaultPubKeyToIdentity(pubkey)] {
+		log.Println(p.RemoteAddr(), ErrObserverNotAllowed)
+		p.Close()
+		return
+	}
+
+	var history [][]byte
+	if n := len(agent.decisions); n > 0 {
+		history = append(history, agent.decisions[n-1].bts)
+	}
+	p.subscribeDecisions(history)
+}
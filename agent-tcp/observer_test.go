@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestObserver(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	newConsensus := func(privateKey *ecdsa.PrivateKey) *bdls.Consensus {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = privateKey
+		config.Participants = coords
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		consensus.SetLatency(200 * time.Millisecond)
+		return consensus
+	}
+	connect := func(a1, a2 *TCPAgent) (*TCPPeer, *TCPPeer) {
+		c1, c2 := net.Pipe()
+		p1 := NewTCPPeer(c1, a1)
+		p2 := NewTCPPeer(c2, a2)
+		assert.True(t, a1.AddPeer(p1))
+		assert.True(t, a2.AddPeer(p2))
+		p1.InitiatePublicKeyAuthentication()
+		p2.InitiatePublicKeyAuthentication()
+		return p1, p2
+	}
+
+	agents := make([]*TCPAgent, len(participants))
+	for i := range participants {
+		agents[i] = NewTCPAgent(newConsensus(participants[i]), participants[i])
+		defer agents[i].Close()
+	}
+	for i := 0; i < len(agents); i++ {
+		for j := i + 1; j < len(agents); j++ {
+			connect(agents[i], agents[j])
+		}
+	}
+
+	// an observer follows a validator without being in the validator set
+	observerKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	observer := NewObserverAgent(newConsensus(observerKey), observerKey)
+	defer observer.Close()
+	agents[0].AllowObserver(&observerKey.PublicKey)
+	toValidator, toObserver := connect(observer, agents[0])
+	assert.Eventually(t, func() bool { return toObserver.Observer() && toObserver.MutuallyAuthenticated() }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, toValidator.Observer())
+
+	for i := range agents {
+		agents[i].Update()
+	}
+	deadline := time.Now().Add(20 * time.Second)
+	for time.Now().Before(deadline) {
+		if height, _, _ := observer.GetLatestState(); height >= 2 {
+			break
+		}
+		for i := range agents {
+			if h, _, _ := agents[i].GetLatestState(); h >= 2 {
+				continue
+			}
+			data := make([]byte, 1024)
+			io.ReadFull(rand.Reader, data)
+			agents[i].Propose(data)
+		}
+		<-time.After(50 * time.Millisecond)
+	}
+	height, _, _ := observer.GetLatestState()
+	assert.GreaterOrEqual(t, height, uint64(2))
+	stats := agents[0].Stats()
+	observers := 0
+	for _, ps := range stats.Peers {
+		if ps.Observer {
+			observers++
+		}
+	}
+	assert.Equal(t, 1, observers)
+
+	// the consensus messages from observers are ignored, instead of scored
+	outsider, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	sp := new(bdls.SignedProto)
+	sp.Sign(&bdls.Message{Type: bdls.MessageType_RoundChange}, outsider)
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	for i := 0; i < 2*DefaultBanThreshold/penaltyInvalidMessage; i++ {
+		toValidator.Send(bts)
+	}
+	<-time.After(200 * time.Millisecond)
+	assert.Equal(t, 0, len(agents[0].Bans()))
+	select {
+	case <-toObserver.die:
+		t.Fatal("the observer is closed")
+	default:
+	}
+
+	// the observers not allowed are closed
+	otherKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	other := NewObserverAgent(newConsensus(otherKey), otherKey)
+	defer other.Close()
+	_, toOther := connect(other, agents[0])
+	select {
+	case <-toOther.die:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the observer not allowed is not closed")
+	}
+}
@@ -0,0 +1,115 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import "time"
+
+const (
+	// default time to wait for the next frame before a connection is
+	// considered unresponsive, keepalives keep idle connections under it
+	defaultIdleTimeout = 60 * time.Second
+)
+
+// transportOptions are the knobs of the connections set by Options
+type transportOptions struct {
+	readTimeout      time.Duration // the deadline to read each chunk of a frame, plus the transfer time
+	writeTimeout     time.Duration // the deadline to write each chunk of frames, plus the transfer time
+	idleTimeout      time.Duration // the deadline to wait for the next frame
+	handshakeTimeout time.Duration // the time for peers to authenticate
+	maxFrameSize     int           // the max size of the frames sent & received, before sealing
+}
+
+// defaultTransportOptions returns the options of connections by default
+func defaultTransportOptions() transportOptions {
+	return transportOptions{
+		readTimeout:      defaultReadTimeout,
+		writeTimeout:     defaultWriteTimeout,
+		idleTimeout:      defaultIdleTimeout,
+		handshakeTimeout: defaultHandshakeTimeout,
+		maxFrameSize:     MaxMessageLength,
+	}
+}
+
+// An Option configures the connections of a TCPAgent created by NewTCPAgent,
+// or of a single TCPPeer created by NewTCPPeer, overriding the ones of it's
+// agent.
+type Option func(*transportOptions)
+
+// WithReadTimeout sets the deadline to read each chunk of a frame, it's
+// extended by the time to transfer the chunk at the min throughput, see
+// SetMinReadThroughput. Zero disables the deadline.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(o *transportOptions) { o.readTimeout = timeout }
+}
+
+// WithWriteTimeout sets the deadline to write each chunk of frames, it's
+// extended by the time to transfer the chunk at the min throughput, see
+// SetMinWriteThroughput. Zero disables the deadline.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(o *transportOptions) { o.writeTimeout = timeout }
+}
+
+// WithIdleTimeout sets the time to wait for the next frame, before the
+// connection is considered unresponsive and closed. It should be longer
+// than the keepalive interval, see SetKeepalive. Zero disables the deadline.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *transportOptions) { o.idleTimeout = timeout }
+}
+
+// WithHandshakeTimeout sets the time for peers to authenticate. Given to
+// NewTCPAgent, it's the timeout of the connections accepted & dialed by the
+// agent, like SetHandshakeTimeout. Given to NewTCPPeer, the peer is closed
+// if it hasn't authenticated in time.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(o *transportOptions) { o.handshakeTimeout = timeout }
+}
+
+// WithMaxFrameSize sets the max size of the frames sent & received, the
+// larger frames received are malformed, and the larger messages are not
+// sent. It's capped at MaxMessageLength, and the peers of a network should
+// share it.
+func WithMaxFrameSize(size int) Option {
+	return func(o *transportOptions) {
+		if size <= 0 || size > MaxMessageLength {
+			size = MaxMessageLength
+		}
+		o.maxFrameSize = size
+	}
+}
+
+// transportDeadline returns the deadline of an I/O operation with the
+// timeout & the time to transfer it, or no deadline if timeout is zero.
+func transportDeadline(timeout time.Duration, transfer time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout + transfer)
+}
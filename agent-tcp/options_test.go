@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestTransportOptions(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a := newTestAgent(t, keyA, WithMaxFrameSize(4096), WithHandshakeTimeout(time.Second))
+	defer a.Close()
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+	assert.Equal(t, 4096, a.getTransportOptions().maxFrameSize)
+	assert.Equal(t, time.Second, a.getHandshakeTimeout())
+	assert.Equal(t, MaxMessageLength, b.getTransportOptions().maxFrameSize)
+
+	c1, c2 := net.Pipe()
+	pa := NewTCPPeer(c1, a)
+	pb := NewTCPPeer(c2, b)
+	assert.True(t, a.AddPeer(pa))
+	assert.True(t, b.AddPeer(pb))
+	pa.InitiatePublicKeyAuthentication()
+	pb.InitiatePublicKeyAuthentication()
+	assert.Eventually(t, func() bool { return pa.MutuallyAuthenticated() && pb.MutuallyAuthenticated() }, 5*time.Second, 10*time.Millisecond)
+
+	// the larger messages are not sent
+	assert.Nil(t, pa.Send(make([]byte, 8192)))
+	<-time.After(200 * time.Millisecond)
+	select {
+	case <-pa.die:
+		t.Fatal("the peer is closed by a message too large to send")
+	default:
+	}
+
+	// the larger frames received are malformed
+	assert.Nil(t, pb.Send(make([]byte, 8192)))
+	select {
+	case <-pa.die:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the peer sending frames too large is not closed")
+	}
+
+	// the options of a peer override the agent's, the peers not
+	// authenticated in time are closed
+	c3, c4 := net.Pipe()
+	go io.Copy(io.Discard, c4)
+	defer c4.Close()
+	pc := NewTCPPeer(c3, a, WithHandshakeTimeout(100*time.Millisecond))
+	assert.Equal(t, 4096, pc.options.maxFrameSize)
+	select {
+	case <-pc.die:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the peer not authenticated is not closed")
+	}
+
+	// the peers sending nothing are closed after the idle timeout
+	c5, c6 := net.Pipe()
+	go io.Copy(io.Discard, c6)
+	defer c6.Close()
+	pd := NewTCPPeer(c5, a, WithIdleTimeout(100*time.Millisecond))
+	assert.Equal(t, 100*time.Millisecond, pd.options.idleTimeout)
+	select {
+	case <-pd.die:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the idle peer is not closed")
+	}
+}
@@ -0,0 +1,101 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultCoverInterval is the default mean interval of the cover NOPs
+	// sent to each peer with padding enabled
+	DefaultCoverInterval = 2 * time.Second
+
+	// minPaddingBucket is the smallest size of padded frames, the sizes
+	// double up to the max frame size
+	minPaddingBucket = 256
+
+	// paddingKey is the key of the Padding field of Gossip, in bytes wire
+	paddingKey = 4<<3 | 2
+)
+
+// SetPadding pads the sealed frames sent to the peers connected afterwards,
+// to sizes of powers of two, and sends sealed NOPs to them at random
+// intervals averaging coverInterval, so observers of the encrypted traffic
+// can't tell the messages of a round apart by size, nor the progress of
+// rounds by silence. 0 coverInterval disables the cover traffic. The
+// plaintext frames of sessions not encrypted are never padded, the peers
+// ignore the padding and needn't enable it. Disabled by default.
+func (agent *TCPAgent) SetPadding(enable bool, coverInterval time.Duration) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.padding = enable
+	agent.coverInterval = coverInterval
+}
+
+// getPadding returns the settings of SetPadding
+func (agent *TCPAgent) getPadding() (bool, time.Duration) {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.padding, agent.coverInterval
+}
+
+// padFrame appends the Padding field to a marshalled Gossip, so it fills
+// the smallest size bucket it fits in, the frames beyond the last bucket
+// under maxFrameSize are returned as they are.
+func padFrame(frame []byte, maxFrameSize int) []byte {
+	var varint [binary.MaxVarintLen64]byte
+	for bucket := minPaddingBucket; bucket <= maxFrameSize; bucket *= 2 {
+		// the padding & it's length prefix fill the room left after the key
+		room := bucket - len(frame) - 1
+		for size := 1; size <= binary.MaxVarintLen64 && size <= room; size++ {
+			n := room - size
+			if binary.PutUvarint(varint[:], uint64(n)) != size {
+				continue
+			}
+			padded := make([]byte, bucket)
+			k := copy(padded, frame)
+			padded[k] = paddingKey
+			copy(padded[k+1:], varint[:size])
+			return padded
+		}
+	}
+	return frame
+}
+
+// coverDelay returns the random delay of the next cover NOP, exponentially
+// distributed around the mean, so the NOPs are not told apart from the
+// messages by their timing.
+func coverDelay(mean time.Duration) time.Duration {
+	return time.Duration(rand.ExpFloat64() * float64(mean))
+}
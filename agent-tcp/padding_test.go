@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestPadding(t *testing.T) {
+	// frames are padded to the smallest bucket they fit in
+	for _, size := range []int{0, 100, 250, 251, 252, 253, 254, 255, 256, 1000, 70000} {
+		frame, err := proto.Marshal(&Gossip{Command: CommandType_CONSENSUS, Message: make([]byte, size)})
+		assert.Nil(t, err)
+		padded := padFrame(frame, MaxMessageLength)
+		assert.GreaterOrEqual(t, len(padded), len(frame)+2)
+		if len(padded) > minPaddingBucket {
+			assert.Less(t, len(padded)/2, len(frame)+2)
+		}
+		assert.Equal(t, 0, len(padded)&(len(padded)-1), "size %v", len(padded))
+
+		var g Gossip
+		assert.Nil(t, proto.Unmarshal(padded, &g))
+		assert.Equal(t, CommandType_CONSENSUS, g.Command)
+		assert.Equal(t, size, len(g.Message))
+	}
+
+	// the sealed frames sent by a padding agent fill the buckets, and cover
+	// NOPs are sent while idle
+	newAgent := func() *TCPAgent {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		agent := newTestAgent(t, key)
+		t.Cleanup(func() { agent.Close() })
+		return agent
+	}
+	a1, a2 := newAgent(), newAgent()
+	a1.SetPadding(true, 20*time.Millisecond)
+	c1, c2 := net.Pipe()
+	rec := &recordConn{Conn: c1}
+	p1 := NewTCPPeer(rec, a1)
+	p2 := NewTCPPeer(c2, a2)
+	assert.True(t, a1.AddPeer(p1))
+	assert.True(t, a2.AddPeer(p2))
+	p1.InitiatePublicKeyAuthentication()
+	p2.InitiatePublicKeyAuthentication()
+	assert.Eventually(t, func() bool { return p1.SessionEncrypted() && p2.SessionEncrypted() }, 5*time.Second, 10*time.Millisecond)
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	assert.Nil(t, a1.ScheduleMaintenance(start, start.Add(time.Hour)))
+	assert.Eventually(t, func() bool { return len(a2.Maintenance()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	nops := func() uint64 {
+		_, commands := p2.traffic.snapshot()
+		return commands[CommandType_NOP.String()].ReceivedMessages
+	}
+	received := nops()
+	assert.Eventually(t, func() bool { return nops() >= received+3 }, 5*time.Second, 10*time.Millisecond)
+
+	written := rec.bytes()
+	sealed := 0
+	for len(written) >= MessageLength {
+		length := int(binary.LittleEndian.Uint32(written))
+		frame := written[MessageLength : MessageLength+length]
+		written = written[MessageLength+length:]
+
+		var g Gossip
+		assert.Nil(t, proto.Unmarshal(frame, &g))
+		if g.Command == CommandType_SEALED {
+			size := len(g.Message) - 16 // the tag of AES-GCM
+			assert.Equal(t, 0, size&(size-1), "size %v", size)
+			assert.GreaterOrEqual(t, size, minPaddingBucket)
+			sealed++
+		}
+	}
+	assert.Greater(t, sealed, 3)
+}
@@ -0,0 +1,163 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/net/nat"
+)
+
+const (
+	// the time to wait for the gateway to map a port on Listen
+	portMappingTimeout = 10 * time.Second
+)
+
+// PortMapper maps ports of the gateway to local ones, the mappings are
+// renewed until removed, see SetPortMapper.
+type PortMapper interface {
+	// AddMapping maps a local port of the protocol, "tcp" or "udp"
+	AddMapping(ctx context.Context, protocol string, port int) error
+	// GetMapping returns the external address of a local port mapped
+	GetMapping(protocol string, port int) (netip.AddrPort, bool)
+	// RemoveMapping removes the mapping of a local port
+	RemoveMapping(ctx context.Context, protocol string, port int) error
+	// Close removes all mappings
+	Close() error
+}
+
+// DiscoverPortMapper discovers the gateway of the local network by UPnP
+// and NAT-PMP, it fails if there is none, or the gateway supports neither.
+func DiscoverPortMapper(ctx context.Context) (PortMapper, error) {
+	return nat.DiscoverNAT(ctx)
+}
+
+// SetPortMapper makes Listen & ListenNAT map the ports listened on by the
+// gateway of mapper, e.g. found by DiscoverPortMapper, so nodes behind a
+// home router are reachable without forwarding the ports manually. The
+// mappings are removed once the listeners are closed, the mapper is closed
+// by the caller. nil stops mapping the ports listened afterwards.
+func (agent *TCPAgent) SetPortMapper(mapper PortMapper) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.portMapper = mapper
+}
+
+// getPortMapper returns the mapper set by SetPortMapper
+func (agent *TCPAgent) getPortMapper() PortMapper {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.portMapper
+}
+
+// MapPort maps a local TCP port by the port mapper, it blocks until the
+// gateway has replied, or ctx is done. The mapping is renewed until
+// UnmapPort.
+func (agent *TCPAgent) MapPort(ctx context.Context, port int) error {
+	mapper := agent.getPortMapper()
+	if mapper == nil {
+		return ErrNoPortMapper
+	}
+	if err := mapper.AddMapping(ctx, "tcp", port); err != nil {
+		return err
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	agent.mappedPorts[port] = mapper
+	return nil
+}
+
+// UnmapPort removes the mapping of a local TCP port
+func (agent *TCPAgent) UnmapPort(ctx context.Context, port int) error {
+	agent.Lock()
+	mapper := agent.mappedPorts[port]
+	delete(agent.mappedPorts, port)
+	agent.Unlock()
+	if mapper == nil {
+		return nil
+	}
+	return mapper.RemoveMapping(ctx, "tcp", port)
+}
+
+// MappedAddrs returns the external addresses of the ports mapped by the
+// gateway, the gateway may not have mapped some yet, or may have failed to.
+func (agent *TCPAgent) MappedAddrs() []string {
+	agent.Lock()
+	mapped := make(map[int]PortMapper, len(agent.mappedPorts))
+	for port, mapper := range agent.mappedPorts {
+		mapped[port] = mapper
+	}
+	agent.Unlock()
+
+	var addrs []string
+	for port, mapper := range mapped {
+		if addr, ok := mapper.GetMapping("tcp", port); ok {
+			addrs = append(addrs, addr.String())
+		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// serveMapped serves l, with it's port mapped by the port mapper if set,
+// the mapping is removed once l is closed.
+func (agent *TCPAgent) serveMapped(l net.Listener) {
+	if agent.getPortMapper() == nil {
+		agent.Serve(l)
+		return
+	}
+
+	// connections are accepted while the gateway maps the port
+	port := l.Addr().(*net.TCPAddr).Port
+	mapped := make(chan bool, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), portMappingTimeout)
+		defer cancel()
+		err := agent.MapPort(ctx, port)
+		if err != nil {
+			log.Println("port mapping:", err)
+		}
+		mapped <- err == nil
+	}()
+
+	agent.Serve(l)
+	if <-mapped {
+		ctx, cancel := context.WithTimeout(context.Background(), portMappingTimeout)
+		defer cancel()
+		agent.UnmapPort(ctx, port)
+	}
+}
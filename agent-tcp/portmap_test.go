@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+// fakePortMapper maps the ports to the ones 10000 above on 203.0.113.7
+type fakePortMapper struct {
+	sync.Mutex
+	ports map[int]bool
+}
+
+func (m *fakePortMapper) AddMapping(ctx context.Context, protocol string, port int) error {
+	m.Lock()
+	defer m.Unlock()
+	m.ports[port] = true
+	return nil
+}
+
+func (m *fakePortMapper) GetMapping(protocol string, port int) (netip.AddrPort, bool) {
+	m.Lock()
+	defer m.Unlock()
+	if !m.ports[port] {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(netip.MustParseAddr("203.0.113.7"), uint16(port+10000)), true
+}
+
+func (m *fakePortMapper) RemoveMapping(ctx context.Context, protocol string, port int) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.ports, port)
+	return nil
+}
+
+func (m *fakePortMapper) Close() error { return nil }
+
+func (m *fakePortMapper) mapped() int {
+	m.Lock()
+	defer m.Unlock()
+	return len(m.ports)
+}
+
+func TestPortMapping(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	agent := newTestAgent(t, key)
+	defer agent.Close()
+	assert.Equal(t, ErrNoPortMapper, agent.MapPort(context.Background(), 4680))
+
+	// the ports listened on are mapped by the gateway
+	mapper := &fakePortMapper{ports: make(map[int]bool)}
+	agent.SetPortMapper(mapper)
+	l, err := agent.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	expected := "203.0.113.7:" + strconv.Itoa(port+10000)
+	assert.Eventually(t, func() bool { return len(agent.MappedAddrs()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{expected}, agent.MappedAddrs())
+
+	w := httptest.NewRecorder()
+	agent.NATHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nat", nil))
+	var status NATStatus
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, []string{expected}, status.MappedAddrs)
+
+	// removed once the listener is closed
+	l.Close()
+	assert.Eventually(t, func() bool { return mapper.mapped() == 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, agent.MappedAddrs())
+}
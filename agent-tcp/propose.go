@@ -0,0 +1,128 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+const (
+	// DefaultMaxProposalSize is the default max size of a streamed proposal,
+	// well below MaxMessageLength, as the proofs carry copies of the state.
+	DefaultMaxProposalSize = 4 * 1024 * 1024
+
+	// the size of chunks to read a streamed proposal
+	proposalChunkSize = 64 * 1024
+)
+
+// ProposalReceipt is the result of a streamed proposal
+type ProposalReceipt struct {
+	Hash string `json:"hash"` // hex encoded StateHash of the state, as in the proofs
+	Size int    `json:"size"`
+}
+
+// ProposeReader assembles a state from r in chunks and proposes it, the
+// size is checked on every chunk, so it fails with ErrProposalTooLarge as
+// soon as maxSize is exceeded without reading the rest, or ErrProposalEmpty
+// if r has nothing. The receipt carries the hash of the state by the
+// consensus, to be matched with the decisions. maxSize <= 0 means
+// DefaultMaxProposalSize.
+func (agent *TCPAgent) ProposeReader(r io.Reader, maxSize int) (*ProposalReceipt, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxProposalSize
+	}
+
+	var state []byte
+	chunk := make([]byte, proposalChunkSize)
+	for {
+		n, err := r.Read(chunk)
+		if len(state)+n > maxSize {
+			return nil, ErrProposalTooLarge
+		}
+		state = append(state, chunk[:n]...)
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(state) == 0 {
+		return nil, ErrProposalEmpty
+	}
+
+	if err := agent.Propose(state); err != nil {
+		return nil, err
+	}
+	agent.Lock()
+	hash := agent.consensus.StateHash(state)
+	agent.Unlock()
+	return &ProposalReceipt{Hash: hex.EncodeToString(hash[:]), Size: len(state)}, nil
+}
+
+// ProposeHandler accepts proposals streamed in the body of POST requests,
+// e.g. with chunked transfer encoding, for the admin API. It replies the
+// ProposalReceipt as json, or 413 if the proposal exceeds maxSize.
+func (agent *TCPAgent) ProposeHandler(maxSize int) http.Handler {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxProposalSize
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		// reject early if the size is known
+		if r.ContentLength > int64(maxSize) {
+			http.Error(w, ErrProposalTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		receipt, err := agent.ProposeReader(r.Body, maxSize)
+		if err == ErrProposalTooLarge {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(receipt)
+	})
+}
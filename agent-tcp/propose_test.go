@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	io "io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/codec"
+	"github.com/yonggewang/bdls/crypto/blake2b"
+)
+
+// endlessReader counts the bytes read from it
+type endlessReader struct{ n int }
+
+func (r *endlessReader) Read(b []byte) (int, error) {
+	r.n += len(b)
+	return len(b), nil
+}
+
+func TestProposeHandler(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	agent := newTestAgent(t, key)
+	defer agent.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	go http.Serve(l, agent.ProposeHandler(1024*1024))
+	url := "http://" + l.Addr().String()
+
+	// streamed in chunks of unknown length
+	state := make([]byte, 300*1024)
+	io.ReadFull(rand.Reader, state)
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < len(state); i += 1000 {
+			end := i + 1000
+			if end > len(state) {
+				end = len(state)
+			}
+			pw.Write(state[i:end])
+		}
+		pw.Close()
+	}()
+	resp, err := http.Post(url, "application/octet-stream", pr)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var receipt ProposalReceipt
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&receipt))
+	resp.Body.Close()
+	hash := blake2b.Sum256(state)
+	assert.Equal(t, hex.EncodeToString(hash[:]), receipt.Hash)
+	assert.Equal(t, len(state), receipt.Size)
+
+	// too large
+	resp, err = http.Post(url, "application/octet-stream", bytes.NewReader(make([]byte, 1024*1024+1)))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = http.Get(url)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	resp.Body.Close()
+
+	// nothing to propose
+	resp, err = http.Post(url, "application/octet-stream", bytes.NewReader(nil))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp.Body.Close()
+	_, err = agent.ProposeReader(bytes.NewReader(nil), 1024*1024)
+	assert.Equal(t, ErrProposalEmpty, err)
+
+	// the limit is checked progressively
+	r := new(endlessReader)
+	_, err = agent.ProposeReader(r, 1024*1024)
+	assert.Equal(t, ErrProposalTooLarge, err)
+	assert.LessOrEqual(t, r.n, 1024*1024+proposalChunkSize)
+}
+
+func TestProposeValue(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	agent := newTestAgent(t, key)
+	defer agent.Close()
+
+	type transfer struct{ Amount uint64 }
+	assert.Nil(t, agent.ProposeValue(codec.JSON, &transfer{42}))
+	s, err := codec.Encode(codec.JSON, &transfer{42})
+	assert.Nil(t, err)
+	agent.Lock()
+	assert.True(t, agent.consensus.HasProposed(s))
+	agent.Unlock()
+
+	// decoded from the decision with the codec it's tagged with
+	var v transfer
+	d := &Decision{Height: 1, State: s}
+	assert.Nil(t, d.Decode(&v))
+	assert.Equal(t, uint64(42), v.Amount)
+	assert.Equal(t, codec.ErrPayload, (&Decision{}).Decode(&v))
+}
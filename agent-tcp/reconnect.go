@@ -0,0 +1,224 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/yonggewang/bdls/transport"
+)
+
+const (
+	// timeout to dial a persistent peer
+	defaultDialTimeout = 10 * time.Second
+)
+
+// DialFunc connects to a peer at addr, it allows persistent peers over any
+// transport providing a net.Conn.
+type DialFunc func(addr string) (net.Conn, error)
+
+// BackoffConfig is the jittered exponential backoff to re-dial dropped
+// persistent peers.
+type BackoffConfig struct {
+	Initial    time.Duration // the delay after the first failure
+	Max        time.Duration // the max delay
+	Multiplier float64       // the factor to grow the delay on each failure
+	Jitter     float64       // the delay is randomized by ±Jitter, in [0, 1]
+}
+
+// DefaultBackoffConfig returns the default backoff for persistent peers
+func DefaultBackoffConfig() *BackoffConfig {
+	return &BackoffConfig{
+		Initial:    time.Second,
+		Max:        time.Minute,
+		Multiplier: 2,
+		Jitter:     0.2,
+	}
+}
+
+// delay returns the delay before the n-th retry, starting from 0
+func (b *BackoffConfig) delay(n int) time.Duration {
+	d := float64(b.Initial) * math.Pow(b.Multiplier, float64(n))
+	if d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	d *= 1 + b.Jitter*(2*rand.Float64()-1)
+	return time.Duration(d)
+}
+
+// persistentPeer is an outbound peer address owned by the agent
+type persistentPeer struct {
+	addr     string
+	dial     DialFunc
+	expected *ecdsa.PublicKey // (optional) the identity the peer must authenticate
+	static   *StaticPeer      // the entry if the peer is managed by SetStaticPeers
+	die      chan struct{}    // closed when removed
+}
+
+// SetBackoff sets the backoff to re-dial persistent peers, it takes effect
+// on the next failure.
+func (agent *TCPAgent) SetBackoff(config *BackoffConfig) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.backoff = config
+}
+
+// AddPersistentPeer makes the agent own the outbound connection to addr,
+// the address will be dialed by dial, or the transport set by SetDialer if
+// it's nil, and re-dialed with backoff whenever the connection drops. Each
+// connection runs the key authentication, and the consensus messages not yet
+// sent on the dropped connection will be delivered on the new one.
+func (agent *TCPAgent) AddPersistentPeer(addr string, dial DialFunc) bool {
+	return agent.addPersistentPeer(addr, dial, nil, nil)
+}
+
+// addPersistentPeer adds a persistent peer, which must authenticate as
+// expected before joining the consensus if expected is not nil.
+func (agent *TCPAgent) addPersistentPeer(addr string, dial DialFunc, expected *ecdsa.PublicKey, static *StaticPeer) bool {
+	if dial == nil {
+		dial = agent.dialTransport(nil)
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	select {
+	case <-agent.die:
+		return false
+	default:
+	}
+
+	if _, ok := agent.persistentPeers[addr]; ok {
+		return false
+	}
+
+	pp := &persistentPeer{addr: addr, dial: dial, expected: expected, static: static, die: make(chan struct{})}
+	agent.persistentPeers[addr] = pp
+	go agent.persistentLoop(pp)
+	return true
+}
+
+// RemovePersistentPeer stops re-dialing addr and closes it's connection
+func (agent *TCPAgent) RemovePersistentPeer(addr string) bool {
+	agent.Lock()
+	defer agent.Unlock()
+	pp, ok := agent.persistentPeers[addr]
+	if ok {
+		delete(agent.persistentPeers, addr)
+		close(pp.die)
+	}
+	return ok
+}
+
+// getBackoff returns the backoff config
+func (agent *TCPAgent) getBackoff() *BackoffConfig {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.backoff
+}
+
+// dialTransport returns a DialFunc dialing with tr, or the transport set by
+// SetDialer if tr is nil.
+func (agent *TCPAgent) dialTransport(tr transport.Transport) DialFunc {
+	return func(addr string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultDialTimeout)
+		defer cancel()
+		if tr == nil {
+			return agent.getDialer().Dial(ctx, addr)
+		}
+		return tr.Dial(ctx, addr)
+	}
+}
+
+// persistentLoop keeps a connection to a persistent peer
+func (agent *TCPAgent) persistentLoop(pp *persistentPeer) {
+	var pending [][]byte // consensus messages left by the dropped connection
+	failures := 0
+
+	for {
+		var p *TCPPeer
+		conn, err := pp.dial(pp.addr)
+		if err == nil {
+			p, err = agent.NewPeer(conn, true)
+		}
+		if err == nil {
+			if pp.expected == nil {
+				if !agent.AddPeer(p) {
+					p.Close()
+				}
+				p.InitiatePublicKeyAuthentication()
+			} else {
+				// join after the identity has been verified
+				p.InitiatePublicKeyAuthentication()
+				if agent.waitAuthenticated(p, pp.expected, agent.getHandshakeTimeout(), pp.die) != nil || !agent.AddPeer(p) {
+					p.Close()
+				}
+			}
+
+			for _, bts := range pending {
+				p.Send(bts)
+			}
+			pending = nil
+
+			connected := time.Now()
+			select {
+			case <-p.die:
+				// a connection lasted longer than the max delay is
+				// considered to be recovered
+				if time.Since(connected) > agent.getBackoff().Max {
+					failures = 0
+				}
+			case <-pp.die:
+				p.Close()
+				return
+			case <-agent.die:
+				return
+			}
+
+			p.Lock()
+			pending = append(pending, p.takeConsensusMessages()...)
+			p.Unlock()
+		}
+
+		select {
+		case <-time.After(agent.getBackoff().delay(failures)):
+			failures++
+		case <-pp.die:
+			return
+		case <-agent.die:
+			return
+		}
+	}
+}
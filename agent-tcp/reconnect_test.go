@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := &BackoffConfig{Initial: time.Second, Max: 10 * time.Second, Multiplier: 2}
+	assert.Equal(t, time.Second, b.delay(0))
+	assert.Equal(t, 4*time.Second, b.delay(2))
+	assert.Equal(t, 10*time.Second, b.delay(10))
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.delay(1)
+		assert.True(t, d >= time.Second && d <= 3*time.Second)
+	}
+}
+
+func TestPersistentPeer(t *testing.T) {
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	clientKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+	client := newTestAgent(t, clientKey)
+	defer client.Close()
+	client.SetBackoff(&BackoffConfig{Initial: 10 * time.Millisecond, Max: 100 * time.Millisecond, Multiplier: 2})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+
+	chPeers := make(chan *TCPPeer)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			p := NewTCPPeer(conn, server)
+			server.AddPeer(p)
+			p.InitiatePublicKeyAuthentication()
+			chPeers <- p
+		}
+	}()
+
+	// authenticated is the client's peer once it has been authenticated by server
+	authenticated := func(p *TCPPeer) bool {
+		deadline := time.Now().Add(5 * time.Second)
+		for p.GetPublicKey() == nil && time.Now().Before(deadline) {
+			<-time.After(20 * time.Millisecond)
+		}
+		return p.GetPublicKey() != nil
+	}
+
+	assert.True(t, client.AddPersistentPeer(l.Addr().String(), nil))
+	assert.False(t, client.AddPersistentPeer(l.Addr().String(), nil))
+
+	p := <-chPeers
+	assert.True(t, authenticated(p))
+	assert.Equal(t, &clientKey.PublicKey, p.GetPublicKey())
+
+	// connection drops, the client re-dials and authenticates again
+	p.Close()
+	select {
+	case p = <-chPeers:
+	case <-time.After(5 * time.Second):
+		t.Fatal("persistent peer not re-dialed")
+	}
+	assert.True(t, authenticated(p))
+
+	// no more re-dials after removal
+	assert.True(t, client.RemovePersistentPeer(l.Addr().String()))
+	select {
+	case <-chPeers:
+		t.Fatal("removed persistent peer re-dialed")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
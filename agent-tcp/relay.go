@@ -0,0 +1,160 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// SetMaxReplicas limits the number of standby nodes served directly, the
+// standby nodes beyond it are redirected to the relays among the subscribed
+// ones, so the primary isn't the bandwidth source for every downstream node.
+// 0 means no limit.
+func (agent *TCPAgent) SetMaxReplicas(n int) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.maxReplicas = n
+}
+
+// SetRelay makes this standby node announce in it's subscriptions that it
+// re-serves the decisions at addr, for up to capacity standby nodes, so the
+// primaries could redirect other standby nodes to it. The relay must Serve
+// at addr, the standby nodes beyond capacity are redirected further down to
+// it's own relays. An empty addr stops announcing.
+func (agent *TCPAgent) SetRelay(addr string, capacity int) {
+	agent.Lock()
+	defer agent.Unlock()
+	if addr == "" {
+		agent.relay = nil
+		agent.maxReplicas = 0
+		return
+	}
+	agent.relay = &ReplicaRelay{Addr: addr, Weight: uint32(capacity)}
+	agent.maxReplicas = capacity
+}
+
+// getRelay returns the relay announced by this agent, or nil if there is
+// none or the relay feature is not active.
+func (agent *TCPAgent) getRelay() *ReplicaRelay {
+	if !agent.FeatureActive(FeatureRelay) {
+		return nil
+	}
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.relay
+}
+
+// replicaFull checks if a new standby node exceeds the max replicas, the
+// relays to redirect to are returned in that case.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) replicaFull(p *TCPPeer) (full bool, relays []*ReplicaRelay) {
+	if agent.maxReplicas <= 0 {
+		return false, nil
+	}
+
+	var subscribed int
+	relaying := agent.FeatureActive(FeatureRelay)
+	for _, peer := range agent.peers {
+		peer.Lock()
+		if peer.replicaSubscribed {
+			if peer == p {
+				peer.Unlock()
+				return false, nil
+			}
+			subscribed++
+			if relaying && peer.relay != nil && peer.relay.Weight > 0 {
+				relays = append(relays, peer.relay)
+			}
+		}
+		peer.Unlock()
+	}
+	return subscribed >= agent.maxReplicas, relays
+}
+
+// handleReplicaRedirect follows the relays a primary redirected this standby
+// node to, the redirecting connection is kept.
+func (agent *TCPAgent) handleReplicaRedirect(m *ReplicaRedirect) {
+	if !agent.replica {
+		return
+	}
+	go agent.followRelays(sampleRelays(m.Relays, rand.Float64))
+}
+
+// followRelays subscribes to the first relay connected in order
+func (agent *TCPAgent) followRelays(relays []*ReplicaRelay) {
+	for _, relay := range relays {
+		p, err := agent.Connect(context.Background(), relay.Addr, nil)
+		if err != nil {
+			log.Println("relay:", relay.Addr, err)
+			continue
+		}
+
+		agent.Lock()
+		fromHeight := agent.decidedHeight + 1
+		agent.Unlock()
+		if err := p.SubscribeDecisions(fromHeight); err != nil {
+			p.Close()
+			log.Println("relay:", relay.Addr, err)
+			continue
+		}
+		return
+	}
+}
+
+// sampleRelays returns the relays with positive weight in a weighted random
+// order without replacement, each relay comes next with the probability
+// proportional to it's weight among the remaining ones. random returns
+// numbers in [0, 1).
+func sampleRelays(relays []*ReplicaRelay, random func() float64) []*ReplicaRelay {
+	type keyed struct {
+		relay *ReplicaRelay
+		key   float64
+	}
+
+	// the exponential keys of Efraimidis & Spirakis, the smallest goes first
+	var keys []keyed
+	for _, relay := range relays {
+		if relay.Weight > 0 {
+			keys = append(keys, keyed{relay, -math.Log(1-random()) / float64(relay.Weight)})
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].key < keys[j].key })
+
+	sampled := make([]*ReplicaRelay, len(keys))
+	for k := range keys {
+		sampled[k] = keys[k].relay
+	}
+	return sampled
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	mrand "math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/transport"
+)
+
+func TestSampleRelays(t *testing.T) {
+	relays := []*ReplicaRelay{{Addr: "a", Weight: 1}, {Addr: "b", Weight: 3}, {Addr: "c", Weight: 0}}
+
+	// relays without capacity are never sampled
+	first := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		sampled := sampleRelays(relays, mrand.Float64)
+		assert.Equal(t, 2, len(sampled))
+		assert.NotEqual(t, sampled[0].Addr, sampled[1].Addr)
+		first[sampled[0].Addr]++
+	}
+
+	// sampled proportionally to the weights
+	assert.InDelta(t, 3000, first["b"], 200)
+	assert.InDelta(t, 1000, first["a"], 200)
+}
+
+func TestReplicaRelay(t *testing.T) {
+	primaryKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	primary := newTestAgent(t, primaryKey)
+	defer primary.Close()
+	primary.SetMaxReplicas(1)
+
+	memory := transport.NewMemory()
+	l, err := memory.Listen("primary")
+	assert.Nil(t, err)
+	go primary.Serve(l)
+
+	newStandby := func(addr string) *TCPAgent {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		standby := newTestAgent(t, key)
+		standby.replica = true
+		standby.SetDialer(memory)
+		if addr != "" {
+			l, err := memory.Listen(addr)
+			assert.Nil(t, err)
+			go standby.Serve(l)
+			standby.SetRelay(addr, 1)
+		}
+		return standby
+	}
+
+	subscribed := func(agent *TCPAgent) (n int) {
+		agent.Lock()
+		defer agent.Unlock()
+		for _, p := range agent.peers {
+			p.Lock()
+			if p.replicaSubscribed {
+				n++
+			}
+			p.Unlock()
+		}
+		return n
+	}
+
+	// the relay is served directly
+	relay := newStandby("relay")
+	defer relay.Close()
+	p, err := relay.Connect(context.Background(), "primary", &primaryKey.PublicKey)
+	assert.Nil(t, err)
+	assert.Nil(t, p.SubscribeDecisions(0))
+	assert.Eventually(t, func() bool { return subscribed(primary) == 1 }, time.Second, 10*time.Millisecond)
+
+	// the next standby node is redirected to the relay
+	standby := newStandby("")
+	defer standby.Close()
+	p, err = standby.Connect(context.Background(), "primary", &primaryKey.PublicKey)
+	assert.Nil(t, err)
+	assert.Nil(t, p.SubscribeDecisions(0))
+	assert.Eventually(t, func() bool { return subscribed(relay) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, subscribed(primary))
+
+	// no relay left to redirect to
+	last := newStandby("")
+	defer last.Close()
+	p, err = last.Connect(context.Background(), "relay", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, p.SubscribeDecisions(0))
+	select {
+	case <-p.die:
+	case <-time.After(time.Second):
+		t.Fatal("the subscription beyond the relay capacity is not rejected")
+	}
+	assert.Equal(t, 1, subscribed(relay))
+}
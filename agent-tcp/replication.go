@@ -0,0 +1,245 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"crypto/ecdsa"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/yonggewang/bdls"
+)
+
+const (
+	// DefaultReplicaHistory is the default number of recent decisions kept by
+	// a primary for standby nodes to catch up from.
+	DefaultReplicaHistory = 1024
+)
+
+// decisionRecord is a <decide> message kept for replication
+type decisionRecord struct {
+	height uint64
+	round  uint64
+	state  bdls.State
+	bts    []byte // marshalled SignedProto of the <decide> message
+
+	participation Bitmap
+}
+
+// NewReplicaAgent creates a TCPAgent for a standby node, which only follows
+// <decide> messages streamed from primaries via TCPPeer.SubscribeDecisions.
+//
+// The consensus object is only used to verify the proofs and track the latest
+// state, it must be configured with the same participants as the primary,
+// but it's PrivateKey doesn't have to be a validator key, so the signing key
+// doesn't need to be present on standby nodes. Peers of a replica agent will
+// not join the consensus. The options are the ones of NewTCPAgent.
+func NewReplicaAgent(consensus Consensus, privateKey *ecdsa.PrivateKey, opts ...Option) *TCPAgent {
+	agent := NewTCPAgent(consensus, privateKey, opts...)
+	agent.replica = true
+	return agent
+}
+
+// SetReplicaHistory sets the number of recent decisions kept for standby nodes.
+func (agent *TCPAgent) SetReplicaHistory(n int) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.maxDecisions = n
+	agent.trimDecisions()
+}
+
+// AllowReplica restricts the standby nodes to the given public keys, any
+// authenticated peer can subscribe if no keys have been allowed.
+func (agent *TCPAgent) AllowReplica(pubkey *ecdsa.PublicKey) {
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.replicaKeys == nil {
+		agent.replicaKeys = make(map[bdls.Identity]bool)
+	}
+	agent.replicaKeys[bdls.DefaultPubKeyToIdentity(pubkey)] = true
+}
+
+// trimDecisions keeps at most maxDecisions recent decisions
+func (agent *TCPAgent) trimDecisions() {
+	if n := len(agent.decisions) - agent.maxDecisions; n > 0 {
+		for i := 0; i < n; i++ {
+			agent.decisions[i] = decisionRecord{} // avoid memory leak
+		}
+		agent.decisions = agent.decisions[n:]
+	}
+}
+
+// recordDecision checks if the consensus has decided a new height, then keeps
+// the <decide> message and streams it to subscribed standby nodes and local
+// subscribers.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) recordDecision() {
+	height, round, state := agent.consensus.CurrentState()
+	proof := agent.consensus.CurrentProof()
+	if proof == nil || height <= agent.decidedHeight {
+		return
+	}
+	agent.decidedHeight = height
+	authors := agent.auditDecision(height, state)
+
+	bts, err := proto.Marshal(proof)
+	if err != nil {
+		panic(err)
+	}
+	participation, _ := Participation(bts, agent.consensus.Participants())
+	agent.recordMetrics(height, round, participation, authors)
+
+	agent.decisions = append(agent.decisions, decisionRecord{height: height, round: round, state: state, bts: bts, participation: participation})
+	agent.trimDecisions()
+
+	if agent.shedLevel() < ShedObservers {
+		for _, p := range agent.peers {
+			p.sendDecision(bts)
+		}
+	}
+	agent.publishDecision(&Decision{Height: height, Round: round, State: state, Proof: bts, Participation: participation})
+}
+
+// handleReplicaSubscribe serves a subscription from a standby node, starting
+// with the kept decisions from the given height.
+func (agent *TCPAgent) handleReplicaSubscribe(p *TCPPeer, fromHeight uint64) error {
+	pubkey := p.GetPublicKey()
+	if pubkey == nil {
+		return ErrReplicaNotAuthenticated
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.replicaKeys != nil && !agent.replicaKeys[bdls.DefaultPubKeyToIdentity(pubkey)] {
+		return ErrReplicaNotAllowed
+	}
+	if agent.shedLevel() >= ShedObservers {
+		return ErrOverloaded
+	}
+
+	// redirect to the relays beyond the max replicas
+	if full, relays := agent.replicaFull(p); full {
+		if len(relays) == 0 {
+			return ErrReplicaFull
+		}
+		p.sendAgentMessage(CommandType_REPLICA_REDIRECT, &ReplicaRedirect{Relays: relays})
+		return nil
+	}
+
+	var history [][]byte
+	for k := range agent.decisions {
+		if agent.decisions[k].height >= fromHeight {
+			history = append(history, agent.decisions[k].bts)
+		}
+	}
+	p.subscribeDecisions(history)
+	return nil
+}
+
+// handleReplicaDecision feeds a <decide> message from a primary to the
+// consensus object of a replica agent, the proofs will be verified there.
+func (agent *TCPAgent) handleReplicaDecision(p *TCPPeer, bts []byte) {
+	if agent.replica {
+		agent.handleConsensusMessage(bts, nil, p)
+	}
+}
+
+// SubscribeDecisions requests the peer to stream it's decisions starting from
+// fromHeight, the peer must have authenticated this agent's public key. It's
+// used by standby nodes created with NewReplicaAgent, the relay set by
+// SetRelay is announced along.
+func (p *TCPPeer) SubscribeDecisions(fromHeight uint64) error {
+	m := ReplicaSubscribe{FromHeight: fromHeight}
+	if relay := p.agent.getRelay(); relay != nil {
+		m.RelayAddr = relay.Addr
+		m.RelayCapacity = relay.Weight
+	}
+	bts, err := proto.Marshal(&m)
+	if err != nil {
+		return err
+	}
+
+	out, err := proto.Marshal(&Gossip{Command: CommandType_REPLICA_SUBSCRIBE, Message: bts})
+	if err != nil {
+		return err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.agentMessages = append(p.agentMessages, out)
+	p.notifyAgentMessage()
+	return nil
+}
+
+// subscribeDecisions marks this peer as a standby node, and enqueues the
+// history decisions.
+func (p *TCPPeer) subscribeDecisions(history [][]byte) {
+	p.Lock()
+	defer p.Unlock()
+	p.replicaSubscribed = true
+	for _, bts := range history {
+		p.enqueueDecision(CommandType_REPLICA_DECISION, bts)
+	}
+}
+
+// setRelay keeps the relay announced in the subscription
+func (p *TCPPeer) setRelay(m *ReplicaSubscribe) {
+	p.Lock()
+	defer p.Unlock()
+	p.relay = nil
+	if m.RelayAddr != "" {
+		p.relay = &ReplicaRelay{Addr: m.RelayAddr, Weight: m.RelayCapacity}
+	}
+}
+
+// sendDecision enqueues a decision if this peer has subscribed
+func (p *TCPPeer) sendDecision(bts []byte) {
+	p.Lock()
+	defer p.Unlock()
+	if p.replicaSubscribed {
+		p.enqueueDecision(CommandType_REPLICA_DECISION, bts)
+	}
+}
+
+// enqueueDecision encapsulates and enqueues a decision to agent messages by
+// the command, REPLICA_DECISION or SYNC_DECISION.
+// NOTE: peer lock must be held.
+func (p *TCPPeer) enqueueDecision(command CommandType, bts []byte) {
+	msg := Gossip{Command: command, Message: bts}
+	if p.agent.FeatureActive(FeatureCompression) && len(bts) >= p.compressionThreshold {
+		compress(&msg, p.compression)
+	}
+	out, err := proto.Marshal(&msg)
+	if err != nil {
+		panic(err)
+	}
+	p.agentMessages = append(p.agentMessages, out)
+	p.notifyAgentMessage()
+}
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestReplicaDecisions(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	newConsensus := func(privateKey *ecdsa.PrivateKey) *bdls.Consensus {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = privateKey
+		config.Participants = coords
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		consensus.SetLatency(200 * time.Millisecond)
+		return consensus
+	}
+
+	// primaries
+	agents := make([]*TCPAgent, len(participants))
+	for i := range participants {
+		agents[i] = NewTCPAgent(newConsensus(participants[i]), participants[i])
+		defer agents[i].Close()
+	}
+
+	for i := 0; i < len(agents); i++ {
+		for j := i + 1; j < len(agents); j++ {
+			c1, c2 := net.Pipe()
+			p1 := NewTCPPeer(c1, agents[i])
+			p2 := NewTCPPeer(c2, agents[j])
+			assert.True(t, agents[i].AddPeer(p1))
+			assert.True(t, agents[j].AddPeer(p2))
+			p1.InitiatePublicKeyAuthentication()
+			p2.InitiatePublicKeyAuthentication()
+		}
+	}
+	<-time.After(time.Second)
+
+	for i := range agents {
+		agents[i].Update()
+		data := make([]byte, 1024)
+		io.ReadFull(rand.Reader, data)
+		assert.Nil(t, agents[i].Propose(data))
+	}
+
+	deadline := time.Now().Add(20 * time.Second)
+	for time.Now().Before(deadline) {
+		if height, _, _ := agents[0].GetLatestState(); height > 0 {
+			break
+		}
+		<-time.After(20 * time.Millisecond)
+	}
+	height, _, state := agents[0].GetLatestState()
+	assert.Equal(t, uint64(1), height)
+
+	// standby node with a key not in the participants
+	standbyKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	replica := NewReplicaAgent(newConsensus(standbyKey), standbyKey)
+	defer replica.Close()
+
+	// a primary only allows the standby node
+	agents[0].AllowReplica(&standbyKey.PublicKey)
+
+	c1, c2 := net.Pipe()
+	p1 := NewTCPPeer(c1, replica)
+	p2 := NewTCPPeer(c2, agents[0])
+	assert.True(t, replica.AddPeer(p1))
+	assert.True(t, agents[0].AddPeer(p2))
+	p1.InitiatePublicKeyAuthentication()
+	p2.InitiatePublicKeyAuthentication()
+	<-time.After(time.Second)
+	assert.Nil(t, p1.SubscribeDecisions(0))
+
+	deadline = time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if replicaHeight, _, _ := replica.GetLatestState(); replicaHeight == height {
+			break
+		}
+		<-time.After(20 * time.Millisecond)
+	}
+
+	replicaHeight, _, replicaState := replica.GetLatestState()
+	assert.Equal(t, height, replicaHeight)
+	assert.Equal(t, state, replicaState)
+
+	// the decisions carry the participation of a quorum, the same on the
+	// standby node
+	sub, err := agents[0].SubscribeHeights(height)
+	assert.Nil(t, err)
+	d := <-sub.C
+	sub.Close()
+	assert.True(t, d.Participation.Count() >= agents[0].consensus.Quorum())
+	sub, err = replica.SubscribeHeights(height)
+	assert.Nil(t, err)
+	replicaDecision := <-sub.C
+	sub.Close()
+	participation, err := Participation(replicaDecision.Proof, coords)
+	assert.Nil(t, err)
+	assert.Equal(t, participation, replicaDecision.Participation)
+}
+
+func TestReplicaNotAllowed(t *testing.T) {
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	clientKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	otherKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+	c1, _ := net.Pipe()
+	p := NewTCPPeer(c1, server)
+
+	// unauthenticated
+	assert.Equal(t, ErrReplicaNotAuthenticated, server.handleReplicaSubscribe(p, 0))
+
+	auth := KeyAuthInit{X: clientKey.PublicKey.X.Bytes(), Y: clientKey.PublicKey.Y.Bytes(), Nonce: newNonce(), Timestamp: time.Now().Unix()}
+	assert.Nil(t, p.handleKeyAuthInit(&auth))
+	p.Lock()
+	p.peerAuthStatus = peerAuthenticated
+	p.Unlock()
+
+	server.AllowReplica(&otherKey.PublicKey)
+	assert.Equal(t, ErrReplicaNotAllowed, server.handleReplicaSubscribe(p, 0))
+
+	server.AllowReplica(&clientKey.PublicKey)
+	assert.Nil(t, server.handleReplicaSubscribe(p, 0))
+}
@@ -0,0 +1,318 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/yonggewang/bdls"
+)
+
+const (
+	// DefaultBanThreshold is the default misbehavior score to ban a peer
+	DefaultBanThreshold = 100
+	// DefaultBanDuration is the default duration of bans
+	DefaultBanDuration = 10 * time.Minute
+)
+
+// the misbehavior penalties
+const (
+	penaltyMalformedFrame = 50 // the frame cannot be decoded, the connection is closed too
+	penaltyAuthFailed     = 50 // the peer failed to authenticate it's public key
+	penaltyInvalidMessage = 10 // a consensus message nobody honest would send
+)
+
+// peerScore is the misbehavior score of a host
+type peerScore struct {
+	score   int
+	updated time.Time
+}
+
+// Ban is a banned host, and the identity it has authenticated.
+type Ban struct {
+	Host     string    `json:"host"`
+	Identity string    `json:"identity,omitempty"` // hex encoded
+	Until    time.Time `json:"until"`
+}
+
+// SetBanPolicy enables the misbehavior scores of peers, from malformed
+// frames, failed authentications and invalid consensus messages, and the
+// peers crossing threshold are disconnected and banned for duration, by
+// their hosts and the identities they have authenticated. The scores are
+// forgotten after duration without misbehavior. 0 threshold disables it.
+func (agent *TCPAgent) SetBanPolicy(threshold int, duration time.Duration) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.banThreshold = threshold
+	agent.banDuration = duration
+}
+
+// Bans returns the bans in effect, in the order of expiry.
+func (agent *TCPAgent) Bans() []Ban {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.pruneBans(time.Now())
+
+	bans := make([]Ban, 0, len(agent.bans))
+	for _, ban := range agent.bans {
+		bans = append(bans, *ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Until.Before(bans[j].Until) })
+	return bans
+}
+
+// Unban lifts the ban of host and resets it's score.
+func (agent *TCPAgent) Unban(host string) bool {
+	agent.Lock()
+	defer agent.Unlock()
+	_, ok := agent.bans[host]
+	delete(agent.bans, host)
+	delete(agent.scores, host)
+	if ok && agent.addressBook != nil {
+		go agent.addressBook.save(agent)
+	}
+	return ok
+}
+
+// Ban bans host for duration, regardless of it's score, the connections
+// from the host are closed.
+func (agent *TCPAgent) Ban(host string, duration time.Duration) Ban {
+	agent.Lock()
+	defer agent.Unlock()
+
+	ban := &Ban{Host: host, Until: time.Now().Add(duration)}
+	agent.bans[host] = ban
+	delete(agent.scores, host)
+	log.Println("banned:", host)
+	agent.publishPeerEvent(PeerEvent{Type: PeerBanned, Time: time.Now(), Address: host})
+
+	for _, peer := range agent.peers {
+		if agent.isBanned(peer) {
+			peer.Close()
+		}
+	}
+	return *ban
+}
+
+// BansHandler serves Bans as json for the admin API, POST ?host=&duration=
+// bans a host, for the ban duration by default, DELETE ?host= lifts a ban.
+func (agent *TCPAgent) BansHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			host := r.URL.Query().Get("host")
+			if host == "" {
+				http.Error(w, "missing host", http.StatusBadRequest)
+				return
+			}
+			agent.Lock()
+			duration := agent.banDuration
+			agent.Unlock()
+			if d := r.URL.Query().Get("duration"); d != "" {
+				var err error
+				if duration, err = time.ParseDuration(d); err != nil || duration <= 0 {
+					http.Error(w, "invalid duration", http.StatusBadRequest)
+					return
+				}
+			}
+			agent.Ban(host, duration)
+		case http.MethodDelete:
+			if !agent.Unban(r.URL.Query().Get("host")) {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agent.Bans())
+	})
+}
+
+// addrHost returns the host of addr, or the whole address if it has no port.
+func addrHost(addr net.Addr) string {
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
+
+// peerHost returns the host of the peer's address
+func peerHost(p *TCPPeer) string { return addrHost(p.RemoteAddr()) }
+
+// pruneBans removes the expired bans and scores.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) pruneBans(now time.Time) {
+	for host, ban := range agent.bans {
+		if !now.Before(ban.Until) {
+			delete(agent.bans, host)
+		}
+	}
+	for host, score := range agent.scores {
+		if now.Sub(score.updated) >= agent.banDuration {
+			delete(agent.scores, host)
+		}
+	}
+}
+
+// isBanned checks if the host of the peer, or the identity it has
+// authenticated, is banned.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) isBanned(p *TCPPeer) bool {
+	if len(agent.bans) == 0 {
+		return false
+	}
+
+	now := time.Now()
+	if ban, ok := agent.bans[peerHost(p)]; ok && now.Before(ban.Until) {
+		return true
+	}
+
+	// the identity is banned from all hosts
+	if key := p.GetPublicKey(); key != nil {
+		id := bdls.DefaultPubKeyToIdentity(key)
+		identity := hex.EncodeToString(id[:])
+		for _, ban := range agent.bans {
+			if ban.Identity == identity && now.Before(ban.Until) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkBanned is isBanned with the agent lock
+func (agent *TCPAgent) checkBanned(p *TCPPeer) bool {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.isBanned(p)
+}
+
+// hostBanned checks if the host is banned, before any handshake.
+func (agent *TCPAgent) hostBanned(host string) bool {
+	agent.Lock()
+	defer agent.Unlock()
+	ban, ok := agent.bans[host]
+	return ok && time.Now().Before(ban.Until)
+}
+
+// misbehave adds penalty to the score of the peer's host.
+func (agent *TCPAgent) misbehave(p *TCPPeer, penalty int) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.misbehaveLocked(p, penalty)
+}
+
+// misbehaveLocked adds penalty to the score of the peer's host, and bans it
+// once the score crosses the threshold, the connections from the host or
+// authenticated to the same identity are closed.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) misbehaveLocked(p *TCPPeer, penalty int) {
+	if agent.banThreshold <= 0 {
+		return
+	}
+
+	now := time.Now()
+	agent.pruneBans(now)
+	host := peerHost(p)
+	score, ok := agent.scores[host]
+	if !ok {
+		score = new(peerScore)
+		agent.scores[host] = score
+	}
+	score.score += penalty
+	score.updated = now
+	if score.score < agent.banThreshold {
+		return
+	}
+
+	ban := &Ban{Host: host, Until: now.Add(agent.banDuration)}
+	if key := p.GetPublicKey(); key != nil {
+		id := bdls.DefaultPubKeyToIdentity(key)
+		ban.Identity = hex.EncodeToString(id[:])
+	}
+	agent.bans[host] = ban
+	delete(agent.scores, host)
+	log.Println("banned:", host, ban.Identity)
+	agent.publishPeerEvent(PeerEvent{Type: PeerBanned, Time: now, Address: host, Identity: ban.Identity})
+
+	for _, peer := range agent.peers {
+		if agent.isBanned(peer) {
+			peer.Close()
+		}
+	}
+	p.Close()
+}
+
+// misbehaviorPenalty returns the penalty of the error handling a frame, or 0
+// if it's not misbehavior.
+func misbehaviorPenalty(err error) int {
+	switch err {
+	case ErrPeerAuthenticatedFailed, ErrKeyLinkage, ErrKeyLinkageEmpty, ErrKeyLinkageExpired, ErrKeyLinkageRevoked, ErrHandshakeNonce, ErrKeyAuthConfirm:
+		return penaltyAuthFailed
+	}
+	return 0
+}
+
+// invalidMessage returns true if the error processing a consensus message
+// means the message is invalid regardless of the timing, i.e. forged or
+// corrupted, instead of late or early.
+func invalidMessage(err error) bool {
+	switch err {
+	case bdls.ErrMessageSignature,
+		bdls.ErrMessageUnknownParticipant,
+		bdls.ErrMessageUnknownMessageType,
+		bdls.ErrLockNotSignedByLeader,
+		bdls.ErrLockProofUnknownParticipant,
+		bdls.ErrLockProofTypeMismatch,
+		bdls.ErrLockProofInsufficient,
+		bdls.ErrSelectNotSignedByLeader,
+		bdls.ErrSelectProofUnknownParticipant,
+		bdls.ErrSelectProofTypeMismatch,
+		bdls.ErrSelectProofInsufficient,
+		bdls.ErrDecideNotSignedByLeader,
+		bdls.ErrDecideProofUnknownParticipant,
+		bdls.ErrDecideProofTypeMismatch,
+		bdls.ErrDecideProofInsufficient:
+		return true
+	}
+	return false
+}
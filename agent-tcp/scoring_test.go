@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	io "io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestBanPolicy(t *testing.T) {
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+	server.SetBanPolicy(DefaultBanThreshold, time.Minute)
+	l, err := server.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+
+	// malformed frames
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		assert.Nil(t, err)
+		conn.Write(make([]byte, MessageLength))
+		io.Copy(io.Discard, conn)
+		conn.Close()
+	}
+	bans := server.Bans()
+	assert.Equal(t, 1, len(bans))
+	assert.Equal(t, "127.0.0.1", bans[0].Host)
+	assert.Equal(t, "", bans[0].Identity)
+
+	// the host is rejected before any handshake
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.Nil(t, err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _ := io.Copy(io.Discard, conn)
+	assert.Equal(t, int64(0), n)
+	conn.Close()
+
+	assert.True(t, server.Unban("127.0.0.1"))
+	assert.False(t, server.Unban("127.0.0.1"))
+	clientKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	client := newTestAgent(t, clientKey)
+	defer client.Close()
+	_, err = client.Connect(context.Background(), l.Addr().String(), &serverKey.PublicKey)
+	assert.Nil(t, err)
+
+	// invalid consensus messages from an authenticated peer
+	clientKey, err = ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	client = newTestAgent(t, clientKey)
+	defer client.Close()
+	c1, c2 := net.Pipe()
+	p1 := NewTCPPeer(c1, server)
+	p2 := NewTCPPeer(c2, client)
+	assert.True(t, server.AddPeer(p1))
+	assert.True(t, client.AddPeer(p2))
+	p1.InitiatePublicKeyAuthentication()
+	p2.InitiatePublicKeyAuthentication()
+	assert.Nil(t, server.waitAuthenticated(p1, &clientKey.PublicKey, time.Second, nil))
+
+	outsider, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	sp := new(bdls.SignedProto)
+	sp.Sign(&bdls.Message{Type: bdls.MessageType_RoundChange}, outsider)
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	for i := 0; i < DefaultBanThreshold/penaltyInvalidMessage; i++ {
+		server.handleConsensusMessage(bts, p1.GetPublicKey(), p1)
+	}
+	select {
+	case <-p1.die:
+	case <-time.After(time.Second):
+		t.Fatal("the misbehaving peer is not closed")
+	}
+
+	// banned by the identity from other hosts too
+	id := bdls.DefaultPubKeyToIdentity(&clientKey.PublicKey)
+	bans = server.Bans()
+	assert.Equal(t, 1, len(bans))
+	assert.Equal(t, hex.EncodeToString(id[:]), bans[0].Identity)
+	// the server may close before or after the client has authenticated it
+	p, err := client.Connect(context.Background(), l.Addr().String(), &serverKey.PublicKey)
+	if err == nil {
+		select {
+		case <-p.die:
+		case <-time.After(time.Second):
+			t.Fatal("the banned identity is not rejected")
+		}
+	}
+
+	// banned by the operator through the admin API
+	srv := httptest.NewServer(server.BansHandler())
+	defer srv.Close()
+	resp, err := http.Post(srv.URL+"?host=192.0.2.1&duration=1h", "", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	bans = server.Bans()
+	assert.Equal(t, 2, len(bans))
+	assert.Equal(t, "192.0.2.1", bans[1].Host)
+	assert.True(t, time.Until(bans[1].Until) > 59*time.Minute)
+	for _, query := range []string{"", "?host=192.0.2.2&duration=x", "?host=192.0.2.2&duration=-1s"} {
+		resp, err = http.Post(srv.URL+query, "", nil)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
@@ -0,0 +1,306 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"math/big"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+)
+
+const (
+	// DefaultRekeyInterval is the default max age of a session key
+	DefaultRekeyInterval = 10 * time.Minute
+
+	// DefaultRekeyBytes is the default max bytes sealed by a session key
+	DefaultRekeyBytes = 1 << 30
+
+	// sealOverhead is the max bytes sealing adds to a frame, the tag and
+	// the gossip encapsulation
+	sealOverhead = 32
+)
+
+// sessionCipher seals or opens the frames of one direction with AES-256-GCM,
+// the nonce is the count of frames sealed, so frames must be opened in the
+// order sealed, and can't be replayed, reordered or dropped.
+type sessionCipher struct {
+	key     []byte
+	aead    cipher.AEAD
+	nonce   []byte
+	counter uint64
+
+	created time.Time // the time the key was derived
+	sealed  int64     // the bytes sealed with the key
+}
+
+// newSessionCipher creates a sessionCipher with a 32 bytes key
+func newSessionCipher(key []byte) *sessionCipher {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &sessionCipher{key: key, aead: aead, nonce: make([]byte, aead.NonceSize()), created: time.Now()}
+}
+
+// next returns the nonce of the next frame
+func (c *sessionCipher) next() []byte {
+	binary.LittleEndian.PutUint64(c.nonce, c.counter)
+	c.counter++
+	return c.nonce
+}
+
+// seal encrypts a marshalled gossip frame, and encapsulates it in a SEALED one
+func (c *sessionCipher) seal(frame []byte) []byte {
+	c.sealed += int64(len(frame))
+	out, err := proto.Marshal(&Gossip{Command: CommandType_SEALED, Message: c.aead.Seal(nil, c.next(), frame, nil)})
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// open decrypts the message of a SEALED gossip frame
+func (c *sessionCipher) open(message []byte) ([]byte, error) {
+	frame, err := c.aead.Open(nil, c.next(), message, nil)
+	if err != nil {
+		return nil, ErrSessionOpen
+	}
+	return frame, nil
+}
+
+// sessionKey derives the key of the frames sent by the side of senderNonce,
+// from the ECDH secrets of the challenges of both sides, in any order:
+// HKDF(min(secret) + max(secret), SessionKeyLabel + senderNonce)
+func sessionKey(secret1 *big.Int, secret2 *big.Int, senderNonce []byte) []byte {
+	s1, s2 := secretBytes(secret1), secretBytes(secret2)
+	if bytes.Compare(s1, s2) > 0 {
+		s1, s2 = s2, s1
+	}
+	return deriveKey(append(s1, s2...), nil, SessionKeyLabel+string(senderNonce))
+}
+
+// rekey derives the next key of a direction from the current one, and the
+// ECDH secret of the ephemeral key announced in SessionRekey and the static
+// key of the receiver, so a leaked session key reveals neither the keys
+// before it nor the ones after the next rotation:
+// HKDF(secret + ephemeral.X + ephemeral.Y, salt: current key, SessionRekeyLabel)
+func (c *sessionCipher) rekey(secret *big.Int, ephemeral *ecdsa.PublicKey) *sessionCipher {
+	var ikm bytes.Buffer
+	ikm.Write(secretBytes(secret))
+	writeKey(&ikm, ephemeral)
+	return newSessionCipher(deriveKey(ikm.Bytes(), c.key, SessionRekeyLabel))
+}
+
+// SetRekey sets the max age and bytes of session keys, the encrypted
+// sessions authenticated afterwards rotate the keys of the frames they send
+// once either is reached, by an in-band REKEY. 0 disables a limit.
+// Keys are rotated every DefaultRekeyInterval or DefaultRekeyBytes by
+// default.
+func (agent *TCPAgent) SetRekey(interval time.Duration, bytes int64) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.rekeyInterval = interval
+	agent.rekeyBytes = bytes
+}
+
+// getRekey returns the limits set by SetRekey
+func (agent *TCPAgent) getRekey() (time.Duration, int64) {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.rekeyInterval, agent.rekeyBytes
+}
+
+// deriveSessionKeys derives the session keys once the secrets of both
+// challenges are known, the frames from the peer can be opened from then.
+// NOTE: peer lock must be held.
+func (p *TCPPeer) deriveSessionKeys() {
+	if p.challengeSecret == nil || p.responseSecret == nil {
+		return
+	}
+	p.sealKey = sessionKey(p.challengeSecret, p.responseSecret, p.nonce)
+	p.opener = newSessionCipher(sessionKey(p.challengeSecret, p.responseSecret, p.peerNonce))
+	p.challengeSecret = nil
+	p.responseSecret = nil
+}
+
+// startSealing encrypts the frames sent to the peer from now on, if both
+// sides support FeatureEncryption, it's called once both sides have
+// authenticated, and all frames of the handshake have been enqueued.
+func (p *TCPPeer) startSealing() {
+	if !p.agent.FeatureActive(FeatureEncryption) {
+		return
+	}
+	interval, bytes := p.agent.getRekey()
+	padding, _ := p.agent.getPadding()
+
+	p.Lock()
+	defer p.Unlock()
+	if p.sealKey == nil || !p.peerFeature(FeatureEncryption) {
+		return
+	}
+	p.rekeyInterval, p.rekeyBytes = interval, bytes
+	p.padding = padding
+	p.sealer = newSessionCipher(p.sealKey)
+	p.sealKey = nil
+	// a sealed NOP tells the peer that the session is encrypted right away,
+	// no plaintext frames are accepted from then.
+	p.agentMessages = append(p.agentMessages, keepaliveFrame)
+	p.notifyAgentMessage()
+}
+
+// sealFrame seals a frame to send if the session is encrypted
+func (p *TCPPeer) sealFrame(frame []byte) []byte {
+	p.Lock()
+	sealer, padding := p.sealer, p.padding
+	p.Unlock()
+	if sealer == nil {
+		return frame
+	}
+	if padding {
+		frame = padFrame(frame, p.options.maxFrameSize)
+	}
+	return sealer.seal(frame)
+}
+
+// rekeyFrame rotates the key of the frames sent if it has reached the limits
+// of SetRekey, returns the sealed REKEY frame to send before the frames
+// sealed with the new key, or nil if not rotated.
+func (p *TCPPeer) rekeyFrame(now time.Time) []byte {
+	p.Lock()
+	defer p.Unlock()
+	sealer := p.sealer
+	if sealer == nil {
+		return nil
+	}
+	if (p.rekeyInterval <= 0 || now.Sub(sealer.created) < p.rekeyInterval) && (p.rekeyBytes <= 0 || sealer.sealed < p.rekeyBytes) {
+		return nil
+	}
+
+	ephemeral, err := ecdsa.GenerateKey(p.peerPublicKey.Curve, rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	bts, err := proto.Marshal(&SessionRekey{X: ephemeral.PublicKey.X.Bytes(), Y: ephemeral.PublicKey.Y.Bytes()})
+	if err != nil {
+		panic(err)
+	}
+	frame, err := proto.Marshal(&Gossip{Command: CommandType_REKEY, Message: bts})
+	if err != nil {
+		panic(err)
+	}
+
+	if p.padding {
+		frame = padFrame(frame, p.options.maxFrameSize)
+	}
+	out := sealer.seal(frame)
+	p.sealer = sealer.rekey(ECDH(p.peerPublicKey, ephemeral), &ephemeral.PublicKey)
+	return out
+}
+
+// handleRekey rotates the key of the frames received to the one announced
+// by the peer, the frames after the REKEY are sealed with it.
+func (p *TCPPeer) handleRekey(m *SessionRekey) error {
+	ephemeral := unmarshalKey(p.agent.privateKey.Curve, m.X, m.Y)
+	if ephemeral == nil {
+		return ErrKeyNotOnCurve
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	// a REKEY is only valid in the encrypted session, it's sealed with the
+	// current key as plaintext frames are rejected then
+	if !p.sealedIn {
+		return ErrSessionNotEstablished
+	}
+	p.opener = p.opener.rekey(ECDH(ephemeral, p.agent.privateKey), ephemeral)
+	return nil
+}
+
+// openGossip replaces a SEALED gossip with the frame it encapsulates, once
+// the peer has sent a SEALED frame, all frames from it must be sealed.
+func (p *TCPPeer) openGossip(msg *Gossip) error {
+	p.Lock()
+	defer p.Unlock()
+	if msg.Command != CommandType_SEALED {
+		if p.sealedIn {
+			return ErrSessionPlaintext
+		}
+		return nil
+	}
+
+	if p.opener == nil {
+		return ErrSessionNotEstablished
+	}
+	frame, err := p.opener.open(msg.Message)
+	if err != nil {
+		return err
+	}
+	p.sealedIn = true
+
+	*msg = Gossip{}
+	if err := proto.Unmarshal(frame, msg); err != nil {
+		return err
+	}
+	if msg.Command == CommandType_SEALED {
+		return ErrSessionOpen
+	}
+	return nil
+}
+
+// peerFeature returns true if the peer has advertised a feature
+// NOTE: peer lock must be held.
+func (p *TCPPeer) peerFeature(feature Feature) bool {
+	for _, f := range p.peerFeatures {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionEncrypted returns true if the frames to and from the peer are
+// both encrypted.
+func (p *TCPPeer) SessionEncrypted() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.sealer != nil && p.sealedIn
+}
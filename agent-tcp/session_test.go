@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestSessionEncryption(t *testing.T) {
+	connect := func(a1, a2 *TCPAgent) (*TCPPeer, *TCPPeer) {
+		c1, c2 := net.Pipe()
+		p1 := NewTCPPeer(c1, a1)
+		p2 := NewTCPPeer(c2, a2)
+		assert.True(t, a1.AddPeer(p1))
+		assert.True(t, a2.AddPeer(p2))
+		p1.InitiatePublicKeyAuthentication()
+		p2.InitiatePublicKeyAuthentication()
+		assert.Nil(t, a1.waitAuthenticated(p1, nil, time.Second, nil))
+		assert.Nil(t, a2.waitAuthenticated(p2, nil, time.Second, nil))
+		return p1, p2
+	}
+	newAgent := func() *TCPAgent {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		agent := newTestAgent(t, key)
+		t.Cleanup(func() { agent.Close() })
+		return agent
+	}
+
+	// encrypted by default, the frames after the handshake are sealed
+	a1, a2 := newAgent(), newAgent()
+	p1, p2 := connect(a1, a2)
+	assert.Eventually(t, func() bool { return p1.SessionEncrypted() && p2.SessionEncrypted() }, 5*time.Second, 10*time.Millisecond)
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	assert.Nil(t, a1.ScheduleMaintenance(start, start.Add(time.Hour)))
+	assert.Eventually(t, func() bool { return len(a2.Maintenance()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// not encrypted if one side doesn't support it
+	a3 := newAgent()
+	a3.SetFeatures(FeatureCompression)
+	p1, p3 := connect(a1, a3)
+	assert.Eventually(t, func() bool { return p1.MutuallyAuthenticated() && p3.MutuallyAuthenticated() }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, p1.SessionEncrypted())
+	assert.False(t, p3.SessionEncrypted())
+
+	// frames can't be tampered, replayed or reordered
+	key := make([]byte, 32)
+	io.ReadFull(rand.Reader, key)
+	sealer, opener := newSessionCipher(key), newSessionCipher(key)
+	frame, err := proto.Marshal(&Gossip{Command: CommandType_CONSENSUS, Message: []byte("vote")})
+	assert.Nil(t, err)
+	var sealed [3]Gossip
+	for i := range sealed {
+		assert.Nil(t, proto.Unmarshal(sealer.seal(frame), &sealed[i]))
+		assert.Equal(t, CommandType_SEALED, sealed[i].Command)
+		assert.False(t, bytes.Contains(sealed[i].Message, []byte("vote")))
+	}
+	opened, err := opener.open(sealed[0].Message)
+	assert.Nil(t, err)
+	assert.Equal(t, frame, opened)
+	_, err = opener.open(sealed[0].Message)
+	assert.Equal(t, ErrSessionOpen, err)
+
+	opener = newSessionCipher(key)
+	_, err = opener.open(sealed[1].Message)
+	assert.Equal(t, ErrSessionOpen, err)
+
+	opener = newSessionCipher(key)
+	sealed[0].Message[0] ^= 1
+	_, err = opener.open(sealed[0].Message)
+	assert.Equal(t, ErrSessionOpen, err)
+
+	// no plaintext frames once sealed, and no sealed frames before the keys
+	p := &TCPPeer{}
+	assert.Equal(t, ErrSessionNotEstablished, p.openGossip(&Gossip{Command: CommandType_SEALED}))
+	p.opener = newSessionCipher(key)
+	msg := Gossip{Command: CommandType_SEALED, Message: sealed[2].Message}
+	p.opener.counter = 2
+	assert.Nil(t, p.openGossip(&msg))
+	assert.Equal(t, CommandType_CONSENSUS, msg.Command)
+	assert.Equal(t, []byte("vote"), msg.Message)
+	assert.Equal(t, ErrSessionPlaintext, p.openGossip(&Gossip{Command: CommandType_CONSENSUS}))
+}
+
+func TestSessionRekey(t *testing.T) {
+	key1, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	key2, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a1 := newTestAgent(t, key1)
+	defer a1.Close()
+	a2 := newTestAgent(t, key2)
+	defer a2.Close()
+	// a1 rotates after every frame
+	a1.SetRekey(0, 1)
+
+	c1, c2 := net.Pipe()
+	p1 := NewTCPPeer(c1, a1)
+	p2 := NewTCPPeer(c2, a2)
+	assert.True(t, a1.AddPeer(p1))
+	assert.True(t, a2.AddPeer(p2))
+	p1.InitiatePublicKeyAuthentication()
+	p2.InitiatePublicKeyAuthentication()
+	assert.Eventually(t, func() bool { return p1.SessionEncrypted() && p2.SessionEncrypted() }, 5*time.Second, 10*time.Millisecond)
+
+	// the frames after the rotations are still opened
+	for i := 0; i < 3; i++ {
+		start := time.Now().Add(time.Duration(i+1) * time.Hour).Truncate(time.Second)
+		assert.Nil(t, a1.ScheduleMaintenance(start, start.Add(time.Hour)))
+		assert.Eventually(t, func() bool {
+			windows := a2.Maintenance()
+			return len(windows) == 1 && windows[0].Start.Equal(start)
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+	_, sent := p1.traffic.snapshot()
+	_, received := p2.traffic.snapshot()
+	assert.True(t, sent["REKEY"].SentMessages >= 4)
+	assert.Equal(t, sent["REKEY"].SentMessages, received["REKEY"].ReceivedMessages)
+	_, sent = p2.traffic.snapshot()
+	assert.Equal(t, uint64(0), sent["REKEY"].SentMessages)
+
+	// the rotated keys differ, and a REKEY outside of an encrypted session
+	// is rejected
+	sealer := newSessionCipher(make([]byte, 32))
+	ephemeral, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	next := sealer.rekey(ECDH(&key2.PublicKey, ephemeral), &ephemeral.PublicKey)
+	assert.NotEqual(t, sealer.key, next.key)
+	assert.Equal(t, next.key, sealer.rekey(ECDH(&ephemeral.PublicKey, key2), &ephemeral.PublicKey).key)
+
+	p := &TCPPeer{agent: a2}
+	m := &SessionRekey{X: ephemeral.PublicKey.X.Bytes(), Y: ephemeral.PublicKey.Y.Bytes()}
+	assert.Equal(t, ErrSessionNotEstablished, p.handleRekey(m))
+	assert.Equal(t, ErrKeyNotOnCurve, p.handleRekey(&SessionRekey{X: []byte{1}, Y: []byte{2}}))
+}
@@ -0,0 +1,250 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultShedInterval is the default interval of evaluating the load
+	DefaultShedInterval = time.Second
+
+	// DefaultMaxInbound is the default number of consensus messages
+	// awaiting the consensus core beyond which a node is overloaded
+	DefaultMaxInbound = 4096
+
+	// DefaultMaxOutbound is the default number of messages pending to a
+	// peer beyond which a node is overloaded
+	DefaultMaxOutbound = 1024
+
+	// DefaultMaxCPU is the default share of the cpus used by the process
+	// beyond which a node is overloaded
+	DefaultMaxCPU = 0.9
+
+	// the pressure beyond the limits to shed one more level
+	shedStep = 0.5
+
+	// the interval of checking if the state sync streams can be served
+	syncDeferInterval = 100 * time.Millisecond
+)
+
+// ShedLevel is how much load is shed to protect the voting path, each level
+// sheds the traffic of the levels below it as well. The consensus messages
+// of the authenticated peers are never shed.
+type ShedLevel int32
+
+const (
+	// ShedNone sheds nothing
+	ShedNone ShedLevel = iota
+	// ShedObservers stops streaming decisions to the standby nodes and the
+	// consensus messages to observers, and refuses new subscriptions
+	ShedObservers
+	// ShedUnauthenticated refuses inbound connections, and drops the
+	// consensus messages of the peers not authenticated
+	ShedUnauthenticated
+	// ShedSync defers serving the state sync streams until the load drops
+	ShedSync
+)
+
+func (l ShedLevel) String() string {
+	switch l {
+	case ShedNone:
+		return "none"
+	case ShedObservers:
+		return "observers"
+	case ShedUnauthenticated:
+		return "unauthenticated"
+	case ShedSync:
+		return "sync"
+	}
+	return "unknown"
+}
+
+// MarshalJSON encodes the level by name
+func (l ShedLevel) MarshalJSON() ([]byte, error) { return json.Marshal(l.String()) }
+
+// Load is the load of a node evaluated by a LoadShedder
+type Load struct {
+	Inbound  int     `json:"inbound"`  // consensus messages awaiting the consensus core
+	Outbound int     `json:"outbound"` // the most messages pending to a peer
+	CPU      float64 `json:"cpu"`      // the share of the cpus used by the process since the last evaluation
+}
+
+// LoadShedder decides the level of load to shed from the load of the node
+// and the current level, it's evaluated periodically by the consensus
+// updater, so it must not block.
+type LoadShedder interface {
+	ShedLevel(load Load, current ShedLevel) ShedLevel
+}
+
+// AdaptiveShedder sheds load progressively with the pressure, the highest
+// ratio of the load to it's limits: beyond 1, a level is shed per 0.5 of
+// pressure. Once the pressure drops, the levels are restored one per
+// evaluation, so the node doesn't flap under a steady attack. Zero limits
+// are not checked.
+type AdaptiveShedder struct {
+	MaxInbound  int
+	MaxOutbound int
+	MaxCPU      float64
+}
+
+// DefaultLoadShedder returns an AdaptiveShedder of the default limits
+func DefaultLoadShedder() *AdaptiveShedder {
+	return &AdaptiveShedder{MaxInbound: DefaultMaxInbound, MaxOutbound: DefaultMaxOutbound, MaxCPU: DefaultMaxCPU}
+}
+
+// ShedLevel implements LoadShedder
+func (s *AdaptiveShedder) ShedLevel(load Load, current ShedLevel) ShedLevel {
+	var pressure float64
+	if s.MaxInbound > 0 {
+		pressure = math.Max(pressure, float64(load.Inbound)/float64(s.MaxInbound))
+	}
+	if s.MaxOutbound > 0 {
+		pressure = math.Max(pressure, float64(load.Outbound)/float64(s.MaxOutbound))
+	}
+	if s.MaxCPU > 0 {
+		pressure = math.Max(pressure, load.CPU/s.MaxCPU)
+	}
+
+	level := ShedNone
+	if pressure >= 1 {
+		level = ShedObservers + ShedLevel(math.Min((pressure-1)/shedStep, float64(ShedSync-ShedObservers)))
+	}
+	if level < current {
+		level = current - 1
+	}
+	return level
+}
+
+// LoadStatus is the load last evaluated & the level of load shed
+type LoadStatus struct {
+	Load  Load      `json:"load"`
+	Level ShedLevel `json:"level"`
+}
+
+// SetLoadShedder enables the protection mode, which sheds load progressively
+// under overload to preserve the voting path, as decided by the shedder from
+// the load evaluated every interval: the traffic of the standby nodes first,
+// then the unauthenticated peers, then the state sync serving. A nil shedder
+// disables it. The load is evaluated by the consensus updater, so the
+// interval is at least the interval of updates.
+func (agent *TCPAgent) SetLoadShedder(shedder LoadShedder, interval time.Duration) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.shedder = shedder
+	agent.shedInterval = interval
+	if shedder == nil {
+		agent.load = Load{}
+		agent.setShedLevel(ShedNone)
+	}
+}
+
+// LoadStatus returns the load last evaluated and the level of load shed
+func (agent *TCPAgent) LoadStatus() LoadStatus {
+	agent.Lock()
+	defer agent.Unlock()
+	return LoadStatus{Load: agent.load, Level: agent.shedLevel()}
+}
+
+// LoadHandler serves the LoadStatus as JSON
+func (agent *TCPAgent) LoadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agent.LoadStatus())
+	})
+}
+
+// shedLevel returns the level of load shed, it's read without the lock
+func (agent *TCPAgent) shedLevel() ShedLevel {
+	return ShedLevel(atomic.LoadInt32(&agent.shedding))
+}
+
+// setShedLevel sets the level of load shed, the changes are logged
+func (agent *TCPAgent) setShedLevel(level ShedLevel) {
+	if old := ShedLevel(atomic.SwapInt32(&agent.shedding, int32(level))); old != level {
+		log.Println("load shedding:", old, "->", level)
+	}
+}
+
+// evaluateLoad measures the load and updates the level of load shed, if
+// the interval has passed since the last evaluation.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) evaluateLoad(now time.Time) {
+	if agent.shedder == nil || now.Sub(agent.lastShed) < agent.shedInterval {
+		return
+	}
+
+	load := Load{Inbound: len(agent.consensusMessages)}
+	for _, p := range agent.peers {
+		if n := p.pendingMessages(); n > load.Outbound {
+			load.Outbound = n
+		}
+	}
+	cpu := processCPUTime()
+	if !agent.lastShed.IsZero() && cpu > 0 {
+		load.CPU = (cpu - agent.lastCPU).Seconds() / now.Sub(agent.lastShed).Seconds() / float64(runtime.NumCPU())
+	}
+	agent.lastShed = now
+	agent.lastCPU = cpu
+	agent.load = load
+	agent.setShedLevel(agent.shedder.ShedLevel(load, agent.shedLevel()))
+}
+
+// pendingMessages returns the number of messages queued to this peer
+func (p *TCPPeer) pendingMessages() int {
+	p.Lock()
+	defer p.Unlock()
+	n := len(p.agentMessages)
+	for lane := range p.lanes {
+		n += p.lanes[lane].len()
+	}
+	return n
+}
+
+// deferSync waits until the state sync streams can be served, returns
+// false if the peer has been closed meanwhile.
+func (p *TCPPeer) deferSync() bool {
+	for p.agent.shedLevel() >= ShedSync {
+		select {
+		case <-time.After(syncDeferInterval):
+		case <-p.die:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestAdaptiveShedder(t *testing.T) {
+	s := DefaultLoadShedder()
+	assert.Equal(t, ShedNone, s.ShedLevel(Load{Inbound: DefaultMaxInbound - 1}, ShedNone))
+	assert.Equal(t, ShedObservers, s.ShedLevel(Load{Inbound: DefaultMaxInbound}, ShedNone))
+	assert.Equal(t, ShedObservers, s.ShedLevel(Load{CPU: 0.95}, ShedNone))
+	assert.Equal(t, ShedUnauthenticated, s.ShedLevel(Load{Outbound: DefaultMaxOutbound * 3 / 2}, ShedNone))
+	assert.Equal(t, ShedSync, s.ShedLevel(Load{Inbound: DefaultMaxInbound * 2}, ShedNone))
+	assert.Equal(t, ShedSync, s.ShedLevel(Load{Inbound: DefaultMaxInbound * 100}, ShedNone))
+
+	// restored one level at a time
+	assert.Equal(t, ShedUnauthenticated, s.ShedLevel(Load{}, ShedSync))
+	assert.Equal(t, ShedNone, s.ShedLevel(Load{}, ShedObservers))
+}
+
+type fixedShedder ShedLevel
+
+func (s fixedShedder) ShedLevel(load Load, current ShedLevel) ShedLevel { return ShedLevel(s) }
+
+func TestLoadShedding(t *testing.T) {
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	clientKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+	shed := func(level ShedLevel) {
+		server.SetLoadShedder(fixedShedder(level), 0)
+		server.Lock()
+		server.evaluateLoad(time.Now())
+		server.Unlock()
+		assert.Equal(t, level, server.LoadStatus().Level)
+	}
+	// accepted connections start the handshake, unless refused
+	accepted := func() bool {
+		c1, c2 := net.Pipe()
+		defer c2.Close()
+		go server.accept(c1)
+		c2.SetReadDeadline(time.Now().Add(time.Second))
+		_, err := c2.Read(make([]byte, 1))
+		return err == nil
+	}
+
+	// standby nodes are refused first
+	c1, _ := net.Pipe()
+	p := NewTCPPeer(c1, server)
+	defer p.Close()
+	auth := KeyAuthInit{X: clientKey.PublicKey.X.Bytes(), Y: clientKey.PublicKey.Y.Bytes(), Nonce: newNonce(), Timestamp: time.Now().Unix()}
+	assert.Nil(t, p.handleKeyAuthInit(&auth))
+	p.Lock()
+	p.peerAuthStatus = peerAuthenticated
+	p.Unlock()
+
+	shed(ShedObservers)
+	assert.Equal(t, ErrOverloaded, server.handleReplicaSubscribe(p, 0))
+	assert.True(t, accepted())
+
+	// then the unauthenticated peers
+	shed(ShedUnauthenticated)
+	assert.False(t, accepted())
+
+	// then state sync is deferred until the load drops
+	shed(ShedSync)
+	done := make(chan bool)
+	go func() { done <- p.deferSync() }()
+	select {
+	case <-done:
+		t.Fatal("state sync served under overload")
+	case <-time.After(3 * syncDeferInterval):
+	}
+	shed(ShedNone)
+	assert.True(t, <-done)
+
+	// disabled
+	shed(ShedSync)
+	server.SetLoadShedder(nil, 0)
+	assert.Equal(t, ShedNone, server.LoadStatus().Level)
+	assert.Nil(t, server.handleReplicaSubscribe(p, 0))
+	assert.True(t, accepted())
+}
@@ -0,0 +1,184 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/yonggewang/bdls/internal/identity"
+	"github.com/yonggewang/bdls/transport"
+)
+
+// StaticPeer is a persistent peer in a static peer list
+type StaticPeer struct {
+	Address   string `json:"address"`         // the TCP address to dial
+	PublicKey string `json:"pubkey"`          // hex encoded X|Y of the identity to expect
+	Proxy     string `json:"proxy,omitempty"` // (optional) socks5:// url to dial through
+}
+
+// publicKey decodes the expected identity
+func (sp *StaticPeer) publicKey() (*ecdsa.PublicKey, error) {
+	pubkey, err := identity.Decode(sp.PublicKey)
+	if err != nil {
+		return nil, ErrStaticPeerPublicKey
+	}
+	return pubkey, nil
+}
+
+// dialFunc returns the DialFunc through the proxy, or nil to dial with the
+// transport of the agent.
+func (sp *StaticPeer) dialFunc(agent *TCPAgent) (DialFunc, error) {
+	if sp.Proxy == "" {
+		return nil, nil
+	}
+	tr, err := transport.ParseSOCKS5(sp.Proxy)
+	if err != nil {
+		return nil, ErrStaticPeerProxy
+	}
+	return agent.dialTransport(tr), nil
+}
+
+// LoadStaticPeers loads a static peer list from a json file like:
+//
+//	[{"address": "10.0.0.1:4680", "pubkey": "<hex encoded X|Y>"},
+//	 {"address": "10.0.1.1:4680", "pubkey": "<hex encoded X|Y>", "proxy": "socks5://10.0.0.254:1080"}]
+func LoadStaticPeers(path string) ([]StaticPeer, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []StaticPeer
+	if err := json.Unmarshal(bts, &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// SetStaticPeers replaces the static peers of this agent, new peers are
+// added as persistent peers which must authenticate as their public keys,
+// peers no longer in the list or with changed keys or proxies are
+// disconnected. The list is rejected as a whole if any peer is invalid.
+func (agent *TCPAgent) SetStaticPeers(peers []StaticPeer) error {
+	type staticEntry struct {
+		peer   *StaticPeer
+		pubkey *ecdsa.PublicKey
+		dial   DialFunc
+	}
+
+	entries := make(map[string]*staticEntry)
+	for k := range peers {
+		if peers[k].Address == "" || entries[peers[k].Address] != nil {
+			return ErrStaticPeerAddress
+		}
+		pubkey, err := peers[k].publicKey()
+		if err != nil {
+			return err
+		}
+		dial, err := peers[k].dialFunc(agent)
+		if err != nil {
+			return err
+		}
+		entries[peers[k].Address] = &staticEntry{&peers[k], pubkey, dial}
+	}
+
+	agent.Lock()
+	var removed []string
+	for addr, pp := range agent.persistentPeers {
+		if pp.static != nil {
+			if e, ok := entries[addr]; !ok || !identity.Equal(e.pubkey, pp.expected) || e.peer.Proxy != pp.static.Proxy {
+				removed = append(removed, addr)
+			}
+		}
+	}
+	agent.Unlock()
+
+	for _, addr := range removed {
+		agent.RemovePersistentPeer(addr)
+	}
+	for addr, e := range entries {
+		agent.addPersistentPeer(addr, e.dial, e.pubkey, e.peer)
+	}
+	return nil
+}
+
+// WatchStaticPeers loads the static peer list from path, and reloads it
+// whenever the file changes, checked at every interval, until stop is
+// called or the agent is closed. Failed reloads are logged and the
+// previous list stays in effect.
+func (agent *TCPAgent) WatchStaticPeers(path string, interval time.Duration) (stop func(), err error) {
+	peers, err := LoadStaticPeers(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := agent.SetStaticPeers(peers); err != nil {
+		return nil, err
+	}
+
+	last, _ := os.ReadFile(path)
+	chStop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				bts, err := os.ReadFile(path)
+				if err != nil || bytes.Equal(bts, last) {
+					continue
+				}
+				last = bts
+
+				var peers []StaticPeer
+				if err := json.Unmarshal(bts, &peers); err != nil {
+					log.Println("static peers:", err)
+					continue
+				}
+				if err := agent.SetStaticPeers(peers); err != nil {
+					log.Println("static peers:", err)
+				}
+			case <-chStop:
+				return
+			case <-agent.die:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(chStop) }) }, nil
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/internal/identity"
+)
+
+func staticPeer(addr string, pubkey *ecdsa.PublicKey) StaticPeer {
+	return StaticPeer{Address: addr, PublicKey: identity.Encode(pubkey)}
+}
+
+func TestStaticPeersInvalid(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	agent := newTestAgent(t, key)
+	defer agent.Close()
+
+	sp := staticPeer("127.0.0.1:1", &key.PublicKey)
+	assert.Equal(t, ErrStaticPeerAddress, agent.SetStaticPeers([]StaticPeer{sp, sp}))
+	assert.Equal(t, ErrStaticPeerAddress, agent.SetStaticPeers([]StaticPeer{{PublicKey: sp.PublicKey}}))
+	assert.Equal(t, ErrStaticPeerPublicKey, agent.SetStaticPeers([]StaticPeer{{Address: sp.Address, PublicKey: "00"}}))
+	assert.Equal(t, ErrStaticPeerProxy, agent.SetStaticPeers([]StaticPeer{{Address: sp.Address, PublicKey: sp.PublicKey, Proxy: "http://127.0.0.1:8080"}}))
+
+	// a point off the curve
+	bad := []byte(sp.PublicKey)
+	if bad[len(bad)-1] == '0' {
+		bad[len(bad)-1] = '1'
+	} else {
+		bad[len(bad)-1] = '0'
+	}
+	assert.Equal(t, ErrStaticPeerPublicKey, agent.SetStaticPeers([]StaticPeer{{Address: sp.Address, PublicKey: string(bad)}}))
+
+	agent.Lock()
+	assert.Equal(t, 0, len(agent.persistentPeers))
+	agent.Unlock()
+}
+
+func TestStaticPeersReload(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	clientKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	serverA := newTestAgent(t, keyA)
+	defer serverA.Close()
+	serverB := newTestAgent(t, keyB)
+	defer serverB.Close()
+	client := newTestAgent(t, clientKey)
+	defer client.Close()
+	client.SetBackoff(&BackoffConfig{Initial: 10 * time.Millisecond, Max: 100 * time.Millisecond, Multiplier: 2})
+
+	lA, err := serverA.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+	lB, err := serverB.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+
+	// connected waits until the client has exactly the peer with the public key
+	connected := func(pubkey *ecdsa.PublicKey) bool {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			client.Lock()
+			ok := len(client.peers) == 1 && identity.Equal(client.peers[0].GetPublicKey(), pubkey)
+			client.Unlock()
+			if ok {
+				return true
+			}
+			<-time.After(20 * time.Millisecond)
+		}
+		return false
+	}
+
+	writeList := func(path string, peers ...StaticPeer) {
+		bts, err := json.Marshal(peers)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(path, bts, 0600))
+	}
+
+	path := filepath.Join(t.TempDir(), "peers.json")
+	writeList(path, staticPeer(lA.Addr().String(), &keyA.PublicKey))
+	loaded, err := LoadStaticPeers(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []StaticPeer{staticPeer(lA.Addr().String(), &keyA.PublicKey)}, loaded)
+
+	stop, err := client.WatchStaticPeers(path, 20*time.Millisecond)
+	assert.Nil(t, err)
+	defer stop()
+	assert.True(t, connected(&keyA.PublicKey))
+
+	// swap A for B
+	writeList(path, staticPeer(lB.Addr().String(), &keyB.PublicKey))
+	assert.True(t, connected(&keyB.PublicKey))
+
+	// a broken file keeps the previous list
+	assert.Nil(t, os.WriteFile(path, []byte("{"), 0600))
+	<-time.After(100 * time.Millisecond)
+	assert.True(t, connected(&keyB.PublicKey))
+
+	// a static peer with an unexpected identity never joins
+	writeList(path, staticPeer(lA.Addr().String(), &keyB.PublicKey))
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		client.Lock()
+		n := len(client.peers)
+		client.Unlock()
+		if n == 0 {
+			break
+		}
+		<-time.After(20 * time.Millisecond)
+	}
+	<-time.After(200 * time.Millisecond)
+	client.Lock()
+	assert.Equal(t, 0, len(client.peers))
+	client.Unlock()
+}
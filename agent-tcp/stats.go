@@ -0,0 +1,191 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/yonggewang/bdls"
+)
+
+// Traffic is the number of frames and their bytes on the wire, including the
+// length prefixes, the bytes are counted before decompression.
+type Traffic struct {
+	SentMessages     uint64 `json:"sent_messages"`
+	SentBytes        uint64 `json:"sent_bytes"`
+	ReceivedMessages uint64 `json:"received_messages"`
+	ReceivedBytes    uint64 `json:"received_bytes"`
+}
+
+// PeerStats is the traffic with a connected peer
+type PeerStats struct {
+	Address  string             `json:"address"`
+	Identity string             `json:"identity,omitempty"` // hex encoded, empty if not authenticated
+	Observer bool               `json:"observer,omitempty"`
+	Traffic                     // total of the commands
+	Commands map[string]Traffic `json:"commands"` // by command type
+}
+
+// Stats is the traffic of an agent, the totals include the peers
+// disconnected.
+type Stats struct {
+	Traffic
+	Commands map[string]Traffic `json:"commands"`
+	Peers    []PeerStats        `json:"peers"`
+
+	// the consensus messages dropped as duplicates before verification
+	Duplicates uint64 `json:"duplicates"`
+
+	// the time spent in the hot path, if the consensus has a profiler
+	Profile []bdls.PhaseProfile `json:"profile,omitempty"`
+}
+
+// trafficCounter counts frames of a command in one direction
+type trafficCounter struct {
+	messages uint64
+	bytes    uint64
+}
+
+// trafficCounters counts frames by command, updated atomically
+type trafficCounters struct {
+	sent     []trafficCounter
+	received []trafficCounter
+}
+
+func newTrafficCounters() *trafficCounters {
+	return &trafficCounters{
+		sent:     make([]trafficCounter, len(CommandType_name)),
+		received: make([]trafficCounter, len(CommandType_name)),
+	}
+}
+
+// count adds a frame of n bytes to the counter of the command, unknown
+// commands are not counted.
+func count(counters []trafficCounter, command CommandType, n int) {
+	if command < 0 || int(command) >= len(counters) {
+		return
+	}
+	atomic.AddUint64(&counters[command].messages, 1)
+	atomic.AddUint64(&counters[command].bytes, uint64(n))
+}
+
+// snapshot returns the total & the traffic by command
+func (c *trafficCounters) snapshot() (total Traffic, commands map[string]Traffic) {
+	commands = make(map[string]Traffic)
+	for k := range c.sent {
+		t := Traffic{
+			SentMessages:     atomic.LoadUint64(&c.sent[k].messages),
+			SentBytes:        atomic.LoadUint64(&c.sent[k].bytes),
+			ReceivedMessages: atomic.LoadUint64(&c.received[k].messages),
+			ReceivedBytes:    atomic.LoadUint64(&c.received[k].bytes),
+		}
+		if t == (Traffic{}) {
+			continue
+		}
+		commands[CommandType(k).String()] = t
+		total.SentMessages += t.SentMessages
+		total.SentBytes += t.SentBytes
+		total.ReceivedMessages += t.ReceivedMessages
+		total.ReceivedBytes += t.ReceivedBytes
+	}
+	return total, commands
+}
+
+// Stats returns the traffic of this agent and it's peers by command, to
+// spot asymmetric or abusive peers, and the profile of the consensus.
+func (agent *TCPAgent) Stats() *Stats {
+	agent.Lock()
+	peers := append([]*TCPPeer(nil), agent.peers...)
+	duplicates := agent.duplicates
+	agent.Unlock()
+
+	stats := new(Stats)
+	stats.Traffic, stats.Commands = agent.traffic.snapshot()
+	stats.Duplicates = duplicates
+	for _, p := range peers {
+		ps := PeerStats{Address: p.RemoteAddr().String(), Observer: p.Observer()}
+		if key := p.GetPublicKey(); key != nil {
+			id := bdls.DefaultPubKeyToIdentity(key)
+			ps.Identity = hex.EncodeToString(id[:])
+		}
+		ps.Traffic, ps.Commands = p.traffic.snapshot()
+		stats.Peers = append(stats.Peers, ps)
+	}
+	stats.Profile = agent.consensus.Profiler().Profile()
+	return stats
+}
+
+// StatsHandler serves Stats as json, for the admin API
+func (agent *TCPAgent) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agent.Stats())
+	})
+}
+
+// countSent counts a frame of bts sent to the peer
+func (p *TCPPeer) countSent(command CommandType, bts []byte) {
+	n := MessageLength + len(bts)
+	count(p.traffic.sent, command, n)
+	count(p.agent.traffic.sent, command, n)
+	if sink := p.agent.getMetricsSink(); sink != nil {
+		sink.FrameSent(p.RemoteAddr(), command, n)
+	}
+}
+
+// countReceived counts a frame of bts received from the peer
+func (p *TCPPeer) countReceived(command CommandType, bts []byte) {
+	n := MessageLength + len(bts)
+	count(p.traffic.received, command, n)
+	count(p.agent.traffic.received, command, n)
+	if sink := p.agent.getMetricsSink(); sink != nil {
+		sink.FrameReceived(p.RemoteAddr(), command, n)
+	}
+}
+
+// gossipCommand returns the command of a marshalled Gossip
+func gossipCommand(bts []byte) CommandType {
+	var b proto.Buffer
+	b.SetBuf(bts)
+	wire, ok := scanField(&b, 1)
+	if !ok || wire != proto.WireVarint {
+		return CommandType_NOP
+	}
+	command, err := b.DecodeVarint()
+	if err != nil {
+		return CommandType_NOP
+	}
+	return CommandType(command)
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestStats(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a := newTestAgent(t, keyA)
+	defer a.Close()
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+
+	c1, c2 := net.Pipe()
+	pa := NewTCPPeer(c1, a)
+	pb := NewTCPPeer(c2, b)
+	assert.True(t, a.AddPeer(pa))
+	assert.True(t, b.AddPeer(pb))
+	pa.InitiatePublicKeyAuthentication()
+	pb.InitiatePublicKeyAuthentication()
+	assert.Nil(t, a.waitAuthenticated(pa, &keyB.PublicKey, time.Second, nil))
+	assert.Nil(t, b.waitAuthenticated(pb, &keyA.PublicKey, time.Second, nil))
+	pa.ping()
+
+	// the frames sent by one side are received by the other
+	assert.Eventually(t, func() bool {
+		sa, sb := a.Stats(), b.Stats()
+		return sa.Commands["LATENCY_PONG"].ReceivedMessages == 1 &&
+			sa.SentBytes == sb.ReceivedBytes && sb.SentBytes == sa.ReceivedBytes
+	}, time.Second, 10*time.Millisecond)
+
+	stats := a.Stats()
+	assert.Equal(t, 1, len(stats.Peers))
+	peer := stats.Peers[0]
+	id := bdls.DefaultPubKeyToIdentity(&keyB.PublicKey)
+	assert.Equal(t, hex.EncodeToString(id[:]), peer.Identity)
+	assert.Equal(t, stats.Traffic, peer.Traffic)
+	assert.Equal(t, uint64(1), peer.Commands["KEY_AUTH_INIT"].SentMessages)
+	assert.Equal(t, uint64(1), peer.Commands["KEY_AUTH_INIT"].ReceivedMessages)
+	assert.Equal(t, uint64(1), peer.Commands["LATENCY_PING"].SentMessages)
+	assert.Equal(t, uint64(0), peer.Commands["LATENCY_PING"].ReceivedMessages)
+
+	// the totals are kept after the peer is gone
+	pa.Close()
+	a.RemovePeer(pa)
+	assert.Equal(t, 0, len(a.Stats().Peers))
+	assert.Equal(t, stats.Traffic, a.Stats().Traffic)
+}
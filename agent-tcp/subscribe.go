@@ -0,0 +1,206 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/codec"
+)
+
+const (
+	// DefaultSubscriptionBuffer is the number of live decisions buffered for
+	// a subscriber, a subscriber falling behind further is dropped.
+	DefaultSubscriptionBuffer = 64
+)
+
+// Decision is a decided height delivered to subscribers
+type Decision struct {
+	Height uint64     `json:"height"`
+	Round  uint64     `json:"round"`
+	State  bdls.State `json:"state"`
+	Proof  []byte     `json:"proof"` // marshalled SignedProto of the <decide> message
+
+	// the participants whose <commit> messages are in the proof, for
+	// rewards & penalties downstream
+	Participation Bitmap `json:"participation"`
+}
+
+// Decode unmarshals the state proposed by ProposeValue into v, with the
+// codec it's tagged with.
+func (d *Decision) Decode(v interface{}) error { return codec.Decode(d.State, v) }
+
+// DecisionSubscription delivers decisions in order of height, without gaps
+// or duplicates, C is closed when the subscription ends.
+type DecisionSubscription struct {
+	C <-chan *Decision
+
+	c     chan *Decision
+	agent *TCPAgent
+	err   error
+	once  sync.Once
+}
+
+// SubscribeHeights delivers the kept decisions from fromHeight, then switches
+// to the live decisions seamlessly, so a consumer can resume from the height
+// after the last one it has processed. 0 starts from the oldest decision kept.
+//
+// It returns ErrHeightPruned if fromHeight is older than the decisions kept,
+// see SetReplicaHistory.
+func (agent *TCPAgent) SubscribeHeights(fromHeight uint64) (*DecisionSubscription, error) {
+	agent.Lock()
+	defer agent.Unlock()
+
+	earliest := agent.decidedHeight + 1
+	if len(agent.decisions) > 0 {
+		earliest = agent.decisions[0].height
+	}
+	if fromHeight != 0 && fromHeight < earliest {
+		return nil, ErrHeightPruned
+	}
+
+	var history []*Decision
+	for k := range agent.decisions {
+		if record := agent.decisions[k]; record.height >= fromHeight {
+			history = append(history, &Decision{Height: record.height, Round: record.round, State: record.state, Proof: record.bts, Participation: record.participation})
+		}
+	}
+
+	sub := &DecisionSubscription{agent: agent}
+	sub.c = make(chan *Decision, len(history)+DefaultSubscriptionBuffer)
+	sub.C = sub.c
+	for _, d := range history {
+		sub.c <- d
+	}
+
+	select {
+	case <-agent.die:
+		sub.end(nil)
+	default:
+		agent.subscriptions[sub] = true
+	}
+	return sub, nil
+}
+
+// Err returns why the subscription ended after C has been closed, nil if
+// it was closed, or ErrSubscriptionOverflow if the subscriber fell behind.
+func (sub *DecisionSubscription) Err() error { return sub.err }
+
+// Close ends the subscription
+func (sub *DecisionSubscription) Close() {
+	sub.agent.Lock()
+	defer sub.agent.Unlock()
+	delete(sub.agent.subscriptions, sub)
+	sub.end(nil)
+}
+
+// end closes C with err.
+// NOTE: agent lock must be held.
+func (sub *DecisionSubscription) end(err error) {
+	sub.once.Do(func() {
+		sub.err = err
+		close(sub.c)
+	})
+}
+
+// publishDecision delivers a decision to subscribers, the ones whose buffer
+// is full are dropped rather than blocking the consensus.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) publishDecision(d *Decision) {
+	for sub := range agent.subscriptions {
+		select {
+		case sub.c <- d:
+		default:
+			delete(agent.subscriptions, sub)
+			sub.end(ErrSubscriptionOverflow)
+		}
+	}
+}
+
+// closeSubscriptions ends all subscriptions.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) closeSubscriptions() {
+	for sub := range agent.subscriptions {
+		delete(agent.subscriptions, sub)
+		sub.end(nil)
+	}
+}
+
+// DecisionsHandler streams decisions as json lines for the admin API, from
+// the height in the query parameter "from", see SubscribeHeights.
+func (agent *TCPAgent) DecisionsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var fromHeight uint64
+		if from := r.URL.Query().Get("from"); from != "" {
+			var err error
+			if fromHeight, err = strconv.ParseUint(from, 10, 64); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		sub, err := agent.SubscribeHeights(fromHeight)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		enc := json.NewEncoder(w)
+		for {
+			select {
+			case d, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if err := enc.Encode(d); err != nil {
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
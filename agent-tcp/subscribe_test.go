@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestSubscribeHeights(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	agent := newTestAgent(t, key)
+	defer agent.Close()
+
+	// decide advances the agent as if the consensus has decided a height
+	decide := func(height uint64) {
+		agent.Lock()
+		defer agent.Unlock()
+		state := []byte{byte(height)}
+		agent.decisions = append(agent.decisions, decisionRecord{height: height, state: state})
+		agent.trimDecisions()
+		agent.decidedHeight = height
+		agent.publishDecision(&Decision{Height: height, State: state})
+	}
+
+	agent.SetReplicaHistory(3)
+	for h := uint64(1); h <= 5; h++ {
+		decide(h)
+	}
+
+	// heights 1 & 2 have been pruned
+	_, err = agent.SubscribeHeights(2)
+	assert.Equal(t, ErrHeightPruned, err)
+
+	// replayed from 4, then live
+	sub, err := agent.SubscribeHeights(4)
+	assert.Nil(t, err)
+	decide(6)
+	for h := uint64(4); h <= 6; h++ {
+		d := <-sub.C
+		assert.Equal(t, h, d.Height)
+		assert.Equal(t, bdls.State{byte(h)}, d.State)
+	}
+	sub.Close()
+	_, ok := <-sub.C
+	assert.False(t, ok)
+	assert.Nil(t, sub.Err())
+
+	// the next height is not pruned even if it's not decided yet
+	sub, err = agent.SubscribeHeights(7)
+	assert.Nil(t, err)
+
+	// a subscriber falling behind is dropped
+	for h := uint64(7); h < 7+DefaultSubscriptionBuffer+1; h++ {
+		decide(h)
+	}
+	n := 0
+	for range sub.C {
+		n++
+	}
+	assert.Equal(t, DefaultSubscriptionBuffer, n)
+	assert.Equal(t, ErrSubscriptionOverflow, sub.Err())
+
+	// streamed as json lines by the admin API
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	go http.Serve(l, agent.DecisionsHandler())
+	url := "http://" + l.Addr().String()
+
+	height := uint64(7 + DefaultSubscriptionBuffer)
+	resp, err := http.Get(url + "?from=" + strconv.FormatUint(height, 10))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	var d Decision
+	assert.Nil(t, dec.Decode(&d))
+	assert.Equal(t, height, d.Height)
+	go decide(height + 1)
+	assert.Nil(t, dec.Decode(&d))
+	assert.Equal(t, height+1, d.Height)
+
+	resp, err = http.Get(url + "?from=1")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+	resp.Body.Close()
+
+	// subscriptions end on close
+	sub, err = agent.SubscribeHeights(0)
+	assert.Nil(t, err)
+	agent.Close()
+	for range sub.C {
+	}
+	assert.Nil(t, sub.Err())
+}
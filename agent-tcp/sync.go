@@ -0,0 +1,144 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	"time"
+
+	"github.com/yonggewang/bdls"
+)
+
+const (
+	// DefaultSyncBatch is the default number of decisions requested at once
+	// by a lagging node
+	DefaultSyncBatch = 64
+
+	// syncInterval is the interval to request again if the peer didn't
+	// answer, or had no decisions to catch up with
+	syncInterval = time.Second
+)
+
+// SetStateSync enables catching up with the network, the decisions of the
+// heights missed are requested from the peers once this node lags behind,
+// t+1 participants have been seen deciding beyond the next height, then the
+// <decide> messages are verified and fast-forward the consensus one height
+// after another. The heights older than the decisions kept by the peers, see
+// SetReplicaHistory, are skipped by the latest <decide> message, so they
+// must be fetched by the application, like from package snapshot. Enabled
+// by default.
+func (agent *TCPAgent) SetStateSync(enable bool) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.stateSync = enable
+}
+
+// requestSync requests the decisions this node has missed from the peer
+// most ahead, if it's lagging behind, at most one batch at a time.
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) requestSync(now time.Time) {
+	if !agent.stateSync || agent.replica {
+		return
+	}
+	height, _, _ := agent.consensus.CurrentState()
+	if agent.networkHeight() <= height+1 {
+		return
+	}
+	// wait for the batch requested, unless it's been applied
+	if now.Before(agent.syncRetry) && height < agent.syncUntil {
+		return
+	}
+
+	var peer *TCPPeer
+	var peerHeight uint64
+	for _, p := range agent.peers {
+		key := p.GetPublicKey()
+		if key == nil || p.Observer() {
+			continue
+		}
+		if h := agent.peerHeights[bdls.DefaultPubKeyToIdentity(key)]; peer == nil || h > peerHeight {
+			peer, peerHeight = p, h
+		}
+	}
+	if peer == nil {
+		return
+	}
+
+	peer.sendAgentMessage(CommandType_SYNC_REQUEST, &SyncRequest{FromHeight: height + 1, Limit: DefaultSyncBatch})
+	agent.syncRetry = now.Add(syncInterval)
+	agent.syncUntil = height + DefaultSyncBatch
+}
+
+// handleSyncRequest sends the kept decisions from the height requested to
+// an authenticated peer, at most DefaultSyncBatch of them.
+func (agent *TCPAgent) handleSyncRequest(p *TCPPeer, m *SyncRequest) error {
+	if p.GetPublicKey() == nil {
+		return ErrSyncNotAuthenticated
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.shedLevel() >= ShedObservers {
+		return nil
+	}
+
+	limit := int(m.Limit)
+	if limit <= 0 || limit > DefaultSyncBatch {
+		limit = DefaultSyncBatch
+	}
+	p.Lock()
+	defer p.Unlock()
+	for k := range agent.decisions {
+		if limit == 0 {
+			break
+		}
+		if agent.decisions[k].height >= m.FromHeight {
+			p.enqueueDecision(CommandType_SYNC_DECISION, agent.decisions[k].bts)
+			limit--
+		}
+	}
+	return nil
+}
+
+// handleSyncDecision queues a <decide> message requested to be applied by
+// the consensus, the proofs are verified there, and neither the message nor
+// the <roundchange> of each height synced is sent to the other peers.
+func (agent *TCPAgent) handleSyncDecision(p *TCPPeer, bts []byte) {
+	if agent.replica {
+		return
+	}
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.draining {
+		return
+	}
+	agent.consensusMessages = append(agent.consensusMessages, inboundMessage{bts: bts, from: p, synced: true})
+	agent.notifyConsensus()
+}
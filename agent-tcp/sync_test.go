@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	io "io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestStateSync(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	agents := make([]*TCPAgent, len(participants))
+	for i := range participants {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = participants[i]
+		config.Participants = coords
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		consensus.SetLatency(200 * time.Millisecond)
+		agents[i] = NewTCPAgent(consensus, participants[i])
+		defer agents[i].Close()
+		agents[i].Update()
+	}
+
+	connect := func(i, j int) {
+		c1, c2 := net.Pipe()
+		p1 := NewTCPPeer(c1, agents[i])
+		p2 := NewTCPPeer(c2, agents[j])
+		assert.True(t, agents[i].AddPeer(p1))
+		assert.True(t, agents[j].AddPeer(p2))
+		p1.InitiatePublicKeyAuthentication()
+		p2.InitiatePublicKeyAuthentication()
+	}
+
+	propose := func(n int) {
+		for i := 0; i < n; i++ {
+			data := make([]byte, 1024)
+			io.ReadFull(rand.Reader, data)
+			assert.Nil(t, agents[i].Propose(data))
+		}
+	}
+
+	waitHeight := func(agent *TCPAgent, height uint64, timeout time.Duration) uint64 {
+		deadline := time.Now().Add(timeout)
+		for time.Now().Before(deadline) {
+			if h, _, _ := agent.GetLatestState(); h >= height {
+				return h
+			}
+			<-time.After(20 * time.Millisecond)
+		}
+		h, _, _ := agent.GetLatestState()
+		return h
+	}
+
+	// a quorum decides some heights without the last participant
+	last := len(agents) - 1
+	for i := 0; i < last; i++ {
+		for j := i + 1; j < last; j++ {
+			connect(i, j)
+		}
+	}
+	<-time.After(time.Second)
+
+	const heights = 3
+	for h := uint64(1); h <= heights; h++ {
+		propose(last)
+		for i := 0; i < last; i++ {
+			assert.Equal(t, h, waitHeight(agents[i], h, 20*time.Second))
+		}
+	}
+
+	// one of the quorum goes away, the next height can't be decided until
+	// the lagging participant has caught up with the others
+	agents[last-1].Close()
+	for i := 0; i < last-1; i++ {
+		connect(i, last)
+	}
+	<-time.After(time.Second)
+	propose(last - 1)
+
+	assert.Equal(t, uint64(heights), waitHeight(agents[last], heights, 20*time.Second))
+
+	// every height missed has been caught up with, one by one
+	sub, err := agents[last].SubscribeHeights(1)
+	assert.Nil(t, err)
+	for h := uint64(1); h <= heights; h++ {
+		d := <-sub.C
+		assert.Equal(t, h, d.Height)
+	}
+	sub.Close()
+
+	// then it takes part in deciding the next height
+	data := make([]byte, 1024)
+	io.ReadFull(rand.Reader, data)
+	assert.Nil(t, agents[last].Propose(data))
+	for _, i := range []int{0, last} {
+		assert.Equal(t, uint64(heights+1), waitHeight(agents[i], heights+1, 20*time.Second))
+	}
+}
+
+func TestStateSyncNotAuthenticated(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	agent := newTestAgent(t, privateKey)
+	defer agent.Close()
+
+	c1, _ := net.Pipe()
+	p := NewTCPPeer(c1, agent)
+	defer p.Close()
+	assert.Equal(t, ErrSyncNotAuthenticated, agent.handleSyncRequest(p, &SyncRequest{FromHeight: 1, Limit: 1}))
+}
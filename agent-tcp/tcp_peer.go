@@ -38,12 +38,17 @@ import (
 	"math/big"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
+	"github.com/libp2p/go-yamux/v5"
 	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/codec"
 	"github.com/yonggewang/bdls/crypto/blake2b"
+	"github.com/yonggewang/bdls/telemetry"
 	"github.com/yonggewang/bdls/timer"
+	"github.com/yonggewang/bdls/transport"
 	proto "github.com/gogo/protobuf/proto"
 )
 
@@ -55,12 +60,17 @@ const (
 	// Message max length(32MB)
 	MaxMessageLength = 32 * 1024 * 1024
 
-	// timeout for a unresponsive connection
+	// default timeouts to read & write a chunk of a frame
 	defaultReadTimeout  = 60 * time.Second
 	defaultWriteTimeout = 60 * time.Second
 
 	// challengeSize
 	challengeSize = 1024
+
+	// frames are written and read in chunks with their own deadlines
+	ioChunkSize = 64 * 1024
+	// default min throughput of a connection in bytes/sec
+	DefaultMinThroughput = 64 * 1024
 )
 
 // authenticationState is the authentication status for both peer
@@ -73,6 +83,9 @@ const (
 	// peerSentAuthkey: the peer begined it's public key authentication,
 	// and we've sent out our challenge.
 	peerAuthkeyReceived
+	// peerAuthVerified: the peer has proved it's key, and is waiting for
+	// our authentication to be confirmed, if mutual authentication is on.
+	peerAuthVerified
 	// peerAuthenticated: the peer has been authenticated to it's public key
 	peerAuthenticated
 	// peer failed to accept our challenge
@@ -86,34 +99,309 @@ const (
 	localAuthKeySent
 	// localChallengeAccepted: we have received challenge from peer and responded
 	localChallengeAccepted
+	// localAuthConfirmed: the peer has confirmed our response
+	localAuthConfirmed
 )
 
 // A TCPAgent binds consensus core to a TCPAgent object, which may have multiple TCPPeer
 type TCPAgent struct {
-	consensus           *bdls.Consensus   // the consensus core
-	privateKey          *ecdsa.PrivateKey // a private key to sign messages
-	peers               []*TCPPeer        // connected peers
-	consensusMessages   [][]byte          // all consensus message awaiting to be processed
-	chConsensusMessages chan struct{}     // notification of new consensus message
+	consensus           Consensus                // the consensus core
+	privateKey          *ecdsa.PrivateKey        // the transport key to authenticate to peers
+	linkage             *KeyLinkage              // (optional) statement to link the transport key to a validator key
+	linkageSequences    map[bdls.Identity]uint64 // the highest key linkage sequence seen for each validator
+	peers               []*TCPPeer               // connected peers
+	consensusMessages   []inboundMessage         // all consensus message awaiting to be processed
+	received            *digestCache             // the digests of the consensus messages processed
+	duplicates          uint64                   // the consensus messages dropped as duplicates
+	chConsensusMessages chan struct{}            // notification of new consensus message
+
+	// replication
+	replica       bool                           // set if this agent is a standby node following decisions
+	replicaKeys   map[bdls.Identity]bool         // (optional) public keys allowed to subscribe as standby nodes
+	observerKeys  map[bdls.Identity]bool         // (optional) public keys allowed to observe
+	decisions     []decisionRecord               // recent decisions for standby nodes to catch up
+	maxDecisions  int                            // max number of decisions kept
+	decidedHeight uint64                         // the latest height recorded in decisions
+	subscriptions map[*DecisionSubscription]bool // local subscribers to decisions
+	maxReplicas   int                            // (optional) max number of standby nodes served directly
+	relay         *ReplicaRelay                  // (optional) the relay announced by this standby node
+
+	// height catch-up, the requests are retried after syncRetry, or once
+	// the height has reached syncUntil
+	stateSync bool
+	syncRetry time.Time
+	syncUntil uint64
+
+	// outbound peers owned by the agent
+	persistentPeers map[string]*persistentPeer // persistent peers by address
+	backoff         *BackoffConfig             // backoff to re-dial persistent peers
+
+	minWriteThroughput int // the min throughput in bytes/sec to extend write deadlines
+	minReadThroughput  int // the min throughput in bytes/sec to extend read deadlines
+
+	options           transportOptions    // the deadlines & max frame size of the connections
+	keepaliveInterval time.Duration       // (optional) the interval of keepalives on idle connections
+	keepaliveMisses   int                 // the number of intervals without frames to declare a peer dead
+	signatureOffload  bool                // skip verifying signatures of messages from their signers' connections
+	flood             bool                // relay the consensus messages received to the other peers
+	dialer            transport.Transport // (optional) the transport to dial peers through
+
+	// (optional) the port to dial from for NAT traversal, and the hole
+	// punches awaiting the rendezvous by nonce
+	punchPort int
+	punches   map[uint64]*pendingPunch
+
+	// (optional) the gateway mapping the ports listened on, and the ports
+	// mapped by their mappers
+	portMapper  PortMapper
+	mappedPorts map[int]PortMapper
+
+	// (optional) the protection mode, deciding the level of load shed from
+	// the load evaluated every interval, the level is accessed atomically
+	shedder      LoadShedder
+	shedInterval time.Duration
+	shedding     int32
+	load         Load
+	lastShed     time.Time
+	lastCPU      time.Duration
+
+	// the keys of the operators allowed on the control channel
+	operators map[bdls.Identity]bool
+
+	// compressions offered to peers & the min size of messages to compress
+	compressions         []CompressionType
+	compressionThreshold int
+
+	// frames sent & received by command, including the peers disconnected
+	traffic *trafficCounters
+
+	// the max age & bytes of session keys
+	rekeyInterval time.Duration
+	rekeyBytes    int64
+
+	// (optional) pad the sealed frames, and the mean interval of the cover
+	// NOPs
+	padding       bool
+	coverInterval time.Duration
+
+	// misbehavior scores & bans by host
+	banThreshold int
+	banDuration  time.Duration
+	scores       map[string]*peerScore
+	bans         map[string]*Ban
+
+	// (optional) the max of inbound connections & the policy to make room
+	// for new ones, and the inbound connections by the time accepted
+	maxConns int
+	eviction EvictionPolicy
+	inbound  map[*TCPPeer]time.Time
+
+	// the connection kept of the ones authenticated to the same key
+	duplicatePolicy DuplicatePolicy
+
+	// (optional) the addresses dialed & the bans kept on disk
+	addressBook *addressBook
+
+	// the nonces of the handshakes seen, until they expire
+	authNonces map[string]time.Time
+	// peers are authenticated after both sides have proved their keys
+	mutualAuth bool
+
+	// (optional) the curves of the keys accepted from peers, all by default
+	curves map[Curve]bool
+
+	// optional features supported, gated & activated by a quorum
+	features       map[Feature]bool
+	featureGates   map[Feature]bool
+	activated      map[Feature]bool
+	activeFeatures atomic.Value // map[Feature]bool, read without the lock
+
+	// the sink of the transport telemetry, read without the lock
+	metricsSink atomic.Value // metricsSinkValue
+
+	// local subscribers to peer events, under their own lock as the events
+	// are published with the agent or peer lock held
+	peerEventSubs map[*PeerEventSubscription]bool
+	eventsLock    sync.Mutex
+
+	// access control lists of networks & public keys
+	allowNets []*net.IPNet
+	denyNets  []*net.IPNet
+	allowKeys map[bdls.Identity]bool
+	denyKeys  map[bdls.Identity]bool
+
+	// liveness & readiness, the heights beyond the next one seen from
+	// participants, and the unix nanoseconds of the last update & the max
+	// stall, accessed atomically
+	maxSyncLag  uint64
+	peerHeights map[bdls.Identity]uint64
+	lastUpdate  int64
+	maxStall    int64
+
+	// proposer fairness audit, the proposals seen for the next height and
+	// the recent epochs
+	fairnessEpoch     uint64
+	fairnessThreshold float64
+	fairness          []*fairnessEpoch
+	proposals         map[bdls.StateHash]map[bdls.Identity]bool
+	proposalHeight    uint64
+
+	// the metrics of the recent heights, the time of the last decision and
+	// the records pending to the store
+	history      []HeightMetrics
+	maxHistory   int
+	lastDecided  time.Time
+	metricsQueue chan []byte
+
+	// planned downtime of this node and peers
+	maintenance map[bdls.Identity]*maintenanceWindow
+
+	// round trip times advertised by peers, rows expire after latencyTTL
+	latencies  map[bdls.Identity]*latencyRow
+	latencyTTL time.Duration
+
+	// set by Shutdown, new messages & proposals are not accepted
+	draining bool
+
+	// multiplexing of the connections & the handlers of the inbound streams
+	mux            bool
+	streamHandlers map[Channel]StreamHandler
+
+	// states of closed peers, kept for them to reconnect
+	migrations       map[bdls.Identity]*peerState
+	migrationTimeout time.Duration
+
+	telemetry *telemetry.Controls // sampling & cardinality controls of telemetry
 
 	die        chan struct{} // tcp agent closing
 	dieOnce    sync.Once
 	sync.Mutex // fields lock
 }
 
-// NewTCPAgent initiate a TCPAgent which talks consensus protocol with peers
-func NewTCPAgent(consensus *bdls.Consensus, privateKey *ecdsa.PrivateKey) *TCPAgent {
+// NewTCPAgent initiate a TCPAgent which talks consensus protocol with peers,
+// the privateKey is used to authenticate to peers, which could be the validator
+// key itself, or a transport key linked via SetKeyLinkage. The deadlines &
+// the max frame size of the connections can be set by opts.
+func NewTCPAgent(consensus Consensus, privateKey *ecdsa.PrivateKey, opts ...Option) *TCPAgent {
 	agent := new(TCPAgent)
 	agent.consensus = consensus
 	agent.privateKey = privateKey
+	agent.linkageSequences = make(map[bdls.Identity]uint64)
+	agent.received = newDigestCache(receivedCacheSize)
+	agent.maxDecisions = DefaultReplicaHistory
+	agent.subscriptions = make(map[*DecisionSubscription]bool)
+	agent.peerEventSubs = make(map[*PeerEventSubscription]bool)
+	agent.decidedHeight, _, _ = consensus.CurrentState()
+	agent.persistentPeers = make(map[string]*persistentPeer)
+	agent.backoff = DefaultBackoffConfig()
+	agent.minWriteThroughput = DefaultMinThroughput
+	agent.minReadThroughput = DefaultMinThroughput
+	agent.options = defaultTransportOptions()
+	for _, opt := range opts {
+		opt(&agent.options)
+	}
+	agent.migrations = make(map[bdls.Identity]*peerState)
+	agent.latencies = make(map[bdls.Identity]*latencyRow)
+	agent.maintenance = make(map[bdls.Identity]*maintenanceWindow)
+	agent.traffic = newTrafficCounters()
+	agent.scores = make(map[string]*peerScore)
+	agent.bans = make(map[string]*Ban)
+	agent.inbound = make(map[*TCPPeer]time.Time)
+	agent.authNonces = make(map[string]time.Time)
+	agent.punches = make(map[uint64]*pendingPunch)
+	agent.mappedPorts = make(map[int]PortMapper)
+	agent.shedInterval = DefaultShedInterval
+	agent.mutualAuth = true
+	agent.rekeyInterval = DefaultRekeyInterval
+	agent.rekeyBytes = DefaultRekeyBytes
+	agent.featureGates = make(map[Feature]bool)
+	agent.activated = make(map[Feature]bool)
+	agent.compressions = defaultCompressions
+	agent.compressionThreshold = DefaultCompressionThreshold
+	agent.migrationTimeout = DefaultMigrationTimeout
+	agent.maxSyncLag = DefaultMaxSyncLag
+	agent.stateSync = true
+	agent.fairnessEpoch = DefaultFairnessEpoch
+	agent.fairnessThreshold = DefaultFairnessThreshold
+	agent.maxHistory = DefaultMaxHistory
+	agent.proposalHeight = agent.decidedHeight + 1
+	agent.peerHeights = make(map[bdls.Identity]uint64)
+	agent.maxStall = int64(DefaultMaxStall)
+	agent.lastUpdate = time.Now().UnixNano()
+	agent.telemetry = telemetry.NewControls()
 	agent.die = make(chan struct{})
 	agent.chConsensusMessages = make(chan struct{}, 1)
+	agent.SetFeatures(defaultFeatures...)
 	go agent.inputConsensusMessage()
 	return agent
 }
 
-// AddPeer adds a peer to this agent
+// SetKeyLinkage sets a statement signed by the validator key to delegate
+// this agent's transport key, peers will identify this agent by the validator
+// key after authentication.
+func (agent *TCPAgent) SetKeyLinkage(linkage *KeyLinkage) error {
+	if _, err := VerifyKeyLinkage(linkage, &agent.privateKey.PublicKey, time.Now()); err != nil {
+		return err
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	agent.linkage = linkage
+	return nil
+}
+
+// keyLinkage returns the statement set by SetKeyLinkage
+func (agent *TCPAgent) keyLinkage() *KeyLinkage {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.linkage
+}
+
+// RevokeKeyLinkage rejects key linkage statements from the validator key with
+// a sequence lower than the given one, to revoke a leaked transport key.
+// Peers which have already authenticated will not be disconnected.
+func (agent *TCPAgent) RevokeKeyLinkage(validatorKey *ecdsa.PublicKey, sequence uint64) {
+	agent.Lock()
+	defer agent.Unlock()
+	id := bdls.DefaultPubKeyToIdentity(validatorKey)
+	if agent.linkageSequences[id] < sequence {
+		agent.linkageSequences[id] = sequence
+	}
+}
+
+// verifyKeyLinkage verifies a statement announced by a peer, and tracks the
+// highest sequence seen for each validator to reject superseded statements.
+func (agent *TCPAgent) verifyKeyLinkage(linkage *KeyLinkage, transportKey *ecdsa.PublicKey) (*ecdsa.PublicKey, error) {
+	validatorKey, err := VerifyKeyLinkage(linkage, transportKey, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	agent.Lock()
+	defer agent.Unlock()
+	id := bdls.DefaultPubKeyToIdentity(validatorKey)
+	if linkage.Sequence < agent.linkageSequences[id] {
+		return nil, ErrKeyLinkageRevoked
+	}
+	agent.linkageSequences[id] = linkage.Sequence
+	return validatorKey, nil
+}
+
+// AddPeer adds a peer to this agent, if the peer has been authenticated and
+// there is another connection to it, one of them will be closed. Peers
+// banned by SetBanPolicy, or from the networks not permitted by
+// AllowNetwork and DenyNetwork are rejected.
 func (agent *TCPAgent) AddPeer(p *TCPPeer) bool {
+	if !agent.addPeer(p) {
+		return false
+	}
+	agent.dedupPeer(p)
+	agent.updateFeatures()
+	return true
+}
+
+// addPeer adds a peer to the peer list & consensus
+func (agent *TCPAgent) addPeer(p *TCPPeer) bool {
 	agent.Lock()
 	defer agent.Unlock()
 
@@ -121,22 +409,82 @@ func (agent *TCPAgent) AddPeer(p *TCPPeer) bool {
 	case <-agent.die:
 		return false
 	default:
+		if agent.draining || agent.isBanned(p) || !agent.permitsAddrLocked(p.RemoteAddr()) {
+			return false
+		}
 		agent.peers = append(agent.peers, p)
+		agent.publishPeerEvent(p.peerEvent(PeerConnected))
+		// peers of a standby node don't join the consensus
+		if agent.replica {
+			return true
+		}
 		return agent.consensus.Join(p)
 	}
 }
 
-// RemovePeer removes a TCPPeer from this agent
+// NumPeers returns the number of peers of this agent
+func (agent *TCPAgent) NumPeers() int {
+	agent.Lock()
+	defer agent.Unlock()
+	return len(agent.peers)
+}
+
+// RemovePeer removes a TCPPeer from this agent & the consensus, the messages
+// pending to it are dropped and the connection is closed, returns false if
+// p is not a peer of this agent. Persistent peers are re-dialed, see
+// RemovePersistentPeer, and DrainPeer flushes the messages first.
 func (agent *TCPAgent) RemovePeer(p *TCPPeer) bool {
+	removed := agent.detachPeer(p, false)
+	p.dropMessages()
+	p.closeConn()
+	return removed
+}
+
+// RemovePeerByKey removes the peers authenticated by key, as their transport
+// or validator keys, like RemovePeer. It returns the number of peers removed.
+func (agent *TCPAgent) RemovePeerByKey(key *ecdsa.PublicKey) int {
+	id := bdls.DefaultPubKeyToIdentity(key)
+	matches := func(k *ecdsa.PublicKey) bool {
+		return k != nil && bdls.DefaultPubKeyToIdentity(k) == id
+	}
+
+	agent.Lock()
+	var peers []*TCPPeer
+	for _, p := range agent.peers {
+		if matches(p.GetPublicKey()) || matches(p.GetTransportPublicKey()) {
+			peers = append(peers, p)
+		}
+	}
+	agent.Unlock()
+
+	n := 0
+	for _, p := range peers {
+		if agent.RemovePeer(p) {
+			n++
+		}
+	}
+	return n
+}
+
+// detachPeer removes a TCPPeer from the peer list & the consensus, the state
+// of the connection is kept for a reconnecting peer to adopt if saveState
+// is set, returns false if p is not a peer of this agent.
+func (agent *TCPAgent) detachPeer(p *TCPPeer, saveState bool) bool {
 	agent.Lock()
 	defer agent.Unlock()
 
 	peerAddress := p.RemoteAddr().String()
 	for k := range agent.peers {
 		if agent.peers[k].RemoteAddr().String() == peerAddress {
+			if saveState {
+				agent.saveState(p)
+			}
 			copy(agent.peers[k:], agent.peers[k+1:])
+			agent.peers[len(agent.peers)-1] = nil // avoid memory leak
 			agent.peers = agent.peers[:len(agent.peers)-1]
-			return agent.consensus.Leave(p.RemoteAddr())
+			agent.consensus.Leave(p.RemoteAddr())
+			agent.publishPeerEvent(p.peerEvent(PeerDisconnected))
+			return true
 		}
 	}
 	return false
@@ -153,6 +501,8 @@ func (agent *TCPAgent) Close() {
 		for k := range agent.peers {
 			agent.peers[k].Close()
 		}
+		agent.closeSubscriptions()
+		agent.closePeerEvents()
 	})
 }
 
@@ -164,19 +514,85 @@ func (agent *TCPAgent) Update() {
 	select {
 	case <-agent.die:
 	default:
+		if agent.draining {
+			return
+		}
 		// call consensus update
-		agent.consensus.Update(time.Now())
+		now := time.Now()
+		agent.markUpdated(now)
+		agent.applyMaintenance(now)
+		agent.evaluateLoad(now)
+		agent.consensus.Update(now)
+		agent.recordDecision()
+		agent.requestSync(now)
 		timer.SystemTimedSched.Put(agent.Update, time.Now().Add(20*time.Millisecond))
 	}
 }
 
 // Propose a state, awaiting to be finalized at next height.
-func (agent *TCPAgent) Propose(s bdls.State) {
+func (agent *TCPAgent) Propose(s bdls.State) error {
+	agent.Lock()
+	defer agent.Unlock()
+	if agent.draining {
+		return ErrAgentShuttingDown
+	}
+	if err := agent.consensus.Propose(s); err != nil {
+		return err
+	}
+	height, _, _ := agent.consensus.CurrentState()
+	agent.recordProposal(agent.identity(), height+1, s)
+	return nil
+}
+
+// ProposeValue proposes an application payload v marshalled by c, the
+// decision carrying it is decoded by Decision.Decode, see package codec.
+func (agent *TCPAgent) ProposeValue(c codec.Codec, v interface{}) error {
+	s, err := codec.Encode(c, v)
+	if err != nil {
+		return err
+	}
+	return agent.Propose(s)
+}
+
+// SetMinWriteThroughput sets the min throughput in bytes/sec expected from
+// peers, large frames are given more time to write at this rate.
+func (agent *TCPAgent) SetMinWriteThroughput(bytesPerSecond int) {
+	agent.Lock()
+	defer agent.Unlock()
+	if bytesPerSecond > 0 {
+		agent.minWriteThroughput = bytesPerSecond
+	}
+}
+
+// getMinWriteThroughput returns the min write throughput
+func (agent *TCPAgent) getMinWriteThroughput() int {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.minWriteThroughput
+}
+
+// SetMinReadThroughput sets the min throughput in bytes/sec expected from
+// peers, the read deadline of a large frame is extended as it's chunks
+// arrive at this rate.
+func (agent *TCPAgent) SetMinReadThroughput(bytesPerSecond int) {
 	agent.Lock()
 	defer agent.Unlock()
-	agent.consensus.Propose(s)
+	if bytesPerSecond > 0 {
+		agent.minReadThroughput = bytesPerSecond
+	}
 }
 
+// getMinReadThroughput returns the min read throughput
+func (agent *TCPAgent) getMinReadThroughput() int {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.minReadThroughput
+}
+
+// Telemetry returns the sampling and cardinality controls for the telemetry
+// of this agent, they can be adjusted at runtime.
+func (agent *TCPAgent) Telemetry() *telemetry.Controls { return agent.telemetry }
+
 // GetLatestState returns latest state
 func (agent *TCPAgent) GetLatestState() (height uint64, round uint64, data bdls.State) {
 	agent.Lock()
@@ -184,14 +600,51 @@ func (agent *TCPAgent) GetLatestState() (height uint64, round uint64, data bdls.
 	return agent.consensus.CurrentState()
 }
 
-// handleConsensusMessage will be called if TCPPeer received a consensus message
-func (agent *TCPAgent) handleConsensusMessage(bts []byte) {
+// GetLatestProof returns the <decide> message of latest state, or nil if
+// nothing has been decided
+func (agent *TCPAgent) GetLatestProof() *bdls.SignedProto {
+	agent.Lock()
+	defer agent.Unlock()
+	return agent.consensus.CurrentProof()
+}
+
+// inboundMessage is a consensus message awaiting to be processed
+type inboundMessage struct {
+	bts    []byte
+	sender *ecdsa.PublicKey // the authenticated key of the connection delivered it, or nil
+	from   *TCPPeer         // the connection delivered it, to score misbehavior
+	synced bool             // requested to catch up, it's not relayed
+}
+
+// handleConsensusMessage will be called if TCPPeer received a consensus message,
+// sender is the authenticated public key of the peer, or nil if unknown.
+func (agent *TCPAgent) handleConsensusMessage(bts []byte, sender *ecdsa.PublicKey, from *TCPPeer) {
+	// observers are read-only
+	if from != nil && from.Observer() {
+		return
+	}
+
 	agent.Lock()
 	defer agent.Unlock()
-	agent.consensusMessages = append(agent.consensusMessages, bts)
+	if agent.draining {
+		return
+	}
+	agent.consensusMessages = append(agent.consensusMessages, inboundMessage{bts: bts, sender: sender, from: from})
 	agent.notifyConsensus()
 }
 
+// SetSignatureOffload enables skipping the signature verification of the
+// consensus messages delivered by their signers' own connections, as the
+// connections have been authenticated to the same keys, see
+// Consensus.ReceiveAuthenticatedMessage. It's only for fully authenticated
+// meshes, where the peers authenticate with their validator keys or linked
+// transport keys, relayed messages are always verified.
+func (agent *TCPAgent) SetSignatureOffload(enable bool) {
+	agent.Lock()
+	defer agent.Unlock()
+	agent.signatureOffload = enable
+}
+
 func (agent *TCPAgent) notifyConsensus() {
 	select {
 	case agent.chConsensusMessages <- struct{}{}:
@@ -207,9 +660,28 @@ func (agent *TCPAgent) inputConsensusMessage() {
 			agent.Lock()
 			msgs := agent.consensusMessages
 			agent.consensusMessages = nil
+			if sink := agent.getMetricsSink(); sink != nil {
+				sink.ReceiveQueueDepth(len(msgs))
+			}
+
+			// the signatures are verified in parallel before receiving
+			// the messages one by one, except the ones authenticated by
+			// the connection
+			var unverified [][]byte
+			for _, msg := range msgs {
+				if !(agent.signatureOffload && msg.sender != nil) {
+					unverified = append(unverified, msg.bts)
+				}
+			}
+			if len(unverified) > 0 {
+				agent.consensus.VerifyMessages(unverified)
+			}
 
+			// the decisions are recorded one by one, as the ones caught
+			// up with arrive in a batch
 			for _, msg := range msgs {
-				agent.consensus.ReceiveMessage(msg, time.Now())
+				agent.processConsensusMessage(msg)
+				agent.recordDecision()
 			}
 			agent.Unlock()
 		case <-agent.die:
@@ -218,6 +690,43 @@ func (agent *TCPAgent) inputConsensusMessage() {
 	}
 }
 
+// processConsensusMessage feeds an inbound message to the consensus core
+// NOTE: agent lock must be held.
+func (agent *TCPAgent) processConsensusMessage(msg inboundMessage) {
+	digest := blake2b.Sum256(msg.bts)
+	if agent.duplicateMessage(digest, msg.from) {
+		return
+	}
+	signed, m := decodeMessage(msg.bts)
+	if m != nil {
+		agent.observeHeight(signed, m)
+	}
+	var err error
+	offloaded := agent.signatureOffload && msg.sender != nil
+	if msg.synced {
+		err = agent.consensus.ApplyDecide(msg.bts, time.Now())
+	} else if offloaded {
+		err = agent.consensus.ReceiveAuthenticatedMessage(msg.bts, msg.sender, time.Now())
+	} else {
+		err = agent.consensus.ReceiveMessage(msg.bts, time.Now())
+	}
+	agent.processedMessage(digest, err)
+	if msg.from != nil && invalidMessage(err) {
+		agent.misbehaveLocked(msg.from, penaltyInvalidMessage)
+	}
+	// the messages accepted without their signatures verified are verified
+	// by the consensus core before being relayed, or the peers would
+	// penalize this agent for them
+	relay := agent.flood && !agent.replica && !msg.synced
+	if err == nil && signed != nil && relay && (!offloaded || agent.consensus.VerifySignature(signed)) {
+		agent.floodMessage(signed, msg.bts, msg.from)
+	}
+	// the verified proposals are audited
+	if err == nil && m != nil && m.Type == bdls.MessageType_RoundChange {
+		agent.recordProposal(bdls.DefaultPubKeyToIdentity(signed.PublicKey(bdls.S256Curve)), m.Height, m.State)
+	}
+}
+
 // fake address for Pipe
 type fakeAddress string
 
@@ -231,21 +740,106 @@ type TCPPeer struct {
 	peerAuthStatus authenticationState // peer authentication status
 	// the announced public key of the peer, only becomes valid if peerAuthStatus == peerAuthenticated
 	peerPublicKey *ecdsa.PublicKey
+	// the validator key linked to peerPublicKey, if the peer has announced a key linkage
+	peerValidatorKey *ecdsa.PublicKey
 
 	// local authentication status
 	localAuthState authenticationState
 
-	// the HMAC of the challenge text if peer has requested key authentication
-	hmac []byte
+	// the HMAC and the transcript of the challenge if peer has requested key
+	// authentication, and the HMAC to confirm it's reply with
+	hmac        []byte
+	transcript  []byte
+	confirmHMAC []byte
+
+	// the HMAC expected in the peer's confirmation of our reply
+	expectedConfirm []byte
+
+	// consensus messages received before both sides have authenticated
+	heldMessages [][]byte
+
+	// the nonce of this connection, and the timestamp & features of our
+	// KeyAuthInit
+	nonce         []byte
+	authTimestamp int64
+	authFeatures  []string
+
+	// session encryption, the ECDH secrets of the challenges of both sides
+	// until the keys are derived
+	peerNonce       []byte
+	challengeSecret *big.Int
+	responseSecret  *big.Int
+	sealKey         []byte         // the key to seal frames with, until sealing starts
+	sealer          *sessionCipher // seals the frames sent, nil if not encrypted
+	opener          *sessionCipher // opens the frames received
+	sealedIn        bool           // set once a sealed frame has been received
+	rekeyInterval   time.Duration  // the max age of the key of sealer
+	rekeyBytes      int64          // the max bytes sealed by the key of sealer
+	padding         bool           // pad the frames sealed
 
 	// message queues and their notifications
-	consensusMessages  [][]byte      // all pending outgoing consensus messages to this peer
-	chConsensusMessage chan struct{} // notification on new consensus data
+	lanes              [numLanes]messageQueue // pending outgoing consensus messages to this peer, by priority
+	chConsensusMessage chan struct{}          // notification on new consensus data
 
 	// agent messages
 	agentMessages  [][]byte      // all pending outgoing agent messages to this peer.
 	chAgentMessage chan struct{} // notification on new agent exchange messages
 
+	// set while the messages taken from the queues are being written
+	writing bool
+
+	// set if the peer has subscribed to decisions as a standby node
+	replicaSubscribed bool
+
+	// (optional) the relay announced by the subscribed standby node
+	relay *ReplicaRelay
+
+	// set if the connection was dialed by this agent, directed is set if
+	// the direction is known, by NewPeer or SetOutbound
+	outbound bool
+	directed bool
+
+	// (optional) the yamux session the connection is the consensus stream of
+	session *yamux.Session
+
+	// set if the state has been moved to another connection
+	migrated bool
+
+	// the compression negotiated for messages sent to the peer
+	compression          CompressionType
+	compressionThreshold int
+
+	// the optional features advertised by the peer
+	peerFeatures []Feature
+
+	// the protocol version negotiated by HELLO, zero if none received
+	protocolVersion uint32
+
+	// the address of this agent observed by the peer
+	observedAddr string
+
+	// frames sent & received by command
+	traffic *trafficCounters
+
+	// set once the failed handshake has been reported
+	handshakeFailed int32
+
+	// the unix nanoseconds of the last frame received & sent, for keepalives
+	lastReceived int64
+	lastSent     int64
+
+	// latency measurement
+	rtt       time.Duration // smoothed round trip time
+	pingNonce uint64        // nonce of the last ping
+	pingSent  time.Time     // the time the last ping was sent, zero if answered
+
+	// closed when the peer has been authenticated
+	chAuthenticated chan struct{}
+
+	// the deadlines & max frame size of the connection, the handshake
+	// timeout is only set by the options given to NewTCPPeer
+	options transportOptions
+
 	// peer closing signal
 	die     chan struct{}
 	dieOnce sync.Once
@@ -254,27 +848,61 @@ type TCPPeer struct {
 	sync.Mutex
 }
 
-// NewTCPPeer creates a TCPPeer with protocol over this connection
-func NewTCPPeer(conn net.Conn, agent *TCPAgent) *TCPPeer {
+// NewTCPPeer creates a TCPPeer with protocol over this connection, the options
+// of the agent can be overridden for this connection by opts.
+func NewTCPPeer(conn net.Conn, agent *TCPAgent, opts ...Option) *TCPPeer {
 	p := new(TCPPeer)
 	p.chConsensusMessage = make(chan struct{}, 1)
 	p.chAgentMessage = make(chan struct{}, 1)
+	p.chAuthenticated = make(chan struct{})
 	p.conn = conn
 	p.agent = agent
 	p.die = make(chan struct{})
+	p.traffic = newTrafficCounters()
+	p.nonce = newNonce()
+	p.options = agent.getTransportOptions()
+	p.options.handshakeTimeout = 0
+	for _, opt := range opts {
+		opt(&p.options)
+	}
+	now := time.Now()
+	p.touchReceived(now)
+	p.touchSent(now)
 	// we start readLoop & sendLoop for each connection
 	go p.readLoop()
 	go p.sendLoop()
+	if timeout := p.options.handshakeTimeout; timeout > 0 {
+		go func() {
+			if agent.waitAuthenticated(p, nil, timeout, nil) == ErrHandshakeTimeout {
+				p.Close()
+			}
+		}()
+	}
 	return p
 }
 
-// RemoteAddr implements PeerInterface, GetPublicKey returns peer's
-// public key, returns nil if peer's has not authenticated it's public-key
+// GetPublicKey implements PeerInterface, GetPublicKey returns peer's
+// public key, returns nil if peer's has not authenticated it's public-key.
+// If the peer has linked it's transport key to a validator key, the
+// validator key will be returned.
 func (p *TCPPeer) GetPublicKey() *ecdsa.PublicKey {
 	p.Lock()
 	defer p.Unlock()
 	if p.peerAuthStatus == peerAuthenticated {
-		//log.Println("get public key:", p.peerPublicKey)
+		if p.peerValidatorKey != nil {
+			return p.peerValidatorKey
+		}
+		return p.peerPublicKey
+	}
+	return nil
+}
+
+// GetTransportPublicKey returns the key which the peer has authenticated
+// the connection with, returns nil if the peer has not authenticated.
+func (p *TCPPeer) GetTransportPublicKey() *ecdsa.PublicKey {
+	p.Lock()
+	defer p.Unlock()
+	if p.peerAuthStatus == peerAuthenticated {
 		return p.peerPublicKey
 	}
 	return nil
@@ -282,17 +910,28 @@ func (p *TCPPeer) GetPublicKey() *ecdsa.PublicKey {
 
 // RemoteAddr implements PeerInterface, returns peer's address as connection identity
 func (p *TCPPeer) RemoteAddr() net.Addr {
-	if p.conn.RemoteAddr().Network() == "pipe" {
+	switch addr := p.conn.RemoteAddr(); addr.Network() {
+	case "pipe":
 		return fakeAddress(fmt.Sprint(unsafe.Pointer(p)))
+	case "unix":
+		// unix socket peers are unnamed or share the same socket path,
+		// so they're identified by the connection.
+		return &net.UnixAddr{Name: fmt.Sprint(addr.String(), "#", unsafe.Pointer(p)), Net: addr.Network()}
+	default:
+		return addr
 	}
-	return p.conn.RemoteAddr()
 }
 
 // Send implements PeerInterface, to send message to this peer
 func (p *TCPPeer) Send(out []byte) error {
+	// the observers are shed first under overload
+	if p.agent.shedLevel() >= ShedObservers && p.Observer() {
+		return nil
+	}
+
 	p.Lock()
 	defer p.Unlock()
-	p.consensusMessages = append(p.consensusMessages, out)
+	p.enqueueConsensusMessage(out)
 	p.notifyConsensusMessage()
 	return nil
 }
@@ -313,24 +952,57 @@ func (p *TCPPeer) notifyAgentMessage() {
 	}
 }
 
-// Close terminates connection to this peer
+// Close terminates connection to this peer, the peer is removed from it's
+// agent, keeping the state of the connection for a reconnecting peer.
 func (p *TCPPeer) Close() {
+	p.closeConn()
+	go p.agent.detachPeer(p, true)
+}
+
+// closeConn closes the connection & signals the peer's goroutines to exit
+func (p *TCPPeer) closeConn() {
 	p.dieOnce.Do(func() {
 		p.conn.Close()
 		close(p.die)
 	})
-	go p.agent.RemovePeer(p)
+}
+
+// dropMessages drops the messages pending to the peer
+func (p *TCPPeer) dropMessages() {
+	p.Lock()
+	defer p.Unlock()
+	p.takeConsensusMessages()
+	p.agentMessages = nil
+}
+
+// SetOutbound marks the connection as dialed by this agent, which is used to
+// break the tie when both sides dial each other simultaneously, peers created
+// by Connect and persistent peers are marked already.
+func (p *TCPPeer) SetOutbound() {
+	p.setDirection(true)
 }
 
 // InitiatePublicKeyAuthentication will initate a procedure to convince
 // the other peer to trust my ownership of public key
 func (p *TCPPeer) InitiatePublicKeyAuthentication() error {
+	linkage := p.agent.keyLinkage()
+	compressions, _ := p.agent.getCompression()
+	features := p.agent.getFeatures()
+
 	p.Lock()
 	defer p.Unlock()
 	if p.localAuthState == localNotAuthenticated {
 		auth := KeyAuthInit{}
 		auth.X = p.agent.privateKey.PublicKey.X.Bytes()
 		auth.Y = p.agent.privateKey.PublicKey.Y.Bytes()
+		auth.Curve = curveName(p.agent.privateKey.Curve)
+		auth.Linkage = linkage
+		auth.Compressions = compressions
+		auth.Features = features
+		auth.Nonce = p.nonce
+		auth.Timestamp = time.Now().Unix()
+		p.authTimestamp = auth.Timestamp
+		p.authFeatures = features
 
 		// proto marshal
 		bts, err := proto.Marshal(&auth)
@@ -358,7 +1030,11 @@ func (p *TCPPeer) InitiatePublicKeyAuthentication() error {
 // handleGossip will process all messages from this peer based on it's message types
 func (p *TCPPeer) handleGossip(msg *Gossip) error {
 	switch msg.Command {
-	case CommandType_NOP: // NOP can be used for connection keepalive
+	case CommandType_NOP: // NOP can be used for connection keepalive, or carries the HELLO
+		var m Hello
+		if proto.Unmarshal(msg.Message, &m) == nil && m.Version > 0 {
+			return p.handleHello(&m)
+		}
 	case CommandType_KEY_AUTH_INIT:
 		// this peer initated it's publickey authentication
 		var m KeyAuthInit
@@ -396,35 +1072,230 @@ func (p *TCPPeer) handleGossip(msg *Gossip) error {
 		if err != nil {
 			return err
 		}
+		if p.GetTransportPublicKey() != nil {
+			if err := p.onAuthenticated(); err != nil {
+				return err
+			}
+		}
+		if p.MutuallyAuthenticated() {
+			p.onMutuallyAuthenticated()
+		}
+
+	case CommandType_KEY_AUTH_CONFIRM:
+		// this peer has accepted our challenge reply
+		var m KeyAuthConfirm
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+
+		authenticated := p.GetTransportPublicKey() != nil
+		err = p.handleKeyAuthConfirm(&m)
+		if err != nil {
+			return err
+		}
+		if !authenticated && p.GetTransportPublicKey() != nil {
+			if err := p.onAuthenticated(); err != nil {
+				return err
+			}
+		}
+		if p.MutuallyAuthenticated() {
+			p.onMutuallyAuthenticated()
+		}
 
 	case CommandType_CONSENSUS:
-		// received a consensus message from this peer
-		p.agent.handleConsensusMessage(msg.Message)
+		// received a consensus message from this peer, it's held until
+		// both sides have authenticated if required
+		if p.agent.getMutualAuthentication() && p.holdConsensusMessage(msg.Message) {
+			return nil
+		}
+		// only the voting path of authenticated peers is kept under overload
+		if p.GetPublicKey() == nil && p.agent.shedLevel() >= ShedUnauthenticated {
+			return nil
+		}
+		p.agent.handleConsensusMessage(msg.Message, p.GetPublicKey(), p)
+	case CommandType_REPLICA_SUBSCRIBE:
+		// a standby node subscribes to our decisions
+		var m ReplicaSubscribe
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+
+		p.setRelay(&m)
+		err = p.agent.handleReplicaSubscribe(p, m.FromHeight)
+		if err != nil {
+			return err
+		}
+	case CommandType_REPLICA_REDIRECT:
+		// the primary has no capacity for us, follow one of the relays
+		var m ReplicaRedirect
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+		p.agent.handleReplicaRedirect(&m)
+	case CommandType_REPLICA_DECISION:
+		// received a decision from the primary
+		p.agent.handleReplicaDecision(p, msg.Message)
+	case CommandType_LATENCY_PING:
+		// echo the ping back
+		var m LatencyPing
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+		p.sendAgentMessage(CommandType_LATENCY_PONG, &m)
+	case CommandType_LATENCY_PONG:
+		var m LatencyPing
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+		p.handlePong(&m)
+	case CommandType_LATENCY_STATUS:
+		// the peer advertises it's round trip times
+		var m LatencyStatus
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+		p.agent.handleLatencyStatus(p, &m)
+	case CommandType_REKEY:
+		// the peer rotates the key of the frames it sends
+		var m SessionRekey
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+
+		err = p.handleRekey(&m)
+		if err != nil {
+			return err
+		}
+	case CommandType_LEAVING:
+		// the peer is shutting down
+		p.agent.handleLeaving(p)
+	case CommandType_OBSERVED_ADDR:
+		// the peer tells the address we connect from
+		var m ObservedAddr
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+		p.handleObservedAddr(&m)
+	case CommandType_PUNCH_REQUEST:
+		// the peer asks us to be the rendezvous of a hole punch
+		var m PunchRequest
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+		p.agent.handlePunchRequest(p, &m)
+	case CommandType_PUNCH:
+		// the rendezvous tells the address to punch to
+		var m Punch
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+		p.agent.handlePunch(p, &m)
+	case CommandType_SYNC_REQUEST:
+		// a lagging peer requests the decisions it has missed
+		var m SyncRequest
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+
+		err = p.agent.handleSyncRequest(p, &m)
+		if err != nil {
+			return err
+		}
+	case CommandType_SYNC_DECISION:
+		// received a decision to catch up with
+		p.agent.handleSyncDecision(p, msg.Message)
+	case CommandType_MAINTENANCE:
+		// the peer announces it's planned downtime
+		var m MaintenanceWindow
+		err := proto.Unmarshal(msg.Message, &m)
+		if err != nil {
+			return err
+		}
+		p.agent.handleMaintenance(p, &m)
 	default:
-		panic(msg)
+		// commands of newer protocol versions are ignored
 	}
 	return nil
 }
 
 // peer initiated key authentication
 func (p *TCPPeer) handleKeyAuthInit(authKey *KeyAuthInit) error {
+	// the curve announced must be accepted, and the key on it
+	curve, curveErr := p.agent.peerCurve(authKey.Curve)
+	if curveErr != nil {
+		curve = bdls.S256Curve
+	}
+	peerPublicKey := unmarshalKey(curve, authKey.X, authKey.Y)
+	onCurve := curveErr == nil && peerPublicKey != nil
+
+	// the access control lists are checked before any processing, then
+	// verify the linkage to validator key if there is any, these must be
+	// done before locking the peer, as the agent lock will be acquired.
+	denied := !p.agent.permitsAddr(p.RemoteAddr()) || (onCurve && p.agent.deniesKey(peerPublicKey))
+	var replayErr error
+	if !denied {
+		replayErr = p.agent.checkReplay(authKey.Nonce, authKey.Timestamp, time.Now())
+	}
+	var validatorKey *ecdsa.PublicKey
+	var linkageErr error
+	if !denied && replayErr == nil && onCurve && authKey.Linkage != nil {
+		validatorKey, linkageErr = p.agent.verifyKeyLinkage(authKey.Linkage, peerPublicKey)
+	}
+	if !denied && linkageErr == nil && onCurve {
+		denied = !p.agent.permitsKeys(peerPublicKey, validatorKey)
+	}
+	compressions, threshold := p.agent.getCompression()
+
 	p.Lock()
 	defer p.Unlock()
 	// only when in init status, authentication process cannot rollback
 	// to prevent from malicious re-authentication DoS
 	if p.peerAuthStatus == peerNotAuthenticated {
-		peerPublicKey := &ecdsa.PublicKey{Curve: bdls.S256Curve, X: big.NewInt(0).SetBytes(authKey.X), Y: big.NewInt(0).SetBytes(authKey.Y)}
-
-		// on curve test
-		if !bdls.S256Curve.IsOnCurve(peerPublicKey.X, peerPublicKey.Y) {
+		if denied {
+			p.peerAuthStatus = peerAuthenticatedFailed
+			return ErrPeerNotAllowed
+		}
+		// a handshake can't be replayed
+		if replayErr != nil {
+			p.peerAuthStatus = peerAuthenticatedFailed
+			return replayErr
+		}
+		// curve & on curve test
+		if curveErr != nil {
+			p.peerAuthStatus = peerAuthenticatedFailed
+			return curveErr
+		}
+		if !onCurve {
 			p.peerAuthStatus = peerAuthenticatedFailed
 			return ErrKeyNotOnCurve
 		}
+		// the linkage to validator key must be valid if there is any
+		if linkageErr != nil {
+			p.peerAuthStatus = peerAuthenticatedFailed
+			return linkageErr
+		}
+		p.peerValidatorKey = validatorKey
+		p.compression = negotiateCompression(compressions, authKey.Compressions)
+		p.compressionThreshold = threshold
+		p.peerFeatures = toFeatures(authKey.Features)
+
 		// temporarily stored announced key
 		p.peerPublicKey = peerPublicKey
 
-		// create ephermal key for authentication
-		ephemeral, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		// create ephermal key for authentication, on the curve of the
+		// peer's key for ECDH
+		ephemeral, err := ecdsa.GenerateKey(curve, rand.Reader)
 		if err != nil {
 			panic(err)
 		}
@@ -440,14 +1311,16 @@ func (p *TCPPeer) handleKeyAuthInit(authKey *KeyAuthInit) error {
 		if err != nil {
 			panic(err)
 		}
+		challenge.Nonce = p.nonce
 
-		// calculates & store HMAC for this random message
-		hmac, err := blake2b.New256(secret.Bytes())
-		if err != nil {
-			panic(err)
-		}
-		hmac.Write(challenge.Challenge)
-		p.hmac = hmac.Sum(nil)
+		// calculates & store HMAC for the transcript bound to this
+		// random message
+		p.transcript = keyAuthTranscript(p.nonce, authKey.Nonce, peerPublicKey, authKey.Curve, authKey.Timestamp, authKey.Features, &ephemeral.PublicKey, challenge.Challenge)
+		p.hmac = keyAuthHMAC(secret, KeyAuthReplyLabel, p.transcript)
+		p.confirmHMAC = keyAuthHMAC(secret, KeyAuthConfirmLabel, p.transcript)
+		p.challengeSecret = secret
+		p.peerNonce = authKey.Nonce
+		p.deriveSessionKeys()
 
 		// proto marshal
 		bts, err := proto.Marshal(&challenge)
@@ -479,19 +1352,37 @@ func (p *TCPPeer) handleKeyAuthChallenge(challenge *KeyAuthChallenge) error {
 	p.Lock()
 	defer p.Unlock()
 	if p.localAuthState == localAuthKeySent {
-		// use ECDH to recover shared-key
-		pubkey := &ecdsa.PublicKey{Curve: bdls.S256Curve, X: big.NewInt(0).SetBytes(challenge.X), Y: big.NewInt(0).SetBytes(challenge.Y)}
+		// use ECDH to recover shared-key, the ephemeral key is on the
+		// curve of my key
+		pubkey := unmarshalKey(p.agent.privateKey.Curve, challenge.X, challenge.Y)
+		if pubkey == nil {
+			return ErrKeyNotOnCurve
+		}
+		// the challenge must be bound to the peer's nonce, and not
+		// reflect ours
+		if len(challenge.Nonce) != nonceSize {
+			return ErrHandshakeNonce
+		}
+		if subtle.ConstantTimeCompare(challenge.Nonce, p.nonce) == 1 {
+			return ErrHandshakeReplay
+		}
 		// derive secret with my private key
 		secret := ECDH(pubkey, p.agent.privateKey)
 
-		// calculates HMAC for the challenge with the key above
+		// calculates HMAC for the transcript with the key above, and
+		// signs the transcript
+		transcript := keyAuthTranscript(challenge.Nonce, p.nonce, &p.agent.privateKey.PublicKey, curveName(p.agent.privateKey.Curve), p.authTimestamp, p.authFeatures, pubkey, challenge.Challenge)
 		var response KeyAuthChallengeReply
-		hmac, err := blake2b.New256(secret.Bytes())
+		response.HMAC = keyAuthHMAC(secret, KeyAuthReplyLabel, transcript)
+		p.expectedConfirm = keyAuthHMAC(secret, KeyAuthConfirmLabel, transcript)
+		p.responseSecret = secret
+		p.deriveSessionKeys()
+		r, s, err := ecdsa.Sign(rand.Reader, p.agent.privateKey, transcript)
 		if err != nil {
 			panic(err)
 		}
-		hmac.Write(challenge.Challenge)
-		response.HMAC = hmac.Sum(nil)
+		response.R = r.Bytes()
+		response.S = s.Bytes()
 
 		// proto marshal
 		bts, err := proto.Marshal(&response)
@@ -520,12 +1411,37 @@ func (p *TCPPeer) handleKeyAuthChallenge(challenge *KeyAuthChallenge) error {
 
 // handle key authentication challenge reply
 func (p *TCPPeer) handleKeyAuthChallengeReply(response *KeyAuthChallengeReply) error {
+	mutual := p.agent.getMutualAuthentication()
+
 	p.Lock()
 	defer p.Unlock()
 	if p.peerAuthStatus == peerAuthkeyReceived {
-		if subtle.ConstantTimeCompare(p.hmac, response.HMAC) == 1 {
+		r := big.NewInt(0).SetBytes(response.R)
+		s := big.NewInt(0).SetBytes(response.S)
+		if subtle.ConstantTimeCompare(p.hmac, response.HMAC) == 1 && ecdsa.Verify(p.peerPublicKey, p.transcript, r, s) {
+			// confirm to the peer
+			bts, err := proto.Marshal(&KeyAuthConfirm{HMAC: p.confirmHMAC})
+			if err != nil {
+				panic(err)
+			}
+			out, err := proto.Marshal(&Gossip{Command: CommandType_KEY_AUTH_CONFIRM, Message: bts})
+			if err != nil {
+				panic(err)
+			}
+			p.agentMessages = append(p.agentMessages, out)
+			p.notifyAgentMessage()
+
 			p.hmac = nil
+			p.transcript = nil
+			p.confirmHMAC = nil
+			// wait for the confirmation of ours if required
+			if mutual && p.localAuthState != localAuthConfirmed {
+				p.peerAuthStatus = peerAuthVerified
+				return nil
+			}
 			p.peerAuthStatus = peerAuthenticated
+			close(p.chAuthenticated)
+			p.agent.publishPeerEvent(p.peerEventLocked(PeerAuthenticated))
 			return nil
 		} else {
 			p.peerAuthStatus = peerAuthenticatedFailed
@@ -536,10 +1452,33 @@ func (p *TCPPeer) handleKeyAuthChallengeReply(response *KeyAuthChallengeReply) e
 	}
 }
 
+// handle the confirmation of our challenge reply
+func (p *TCPPeer) handleKeyAuthConfirm(confirm *KeyAuthConfirm) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.localAuthState == localChallengeAccepted {
+		if subtle.ConstantTimeCompare(p.expectedConfirm, confirm.HMAC) != 1 {
+			return ErrKeyAuthConfirm
+		}
+		p.expectedConfirm = nil
+		p.localAuthState = localAuthConfirmed
+		// the peer was waiting for this confirmation
+		if p.peerAuthStatus == peerAuthVerified {
+			p.peerAuthStatus = peerAuthenticated
+			close(p.chAuthenticated)
+			p.agent.publishPeerEvent(p.peerEventLocked(PeerAuthenticated))
+		}
+		return nil
+	} else {
+		return ErrPeerKeyAuthConfirm
+	}
+}
+
 // readLoop keeps reading messages from peer
 func (p *TCPPeer) readLoop() {
 	defer p.Close()
 	msgLength := make([]byte, MessageLength)
+	profiler := p.agent.consensus.Profiler()
 
 	for {
 		select {
@@ -547,7 +1486,7 @@ func (p *TCPPeer) readLoop() {
 			return
 		default:
 			// read message size
-			p.conn.SetReadDeadline(time.Now().Add(defaultReadTimeout))
+			p.conn.SetReadDeadline(transportDeadline(p.options.idleTimeout, 0))
 			_, err := io.ReadFull(p.conn, msgLength)
 			if err != nil {
 				return
@@ -555,39 +1494,72 @@ func (p *TCPPeer) readLoop() {
 
 			// check length
 			length := binary.LittleEndian.Uint32(msgLength)
-			if length > MaxMessageLength {
-				log.Println(err)
+			if length > uint32(p.options.maxFrameSize)+sealOverhead {
+				log.Println(ErrMessageLengthExceed)
+				p.agent.misbehave(p, penaltyMalformedFrame)
 				return
 			}
 
 			if length == 0 {
 				log.Println("zero length")
+				p.agent.misbehave(p, penaltyMalformedFrame)
 				return
 			}
 
 			// read message bytes
-			p.conn.SetReadDeadline(time.Now().Add(defaultReadTimeout))
 			bts := make([]byte, length)
-			_, err = io.ReadFull(p.conn, bts)
-			if err != nil {
+			start := profiler.Now()
+			if err := p.readFrame(bts, p.agent.getMinReadThroughput()); err != nil {
 				return
 			}
+			profiler.Since(bdls.ProfileIO, start)
 
-			// unmarshal bytes to message
-			var gossip Gossip
-			err = proto.Unmarshal(bts, &gossip)
-			if err != nil {
-				log.Println(err)
+			if err := p.handleFrame(bts); err != nil {
 				return
 			}
+		}
+	}
+}
 
-			err = p.handleGossip(&gossip)
-			if err != nil {
-				log.Println(err)
-				return
-			}
+// handleFrame parses & handles a frame read from the peer, the misbehavior
+// is scored, the connection should be closed on error.
+func (p *TCPPeer) handleFrame(bts []byte) error {
+	// unmarshal bytes to message
+	var gossip Gossip
+	err := proto.Unmarshal(bts, &gossip)
+	if err != nil {
+		log.Println(err)
+		p.agent.misbehave(p, penaltyMalformedFrame)
+		return err
+	}
+	// frames of an encrypted session are opened
+	if err := p.openGossip(&gossip); err != nil {
+		log.Println(p.RemoteAddr(), err)
+		return err
+	}
+	p.countReceived(gossip.Command, bts)
+	p.touchReceived(time.Now())
+
+	// the decompressed messages are limited to the max frame size too
+	err = decompress(&gossip)
+	if err == nil && len(gossip.Message) > p.options.maxFrameSize {
+		err = ErrMessageLengthExceed
+	}
+	if err != nil {
+		log.Println(err)
+		p.agent.misbehave(p, penaltyMalformedFrame)
+		return err
+	}
+
+	err = p.handleGossip(&gossip)
+	if err != nil {
+		log.Println(err)
+		if penalty := misbehaviorPenalty(err); penalty > 0 {
+			p.agent.misbehave(p, penalty)
 		}
+		return err
 	}
+	return nil
 }
 
 // sendLoop keeps sending consensus message to this peer
@@ -596,63 +1568,181 @@ func (p *TCPPeer) sendLoop() {
 
 	var pending [][]byte
 	var msg Gossip
-	msg.Command = CommandType_CONSENSUS
-	msgLength := make([]byte, MessageLength)
+	var batch frameBatch // frames coalesced into one write
+	profiler := p.agent.consensus.Profiler()
+
+	// flush writes the frames in batch
+	flush := func(throughput int) error {
+		if batch.size == 0 {
+			return nil
+		}
+		start := profiler.Now()
+		begin := time.Now()
+		err := p.writeFrames(batch.bufs, throughput)
+		profiler.Since(bdls.ProfileIO, start)
+		if sink := p.agent.getMetricsSink(); sink != nil {
+			sink.WriteLatency(p.RemoteAddr(), batch.size, time.Since(begin))
+		}
+		batch.reset()
+		p.touchSent(time.Now())
+		return err
+	}
+
+	// keepalives on idle connections
+	var chKeepalive <-chan time.Time
+	interval, misses := p.agent.getKeepalive()
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		chKeepalive = ticker.C
+	}
+
+	// cover NOPs on padded sessions
+	var cover *time.Timer
+	var chCover <-chan time.Time
+	padding, coverInterval := p.agent.getPadding()
+	if padding && coverInterval > 0 {
+		cover = time.NewTimer(coverDelay(coverInterval))
+		defer cover.Stop()
+		chCover = cover.C
+	}
+
+	// the HELLO goes first, before any consensus traffic
+	hello := p.agent.helloFrame()
+	p.countSent(CommandType_NOP, hello)
+	batch.append(hello)
+	if err := flush(p.agent.getMinWriteThroughput()); err != nil {
+		log.Println(err)
+		return
+	}
 
 	for {
 		select {
 		case <-p.chConsensusMessage:
-			p.Lock()
-			pending = p.consensusMessages
-			p.consensusMessages = nil
-			p.Unlock()
+			p.reportQueueDepth()
+			throughput := p.agent.getMinWriteThroughput()
+			compressing := p.agent.FeatureActive(FeatureCompression)
+			for {
+				// lanes are drained in priority order, a message of higher
+				// priority enqueued meanwhile is sent next
+				p.Lock()
+				bts, ok := p.nextConsensusMessage()
+				compression, threshold := p.compression, p.compressionThreshold
+				if ok {
+					p.writing = true
+				}
+				p.Unlock()
+				if !ok {
+					break
+				}
 
-			for _, bts := range pending {
 				// we need to encapsulate consensus messages
-				msg.Message = bts
+				msg = Gossip{Command: CommandType_CONSENSUS, Message: bts}
+				if compressing && len(bts) >= threshold {
+					compress(&msg, compression)
+				}
 				out, err := proto.Marshal(&msg)
 				if err != nil {
 					panic(err)
 				}
 
-				if len(out) > MaxMessageLength {
-					panic("maximum message size exceeded")
+				if len(out) > p.options.maxFrameSize {
+					log.Println(ErrMessageLengthExceed)
+					continue
 				}
 
-				binary.LittleEndian.PutUint32(msgLength, uint32(len(out)))
-				p.conn.SetWriteDeadline(time.Now().Add(defaultWriteTimeout))
-				// write length
-				_, err = p.conn.Write(msgLength)
-				if err != nil {
-					log.Println(err)
-					return
+				// pending frames are written together, up to a chunk
+				out = p.sealFrame(out)
+				p.countSent(CommandType_CONSENSUS, out)
+				batch.append(out)
+				if rekey := p.rekeyFrame(time.Now()); rekey != nil {
+					p.countSent(CommandType_REKEY, rekey)
+					batch.append(rekey)
 				}
-
-				// write message
-				_, err = p.conn.Write(out)
-				if err != nil {
-					log.Println(err)
-					return
+				if batch.size >= ioChunkSize {
+					if err := flush(throughput); err != nil {
+						log.Println(err)
+						return
+					}
 				}
 			}
+
+			if err := flush(throughput); err != nil {
+				log.Println(err)
+				return
+			}
+			p.doneWriting()
 		case <-p.chAgentMessage:
+			p.reportQueueDepth()
 			p.Lock()
 			pending = p.agentMessages
 			p.agentMessages = nil
+			version := p.negotiatedVersion()
+			p.writing = len(pending) > 0
 			p.Unlock()
 
+			throughput := p.agent.getMinWriteThroughput()
 			for _, bts := range pending {
-				binary.LittleEndian.PutUint32(msgLength, uint32(len(bts)))
-				// write length
-				_, err := p.conn.Write(msgLength)
-				if err != nil {
+				command := gossipCommand(bts)
+				if !commandSupported(version, command) {
+					// the peer of an older version would close the connection
+					continue
+				}
+				bts = p.sealFrame(bts)
+				p.countSent(command, bts)
+				batch.append(bts)
+				if rekey := p.rekeyFrame(time.Now()); rekey != nil {
+					p.countSent(CommandType_REKEY, rekey)
+					batch.append(rekey)
+				}
+				if batch.size >= ioChunkSize {
+					if err := flush(throughput); err != nil {
+						log.Println(err)
+						return
+					}
+				}
+			}
+
+			if err := flush(throughput); err != nil {
+				log.Println(err)
+				return
+			}
+			p.doneWriting()
+
+		case now := <-chKeepalive:
+			idle, err := p.keepalive(now, interval, misses)
+			if err != nil {
+				log.Println(p.RemoteAddr(), err)
+				return
+			}
+			if idle {
+				frame := p.sealFrame(keepaliveFrame)
+				p.countSent(CommandType_NOP, frame)
+				batch.append(frame)
+				if rekey := p.rekeyFrame(now); rekey != nil {
+					p.countSent(CommandType_REKEY, rekey)
+					batch.append(rekey)
+				}
+				if err := flush(p.agent.getMinWriteThroughput()); err != nil {
 					log.Println(err)
 					return
 				}
+			}
 
-				// write message
-				_, err = p.conn.Write(bts)
-				if err != nil {
+		case now := <-chCover:
+			cover.Reset(coverDelay(coverInterval))
+			p.Lock()
+			padded := p.sealer != nil && p.padding
+			p.Unlock()
+			if padded {
+				frame := p.sealFrame(keepaliveFrame)
+				p.countSent(CommandType_NOP, frame)
+				batch.append(frame)
+				if rekey := p.rekeyFrame(now); rekey != nil {
+					p.countSent(CommandType_REKEY, rekey)
+					batch.append(rekey)
+				}
+				if err := flush(p.agent.getMinWriteThroughput()); err != nil {
 					log.Println(err)
 					return
 				}
@@ -663,3 +1753,88 @@ func (p *TCPPeer) sendLoop() {
 		}
 	}
 }
+
+// frameBatch is a batch of |MessageLength|Message| frames for vectored I/O,
+// the messages are referenced without being copied.
+type frameBatch struct {
+	headers []byte      // the length prefixes, reused between batches
+	bufs    net.Buffers // length prefixes and messages, alternately
+	size    int         // total bytes of the frames
+}
+
+// append adds a frame of bts to the batch
+func (b *frameBatch) append(bts []byte) {
+	n := len(b.headers)
+	b.headers = append(b.headers, make([]byte, MessageLength)...)
+	header := b.headers[n : n+MessageLength : n+MessageLength]
+	binary.LittleEndian.PutUint32(header, uint32(len(bts)))
+	b.bufs = append(b.bufs, header, bts)
+	b.size += MessageLength + len(bts)
+}
+
+// reset empties the batch for reuse
+func (b *frameBatch) reset() {
+	for k := range b.bufs {
+		b.bufs[k] = nil // avoid memory leak
+	}
+	b.headers = b.headers[:0]
+	b.bufs = b.bufs[:0]
+	b.size = 0
+}
+
+// writeFrames writes bufs in chunks with vectored I/O, so the frames share
+// the syscalls, each chunk has a write deadline of the write timeout plus
+// the time to transfer it at the min throughput, so large frames on slow
+// links won't hit a fixed deadline, while stalled connections are still
+// detected.
+func (p *TCPPeer) writeFrames(bufs net.Buffers, throughput int) error {
+	var chunk net.Buffers
+	for len(bufs) > 0 {
+		// take up to ioChunkSize bytes, splitting a buffer if necessary
+		chunk = chunk[:0]
+		n := 0
+		for len(bufs) > 0 && n < ioChunkSize {
+			b := bufs[0]
+			if n+len(b) > ioChunkSize {
+				b = b[:ioChunkSize-n]
+				bufs[0] = bufs[0][len(b):]
+			} else {
+				bufs = bufs[1:]
+			}
+			chunk = append(chunk, b)
+			n += len(b)
+		}
+
+		p.conn.SetWriteDeadline(transportDeadline(p.options.writeTimeout, transferDuration(n, throughput)))
+		writing := chunk
+		if _, err := writing.WriteTo(p.conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFrame reads the message of a frame into bts in chunks, the read
+// deadline is extended for each chunk by the read timeout plus the time
+// to transfer it at the min throughput, so a large frame is not required
+// to arrive within one fixed window, while stalled peers are still detected.
+func (p *TCPPeer) readFrame(bts []byte, throughput int) error {
+	for len(bts) > 0 {
+		n := len(bts)
+		if n > ioChunkSize {
+			n = ioChunkSize
+		}
+
+		p.conn.SetReadDeadline(transportDeadline(p.options.readTimeout, transferDuration(n, throughput)))
+		if _, err := io.ReadFull(p.conn, bts[:n]); err != nil {
+			return err
+		}
+		bts = bts[n:]
+	}
+	return nil
+}
+
+// transferDuration returns the time to transfer n bytes at throughput bytes/sec
+func transferDuration(n int, throughput int) time.Duration {
+	return time.Duration(int64(n) * int64(time.Second) / int64(throughput))
+}
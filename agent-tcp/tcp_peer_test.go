@@ -2,6 +2,7 @@ package agent
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/binary"
@@ -11,14 +12,16 @@ import (
 	"net"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
 	"sync"
 	"testing"
 	"time"
 
-	"github.com/yonggewang/bdls"
-	"github.com/yonggewang/bdls/crypto/blake2b"
 	"github.com/davecgh/go-spew/spew"
+	proto "github.com/gogo/protobuf/proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/crypto/blake2b"
 )
 
 // init will listen for 6060 while debugging
@@ -131,22 +134,21 @@ func testConsensus(t *testing.T, param *testParam) {
 			agents[i] = NewTCPAgent(all[i], participants[i])
 		}
 
+		// one connection of each pair, the duplicates would be closed
 		for i := 0; i < len(all); i++ {
-			for j := 0; j < len(all); j++ {
-				if i != j {
-					c1, c2 := net.Pipe() // in memory duplex pipe to connection i & j
-					p1 := NewTCPPeer(c1, agents[i])
-					p2 := NewTCPPeer(c2, agents[j])
-					ok := agents[i].AddPeer(p1)
-					assert.True(t, ok)
-					ok = agents[j].AddPeer(p2)
-					assert.True(t, ok)
-					numConns += 2
-
-					// auth public key
-					p1.InitiatePublicKeyAuthentication()
-					p2.InitiatePublicKeyAuthentication()
-				}
+			for j := i + 1; j < len(all); j++ {
+				c1, c2 := net.Pipe() // in memory duplex pipe to connection i & j
+				p1 := NewTCPPeer(c1, agents[i])
+				p2 := NewTCPPeer(c2, agents[j])
+				ok := agents[i].AddPeer(p1)
+				assert.True(t, ok)
+				ok = agents[j].AddPeer(p2)
+				assert.True(t, ok)
+				numConns += 2
+
+				// auth public key
+				p1.InitiatePublicKeyAuthentication()
+				p2.InitiatePublicKeyAuthentication()
 			}
 		}
 
@@ -154,9 +156,12 @@ func testConsensus(t *testing.T, param *testParam) {
 
 		// make sure authentication completed
 		for i := 0; i < len(all); i++ {
-			for _, peer := range agents[i].peers {
+			agents[i].Lock()
+			peers := append([]*TCPPeer(nil), agents[i].peers...)
+			agents[i].Unlock()
+			for _, peer := range peers {
 				peer.Lock()
-				assert.Equal(t, peer.localAuthState, localChallengeAccepted)
+				assert.Equal(t, peer.localAuthState, localAuthConfirmed)
 				assert.Equal(t, peer.peerAuthStatus, peerAuthenticated)
 				peer.Unlock()
 			}
@@ -216,3 +221,483 @@ func testConsensus(t *testing.T, param *testParam) {
 
 	t.Logf("consensus stopped at height:%v for %v peers %v participants", param.stopHeight, param.numPeers, param.numParticipants)
 }
+
+// newTestAgent creates a TCPAgent with a minimal quorum
+func newTestAgent(t testing.TB, privateKey *ecdsa.PrivateKey, opts ...Option) *TCPAgent {
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = privateKey
+	config.Participants = []bdls.Identity{bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey)}
+	for i := 1; i < bdls.ConfigMinimumParticipants; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		config.Participants = append(config.Participants, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	return NewTCPAgent(consensus, privateKey, opts...)
+}
+
+// deadlineConn records writes and their deadlines
+type deadlineConn struct {
+	net.Conn
+	writes    []int
+	deadlines []time.Time
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	c.writes = append(c.writes, len(b))
+	return len(b), nil
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.deadlines = append(c.deadlines, t)
+	return nil
+}
+
+func TestWriteFramesDeadlines(t *testing.T) {
+	conn := new(deadlineConn)
+	p := &TCPPeer{conn: conn, options: defaultTransportOptions()}
+
+	const throughput = ioChunkSize // a chunk per second
+	var batch frameBatch
+	batch.append(make([]byte, 10))
+	batch.append(make([]byte, 2*ioChunkSize))
+	start := time.Now()
+	assert.Nil(t, p.writeFrames(batch.bufs, throughput))
+
+	// frames coalesced, then written in chunks, the buffers are written one
+	// by one as deadlineConn has no vectored I/O
+	assert.Equal(t, []int{MessageLength, 10, MessageLength, ioChunkSize - 2*MessageLength - 10, ioChunkSize, 2*MessageLength + 10}, conn.writes)
+
+	// each chunk is given the time to transfer it at the throughput
+	assert.Equal(t, 3, len(conn.deadlines))
+	assert.True(t, conn.deadlines[0].Sub(start) >= defaultWriteTimeout+time.Second)
+	assert.True(t, conn.deadlines[1].Sub(start) >= defaultWriteTimeout+time.Second)
+	assert.True(t, conn.deadlines[2].Sub(start) < defaultWriteTimeout+time.Second)
+}
+
+func TestFrameBatch(t *testing.T) {
+	var batch frameBatch
+	payload := []byte("abc")
+	batch.append(payload)
+	batch.append(nil)
+	batch.append([]byte("de"))
+	assert.Equal(t, 3*MessageLength+5, batch.size)
+
+	var buf bytes.Buffer
+	_, err := batch.bufs.WriteTo(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{3, 0, 0, 0, 'a', 'b', 'c', 0, 0, 0, 0, 2, 0, 0, 0, 'd', 'e'}, buf.Bytes())
+
+	// the payloads are not copied, and the headers are reused
+	batch.reset()
+	batch.append(payload)
+	assert.True(t, &payload[0] == &batch.bufs[1][0])
+	assert.Equal(t, MessageLength+len(payload), batch.size)
+	assert.Equal(t, float64(0), testing.AllocsPerRun(10, func() {
+		batch.reset()
+		batch.append(payload)
+	}))
+}
+
+// chunkConn records reads and their deadlines
+type chunkConn struct {
+	net.Conn
+	reads     []int
+	deadlines []time.Time
+}
+
+func (c *chunkConn) Read(b []byte) (int, error) {
+	c.reads = append(c.reads, len(b))
+	return len(b), nil
+}
+
+func (c *chunkConn) SetReadDeadline(t time.Time) error {
+	c.deadlines = append(c.deadlines, t)
+	return nil
+}
+
+func TestReadFrameDeadlines(t *testing.T) {
+	conn := new(chunkConn)
+	p := &TCPPeer{conn: conn, options: defaultTransportOptions()}
+
+	const throughput = ioChunkSize // a chunk per second
+	start := time.Now()
+	assert.Nil(t, p.readFrame(make([]byte, 2*ioChunkSize+1), throughput))
+
+	// the deadline is extended for each chunk
+	assert.Equal(t, []int{ioChunkSize, ioChunkSize, 1}, conn.reads)
+	assert.Equal(t, 3, len(conn.deadlines))
+	assert.True(t, conn.deadlines[1].Sub(start) >= defaultReadTimeout+time.Second)
+	assert.True(t, conn.deadlines[2].Sub(start) < defaultReadTimeout+time.Second)
+}
+
+func TestSignatureOffload(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	agents := make([]*TCPAgent, len(participants))
+	for i := range participants {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = participants[i]
+		config.Participants = coords
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		consensus.SetLatency(200 * time.Millisecond)
+
+		agents[i] = NewTCPAgent(consensus, participants[i])
+		agents[i].SetSignatureOffload(true)
+		defer agents[i].Close()
+	}
+
+	for i := 0; i < len(agents); i++ {
+		for j := i + 1; j < len(agents); j++ {
+			c1, c2 := net.Pipe()
+			p1 := NewTCPPeer(c1, agents[i])
+			p2 := NewTCPPeer(c2, agents[j])
+			assert.True(t, agents[i].AddPeer(p1))
+			assert.True(t, agents[j].AddPeer(p2))
+			p1.InitiatePublicKeyAuthentication()
+			p2.InitiatePublicKeyAuthentication()
+		}
+	}
+	<-time.After(time.Second)
+
+	// decide a few heights, with the proofs verifiable by others
+	for i := range agents {
+		agents[i].Update()
+	}
+	const heights = 3
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		height, _, _ := agents[0].GetLatestState()
+		if height >= heights {
+			break
+		}
+		for i := range agents {
+			if h, _, _ := agents[i].GetLatestState(); h == height {
+				data := make([]byte, 1024)
+				io.ReadFull(rand.Reader, data)
+				agents[i].Propose(data)
+			}
+		}
+		<-time.After(100 * time.Millisecond)
+	}
+
+	height, _, _ := agents[0].GetLatestState()
+	assert.GreaterOrEqual(t, height, uint64(heights))
+	proof := agents[0].GetLatestProof()
+	if assert.NotNil(t, proof) {
+		assert.True(t, proof.Verify(bdls.S256Curve))
+		m, err := bdls.DecodeMessage(proof.Message)
+		assert.Nil(t, err)
+		for _, p := range m.Proof {
+			assert.True(t, p.Verify(bdls.S256Curve))
+		}
+	}
+}
+
+func TestRemovePeer(t *testing.T) {
+	keyA, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	keyB, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a := newTestAgent(t, keyA)
+	defer a.Close()
+	b := newTestAgent(t, keyB)
+	defer b.Close()
+
+	connect := func() (*TCPPeer, *TCPPeer) {
+		c1, c2 := net.Pipe()
+		pa := NewTCPPeer(c1, a)
+		pb := NewTCPPeer(c2, b)
+		assert.True(t, a.AddPeer(pa))
+		assert.True(t, b.AddPeer(pb))
+		pa.InitiatePublicKeyAuthentication()
+		pb.InitiatePublicKeyAuthentication()
+		assert.Nil(t, a.waitAuthenticated(pa, &keyB.PublicKey, time.Second, nil))
+		assert.Nil(t, b.waitAuthenticated(pb, &keyA.PublicKey, time.Second, nil))
+		return pa, pb
+	}
+
+	// the peer is removed by it's key, and the connection closed
+	pa, pb := connect()
+	assert.Equal(t, 1, a.NumPeers())
+	pa.Lock()
+	pa.enqueueConsensusMessage([]byte("pending"))
+	pa.Unlock()
+	assert.Equal(t, 1, a.RemovePeerByKey(&keyB.PublicKey))
+	assert.Equal(t, 0, a.NumPeers())
+	<-pa.die
+	<-pb.die
+	assert.True(t, pa.outboundSent())
+	pa.Lock()
+	assert.Equal(t, 0, len(pa.takeConsensusMessages()))
+	pa.Unlock()
+	assert.Eventually(t, func() bool { return b.NumPeers() == 0 }, time.Second, 10*time.Millisecond)
+
+	// removed only once
+	assert.False(t, a.RemovePeer(pa))
+	assert.Equal(t, 0, a.RemovePeerByKey(&keyB.PublicKey))
+
+	// the messages pending are written before a drained peer is removed
+	pa, pb = connect()
+	m := &bdls.Message{Type: bdls.MessageType_RoundChange, Height: 1, Round: 1, State: []byte("drain")}
+	sp := new(bdls.SignedProto)
+	sp.Sign(m, keyA)
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	assert.Nil(t, pa.Send(bts))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, a.DrainPeer(ctx, pa))
+	assert.Equal(t, 0, a.NumPeers())
+	<-pa.die
+	assert.Equal(t, uint64(1), a.Stats().Commands["CONSENSUS"].SentMessages)
+	<-pb.die
+}
+
+// allocation budgets of the per-message hot paths, a change exceeding them
+// reintroduces allocations per message.
+func TestAllocs(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	m := &bdls.Message{Type: bdls.MessageType_Commit, Height: 1, Round: 1, State: make([]byte, 1024)}
+	sp := new(bdls.SignedProto)
+	sp.Sign(m, key)
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+	frame, err := proto.Marshal(&Gossip{Command: CommandType_CONSENSUS, Message: bts})
+	assert.Nil(t, err)
+
+	p := &TCPPeer{chConsensusMessage: make(chan struct{}, 1), traffic: newTrafficCounters()}
+	p.agent = &TCPAgent{traffic: newTrafficCounters()}
+	profiler := bdls.NewProfiler()
+	var msg Gossip
+	var batch frameBatch
+
+	for _, budget := range []struct {
+		name   string
+		allocs float64
+		f      func()
+	}{
+		{"lane", 0, func() { messageLane(bts) }},
+		{"command", 0, func() { gossipCommand(frame) }},
+		{"queue", 0, func() {
+			p.Send(bts)
+			p.Lock()
+			p.nextConsensusMessage()
+			p.Unlock()
+		}},
+		{"count", 0, func() {
+			p.countSent(CommandType_CONSENSUS, frame)
+			p.countReceived(CommandType_CONSENSUS, frame)
+		}},
+		{"profile", 0, func() { profiler.Since(bdls.ProfileIO, profiler.Now()) }},
+		{"batch", 0, func() {
+			batch.reset()
+			batch.append(frame)
+		}},
+		// the frame to write
+		{"encapsulate", 1, func() {
+			msg = Gossip{Command: CommandType_CONSENSUS, Message: bts}
+			compress(&msg, CompressionType_NONE)
+			proto.Marshal(&msg)
+		}},
+		// the message handed over to the consensus
+		{"decapsulate", 1, func() {
+			msg.Reset()
+			proto.Unmarshal(frame, &msg)
+			decompress(&msg)
+		}},
+	} {
+		assert.LessOrEqual(t, testing.AllocsPerRun(100, budget.f), budget.allocs, budget.name)
+	}
+}
+
+func TestMessageQueue(t *testing.T) {
+	var q messageQueue
+	var next byte
+	push := func(n int) {
+		for i := 0; i < n; i++ {
+			q.push([]byte{next})
+			next++
+		}
+	}
+
+	// in order across compactions
+	var expected byte
+	for round := 0; round < 10; round++ {
+		push(5)
+		for i := 0; i < 3; i++ {
+			bts, ok := q.pop()
+			assert.True(t, ok)
+			assert.Equal(t, []byte{expected}, bts)
+			expected++
+		}
+	}
+	assert.Equal(t, 20, len(q.msgs)-q.head)
+	assert.True(t, cap(q.msgs) < 50)
+
+	// the rest taken in order
+	msgs := q.take()
+	assert.Equal(t, 20, len(msgs))
+	assert.Equal(t, []byte{expected}, msgs[0])
+	_, ok := q.pop()
+	assert.False(t, ok)
+}
+
+// readGossip reads frames from conn until a message of cmd
+func readGossip(t *testing.T, conn net.Conn, cmd CommandType) []byte {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		header := make([]byte, MessageLength)
+		_, err := io.ReadFull(conn, header)
+		assert.Nil(t, err)
+		frame := make([]byte, binary.LittleEndian.Uint32(header))
+		_, err = io.ReadFull(conn, frame)
+		assert.Nil(t, err)
+
+		var g Gossip
+		assert.Nil(t, proto.Unmarshal(frame, &g))
+		if g.Command == cmd {
+			return g.Message
+		}
+	}
+}
+
+// fuzzSeeds returns the frames of a handshake and of the consensus traffic
+func fuzzSeeds(t testing.TB) (frames [][]byte, consensus [][]byte) {
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < 2; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, key)
+	}
+	agent := newTestAgent(t, keys[0])
+	defer agent.Close()
+	frames = append(frames, agent.helloFrame())
+
+	auth, err := proto.Marshal(&KeyAuthInit{X: keys[0].PublicKey.X.Bytes(), Y: keys[0].PublicKey.Y.Bytes(), Curve: curveName(keys[0].Curve), Nonce: newNonce(), Timestamp: time.Now().Unix()})
+	assert.Nil(t, err)
+	challenge, err := proto.Marshal(&KeyAuthChallenge{X: keys[1].PublicKey.X.Bytes(), Y: keys[1].PublicKey.Y.Bytes(), Challenge: make([]byte, 32)})
+	assert.Nil(t, err)
+	for _, g := range []Gossip{
+		{Command: CommandType_KEY_AUTH_INIT, Message: auth},
+		{Command: CommandType_KEY_AUTH_CHALLENGE, Message: challenge},
+		{Command: CommandType_KEY_AUTH_CHALLENGE_REPLY, Message: make([]byte, 32)},
+		{Command: CommandType_LATENCY_PING},
+	} {
+		bts, err := proto.Marshal(&g)
+		assert.Nil(t, err)
+		frames = append(frames, bts)
+	}
+
+	for _, m := range []bdls.Message{
+		{Type: bdls.MessageType_RoundChange, Height: 1, State: []byte("state")},
+		{Type: bdls.MessageType_Commit, Height: 1, State: []byte("state")},
+		{Type: bdls.MessageType_Decide, Height: 1, State: []byte("state")},
+	} {
+		signed := new(bdls.SignedProto)
+		signed.Sign(&m, keys[1])
+		bts, err := proto.Marshal(signed)
+		assert.Nil(t, err)
+		consensus = append(consensus, bts)
+
+		g := Gossip{Command: CommandType_CONSENSUS, Message: bts}
+		compress(&g, CompressionType_SNAPPY)
+		if bts, err = proto.Marshal(&g); assert.Nil(t, err) {
+			frames = append(frames, bts)
+		}
+	}
+	return frames, consensus
+}
+
+func FuzzFrame(f *testing.F) {
+	frames, _ := fuzzSeeds(f)
+	for _, frame := range frames {
+		f.Add(frame)
+	}
+
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(f, err)
+	agent := newTestAgent(f, key)
+	defer agent.Close()
+	agent.SetMutualAuthentication(false)
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		c1, _ := net.Pipe()
+		p := NewTCPPeer(c1, agent)
+		defer p.Close()
+		p.handleFrame(frame)
+	})
+}
+
+func FuzzHandshake(f *testing.F) {
+	frames, _ := fuzzSeeds(f)
+	for _, frame := range frames {
+		var g Gossip
+		assert.Nil(f, proto.Unmarshal(frame, &g))
+		f.Add(byte(g.Command), g.Message)
+	}
+
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(f, err)
+	agent := newTestAgent(f, key)
+	defer agent.Close()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// the commands of the handshake, the others are covered by FuzzFrame
+	commands := []CommandType{
+		CommandType_NOP,
+		CommandType_KEY_AUTH_INIT,
+		CommandType_KEY_AUTH_CHALLENGE,
+		CommandType_KEY_AUTH_CHALLENGE_REPLY,
+		CommandType_KEY_AUTH_CONFIRM,
+		CommandType_REKEY,
+	}
+	f.Fuzz(func(t *testing.T, command byte, message []byte) {
+		c1, _ := net.Pipe()
+		p := NewTCPPeer(c1, agent)
+		defer p.Close()
+		p.handleGossip(&Gossip{Command: commands[int(command)%len(commands)], Message: message})
+	})
+}
+
+func FuzzConsensusMessage(f *testing.F) {
+	_, consensus := fuzzSeeds(f)
+	for _, bts := range consensus {
+		f.Add(bts)
+	}
+
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(f, err)
+	agent := newTestAgent(f, key)
+	defer agent.Close()
+	participants := agent.consensus.Participants()
+
+	f.Fuzz(func(t *testing.T, bts []byte) {
+		messageLane(bts)
+		Participation(bts, participants)
+
+		agent.Lock()
+		agent.processConsensusMessage(inboundMessage{bts: bts})
+		agent.Unlock()
+	})
+}
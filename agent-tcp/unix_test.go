@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bdls.sock")
+	l, err := ListenUnix(path)
+	assert.Nil(t, err)
+	defer l.Close()
+
+	// an active socket must not be taken over
+	_, err = ListenUnix(path)
+	assert.Equal(t, ErrUnixSocketInUse, err)
+
+	serverKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	server := newTestAgent(t, serverKey)
+	defer server.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			assert.True(t, server.AddPeer(NewTCPPeer(conn, server)))
+		}
+	}()
+
+	// unnamed unix socket peers must be told apart
+	var peers []*TCPPeer
+	for i := 0; i < 2; i++ {
+		clientKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		client := newTestAgent(t, clientKey)
+		defer client.Close()
+
+		conn, err := DialUnix(path)
+		assert.Nil(t, err)
+		p := NewTCPPeer(conn, client)
+		assert.True(t, client.AddPeer(p))
+		assert.Nil(t, p.InitiatePublicKeyAuthentication())
+		peers = append(peers, p)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		server.Lock()
+		n := len(server.peers)
+		server.Unlock()
+		if n == 2 {
+			break
+		}
+		<-time.After(20 * time.Millisecond)
+	}
+
+	server.Lock()
+	assert.Equal(t, 2, len(server.peers))
+	assert.NotEqual(t, server.peers[0].RemoteAddr().String(), server.peers[1].RemoteAddr().String())
+	server.Unlock()
+	assert.Equal(t, "unix", peers[0].RemoteAddr().Network())
+}
@@ -0,0 +1,121 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package agent
+
+import (
+	proto "github.com/gogo/protobuf/proto"
+)
+
+const (
+	// ProtocolVersion is the wire protocol version of this agent
+	ProtocolVersion = 4
+	// MinProtocolVersion is the oldest version this agent talks, version 1
+	// agents send no HELLO
+	MinProtocolVersion = 1
+)
+
+// protocolCommands is the compatibility matrix of the versions, the newest
+// command each version knows. Agents of version 1 close the connection on
+// commands they don't know, the later ones ignore them.
+var protocolCommands = []CommandType{
+	1: CommandType_REKEY,
+	2: CommandType_REKEY,
+	3: CommandType_PUNCH,
+	4: CommandType_SYNC_DECISION,
+}
+
+// commandSupported returns if the command can be sent to an agent of the
+// version
+func commandSupported(version uint32, command CommandType) bool {
+	if int(version) >= len(protocolCommands) {
+		return true
+	}
+	return command <= protocolCommands[version]
+}
+
+// helloFrame returns the HELLO to send first on a connection
+func (agent *TCPAgent) helloFrame() []byte {
+	hello, err := proto.Marshal(&Hello{
+		Version:    ProtocolVersion,
+		MinVersion: MinProtocolVersion,
+		Features:   agent.getFeatures(),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	bts, err := proto.Marshal(&Gossip{Command: CommandType_NOP, Message: hello})
+	if err != nil {
+		panic(err)
+	}
+	return bts
+}
+
+// handleHello negotiates the protocol version with the peer, the features
+// are taken until the authenticated ones arrive with KeyAuthInit.
+func (p *TCPPeer) handleHello(hello *Hello) error {
+	if hello.Version < MinProtocolVersion || hello.MinVersion > ProtocolVersion {
+		return ErrProtocolVersion
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if p.protocolVersion != 0 {
+		// the version is negotiated once per connection
+		return nil
+	}
+
+	p.protocolVersion = hello.Version
+	if p.protocolVersion > ProtocolVersion {
+		p.protocolVersion = ProtocolVersion
+	}
+	if p.peerAuthStatus == peerNotAuthenticated {
+		p.peerFeatures = toFeatures(hello.Features)
+	}
+	return nil
+}
+
+// ProtocolVersion returns the protocol version negotiated with the peer,
+// peers sending no HELLO are of version 1.
+func (p *TCPPeer) ProtocolVersion() uint32 {
+	p.Lock()
+	defer p.Unlock()
+	return p.negotiatedVersion()
+}
+
+// negotiatedVersion returns the protocol version of the peer, the lock
+// must be held
+func (p *TCPPeer) negotiatedVersion() uint32 {
+	if p.protocolVersion == 0 {
+		return MinProtocolVersion
+	}
+	return p.protocolVersion
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestProtocolVersion(t *testing.T) {
+	key1, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	key2, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	a1 := newTestAgent(t, key1)
+	defer a1.Close()
+	a2 := newTestAgent(t, key2)
+	defer a2.Close()
+
+	c1, c2 := net.Pipe()
+	p1 := NewTCPPeer(c1, a1)
+	p2 := NewTCPPeer(c2, a2)
+	assert.True(t, a1.AddPeer(p1))
+	assert.True(t, a2.AddPeer(p2))
+	assert.Nil(t, p1.InitiatePublicKeyAuthentication())
+	assert.Nil(t, p2.InitiatePublicKeyAuthentication())
+	assert.Eventually(t, func() bool { return p1.GetPublicKey() != nil && p2.GetPublicKey() != nil }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint32(ProtocolVersion), p1.ProtocolVersion())
+	assert.Equal(t, uint32(ProtocolVersion), p2.ProtocolVersion())
+
+	// peers sending no HELLO are of version 1, a newer one is negotiated
+	// down to ours
+	c3, _ := net.Pipe()
+	p := NewTCPPeer(c3, a1)
+	assert.Equal(t, uint32(1), p.ProtocolVersion())
+	assert.Nil(t, p.handleHello(&Hello{Version: ProtocolVersion + 1, MinVersion: 1, Features: []string{string(FeatureCompression)}}))
+	assert.Equal(t, uint32(ProtocolVersion), p.ProtocolVersion())
+	assert.Equal(t, []Feature{FeatureCompression}, p.peerFeatures)
+
+	// the versions must overlap
+	c4, _ := net.Pipe()
+	p = NewTCPPeer(c4, a1)
+	assert.Equal(t, ErrProtocolVersion, p.handleHello(&Hello{Version: ProtocolVersion + 2, MinVersion: ProtocolVersion + 1}))
+
+	// keepalives are not taken as HELLO, and unknown commands are ignored
+	assert.Nil(t, p.handleGossip(&Gossip{Command: CommandType_NOP, Message: []byte{0}}))
+	assert.Equal(t, uint32(1), p.ProtocolVersion())
+	assert.Nil(t, p.handleGossip(&Gossip{Command: CommandType(1000)}))
+
+	// commands newer than the peer's version are not sent
+	assert.True(t, commandSupported(1, CommandType_REKEY))
+	assert.False(t, commandSupported(1, CommandType(1000)))
+	assert.True(t, commandSupported(ProtocolVersion+1, CommandType(1000)))
+}
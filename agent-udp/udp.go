@@ -0,0 +1,161 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package udpagent
+
+import (
+	"errors"
+	"net"
+
+	"github.com/xtaci/kcp-go/v5"
+)
+
+var (
+	// ErrConfigWindow indicates the window sizes are not positive
+	ErrConfigWindow = errors.New("Config.SendWindow and Config.ReceiveWindow must be positive")
+	// ErrConfigMTU indicates the MTU is out of range
+	ErrConfigMTU = errors.New("Config.MTU is out of range")
+)
+
+// Config tunes the retransmission of KCP sessions
+type Config struct {
+	// NoDelay enables nodelay mode of KCP, minimal RTO is reduced to 30ms.
+	NoDelay bool
+	// Interval is the internal update timer interval in milliseconds.
+	Interval int
+	// Resend triggers fast retransmission after the number of duplicated
+	// ACKs, 0 to disable.
+	Resend int
+	// NoCongestion disables the congestion control.
+	NoCongestion bool
+	// SendWindow & ReceiveWindow are the window sizes in packets.
+	SendWindow    int
+	ReceiveWindow int
+	// MTU is the max size of UDP packets.
+	MTU int
+	// ACKNoDelay flushes ACKs immediately when packets are received.
+	ACKNoDelay bool
+	// DataShards & ParityShards set the forward error correction, 0 to disable.
+	DataShards   int
+	ParityShards int
+}
+
+// DefaultConfig returns a config retransmitting aggressively for WAN links
+func DefaultConfig() *Config {
+	return &Config{
+		NoDelay:       true,
+		Interval:      10,
+		Resend:        2,
+		NoCongestion:  true,
+		SendWindow:    1024,
+		ReceiveWindow: 1024,
+		MTU:           1350,
+		ACKNoDelay:    true,
+	}
+}
+
+// VerifyConfig verifies the integrity of this config
+func (c *Config) VerifyConfig() error {
+	if c.SendWindow <= 0 || c.ReceiveWindow <= 0 {
+		return ErrConfigWindow
+	}
+	if c.MTU < 50 || c.MTU > 1500 {
+		return ErrConfigMTU
+	}
+	return nil
+}
+
+// apply configures a session, frames are sent as a byte stream
+func (c *Config) apply(sess *kcp.UDPSession) {
+	nodelay, nc := 0, 0
+	if c.NoDelay {
+		nodelay = 1
+	}
+	if c.NoCongestion {
+		nc = 1
+	}
+	sess.SetStreamMode(true)
+	sess.SetNoDelay(nodelay, c.Interval, c.Resend, nc)
+	sess.SetWindowSize(c.SendWindow, c.ReceiveWindow)
+	sess.SetMtu(c.MTU)
+	sess.SetACKNoDelay(c.ACKNoDelay)
+}
+
+// Dial connects to a KCP listener at addr, config could be nil for
+// DefaultConfig().
+func Dial(addr string, config *Config) (net.Conn, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if err := config.VerifyConfig(); err != nil {
+		return nil, err
+	}
+
+	sess, err := kcp.DialWithOptions(addr, nil, config.DataShards, config.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+	config.apply(sess)
+	return sess, nil
+}
+
+// Listener accepts KCP sessions, it implements net.Listener.
+type Listener struct {
+	*kcp.Listener
+	config *Config
+}
+
+// Listen announces on the UDP address addr, config could be nil for
+// DefaultConfig(), and must be the same on both ends for forward error
+// correction.
+func Listen(addr string, config *Config) (*Listener, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if err := config.VerifyConfig(); err != nil {
+		return nil, err
+	}
+
+	l, err := kcp.ListenWithOptions(addr, nil, config.DataShards, config.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{Listener: l, config: config}, nil
+}
+
+// Accept implements net.Listener
+func (l *Listener) Accept() (net.Conn, error) {
+	sess, err := l.Listener.AcceptKCP()
+	if err != nil {
+		return nil, err
+	}
+	l.config.apply(sess)
+	return sess, nil
+}
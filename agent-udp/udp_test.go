@@ -0,0 +1,91 @@
+package udpagent
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	agent "github.com/yonggewang/bdls/agent-tcp"
+	"github.com/yonggewang/bdls/transport/transporttest"
+)
+
+func newTestAgent(t *testing.T, privateKey *ecdsa.PrivateKey, participants []bdls.Identity) *agent.TCPAgent {
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = privateKey
+	config.Participants = participants
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	return agent.NewTCPAgent(consensus, privateKey)
+}
+
+func TestUDPPeerAuthentication(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	server := newTestAgent(t, keys[0], participants)
+	defer server.Close()
+	client := newTestAgent(t, keys[1], participants)
+	defer client.Close()
+
+	// with forward error correction
+	config := DefaultConfig()
+	config.DataShards = 10
+	config.ParityShards = 3
+	l, err := Listen("127.0.0.1:0", config)
+	assert.Nil(t, err)
+	defer l.Close()
+
+	c1, err := Dial(l.Addr().String(), config)
+	assert.Nil(t, err)
+	p1 := agent.NewTCPPeer(c1, client)
+	assert.True(t, client.AddPeer(p1))
+	assert.Nil(t, p1.InitiatePublicKeyAuthentication())
+
+	c2, err := l.Accept()
+	assert.Nil(t, err)
+	p2 := agent.NewTCPPeer(c2, server)
+	assert.True(t, server.AddPeer(p2))
+	assert.Nil(t, p2.InitiatePublicKeyAuthentication())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for (p1.GetPublicKey() == nil || p2.GetPublicKey() == nil) && time.Now().Before(deadline) {
+		<-time.After(20 * time.Millisecond)
+	}
+
+	assert.Equal(t, &keys[0].PublicKey, p1.GetPublicKey())
+	assert.Equal(t, &keys[1].PublicKey, p2.GetPublicKey())
+	assert.Equal(t, "udp", c1.RemoteAddr().Network())
+}
+
+func TestVerifyConfig(t *testing.T) {
+	config := DefaultConfig()
+	assert.Nil(t, config.VerifyConfig())
+
+	config.SendWindow = 0
+	_, err := Dial("127.0.0.1:1", config)
+	assert.Equal(t, ErrConfigWindow, err)
+
+	config = DefaultConfig()
+	config.MTU = 9000
+	_, err = Listen("127.0.0.1:0", config)
+	assert.Equal(t, ErrConfigMTU, err)
+}
+
+func TestTransportConformance(t *testing.T) {
+	suite := &transporttest.Suite{Transport: new(Transport), Addr: "127.0.0.1:0", SkipCloseNotify: true}
+	suite.Run(t)
+}
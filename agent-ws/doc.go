@@ -0,0 +1,5 @@
+// Package wsagent carries the agent-tcp protocol over WebSocket, each binary
+// message holds exactly one length-prefixed Gossip frame. Peers can connect
+// over ws/wss on port 443 where only outbound HTTPS is allowed, connections
+// from Dial and Listener can be used with agent.NewTCPPeer.
+package wsagent
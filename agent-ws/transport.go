@@ -0,0 +1,97 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package wsagent
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/yonggewang/bdls/transport"
+)
+
+var _ transport.Transport = (*Transport)(nil)
+
+// Transport implements transport.Transport over websocket, it listens with
+// it's own http server, addresses are host:port.
+type Transport struct {
+	Path            string      // (optional) the http path, defaults to "/"
+	Header          http.Header // (optional) extra headers to dial with
+	TLSConfig       *tls.Config // (optional) dials wss:// if set
+	ServerTLSConfig *tls.Config // (optional) serves https if set
+}
+
+func (t *Transport) path() string {
+	if t.Path == "" {
+		return "/"
+	}
+	return t.Path
+}
+
+// Dial implements transport.Transport
+func (t *Transport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	scheme := "ws://"
+	if t.TLSConfig != nil {
+		scheme = "wss://"
+	}
+	return Dial(ctx, scheme+addr+t.path(), t.Header, t.TLSConfig)
+}
+
+// Listen implements transport.Transport
+func (t *Transport) Listen(addr string) (net.Listener, error) {
+	tl, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if t.ServerTLSConfig != nil {
+		tl = tls.NewListener(tl, t.ServerTLSConfig)
+	}
+
+	l := NewListener(tl.Addr())
+	mux := http.NewServeMux()
+	mux.Handle(t.path(), l)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: defaultHandshakeTimeout}
+	go server.Serve(tl)
+	return &serverListener{Listener: l, server: server}, nil
+}
+
+// serverListener closes the http server along with the Listener
+type serverListener struct {
+	*Listener
+	server *http.Server
+}
+
+// Close implements net.Listener
+func (l *serverListener) Close() error {
+	l.Listener.Close()
+	return l.server.Close()
+}
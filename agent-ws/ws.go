@@ -0,0 +1,233 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package wsagent
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	agent "github.com/yonggewang/bdls/agent-tcp"
+)
+
+const (
+	// Subprotocol is the websocket subprotocol negotiated for consensus connections
+	Subprotocol = "bdls"
+
+	// timeout for websocket upgrade handshake
+	defaultHandshakeTimeout = 10 * time.Second
+)
+
+var (
+	// ErrFrameLength indicates the length prefix of a frame exceeds the maximum
+	ErrFrameLength = errors.New("frame length exceeded maximum")
+	// ErrMessageType indicates a non-binary websocket message has been received
+	ErrMessageType = errors.New("websocket message is not binary")
+)
+
+// Conn adapts a websocket connection into a net.Conn, writes are buffered
+// until a whole |MessageLength|Message| frame has been written, then sent
+// as one binary message, reads are concatenated from binary messages.
+type Conn struct {
+	ws     *websocket.Conn
+	reader io.Reader // reader of current incoming message
+	wbuf   []byte    // partial outgoing frame
+	wmu    sync.Mutex
+}
+
+// NewConn creates a net.Conn from a websocket connection
+func NewConn(ws *websocket.Conn) *Conn {
+	ws.SetReadLimit(agent.MessageLength + agent.MaxMessageLength)
+	return &Conn{ws: ws}
+}
+
+// Read implements net.Conn
+func (c *Conn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			messageType, r, err := c.ws.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			if messageType != websocket.BinaryMessage {
+				return 0, ErrMessageType
+			}
+			c.reader = r
+		}
+
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Write implements net.Conn
+func (c *Conn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.wbuf = append(c.wbuf, b...)
+	for len(c.wbuf) >= agent.MessageLength {
+		length := binary.LittleEndian.Uint32(c.wbuf)
+		if length > agent.MaxMessageLength {
+			return 0, ErrFrameLength
+		}
+
+		size := agent.MessageLength + int(length)
+		if len(c.wbuf) < size {
+			break
+		}
+
+		if err := c.ws.WriteMessage(websocket.BinaryMessage, c.wbuf[:size]); err != nil {
+			return 0, err
+		}
+		c.wbuf = c.wbuf[:copy(c.wbuf, c.wbuf[size:])]
+	}
+	return len(b), nil
+}
+
+// Close implements net.Conn
+func (c *Conn) Close() error { return c.ws.Close() }
+
+// LocalAddr implements net.Conn
+func (c *Conn) LocalAddr() net.Addr { return c.ws.LocalAddr() }
+
+// RemoteAddr implements net.Conn
+func (c *Conn) RemoteAddr() net.Addr { return c.ws.RemoteAddr() }
+
+// SetDeadline implements net.Conn
+func (c *Conn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn
+func (c *Conn) SetReadDeadline(t time.Time) error { return c.ws.SetReadDeadline(t) }
+
+// SetWriteDeadline implements net.Conn
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.ws.SetWriteDeadline(t) }
+
+// Dial connects to a websocket endpoint like "wss://example.com:443/bdls",
+// the tlsConf is used for wss urls, and could be nil for system defaults.
+func Dial(ctx context.Context, url string, header http.Header, tlsConf *tls.Config) (net.Conn, error) {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: defaultHandshakeTimeout,
+		TLSClientConfig:  tlsConf,
+		Subprotocols:     []string{Subprotocol},
+	}
+
+	ws, _, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(ws), nil
+}
+
+// Listener upgrades http requests to websocket connections, it implements
+// http.Handler to be mounted on a http(s) server, and net.Listener to accept
+// the upgraded connections.
+type Listener struct {
+	upgrader websocket.Upgrader
+	addr     net.Addr
+	chConns  chan net.Conn
+
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+// NewListener creates a Listener, addr is the address of the http server
+// it will be mounted on, and will be returned by Addr().
+func NewListener(addr net.Addr) *Listener {
+	l := new(Listener)
+	l.upgrader.HandshakeTimeout = defaultHandshakeTimeout
+	l.upgrader.Subprotocols = []string{Subprotocol}
+	// peers are authenticated by KEY_AUTH handshake, not by origin
+	l.upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	l.addr = addr
+	l.chConns = make(chan net.Conn)
+	l.die = make(chan struct{})
+	return l
+}
+
+// ServeHTTP implements http.Handler
+func (l *Listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-l.die:
+		http.Error(w, "listener closed", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	ws, err := l.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	select {
+	case l.chConns <- NewConn(ws):
+	case <-l.die:
+		ws.Close()
+	}
+}
+
+// Accept implements net.Listener
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.chConns:
+		return conn, nil
+	case <-l.die:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener, the http server has to be closed separately.
+func (l *Listener) Close() error {
+	l.dieOnce.Do(func() { close(l.die) })
+	return nil
+}
+
+// Addr implements net.Listener
+func (l *Listener) Addr() net.Addr { return l.addr }
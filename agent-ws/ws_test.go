@@ -0,0 +1,112 @@
+package wsagent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	agent "github.com/yonggewang/bdls/agent-tcp"
+	"github.com/yonggewang/bdls/transport/transporttest"
+)
+
+func newTestAgent(t *testing.T, privateKey *ecdsa.PrivateKey, participants []bdls.Identity) *agent.TCPAgent {
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = privateKey
+	config.Participants = participants
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	return agent.NewTCPAgent(consensus, privateKey)
+}
+
+func TestWSPeerAuthentication(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	server := newTestAgent(t, keys[0], participants)
+	defer server.Close()
+	client := newTestAgent(t, keys[1], participants)
+	defer client.Close()
+
+	l := NewListener(nil)
+	defer l.Close()
+	ts := httptest.NewServer(l)
+	defer ts.Close()
+
+	c1, err := Dial(context.Background(), "ws"+strings.TrimPrefix(ts.URL, "http"), nil, nil)
+	assert.Nil(t, err)
+	p1 := agent.NewTCPPeer(c1, client)
+	assert.True(t, client.AddPeer(p1))
+	assert.Nil(t, p1.InitiatePublicKeyAuthentication())
+
+	c2, err := l.Accept()
+	assert.Nil(t, err)
+	p2 := agent.NewTCPPeer(c2, server)
+	assert.True(t, server.AddPeer(p2))
+	assert.Nil(t, p2.InitiatePublicKeyAuthentication())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for (p1.GetPublicKey() == nil || p2.GetPublicKey() == nil) && time.Now().Before(deadline) {
+		<-time.After(20 * time.Millisecond)
+	}
+
+	assert.Equal(t, &keys[0].PublicKey, p1.GetPublicKey())
+	assert.Equal(t, &keys[1].PublicKey, p2.GetPublicKey())
+}
+
+func TestWSFraming(t *testing.T) {
+	l := NewListener(nil)
+	defer l.Close()
+	ts := httptest.NewServer(l)
+	defer ts.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer ws.Close()
+
+	conn, err := l.Accept()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// a frame written in pieces is sent as one binary message
+	frame := make([]byte, agent.MessageLength+3)
+	binary.LittleEndian.PutUint32(frame, 3)
+	copy(frame[agent.MessageLength:], []byte{1, 2, 3})
+	_, err = conn.Write(frame[:agent.MessageLength])
+	assert.Nil(t, err)
+	_, err = conn.Write(frame[agent.MessageLength:])
+	assert.Nil(t, err)
+
+	messageType, bts, err := ws.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, websocket.BinaryMessage, messageType)
+	assert.Equal(t, frame, bts)
+
+	// text messages are rejected
+	assert.Nil(t, ws.WriteMessage(websocket.TextMessage, frame))
+	_, err = conn.Read(make([]byte, len(frame)))
+	assert.Equal(t, ErrMessageType, err)
+}
+
+func TestTransportConformance(t *testing.T) {
+	suite := &transporttest.Suite{Transport: &Transport{Path: "/bdls"}, Addr: "127.0.0.1:0"}
+	suite.Run(t)
+}
@@ -0,0 +1,172 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/yonggewang/bdls/crypto/blake2b"
+)
+
+// beaconDomain separates the VRF inputs & the randomness of beacons from
+// other uses of the keys
+const beaconDomain = "BDLS-BEACON"
+
+// Beacon is the randomness decided at a height. With Config.EnableBeacon,
+// the participants attach a VRF proof over the height to their <commit>
+// messages, and the randomness is the hash of the VRF outputs of the
+// <commit> proofs in the <decide> message, so it can't be computed before
+// a quorum has committed, and is verified by anyone with the <decide>
+// message.
+//
+// Each VRF output is unique to the participant & height, so no participant
+// can grind it's contribution. The leader of the deciding round chooses
+// which of the <commit> messages beyond a quorum are included though, so
+// it has a choice among a few values of the randomness, applications
+// requiring it to be unbiased should commit to their use of the randomness
+// of a height before it's decided.
+type Beacon struct {
+	// the height the randomness is decided at
+	Height uint64
+	// the randomness
+	Randomness [32]byte
+	// the participants contributed their VRF outputs
+	Contributors []Identity
+}
+
+// beaconSeed returns the VRF input of participants at the height
+func beaconSeed(height uint64) []byte {
+	seed := make([]byte, len(beaconDomain)+8)
+	copy(seed, beaconDomain)
+	binary.BigEndian.PutUint64(seed[len(beaconDomain):], height)
+	return seed
+}
+
+// proveBeacon returns the VRF proof of this participant at the height
+func (c *Consensus) proveBeacon(height uint64) []byte {
+	_, proof, err := VRFProve(c.privateKey, beaconSeed(height))
+	if err != nil {
+		panic(err)
+	}
+	return proof
+}
+
+// verifyCommitBeacon verifies the VRF proof of a <commit> message signed by
+// the key, returns the VRF output
+func (c *Consensus) verifyCommitBeacon(m *Message, signed *SignedProto) ([32]byte, error) {
+	output, err := VRFVerify(signed.PublicKey(c.curve), beaconSeed(m.Height), m.Beacon)
+	if err != nil {
+		return output, ErrCommitBeacon
+	}
+	return output, nil
+}
+
+// CurrentBeacon returns the beacon of the latest height decided, derived
+// from the <decide> message returned by CurrentProof.
+func (c *Consensus) CurrentBeacon() (*Beacon, error) {
+	if c.latestProof == nil {
+		return nil, ErrBeaconNotFound
+	}
+	m, err := DecodeMessage(c.latestProof.Message)
+	if err != nil {
+		return nil, err
+	}
+	return c.deriveBeacon(m)
+}
+
+// ValidateBeacon validates a <decide> message like ValidateDecideMessage,
+// and returns the beacon derived from it, for non-participants to verify the
+// randomness of a height.
+func (c *Consensus) ValidateBeacon(bts []byte, targetState []byte) (*Beacon, error) {
+	signed, err := DecodeSignedMessage(bts)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.validateDecideMessage(signed, targetState); err != nil {
+		return nil, err
+	}
+	m, err := DecodeMessage(signed.Message)
+	if err != nil {
+		return nil, err
+	}
+	return c.deriveBeacon(m)
+}
+
+// deriveBeacon verifies the VRF proofs in the <commit> proofs of a <decide>
+// message, and hashes their outputs to the randomness, the signatures of the
+// proofs must have been verified.
+func (c *Consensus) deriveBeacon(m *Message) (*Beacon, error) {
+	if m.Type != MessageType_Decide {
+		return nil, ErrBeaconMessage
+	}
+
+	outputs := make(map[Identity][32]byte)
+	for _, proof := range m.Proof {
+		mProof, err := DecodeMessage(proof.Message)
+		if err != nil {
+			return nil, err
+		}
+		if mProof.Type != MessageType_Commit || mProof.Height != m.Height {
+			return nil, ErrBeaconMessage
+		}
+		output, err := c.verifyCommitBeacon(mProof, proof)
+		if err != nil {
+			return nil, err
+		}
+		outputs[c.pubKeyToIdentity(proof.PublicKey(c.curve))] = output
+	}
+	if len(outputs) == 0 {
+		return nil, ErrBeaconNotFound
+	}
+
+	beacon := &Beacon{Height: m.Height}
+	sorted := make([][32]byte, 0, len(outputs))
+	for id, output := range outputs {
+		beacon.Contributors = append(beacon.Contributors, id)
+		sorted = append(sorted, output)
+	}
+	sort.Slice(beacon.Contributors, func(i, j int) bool {
+		return bytes.Compare(beacon.Contributors[i][:], beacon.Contributors[j][:]) < 0
+	})
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][:], sorted[j][:]) < 0 })
+
+	// the outputs are hashed in order, so the randomness doesn't depend on
+	// the order of the proofs
+	h, _ := blake2b.New256(nil)
+	h.Write(beaconSeed(m.Height))
+	for _, output := range sorted {
+		h.Write(output[:])
+	}
+	copy(beacon.Randomness[:], h.Sum(nil))
+	return beacon, nil
+}
@@ -0,0 +1,279 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/yonggewang/bdls/crypto/blake2b"
+	"golang.org/x/crypto/bn256"
+)
+
+const (
+	// blsCommitDomain separates the digests signed by BLS keys in <commit>
+	blsCommitDomain = "BDLS_BLS_COMMIT"
+	// blsPossessionDomain separates the proofs of possession of BLS keys
+	blsPossessionDomain = "BDLS_BLS_POSSESSION"
+)
+
+// ErrBLSKey will be returned if a BLS key is malformed
+var ErrBLSKey = errors.New("incorrect BLS key format")
+
+// bn256P is the prime of the base field of bn256
+var bn256P, _ = new(big.Int).SetString("65000549695646603732796438742359905742825358107623003571877145026864184071783", 10)
+
+// BLSPrivateKey is a BLS key on the BN256 curve to sign <commit> messages,
+// so the leader can aggregate the signatures into a single one of constant
+// size in <decide>, see Config.BLSKey.
+//
+// NOTE: BN256 is estimated to provide about 100 bits of security.
+type BLSPrivateKey struct {
+	x   *big.Int
+	pub *BLSPublicKey
+}
+
+// BLSPublicKey is the public key of a BLSPrivateKey, a point on G2
+type BLSPublicKey struct {
+	p *bn256.G2
+}
+
+// GenerateBLSKey generates a BLS private key with the randomness from r
+func GenerateBLSKey(r io.Reader) (*BLSPrivateKey, error) {
+	x, p, err := bn256.RandomG2(r)
+	if err != nil {
+		return nil, err
+	}
+	return &BLSPrivateKey{x: x, pub: &BLSPublicKey{p: p}}, nil
+}
+
+// UnmarshalBLSPrivateKey decodes a BLS private key encoded by Marshal
+func UnmarshalBLSPrivateKey(data []byte) (*BLSPrivateKey, error) {
+	x := new(big.Int).SetBytes(data)
+	if len(data) != 32 || x.Sign() == 0 || x.Cmp(bn256.Order) >= 0 {
+		return nil, ErrBLSKey
+	}
+	return &BLSPrivateKey{x: x, pub: &BLSPublicKey{p: new(bn256.G2).ScalarBaseMult(x)}}, nil
+}
+
+// Marshal encodes the private key in 32 bytes
+func (k *BLSPrivateKey) Marshal() []byte {
+	data := make([]byte, 32)
+	return k.x.FillBytes(data)
+}
+
+// PublicKey returns the public key of the private key
+func (k *BLSPrivateKey) PublicKey() *BLSPublicKey { return k.pub }
+
+// ProvePossession returns a signature of the public key, which shall be
+// checked by VerifyPossession before the key is configured in
+// Config.BLSPublicKeys, as the aggregated signatures are forgeable with
+// keys crafted from the others' keys.
+func (k *BLSPrivateKey) ProvePossession() []byte {
+	return k.sign(blsPossessionDigest(k.pub))
+}
+
+// sign signs the digest, the signature is a point on G1
+func (k *BLSPrivateKey) sign(digest []byte) []byte {
+	return new(bn256.G1).ScalarMult(blsHashToG1(digest), k.x).Marshal()
+}
+
+// UnmarshalBLSPublicKey decodes a BLS public key encoded by Marshal
+func UnmarshalBLSPublicKey(data []byte) (*BLSPublicKey, error) {
+	// the point at infinity verifies any signature of it's own
+	p, ok := new(bn256.G2).Unmarshal(data)
+	if !ok || bytes.Equal(data, make([]byte, len(data))) {
+		return nil, ErrBLSKey
+	}
+	return &BLSPublicKey{p: p}, nil
+}
+
+// Marshal encodes the public key in 128 bytes
+func (pk *BLSPublicKey) Marshal() []byte { return pk.p.Marshal() }
+
+// VerifyPossession verifies the proof returned by ProvePossession
+func (pk *BLSPublicKey) VerifyPossession(proof []byte) bool {
+	return blsVerify(pk.p, blsPossessionDigest(pk), proof)
+}
+
+// blsPossessionDigest is the digest signed to prove the possession of a key
+func blsPossessionDigest(pk *BLSPublicKey) []byte {
+	digest := blake2b.Sum256(append([]byte(blsPossessionDomain), pk.Marshal()...))
+	return digest[:]
+}
+
+// blsCommitDigest is the digest signed by BLS keys in <commit>, it's the same
+// for all the participants committing to the state, so the signatures can be
+// aggregated and verified at once.
+func blsCommitDigest(height uint64, round uint64, stateHash StateHash) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(blsCommitDomain)
+	binary.Write(&buf, binary.LittleEndian, height)
+	binary.Write(&buf, binary.LittleEndian, round)
+	buf.Write(stateHash[:])
+	digest := blake2b.Sum256(buf.Bytes())
+	return digest[:]
+}
+
+// blsHashToG1 maps the digest to a point on G1 by try-and-increment, the
+// cofactor of G1 is 1, so every point on the curve is in G1.
+func blsHashToG1(digest []byte) *bn256.G1 {
+	x := new(big.Int).SetBytes(digest)
+	x.Mod(x, bn256P)
+	three := big.NewInt(3)
+	for {
+		// y² = x³ + 3
+		rhs := new(big.Int).Exp(x, three, bn256P)
+		rhs.Add(rhs, three)
+		rhs.Mod(rhs, bn256P)
+		if y := new(big.Int).ModSqrt(rhs, bn256P); y != nil {
+			point := make([]byte, 64)
+			x.FillBytes(point[:32])
+			y.FillBytes(point[32:])
+			if g, ok := new(bn256.G1).Unmarshal(point); ok {
+				return g
+			}
+		}
+		x.Add(x, big.NewInt(1))
+		x.Mod(x, bn256P)
+	}
+}
+
+// blsAggregate sums the signatures, it returns false if any is malformed
+func blsAggregate(sigs [][]byte) ([]byte, bool) {
+	var sum *bn256.G1
+	for _, sig := range sigs {
+		p, ok := new(bn256.G1).Unmarshal(sig)
+		if !ok {
+			return nil, false
+		}
+		if sum == nil {
+			sum = p
+		} else {
+			sum = new(bn256.G1).Add(sum, p)
+		}
+	}
+	if sum == nil {
+		return nil, false
+	}
+	return sum.Marshal(), true
+}
+
+// blsVerify verifies the signature of the digest by the public key, which
+// may be the sum of the public keys of an aggregated signature.
+func blsVerify(pk *bn256.G2, digest []byte, sig []byte) bool {
+	s, ok := new(bn256.G1).Unmarshal(sig)
+	if !ok {
+		return false
+	}
+	// e(sig, g2) == e(H(m), pk)
+	g2 := new(bn256.G2).ScalarBaseMult(big.NewInt(1))
+	return bytes.Equal(bn256.Pair(s, g2).Marshal(), bn256.Pair(blsHashToG1(digest), pk).Marshal())
+}
+
+// signCommitBLS returns the BLS signature of this participant for <commit>
+func (c *Consensus) signCommitBLS(m *Message) []byte {
+	return c.blsKey.sign(blsCommitDigest(m.Height, m.Round, c.stateHash(m.State)))
+}
+
+// verifyCommitBLS verifies the BLS signature of a <commit> message signed
+// by the key.
+func (c *Consensus) verifyCommitBLS(m *Message, signed *SignedProto) error {
+	id := c.pubKeyToIdentity(signed.PublicKey(c.curve))
+	pk := c.blsPublicKeys[id]
+	digest := blsCommitDigest(m.Height, m.Round, c.stateHash(m.State))
+	if c.preverified[shareKey(id, digest, m.BLSSignature)] && pk != nil {
+		return nil
+	}
+	if pk == nil || !blsVerify(pk.p, digest, m.BLSSignature) {
+		return ErrCommitBLSSignature
+	}
+	return nil
+}
+
+// aggregateCommitsBLS aggregates the BLS signatures of the <commit> messages
+// to the locked state in current round, returns the signature and the
+// bitmap of the signers, bit i of byte i/8 for the i-th participant.
+func (c *Consensus) aggregateCommitsBLS() (sig []byte, signers []byte) {
+	index := make(map[Identity]int, len(c.participants))
+	for i := len(c.participants) - 1; i >= 0; i-- {
+		index[c.participants[i]] = i
+	}
+
+	signers = make([]byte, (len(c.participants)+7)/8)
+	var sigs [][]byte
+	for _, commit := range c.currentRound.commits {
+		if commit.StateHash != c.currentRound.LockedStateHash {
+			continue
+		}
+		i := index[c.pubKeyToIdentity(commit.Signed.PublicKey(c.curve))]
+		signers[i/8] |= 1 << (i % 8)
+		sigs = append(sigs, commit.Message.BLSSignature)
+	}
+	sig, _ = blsAggregate(sigs)
+	return sig, signers
+}
+
+// verifyDecideBLS verifies the aggregated BLS signature of a <decide>
+// message, the signers must weigh at least 2t+1.
+func (c *Consensus) verifyDecideBLS(m *Message) error {
+	if len(m.Signers) != (len(c.participants)+7)/8 {
+		return ErrDecideProofInsufficient
+	}
+
+	var weight uint64
+	var pk *bn256.G2
+	signed := make(map[Identity]bool)
+	for i, id := range c.participants {
+		if m.Signers[i/8]&(1<<(i%8)) == 0 || signed[id] {
+			continue
+		}
+		signed[id] = true
+		weight += c.weight(id)
+		if pk == nil {
+			pk = c.blsPublicKeys[id].p
+		} else {
+			pk = new(bn256.G2).Add(pk, c.blsPublicKeys[id].p)
+		}
+	}
+
+	if weight < 2*c.t()+1 {
+		return ErrDecideProofInsufficient
+	}
+
+	if !blsVerify(pk, blsCommitDigest(m.Height, m.Round, c.stateHash(m.State)), m.BLSSignature) {
+		return ErrDecideBLSSignature
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBLSKey(t *testing.T) {
+	key, err := GenerateBLSKey(rand.Reader)
+	assert.Nil(t, err)
+	other, err := GenerateBLSKey(rand.Reader)
+	assert.Nil(t, err)
+
+	decoded, err := UnmarshalBLSPrivateKey(key.Marshal())
+	assert.Nil(t, err)
+	assert.Equal(t, key.PublicKey().Marshal(), decoded.PublicKey().Marshal())
+	pk, err := UnmarshalBLSPublicKey(key.PublicKey().Marshal())
+	assert.Nil(t, err)
+	_, err = UnmarshalBLSPublicKey(make([]byte, 128))
+	assert.Equal(t, ErrBLSKey, err)
+
+	assert.True(t, pk.VerifyPossession(key.ProvePossession()))
+	assert.False(t, pk.VerifyPossession(other.ProvePossession()))
+}
+
+func TestBLSAggregatedDecide(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []Identity
+	var blsKeys []*BLSPrivateKey
+	var blsPublicKeys []*BLSPublicKey
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+		blsKey, err := GenerateBLSKey(rand.Reader)
+		assert.Nil(t, err)
+		blsKeys = append(blsKeys, blsKey)
+		blsPublicKeys = append(blsPublicKeys, blsKey.PublicKey())
+	}
+
+	epoch := time.Now()
+	newConfig := func(privateKey *ecdsa.PrivateKey, blsKey *BLSPrivateKey) *Config {
+		config := new(Config)
+		config.Epoch = epoch
+		config.PrivateKey = privateKey
+		config.Participants = coords
+		config.ExperimentalBN256 = true
+		config.BLSKey = blsKey
+		config.BLSPublicKeys = blsPublicKeys
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a State) bool { return true }
+		return config
+	}
+
+	var peers []*IPCPeer
+	for i := range participants {
+		consensus, err := NewConsensus(newConfig(participants[i], blsKeys[i]))
+		assert.Nil(t, err)
+		consensus.SetLatency(50 * time.Millisecond)
+		peers = append(peers, NewIPCPeer(consensus, 10*time.Millisecond))
+	}
+	for i := range peers {
+		for j := range peers {
+			if i != j {
+				assert.True(t, peers[i].c.Join(peers[j]))
+			}
+		}
+	}
+	for i := range peers {
+		peers[i].Update()
+		data := make([]byte, 1024)
+		io.ReadFull(rand.Reader, data)
+		peers[i].Propose(data)
+	}
+	defer func() {
+		for i := range peers {
+			peers[i].Close()
+		}
+	}()
+
+	for i := range peers {
+		assert.Eventually(t, func() bool { h, _, _ := peers[i].GetLatestState(); return h > 0 }, 20*time.Second, 20*time.Millisecond)
+	}
+
+	// the <decide> carries a signature of constant size instead of proofs
+	peers[0].Lock()
+	_, _, state := peers[0].c.CurrentState()
+	signed := peers[0].c.CurrentProof()
+	peers[0].Unlock()
+	m, err := DecodeMessage(signed.Message)
+	assert.Nil(t, err)
+	assert.Empty(t, m.Proof)
+	assert.Len(t, m.BLSSignature, 64)
+	assert.Len(t, m.Signers, 1)
+
+	observer, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	verifier, err := NewConsensus(newConfig(observer, nil))
+	assert.Nil(t, err)
+	decide, err := proto.Marshal(signed)
+	assert.Nil(t, err)
+	assert.Nil(t, verifier.ValidateDecideMessage(decide, state))
+
+	// the leader can't claim more signers than aggregated, nor fewer than
+	// the quorum
+	leader := verifier.roundLeader(m.Round)
+	var leaderKey *ecdsa.PrivateKey
+	for i := range coords {
+		if coords[i] == leader {
+			leaderKey = participants[i]
+		}
+	}
+	forge := func(signers byte) error {
+		forged := *m
+		forged.Signers = []byte{signers}
+		sp := new(SignedProto)
+		sp.Sign(&forged, leaderKey)
+		bts, err := proto.Marshal(sp)
+		assert.Nil(t, err)
+		return verifier.ValidateDecideMessage(bts, state)
+	}
+	assert.Nil(t, forge(m.Signers[0]))
+	if m.Signers[0] != 0x0f {
+		assert.Equal(t, ErrDecideBLSSignature, forge(0x0f))
+	}
+	assert.Equal(t, ErrDecideProofInsufficient, forge(0x03))
+
+	// experimental only
+	config := newConfig(observer, nil)
+	config.ExperimentalBN256 = false
+	assert.Equal(t, ErrConfigExperimental, VerifyConfig(config))
+
+	// keys for each participant, not with the beacon
+	config = newConfig(observer, nil)
+	config.BLSPublicKeys = blsPublicKeys[1:]
+	assert.Equal(t, ErrConfigBLSPublicKeys, VerifyConfig(config))
+	config.BLSKey = blsKeys[0]
+	config.BLSPublicKeys = nil
+	assert.Equal(t, ErrConfigBLSPublicKeys, VerifyConfig(config))
+	config = newConfig(observer, nil)
+	config.EnableBeacon = true
+	assert.Equal(t, ErrConfigBLSBeacon, VerifyConfig(config))
+}
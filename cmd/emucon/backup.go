@@ -0,0 +1,319 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yonggewang/bdls/crypto/blake2b"
+	"github.com/yonggewang/bdls/node"
+)
+
+// manifestName is the name of the integrity manifest in a backup archive,
+// it's always the last entry of the archive.
+const manifestName = "MANIFEST.json"
+
+// A Manifest lists the files in a backup archive with their hashes
+type Manifest struct {
+	Created time.Time       `json:"created"`
+	Files   []ManifestEntry `json:"files"`
+}
+
+// A ManifestEntry describes a file in a backup archive
+type ManifestEntry struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"` // hex encoded blake2b-256
+}
+
+// backup writes the files to w as a gzipped tarball, followed by a manifest
+// of their hashes. The directories, like the data directory of the
+// namespaces, are archived recursively under their base names. The
+// directories locked by a node, see node.LockDir, are locked until the
+// backup completes, so a running node is not backed up half-written, and
+// the lock files are left out. Each file is read exactly once, so the
+// hashes in the manifest are those of the archived contents.
+func backup(w io.Writer, paths []string) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	var locks []*node.DirLock
+	defer func() {
+		for _, lock := range locks {
+			lock.Unlock()
+		}
+	}()
+
+	manifest := Manifest{Created: time.Now()}
+	names := make(map[string]bool)
+	add := func(path string, name string) error {
+		if names[name] || name == manifestName {
+			return fmt.Errorf("duplicated file name in backup: %v", name)
+		}
+		names[name] = true
+
+		entry, err := backupFile(tw, path, name)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, entry)
+		return nil
+	}
+
+	for _, root := range paths {
+		fi, err := os.Stat(root)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			if err := add(root, filepath.Base(root)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if _, err := os.Lstat(filepath.Join(path, node.LockName)); err == nil {
+					lock, err := node.LockDir(path)
+					if err != nil {
+						return fmt.Errorf("%v: %w, stop the node first", path, err)
+					}
+					locks = append(locks, lock)
+				}
+				return nil
+			}
+			if d.Name() == node.LockName {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			return add(path, filepath.ToSlash(filepath.Join(filepath.Base(root), rel)))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	bts, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{Name: manifestName, Mode: 0600, Size: int64(len(bts)), ModTime: manifest.Created}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(bts); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// backupFile archives a regular file as name
+func backupFile(tw *tar.Writer, path string, name string) (entry ManifestEntry, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return entry, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return entry, err
+	}
+	if !fi.Mode().IsRegular() {
+		return entry, fmt.Errorf("not a regular file: %v", path)
+	}
+
+	hdr := &tar.Header{Name: name, Mode: int64(fi.Mode().Perm()), Size: fi.Size(), ModTime: fi.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return entry, err
+	}
+
+	h, err := blake2b.New256(nil)
+	if err != nil {
+		return entry, err
+	}
+	// the file size is fixed by the header, a file changing during
+	// backup will fail here instead of producing a torn archive.
+	if _, err := io.CopyN(io.MultiWriter(tw, h), file, fi.Size()); err != nil {
+		return entry, err
+	}
+
+	entry.Name = name
+	entry.Size = fi.Size()
+	entry.Hash = hex.EncodeToString(h.Sum(nil))
+	return entry, nil
+}
+
+// restore extracts a backup archive from r into dir, the files are only
+// moved into dir after all of them have been verified against the manifest.
+// Existing files will not be overwritten unless force is set. The files of
+// the directories archived are restored under dir, the paths leading out
+// of dir are rejected.
+func restore(r io.Reader, dir string, force bool) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	staging, err := os.MkdirTemp(dir, ".restore")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	hashes := make(map[string]string)
+	var manifest *Manifest
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if manifest != nil {
+			return errors.New("unexpected file after manifest in backup")
+		}
+
+		if hdr.Name == manifestName {
+			manifest = new(Manifest)
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if hdr.Typeflag != tar.TypeReg || !validName(hdr.Name) {
+			return fmt.Errorf("invalid file in backup: %v", hdr.Name)
+		}
+		if _, ok := hashes[hdr.Name]; ok {
+			return fmt.Errorf("duplicated file in backup: %v", hdr.Name)
+		}
+
+		path := filepath.Join(staging, filepath.FromSlash(hdr.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		hash, err := restoreFile(tr, path, os.FileMode(hdr.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		hashes[hdr.Name] = hash
+	}
+
+	// verify integrity
+	if manifest == nil {
+		return errors.New("missing manifest in backup")
+	}
+	if len(manifest.Files) != len(hashes) {
+		return errors.New("files in backup mismatch the manifest")
+	}
+	for _, entry := range manifest.Files {
+		if hash, ok := hashes[entry.Name]; !ok || hash != entry.Hash {
+			return fmt.Errorf("integrity check failed for file: %v", entry.Name)
+		}
+	}
+
+	if !force {
+		for _, entry := range manifest.Files {
+			if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(entry.Name))); err == nil {
+				return fmt.Errorf("file exists: %v, use --force to overwrite", entry.Name)
+			}
+		}
+	}
+
+	for _, entry := range manifest.Files {
+		path := filepath.Join(dir, filepath.FromSlash(entry.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(staging, filepath.FromSlash(entry.Name)), path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validName returns if the name of a file in the archive is a relative path
+// staying within the directory restored to.
+func validName(name string) bool {
+	if name == "" || strings.Contains(name, "\\") || path.IsAbs(name) || path.Clean(name) != name {
+		return false
+	}
+	return filepath.IsLocal(filepath.FromSlash(name))
+}
+
+// restoreFile writes a file from the archive to path, returns it's hash
+func restoreFile(r io.Reader, path string, perm os.FileMode) (string, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h, err := blake2b.New256(nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(io.MultiWriter(file, h), r); err != nil {
+		return "", err
+	}
+	if err := file.Sync(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
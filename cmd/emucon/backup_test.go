@@ -0,0 +1,84 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls/node"
+)
+
+func TestBackupRestore(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"quorum.json":                       `{"keys":[]}`,
+		"peers.json":                        `[]`,
+		"data/default/metrics/00000001.wal": "records",
+		"data/other/state":                  "state",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	// a namespace locked by a node
+	lock, err := node.LockDir(filepath.Join(src, "data", "default"))
+	assert.Nil(t, err)
+	paths := []string{filepath.Join(src, "quorum.json"), filepath.Join(src, "peers.json"), filepath.Join(src, "data")}
+
+	// the node must be stopped
+	var archive bytes.Buffer
+	err = backup(&archive, paths)
+	assert.True(t, errors.Is(err, node.ErrDirLocked))
+	assert.Nil(t, lock.Unlock())
+
+	archive.Reset()
+	assert.Nil(t, backup(&archive, paths))
+	// the namespaces are unlocked after the backup
+	lock, err = node.LockDir(filepath.Join(src, "data", "default"))
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Unlock())
+
+	dst := t.TempDir()
+	assert.Nil(t, restore(bytes.NewReader(archive.Bytes()), dst, false))
+	for name, content := range files {
+		bts, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		assert.Nil(t, err)
+		assert.Equal(t, content, string(bts))
+	}
+	// the lock files are left out
+	_, err = os.Stat(filepath.Join(dst, "data", "default", node.LockName))
+	assert.True(t, os.IsNotExist(err))
+
+	// existing files are kept unless forced
+	assert.NotNil(t, restore(bytes.NewReader(archive.Bytes()), dst, false))
+	assert.Nil(t, restore(bytes.NewReader(archive.Bytes()), dst, true))
+
+	// duplicated names
+	assert.NotNil(t, backup(new(bytes.Buffer), []string{paths[0], paths[0]}))
+}
+
+func TestRestoreInvalidNames(t *testing.T) {
+	for _, name := range []string{"../evil", "data/../../evil", "/evil", "data//evil", "./evil", `data\..\..\evil`, ""} {
+		var archive bytes.Buffer
+		zw := gzip.NewWriter(&archive)
+		tw := tar.NewWriter(zw)
+		assert.Nil(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: 4, Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte("evil"))
+		assert.Nil(t, err)
+		assert.Nil(t, tw.Close())
+		assert.Nil(t, zw.Close())
+
+		parent := t.TempDir()
+		dir := filepath.Join(parent, "dir")
+		assert.Nil(t, os.Mkdir(dir, 0700))
+		assert.NotNil(t, restore(&archive, dir, true), name)
+		_, err = os.Stat(filepath.Join(parent, "evil"))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
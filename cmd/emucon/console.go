@@ -0,0 +1,382 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yonggewang/bdls/agent-tcp"
+)
+
+// consoleCommands are the commands of the console, completed by tab
+var consoleCommands = []string{"status", "peers", "dump", "bans", "ban", "unban", "propose-test", "help", "exit"}
+
+// consoleRoutes are the admin API routes completed for dump
+var consoleRoutes = []string{"/readyz", "/livez", "/stats", "/latency", "/bans", "/features", "/fairness", "/history", "/maintenance"}
+
+// console is an interactive session with the admin API of a live node
+type console struct {
+	client *http.Client
+	root   string // the url of the admin API
+	base   string // the url of the namespace's routes
+	out    io.Writer
+}
+
+// runConsole reads commands from stdin until exit or EOF, with line editing
+// and tab completion if stdin is a terminal. The admin API at root is
+// requested by client.
+func runConsole(client *http.Client, root, namespace string) error {
+	c := &console{client: client, root: root, out: os.Stdout}
+	c.base = c.root
+	if namespace != "" {
+		c.base += "/" + namespace
+	}
+
+	editor := &lineEditor{in: bufio.NewReader(os.Stdin), out: os.Stdout, fd: int(os.Stdin.Fd()), complete: completeCommand}
+	fmt.Fprintln(c.out, "connected to", c.base+`, type "help" for the commands`)
+	for {
+		line, err := editor.readLine("bdls> ")
+		if err == io.EOF {
+			fmt.Fprintln(c.out)
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			return nil
+		}
+		if err := c.exec(args); err != nil {
+			fmt.Fprintln(c.out, "error:", err)
+		}
+	}
+}
+
+// exec runs a command
+func (c *console) exec(args []string) error {
+	switch args[0] {
+	case "help":
+		fmt.Fprint(c.out, `status                     health of the node
+peers                      the connected peers and their traffic
+dump <route>               the json of an admin API route, like /fairness
+bans                       the bans in effect
+ban <host> [duration]      ban a host, for the ban duration by default
+unban <host>               lift the ban of a host
+propose-test [size]        propose random bytes, 1024 by default
+exit                       leave the console
+`)
+		return nil
+	case "status":
+		var health agent.Health
+		// not ready is 503 with the health
+		if err := c.getJSON(c.root+"/readyz", &health, http.StatusServiceUnavailable); err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "live:\t%v\tlast update %v ago\n", health.Live, time.Since(health.LastUpdate).Round(time.Millisecond))
+		fmt.Fprintf(tw, "ready:\t%v\n", health.Ready)
+		fmt.Fprintf(tw, "height:\t%v\tnetwork %v, synced %v\n", health.Height, health.NetworkHeight, health.Synced)
+		fmt.Fprintf(tw, "participants:\t%v\tquorum %v\n", health.Participants, health.Quorum)
+		return tw.Flush()
+	case "peers":
+		var stats agent.Stats
+		if err := c.getJSON(c.base+"/stats", &stats); err != nil {
+			return err
+		}
+		sort.Slice(stats.Peers, func(i, j int) bool { return stats.Peers[i].Address < stats.Peers[j].Address })
+		tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "PEER\tIDENTITY\tSENT\tRECEIVED")
+		for _, p := range stats.Peers {
+			identity := p.Identity
+			if len(identity) > 16 {
+				identity = identity[:16]
+			} else if identity == "" {
+				identity = "-"
+			}
+			fmt.Fprintf(tw, "%v\t%v\t%v msgs, %v bytes\t%v msgs, %v bytes\n", p.Address, identity, p.SentMessages, p.SentBytes, p.ReceivedMessages, p.ReceivedBytes)
+		}
+		return tw.Flush()
+	case "dump":
+		if len(args) != 2 || !strings.HasPrefix(args[1], "/") {
+			return errors.New("usage: dump <route>")
+		}
+		base := c.base
+		if args[1] == "/readyz" || args[1] == "/livez" {
+			base = c.root
+		}
+		var raw json.RawMessage
+		if err := c.getJSON(base+args[1], &raw, http.StatusServiceUnavailable); err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, raw, "", "  "); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, out.String())
+		return nil
+	case "bans":
+		var bans []agent.Ban
+		if err := c.getJSON(c.base+"/bans", &bans); err != nil {
+			return err
+		}
+		c.printBans(bans)
+		return nil
+	case "ban", "unban":
+		if len(args) < 2 || len(args) > 3 || (args[0] == "unban" && len(args) != 2) {
+			return fmt.Errorf("usage: %v <host>", args[0])
+		}
+		query := url.Values{"host": {args[1]}}
+		method := http.MethodDelete
+		if args[0] == "ban" {
+			method = http.MethodPost
+			if len(args) == 3 {
+				query.Set("duration", args[2])
+			}
+		}
+		var bans []agent.Ban
+		if err := c.do(method, c.base+"/bans?"+query.Encode(), nil, &bans); err != nil {
+			return err
+		}
+		c.printBans(bans)
+		return nil
+	case "propose-test":
+		size := 1024
+		if len(args) > 1 {
+			var err error
+			if size, err = strconv.Atoi(args[1]); err != nil || size <= 0 {
+				return errors.New("usage: propose-test [size]")
+			}
+		}
+		state := make([]byte, size)
+		if _, err := io.ReadFull(rand.Reader, state); err != nil {
+			return err
+		}
+		var receipt agent.ProposalReceipt
+		if err := c.do(http.MethodPost, c.base+"/propose", bytes.NewReader(state), &receipt); err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "proposed %v bytes, hash %v\n", receipt.Size, receipt.Hash)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q, type \"help\" for the commands", args[0])
+}
+
+// printBans prints the bans in a table
+func (c *console) printBans(bans []agent.Ban) {
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tIDENTITY\tUNTIL")
+	for _, ban := range bans {
+		identity := ban.Identity
+		if len(identity) > 16 {
+			identity = identity[:16]
+		} else if identity == "" {
+			identity = "-"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\n", ban.Host, identity, ban.Until.Local().Format(time.RFC3339))
+	}
+	tw.Flush()
+}
+
+// getJSON gets the json of a route into v, the statuses other than 200
+// accepted are listed
+func (c *console) getJSON(url string, v interface{}, accepted ...int) error {
+	return c.do(http.MethodGet, url, nil, v, accepted...)
+}
+
+// do sends a request to the admin API, and decodes the json replied into v
+func (c *console) do(method, url string, body io.Reader, v interface{}, accepted ...int) error {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	ok := resp.StatusCode == http.StatusOK
+	for _, status := range accepted {
+		ok = ok || resp.StatusCode == status
+	}
+	if !ok {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%v: %v", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// completeCommand returns the lines completing line, the commands, or the
+// routes of dump
+func completeCommand(line string) []string {
+	var candidates []string
+	if i := strings.IndexByte(line, ' '); i < 0 {
+		for _, cmd := range consoleCommands {
+			if strings.HasPrefix(cmd, line) {
+				candidates = append(candidates, cmd+" ")
+			}
+		}
+	} else if line[:i] == "dump" {
+		arg := strings.TrimLeft(line[i:], " ")
+		for _, route := range consoleRoutes {
+			if strings.HasPrefix(route, arg) {
+				candidates = append(candidates, "dump "+route)
+			}
+		}
+	}
+	return candidates
+}
+
+// lineEditor reads lines from a terminal in raw mode, with backspace, tab
+// completion and history by the arrow keys, or plain lines from others.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	fd       int
+	history  []string
+	complete func(line string) []string
+}
+
+// readLine reads a line after prompt, io.EOF on Ctrl-D or the end of input,
+// the prompt is shown on terminals only
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		// not a terminal, like a script piped in
+		line, err := e.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimSpace(line), err
+	}
+	defer restore()
+	fmt.Fprint(e.out, prompt)
+
+	var line []rune
+	position := len(e.history) // the line of the history shown
+	redraw := func() { fmt.Fprint(e.out, "\r\x1b[K", prompt, string(line)) }
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			if s := strings.TrimSpace(string(line)); s != "" {
+				e.history = append(e.history, s)
+			}
+			return string(line), nil
+		case 3: // Ctrl-C drops the line
+			fmt.Fprint(e.out, "^C\r\n")
+			line = line[:0]
+			redraw()
+		case 4: // Ctrl-D leaves on an empty line
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+		case 21: // Ctrl-U clears the line
+			line = line[:0]
+			redraw()
+		case 8, 127:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				redraw()
+			}
+		case '\t':
+			candidates := e.complete(string(line))
+			if len(candidates) == 0 {
+				continue
+			}
+			if prefix := commonPrefix(candidates); len(prefix) > len(string(line)) {
+				line = []rune(prefix)
+			} else if len(candidates) > 1 {
+				fmt.Fprint(e.out, "\r\n", strings.Join(candidates, "  "), "\r\n")
+			}
+			redraw()
+		case 27: // the arrow keys are ESC [ A/B
+			if b, _ := e.in.ReadByte(); b != '[' {
+				continue
+			}
+			switch b, _ := e.in.ReadByte(); b {
+			case 'A':
+				if position > 0 {
+					position--
+					line = []rune(e.history[position])
+				}
+			case 'B':
+				if position < len(e.history) {
+					position++
+				}
+				line = line[:0]
+				if position < len(e.history) {
+					line = []rune(e.history[position])
+				}
+			}
+			redraw()
+		default:
+			if r >= ' ' {
+				line = append(line, r)
+				fmt.Fprint(e.out, string(r))
+			}
+		}
+	}
+}
+
+// commonPrefix returns the longest common prefix of the strings
+func commonPrefix(strs []string) string {
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
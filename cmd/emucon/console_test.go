@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsoleExec(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		switch r.URL.Path {
+		case "/readyz", "/ns/stats", "/ns/propose":
+			w.Write([]byte("{}"))
+		case "/ns/bans":
+			w.Write([]byte("[]"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		line    string
+		request string // the request sent, none if empty
+		err     string // the error returned, none if empty
+	}{
+		{"help", "", ""},
+		{"status", "GET /readyz", ""},
+		{"peers", "GET /ns/stats", ""},
+		{"dump /readyz", "GET /readyz", ""},
+		{"dump /stats", "GET /ns/stats", ""},
+		{"dump /missing", "GET /ns/missing", "404 Not Found"},
+		{"dump", "", "usage: dump"},
+		{"dump stats", "", "usage: dump"},
+		{"bans", "GET /ns/bans", ""},
+		{"ban 10.0.0.1", "POST /ns/bans?host=10.0.0.1", ""},
+		{"ban 10.0.0.1 1h", "POST /ns/bans?duration=1h&host=10.0.0.1", ""},
+		{"ban", "", "usage: ban"},
+		{"unban 10.0.0.1", "DELETE /ns/bans?host=10.0.0.1", ""},
+		{"unban 10.0.0.1 1h", "", "usage: unban"},
+		{"propose-test 16", "POST /ns/propose", ""},
+		{"propose-test -1", "", "usage: propose-test"},
+		{"propose-test many", "", "usage: propose-test"},
+		{"stats", "", `unknown command "stats"`},
+		{"STATUS", "", `unknown command "STATUS"`},
+	}
+	for _, tt := range tests {
+		requests = nil
+		var out bytes.Buffer
+		c := &console{client: server.Client(), root: server.URL, base: server.URL + "/ns", out: &out}
+		err := c.exec(strings.Fields(tt.line))
+		if tt.err == "" {
+			assert.Nil(t, err, tt.line)
+			assert.NotEmpty(t, out.String(), tt.line)
+		} else if assert.NotNil(t, err, tt.line) {
+			assert.Contains(t, err.Error(), tt.err, tt.line)
+		}
+		if tt.request == "" {
+			assert.Empty(t, requests, tt.line)
+		} else {
+			assert.Equal(t, []string{tt.request}, requests, tt.line)
+		}
+	}
+}
+
+func TestCompleteCommand(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"sta", []string{"status "}},
+		{"ban", []string{"bans ", "ban "}},
+		{"x", nil},
+		{"dump /f", []string{"dump /features", "dump /fairness"}},
+		{"dump  /li", []string{"dump /livez"}},
+		{"peers /", nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, completeCommand(tt.line), tt.line)
+	}
+	assert.Equal(t, "dump /f", commonPrefix([]string{"dump /features", "dump /fairness"}))
+	assert.Equal(t, "status ", commonPrefix([]string{"status "}))
+}
+
+func TestLineEditorNotTerminal(t *testing.T) {
+	var out bytes.Buffer
+	e := &lineEditor{in: bufio.NewReader(strings.NewReader(" status \n\npeers")), out: &out, fd: -1, complete: completeCommand}
+	for _, want := range []string{"status", "", "peers"} {
+		line, err := e.readLine("bdls> ")
+		assert.Nil(t, err)
+		assert.Equal(t, want, line)
+	}
+	_, err := e.readLine("bdls> ")
+	assert.Equal(t, io.EOF, err)
+	// no prompt without a terminal
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,163 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/agent-tcp"
+)
+
+// diagnosis of a single peer
+const (
+	diagOK          = "ok"
+	diagTCPFail     = "tcp fail"
+	diagHandshake   = "handshake timeout"
+	diagAuthFail    = "auth fail"
+	diagNotInQuorum = "not in quorum"
+)
+
+// PeerDiagnostic is the result of probing a peer
+type PeerDiagnostic struct {
+	Address   string
+	Status    string
+	RTT       time.Duration // TCP connect time
+	Handshake time.Duration // time to authenticate the peer
+	Identity  string        // hex prefix of the authenticated identity
+	Detail    string
+}
+
+// doctor dials every peer, runs the authentication handshake and reports
+// per-peer diagnostics, the agent is never started so no consensus message
+// is sent.
+func doctor(config *bdls.Config, peers []string, timeout time.Duration) []PeerDiagnostic {
+	consensus, err := bdls.NewConsensus(config)
+	if err != nil {
+		return []PeerDiagnostic{{Status: diagAuthFail, Detail: err.Error()}}
+	}
+	tagent := agent.NewTCPAgent(consensus, config.PrivateKey)
+	defer tagent.Close()
+	tagent.SetHandshakeTimeout(timeout)
+
+	participants := make(map[bdls.Identity]int)
+	for k, id := range config.Participants {
+		participants[id] = k
+	}
+
+	results := make([]PeerDiagnostic, len(peers))
+	done := make(chan struct{})
+	for k := range peers {
+		go func(d *PeerDiagnostic) {
+			defer func() { done <- struct{}{} }()
+			probe(tagent, d, timeout, participants)
+		}(&results[k])
+		results[k].Address = peers[k]
+	}
+	for range peers {
+		<-done
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Address < results[j].Address })
+	return results
+}
+
+// probe diagnoses a single peer
+func probe(tagent *agent.TCPAgent, d *PeerDiagnostic, timeout time.Duration, participants map[bdls.Identity]int) {
+	// plain TCP connect time as RTT
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", d.Address, timeout)
+	if err != nil {
+		d.Status, d.Detail = diagTCPFail, err.Error()
+		return
+	}
+	d.RTT = time.Since(start)
+	conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start = time.Now()
+	p, err := tagent.Connect(ctx, d.Address, nil)
+	switch {
+	case err == nil:
+	case err == context.DeadlineExceeded || err == agent.ErrHandshakeTimeout:
+		d.Status, d.Detail = diagHandshake, "the peer didn't authenticate, is it a bdls agent?"
+		return
+	case err == agent.ErrPeerAuthenticatedFailed:
+		d.Status, d.Detail = diagAuthFail, "the peer closed the connection or failed to prove it's key"
+		return
+	default:
+		if _, ok := err.(net.Error); ok {
+			d.Status = diagTCPFail
+		} else {
+			d.Status = diagAuthFail
+		}
+		d.Detail = err.Error()
+		return
+	}
+	d.Handshake = time.Since(start)
+	defer p.Close()
+
+	id := bdls.DefaultPubKeyToIdentity(p.GetPublicKey())
+	d.Identity = fmt.Sprintf("%x", id[:8])
+	if k, ok := participants[id]; ok {
+		d.Status, d.Detail = diagOK, fmt.Sprint("participant ", k)
+	} else {
+		d.Status, d.Detail = diagNotInQuorum, "the peer's key is not in the quorum file"
+	}
+}
+
+// printDiagnostics writes the diagnostics as a table
+func printDiagnostics(w io.Writer, results []PeerDiagnostic) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PEER\tSTATUS\tRTT\tHANDSHAKE\tIDENTITY\tDETAIL")
+	for _, d := range results {
+		rtt, handshake := "-", "-"
+		if d.RTT > 0 {
+			rtt = d.RTT.Round(time.Microsecond).String()
+		}
+		if d.Handshake > 0 {
+			handshake = d.Handshake.Round(time.Microsecond).String()
+		}
+		identity := d.Identity
+		if identity == "" {
+			identity = "-"
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\n", d.Address, d.Status, rtt, handshake, identity, d.Detail)
+	}
+	tw.Flush()
+}
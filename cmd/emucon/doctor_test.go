@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/agent-tcp"
+)
+
+// serveAgent accepts connections with an agent of the key, the agent proves
+// it's identity to every peer
+func serveAgent(t *testing.T, config *bdls.Config, key *ecdsa.PrivateKey) net.Listener {
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	server := agent.NewTCPAgent(consensus, key)
+	t.Cleanup(server.Close)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			p := agent.NewTCPPeer(conn, server)
+			server.AddPeer(p)
+			p.InitiatePublicKeyAuthentication()
+		}
+	}()
+	return l
+}
+
+func TestDoctor(t *testing.T) {
+	config := testConfig(t, 4)
+	participant, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	config.Participants[1] = bdls.DefaultPubKeyToIdentity(&participant.PublicKey)
+	outsider, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	ok := serveAgent(t, config, participant)
+	other := serveAgent(t, config, outsider)
+	// a silent listener never authenticates itself
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer silent.Close()
+	// nothing listens on an unreachable peer
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closed.Close()
+
+	want := map[string]string{
+		ok.Addr().String():     diagOK,
+		other.Addr().String():  diagNotInQuorum,
+		silent.Addr().String(): diagHandshake,
+		closed.Addr().String(): diagTCPFail,
+	}
+	var peers []string
+	for addr := range want {
+		peers = append(peers, addr)
+	}
+	results := doctor(config, peers, 500*time.Millisecond)
+	assert.Equal(t, len(want), len(results))
+	for _, d := range results {
+		assert.Equal(t, want[d.Address], d.Status, d.Address)
+		if d.Status == diagOK {
+			assert.Equal(t, "participant 1", d.Detail)
+		}
+	}
+
+	var out bytes.Buffer
+	printDiagnostics(&out, results)
+	assert.Equal(t, len(want)+1, strings.Count(out.String(), "\n"))
+}
+
+func TestDoctorBadConfig(t *testing.T) {
+	config := testConfig(t, 4)
+	config.Participants = config.Participants[:3]
+	results := doctor(config, []string{"127.0.0.1:4680"}, time.Second)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, diagAuthFail, results[0].Status)
+	assert.NotEmpty(t, results[0].Detail)
+}
@@ -32,6 +32,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/hex"
@@ -42,18 +43,35 @@ import (
 	"log"
 	"math/big"
 	"net"
+	"net/http"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/yonggewang/bdls"
 	"github.com/yonggewang/bdls/agent-tcp"
 	"github.com/yonggewang/bdls/crypto/blake2b"
+	"github.com/yonggewang/bdls/internal/identity"
+	"github.com/yonggewang/bdls/discovery"
+	"github.com/yonggewang/bdls/node"
+	"github.com/yonggewang/bdls/transport"
+	"github.com/yonggewang/bdls/wal"
 	"github.com/urfave/cli/v2"
 )
 
+// defaultNamespace is the namespace of the chain instance if not set
+const defaultNamespace = "default"
+
 // A quorum set for consenus
 type Quorum struct {
-	Keys []*big.Int `json:"keys"` // pem formatted keys
+	Keys    []*big.Int `json:"keys"`               // pem formatted keys
+	Weights []uint64   `json:"weights,omitempty"`  // voting power of the keys, optional
+	BLSKeys [][]byte   `json:"bls_keys,omitempty"` // BLS keys to aggregate <commit> signatures, optional
+
+	// threshold key and the shares of the keys, optional
+	ThresholdKey    []byte   `json:"threshold_key,omitempty"`
+	ThresholdShares [][]byte `json:"threshold_shares,omitempty"`
 }
 
 func main() {
@@ -76,18 +94,61 @@ func main() {
 						Value: "./quorum.json",
 						Usage: "output quorum file",
 					},
+					&cli.BoolFlag{
+						Name:  "bls",
+						Usage: "generate BLS keys too, to aggregate the <commit> signatures in <decide>",
+					},
+					&cli.IntFlag{
+						Name:  "threshold",
+						Usage: "generate a threshold key of this threshold too, for a single threshold signature in <decide>",
+					},
+					&cli.StringFlag{
+						Name:  "import",
+						Usage: "import the secp256k1 private keys in hex from this file, one per line, as exported by Bitcoin or Ethereum wallets, instead of generating",
+					},
 				},
 				Action: func(c *cli.Context) error {
-					count := c.Int("count")
-					quorum := &Quorum{}
-					// generate private keys
-					for i := 0; i < count; i++ {
-						privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+					// import or generate private keys
+					var keys []*ecdsa.PrivateKey
+					if path := c.String("import"); path != "" {
+						imported, err := importKeys(path)
 						if err != nil {
 							return err
 						}
+						keys = imported
+					} else {
+						for i := 0; i < c.Int("count"); i++ {
+							privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+							if err != nil {
+								return err
+							}
+							keys = append(keys, privateKey)
+						}
+					}
 
+					quorum := &Quorum{}
+					for i, privateKey := range keys {
 						quorum.Keys = append(quorum.Keys, privateKey.D)
+						log.Println("public key", i, identity.Encode(&privateKey.PublicKey))
+
+						if c.Bool("bls") {
+							blsKey, err := bdls.GenerateBLSKey(rand.Reader)
+							if err != nil {
+								return err
+							}
+							quorum.BLSKeys = append(quorum.BLSKeys, blsKey.Marshal())
+						}
+					}
+
+					if threshold := c.Int("threshold"); threshold > 0 {
+						pk, shares, err := bdls.GenerateThresholdKeys(threshold, len(keys), rand.Reader)
+						if err != nil {
+							return err
+						}
+						quorum.ThresholdKey = pk.Marshal()
+						for _, share := range shares {
+							quorum.ThresholdShares = append(quorum.ThresholdShares, share.Marshal())
+						}
 					}
 
 					file, err := os.Create(c.String("config"))
@@ -102,7 +163,7 @@ func main() {
 					}
 					file.Close()
 
-					log.Println("generate", c.Int("count"), "keys")
+					log.Println("generate", len(keys), "keys")
 					return nil
 				},
 			},
@@ -130,51 +191,381 @@ func main() {
 						Value: "./peers.json",
 						Usage: "all peers's ip:port list to connect, as a json array",
 					},
+					&cli.StringSliceFlag{
+						Name:  "seeds",
+						Usage: "DNS seeds to discover more peers from, TXT or SRV(_service._tcp.domain) records",
+					},
+					&cli.BoolFlag{
+						Name:  "mdns",
+						Usage: "advertise and discover participants on the LAN with mDNS",
+					},
+					&cli.BoolFlag{
+						Name:  "mux",
+						Usage: "multiplex the consensus, state sync and admin streams over one connection to each peer, all nodes must enable it",
+					},
+					&cli.BoolFlag{
+						Name:  "flood",
+						Usage: "relay the consensus messages received to the other peers, for networks which are not a full mesh",
+					},
+					&cli.BoolFlag{
+						Name:  "padding",
+						Usage: "pad the encrypted frames to power of two sizes, and send cover traffic, so observers can't infer the progress of rounds",
+					},
+					&cli.BoolFlag{
+						Name:  "shed",
+						Usage: "shed the traffic of standby nodes, unauthenticated peers and state sync progressively under overload, to keep voting",
+					},
+					&cli.IntFlag{
+						Name:  "max-conns",
+						Usage: "the max of inbound connections, the most misbehaving or the oldest unauthenticated one is evicted for a new one, 0 for no limit",
+					},
+					&cli.StringFlag{
+						Name:  "address-book",
+						Usage: "keep the peers dialed and the bans in this file, to reconnect and keep the bans after a restart",
+					},
+					&cli.IntFlag{
+						Name:  "max-frame-size",
+						Value: agent.MaxMessageLength,
+						Usage: "the max size of the frames sent to and received from peers, the larger ones are dropped, all nodes should share it",
+					},
+					&cli.BoolFlag{
+						Name:  "beacon",
+						Usage: "attach VRF proofs to the commits for a verifiable randomness at each height, all nodes must enable it",
+					},
+					&cli.BoolFlag{
+						Name:  "nat",
+						Usage: "dial peers from the listening port, so the node behind NAT can be reached by hole punching",
+					},
+					&cli.BoolFlag{
+						Name:  "upnp",
+						Usage: "request a mapping of the listening port from the gateway by UPnP or NAT-PMP",
+					},
+					&cli.StringFlag{
+						Name:  "socks5",
+						Usage: "dial peers through a SOCKS5 proxy, as socks5://[user:password@]host:port",
+					},
+					&cli.StringFlag{
+						Name:  "tor-control",
+						Usage: "publish the listener as an onion service through the Tor control port, like 127.0.0.1:9051",
+					},
+					&cli.StringFlag{
+						Name:  "tor-password",
+						Usage: "the password of the Tor control port",
+					},
+					&cli.StringSliceFlag{
+						Name:  "allow",
+						Usage: "only accept peers from these IPs or CIDRs, like 10.0.0.0/8",
+					},
+					&cli.StringSliceFlag{
+						Name:  "deny",
+						Usage: "reject peers from these IPs or CIDRs",
+					},
+					&cli.StringFlag{
+						Name:  "admin",
+						Usage: "serve the admin API on this address, like 127.0.0.1:4690",
+					},
+					&cli.StringFlag{
+						Name:  "control",
+						Usage: "serve the admin API to the operators over an encrypted control channel on this address, like :4691",
+					},
+					&cli.StringSliceFlag{
+						Name:  "operator",
+						Usage: "the public keys of the operators allowed on the control channel, in hex",
+					},
+					&cli.StringFlag{
+						Name:  "namespace",
+						Usage: "run the chain instance in this namespace of --data, the admin API is served under /<namespace>/",
+					},
+					&cli.StringFlag{
+						Name:  "data",
+						Value: "./data",
+						Usage: "the directory of the namespaces",
+					},
+					&cli.IntFlag{
+						Name:  "max-peers",
+						Usage: "the max peers of the namespace, 0 is unlimited",
+					},
+					&cli.StringFlag{
+						Name:  "user",
+						Usage: "run as this user after binding the listener and loading the keys",
+					},
+					&cli.StringSliceFlag{
+						Name:  "feature-gate",
+						Usage: "activate these features only after a quorum of participants support them, like compression",
+					},
+					&cli.DurationFlag{
+						Name:  "grace",
+						Value: node.DefaultGracePeriod,
+						Usage: "the time to stop the admin API, the proposer and the peers on SIGINT or SIGTERM",
+					},
+					&cli.BoolFlag{
+						Name:  "wait-for-sync",
+						Usage: "serve the admin API routes other than the probes, and propose, only once synced and connected to a quorum",
+					},
+					&cli.UintFlag{
+						Name:  "max-sync-lag",
+						Value: agent.DefaultMaxSyncLag,
+						Usage: "the max heights behind the network to be ready",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-selfcheck",
+						Usage: "start without checking keys, clock, disk, config and peers",
+					},
+					&cli.StringFlag{
+						Name:  "signer",
+						Usage: "sign the consensus messages by the remote signer on this unix socket, see the signer command",
+					},
+					&cli.StringFlag{
+						Name:  "transport",
+						Value: "./transport.json",
+						Usage: "the transport key written by the signer command, to authenticate to peers with --signer",
+					},
 				},
 				Action: func(c *cli.Context) error {
-					// open quorum config
-					file, err := os.Open(c.String("config"))
+					config, err := loadConfig(c.String("config"), c.Int("id"))
 					if err != nil {
 						return err
 					}
-					defer file.Close()
+					log.Println("identity:", c.Int("id"))
 
-					quorum := new(Quorum)
-					err = json.NewDecoder(file).Decode(quorum)
+					if err := startConsensus(c, config); err != nil {
+						return err
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "signer",
+				Usage: "hold the key of a participant and sign it's consensus messages for \"run --signer\", refusing conflicting votes",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "id",
+						Value: 0,
+						Usage: "the node id, will use the n-th private key in quorum.json",
+					},
+					&cli.StringFlag{
+						Name:  "config",
+						Value: "./quorum.json",
+						Usage: "the shared quorum config file",
+					},
+					&cli.StringFlag{
+						Name:  "socket",
+						Value: "./signer.sock",
+						Usage: "the unix socket to serve on",
+					},
+					&cli.StringFlag{
+						Name:  "watermark",
+						Value: "./watermark.json",
+						Usage: "the file of the latest height and round signed, it must be kept with the key",
+					},
+					&cli.StringFlag{
+						Name:  "transport",
+						Value: "./transport.json",
+						Usage: "write a transport key linked to the key to this file, for \"run --signer\" to authenticate to peers",
+					},
+					&cli.DurationFlag{
+						Name:  "transport-validity",
+						Value: 30 * 24 * time.Hour,
+						Usage: "the validity of the transport key, restart the signer and the node to renew it",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					config, err := loadConfig(c.String("config"), c.Int("id"))
+					if err != nil {
+						return err
+					}
+
+					if err := writeTransport(c.String("transport"), config.PrivateKey, c.Duration("transport-validity")); err != nil {
+						return err
+					}
+					l, err := listenSigner(c.String("socket"))
+					if err != nil {
+						return err
+					}
+					defer l.Close()
+					log.Println("signing for identity", c.Int("id"), "on:", c.String("socket"))
+					return serveSigner(l, config.PrivateKey, c.String("watermark"))
+				},
+			},
+			{
+				Name:  "doctor",
+				Usage: "dial and authenticate all peers, and report per-peer diagnostics",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "id",
+						Value: 0,
+						Usage: "the node id, will use the n-th private key in quorum.json",
+					},
+					&cli.StringFlag{
+						Name:  "config",
+						Value: "./quorum.json",
+						Usage: "the shared quorum config file",
+					},
+					&cli.StringFlag{
+						Name:  "peers",
+						Value: "./peers.json",
+						Usage: "all peers's ip:port list to connect, as a json array",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Value: 5 * time.Second,
+						Usage: "timeout to connect and authenticate each peer",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					config, err := loadConfig(c.String("config"), c.Int("id"))
 					if err != nil {
 						return err
 					}
 
-					id := c.Int("id")
-					if id >= len(quorum.Keys) {
-						return errors.New(fmt.Sprint("cannot locate private key for id:", id))
+					peers, err := loadPeers(c.String("peers"))
+					if err != nil {
+						return err
 					}
-					log.Println("identity:", id)
-
-					// create configuration
-					config := new(bdls.Config)
-					config.Epoch = time.Now()
-					config.CurrentHeight = 0
-					config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
-					config.StateValidate = func(bdls.State) bool { return true }
-
-					for k := range quorum.Keys {
-						priv := new(ecdsa.PrivateKey)
-						priv.PublicKey.Curve = bdls.S256Curve
-						priv.D = quorum.Keys[k]
-						priv.PublicKey.X, priv.PublicKey.Y = bdls.S256Curve.ScalarBaseMult(priv.D.Bytes())
-						// myself
-						if id == k {
-							config.PrivateKey = priv
+
+					results := doctor(config, peers, c.Duration("timeout"))
+					printDiagnostics(os.Stdout, results)
+					for _, d := range results {
+						if d.Status != diagOK {
+							return errors.New("some peers are unhealthy")
 						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "console",
+				Usage: "an interactive console to the admin API of a live node",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "admin",
+						Value: "127.0.0.1:4690",
+						Usage: "the address of the admin API",
+					},
+					&cli.StringFlag{
+						Name:  "namespace",
+						Usage: "the namespace of the chain instance, if the node runs with --namespace",
+					},
+					&cli.StringFlag{
+						Name:  "control",
+						Usage: "connect to the control channel of the node on this address instead of the admin API",
+					},
+					&cli.StringFlag{
+						Name:  "key",
+						Value: "./operator.json",
+						Usage: "the key file of the operator for the control channel, as written by genkeys",
+					},
+					&cli.StringFlag{
+						Name:  "node",
+						Usage: "the public key of the node for the control channel, in hex",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					control := c.String("control")
+					if control == "" {
+						return runConsole(&http.Client{Timeout: 10 * time.Second}, "http://"+c.String("admin"), c.String("namespace"))
+					}
 
-						// set validator sequence
-						config.Participants = append(config.Participants, bdls.DefaultPubKeyToIdentity(&priv.PublicKey))
+					config, err := loadConfig(c.String("key"), 0)
+					if err != nil {
+						return err
+					}
+					nodeKey, err := identity.Decode(c.String("node"))
+					if err != nil {
+						return fmt.Errorf("node: %w", err)
+					}
+					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					defer cancel()
+					cc, err := agent.DialControl(ctx, control, config.PrivateKey, nodeKey)
+					if err != nil {
+						return err
+					}
+					defer cc.Close()
+					return runConsole(&http.Client{Transport: cc, Timeout: 10 * time.Second}, "http://"+control, c.String("namespace"))
+				},
+			},
+			{
+				Name:      "backup",
+				Usage:     "archive the quorum and peers files, and the namespaces with their WALs, with an integrity manifest",
+				ArgsUsage: "[files or directories...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Value: "./backup.tar.gz",
+						Usage: "output archive, \"-\" for stdout to stream to other storages",
+					},
+					&cli.StringFlag{
+						Name:  "data",
+						Value: "./data",
+						Usage: "the directory of the namespaces, it's locked during the backup",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					files := c.Args().Slice()
+					if len(files) == 0 {
+						files = []string{"./quorum.json", "./peers.json"}
+						if _, err := os.Stat(c.String("data")); err == nil {
+							files = append(files, c.String("data"))
+						}
 					}
 
-					if err := startConsensus(c, config); err != nil {
+					if c.String("output") == "-" {
+						return backup(os.Stdout, files)
+					}
+
+					file, err := os.OpenFile(c.String("output"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+					if err != nil {
+						return err
+					}
+					defer file.Close()
+
+					if err := backup(file, files); err != nil {
+						os.Remove(c.String("output"))
+						return err
+					}
+					if err := file.Sync(); err != nil {
+						return err
+					}
+
+					log.Println("backup", len(files), "files to", c.String("output"))
+					return nil
+				},
+			},
+			{
+				Name:  "restore",
+				Usage: "verify and extract an archive created by backup",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "input",
+						Value: "./backup.tar.gz",
+						Usage: "input archive, \"-\" for stdin to stream from other storages",
+					},
+					&cli.StringFlag{
+						Name:  "dir",
+						Value: ".",
+						Usage: "the directory to restore to",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "overwrite existing files",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					var r io.Reader = os.Stdin
+					if c.String("input") != "-" {
+						file, err := os.Open(c.String("input"))
+						if err != nil {
+							return err
+						}
+						defer file.Close()
+						r = file
+					}
+
+					if err := restore(r, c.String("dir"), c.Bool("force")); err != nil {
 						return err
 					}
+
+					log.Println("restored to", c.String("dir"))
 					return nil
 				},
 			},
@@ -193,9 +584,150 @@ func main() {
 
 }
 
+// loadConfig creates the consensus config for the id-th participant in
+// the quorum file
+func loadConfig(path string, id int) (*bdls.Config, error) {
+	// open quorum config
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	quorum := new(Quorum)
+	err = json.NewDecoder(file).Decode(quorum)
+	if err != nil {
+		return nil, err
+	}
+
+	if id >= len(quorum.Keys) {
+		return nil, errors.New(fmt.Sprint("cannot locate private key for id:", id))
+	}
+
+	// create configuration
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.CurrentHeight = 0
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(bdls.State) bool { return true }
+
+	for k := range quorum.Keys {
+		priv := new(ecdsa.PrivateKey)
+		priv.PublicKey.Curve = bdls.S256Curve
+		priv.D = quorum.Keys[k]
+		priv.PublicKey.X, priv.PublicKey.Y = bdls.S256Curve.ScalarBaseMult(priv.D.Bytes())
+		// myself
+		if id == k {
+			config.PrivateKey = priv
+		}
+
+		// set validator sequence
+		config.Participants = append(config.Participants, bdls.DefaultPubKeyToIdentity(&priv.PublicKey))
+	}
+	config.Weights = quorum.Weights
+
+	// the BLS & threshold signatures are experimental, they're enabled by
+	// generating the keys with --bls or --threshold
+	config.ExperimentalBN256 = len(quorum.BLSKeys) > 0 || quorum.ThresholdKey != nil
+
+	// aggregate <commit> signatures with the BLS keys
+	for k := range quorum.BLSKeys {
+		blsKey, err := bdls.UnmarshalBLSPrivateKey(quorum.BLSKeys[k])
+		if err != nil {
+			return nil, err
+		}
+		if id == k {
+			config.BLSKey = blsKey
+		}
+		config.BLSPublicKeys = append(config.BLSPublicKeys, blsKey.PublicKey())
+	}
+
+	// combine partial signatures with the threshold key
+	if quorum.ThresholdKey != nil {
+		config.ThresholdPublicKey, err = bdls.UnmarshalThresholdPublicKey(quorum.ThresholdKey)
+		if err != nil {
+			return nil, err
+		}
+		if id < len(quorum.ThresholdShares) {
+			config.ThresholdKey, err = bdls.UnmarshalThresholdKeyShare(quorum.ThresholdShares[id])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return config, nil
+}
+
+// importKeys loads the secp256k1 private keys in hex, one per line, with
+// an optional 0x prefix
+func importKeys(path string) ([]*ecdsa.PrivateKey, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*ecdsa.PrivateKey
+	for _, line := range strings.Split(string(bts), "\n") {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "0x")
+		if line == "" {
+			continue
+		}
+		raw, err := hex.DecodeString(line)
+		if err != nil {
+			return nil, bdls.ErrPrivateKey
+		}
+		key, err := bdls.ParseSecp256k1PrivateKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// loadPeers loads the peers file as a json array of ip:port
+func loadPeers(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var peers []string
+	err = json.NewDecoder(file).Decode(&peers)
+	if err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
 // consensus for one round with full procedure
 func startConsensus(c *cli.Context, config *bdls.Config) error {
-	// create consensus
+	// create consensus, profiled for the admin API
+	if c.String("admin") != "" || c.String("control") != "" {
+		config.Profiler = bdls.NewProfiler()
+	}
+	config.EnableBeacon = c.Bool("beacon")
+
+	// the messages are signed by the remote signer of the participant's key,
+	// the key is dropped, the peers are authenticated by the transport key
+	// linked to it instead
+	nodeKey, validatorKey := config.PrivateKey, &config.PrivateKey.PublicKey
+	var linkage *agent.KeyLinkage
+	if socket := c.String("signer"); socket != "" {
+		signer, cc, err := dialSigner(socket, config.Participants[c.Int("id")])
+		if err != nil {
+			return err
+		}
+		defer cc.Close()
+		if nodeKey, linkage, err = loadTransport(c.String("transport")); err != nil {
+			return err
+		}
+		config.PrivateKey = nil
+		config.Signer = signer
+		config.Verifier = bdls.ECDSAVerifier{Curve: bdls.S256Curve}
+		log.Println("signing by the remote signer on:", socket)
+	}
 	consensus, err := bdls.NewConsensus(config)
 	if err != nil {
 		return err
@@ -203,16 +735,45 @@ func startConsensus(c *cli.Context, config *bdls.Config) error {
 	consensus.SetLatency(200 * time.Millisecond)
 
 	// load endpoints
-	file, err := os.Open(c.String("peers"))
+	peers, err := loadPeers(c.String("peers"))
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	var peers []string
-	err = json.NewDecoder(file).Decode(&peers)
-	if err != nil {
-		return err
+	// discover peers from DNS seeds
+	if seeds := c.StringSlice("seeds"); len(seeds) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		addrs, err := discovery.NewDNSSeed(seeds...).Resolve(ctx)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		known := make(map[string]bool)
+		for _, addr := range peers {
+			known[addr] = true
+		}
+		for _, addr := range addrs {
+			if !known[addr] {
+				log.Println("discovered peer:", addr)
+				peers = append(peers, addr)
+			}
+		}
+	}
+
+	// outbound connections through a proxy if set
+	var dialer transport.Transport = new(transport.TCP)
+	if proxy := c.String("socks5"); proxy != "" {
+		if dialer, err = transport.ParseSOCKS5(proxy); err != nil {
+			return err
+		}
+	}
+
+	// fail fast on misconfigurations
+	if !c.Bool("skip-selfcheck") {
+		if err := selfCheck(config, c.String("config"), peers, c.String("listen")); err != nil {
+			return err
+		}
 	}
 
 	// start listener
@@ -221,22 +782,202 @@ func startConsensus(c *cli.Context, config *bdls.Config) error {
 		return err
 	}
 
-	l, err := net.ListenTCP("tcp", tcpaddr)
-	if err != nil {
+	var l net.Listener
+	if control := c.String("tor-control"); control != "" {
+		tor := &transport.Tor{Control: control, ControlPassword: c.String("tor-password")}
+		if l, err = tor.Listen(tcpaddr.String()); err != nil {
+			return err
+		}
+		log.Println("onion service published at:", l.Addr())
+	} else if c.Bool("nat") {
+		// the outbound connections share the mapping of the listener
+		if l, err = (&transport.TCP{ReusePort: true}).Listen(tcpaddr.String()); err != nil {
+			return err
+		}
+		if c.String("socks5") == "" {
+			dialer = &transport.TCP{ReusePort: true, Dialer: net.Dialer{LocalAddr: &net.TCPAddr{Port: l.Addr().(*net.TCPAddr).Port}}}
+		}
+	} else if l, err = net.ListenTCP("tcp", tcpaddr); err != nil {
 		return err
 	}
 	defer l.Close()
 	log.Println("listening on:", c.String("listen"))
 
+	// the network facing process runs unprivileged from now on, the keys
+	// are loaded already
+	if username := c.String("user"); username != "" {
+		if err := node.DropPrivileges(username); err != nil {
+			return err
+		}
+		log.Println("running as:", username)
+	}
+
 	// initiate tcp agent
-	tagent := agent.NewTCPAgent(consensus, config.PrivateKey)
+	tagent := agent.NewTCPAgent(consensus, nodeKey, agent.WithMaxFrameSize(c.Int("max-frame-size")))
+	if linkage != nil {
+		if err := tagent.SetKeyLinkage(linkage); err != nil {
+			return err
+		}
+	}
+	tagent.SetKeepalive(agent.DefaultKeepaliveInterval, agent.DefaultKeepaliveMisses)
+	tagent.SetBanPolicy(agent.DefaultBanThreshold, agent.DefaultBanDuration)
+	tagent.SetHealthPolicy(uint64(c.Uint("max-sync-lag")), agent.DefaultMaxStall)
+	tagent.SetMux(c.Bool("mux"))
+	tagent.SetFlood(c.Bool("flood"))
+	if c.Bool("padding") {
+		tagent.SetPadding(true, agent.DefaultCoverInterval)
+	}
+	if c.Bool("shed") {
+		tagent.SetLoadShedder(agent.DefaultLoadShedder(), agent.DefaultShedInterval)
+	}
+	if max := c.Int("max-conns"); max > 0 {
+		tagent.SetMaxConnections(max, agent.EvictLowestScore)
+	}
+	if path := c.String("address-book"); path != "" {
+		if err := tagent.SetAddressBook(path, agent.DefaultAddressMaxAge); err != nil {
+			return err
+		}
+	}
+	if c.Bool("nat") {
+		tagent.SetPunchPort(l.Addr().(*net.TCPAddr).Port)
+	}
+
+	// reachable behind a home router without forwarding the port manually,
+	// the node runs without the mapping if there is no gateway to map it
+	if c.Bool("upnp") {
+		port := l.Addr().(*net.TCPAddr).Port
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		mapper, err := agent.DiscoverPortMapper(ctx)
+		if err == nil {
+			tagent.SetPortMapper(mapper)
+			err = tagent.MapPort(ctx, port)
+			defer mapper.Close()
+		}
+		cancel()
+		if err != nil {
+			log.Println("port mapping:", err)
+		} else {
+			log.Println("port mapped to:", tagent.MappedAddrs())
+		}
+	}
+	for _, feature := range c.StringSlice("feature-gate") {
+		tagent.SetFeatureGate(agent.Feature(feature), true)
+	}
+
+	// isolate the chain instance in it's namespace, the peers are filtered
+	// by the namespace
+	nsConfig := &node.Config{
+		Name:          c.String("namespace"),
+		AllowNetworks: c.StringSlice("allow"),
+		DenyNetworks:  c.StringSlice("deny"),
+		Quota:         node.Quota{MaxPeers: c.Int("max-peers")},
+	}
+	if nsConfig.Name == "" {
+		nsConfig.Name = defaultNamespace
+	}
+	host := node.NewHost(c.String("data"))
+	ns, err := host.Add(nsConfig)
+	if err != nil {
+		return err
+	}
+	if err := ns.Attach(tagent); err != nil {
+		return err
+	}
+
+	// the metrics of the decided heights are kept in the namespace, so the
+	// history survives restarts
+	metrics, err := ns.OpenWAL("metrics", wal.Config{}, tagent.RestoreMetrics)
 	if err != nil {
 		return err
 	}
+	tagent.SetMetricsStore(metrics)
 
 	// start updater
 	tagent.Update()
 
+	// on SIGINT or SIGTERM, stop proposing and announce leaving so the
+	// rounds led by this node won't wait for it's proposal, then flush &
+	// close the peers, the namespace is closed last.
+	shutdown := node.NewShutdown(c.Duration("grace"))
+	stopping := make(chan struct{})
+	stopped := make(chan struct{})
+	shutdown.Register(node.StageConsensus, "proposer", func(ctx context.Context) error {
+		close(stopping)
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		tagent.Leave(time.Second)
+		return nil
+	})
+	shutdown.Register(node.StageTransport, "agent", func(ctx context.Context) error {
+		l.Close()
+		return tagent.Shutdown(ctx)
+	})
+	shutdown.Register(node.StageStorage, "namespaces", func(ctx context.Context) error { return host.Close() })
+	defer shutdown.HandleSignals()()
+
+	// admin API
+	admin, control := c.String("admin"), c.String("control")
+	if admin != "" || control != "" {
+		defer tagent.ReportLatency(5 * time.Second)()
+		ns.Handle("/latency", tagent.LatencyHandler())
+		ns.Handle("/propose", tagent.ProposeHandler(0))
+		ns.Handle("/decisions", tagent.DecisionsHandler())
+		ns.Handle("/maintenance", tagent.MaintenanceHandler())
+		ns.Handle("/stats", tagent.StatsHandler())
+		ns.Handle("/bans", tagent.BansHandler())
+		ns.Handle("/features", tagent.FeaturesHandler())
+		ns.Handle("/fairness", tagent.FairnessHandler())
+		ns.Handle("/history", tagent.MetricsHistoryHandler())
+		ns.Handle("/nat", tagent.NATHandler())
+		ns.Handle("/load", tagent.LoadHandler())
+		ns.Handle("/beacon", tagent.BeaconHandler())
+		ns.Handle("/peers/events", tagent.PeerEventsHandler())
+		// routes are prefixed only if the namespace is set explicitly
+		var handler http.Handler = ns
+		if c.String("namespace") != "" {
+			handler = host
+		}
+		// the probes are served at the root for orchestrators, even while
+		// the other routes wait for sync
+		if c.Bool("wait-for-sync") {
+			handler = syncGate(tagent, handler)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/livez", tagent.LivenessHandler())
+		mux.Handle("/readyz", tagent.ReadinessHandler())
+		mux.Handle("/", handler)
+		if admin != "" {
+			server := &http.Server{Addr: admin, Handler: mux}
+			shutdown.Register(node.StageRPC, "admin API", server.Shutdown)
+			go func() { log.Println("admin API:", server.ListenAndServe()) }()
+		}
+
+		// the operators reach the same routes over the encrypted control
+		// channel, authenticated by their keys
+		if control != "" {
+			var operators []*ecdsa.PublicKey
+			for _, text := range c.StringSlice("operator") {
+				key, err := identity.Decode(text)
+				if err != nil {
+					return fmt.Errorf("operator %v: %w", text, err)
+				}
+				operators = append(operators, key)
+			}
+			tagent.SetOperators(operators...)
+
+			cl, err := net.Listen("tcp", control)
+			if err != nil {
+				return err
+			}
+			shutdown.Register(node.StageRPC, "control channel", func(ctx context.Context) error { return cl.Close() })
+			log.Println("control channel on:", cl.Addr(), "node key:", identity.Encode(&nodeKey.PublicKey))
+			go func() { log.Println("control channel:", tagent.ServeControl(cl, mux)) }()
+		}
+	}
+
 	// passive connection from peers
 	go func() {
 		for {
@@ -245,31 +986,94 @@ func startConsensus(c *cli.Context, config *bdls.Config) error {
 				return
 			}
 			log.Println("peer connected from:", conn.RemoteAddr())
-			// peer endpoint created
-			p := agent.NewTCPPeer(conn, tagent)
-			tagent.AddPeer(p)
-			// prove my identity to this peer
-			p.InitiatePublicKeyAuthentication()
+			// peer endpoint created, the session of a multiplexed one is
+			// awaited in the background
+			go func() {
+				p, err := tagent.NewPeer(conn, false)
+				if err != nil {
+					log.Println(conn.RemoteAddr(), err)
+					return
+				}
+				if !ns.AddPeer(p) {
+					p.Close()
+					return
+				}
+				// prove my identity to this peer
+				p.InitiatePublicKeyAuthentication()
+			}()
 		}
 	}()
 
 	// active connections to peers
-	for k := range peers {
-		go func(raddr string) {
-			for {
-				conn, err := net.Dial("tcp", raddr)
-				if err == nil {
-					log.Println("connected to peer:", conn.RemoteAddr())
-					// peer endpoint created
-					p := agent.NewTCPPeer(conn, tagent)
-					tagent.AddPeer(p)
-					// prove my identity to this peer
-					p.InitiatePublicKeyAuthentication()
+	connect := func(raddr string) {
+		for {
+			conn, err := dialer.Dial(context.Background(), raddr)
+			if err == nil {
+				log.Println("connected to peer:", conn.RemoteAddr())
+				// peer endpoint created
+				p, err := tagent.NewPeer(conn, true)
+				if err != nil {
+					log.Println(raddr, err)
+					<-time.After(time.Second)
+					continue
+				}
+				if !ns.AddPeer(p) {
+					p.Close()
 					return
 				}
-				<-time.After(time.Second)
+				// prove my identity to this peer
+				p.InitiatePublicKeyAuthentication()
+				return
 			}
-		}(peers[k])
+			<-time.After(time.Second)
+		}
+	}
+	for k := range peers {
+		go connect(peers[k])
+	}
+
+	// discover participants on the LAN
+	if c.Bool("mdns") {
+		responder, err := discovery.AdvertiseMDNS(validatorKey, l.Addr().(*net.TCPAddr).Port)
+		if err != nil {
+			return err
+		}
+		defer responder.Close()
+
+		participants := make(map[bdls.Identity]bool)
+		for _, id := range config.Participants {
+			participants[id] = true
+		}
+		// myself
+		delete(participants, bdls.DefaultPubKeyToIdentity(validatorKey))
+
+		go discovery.BrowseMDNS(context.Background(), func(peer *discovery.MDNSPeer) {
+			id := bdls.DefaultPubKeyToIdentity(peer.PublicKey)
+			if participants[id] {
+				// connect once to each participant
+				delete(participants, id)
+				log.Println("discovered participant on LAN:", peer.Addrs[0])
+				go connect(peer.Addrs[0])
+			}
+		})
+	}
+
+	// hold proposing until synced
+	if c.Bool("wait-for-sync") {
+		log.Println("waiting for sync")
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-stopping
+			cancel()
+		}()
+		err := tagent.WaitReady(ctx)
+		cancel()
+		if err != nil {
+			close(stopped)
+			<-shutdown.Done()
+			return shutdown.Err()
+		}
+		log.Println("synced")
 	}
 
 	lastHeight := uint64(0)
@@ -278,18 +1082,46 @@ NEXTHEIGHT:
 	for {
 		data := make([]byte, 1024)
 		io.ReadFull(rand.Reader, data)
-		tagent.Propose(data)
+		if err := tagent.Propose(data); err != nil {
+			log.Println("propose:", err)
+		}
 
 		for {
 			newHeight, newRound, newState := tagent.GetLatestState()
 			if newHeight > lastHeight {
 				h := blake2b.Sum256(newState)
 				log.Printf("<decide> at height:%v round:%v hash:%v", newHeight, newRound, hex.EncodeToString(h[:]))
+				if config.EnableBeacon {
+					if beacon, err := tagent.CurrentBeacon(); err == nil {
+						log.Printf("<beacon> at height:%v randomness:%v", beacon.Height, hex.EncodeToString(beacon.Randomness[:]))
+					}
+				}
 				lastHeight = newHeight
 				continue NEXTHEIGHT
 			}
-			// wait
-			<-time.After(20 * time.Millisecond)
+			// wait, or stop on shutdown
+			select {
+			case <-time.After(20 * time.Millisecond):
+			case <-stopping:
+				close(stopped)
+				<-shutdown.Done()
+				return shutdown.Err()
+			}
 		}
 	}
 }
+
+// syncGate serves 503 until the agent is ready once, then the handler.
+func syncGate(tagent *agent.TCPAgent, handler http.Handler) http.Handler {
+	var synced int32
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&synced) == 0 {
+			if !tagent.Ready() {
+				http.Error(w, "waiting for sync", http.StatusServiceUnavailable)
+				return
+			}
+			atomic.StoreInt32(&synced, 1)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
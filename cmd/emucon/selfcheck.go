@@ -0,0 +1,278 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yonggewang/bdls"
+)
+
+const (
+	// minimum free disk space in the working directory
+	selfCheckMinFreeDisk = 64 << 20
+	// timeout for dialing each peer
+	selfCheckDialTimeout = 3 * time.Second
+)
+
+// selfCheckClockFloor is the earliest wall clock time considered sane, a
+// clock before this is typically an unset RTC on a fresh machine.
+var selfCheckClockFloor = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ErrSelfCheck is returned when any check of the self-check fails
+var ErrSelfCheck = errors.New("self-check failed, fix the errors above or run with --skip-selfcheck")
+
+// checkStatus is the status of a single check
+type checkStatus int
+
+const (
+	checkOK checkStatus = iota
+	checkWarn
+	checkFail
+)
+
+func (s checkStatus) String() string {
+	switch s {
+	case checkOK:
+		return " OK "
+	case checkWarn:
+		return "WARN"
+	default:
+		return "FAIL"
+	}
+}
+
+// checkResult is the outcome of a single check, with a hint to fix it
+type checkResult struct {
+	Name   string
+	Status checkStatus
+	Detail string
+	Hint   string
+}
+
+// selfCheck validates the local environment before the agent starts,
+// so misconfigurations are reported instead of stalling at height 1.
+func selfCheck(config *bdls.Config, configPath string, peers []string, listen string) error {
+	var results []checkResult
+	results = append(results, checkKeys(config, configPath)...)
+	results = append(results, checkClock(time.Now()))
+	results = append(results, checkDisk("."))
+	results = append(results, checkConsistency(config, peers, listen)...)
+	results = append(results, checkPeers(peers, listen)...)
+
+	failed := false
+	for _, r := range results {
+		log.Printf("self-check [%v] %v: %v", r.Status, r.Name, r.Detail)
+		if r.Status != checkOK && r.Hint != "" {
+			log.Printf("self-check        hint: %v", r.Hint)
+		}
+		if r.Status == checkFail {
+			failed = true
+		}
+	}
+
+	if failed {
+		return ErrSelfCheck
+	}
+	return nil
+}
+
+// checkKeys checks the quorum file and the private key of this node
+func checkKeys(config *bdls.Config, configPath string) (results []checkResult) {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		results = append(results, checkResult{"keystore", checkFail, err.Error(), "run `emucon genkeys` or pass --config"})
+		return
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		results = append(results, checkResult{"keystore", checkWarn,
+			fmt.Sprintf("%v is accessible by other users (%v)", configPath, info.Mode().Perm()),
+			fmt.Sprintf("chmod 600 %v", configPath)})
+	} else {
+		results = append(results, checkResult{"keystore", checkOK, configPath, ""})
+	}
+
+	// the key may be held by a remote signer
+	var identity bdls.Identity
+	if config.Signer != nil {
+		identity = bdls.DefaultPubKeyToIdentity(signerPublicKey(config.Signer))
+	} else {
+		priv := config.PrivateKey
+		if priv == nil || priv.D.Sign() <= 0 || priv.D.Cmp(bdls.S256Curve.Params().N) >= 0 {
+			results = append(results, checkResult{"private key", checkFail, "the private key is out of range", "regenerate the quorum with `emucon genkeys`"})
+			return
+		}
+		identity = bdls.DefaultPubKeyToIdentity(&priv.PublicKey)
+	}
+	seen := make(map[bdls.Identity]bool)
+	found := false
+	for _, p := range config.Participants {
+		if seen[p] {
+			results = append(results, checkResult{"private key", checkFail, "duplicated participant keys in quorum", "regenerate the quorum with `emucon genkeys`"})
+			return
+		}
+		seen[p] = true
+		found = found || p == identity
+	}
+	if !found {
+		results = append(results, checkResult{"private key", checkFail, "the private key is not a participant", "check --id against the quorum"})
+		return
+	}
+	results = append(results, checkResult{"private key", checkOK, fmt.Sprintf("participant %x", identity[:8]), ""})
+	return
+}
+
+// checkClock checks the wall clock is plausible, consensus timeouts and
+// the epoch are derived from it.
+func checkClock(now time.Time) checkResult {
+	if now.Before(selfCheckClockFloor) {
+		return checkResult{"clock", checkFail, fmt.Sprint("wall clock is ", now.UTC()), "synchronize the system clock with NTP"}
+	}
+	return checkResult{"clock", checkOK, now.UTC().Format(time.RFC3339), ""}
+}
+
+// checkDisk checks the free space in dir
+func checkDisk(dir string) checkResult {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return checkResult{"disk", checkWarn, err.Error(), ""}
+	}
+
+	free, err := diskFree(abs)
+	if err != nil {
+		return checkResult{"disk", checkWarn, fmt.Sprint("cannot determine free space: ", err), ""}
+	}
+	if free < selfCheckMinFreeDisk {
+		return checkResult{"disk", checkFail,
+			fmt.Sprintf("%v MB free in %v", free>>20, abs),
+			fmt.Sprintf("free at least %v MB", selfCheckMinFreeDisk>>20)}
+	}
+	return checkResult{"disk", checkOK, fmt.Sprintf("%v MB free in %v", free>>20, abs), ""}
+}
+
+// checkConsistency checks the consensus config against the quorum and
+// the peer list
+func checkConsistency(config *bdls.Config, peers []string, listen string) (results []checkResult) {
+	if err := bdls.VerifyConfig(config); err != nil {
+		results = append(results, checkResult{"config", checkFail, err.Error(),
+			fmt.Sprintf("the quorum needs at least %v participants", bdls.ConfigMinimumParticipants)})
+		return
+	}
+
+	if _, _, err := net.SplitHostPort(listen); err != nil {
+		results = append(results, checkResult{"config", checkFail, fmt.Sprint("listen address: ", err), "pass --listen as host:port"})
+		return
+	}
+
+	// a node can reach consensus with 2t+1 participants including itself
+	t := (len(config.Participants) - 1) / 3
+	if len(peers) < 2*t {
+		results = append(results, checkResult{"config", checkFail,
+			fmt.Sprintf("%v peers configured, %v participants need at least %v", len(peers), len(config.Participants), 2*t),
+			"add the other participants' addresses to the peers file"})
+		return
+	}
+	results = append(results, checkResult{"config", checkOK,
+		fmt.Sprintf("%v participants, %v peers, tolerates %v faulty", len(config.Participants), len(peers), t), ""})
+	return
+}
+
+// checkPeers dials the configured peers. Unreachable peers are only
+// warnings, as other participants may not have started yet.
+func checkPeers(peers []string, listen string) (results []checkResult) {
+	type dialResult struct {
+		addr string
+		rtt  time.Duration
+		err  error
+	}
+
+	ch := make(chan dialResult, len(peers))
+	for _, addr := range peers {
+		go func(addr string) {
+			start := time.Now()
+			conn, err := net.DialTimeout("tcp", addr, selfCheckDialTimeout)
+			if err == nil {
+				conn.Close()
+			}
+			ch <- dialResult{addr, time.Since(start), err}
+		}(addr)
+	}
+
+	for range peers {
+		r := <-ch
+		name := fmt.Sprint("peer ", r.addr)
+		switch {
+		case isSelf(r.addr, listen):
+			results = append(results, checkResult{name, checkOK, "self", ""})
+		case r.err != nil:
+			results = append(results, checkResult{name, checkWarn, r.err.Error(), "check the peer is running and the port is open"})
+		default:
+			results = append(results, checkResult{name, checkOK, fmt.Sprint("reachable in ", r.rtt), ""})
+		}
+	}
+	return
+}
+
+// isSelf tells whether addr is the local listening address
+func isSelf(addr string, listen string) bool {
+	_, lport, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || port != lport {
+		return false
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return false
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() {
+			return true
+		}
+		if ifaddrs, err := net.InterfaceAddrs(); err == nil {
+			for _, a := range ifaddrs {
+				if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
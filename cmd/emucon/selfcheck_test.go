@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+// testConfig returns a config of n participants, the first one is this node
+func testConfig(t *testing.T, n int) *bdls.Config {
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return 0 }
+	config.StateValidate = func(a bdls.State) bool { return true }
+	for i := 0; i < n; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		if i == 0 {
+			config.PrivateKey = key
+		}
+		config.Participants = append(config.Participants, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+	return config
+}
+
+// statuses returns the statuses of the results
+func statuses(results []checkResult) (out []checkStatus) {
+	for _, r := range results {
+		out = append(out, r.Status)
+	}
+	return out
+}
+
+func TestCheckKeys(t *testing.T) {
+	dir := t.TempDir()
+	private := filepath.Join(dir, "private.json")
+	assert.Nil(t, os.WriteFile(private, []byte("{}"), 0600))
+	shared := filepath.Join(dir, "shared.json")
+	assert.Nil(t, os.WriteFile(shared, []byte("{}"), 0644))
+
+	tests := []struct {
+		name   string
+		path   string
+		config func(*bdls.Config)
+		want   []checkStatus
+	}{
+		{"ok", private, func(*bdls.Config) {}, []checkStatus{checkOK, checkOK}},
+		{"missing keystore", filepath.Join(dir, "missing.json"), func(*bdls.Config) {}, []checkStatus{checkFail}},
+		{"keystore accessible by others", shared, func(*bdls.Config) {}, []checkStatus{checkWarn, checkOK}},
+		{"no private key", private, func(c *bdls.Config) { c.PrivateKey = nil }, []checkStatus{checkOK, checkFail}},
+		{"not a participant", private, func(c *bdls.Config) { c.Participants = c.Participants[1:] }, []checkStatus{checkOK, checkFail}},
+		{"duplicated participants", private, func(c *bdls.Config) { c.Participants = append(c.Participants, c.Participants[1]) }, []checkStatus{checkOK, checkFail}},
+	}
+	for _, tt := range tests {
+		config := testConfig(t, 4)
+		tt.config(config)
+		assert.Equal(t, tt.want, statuses(checkKeys(config, tt.path)), tt.name)
+	}
+}
+
+func TestCheckClock(t *testing.T) {
+	assert.Equal(t, checkOK, checkClock(time.Now()).Status)
+	assert.Equal(t, checkFail, checkClock(time.Unix(0, 0)).Status)
+}
+
+func TestCheckConsistency(t *testing.T) {
+	peers := []string{"127.0.0.1:4681", "127.0.0.1:4682", "127.0.0.1:4683"}
+	tests := []struct {
+		name   string
+		n      int
+		peers  []string
+		listen string
+		want   checkStatus
+	}{
+		{"ok", 4, peers, ":4680", checkOK},
+		{"too few participants", 3, peers, ":4680", checkFail},
+		{"bad listen address", 4, peers, "4680", checkFail},
+		{"too few peers", 4, peers[:1], ":4680", checkFail},
+	}
+	for _, tt := range tests {
+		results := checkConsistency(testConfig(t, tt.n), tt.peers, tt.listen)
+		assert.Equal(t, []checkStatus{tt.want}, statuses(results), tt.name)
+	}
+}
+
+func TestCheckPeers(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	closed.Close()
+
+	tests := []struct {
+		name   string
+		addr   string
+		listen string
+		want   checkStatus
+	}{
+		{"reachable", l.Addr().String(), ":0", checkOK},
+		{"unreachable", closed.Addr().String(), ":0", checkWarn},
+		{"self", closed.Addr().String(), closed.Addr().String(), checkOK},
+	}
+	for _, tt := range tests {
+		results := checkPeers([]string{tt.addr}, tt.listen)
+		assert.Equal(t, []checkStatus{tt.want}, statuses(results), tt.name)
+	}
+	assert.True(t, isSelf("localhost:4680", ":4680"))
+	assert.False(t, isSelf("localhost:4681", ":4680"))
+	assert.False(t, isSelf("192.0.2.1:4680", ":4680"))
+}
@@ -0,0 +1,168 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/agent-tcp"
+	grpcsigner "github.com/yonggewang/bdls/signer-grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// signerDialTimeout is the time to reach the remote signer on start
+const signerDialTimeout = 10 * time.Second
+
+// transportFile is the transport key of the network facing process, and
+// the statement linking it to the validator key held by the signer
+type transportFile struct {
+	Key     *big.Int          `json:"key"`
+	Linkage *agent.KeyLinkage `json:"linkage"`
+}
+
+// errSignerKey indicates the remote signer holds another key than the node's
+var errSignerKey = errors.New("the remote signer holds another key than the participant's")
+
+// listenSigner listens on the unix socket of the remote signer, the socket
+// is accessible by the user only, a stale socket is replaced.
+func listenSigner(socket string) (net.Listener, error) {
+	if info, err := os.Lstat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(socket); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// serveSigner signs the messages of the private key on the listener until
+// it's closed, with the watermark persisted at the path.
+func serveSigner(l net.Listener, privateKey *ecdsa.PrivateKey, watermark string) error {
+	server, err := grpcsigner.NewServer(bdls.NewECDSASigner(privateKey), watermark)
+	if err != nil {
+		return err
+	}
+	gs := grpc.NewServer()
+	server.Register(gs)
+	return gs.Serve(l)
+}
+
+// dialSigner connects to the remote signer on the unix socket, it must hold
+// the key of the identity.
+func dialSigner(socket string, id bdls.Identity) (*grpcsigner.Client, *grpc.ClientConn, error) {
+	path, err := filepath.Abs(socket)
+	if err != nil {
+		return nil, nil, err
+	}
+	cc, err := grpc.NewClient("unix://"+path, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), signerDialTimeout)
+	defer cancel()
+	client, err := grpcsigner.NewClient(ctx, cc, 0)
+	if err != nil {
+		cc.Close()
+		return nil, nil, err
+	}
+	if bdls.DefaultPubKeyToIdentity(signerPublicKey(client)) != id {
+		cc.Close()
+		return nil, nil, errSignerKey
+	}
+	return client, cc, nil
+}
+
+// signerPublicKey returns the public key of the signer
+func signerPublicKey(signer bdls.Signer) *ecdsa.PublicKey {
+	X, Y := signer.PublicKey()
+	return &ecdsa.PublicKey{Curve: bdls.S256Curve, X: new(big.Int).SetBytes(X[:]), Y: new(big.Int).SetBytes(Y[:])}
+}
+
+// writeTransport generates a transport key for the network facing process,
+// linked to the validator key for the validity, to the file at path, which
+// is accessible by the user only.
+func writeTransport(path string, validatorKey *ecdsa.PrivateKey, validity time.Duration) error {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	if err != nil {
+		return err
+	}
+	// a later statement supersedes the earlier ones
+	now := time.Now()
+	linkage, err := agent.NewKeyLinkage(validatorKey, &key.PublicKey, uint64(now.Unix()), now, now.Add(validity))
+	if err != nil {
+		return err
+	}
+	bts, err := json.Marshal(&transportFile{Key: key.D, Linkage: linkage})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bts, 0600)
+}
+
+// loadTransport loads the transport key and it's linkage written by
+// writeTransport
+func loadTransport(path string) (*ecdsa.PrivateKey, *agent.KeyLinkage, error) {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	transport := new(transportFile)
+	if err := json.Unmarshal(bts, transport); err != nil {
+		return nil, nil, err
+	}
+	if transport.Key == nil || transport.Key.Sign() <= 0 || transport.Key.Cmp(bdls.S256Curve.Params().N) >= 0 {
+		return nil, nil, bdls.ErrPrivateKey
+	}
+	key := new(ecdsa.PrivateKey)
+	key.PublicKey.Curve = bdls.S256Curve
+	key.D = transport.Key
+	key.PublicKey.X, key.PublicKey.Y = bdls.S256Curve.ScalarBaseMult(key.D.Bytes())
+	return key, transport.Linkage, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/agent-tcp"
+)
+
+func TestRemoteSigner(t *testing.T) {
+	// the socket path is limited in length
+	dir, err := os.MkdirTemp("", "signer")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "signer.sock")
+
+	config := testConfig(t, 4)
+	l, err := listenSigner(socket)
+	assert.Nil(t, err)
+	defer l.Close()
+	info, err := os.Stat(socket)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	go serveSigner(l, config.PrivateKey, filepath.Join(dir, "watermark.json"))
+
+	signer, cc, err := dialSigner(socket, config.Participants[0])
+	assert.Nil(t, err)
+	defer cc.Close()
+	// the key is held by the signer only
+	config.Signer = signer
+	config.PrivateKey = nil
+	assert.Equal(t, []checkStatus{checkOK, checkOK}, statuses(checkKeys(config, socket)))
+	sp := new(bdls.SignedProto)
+	assert.Nil(t, sp.SignWith(&bdls.Message{Type: bdls.MessageType_Commit, Height: 1, State: []byte("a")}, signer))
+	assert.True(t, sp.Verify(bdls.S256Curve))
+	// the watermark is persisted
+	_, err = os.Stat(filepath.Join(dir, "watermark.json"))
+	assert.Nil(t, err)
+
+	// the signer must hold the participant's key
+	_, _, err = dialSigner(socket, config.Participants[1])
+	assert.Equal(t, errSignerKey, err)
+}
+
+func TestTransport(t *testing.T) {
+	config := testConfig(t, 4)
+	path := filepath.Join(t.TempDir(), "transport.json")
+	assert.Nil(t, writeTransport(path, config.PrivateKey, time.Hour))
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// the transport key is linked to the validator key
+	key, linkage, err := loadTransport(path)
+	assert.Nil(t, err)
+	assert.NotEqual(t, config.PrivateKey.D, key.D)
+	validatorKey, err := agent.VerifyKeyLinkage(linkage, &key.PublicKey, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, config.Participants[0], bdls.DefaultPubKeyToIdentity(validatorKey))
+	_, err = agent.VerifyKeyLinkage(linkage, &key.PublicKey, time.Now().Add(2*time.Hour))
+	assert.Equal(t, agent.ErrKeyLinkageExpired, err)
+
+	assert.Nil(t, os.WriteFile(path, []byte(`{"key":0}`), 0600))
+	_, _, err = loadTransport(path)
+	assert.Equal(t, bdls.ErrPrivateKey, err)
+}
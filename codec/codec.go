@@ -0,0 +1,169 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package codec
+
+import (
+	"encoding/json"
+	"sync"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/yonggewang/bdls"
+)
+
+const (
+	// maxNameLength is the max length of codec names, as they're prefixed
+	// to payloads by a byte of length
+	maxNameLength = 255
+)
+
+// Codec serializes application payloads.
+type Codec interface {
+	// Name identifies the codec in the payloads, it must be stable across
+	// versions and nodes.
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[string]Codec)
+)
+
+var (
+	// JSON encodes values with encoding/json
+	JSON Codec = jsonCodec{}
+	// Proto encodes protobuf messages
+	Proto Codec = protoCodec{}
+)
+
+func init() {
+	Register(JSON)
+	Register(Proto)
+}
+
+// Register makes a codec available to Decode by it's name, it fails if the
+// name is invalid or has been registered.
+func Register(c Codec) error {
+	name := c.Name()
+	if name == "" || len(name) > maxNameLength {
+		return ErrCodecName
+	}
+
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, ok := codecs[name]; ok {
+		return ErrCodecRegistered
+	}
+	codecs[name] = c
+	return nil
+}
+
+// Lookup returns the codec registered with name.
+func Lookup(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// Encode marshals v with c into a state tagged with the codec's name, as
+// |name length|name|payload|, to propose. c doesn't have to be registered
+// to encode.
+func Encode(c Codec, v interface{}) (bdls.State, error) {
+	name := c.Name()
+	if name == "" || len(name) > maxNameLength {
+		return nil, ErrCodecName
+	}
+
+	payload, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	s := make(bdls.State, 0, 1+len(name)+len(payload))
+	s = append(s, byte(len(name)))
+	s = append(s, name...)
+	s = append(s, payload...)
+	return s, nil
+}
+
+// Decode unmarshals a state encoded by Encode into v, with the registered
+// codec it's tagged with.
+func Decode(s bdls.State, v interface{}) error {
+	name, payload, err := Split(s)
+	if err != nil {
+		return err
+	}
+
+	c, ok := Lookup(name)
+	if !ok {
+		return ErrUnknownCodec
+	}
+	return c.Unmarshal(payload, v)
+}
+
+// Split returns the codec name and the payload of a state encoded by Encode.
+func Split(s bdls.State) (name string, payload []byte, err error) {
+	if len(s) < 1 || s[0] == 0 || len(s) < 1+int(s[0]) {
+		return "", nil, ErrPayload
+	}
+	n := int(s[0])
+	return string(s[1 : 1+n]), s[1+n:], nil
+}
+
+// jsonCodec encodes values with encoding/json
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                               { return "json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// protoCodec encodes protobuf messages
+type protoCodec struct{}
+
+func (protoCodec) Name() string { return "proto" }
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProto
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProto
+	}
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,103 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+// rawCodec passes bytes through, as a custom codec
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return "raw" }
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return append([]byte(nil), v.([]byte)...), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), data...)
+	return nil
+}
+
+func TestJSON(t *testing.T) {
+	type transfer struct {
+		From, To string
+		Amount   uint64
+	}
+
+	s, err := Encode(JSON, &transfer{"alice", "bob", 42})
+	assert.Nil(t, err)
+	name, payload, err := Split(s)
+	assert.Nil(t, err)
+	assert.Equal(t, "json", name)
+	assert.Equal(t, `{"From":"alice","To":"bob","Amount":42}`, string(payload))
+
+	var v transfer
+	assert.Nil(t, Decode(s, &v))
+	assert.Equal(t, transfer{"alice", "bob", 42}, v)
+}
+
+func TestProto(t *testing.T) {
+	m := &bdls.Message{Type: bdls.MessageType_Commit, Height: 7, State: []byte("state")}
+	s, err := Encode(Proto, m)
+	assert.Nil(t, err)
+
+	v := new(bdls.Message)
+	assert.Nil(t, Decode(s, v))
+	assert.Equal(t, m.Height, v.Height)
+	assert.Equal(t, m.State, v.State)
+
+	_, err = Encode(Proto, "not a message")
+	assert.Equal(t, ErrNotProto, err)
+	var str string
+	assert.Equal(t, ErrNotProto, Decode(s, &str))
+}
+
+func TestRegister(t *testing.T) {
+	// encoded without being registered, but not decodable
+	s, err := Encode(rawCodec{}, []byte("payload"))
+	assert.Nil(t, err)
+	var v []byte
+	assert.Equal(t, ErrUnknownCodec, Decode(s, &v))
+
+	assert.Nil(t, Register(rawCodec{}))
+	assert.Equal(t, ErrCodecRegistered, Register(rawCodec{}))
+	assert.Nil(t, Decode(s, &v))
+	assert.Equal(t, []byte("payload"), v)
+
+	c, ok := Lookup("raw")
+	assert.True(t, ok)
+	assert.Equal(t, rawCodec{}, c)
+	_, ok = Lookup("cbor")
+	assert.False(t, ok)
+}
+
+func TestSplit(t *testing.T) {
+	for _, s := range []bdls.State{nil, {0}, {5, 'j', 's'}} {
+		_, _, err := Split(s)
+		assert.Equal(t, ErrPayload, err, s)
+	}
+
+	name, payload, err := Split(bdls.State{3, 'r', 'a', 'w'})
+	assert.Nil(t, err)
+	assert.Equal(t, "raw", name)
+	assert.Equal(t, 0, len(payload))
+}
+
+func TestCodecName(t *testing.T) {
+	_, err := Encode(namedCodec(""), nil)
+	assert.Equal(t, ErrCodecName, err)
+	_, err = Encode(namedCodec(bytes.Repeat([]byte{'x'}, 256)), nil)
+	assert.Equal(t, ErrCodecName, err)
+	assert.Equal(t, ErrCodecName, Register(namedCodec("")))
+}
+
+// namedCodec is a JSON codec with any name
+type namedCodec string
+
+func (c namedCodec) Name() string                               { return string(c) }
+func (c namedCodec) Marshal(v interface{}) ([]byte, error)      { return JSON.Marshal(v) }
+func (c namedCodec) Unmarshal(data []byte, v interface{}) error { return JSON.Unmarshal(data, v) }
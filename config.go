@@ -32,6 +32,8 @@ package bdls
 
 import (
 	"crypto/ecdsa"
+	"math"
+	"math/bits"
 	"time"
 )
 
@@ -48,8 +50,21 @@ type Config struct {
 	CurrentHeight uint64
 	// PrivateKey
 	PrivateKey *ecdsa.PrivateKey
+	// Signer signs the messages instead of PrivateKey, for the other
+	// signature schemes like Ed25519Signer, or keys held out of memory
+	// (optional).
+	Signer Signer
+	// Verifier verifies the signatures of the participants, it must be of
+	// the scheme of Signer (optional). Default to the Signer if it's a
+	// Verifier, or ECDSA on the curve of PrivateKey.
+	Verifier Verifier
 	// Consensus Group
 	Participants []Identity
+	// Weights is the voting power of Participants[k], so the quorums are
+	// reached by 2/3 of the total weight instead of the number of
+	// participants, for validators of unequal stakes (optional). All
+	// participants weigh 1 if empty.
+	Weights []uint64
 	// EnableCommitUnicast sets to true to enable <commit> message to be delivered via unicast
 	// if not(by default), <commit> message will be broadcasted
 	EnableCommitUnicast bool
@@ -73,6 +88,58 @@ type Config struct {
 	// Identity derviation from ecdsa.PublicKey
 	// (optional). Default to DefaultPubKeyToIdentity
 	PubKeyToIdentity func(pubkey *ecdsa.PublicKey) (ret Identity)
+
+	// AdmissionPolicy will be consulted while proposing states, and again
+	// before proposing in <roundchange> (optional).
+	AdmissionPolicy AdmissionPolicy
+
+	// Profiler times the verification, state transitions and marshalling
+	// (optional).
+	Profiler *Profiler
+
+	// VerifyWorkers is the number of goroutines verifying the signatures in
+	// VerifyMessages (optional). Default to runtime.GOMAXPROCS(0).
+	VerifyWorkers int
+
+	// EnableBeacon sets to true to attach VRF proofs to <commit> messages,
+	// and require them in the <commit> proofs of <decide> messages, for the
+	// randomness beacon of each height, see Beacon. All participants must
+	// enable it, and the keys must be on secp256k1 in PrivateKey.
+	EnableBeacon bool
+
+	// ExperimentalBN256 enables the BLS & threshold signatures of BLSKey,
+	// BLSPublicKeys, ThresholdKey and ThresholdPublicKey, which are built on
+	// the deprecated golang.org/x/crypto/bn256 of about 100 bits of security.
+	// They're experimental until moved to a maintained BLS12-381 library,
+	// and can't be set without it.
+	ExperimentalBN256 bool
+
+	// BLSKey signs the <commit> messages with BLS too, so the leader can
+	// aggregate the signatures into a single one in <decide>, instead of the
+	// <commit> proofs (optional). BLSPublicKeys must be set.
+	BLSKey *BLSPrivateKey
+
+	// BLSPublicKeys is the BLS public key of Participants[k], setting them
+	// requires aggregated BLS signatures in <decide> messages (optional). All
+	// participants must set them, and the keys must have been checked by
+	// BLSPublicKey.VerifyPossession. It can't be enabled with EnableBeacon,
+	// as the beacon is derived from the <commit> proofs.
+	BLSPublicKeys []*BLSPublicKey
+
+	// ThresholdKey is the share of this participant of ThresholdPublicKey,
+	// it signs the <commit> messages, so the leader can combine the partial
+	// signatures into a single threshold signature in <decide> (optional).
+	// The share of Participants[k] must be of index k+1.
+	ThresholdKey *ThresholdKeyShare
+
+	// ThresholdPublicKey is the threshold key shared by the participants,
+	// setting it requires a threshold signature in <decide> messages, which
+	// is verified by the group key only (optional). It's generated by
+	// GenerateThresholdKeys, or by the participants with ThresholdDealing,
+	// or imported from an external DKG by UnmarshalThresholdPublicKey. The
+	// threshold must be at least 2t+1 of the participants, and it can't be
+	// set with Weights, BLSPublicKeys or EnableBeacon.
+	ThresholdPublicKey *ThresholdPublicKey
 }
 
 // VerifyConfig verifies the integrity of this config when creating new consensus object
@@ -89,13 +156,83 @@ func VerifyConfig(c *Config) error {
 		return ErrConfigStateValidate
 	}
 
-	if c.PrivateKey == nil {
+	if c.PrivateKey == nil && c.Signer == nil {
 		return ErrConfigPrivateKey
 	}
 
+	if c.Signer != nil && c.Verifier == nil {
+		if _, ok := c.Signer.(Verifier); !ok {
+			return ErrConfigVerifier
+		}
+	}
+
 	if len(c.Participants) < ConfigMinimumParticipants {
 		return ErrConfigParticipants
 	}
 
+	if len(c.Weights) > 0 {
+		if len(c.Weights) != len(c.Participants) {
+			return ErrConfigWeights
+		}
+		// the total weight, and the quorum of 2t+1 of it, must not
+		// overflow
+		var total, carry uint64
+		for _, w := range c.Weights {
+			if w == 0 {
+				return ErrConfigWeights
+			}
+			if total, carry = bits.Add64(total, w, 0); carry != 0 {
+				return ErrConfigWeights
+			}
+		}
+		if 2*((total-1)/3)+1 > math.MaxInt {
+			return ErrConfigWeights
+		}
+	}
+
+	if !c.ExperimentalBN256 && (c.BLSKey != nil || len(c.BLSPublicKeys) > 0 || c.ThresholdKey != nil || c.ThresholdPublicKey != nil) {
+		return ErrConfigExperimental
+	}
+
+	if c.BLSKey != nil && len(c.BLSPublicKeys) == 0 {
+		return ErrConfigBLSPublicKeys
+	}
+
+	if len(c.BLSPublicKeys) > 0 {
+		if len(c.BLSPublicKeys) != len(c.Participants) {
+			return ErrConfigBLSPublicKeys
+		}
+		for _, pk := range c.BLSPublicKeys {
+			if pk == nil {
+				return ErrConfigBLSPublicKeys
+			}
+		}
+		if c.EnableBeacon {
+			return ErrConfigBLSBeacon
+		}
+	}
+
+	if c.ThresholdKey != nil && c.ThresholdPublicKey == nil {
+		return ErrConfigThreshold
+	}
+
+	if pk := c.ThresholdPublicKey; pk != nil {
+		ids := make(map[Identity]bool)
+		for _, id := range c.Participants {
+			ids[id] = true
+		}
+		t := (len(ids) - 1) / 3
+		if len(pk.shares) != len(c.Participants) || pk.Threshold < 2*t+1 || pk.Threshold > len(ids) {
+			return ErrConfigThreshold
+		}
+		if len(c.Weights) > 0 || len(c.BLSPublicKeys) > 0 || c.EnableBeacon {
+			return ErrConfigThresholdMode
+		}
+	}
+
+	if c.EnableBeacon && (c.PrivateKey == nil || c.PrivateKey.Curve != S256Curve) {
+		return ErrVRFCurve
+	}
+
 	return nil
 }
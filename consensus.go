@@ -86,6 +86,7 @@ type messageTuple struct {
 	StateHash StateHash    // computed while adding
 	Message   *Message     // the decoded message
 	Signed    *SignedProto // the encoded message with signature
+	Weight    uint64       // the weight of the signer, computed while adding
 }
 
 // a sorter for messageTuple slice
@@ -118,10 +119,11 @@ type consensusRound struct {
 	roundChanges []messageTuple // stores <roundchange> message tuples of this round
 	commits      []messageTuple // stores <commit> message tuples of this round
 
-	// track current max proposed state in <roundchange>,  we don't have to compute this for
-	// a non-leader participant, or if there're no more than 2t+1 messages for leader.
-	MaxProposedState State
-	MaxProposedCount int
+	// track current max proposed state in <roundchange> and the weight of it's proposers,
+	// we don't have to compute this for a non-leader participant, or if there're no more
+	// than 2t+1 messages for leader.
+	MaxProposedState  State
+	MaxProposedWeight uint64
 }
 
 // newConsensusRound creates a new round, and sets the round number
@@ -142,7 +144,7 @@ func (r *consensusRound) AddRoundChange(sp *SignedProto, m *Message) bool {
 		}
 	}
 
-	r.roundChanges = append(r.roundChanges, messageTuple{StateHash: r.c.stateHash(m.State), Message: m, Signed: sp})
+	r.roundChanges = append(r.roundChanges, messageTuple{StateHash: r.c.stateHash(m.State), Message: m, Signed: sp, Weight: r.c.signerWeight(sp)})
 	return true
 }
 
@@ -169,6 +171,15 @@ func (r *consensusRound) RemoveRoundChange(idx int) {
 // NumRoundChanges returns count of <roundchange> messages.
 func (r *consensusRound) NumRoundChanges() int { return len(r.roundChanges) }
 
+// RoundChangeWeight returns the weight of the signers of <roundchange> messages.
+func (r *consensusRound) RoundChangeWeight() uint64 {
+	var weight uint64
+	for k := range r.roundChanges {
+		weight += r.roundChanges[k].Weight
+	}
+	return weight
+}
+
 // SignedRoundChanges converts and returns []*SignedProto(as slice)
 func (r *consensusRound) SignedRoundChanges() []*SignedProto {
 	proof := make([]*SignedProto, 0, len(r.roundChanges))
@@ -197,19 +208,20 @@ func (r *consensusRound) AddCommit(sp *SignedProto, m *Message) bool {
 			return false
 		}
 	}
-	r.commits = append(r.commits, messageTuple{StateHash: r.c.stateHash(m.State), Message: m, Signed: sp})
+	r.commits = append(r.commits, messageTuple{StateHash: r.c.stateHash(m.State), Message: m, Signed: sp, Weight: r.c.signerWeight(sp)})
 	return true
 }
 
-// NumCommitted counts <commit> messages which points to what the leader has locked.
-func (r *consensusRound) NumCommitted() int {
-	var count int
+// CommittedWeight sums the weight of the signers of <commit> messages which points
+// to what the leader has locked.
+func (r *consensusRound) CommittedWeight() uint64 {
+	var weight uint64
 	for k := range r.commits {
 		if r.commits[k].StateHash == r.LockedStateHash {
-			count++
+			weight += r.commits[k].Weight
 		}
 	}
-	return count
+	return weight
 }
 
 // SignedCommits converts and returns []*SignedProto
@@ -221,8 +233,9 @@ func (r *consensusRound) SignedCommits() []*SignedProto {
 	return proof
 }
 
-// GetMaxProposed finds the most agreed-on non-nil state, if these is any.
-func (r *consensusRound) GetMaxProposed() (s State, count int) {
+// GetMaxProposed finds the most agreed-on non-nil state by the weight of it's
+// proposers, if these is any.
+func (r *consensusRound) GetMaxProposed() (s State, weight uint64) {
 	if len(r.roundChanges) == 0 {
 		return nil, 0
 	}
@@ -238,32 +251,32 @@ func (r *consensusRound) GetMaxProposed() (s State, count int) {
 	}
 	sort.Sort(&sorter)
 
-	// find the maximum occurred hash
+	// find the maximum weighted hash
 	// O(n)
-	maxCount := 1
+	maxWeight := r.roundChanges[0].Weight
 	maxState := r.roundChanges[0]
-	curCount := 1
+	curWeight := r.roundChanges[0].Weight
 
 	n := len(r.roundChanges)
 	for i := 1; i < n; i++ {
 		if r.roundChanges[i].StateHash == r.roundChanges[i-1].StateHash {
-			curCount++
+			curWeight += r.roundChanges[i].Weight
 		} else {
-			if curCount > maxCount {
-				maxCount = curCount
+			if curWeight > maxWeight {
+				maxWeight = curWeight
 				maxState = r.roundChanges[i-1]
 			}
-			curCount = 1
+			curWeight = r.roundChanges[i].Weight
 		}
 	}
 
-	// if the last hash is the maximum occurred
-	if curCount > maxCount {
-		maxCount = curCount
+	// if the last hash is the maximum weighted
+	if curWeight > maxWeight {
+		maxWeight = curWeight
 		maxState = r.roundChanges[n-1]
 	}
 
-	return maxState.Message.State, maxCount
+	return maxState.Message.State, maxWeight
 }
 
 // Consensus implements a deterministic BDLS consensus protocol.
@@ -302,14 +315,26 @@ type Consensus struct {
 	messageOutCallback func(m *Message, sp *SignedProto)
 	// public key to identity function
 	pubKeyToIdentity func(pubkey *ecdsa.PublicKey) Identity
+	// admission policy for unconfirmed states
+	admissionPolicy AdmissionPolicy
+	// (optional) profiler of the hot path
+	profiler *Profiler
 
 	// the StateHash function to identify a state
 	stateHash func(State) StateHash
 
-	// private key
+	// private key, nil if signed by a Signer from config
 	privateKey *ecdsa.PrivateKey
-	// my publickey coodinate
-	identity Identity
+	// signer & verifier of messages
+	signer   Signer
+	verifier Verifier
+	// the signatures verified by VerifyMessages, and the number of workers
+	// to verify them
+	preverified   map[string]bool
+	verifyWorkers int
+	// my publickey, and it's coodinate
+	publicKey *ecdsa.PublicKey
+	identity  Identity
 	// curve retrieved from private key
 	curve elliptic.Curve
 
@@ -325,9 +350,27 @@ type Consensus struct {
 	// count num of individual identities
 	numIdentities int
 
+	// (optional) the weights of the participants, and the total weight of
+	// the individual identities, which is numIdentities if not weighted
+	weights     map[Identity]uint64
+	totalWeight uint64
+
 	// set to true to enable <commit> message unicast
 	enableCommitUnicast bool
 
+	// set to true to attach & require VRF proofs of the beacon in <commit>
+	enableBeacon bool
+
+	// (optional) the BLS key to sign <commit>, and the BLS public keys of
+	// the participants, which requires aggregated signatures in <decide>
+	blsKey        *BLSPrivateKey
+	blsPublicKeys map[Identity]*BLSPublicKey
+
+	// (optional) the share of this participant of the threshold key, which
+	// requires threshold signatures in <decide>
+	thresholdKey       *ThresholdKeyShare
+	thresholdPublicKey *ThresholdPublicKey
+
 	// NOTE: fixed leader for testing purpose
 	fixedLeader *Identity
 
@@ -336,6 +379,13 @@ type Consensus struct {
 
 	// the last message which caused round change
 	lastRoundChangeProof []*SignedProto
+
+	// messages accepted by ReceiveAuthenticatedMessage without verifying
+	// their signatures, which must be verified before being used as proofs
+	unverified map[*SignedProto]bool
+
+	// participants announced leaving at current height
+	goneLeaders map[Identity]bool
 }
 
 // NewConsensus creates a BDLS consensus object to participant in consensus procedure,
@@ -365,6 +415,13 @@ func (c *Consensus) init(config *Config) {
 	c.privateKey = config.PrivateKey
 	c.pubKeyToIdentity = config.PubKeyToIdentity
 	c.enableCommitUnicast = config.EnableCommitUnicast
+	c.enableBeacon = config.EnableBeacon
+	c.blsKey = config.BLSKey
+	c.thresholdKey = config.ThresholdKey
+	c.thresholdPublicKey = config.ThresholdPublicKey
+	c.admissionPolicy = config.AdmissionPolicy
+	c.profiler = config.Profiler
+	c.verifyWorkers = config.VerifyWorkers
 
 	// if config has not set hash function, use the default
 	if c.stateHash == nil {
@@ -374,11 +431,29 @@ func (c *Consensus) init(config *Config) {
 	if c.pubKeyToIdentity == nil {
 		c.pubKeyToIdentity = DefaultPubKeyToIdentity
 	}
-	c.identity = c.pubKeyToIdentity(&c.privateKey.PublicKey)
-	c.curve = c.privateKey.Curve
+
+	// sign with the private key, unless a signer is set
+	c.curve = S256Curve
+	c.signer = config.Signer
+	c.verifier = config.Verifier
+	if c.privateKey != nil {
+		c.curve = c.privateKey.Curve
+		if c.signer == nil {
+			c.signer = NewECDSASigner(c.privateKey)
+		}
+	}
+	if c.verifier == nil {
+		c.verifier, _ = c.signer.(Verifier)
+	}
+	var sp SignedProto
+	sp.X, sp.Y = c.signer.PublicKey()
+	c.publicKey = sp.PublicKey(c.curve)
+	c.identity = c.pubKeyToIdentity(c.publicKey)
 
 	// initial default parameters settings
 	c.latency = DefaultConsensusLatency
+	c.unverified = make(map[*SignedProto]bool)
+	c.goneLeaders = make(map[Identity]bool)
 
 	// and initiated the first <roundchange> proposal
 	c.switchRound(0)
@@ -393,9 +468,32 @@ func (c *Consensus) init(config *Config) {
 		ids[id] = true
 	}
 	c.numIdentities = len(ids)
+
+	// the BLS public keys of individual identities
+	if len(config.BLSPublicKeys) > 0 {
+		c.blsPublicKeys = make(map[Identity]*BLSPublicKey)
+		for k, id := range c.participants {
+			if _, ok := c.blsPublicKeys[id]; !ok {
+				c.blsPublicKeys[id] = config.BLSPublicKeys[k]
+			}
+		}
+	}
+
+	// sum the weights of individual identities
+	c.totalWeight = uint64(c.numIdentities)
+	if len(config.Weights) > 0 {
+		c.weights = make(map[Identity]uint64)
+		c.totalWeight = 0
+		for k, id := range c.participants {
+			if _, ok := c.weights[id]; !ok {
+				c.weights[id] = config.Weights[k]
+				c.totalWeight += config.Weights[k]
+			}
+		}
+	}
 }
 
-//  calculates roundchangeDuration
+// calculates roundchangeDuration
 func (c *Consensus) roundchangeDuration(round uint64) time.Duration {
 	d := 2 * c.latency * (1 << round)
 	if d > MaxConsensusLatency {
@@ -404,7 +502,7 @@ func (c *Consensus) roundchangeDuration(round uint64) time.Duration {
 	return d
 }
 
-//  calculates collectDuration
+// calculates collectDuration
 func (c *Consensus) collectDuration(round uint64) time.Duration {
 	d := 2 * c.latency * (1 << round)
 	if d > MaxConsensusLatency {
@@ -413,7 +511,7 @@ func (c *Consensus) collectDuration(round uint64) time.Duration {
 	return d
 }
 
-//  calculates lockDuration
+// calculates lockDuration
 func (c *Consensus) lockDuration(round uint64) time.Duration {
 	d := 4 * c.latency * (1 << round)
 	if d > MaxConsensusLatency {
@@ -470,6 +568,34 @@ func (c *Consensus) maximalUnconfirmed() State {
 	return nil
 }
 
+// recheckUnconfirmed evicts unconfirmed states which are no longer
+// acceptable to the admission policy, states in exempt will be kept
+// regardless of the policy.
+func (c *Consensus) recheckUnconfirmed(exempt []State) {
+	if c.admissionPolicy == nil {
+		return
+	}
+
+	exemptHashes := make(map[StateHash]bool)
+	for k := range exempt {
+		exemptHashes[c.stateHash(exempt[k])] = true
+	}
+
+	// in-place deletion
+	o := 0
+	for i := 0; i < len(c.unconfirmed); i++ {
+		if exemptHashes[c.stateHash(c.unconfirmed[i])] ||
+			c.admissionPolicy.CheckState(c.unconfirmed[i], AdmissionRecheck) == nil {
+			c.unconfirmed[o] = c.unconfirmed[i]
+			o++
+		}
+	}
+	for i := o; i < len(c.unconfirmed); i++ {
+		c.unconfirmed[i] = nil // avoid memory leak
+	}
+	c.unconfirmed = c.unconfirmed[:o]
+}
+
 // verifyMessage verifies message signature against it's <r,s> & <x,y>,
 // and also checks if the signer is a valid participant.
 // returns it's decoded 'Message' object if signature has proved authentic.
@@ -478,6 +604,7 @@ func (c *Consensus) verifyMessage(signed *SignedProto) (*Message, error) {
 	if signed == nil {
 		return nil, ErrMessageIsEmpty
 	}
+	defer c.profiler.Since(ProfileVerify, c.profiler.Now())
 
 	// check signer's identity, all participants have proven
 	// public key
@@ -507,7 +634,7 @@ func (c *Consensus) verifyMessage(signed *SignedProto) (*Message, error) {
 	*/
 
 	// as public key is proven , we don't have to verify the public key
-	if !signed.Verify(c.curve) {
+	if !c.verifySignature(signed) {
 		return nil, ErrMessageSignature
 	}
 
@@ -520,6 +647,41 @@ func (c *Consensus) verifyMessage(signed *SignedProto) (*Message, error) {
 	return m, nil
 }
 
+// verifyAuthenticatedMessage is like verifyMessage, but skips verifying the
+// signature if the message is from the sender's own connection and of a type
+// in canSkipVerify, the message is recorded in c.unverified then.
+func (c *Consensus) verifyAuthenticatedMessage(signed *SignedProto, sender *ecdsa.PublicKey) (*Message, error) {
+	if signed == nil {
+		return nil, ErrMessageIsEmpty
+	}
+
+	coord := c.pubKeyToIdentity(signed.PublicKey(c.curve))
+	if coord != c.pubKeyToIdentity(sender) {
+		return c.verifyMessage(signed)
+	}
+
+	m := new(Message)
+	if err := proto.Unmarshal(signed.Message, m); err != nil {
+		return nil, err
+	}
+	if !canSkipVerify(m.Type) {
+		return c.verifyMessage(signed)
+	}
+
+	knownParticipants := false
+	for k := range c.participants {
+		if coord == c.participants[k] {
+			knownParticipants = true
+		}
+	}
+	if !knownParticipants {
+		return nil, ErrMessageUnknownParticipant
+	}
+
+	c.unverified[signed] = true
+	return m, nil
+}
+
 // verify <roundchange> message
 func (c *Consensus) verifyRoundChangeMessage(m *Message) error {
 	// check message height
@@ -611,17 +773,17 @@ func (c *Consensus) verifyLockMessage(m *Message, signed *SignedProto) error {
 		rcs[c.pubKeyToIdentity(proof.PublicKey(c.curve))] = mProof.State
 	}
 
-	// count individual proofs to B', which has already guaranteed to be the maximal one.
-	var numValidateProofs int
+	// weigh individual proofs to B', which has already guaranteed to be the maximal one.
+	var validateWeight uint64
 	mHash := c.stateHash(m.State)
-	for _, v := range rcs {
+	for id, v := range rcs {
 		if c.stateHash(v) == mHash { // B'
-			numValidateProofs++
+			validateWeight += c.weight(id)
 		}
 	}
 
-	// check if valid proofs count is less that 2*t+1
-	if numValidateProofs < 2*c.t()+1 {
+	// check if valid proofs weight is less that 2*t+1
+	if validateWeight < 2*c.t()+1 {
 		return ErrLockProofInsufficient
 	}
 	return nil
@@ -719,16 +881,20 @@ func (c *Consensus) verifySelectMessage(m *Message, signed *SignedProto) error {
 	}
 
 	// check we have at least 2*t+1 proof
-	if len(rcs) < 2*c.t()+1 {
+	var proofWeight uint64
+	for id := range rcs {
+		proofWeight += c.weight(id)
+	}
+	if proofWeight < 2*c.t()+1 {
 		return ErrSelectProofInsufficient
 	}
 
-	// count maximum proofs with B' != NULL with identical data hash,
+	// weigh maximum proofs with B' != NULL with identical data hash,
 	// to prevent leader cheating on select.
-	dataProposals := make(map[StateHash]int)
-	for _, data := range rcs {
+	dataProposals := make(map[StateHash]uint64)
+	for id, data := range rcs {
 		if data != nil {
-			dataProposals[c.stateHash(data)]++
+			dataProposals[c.stateHash(data)] += c.weight(id)
 		}
 	}
 
@@ -739,10 +905,10 @@ func (c *Consensus) verifySelectMessage(m *Message, signed *SignedProto) error {
 	}
 
 	// find the highest proposed B'(not NULL)
-	var maxProposed int
-	for _, count := range dataProposals {
-		if count > maxProposed {
-			maxProposed = count
+	var maxProposed uint64
+	for _, weight := range dataProposals {
+		if weight > maxProposed {
+			maxProposed = weight
 		}
 	}
 
@@ -876,6 +1042,15 @@ func (c *Consensus) verifyDecideMessage(m *Message, signed *SignedProto) error {
 		return ErrDecideNotSignedByLeader
 	}
 
+	// the aggregated BLS signature, or the threshold signature replaces the
+	// <commit> proofs
+	if c.blsPublicKeys != nil {
+		return c.verifyDecideBLS(m)
+	}
+	if c.thresholdPublicKey != nil {
+		return c.verifyDecideThreshold(m)
+	}
+
 	commits := make(map[Identity]State)
 	for _, proof := range m.Proof {
 		mProof, err := c.verifyMessage(proof)
@@ -909,21 +1084,28 @@ func (c *Consensus) verifyDecideMessage(m *Message, signed *SignedProto) error {
 			}
 		}
 
+		// the beacon of each commit
+		if c.enableBeacon {
+			if _, err := c.verifyCommitBeacon(mProof, proof); err != nil {
+				return err
+			}
+		}
+
 		commits[c.pubKeyToIdentity(proof.PublicKey(c.curve))] = mProof.State
 	}
 
-	// count proofs to m.State
-	var numValidateProofs int
+	// weigh proofs to m.State
+	var validateWeight uint64
 	mHash := c.stateHash(m.State)
-	for _, v := range commits {
+	for id, v := range commits {
 		if c.stateHash(v) == mHash {
-			numValidateProofs++
+			validateWeight += c.weight(id)
 		}
 	}
 
 	// check to see if the message has at least 2*t+1 <commit> valid proofs,
 	// if not, the leader may cheat.
-	if numValidateProofs < 2*c.t()+1 {
+	if validateWeight < 2*c.t()+1 {
 		return ErrDecideProofInsufficient
 	}
 	return nil
@@ -944,6 +1126,7 @@ func (c *Consensus) broadcastRoundChange() {
 	data := c.maximalLocked()
 	if data == nil {
 		// if there's none locked data, we pick the maximum unconfirmed data to propose
+		c.recheckUnconfirmed(nil)
 		data = c.maximalUnconfirmed()
 		// if still null, return
 		if data == nil {
@@ -969,7 +1152,7 @@ func (c *Consensus) broadcastLock() {
 	m.Height = c.latestHeight + 1
 	m.Round = c.currentRound.RoundNumber
 	m.State = c.currentRound.LockedState
-	m.Proof = c.currentRound.SignedRoundChanges()
+	m.Proof = c.verifiedProofs(c.currentRound.SignedRoundChanges())
 	c.broadcast(&m)
 	//log.Println("broadcast:<lock>")
 }
@@ -992,21 +1175,30 @@ func (c *Consensus) broadcastSelect() {
 	m.Type = MessageType_Select
 	m.Height = c.latestHeight + 1
 	m.Round = c.currentRound.RoundNumber
+	// states in <roundchange> proofs are kept, as B' must be no less than any of them
+	c.recheckUnconfirmed(c.currentRound.RoundChangeStates())
 	m.State = c.maximalUnconfirmed() // B' may be NULL
-	m.Proof = c.currentRound.SignedRoundChanges()
+	m.Proof = c.verifiedProofs(c.currentRound.SignedRoundChanges())
 	c.broadcast(&m)
 	//log.Println("broadcast:<select>", m.State)
 }
 
 // broadcastDecide will broadcast a <decide> message by the leader,
-// from current round with <commit> proofs.
+// from current round with <commit> proofs, or their aggregated BLS signature,
+// or their combined threshold signature.
 func (c *Consensus) broadcastDecide() *SignedProto {
 	var m Message
 	m.Type = MessageType_Decide
 	m.Height = c.latestHeight + 1
 	m.Round = c.currentRound.RoundNumber
 	m.State = c.currentRound.LockedState
-	m.Proof = c.currentRound.SignedCommits()
+	if c.blsPublicKeys != nil {
+		m.BLSSignature, m.Signers = c.aggregateCommitsBLS()
+	} else if c.thresholdPublicKey != nil {
+		m.BLSSignature, m.Signers = c.combineCommitsThreshold()
+	} else {
+		m.Proof = c.verifiedProofs(c.currentRound.SignedCommits())
+	}
 	return c.broadcast(&m)
 	//log.Println("broadcast:<decide>")
 }
@@ -1021,7 +1213,7 @@ func (c *Consensus) broadcastResync() {
 	var m Message
 	m.Type = MessageType_Resync
 	// we only care about <roundchange> messages in resync
-	m.Proof = c.lastRoundChangeProof
+	m.Proof = c.verifiedProofs(c.lastRoundChangeProof)
 	c.broadcast(&m)
 	//log.Println("broadcast:<resync>")
 }
@@ -1038,6 +1230,15 @@ func (c *Consensus) sendCommit(msgLock *Message) {
 	m.Height = msgLock.Height // h
 	m.Round = msgLock.Round   // r
 	m.State = msgLock.State   // B'j
+	if c.enableBeacon {
+		m.Beacon = c.proveBeacon(m.Height)
+	}
+	if c.blsKey != nil {
+		m.BLSSignature = c.signCommitBLS(&m)
+	}
+	if c.thresholdKey != nil {
+		m.BLSSignature = c.signCommitThreshold(&m)
+	}
 	if c.enableCommitUnicast {
 		c.sendTo(&m, c.roundLeader(m.Round))
 	} else {
@@ -1048,11 +1249,16 @@ func (c *Consensus) sendCommit(msgLock *Message) {
 }
 
 // broadcast signs the message with private key before broadcasting to all peers.
+// The message is dropped if the signer fails, like a remote signer being
+// unreachable, and nil is returned, the timeouts will send it again.
 func (c *Consensus) broadcast(m *Message) *SignedProto {
 	// sign
+	start := c.profiler.Now()
 	sp := new(SignedProto)
 	sp.Version = ProtocolVersion
-	sp.Sign(m, c.privateKey)
+	if err := sp.SignWith(m, c.signer); err != nil {
+		return nil
+	}
 
 	// message callback
 	if c.messageOutCallback != nil {
@@ -1063,6 +1269,7 @@ func (c *Consensus) broadcast(m *Message) *SignedProto {
 	if err != nil {
 		panic(err)
 	}
+	c.profiler.Since(ProfileMarshal, start)
 
 	// send to peers one by one
 	for _, peer := range c.peers {
@@ -1074,12 +1281,16 @@ func (c *Consensus) broadcast(m *Message) *SignedProto {
 	return sp
 }
 
-// sendTo signs the message with private key before transmitting to the peer.
+// sendTo signs the message with private key before transmitting to the peer,
+// it's dropped if the signer fails.
 func (c *Consensus) sendTo(m *Message, leader Identity) {
 	// sign
+	start := c.profiler.Now()
 	sp := new(SignedProto)
 	sp.Version = ProtocolVersion
-	sp.Sign(m, c.privateKey)
+	if err := sp.SignWith(m, c.signer); err != nil {
+		return
+	}
 
 	// message callback
 	if c.messageOutCallback != nil {
@@ -1091,6 +1302,7 @@ func (c *Consensus) sendTo(m *Message, leader Identity) {
 	if err != nil {
 		panic(err)
 	}
+	c.profiler.Since(ProfileMarshal, start)
 
 	// we need to send this message to myself (via loopback) if i'm the leader
 	if leader == c.identity {
@@ -1172,6 +1384,17 @@ func (c *Consensus) lockRelease() {
 // and all lower rounds will be cleared while switching.
 func (c *Consensus) switchRound(round uint64) { c.currentRound = c.getRound(round, true) }
 
+// LeaderGone hints that a participant is leaving, the rounds led by it at
+// current height won't wait for it's <lock>, <select> or <decide>, but
+// enter lock-release stage once 2t+1 <roundchange> are collected, as if the
+// timeouts had expired. The hint only affects liveness, and is cleared at
+// the next height.
+func (c *Consensus) LeaderGone(id Identity) {
+	if id != c.identity {
+		c.goneLeaders[id] = true
+	}
+}
+
 // roundLeader returns leader's identity for a given round
 func (c *Consensus) roundLeader(round uint64) Identity {
 	// NOTE: fixed leader is for testing
@@ -1193,16 +1416,52 @@ func (c *Consensus) heightSync(height uint64, round uint64, s State, now time.Ti
 	c.rounds.Init()              // clean all round
 	c.locks = nil                // clean locks
 	c.unconfirmed = nil          // clean all unconfirmed states from previous heights
-	c.switchRound(0)             // start new round at new height
+	c.unverified = make(map[*SignedProto]bool)
+	c.goneLeaders = make(map[Identity]bool)
+	c.switchRound(0) // start new round at new height
 	c.currentRound.Stage = stageRoundChanging
 }
 
-// t calculates (n-1)/3
-func (c *Consensus) t() int { return (c.numIdentities - 1) / 3 }
+// t calculates (n-1)/3, n is the total weight if the participants are weighted
+func (c *Consensus) t() uint64 { return (c.totalWeight - 1) / 3 }
+
+// weight returns the weight of a participant, 1 if not weighted
+func (c *Consensus) weight(id Identity) uint64 {
+	if c.weights == nil {
+		return 1
+	}
+	return c.weights[id]
+}
+
+// signerWeight returns the weight of the signer of a message
+func (c *Consensus) signerWeight(sp *SignedProto) uint64 {
+	if c.weights == nil {
+		return 1
+	}
+	return c.weights[c.pubKeyToIdentity(sp.PublicKey(c.curve))]
+}
 
 // Propose adds a new state to unconfirmed queue to particpate in
-// consensus at next height.
-func (c *Consensus) Propose(s State) {
+// consensus at next height, the error from AdmissionPolicy will be
+// returned if the state has been rejected.
+func (c *Consensus) Propose(s State) error {
+	if s == nil {
+		return nil
+	}
+
+	if c.admissionPolicy != nil {
+		if err := c.admissionPolicy.CheckState(s, AdmissionNew); err != nil {
+			return err
+		}
+	}
+
+	c.propose(s)
+	return nil
+}
+
+// propose adds a state to unconfirmed queue without admission check,
+// used for states proposed by other participants.
+func (c *Consensus) propose(s State) {
 	if s == nil {
 		return
 	}
@@ -1219,6 +1478,8 @@ func (c *Consensus) Propose(s State) {
 // ReceiveMessage processes incoming consensus messages, and returns error
 // if message cannot be processed for some reason.
 func (c *Consensus) ReceiveMessage(bts []byte, now time.Time) (err error) {
+	defer c.profiler.Since(ProfileTransition, c.profiler.Now())
+
 	// messages broadcasted to myself may be queued recursively, and
 	// we only process these messages in defer to avoid side effects
 	// while processing.
@@ -1227,14 +1488,166 @@ func (c *Consensus) ReceiveMessage(bts []byte, now time.Time) (err error) {
 			bts := c.loopback[0]
 			c.loopback = c.loopback[1:]
 			// NOTE: message directed to myself ignores error.
-			_ = c.receiveMessage(bts, now)
+			_ = c.receiveMessage(bts, now, nil)
+		}
+	}()
+
+	return c.receiveMessage(bts, now, nil)
+}
+
+// ReceiveAuthenticatedMessage is like ReceiveMessage, for messages delivered
+// by a connection which has authenticated to sender at session level. If
+// the message is signed by the sender itself, i.e. not relayed, and it's a
+// <roundchange>, <commit>, <lock-release> or <resync>, the verification of
+// it's signature is skipped.
+//
+// Safety: a sender can only skip the verification of it's own messages, so
+// nothing is forgeable which an authenticated sender couldn't have signed
+// anyway. But a byzantine sender could send it's own message with a bad
+// signature, which would invalidate the proofs of honest nodes relaying it,
+// so the skipped signatures are verified before the messages are used as
+// proofs, and the invalid ones are left out. <lock>, <select> and <decide>
+// are always verified, as they're recorded or relayed as a whole.
+//
+// Messages embedded as proofs are always verified, as well as all messages
+// when sender is nil.
+func (c *Consensus) ReceiveAuthenticatedMessage(bts []byte, sender *ecdsa.PublicKey, now time.Time) (err error) {
+	defer c.profiler.Since(ProfileTransition, c.profiler.Now())
+
+	defer func() {
+		for len(c.loopback) > 0 {
+			bts := c.loopback[0]
+			c.loopback = c.loopback[1:]
+			_ = c.receiveMessage(bts, now, nil)
 		}
 	}()
 
-	return c.receiveMessage(bts, now)
+	return c.receiveMessage(bts, now, sender)
 }
 
-func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
+// ApplyDecide fast-forwards the consensus to the height of a <decide>
+// message fetched to catch up with the network. Unlike ReceiveMessage, the
+// message is not propagated to the peers, and the <roundchange> of the new
+// height is broadcasted at next Update, so applying the decisions of many
+// heights one after another sends only the one of the latest.
+func (c *Consensus) ApplyDecide(bts []byte, now time.Time) error {
+	defer c.profiler.Since(ProfileTransition, c.profiler.Now())
+
+	signed := new(SignedProto)
+	err := proto.Unmarshal(bts, signed)
+	if err != nil {
+		return err
+	}
+
+	if signed.Version != ProtocolVersion {
+		return ErrMessageVersion
+	}
+
+	m, err := c.verifyMessage(signed)
+	if err != nil {
+		return err
+	}
+
+	if m.Type != MessageType_Decide {
+		return ErrMessageUnknownMessageType
+	}
+
+	if c.messageValidator != nil {
+		if !c.messageValidator(c, m, signed) {
+			return ErrMessageValidator
+		}
+	}
+
+	err = c.verifyDecideMessage(m, signed)
+	if err != nil {
+		return err
+	}
+
+	c.latestProof = signed
+	c.heightSync(m.Height, m.Round, m.State, now)
+	// the <roundchange> is broadcasted at next Update
+	c.rcTimeout = now
+	return nil
+}
+
+// canSkipVerify returns true if the signature of a message of the given type
+// from it's own signer's connection can be verified lazily
+func canSkipVerify(t MessageType) bool {
+	switch t {
+	case MessageType_RoundChange, MessageType_Commit, MessageType_LockRelease, MessageType_Resync:
+		return true
+	}
+	return false
+}
+
+// verifiedProofs verifies the proofs accepted without their signatures
+// verified, and leaves the invalid ones out.
+func (c *Consensus) verifiedProofs(proofs []*SignedProto) []*SignedProto {
+	if len(c.unverified) == 0 {
+		return proofs
+	}
+
+	verified := make([]*SignedProto, 0, len(proofs))
+	for _, proof := range proofs {
+		if c.unverified[proof] {
+			start := c.profiler.Now()
+			valid := c.verifySignature(proof)
+			c.profiler.Since(ProfileVerify, start)
+			if !valid {
+				continue
+			}
+			delete(c.unverified, proof)
+		}
+		verified = append(verified, proof)
+	}
+	return verified
+}
+
+// verifyTuples verifies the messages of the tuples accepted without their
+// signatures verified, and returns the valid ones, so the forged messages
+// don't count towards 2t+1.
+func (c *Consensus) verifyTuples(tuples []messageTuple) []messageTuple {
+	if len(c.unverified) == 0 {
+		return tuples
+	}
+
+	o := 0
+	for k := range tuples {
+		if proof := tuples[k].Signed; c.unverified[proof] {
+			start := c.profiler.Now()
+			valid := c.verifySignature(proof)
+			c.profiler.Since(ProfileVerify, start)
+			delete(c.unverified, proof)
+			if !valid {
+				continue
+			}
+		}
+		tuples[o] = tuples[k]
+		o++
+	}
+	for k := o; k < len(tuples); k++ {
+		tuples[k] = messageTuple{} // set to nil to avoid memory leak
+	}
+	return tuples[:o]
+}
+
+// verifyRoundChanges verifies the <roundchange> messages of the round before
+// 2t+1 of them are acted on, the max proposed state is recomputed if any
+// has been removed.
+func (c *Consensus) verifyRoundChanges(r *consensusRound) {
+	n := len(r.roundChanges)
+	if r.roundChanges = c.verifyTuples(r.roundChanges); len(r.roundChanges) != n && r.MaxProposedWeight > 0 {
+		r.MaxProposedState, r.MaxProposedWeight = r.GetMaxProposed()
+	}
+}
+
+// verifyCommits verifies the <commit> messages of the round before deciding
+// by them.
+func (c *Consensus) verifyCommits(r *consensusRound) {
+	r.commits = c.verifyTuples(r.commits)
+}
+
+func (c *Consensus) receiveMessage(bts []byte, now time.Time, sender *ecdsa.PublicKey) error {
 	// unmarshal signed message
 	signed := new(SignedProto)
 	err := proto.Unmarshal(bts, signed)
@@ -1248,7 +1661,12 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 	}
 
 	// check message signature & qualifications
-	m, err := c.verifyMessage(signed)
+	var m *Message
+	if sender != nil {
+		m, err = c.verifyAuthenticatedMessage(signed, sender)
+	} else {
+		m, err = c.verifyMessage(signed)
+	}
 	if err != nil {
 		return err
 	}
@@ -1310,7 +1728,15 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 		// at round m.Round. if this message is not duplicated in m.Round,
 		// round records message along with its signed <roundchange> message
 		// to provide proofs in the future.
+		weight := round.RoundChangeWeight()
 		if round.AddRoundChange(signed, m) {
+			// the messages not verified yet are verified at 2t+1, before
+			// acting on their weight, so the round is fully verified once
+			// it has reached 2t+1.
+			if round.RoundChangeWeight() >= 2*c.t()+1 {
+				c.verifyRoundChanges(round)
+			}
+
 			// During any time of the protocol, if a the Pacemaker of Pj (including Pi)
 			// receives at least 2t + 1 round-change message (including round-change
 			// message from himself) for round r (which is larger than its current round
@@ -1325,7 +1751,9 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 			//
 			// Example: P sends r+1 to remove from r, and sends to r again to trigger 2t+1 once
 			// more to reset timeout.
-			if round.NumRoundChanges() == 2*c.t()+1 && round.Stage < stageLock {
+			//
+			// NOTE: with weighted participants, 2t+1 is triggered when the weight crosses it.
+			if quorum := 2*c.t() + 1; weight < quorum && round.RoundChangeWeight() >= quorum && round.Stage < stageLock {
 				// switch to this round
 				c.switchRound(m.Round)
 				// record this round change proof for resyncing
@@ -1352,10 +1780,10 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 
 			// for the leader, who's current round has at least 2*t+1 <roundchange>,
 			// we will track max proposed state for each valid added <roundchange>
-			if round == c.currentRound && round.NumRoundChanges() >= 2*c.t()+1 {
+			if round == c.currentRound && round.RoundChangeWeight() >= 2*c.t()+1 {
 				leaderKey := c.roundLeader(m.Round)
 				if leaderKey == c.identity {
-					round.MaxProposedState, round.MaxProposedCount = round.GetMaxProposed()
+					round.MaxProposedState, round.MaxProposedWeight = round.GetMaxProposed()
 				}
 			}
 		}
@@ -1380,7 +1808,7 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 			c.lockReleaseTimeout = now.Add(c.commitDuration(m.Round))
 			c.lockRelease()
 			// add to Blockj
-			c.Propose(m.State)
+			c.propose(m.State)
 		}
 
 	case MessageType_Lock:
@@ -1464,13 +1892,38 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 				return err
 			}
 
+			// the beacon must be verified before the commit becomes a proof
+			if c.enableBeacon {
+				if _, err := c.verifyCommitBeacon(m, signed); err != nil {
+					return err
+				}
+			}
+
+			// so does the BLS signature before being aggregated, or the
+			// partial signature before being combined
+			if c.blsPublicKeys != nil {
+				if err := c.verifyCommitBLS(m, signed); err != nil {
+					return err
+				}
+			}
+			if c.thresholdPublicKey != nil {
+				if err := c.verifyCommitThreshold(m, signed); err != nil {
+					return err
+				}
+			}
+
 			// verifyCommitMessage can guarantee that the message is to currentRound,
 			// so we're safe to process in current round.
 			if c.currentRound.AddCommit(signed, m) {
 				// NOTE: we proceed the following only when AddCommit returns true.
-				// NumCommitted will only return commits with locked B'
+				// CommittedWeight will only weigh commits with locked B'
 				// and ignore non-B' commits.
-				if c.currentRound.NumCommitted() >= 2*c.t()+1 {
+				// the messages not verified yet are verified at 2t+1,
+				// before deciding by their weight
+				if c.currentRound.CommittedWeight() >= c.decideWeight() {
+					c.verifyCommits(c.currentRound)
+				}
+				if c.currentRound.CommittedWeight() >= c.decideWeight() {
 					/*
 						log.Println("======= LEADER'S DECIDE=====")
 						log.Println("Height:", c.currentHeight+1)
@@ -1478,13 +1931,16 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 						log.Println("State:", State(c.currentRound.LockedState).hash())
 					*/
 
-					// broadcast decide will return what it has sent
-					c.latestProof = c.broadcastDecide()
-					c.heightSync(c.latestHeight+1, c.currentRound.RoundNumber, c.currentRound.LockedState, now)
-					// leader should wait for 1 more latency
-					c.rcTimeout = now.Add(c.roundchangeDuration(0) + c.latency)
-					// broadcast <roundchange> at new height
-					c.broadcastRoundChange()
+					// broadcast decide will return what it has sent, or nil if
+					// it's not signed, then the next <commit> retries
+					if proof := c.broadcastDecide(); proof != nil {
+						c.latestProof = proof
+						c.heightSync(c.latestHeight+1, c.currentRound.RoundNumber, c.currentRound.LockedState, now)
+						// leader should wait for 1 more latency
+						c.rcTimeout = now.Add(c.roundchangeDuration(0) + c.latency)
+						// broadcast <roundchange> at new height
+						c.broadcastRoundChange()
+					}
 				}
 			}
 		}
@@ -1526,13 +1982,15 @@ func (c *Consensus) receiveMessage(bts []byte, now time.Time) error {
 // Update will process timing event for the state machine, callers
 // from outside MUST call this function periodically(like 20ms).
 func (c *Consensus) Update(now time.Time) error {
+	defer c.profiler.Since(ProfileTransition, c.profiler.Now())
+
 	// as in ReceiveMessage, we also need to handle broadcasting messages
 	// directed to myself.
 	defer func() {
 		for len(c.loopback) > 0 {
 			bts := c.loopback[0]
 			c.loopback = c.loopback[1:]
-			_ = c.receiveMessage(bts, now)
+			_ = c.receiveMessage(bts, now, nil)
 		}
 	}()
 
@@ -1558,7 +2016,8 @@ func (c *Consensus) Update(now time.Time) error {
 		if leaderKey == c.identity {
 			// check if we have enough 2t+1 <roundchange> to lock B',
 			// which B' != NULL
-			if c.currentRound.MaxProposedCount >= 2*c.t()+1 {
+			c.verifyRoundChanges(c.currentRound)
+			if c.currentRound.MaxProposedWeight >= 2*c.t()+1 {
 				// lock B' to c.currentRound
 				c.currentRound.LockedState = c.currentRound.MaxProposedState
 				// and computes its hash for comparing B' in <commit> message
@@ -1576,7 +2035,7 @@ func (c *Consensus) Update(now time.Time) error {
 				// enqueue all received non-NULL data
 				states := c.currentRound.RoundChangeStates()
 				for k := range states {
-					c.Propose(states[k])
+					c.propose(states[k])
 				}
 
 				// broadcast this <select>, leader itself will receive this message too.
@@ -1587,6 +2046,12 @@ func (c *Consensus) Update(now time.Time) error {
 				c.lockRelease()
 				return nil
 			}
+		} else if c.goneLeaders[leaderKey] {
+			// the leader has left, neither <lock> nor <select> will come,
+			// enters lock-release status as if commit has timed out.
+			c.currentRound.Stage = stageLockRelease
+			c.lockReleaseTimeout = now.Add(c.lockReleaseDuration(c.currentRound.RoundNumber))
+			c.lockRelease()
 		} else if now.After(c.lockTimeout) {
 			// non-leader's lock timeout, enters commit status and set timeout
 			c.currentRound.Stage = stageCommit
@@ -1598,7 +2063,8 @@ func (c *Consensus) Update(now time.Time) error {
 			panic("commit stage entered, but commitTimout not set")
 		}
 
-		if now.After(c.commitTimeout) {
+		// no <decide> will come if the leader has left
+		if now.After(c.commitTimeout) || c.goneLeaders[c.roundLeader(c.currentRound.RoundNumber)] {
 			c.currentRound.Stage = stageLockRelease
 			c.lockReleaseTimeout = now.Add(c.lockReleaseDuration(c.currentRound.RoundNumber))
 			c.lockRelease()
@@ -1629,9 +2095,29 @@ func (c *Consensus) CurrentState() (height uint64, round uint64, data State) {
 // CurrentProof returns current <decide> message for current height
 func (c *Consensus) CurrentProof() *SignedProto { return c.latestProof }
 
+// Profiler returns the profiler set in Config, or nil.
+func (c *Consensus) Profiler() *Profiler { return c.profiler }
+
+// Participants returns the identities of the consensus group
+func (c *Consensus) Participants() []Identity {
+	return append([]Identity(nil), c.participants...)
+}
+
+// Quorum returns the number of participants to reach agreement, 2t+1, or
+// their weight if the participants are weighted, see Weight.
+func (c *Consensus) Quorum() int { return int(2*c.t() + 1) }
+
+// Weight returns the weight of a participant, 1 if the participants are not
+// weighted, or 0 if it's not a participant of a weighted consensus.
+func (c *Consensus) Weight(id Identity) uint64 { return c.weight(id) }
+
 // SetLatency sets participants expected latency for consensus core
 func (c *Consensus) SetLatency(latency time.Duration) { c.latency = latency }
 
+// StateHash returns the hash identifying the state in the messages, and
+// the proofs of the decisions.
+func (c *Consensus) StateHash(state State) StateHash { return c.stateHash(state) }
+
 // HasProposed checks whether some state has been proposed via <roundchange>
 // <lock> or left in c.unconfirmed
 func (c *Consensus) HasProposed(state State) bool {
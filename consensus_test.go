@@ -3,9 +3,11 @@ package bdls
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	fmt "fmt"
 	"io"
 	"log"
@@ -131,6 +133,112 @@ func TestProposeMultipleRoundChanges(t *testing.T) {
 	assert.Equal(t, highest, lastOne.Message.Round)
 }
 
+func TestReceiveAuthenticatedMessage(t *testing.T) {
+	_, signed, signer := createRoundChangeMessage(t, 1, 0)
+	other, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	extra, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	// 2t+1 is not reached by one <roundchange>, it's not verified until then
+	consensus := createConsensus(t, 0, 0, []*ecdsa.PublicKey{&signer.PublicKey, &other.PublicKey, &extra.PublicKey})
+
+	// a byzantine signer sends it's own message with a bad signature
+	signed.S[0] ^= 0xff
+	bts, err := proto.Marshal(signed)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrMessageSignature, consensus.ReceiveMessage(bts, time.Now()))
+	// relayed by another participant
+	assert.Equal(t, ErrMessageSignature, consensus.ReceiveAuthenticatedMessage(bts, &other.PublicKey, time.Now()))
+	// delivered by the signer's own connection
+	assert.Nil(t, consensus.ReceiveAuthenticatedMessage(bts, &signer.PublicKey, time.Now()))
+	assert.Equal(t, 1, len(consensus.unverified))
+
+	// the bad signature is left out of the proofs
+	proofs := consensus.currentRound.SignedRoundChanges()
+	verified := consensus.verifiedProofs(proofs)
+	assert.Equal(t, len(proofs)-1, len(verified))
+	for _, proof := range verified {
+		assert.True(t, proof.Verify(S256Curve))
+	}
+
+	// <lock> is always verified
+	_, signedLock, lockSigner, _ := createLockMessage(t, 4, 1, 0, 1, 0)
+	consensus.AddParticipant(&lockSigner.PublicKey)
+	signedLock.S[0] ^= 0xff
+	bts, err = proto.Marshal(signedLock)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrMessageSignature, consensus.ReceiveAuthenticatedMessage(bts, &lockSigner.PublicKey, time.Now()))
+}
+
+func TestUnverifiedQuorum(t *testing.T) {
+	var signers []*ecdsa.PrivateKey
+	var quorum []*ecdsa.PublicKey
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		signers = append(signers, privateKey)
+		quorum = append(quorum, &privateKey.PublicKey)
+	}
+	// 5 participants, 2t+1 = 3
+	consensus := createConsensus(t, 0, 0, quorum)
+
+	receive := func(signer *ecdsa.PrivateKey, forge bool) error {
+		_, signed, _ := createRoundChangeMessageSigner(t, 1, 1, []byte{1}, signer)
+		if forge {
+			signed.S[0] ^= 0xff
+		}
+		bts, err := proto.Marshal(signed)
+		assert.Nil(t, err)
+		return consensus.ReceiveAuthenticatedMessage(bts, &signer.PublicKey, time.Now())
+	}
+
+	// the forged <roundchange> reaching 2t+1 is verified, and removed
+	assert.Nil(t, receive(signers[0], false))
+	assert.Nil(t, receive(signers[1], false))
+	assert.Nil(t, receive(signers[2], true))
+	assert.Equal(t, uint64(0), consensus.currentRound.RoundNumber)
+	assert.Equal(t, 2, consensus.getRound(1, false).NumRoundChanges())
+	assert.Equal(t, 0, len(consensus.unverified))
+
+	// a valid one reaches 2t+1
+	assert.Nil(t, receive(signers[3], false))
+	assert.Equal(t, uint64(1), consensus.currentRound.RoundNumber)
+	for _, proof := range consensus.currentRound.SignedRoundChanges() {
+		assert.True(t, proof.Verify(S256Curve))
+	}
+
+	// the same for <commit> messages to the leader, it doesn't decide by
+	// the forged one
+	state := []byte{1}
+	consensus.fixedLeader = &consensus.identity
+	consensus.currentRound.Stage = stageCommit
+	consensus.currentRound.LockedState = state
+	consensus.currentRound.LockedStateHash = consensus.stateHash(state)
+	commit := func(signer *ecdsa.PrivateKey, forge bool) error {
+		_, signed, _ := createCommitMessageSigner(t, 1, 1, state, signer)
+		if forge {
+			signed.S[0] ^= 0xff
+		}
+		bts, err := proto.Marshal(signed)
+		assert.Nil(t, err)
+		return consensus.ReceiveAuthenticatedMessage(bts, &signer.PublicKey, time.Now())
+	}
+	assert.Nil(t, commit(signers[0], false))
+	assert.Nil(t, commit(signers[1], false))
+	assert.Nil(t, commit(signers[2], true))
+	assert.Equal(t, uint64(0), consensus.latestHeight)
+	assert.Equal(t, 2, len(consensus.currentRound.commits))
+
+	assert.Nil(t, commit(signers[3], false))
+	assert.Equal(t, uint64(1), consensus.latestHeight)
+	var decide Message
+	assert.Nil(t, proto.Unmarshal(consensus.latestProof.Message, &decide))
+	assert.Equal(t, 3, len(decide.Proof))
+	for _, proof := range decide.Proof {
+		assert.True(t, proof.Verify(S256Curve))
+	}
+}
+
 func TestMultipleCommits(t *testing.T) {
 	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
 	assert.Nil(t, err)
@@ -171,6 +279,63 @@ func TestMultipleCommits(t *testing.T) {
 	assert.Equal(t, 1, count)
 }
 
+// admissionFunc adapts a function to AdmissionPolicy
+type admissionFunc func(s State, check AdmissionCheck) error
+
+func (f admissionFunc) CheckState(s State, check AdmissionCheck) error { return f(s, check) }
+
+func TestAdmissionPolicy(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	errRejected := errors.New("rejected")
+	banned := make(map[string]bool)
+	var roundChanges []State
+
+	config := new(Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = privateKey
+	config.Participants = []Identity{DefaultPubKeyToIdentity(&privateKey.PublicKey)}
+	config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a State) bool { return true }
+	config.AdmissionPolicy = admissionFunc(func(s State, check AdmissionCheck) error {
+		if banned[string(s)] {
+			return errRejected
+		}
+		return nil
+	})
+	config.MessageOutCallback = func(m *Message, sp *SignedProto) {
+		if m.Type == MessageType_RoundChange {
+			roundChanges = append(roundChanges, m.State)
+		}
+	}
+
+	consensus := new(Consensus)
+	consensus.init(config)
+	consensus.switchRound(0)
+
+	s1 := State([]byte{1})
+	s2 := State([]byte{2})
+	s3 := State([]byte{3})
+	banned[string(s1)] = true
+
+	// rejected on submission
+	assert.Equal(t, errRejected, consensus.Propose(s1))
+	assert.Nil(t, consensus.Propose(s2))
+	assert.Nil(t, consensus.Propose(s3))
+	assert.False(t, consensus.HasProposed(s1))
+	assert.True(t, consensus.HasProposed(s2))
+	assert.True(t, consensus.HasProposed(s3))
+
+	// the maximal state s3 is evicted while rechecking before <roundchange>
+	banned[string(s3)] = true
+	consensus.broadcastRoundChange()
+	assert.False(t, consensus.HasProposed(s3))
+	if assert.Equal(t, 1, len(roundChanges)) {
+		assert.Equal(t, s2, roundChanges[0])
+	}
+}
+
 func TestMaximalLocked(t *testing.T) {
 	consensus := createConsensus(t, 0, 0, nil)
 
@@ -349,6 +514,47 @@ func testStageChange(t *testing.T, leader bool) {
 
 }
 
+func TestLeaderGone(t *testing.T) {
+	quorum := 20
+	consensus := createConsensus(t, 0, 0, nil)
+
+	// create messages & add participant first
+	var sps []*SignedProto
+	var leader *ecdsa.PrivateKey
+	for i := 0; i < quorum; i++ {
+		randstate := make([]byte, 1024)
+		_, err := io.ReadFull(rand.Reader, randstate)
+		assert.Nil(t, err)
+		_, signed, priv := createRoundChangeMessageState(t, 1, 1, randstate)
+		consensus.AddParticipant(&priv.PublicKey)
+		sps = append(sps, signed)
+		leader = priv
+	}
+	consensus.SetLeader(&leader.PublicKey)
+
+	// not the leader, nothing changes
+	consensus.LeaderGone(DefaultPubKeyToIdentity(sps[0].PublicKey(S256Curve)))
+	consensus.LeaderGone(consensus.identity)
+
+	for i := 0; i < quorum; i++ {
+		bts, err := proto.Marshal(sps[i])
+		assert.Nil(t, err)
+		assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	}
+	assert.Equal(t, stageLock, consensus.currentRound.Stage)
+	_ = consensus.Update(time.Now())
+	assert.Equal(t, stageLock, consensus.currentRound.Stage)
+
+	// lock-release without waiting for the timeouts of lock & commit
+	consensus.LeaderGone(DefaultPubKeyToIdentity(&leader.PublicKey))
+	_ = consensus.Update(time.Now())
+	assert.Equal(t, stageLockRelease, consensus.currentRound.Stage)
+
+	// cleared at the next height
+	consensus.heightSync(1, 0, nil, time.Now())
+	assert.Equal(t, 0, len(consensus.goneLeaders))
+}
+
 func TestCommitTimeout(t *testing.T) {
 	t.Log("test commitTimeout stage changing")
 	consensus := createConsensus(t, 0, 0, nil)
@@ -372,11 +578,41 @@ func TestCommitTimeout(t *testing.T) {
 	assert.Equal(t, 1, len(consensus.locks))
 }
 
-///////////////////////////////////////////////////////////////////////////////
+func TestProfiler(t *testing.T) {
+	consensus := createConsensus(t, 0, 0, nil)
+	consensus.profiler = NewProfiler()
+
+	randstate := make([]byte, 1024)
+	_, err := io.ReadFull(rand.Reader, randstate)
+	assert.Nil(t, err)
+	_, signed, priv := createRoundChangeMessageState(t, 1, 0, randstate)
+	consensus.AddParticipant(&priv.PublicKey)
+	bts, err := proto.Marshal(signed)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+	consensus.Update(time.Now())
+
+	profile := consensus.Profiler().Profile()
+	assert.Equal(t, int(numProfilePhases), len(profile))
+	for _, phase := range []ProfilePhase{ProfileVerify, ProfileTransition} {
+		assert.Equal(t, phase.String(), profile[phase].Phase)
+		assert.True(t, profile[phase].Count > 0, phase)
+		assert.True(t, profile[phase].Total > 0, phase)
+	}
+	// the agent times the I/O
+	assert.Equal(t, uint64(0), profile[ProfileIO].Count)
+
+	// a nil profiler times nothing
+	var profiler *Profiler
+	profiler.Since(ProfileVerify, profiler.Now())
+	assert.Nil(t, profiler.Profile())
+}
+
+// /////////////////////////////////////////////////////////////////////////////
 //
 // consensus functional tests via IPC
 //
-///////////////////////////////////////////////////////////////////////////////
+// /////////////////////////////////////////////////////////////////////////////
 type testParam struct {
 	numPeers        int
 	numParticipants int
@@ -1110,3 +1346,188 @@ func testConsensus(t *testing.T, param *testParam) []string {
 	}
 
 }
+
+func TestBeacon(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []Identity
+	for i := 0; i < ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	newConfig := func(privateKey *ecdsa.PrivateKey, epoch time.Time) *Config {
+		config := new(Config)
+		config.Epoch = epoch
+		config.PrivateKey = privateKey
+		config.Participants = coords
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a State) bool { return true }
+		config.EnableBeacon = true
+		return config
+	}
+
+	var peers []*IPCPeer
+	epoch := time.Now()
+	for i := range participants {
+		consensus, err := NewConsensus(newConfig(participants[i], epoch))
+		assert.Nil(t, err)
+		consensus.SetLatency(50 * time.Millisecond)
+		_, err = consensus.CurrentBeacon()
+		assert.Equal(t, ErrBeaconNotFound, err)
+		peers = append(peers, NewIPCPeer(consensus, 10*time.Millisecond))
+	}
+	for i := range peers {
+		for j := range peers {
+			if i != j {
+				assert.True(t, peers[i].c.Join(peers[j]))
+			}
+		}
+	}
+	for i := range peers {
+		peers[i].Update()
+		data := make([]byte, 1024)
+		io.ReadFull(rand.Reader, data)
+		peers[i].Propose(data)
+	}
+	defer func() {
+		for i := range peers {
+			peers[i].Close()
+		}
+	}()
+
+	// all participants derive the same randomness from the <decide> message
+	var beacons []*Beacon
+	var decide []byte
+	var state State
+	for i := range peers {
+		assert.Eventually(t, func() bool { h, _, _ := peers[i].GetLatestState(); return h > 0 }, 10*time.Second, 20*time.Millisecond)
+		peers[i].Lock()
+		beacon, err := peers[i].c.CurrentBeacon()
+		if i == 0 {
+			_, _, state = peers[i].c.CurrentState()
+			decide, err = proto.Marshal(peers[i].c.CurrentProof())
+			assert.Nil(t, err)
+		}
+		peers[i].Unlock()
+		assert.Nil(t, err)
+		beacons = append(beacons, beacon)
+	}
+	for _, beacon := range beacons[1:] {
+		if beacon.Height == beacons[0].Height {
+			assert.Equal(t, beacons[0].Randomness, beacon.Randomness)
+		}
+	}
+	assert.True(t, len(beacons[0].Contributors) >= 2*((len(participants)-1)/3)+1)
+
+	// non-participants verify the randomness with the <decide> message
+	observer, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	verifier, err := NewConsensus(newConfig(observer, epoch))
+	assert.Nil(t, err)
+	verified, err := verifier.ValidateBeacon(decide, state)
+	assert.Nil(t, err)
+	assert.Equal(t, beacons[0].Randomness, verified.Randomness)
+
+	// <commit> messages without a valid VRF proof are rejected
+	m := new(Message)
+	m.Type = MessageType_Commit
+	m.Height = 1
+	m.Beacon = make([]byte, VRFProofSize)
+	signed := new(SignedProto)
+	signed.Sign(m, participants[0])
+	_, err = verifier.verifyCommitBeacon(m, signed)
+	assert.Equal(t, ErrCommitBeacon, err)
+
+	// the beacon is only defined on secp256k1
+	_, _, err = VRFProve(observer, beaconSeed(1))
+	assert.Nil(t, err)
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrVRFCurve, VerifyConfig(newConfig(p256, epoch)))
+}
+
+func TestWeightedQuorum(t *testing.T) {
+	// the first participant holds half of the stake
+	var participants []*ecdsa.PrivateKey
+	var coords []Identity
+	weights := []uint64{4, 1, 1, 1, 1}
+	for range weights {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	newConfig := func(privateKey *ecdsa.PrivateKey, epoch time.Time) *Config {
+		config := new(Config)
+		config.Epoch = epoch
+		config.PrivateKey = privateKey
+		config.Participants = coords
+		config.Weights = weights
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a State) bool { return true }
+		return config
+	}
+
+	// 5 of the total weight 8 is the quorum, which 2 of 5 participants hold
+	epoch := time.Now()
+	var peers []*IPCPeer
+	for i := 0; i < 2; i++ {
+		consensus, err := NewConsensus(newConfig(participants[i], epoch))
+		assert.Nil(t, err)
+		assert.Equal(t, 5, consensus.Quorum())
+		assert.Equal(t, weights[i], consensus.Weight(coords[i]))
+		consensus.SetLatency(50 * time.Millisecond)
+		peers = append(peers, NewIPCPeer(consensus, 10*time.Millisecond))
+	}
+	assert.True(t, peers[0].c.Join(peers[1]))
+	assert.True(t, peers[1].c.Join(peers[0]))
+	for i := range peers {
+		peers[i].Update()
+		data := make([]byte, 1024)
+		io.ReadFull(rand.Reader, data)
+		peers[i].Propose(data)
+	}
+	defer func() {
+		for i := range peers {
+			peers[i].Close()
+		}
+	}()
+
+	for i := range peers {
+		assert.Eventually(t, func() bool { h, _, _ := peers[i].GetLatestState(); return h > 0 }, 20*time.Second, 20*time.Millisecond)
+	}
+	peers[0].Lock()
+	_, _, state := peers[0].c.CurrentState()
+	decide, err := proto.Marshal(peers[0].c.CurrentProof())
+	peers[0].Unlock()
+	assert.Nil(t, err)
+
+	// the proof is verified by the weights, it's insufficient by count
+	observer, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	verifier, err := NewConsensus(newConfig(observer, epoch))
+	assert.Nil(t, err)
+	assert.Nil(t, verifier.ValidateDecideMessage(decide, state))
+	config := newConfig(observer, epoch)
+	config.Weights = nil
+	verifier, err = NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrDecideProofInsufficient, verifier.ValidateDecideMessage(decide, state))
+
+	// a weight for each participant
+	config.Weights = weights[1:]
+	assert.Equal(t, ErrConfigWeights, VerifyConfig(config))
+	config.Weights = []uint64{4, 1, 0, 1, 1}
+	assert.Equal(t, ErrConfigWeights, VerifyConfig(config))
+
+	// the total weight must not overflow, nor the quorum
+	config.Weights = []uint64{math.MaxUint64 - 2, 1, 1, 1, 1}
+	assert.Equal(t, ErrConfigWeights, VerifyConfig(config))
+	config.Weights = []uint64{math.MaxUint64 - 10, 1, 1, 1, 1}
+	assert.Equal(t, ErrConfigWeights, VerifyConfig(config))
+	config.Weights = []uint64{math.MaxInt64 / 2, 1, 1, 1, 1}
+	assert.Nil(t, VerifyConfig(config))
+}
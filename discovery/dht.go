@@ -0,0 +1,607 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/bits"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/crypto/blake2b"
+	"github.com/yonggewang/bdls/internal/identity"
+)
+
+const (
+	// DHTBucketSize is the k of Kademlia, the max contacts per bucket and
+	// the number of nodes a record is stored on
+	DHTBucketSize = 16
+	// DHTAlpha is the number of concurrent queries of a lookup
+	DHTAlpha = 3
+	// DHTRecordTTL is how long a record is kept after it's stored, peers
+	// should announce again well before it expires
+	DHTRecordTTL = 24 * time.Hour
+
+	// timeout of a single request
+	dhtRequestTimeout = 2 * time.Second
+	// max size of a message
+	dhtMaxPacketSize = 8192
+	// max number of addresses in a record
+	dhtMaxAddrs = 16
+	// max number of records stored for others
+	dhtMaxRecords = 65536
+)
+
+// Locator finds the addresses of a participant by it's public key, it's
+// the pluggable interface of key based discovery, implemented by DHT.
+type Locator interface {
+	FindPeer(ctx context.Context, pubkey *ecdsa.PublicKey) ([]string, error)
+}
+
+// message types
+const (
+	dhtPing      = "ping"
+	dhtPong      = "pong"
+	dhtFindNode  = "find_node"
+	dhtNodes     = "nodes"
+	dhtStore     = "store"
+	dhtStored    = "stored"
+	dhtFindValue = "find_value"
+	dhtValue     = "value"
+)
+
+// nodeID is the position of a node or a record in the DHT
+type nodeID [blake2b.Size256]byte
+
+// dhtKey returns the DHT key of a public key
+func dhtKey(pubkey *ecdsa.PublicKey) nodeID {
+	id := bdls.DefaultPubKeyToIdentity(pubkey)
+	return blake2b.Sum256(id[:])
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (id nodeID) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(id[:])), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (id *nodeID) UnmarshalText(text []byte) error {
+	bts, err := hex.DecodeString(string(text))
+	if err != nil || len(bts) != len(id) {
+		return ErrRecordInvalid
+	}
+	copy(id[:], bts)
+	return nil
+}
+
+// xor returns the distance between two ids
+func (id nodeID) xor(other nodeID) (d nodeID) {
+	for k := range id {
+		d[k] = id[k] ^ other[k]
+	}
+	return
+}
+
+// bucket returns the bucket index of other, the length of the common prefix
+func (id nodeID) bucket(other nodeID) int {
+	d := id.xor(other)
+	for k := range d {
+		if d[k] != 0 {
+			return k*8 + bits.LeadingZeros8(d[k])
+		}
+	}
+	return len(d)*8 - 1
+}
+
+// contact is a node in the routing table
+type contact struct {
+	ID   nodeID `json:"id"`
+	Addr string `json:"addr"` // UDP address
+}
+
+// Record is a signed announcement of the addresses of a participant
+type Record struct {
+	PublicKey string   `json:"pubkey"` // hex encoded X|Y
+	Addrs     []string `json:"addrs"`  // addresses to dial the participant's agent
+	Seq       uint64   `json:"seq"`    // newer records have larger seq
+	Signature []byte   `json:"sig"`    // ASN.1 ECDSA signature of the digest
+}
+
+// NewRecord creates a record of addrs signed by key
+func NewRecord(key *ecdsa.PrivateKey, addrs []string, seq uint64) (*Record, error) {
+	r := &Record{PublicKey: identity.Encode(&key.PublicKey), Addrs: addrs, Seq: seq}
+	sig, err := ecdsa.SignASN1(rand.Reader, key, r.digest())
+	if err != nil {
+		return nil, err
+	}
+	r.Signature = sig
+	return r, nil
+}
+
+// digest returns the hash to sign
+func (r *Record) digest() []byte {
+	hash, _ := blake2b.New256(nil)
+	hash.Write([]byte(r.PublicKey))
+	binary.Write(hash, binary.LittleEndian, r.Seq)
+	for _, addr := range r.Addrs {
+		binary.Write(hash, binary.LittleEndian, uint32(len(addr)))
+		hash.Write([]byte(addr))
+	}
+	return hash.Sum(nil)
+}
+
+// Verify verifies the signature and returns the public key of the record
+func (r *Record) Verify() (*ecdsa.PublicKey, error) {
+	pubkey, err := identity.Decode(r.PublicKey)
+	if err != nil || len(r.Addrs) > dhtMaxAddrs {
+		return nil, ErrRecordInvalid
+	}
+	if !ecdsa.VerifyASN1(pubkey, r.digest(), r.Signature) {
+		return nil, ErrRecordInvalid
+	}
+	return pubkey, nil
+}
+
+// dhtMessage is the message of the DHT protocol, encoded as JSON in a UDP
+// packet
+type dhtMessage struct {
+	Type     string    `json:"type"`
+	ID       uint64    `json:"id"`                 // request id, echoed in response
+	From     nodeID    `json:"from"`               // id of the sender
+	Target   *nodeID   `json:"target,omitempty"`   // find_node & find_value
+	Record   *Record   `json:"record,omitempty"`   // store & value
+	Contacts []contact `json:"contacts,omitempty"` // nodes & value
+}
+
+// storedRecord is a record with it's expiry
+type storedRecord struct {
+	record  *Record
+	expires time.Time
+}
+
+// DHT is a lightweight Kademlia DHT over UDP, participants announce
+// signed records of their addresses at the key of their public key, so
+// others can find them without centralized seed lists.
+//
+// Node ids are not authenticated, records are, so a malicious node could
+// withhold records but not forge them.
+type DHT struct {
+	conn    net.PacketConn
+	key     *ecdsa.PrivateKey
+	self    nodeID
+	buckets [len(nodeID{}) * 8][]contact
+
+	records map[nodeID]storedRecord
+	pending map[uint64]chan *dhtMessage
+	mu      sync.Mutex
+
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+// NewDHT creates a DHT node on conn, it's id is derived from the public
+// key of key, like the records.
+func NewDHT(conn net.PacketConn, key *ecdsa.PrivateKey) *DHT {
+	d := new(DHT)
+	d.conn = conn
+	d.key = key
+	d.self = dhtKey(&key.PublicKey)
+	d.records = make(map[nodeID]storedRecord)
+	d.pending = make(map[uint64]chan *dhtMessage)
+	d.die = make(chan struct{})
+	go d.recvLoop()
+	return d
+}
+
+// Addr returns the UDP address of this node
+func (d *DHT) Addr() net.Addr { return d.conn.LocalAddr() }
+
+// Close stops the DHT and closes the conn
+func (d *DHT) Close() error {
+	d.dieOnce.Do(func() { close(d.die) })
+	return d.conn.Close()
+}
+
+// Bootstrap joins the DHT through the nodes at addrs, and looks up this
+// node to fill the routing table, returns error if none of them answered.
+func (d *DHT) Bootstrap(ctx context.Context, addrs []string) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var lastErr error
+	joined := false
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			_, err := d.request(ctx, addr, &dhtMessage{Type: dhtPing})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lastErr = err
+			} else {
+				joined = true
+			}
+		}(addr)
+	}
+	wg.Wait()
+
+	if !joined {
+		if lastErr == nil {
+			lastErr = ErrNoAddress
+		}
+		return lastErr
+	}
+	d.lookup(ctx, d.self, false)
+	return nil
+}
+
+// Announce signs a record of addrs, and stores it on the nodes closest to
+// the public key of this node.
+func (d *DHT) Announce(ctx context.Context, addrs []string) error {
+	r, err := NewRecord(d.key, addrs, uint64(time.Now().UnixNano()))
+	if err != nil {
+		return err
+	}
+	d.store(r)
+
+	closest, _ := d.lookup(ctx, d.self, false)
+	var wg sync.WaitGroup
+	for _, c := range closest {
+		wg.Add(1)
+		go func(c contact) {
+			defer wg.Done()
+			d.request(ctx, c.Addr, &dhtMessage{Type: dhtStore, Record: r})
+		}(c)
+	}
+	wg.Wait()
+	return nil
+}
+
+// FindPeer implements Locator
+func (d *DHT) FindPeer(ctx context.Context, pubkey *ecdsa.PublicKey) ([]string, error) {
+	key := dhtKey(pubkey)
+	d.mu.Lock()
+	stored, ok := d.records[key]
+	d.mu.Unlock()
+	if ok && time.Now().Before(stored.expires) {
+		return stored.record.Addrs, nil
+	}
+
+	if _, r := d.lookup(ctx, key, true); r != nil {
+		return r.Addrs, nil
+	}
+	return nil, ErrPeerNotFound
+}
+
+// store keeps a verified record if it's newer
+func (d *DHT) store(r *Record) bool {
+	pubkey, err := r.Verify()
+	if err != nil {
+		return false
+	}
+
+	key := dhtKey(pubkey)
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	old, ok := d.records[key]
+	if ok && old.record.Seq > r.Seq && now.Before(old.expires) {
+		return false
+	}
+
+	if !ok && len(d.records) >= dhtMaxRecords {
+		for k, stored := range d.records {
+			if now.After(stored.expires) {
+				delete(d.records, k)
+			}
+		}
+		if len(d.records) >= dhtMaxRecords {
+			return false
+		}
+	}
+	d.records[key] = storedRecord{record: r, expires: now.Add(DHTRecordTTL)}
+	return true
+}
+
+// lookup iteratively queries the nodes closest to target, returns the
+// closest nodes found, or the record of target if findValue is set.
+func (d *DHT) lookup(ctx context.Context, target nodeID, findValue bool) ([]contact, *Record) {
+	type result struct {
+		from     contact
+		contacts []contact
+		record   *Record
+		err      error
+	}
+
+	shortlist := d.closest(target, DHTBucketSize)
+	queried := make(map[nodeID]bool)
+	failed := make(map[nodeID]bool)
+	var found *Record
+
+	for {
+		// the alpha closest nodes not queried
+		var batch []contact
+		for _, c := range shortlist {
+			if !queried[c.ID] && len(batch) < DHTAlpha {
+				batch = append(batch, c)
+			}
+		}
+		if len(batch) == 0 || found != nil {
+			break
+		}
+
+		ch := make(chan result, len(batch))
+		for _, c := range batch {
+			queried[c.ID] = true
+			go func(c contact) {
+				req := &dhtMessage{Type: dhtFindNode, Target: &target}
+				if findValue {
+					req.Type = dhtFindValue
+				}
+				resp, err := d.request(ctx, c.Addr, req)
+				if err != nil {
+					ch <- result{from: c, err: err}
+					return
+				}
+				ch <- result{from: c, contacts: resp.Contacts, record: resp.Record}
+			}(c)
+		}
+
+		for range batch {
+			r := <-ch
+			if r.err != nil {
+				failed[r.from.ID] = true
+				continue
+			}
+			if r.record != nil {
+				if pubkey, err := r.record.Verify(); err == nil && dhtKey(pubkey) == target {
+					if found == nil || r.record.Seq > found.Seq {
+						found = r.record
+					}
+				}
+			}
+			for _, c := range r.contacts {
+				if c.ID != d.self && !containsContact(shortlist, c.ID) {
+					shortlist = append(shortlist, c)
+				}
+			}
+		}
+
+		// keep the k closest live nodes
+		live := shortlist[:0]
+		for _, c := range shortlist {
+			if !failed[c.ID] {
+				live = append(live, c)
+			}
+		}
+		shortlist = live
+		sortByDistance(shortlist, target)
+		if len(shortlist) > DHTBucketSize {
+			shortlist = shortlist[:DHTBucketSize]
+		}
+	}
+
+	if found != nil {
+		d.store(found)
+	}
+	return shortlist, found
+}
+
+// closest returns the n contacts closest to target in the routing table
+func (d *DHT) closest(target nodeID, n int) []contact {
+	d.mu.Lock()
+	var all []contact
+	for _, bucket := range d.buckets {
+		all = append(all, bucket...)
+	}
+	d.mu.Unlock()
+
+	sortByDistance(all, target)
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// seen updates the routing table with a node that has been heard from,
+// known nodes are moved to the tail of their buckets, new nodes are
+// dropped if the bucket is full, as long-lived nodes are preferred.
+func (d *DHT) seen(c contact) {
+	if c.ID == d.self {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	idx := d.self.bucket(c.ID)
+	bucket := d.buckets[idx]
+	for k := range bucket {
+		if bucket[k].ID == c.ID {
+			bucket = append(bucket[:k], bucket[k+1:]...)
+			d.buckets[idx] = append(bucket, c)
+			return
+		}
+	}
+	if len(bucket) < DHTBucketSize {
+		d.buckets[idx] = append(bucket, c)
+	}
+}
+
+// request sends a request to addr and waits for the response
+func (d *DHT) request(ctx context.Context, addr string, req *dhtMessage) (*dhtMessage, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var id [8]byte
+	rand.Read(id[:])
+	req.ID = binary.LittleEndian.Uint64(id[:])
+	req.From = d.self
+
+	ch := make(chan *dhtMessage, 1)
+	d.mu.Lock()
+	d.pending[req.ID] = ch
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, req.ID)
+		d.mu.Unlock()
+	}()
+
+	if err := d.send(udpAddr, req); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(dhtRequestTimeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		d.seen(contact{ID: resp.From, Addr: udpAddr.String()})
+		return resp, nil
+	case <-timer.C:
+		return nil, ErrRequestTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-d.die:
+		return nil, ErrDHTClosed
+	}
+}
+
+// send encodes and sends a message
+func (d *DHT) send(addr net.Addr, m *dhtMessage) error {
+	bts, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = d.conn.WriteTo(bts, addr)
+	return err
+}
+
+// recvLoop receives messages, delivers responses and answers requests
+func (d *DHT) recvLoop() {
+	buf := make([]byte, dhtMaxPacketSize)
+	for {
+		n, from, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-d.die:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+
+		m := new(dhtMessage)
+		if err := json.Unmarshal(buf[:n], m); err != nil {
+			continue
+		}
+
+		switch m.Type {
+		case dhtPong, dhtNodes, dhtStored, dhtValue:
+			d.mu.Lock()
+			ch, ok := d.pending[m.ID]
+			d.mu.Unlock()
+			if ok {
+				select {
+				case ch <- m:
+				default:
+				}
+			}
+		default:
+			d.handleRequest(m, from)
+		}
+	}
+}
+
+// handleRequest answers a request
+func (d *DHT) handleRequest(req *dhtMessage, from net.Addr) {
+	resp := &dhtMessage{ID: req.ID, From: d.self}
+	switch req.Type {
+	case dhtPing:
+		resp.Type = dhtPong
+	case dhtFindNode, dhtFindValue:
+		if req.Target == nil {
+			return
+		}
+		resp.Type = dhtNodes
+		if req.Type == dhtFindValue {
+			d.mu.Lock()
+			stored, ok := d.records[*req.Target]
+			d.mu.Unlock()
+			if ok && time.Now().Before(stored.expires) {
+				resp.Type = dhtValue
+				resp.Record = stored.record
+			}
+		}
+		resp.Contacts = d.closest(*req.Target, DHTBucketSize)
+	case dhtStore:
+		if req.Record == nil {
+			return
+		}
+		resp.Type = dhtStored
+		d.store(req.Record)
+	default:
+		return
+	}
+
+	d.seen(contact{ID: req.From, Addr: from.String()})
+	d.send(from, resp)
+}
+
+// sortByDistance sorts contacts by the distance to target
+func sortByDistance(contacts []contact, target nodeID) {
+	sort.Slice(contacts, func(i, j int) bool {
+		di, dj := contacts[i].ID.xor(target), contacts[j].ID.xor(target)
+		return bytes.Compare(di[:], dj[:]) < 0
+	})
+}
+
+func containsContact(contacts []contact, id nodeID) bool {
+	for _, c := range contacts {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
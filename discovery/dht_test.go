@@ -0,0 +1,122 @@
+package discovery
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func newTestDHT(t *testing.T) (*DHT, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	d := NewDHT(conn, key)
+	t.Cleanup(func() { d.Close() })
+	return d, key
+}
+
+func TestNodeIDBucket(t *testing.T) {
+	var a, b nodeID
+	b[0] = 0x80
+	assert.Equal(t, 0, a.bucket(b))
+	b[0] = 0
+	b[1] = 0x01
+	assert.Equal(t, 15, a.bucket(b))
+	assert.Equal(t, 255, a.bucket(a))
+
+	text, err := b.MarshalText()
+	assert.Nil(t, err)
+	var c nodeID
+	assert.Nil(t, c.UnmarshalText(text))
+	assert.Equal(t, b, c)
+	assert.NotNil(t, c.UnmarshalText([]byte("00")))
+}
+
+func TestDHTFindPeer(t *testing.T) {
+	const n = 24
+	nodes := make([]*DHT, n)
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := range nodes {
+		nodes[i], keys[i] = newTestDHT(t)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// everyone joins through the first node
+	for i := 1; i < n; i++ {
+		assert.Nil(t, nodes[i].Bootstrap(ctx, []string{nodes[0].Addr().String()}))
+	}
+	for i := range nodes {
+		assert.Nil(t, nodes[i].Announce(ctx, []string{fmt.Sprintf("10.0.0.%v:4680", i)}))
+	}
+
+	for i := range nodes {
+		j := (i*7 + 3) % n
+		addrs, err := nodes[i].FindPeer(ctx, &keys[j].PublicKey)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{fmt.Sprintf("10.0.0.%v:4680", j)}, addrs)
+	}
+
+	// a newer announcement replaces the old one
+	assert.Nil(t, nodes[5].Announce(ctx, []string{"10.0.1.5:4680"}))
+	for _, i := range []int{1, 10, 20} {
+		// drop the cached record
+		nodes[i].mu.Lock()
+		delete(nodes[i].records, dhtKey(&keys[5].PublicKey))
+		nodes[i].mu.Unlock()
+		addrs, err := nodes[i].FindPeer(ctx, &keys[5].PublicKey)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"10.0.1.5:4680"}, addrs)
+	}
+
+	// unknown key
+	other, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	_, err = nodes[3].FindPeer(ctx, &other.PublicKey)
+	assert.Equal(t, ErrPeerNotFound, err)
+}
+
+func TestDHTRecordForged(t *testing.T) {
+	d, key := newTestDHT(t)
+	assert.Nil(t, d.Announce(context.Background(), []string{"10.0.0.1:4680"}))
+
+	d.mu.Lock()
+	r := *d.records[dhtKey(&key.PublicKey)].record
+	d.mu.Unlock()
+	_, err := r.Verify()
+	assert.Nil(t, err)
+
+	// tampered addresses
+	r.Addrs = []string{"10.6.6.6:4680"}
+	_, err = r.Verify()
+	assert.Equal(t, ErrRecordInvalid, err)
+	assert.False(t, d.store(&r))
+
+	// an older record doesn't replace the newer one
+	older, err := NewRecord(key, []string{"10.0.0.2:4680"}, r.Seq-1)
+	assert.Nil(t, err)
+	assert.False(t, d.store(older))
+	newer, err := NewRecord(key, []string{"10.0.0.2:4680"}, r.Seq+1)
+	assert.Nil(t, err)
+	assert.True(t, d.store(newer))
+}
+
+func TestDHTBootstrapFailed(t *testing.T) {
+	d, _ := newTestDHT(t)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	silent := conn.LocalAddr().String()
+	defer conn.Close()
+
+	err = d.Bootstrap(context.Background(), []string{silent})
+	assert.Equal(t, ErrRequestTimeout, err)
+}
@@ -0,0 +1,181 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package discovery
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPort is the port for TXT entries without one
+const DefaultPort = "4680"
+
+// Resolver looks up DNS records, net.DefaultResolver implements it.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNSSeed resolves a set of DNS seeds to peer addresses.
+//
+// A seed name starting with an underscore, like _bdls._tcp.example.com, is
+// resolved as SRV records, other names as TXT records, each containing
+// addresses separated by commas or spaces.
+type DNSSeed struct {
+	Names       []string // the seed names
+	Resolver    Resolver // (optional) defaults to net.DefaultResolver
+	DefaultPort string   // (optional) defaults to DefaultPort
+}
+
+// NewDNSSeed creates a DNSSeed for names with the default resolver
+func NewDNSSeed(names ...string) *DNSSeed {
+	return &DNSSeed{Names: names}
+}
+
+// Resolve looks up all seeds and returns the deduplicated addresses, a
+// seed failing to resolve is skipped as long as others succeed.
+func (s *DNSSeed) Resolve(ctx context.Context) ([]string, error) {
+	if len(s.Names) == 0 {
+		return nil, ErrNoSeeds
+	}
+
+	var addrs []string
+	var lastErr error
+	seen := make(map[string]bool)
+	for _, name := range s.Names {
+		resolved, err := s.resolve(ctx, name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, addr := range resolved {
+			if !seen[addr] {
+				seen[addr] = true
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+
+	if len(addrs) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, ErrNoAddress
+	}
+	return addrs, nil
+}
+
+// resolve looks up a single seed
+func (s *DNSSeed) resolve(ctx context.Context, name string) ([]string, error) {
+	resolver := s.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	if strings.HasPrefix(name, "_") {
+		_, records, err := resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+
+		var addrs []string
+		for _, r := range records {
+			target := strings.TrimSuffix(r.Target, ".")
+			if target == "" {
+				continue
+			}
+			addrs = append(addrs, net.JoinHostPort(target, strconv.Itoa(int(r.Port))))
+		}
+		return addrs, nil
+	}
+
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	port := s.DefaultPort
+	if port == "" {
+		port = DefaultPort
+	}
+
+	var addrs []string
+	for _, r := range records {
+		for _, entry := range strings.FieldsFunc(r, func(c rune) bool { return c == ',' || c == ' ' || c == '\t' }) {
+			if _, _, err := net.SplitHostPort(entry); err != nil {
+				// bare host or IPv6 address without port
+				entry = net.JoinHostPort(strings.Trim(entry, "[]"), port)
+				if _, _, err := net.SplitHostPort(entry); err != nil {
+					continue
+				}
+			}
+			addrs = append(addrs, entry)
+		}
+	}
+	return addrs, nil
+}
+
+// Bootstrap resolves the seeds and feeds each address to add, which is
+// usually TCPAgent.AddPersistentPeer, returns the number of addresses
+// accepted by add.
+func (s *DNSSeed) Bootstrap(ctx context.Context, add func(addr string) bool) (int, error) {
+	addrs, err := s.Resolve(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, addr := range addrs {
+		if add(addr) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Run bootstraps from the seeds at every interval until ctx is done, so
+// peers added to the seeds later are discovered too. Addresses already
+// known are expected to be rejected by add.
+func (s *DNSSeed) Run(ctx context.Context, interval time.Duration, add func(addr string) bool) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.Bootstrap(ctx, add)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
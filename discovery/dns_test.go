@@ -0,0 +1,135 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errNotFound = errors.New("not found")
+
+type fakeResolver struct {
+	sync.Mutex
+	txt map[string][]string
+	srv map[string][]*net.SRV
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r.Lock()
+	defer r.Unlock()
+	if records, ok := r.txt[name]; ok {
+		return records, nil
+	}
+	return nil, errNotFound
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if records, ok := r.srv[name]; ok {
+		return name, records, nil
+	}
+	return "", nil, errNotFound
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{
+		txt: map[string][]string{
+			"seed.example.com":  {"10.0.0.1:4680, 10.0.0.2", "[::1]:4681 fe80::1"},
+			"seed2.example.com": {"10.0.0.1:4680"},
+		},
+		srv: map[string][]*net.SRV{
+			"_bdls._tcp.example.com": {
+				{Target: "node1.example.com.", Port: 4690},
+				{Target: "node2.example.com.", Port: 4691},
+				{Target: ".", Port: 0},
+			},
+		},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	seed := &DNSSeed{
+		Names:    []string{"seed.example.com", "seed2.example.com", "_bdls._tcp.example.com", "missing.example.com"},
+		Resolver: newFakeResolver(),
+	}
+
+	addrs, err := seed.Resolve(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"10.0.0.1:4680",
+		"10.0.0.2:4680",
+		"[::1]:4681",
+		"[fe80::1]:4680",
+		"node1.example.com:4690",
+		"node2.example.com:4691",
+	}, addrs)
+
+	seed.DefaultPort = "9000"
+	addrs, err = seed.Resolve(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2:9000", addrs[1])
+}
+
+func TestResolveErrors(t *testing.T) {
+	_, err := (&DNSSeed{Resolver: newFakeResolver()}).Resolve(context.Background())
+	assert.Equal(t, ErrNoSeeds, err)
+
+	_, err = (&DNSSeed{Names: []string{"missing.example.com"}, Resolver: newFakeResolver()}).Resolve(context.Background())
+	assert.Equal(t, errNotFound, err)
+
+	r := newFakeResolver()
+	r.txt["empty.example.com"] = []string{""}
+	_, err = (&DNSSeed{Names: []string{"empty.example.com"}, Resolver: r}).Resolve(context.Background())
+	assert.Equal(t, ErrNoAddress, err)
+}
+
+func TestBootstrap(t *testing.T) {
+	r := newFakeResolver()
+	seed := &DNSSeed{Names: []string{"seed2.example.com"}, Resolver: r}
+
+	known := make(map[string]bool)
+	add := func(addr string) bool {
+		if known[addr] {
+			return false
+		}
+		known[addr] = true
+		return true
+	}
+
+	n, err := seed.Bootstrap(context.Background(), add)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	// known addresses are rejected
+	n, err = seed.Bootstrap(context.Background(), add)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	// Run discovers addresses added to the seed later
+	ctx, cancel := context.WithCancel(context.Background())
+	chAdded := make(chan string, 8)
+	done := make(chan error)
+	go func() {
+		done <- seed.Run(ctx, 10*time.Millisecond, func(addr string) bool {
+			if addr == "10.0.0.3:4680" {
+				chAdded <- addr
+			}
+			return true
+		})
+	}()
+	<-time.After(30 * time.Millisecond)
+	r.Lock()
+	r.txt["seed2.example.com"] = []string{"10.0.0.1:4680,10.0.0.3"}
+	r.Unlock()
+	select {
+	case <-chAdded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("new seed address not discovered")
+	}
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
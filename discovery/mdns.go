@@ -0,0 +1,137 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package discovery
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/libp2p/zeroconf/v2"
+	"github.com/yonggewang/bdls/internal/identity"
+)
+
+const (
+	// MDNSService is the DNS-SD service type agents advertise on LANs
+	MDNSService = "_bdls._tcp"
+	// MDNSDomain is the mDNS domain
+	MDNSDomain = "local."
+
+	// the TXT key of the advertised public key
+	mdnsPublicKey = "pubkey="
+	// the length of the identity prefix as the instance name
+	mdnsInstanceLength = 16
+)
+
+// MDNSPeer is a peer found on the LAN
+type MDNSPeer struct {
+	Addrs     []string         // host:port addresses, IPv4 first
+	PublicKey *ecdsa.PublicKey // the advertised public key
+}
+
+// MDNSResponder advertises an agent on the LAN with mDNS, it's opt-in and
+// meant for test clusters and private networks.
+type MDNSResponder struct {
+	server *zeroconf.Server
+}
+
+// AdvertiseMDNS starts answering mDNS queries for MDNSService with the
+// listening port and public key of an agent on all multicast interfaces.
+func AdvertiseMDNS(pubkey *ecdsa.PublicKey, port int) (*MDNSResponder, error) {
+	text := identity.Encode(pubkey)
+	server, err := zeroconf.Register(text[:mdnsInstanceLength], MDNSService, MDNSDomain, port, []string{mdnsPublicKey + text}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &MDNSResponder{server: server}, nil
+}
+
+// Close stops advertising
+func (r *MDNSResponder) Close() {
+	r.server.Shutdown()
+}
+
+// BrowseMDNS looks for agents on the LAN until ctx is done, found is
+// called for every answer with a valid public key, including repeated
+// answers of the same agent and the answers of this agent itself, so it
+// should ignore known public keys. found is called from one goroutine.
+func BrowseMDNS(ctx context.Context, found func(peer *MDNSPeer)) error {
+	entries := make(chan *zeroconf.ServiceEntry)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for entry := range entries {
+			if peer := parseMDNSEntry(entry); peer != nil {
+				found(peer)
+			}
+		}
+	}()
+
+	err := zeroconf.Browse(ctx, MDNSService, MDNSDomain, entries)
+	if err != nil {
+		return err
+	}
+	<-done
+	return ctx.Err()
+}
+
+// parseMDNSEntry converts a service entry to a peer, returns nil if the
+// entry has no address or valid public key
+func parseMDNSEntry(entry *zeroconf.ServiceEntry) *MDNSPeer {
+	peer := new(MDNSPeer)
+	for _, text := range entry.Text {
+		if strings.HasPrefix(text, mdnsPublicKey) {
+			if pubkey, err := identity.Decode(strings.TrimPrefix(text, mdnsPublicKey)); err == nil {
+				peer.PublicKey = pubkey
+			}
+		}
+	}
+	if peer.PublicKey == nil || entry.Port <= 0 {
+		return nil
+	}
+
+	port := strconv.Itoa(entry.Port)
+	for _, ip := range entry.AddrIPv4 {
+		peer.Addrs = append(peer.Addrs, net.JoinHostPort(ip.String(), port))
+	}
+	for _, ip := range entry.AddrIPv6 {
+		// link-local addresses need a zone we don't know
+		if !ip.IsLinkLocalUnicast() {
+			peer.Addrs = append(peer.Addrs, net.JoinHostPort(ip.String(), port))
+		}
+	}
+	if len(peer.Addrs) == 0 {
+		return nil
+	}
+	return peer
+}
@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libp2p/zeroconf/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/internal/identity"
+)
+
+func TestParseMDNSEntry(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	entry := &zeroconf.ServiceEntry{
+		Port:     4680,
+		Text:     []string{"other=1", mdnsPublicKey + identity.Encode(&key.PublicKey)},
+		AddrIPv4: []net.IP{net.ParseIP("192.168.1.2")},
+		AddrIPv6: []net.IP{net.ParseIP("fe80::1"), net.ParseIP("fd00::2")},
+	}
+	peer := parseMDNSEntry(entry)
+	assert.NotNil(t, peer)
+	assert.True(t, identity.Equal(&key.PublicKey, peer.PublicKey))
+	assert.Equal(t, []string{"192.168.1.2:4680", "[fd00::2]:4680"}, peer.Addrs)
+
+	// invalid public key
+	entry.Text = []string{mdnsPublicKey + "00"}
+	assert.Nil(t, parseMDNSEntry(entry))
+
+	// no usable address
+	entry.Text = []string{mdnsPublicKey + identity.Encode(&key.PublicKey)}
+	entry.AddrIPv4 = nil
+	entry.AddrIPv6 = []net.IP{net.ParseIP("fe80::1")}
+	assert.Nil(t, parseMDNSEntry(entry))
+}
+
+func TestMDNS(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping mDNS on multicast interfaces in short mode")
+	}
+
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	responder, err := AdvertiseMDNS(&key.PublicKey, 4680)
+	if err != nil {
+		t.Skip("no multicast interface:", err)
+	}
+	defer responder.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	chFound := make(chan *MDNSPeer, 16)
+	go BrowseMDNS(ctx, func(peer *MDNSPeer) {
+		if identity.Equal(peer.PublicKey, &key.PublicKey) {
+			chFound <- peer
+		}
+	})
+
+	select {
+	case peer := <-chFound:
+		assert.NotEmpty(t, peer.Addrs)
+	case <-ctx.Done():
+		t.Fatal("advertised agent not found")
+	}
+}
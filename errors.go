@@ -39,8 +39,15 @@ var (
 	ErrConfigStateCompare       = errors.New("Config.StateCompare function has not set")
 	ErrConfigStateValidate      = errors.New("Config.StateValidate function has not set")
 	ErrConfigPrivateKey         = errors.New("Config.PrivateKey has not set")
+	ErrConfigVerifier           = errors.New("Config.Verifier has not set for Config.Signer")
 	ErrConfigParticipants       = errors.New("Config.Participants must contain at least 4 participants")
 	ErrConfigPubKeyToCoordinate = errors.New("Config.must contain at least 4 participants")
+	ErrConfigWeights            = errors.New("Config.Weights must have a positive weight for each participant")
+	ErrConfigExperimental       = errors.New("Config.ExperimentalBN256 must be set to enable the BLS or threshold signatures")
+	ErrConfigBLSPublicKeys      = errors.New("Config.BLSPublicKeys must have a BLS public key for each participant")
+	ErrConfigBLSBeacon          = errors.New("Config.BLSPublicKeys can't be set with Config.EnableBeacon")
+	ErrConfigThreshold          = errors.New("Config.ThresholdPublicKey must have a share for each participant, and a threshold of at least 2t+1")
+	ErrConfigThresholdMode      = errors.New("Config.ThresholdPublicKey can't be set with Config.Weights, Config.BLSPublicKeys or Config.EnableBeacon")
 
 	// common errors related to every message
 	ErrMessageVersion            = errors.New("the message has different version")
@@ -108,4 +115,27 @@ var (
 
 	// <decide> verification
 	ErrMismatchedTargetState = errors.New("the state in <decide> message does not match the provided target state")
+
+	// beacon related
+	ErrCommitBeacon   = errors.New("the beacon in <commit> message has an invalid VRF proof")
+	ErrBeaconNotFound = errors.New("no beacon has been decided")
+	ErrBeaconMessage  = errors.New("the beacon is not derived from a <decide> message")
+
+	// BLS related
+	ErrCommitBLSSignature = errors.New("the <commit> message has an invalid BLS signature")
+	ErrDecideBLSSignature = errors.New("the <decide> message has an invalid aggregated BLS signature")
+
+	// threshold signature related
+	ErrDecideThresholdSignature = errors.New("the <decide> message has an invalid threshold signature")
+
+	// snapshot related
+	ErrSnapshotVersion  = errors.New("the snapshot has an unsupported version")
+	ErrSnapshotIdentity = errors.New("the snapshot is of another participant")
+	ErrSnapshotMessage  = errors.New("the snapshot has an inconsistent message")
+
+	// VRF related
+	ErrVRFCurve       = errors.New("the VRF is only defined on secp256k1")
+	ErrVRFPublicKey   = errors.New("the public key of the VRF proof is not on the curve")
+	ErrVRFProof       = errors.New("the VRF proof is invalid")
+	ErrVRFHashToCurve = errors.New("the VRF input cannot be hashed to the curve")
 )
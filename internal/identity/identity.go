@@ -0,0 +1,86 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package identity encodes the public keys of participants as text, the
+// same X|Y layout as bdls.Identity in hex, for configs and metadata shared
+// by the agents and tools of this module.
+package identity
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/yonggewang/bdls"
+)
+
+// ErrPublicKey is returned if the text is not a public key on bdls.S256Curve
+var ErrPublicKey = errors.New("invalid public key")
+
+// Encode encodes pubkey as hex of X|Y
+func Encode(pubkey *ecdsa.PublicKey) string {
+	id := bdls.DefaultPubKeyToIdentity(pubkey)
+	return hex.EncodeToString(id[:])
+}
+
+// Decode decodes a public key encoded by Encode, or the hex of a SEC1
+// encoded key as used by Bitcoin & Ethereum tools, with an optional 0x
+// prefix, and verifies it's on bdls.S256Curve
+func Decode(s string) (*ecdsa.PublicKey, error) {
+	bts, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, ErrPublicKey
+	}
+	if len(bts) != 2*bdls.SizeAxis {
+		pubkey, err := bdls.ParseSecp256k1PublicKey(bts)
+		if err != nil {
+			return nil, ErrPublicKey
+		}
+		return pubkey, nil
+	}
+
+	pubkey := &ecdsa.PublicKey{Curve: bdls.S256Curve}
+	pubkey.X = new(big.Int).SetBytes(bts[:bdls.SizeAxis])
+	pubkey.Y = new(big.Int).SetBytes(bts[bdls.SizeAxis:])
+	if !pubkey.Curve.IsOnCurve(pubkey.X, pubkey.Y) {
+		return nil, ErrPublicKey
+	}
+	return pubkey, nil
+}
+
+// Equal compares two public keys, nil keys are only equal to nil
+func Equal(a *ecdsa.PublicKey, b *ecdsa.PublicKey) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.X.Cmp(b.X) == 0 && a.Y.Cmp(b.Y) == 0
+}
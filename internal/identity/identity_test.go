@@ -0,0 +1,61 @@
+package identity
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	s := Encode(&key.PublicKey)
+	assert.Equal(t, 4*bdls.SizeAxis, len(s))
+	pubkey, err := Decode(s)
+	assert.Nil(t, err)
+	assert.True(t, Equal(&key.PublicKey, pubkey))
+
+	_, err = Decode("00")
+	assert.Equal(t, ErrPublicKey, err)
+	_, err = Decode(strings.Repeat("zz", 2*bdls.SizeAxis))
+	assert.Equal(t, ErrPublicKey, err)
+	_, err = Decode(strings.Repeat("01", 2*bdls.SizeAxis))
+	assert.Equal(t, ErrPublicKey, err)
+
+	assert.True(t, Equal(nil, nil))
+	assert.False(t, Equal(&key.PublicKey, nil))
+}
+
+func TestDecodeSEC1(t *testing.T) {
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	compressed := bdls.CompressSecp256k1PublicKey(&key.PublicKey)
+	uncompressed := append([]byte{0x04}, hexToBytes(t, Encode(&key.PublicKey))...)
+	for _, s := range []string{
+		hex.EncodeToString(compressed),
+		"0x" + hex.EncodeToString(compressed),
+		"0x" + hex.EncodeToString(uncompressed),
+		"0x" + Encode(&key.PublicKey),
+	} {
+		pubkey, err := Decode(s)
+		assert.Nil(t, err)
+		assert.True(t, Equal(&key.PublicKey, pubkey))
+	}
+
+	compressed[0] = 0x05
+	_, err = Decode(hex.EncodeToString(compressed))
+	assert.Equal(t, ErrPublicKey, err)
+}
+
+func hexToBytes(t *testing.T, s string) []byte {
+	bts, err := hex.DecodeString(s)
+	assert.Nil(t, err)
+	return bts
+}
@@ -75,7 +75,7 @@ func NewIPCPeer(c *Consensus, latency time.Duration) *IPCPeer {
 }
 
 // GetPublicKey returns peer's public key as identity
-func (p *IPCPeer) GetPublicKey() *ecdsa.PublicKey { return &p.c.privateKey.PublicKey }
+func (p *IPCPeer) GetPublicKey() *ecdsa.PublicKey { return p.c.publicKey }
 
 // RemoteAddr implements Peer.RemoteAddr, the address is p's memory address
 func (p *IPCPeer) RemoteAddr() net.Addr { return fakeAddress(fmt.Sprint(unsafe.Pointer(p))) }
@@ -95,10 +95,10 @@ func (p *IPCPeer) GetBytesCount() int64 {
 }
 
 // Propose a state, awaiting to be finalized at next height.
-func (p *IPCPeer) Propose(s State) {
+func (p *IPCPeer) Propose(s State) error {
 	p.Lock()
 	defer p.Unlock()
-	p.c.Propose(s)
+	return p.c.Propose(s)
 }
 
 // GetLatestState returns latest state
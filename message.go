@@ -31,7 +31,6 @@ package bdls
 import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
@@ -165,48 +164,46 @@ func (sp *SignedProto) Hash() []byte {
 
 // Sign the message with a private key
 func (sp *SignedProto) Sign(m *Message, privateKey *ecdsa.PrivateKey) {
+	if err := sp.SignWith(m, NewECDSASigner(privateKey)); err != nil {
+		panic(err)
+	}
+}
+
+// SignWith signs the message with the signer, by SignMessage if it's a
+// MessageSigner
+func (sp *SignedProto) SignWith(m *Message, signer Signer) error {
 	bts, err := proto.Marshal(m)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	// hash message
 	sp.Version = ProtocolVersion
 	sp.Message = bts
-
-	err = sp.X.Unmarshal(privateKey.PublicKey.X.Bytes())
-	if err != nil {
-		panic(err)
+	sp.X, sp.Y = signer.PublicKey()
+
+	// sign the message, or it's hash
+	var r, s []byte
+	if ms, ok := signer.(MessageSigner); ok {
+		r, s, err = ms.SignMessage(sp)
+	} else {
+		r, s, err = signer.Sign(sp.Hash())
 	}
-	err = sp.Y.Unmarshal(privateKey.PublicKey.Y.Bytes())
 	if err != nil {
-		panic(err)
+		return err
 	}
-	hash := sp.Hash()
-
-	// sign the message
-	r, s, err := ecdsa.Sign(rand.Reader, privateKey, hash)
-	if err != nil {
-		panic(err)
-	}
-	sp.R = r.Bytes()
-	sp.S = s.Bytes()
+	sp.R = r
+	sp.S = s
+	return nil
 }
 
-// Verify the signature of this signed message
+// Verify the ECDSA signature of this signed message
 func (sp *SignedProto) Verify(curve elliptic.Curve) bool {
-	var X, Y, R, S big.Int
-	hash := sp.Hash()
-	// verify against public key and r, s
-	pubkey := ecdsa.PublicKey{}
-	pubkey.Curve = curve
-	pubkey.X = &X
-	pubkey.Y = &Y
-	X.SetBytes(sp.X[:])
-	Y.SetBytes(sp.Y[:])
-	R.SetBytes(sp.R[:])
-	S.SetBytes(sp.S[:])
-
-	return ecdsa.Verify(&pubkey, hash, &R, &S)
+	return sp.VerifyWith(ECDSAVerifier{Curve: curve})
+}
+
+// VerifyWith verifies the signature of this signed message with the verifier
+func (sp *SignedProto) VerifyWith(verifier Verifier) bool {
+	return verifier.Verify(sp.X, sp.Y, sp.Hash(), sp.R, sp.S)
 }
 
 // PublicKey returns the public key of this signed message
@@ -165,10 +165,19 @@ type Message struct {
 	// Proofs related
 	Proof []*SignedProto `protobuf:"bytes,5,rep,name=Proof,proto3" json:"Proof,omitempty"`
 	// for lock-release, it's an embeded <lock> message
-	LockRelease          *SignedProto `protobuf:"bytes,6,opt,name=LockRelease,proto3" json:"LockRelease,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
-	XXX_unrecognized     []byte       `json:"-"`
-	XXX_sizecache        int32        `json:"-"`
+	LockRelease *SignedProto `protobuf:"bytes,6,opt,name=LockRelease,proto3" json:"LockRelease,omitempty"`
+	// for commit, the VRF proof of the signer over the beacon seed of the
+	// height, if the beacon is enabled
+	Beacon []byte `protobuf:"bytes,7,opt,name=Beacon,proto3" json:"Beacon,omitempty"`
+	// for commit, the BLS signature or the partial threshold signature of the
+	// signer over the state, and for decide, the aggregated BLS signature of
+	// the signers, or the threshold signature, if either is enabled
+	BLSSignature []byte `protobuf:"bytes,8,opt,name=BLSSignature,proto3" json:"BLSSignature,omitempty"`
+	// for decide, the bitmap of the participants aggregated in BLSSignature
+	Signers              []byte   `protobuf:"bytes,9,opt,name=Signers,proto3" json:"Signers,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *Message) Reset()         { *m = Message{} }
@@ -246,6 +255,27 @@ func (m *Message) GetLockRelease() *SignedProto {
 	return nil
 }
 
+func (m *Message) GetBeacon() []byte {
+	if m != nil {
+		return m.Beacon
+	}
+	return nil
+}
+
+func (m *Message) GetBLSSignature() []byte {
+	if m != nil {
+		return m.BLSSignature
+	}
+	return nil
+}
+
+func (m *Message) GetSigners() []byte {
+	if m != nil {
+		return m.Signers
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("bdls.MessageType", MessageType_name, MessageType_value)
 	proto.RegisterType((*SignedProto)(nil), "bdls.SignedProto")
@@ -255,31 +285,34 @@ func init() {
 func init() { proto.RegisterFile("message.proto", fileDescriptor_33c57e4bae7b9afd) }
 
 var fileDescriptor_33c57e4bae7b9afd = []byte{
-	// 381 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x92, 0xcd, 0xaa, 0xda, 0x40,
-	0x14, 0xc7, 0x1d, 0xf3, 0x61, 0x39, 0xd1, 0x76, 0x3a, 0x94, 0x32, 0x74, 0xa1, 0x41, 0x28, 0x95,
-	0x42, 0x23, 0xd4, 0x27, 0xa8, 0x76, 0x51, 0xe8, 0x07, 0x32, 0xf6, 0x05, 0xf2, 0x71, 0x8c, 0xa1,
-	0x26, 0x23, 0x99, 0xa4, 0x98, 0xc7, 0xe9, 0xdb, 0xb8, 0x2c, 0x5d, 0x76, 0x21, 0x17, 0x9f, 0xe4,
-	0x32, 0x13, 0xbd, 0x64, 0x71, 0xef, 0xee, 0xfc, 0xce, 0xff, 0x7f, 0xce, 0xf9, 0x27, 0x0c, 0x8c,
-	0x72, 0x54, 0x2a, 0x4c, 0x31, 0x38, 0x94, 0xb2, 0x92, 0xcc, 0x8e, 0x92, 0xbd, 0x7a, 0xf3, 0x21,
-	0xcd, 0xaa, 0x5d, 0x1d, 0x05, 0xb1, 0xcc, 0xe7, 0xa9, 0x4c, 0xe5, 0xdc, 0x88, 0x51, 0xbd, 0x35,
-	0x64, 0xc0, 0x54, 0xed, 0xd0, 0xf4, 0x0f, 0x01, 0x6f, 0x93, 0xa5, 0x05, 0x26, 0x6b, 0xb3, 0x84,
-	0xc3, 0xe0, 0x37, 0x96, 0x2a, 0x93, 0x05, 0x27, 0x3e, 0x99, 0x8d, 0xc4, 0x0d, 0xb5, 0xf2, 0xbd,
-	0xbd, 0xc7, 0xfb, 0x3e, 0x99, 0x0d, 0xc5, 0x0d, 0x99, 0x0f, 0xe4, 0xc8, 0x2d, 0xdd, 0x5b, 0xb2,
-	0xd3, 0x79, 0xd2, 0xfb, 0x7f, 0x9e, 0xc0, 0xba, 0x8e, 0xbe, 0x62, 0xf3, 0xe9, 0x98, 0x29, 0x41,
-	0x8e, 0xda, 0xd1, 0x70, 0xfb, 0x69, 0x47, 0xc3, 0x86, 0x40, 0x4a, 0xee, 0x98, 0xbd, 0xa4, 0xd4,
-	0xa4, 0xb8, 0xdb, 0x92, 0x9a, 0xfe, 0x23, 0x0f, 0xa7, 0xd9, 0x5b, 0xb0, 0x7f, 0x36, 0x07, 0x34,
-	0xe1, 0x9e, 0x7f, 0x7c, 0x19, 0xe8, 0x6f, 0x0e, 0xae, 0xa2, 0x16, 0x84, 0x91, 0xd9, 0x6b, 0x70,
-	0xbf, 0x60, 0x96, 0xee, 0x2a, 0x93, 0xd5, 0x16, 0x57, 0x62, 0xaf, 0xc0, 0x11, 0xb2, 0x2e, 0x12,
-	0x13, 0xd7, 0x16, 0x2d, 0xe8, 0xee, 0xa6, 0x0a, 0x2b, 0x6c, 0x23, 0x8a, 0x16, 0xd8, 0x3b, 0x70,
-	0xd6, 0xa5, 0x94, 0x5b, 0xee, 0xf8, 0xd6, 0xcc, 0xbb, 0xdd, 0xea, 0xfc, 0x2c, 0xd1, 0xea, 0x6c,
-	0x01, 0xde, 0x37, 0x19, 0xff, 0x12, 0xb8, 0xc7, 0x50, 0xa1, 0xc9, 0xfd, 0xa8, 0xbd, 0xeb, 0x7a,
-	0x5f, 0x82, 0xd7, 0x89, 0xcd, 0x06, 0x60, 0xfd, 0x90, 0x07, 0xda, 0x63, 0x2f, 0xc0, 0x33, 0xa1,
-	0x56, 0xbb, 0xb0, 0x48, 0x91, 0x12, 0xf6, 0x0c, 0x6c, 0x3d, 0x47, 0xfb, 0x0c, 0xc0, 0xdd, 0xe0,
-	0x1e, 0xe3, 0x8a, 0x5a, 0xba, 0x5e, 0xc9, 0x3c, 0xcf, 0x2a, 0x6a, 0xeb, 0x91, 0xce, 0x66, 0xea,
-	0x68, 0xf1, 0x33, 0xc6, 0x59, 0x82, 0xd4, 0xd5, 0xb5, 0x40, 0xd5, 0x14, 0x31, 0x1d, 0x2c, 0x87,
-	0xa7, 0xcb, 0x98, 0xfc, 0xbd, 0x8c, 0xc9, 0xdd, 0x65, 0x4c, 0x22, 0xd7, 0xbc, 0x80, 0xc5, 0x7d,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0x43, 0xc3, 0x64, 0x6c, 0x47, 0x02, 0x00, 0x00,
+	// 417 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x92, 0xcd, 0x8a, 0x13, 0x41,
+	0x10, 0xc7, 0xb7, 0x93, 0x99, 0xc9, 0x5a, 0x93, 0xd5, 0xb6, 0x11, 0x69, 0x3c, 0x64, 0x43, 0x40,
+	0x0c, 0x82, 0x59, 0x70, 0x9f, 0xc0, 0xac, 0x07, 0xc1, 0x55, 0x42, 0xc7, 0x17, 0x98, 0x99, 0xd4,
+	0x4e, 0x06, 0x93, 0xe9, 0xd0, 0xdd, 0x23, 0x99, 0xc7, 0xf1, 0xe6, 0xa3, 0xec, 0xd1, 0xb3, 0x87,
+	0x20, 0x79, 0x12, 0xe9, 0xea, 0x44, 0x22, 0xb8, 0xb7, 0xfa, 0xd5, 0xbf, 0x3e, 0xfe, 0xfd, 0x01,
+	0x17, 0x6b, 0xb4, 0x36, 0x2b, 0x71, 0xb2, 0x31, 0xda, 0x69, 0x11, 0xe5, 0x8b, 0x95, 0x7d, 0xf1,
+	0xa6, 0xac, 0xdc, 0xb2, 0xc9, 0x27, 0x85, 0x5e, 0x5f, 0x95, 0xba, 0xd4, 0x57, 0x24, 0xe6, 0xcd,
+	0x1d, 0x11, 0x01, 0x45, 0xa1, 0x69, 0xf4, 0x9d, 0x41, 0x3a, 0xaf, 0xca, 0x1a, 0x17, 0x33, 0x1a,
+	0x22, 0xa1, 0xf7, 0x0d, 0x8d, 0xad, 0x74, 0x2d, 0xd9, 0x90, 0x8d, 0x2f, 0xd4, 0x11, 0xbd, 0xf2,
+	0x29, 0xec, 0x93, 0x9d, 0x21, 0x1b, 0xf7, 0xd5, 0x11, 0xc5, 0x10, 0xd8, 0x56, 0x76, 0x7d, 0x6e,
+	0x2a, 0xee, 0x77, 0x97, 0x67, 0xbf, 0x76, 0x97, 0x30, 0x6b, 0xf2, 0x8f, 0xd8, 0xbe, 0xdb, 0x56,
+	0x56, 0xb1, 0xad, 0xaf, 0x68, 0x65, 0xf4, 0x70, 0x45, 0x2b, 0xfa, 0xc0, 0x8c, 0x8c, 0x69, 0x2e,
+	0x33, 0x9e, 0xac, 0x4c, 0x02, 0xd9, 0xd1, 0x8f, 0xce, 0xdf, 0xd5, 0xe2, 0x25, 0x44, 0x5f, 0xda,
+	0x0d, 0x92, 0xb9, 0xc7, 0x6f, 0x9f, 0x4e, 0xfc, 0x99, 0x27, 0x07, 0xd1, 0x0b, 0x8a, 0x64, 0xf1,
+	0x1c, 0x92, 0x0f, 0x58, 0x95, 0x4b, 0x47, 0x5e, 0x23, 0x75, 0x20, 0xf1, 0x0c, 0x62, 0xa5, 0x9b,
+	0x7a, 0x41, 0x76, 0x23, 0x15, 0xc0, 0x67, 0xe7, 0x2e, 0x73, 0x18, 0x2c, 0xaa, 0x00, 0xe2, 0x15,
+	0xc4, 0x33, 0xa3, 0xf5, 0x9d, 0x8c, 0x87, 0xdd, 0x71, 0x7a, 0xdc, 0x75, 0x72, 0x59, 0x2a, 0xe8,
+	0xe2, 0x1a, 0xd2, 0x5b, 0x5d, 0x7c, 0x55, 0xb8, 0xc2, 0xcc, 0x22, 0xf9, 0xfe, 0x6f, 0xf9, 0x69,
+	0x95, 0x77, 0x38, 0xc5, 0xac, 0xd0, 0xb5, 0xec, 0xd1, 0xd2, 0x03, 0x89, 0x11, 0xf4, 0xa7, 0xb7,
+	0x73, 0xdf, 0x96, 0xb9, 0xc6, 0xa0, 0x3c, 0x27, 0xf5, 0x9f, 0x9c, 0x7f, 0x0a, 0x9a, 0x6b, 0xac,
+	0x7c, 0x14, 0x9e, 0xe2, 0x80, 0xaf, 0x0d, 0xa4, 0x27, 0x97, 0x21, 0x7a, 0xd0, 0xfd, 0xac, 0x37,
+	0xfc, 0x4c, 0x3c, 0x81, 0x94, 0x8e, 0x7a, 0xb3, 0xcc, 0xea, 0x12, 0x39, 0x13, 0xe7, 0x10, 0x79,
+	0x37, 0xbc, 0x23, 0x00, 0x92, 0x39, 0xae, 0xb0, 0x70, 0xbc, 0xeb, 0xe3, 0x1b, 0xbd, 0x5e, 0x57,
+	0x8e, 0x47, 0xbe, 0xe5, 0xc4, 0x2f, 0x8f, 0xbd, 0xf8, 0x1e, 0x8b, 0x6a, 0x81, 0x3c, 0xf1, 0xb1,
+	0x42, 0xdb, 0xd6, 0x05, 0xef, 0x4d, 0xfb, 0xf7, 0xfb, 0x01, 0xfb, 0xb9, 0x1f, 0xb0, 0xdf, 0xfb,
+	0x01, 0xcb, 0x13, 0xfa, 0x57, 0xd7, 0x7f, 0x06, 0x00, 0x2c, 0x78, 0xcb, 0xf2, 0x9d, 0x02, 0x00,
+	0x00,
 }
 
 func (m *SignedProto) Marshal() (dAtA []byte, err error) {
@@ -379,6 +412,27 @@ func (m *Message) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i -= len(m.XXX_unrecognized)
 		copy(dAtA[i:], m.XXX_unrecognized)
 	}
+	if len(m.Signers) > 0 {
+		i -= len(m.Signers)
+		copy(dAtA[i:], m.Signers)
+		i = encodeVarintMessage(dAtA, i, uint64(len(m.Signers)))
+		i--
+		dAtA[i] = 0x4a
+	}
+	if len(m.BLSSignature) > 0 {
+		i -= len(m.BLSSignature)
+		copy(dAtA[i:], m.BLSSignature)
+		i = encodeVarintMessage(dAtA, i, uint64(len(m.BLSSignature)))
+		i--
+		dAtA[i] = 0x42
+	}
+	if len(m.Beacon) > 0 {
+		i -= len(m.Beacon)
+		copy(dAtA[i:], m.Beacon)
+		i = encodeVarintMessage(dAtA, i, uint64(len(m.Beacon)))
+		i--
+		dAtA[i] = 0x3a
+	}
 	if m.LockRelease != nil {
 		{
 			size, err := m.LockRelease.MarshalToSizedBuffer(dAtA[:i])
@@ -501,6 +555,18 @@ func (m *Message) Size() (n int) {
 		l = m.LockRelease.Size()
 		n += 1 + l + sovMessage(uint64(l))
 	}
+	l = len(m.Beacon)
+	if l > 0 {
+		n += 1 + l + sovMessage(uint64(l))
+	}
+	l = len(m.BLSSignature)
+	if l > 0 {
+		n += 1 + l + sovMessage(uint64(l))
+	}
+	l = len(m.Signers)
+	if l > 0 {
+		n += 1 + l + sovMessage(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -944,6 +1010,108 @@ func (m *Message) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Beacon", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthMessage
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthMessage
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Beacon = append(m.Beacon[:0], dAtA[iNdEx:postIndex]...)
+			if m.Beacon == nil {
+				m.Beacon = []byte{}
+			}
+			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BLSSignature", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthMessage
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthMessage
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.BLSSignature = append(m.BLSSignature[:0], dAtA[iNdEx:postIndex]...)
+			if m.BLSSignature == nil {
+				m.BLSSignature = []byte{}
+			}
+			iNdEx = postIndex
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Signers", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowMessage
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthMessage
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthMessage
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Signers = append(m.Signers[:0], dAtA[iNdEx:postIndex]...)
+			if m.Signers == nil {
+				m.Signers = []byte{}
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipMessage(dAtA[iNdEx:])
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"io"
 	mrand "math/rand"
+	"net"
 	"testing"
 	"time"
 
@@ -930,6 +931,39 @@ func TestValidateDecideMessageCorrect(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+// countingPeer counts the messages sent to it
+type countingPeer struct{ sent int }
+
+func (p *countingPeer) GetPublicKey() *ecdsa.PublicKey { return nil }
+func (p *countingPeer) RemoteAddr() net.Addr           { return &net.TCPAddr{} }
+func (p *countingPeer) Send(msg []byte) error          { p.sent++; return nil }
+
+func TestApplyDecide(t *testing.T) {
+	m, sp, privateKey, proofKeys := createDecideMessage(t, 20, 10, 10, 10, 10)
+	consensus := createConsensus(t, 9, 10, proofKeys)
+	consensus.SetLeader(&privateKey.PublicKey)
+	peer := new(countingPeer)
+	assert.True(t, consensus.Join(peer))
+	bts, err := proto.Marshal(sp)
+	assert.Nil(t, err)
+
+	now := time.Now()
+	err = consensus.ApplyDecide(bts, now)
+	assert.Nil(t, err)
+	height, _, state := consensus.CurrentState()
+	assert.Equal(t, m.Height, height)
+	assert.Equal(t, State(m.State), state)
+	// neither the <decide> nor a <roundchange> is sent
+	assert.Equal(t, 0, peer.sent)
+
+	// the decision is applied only once
+	err = consensus.ApplyDecide(bts, now)
+	assert.NotNil(t, err)
+
+	// the <roundchange> of the new height is broadcasted at next Update
+	assert.Equal(t, now, consensus.rcTimeout)
+}
+
 func TestValidateDecideMessageUnknowParticipant(t *testing.T) {
 	m, sp, privateKey, proofKeys := createDecideMessage(t, 20, 10, 10, 10, 10)
 	consensus := createConsensus(t, 9, 10, proofKeys)
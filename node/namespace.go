@@ -0,0 +1,439 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package node
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	agent "github.com/yonggewang/bdls/agent-tcp"
+	"github.com/yonggewang/bdls/telemetry"
+	"github.com/yonggewang/bdls/wal"
+)
+
+const (
+	// NamespaceLabel is the metrics label of the namespace
+	NamespaceLabel = "namespace"
+
+	// walRecordOverhead is the header of a record in the write-ahead log
+	walRecordOverhead = 8
+)
+
+var namespaceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Quota bounds the resources of a namespace, 0 is unlimited
+type Quota struct {
+	MaxStorageBytes       int64 // bytes in the namespace's directory
+	MaxPeers              int   // connected peers of the agent
+	MaxPeerLabels         int   // distinct peers with their own metrics series
+	MaxConcurrentRequests int   // RPC requests being served
+}
+
+// Config is to config a namespace
+type Config struct {
+	// Name of the namespace, also the name of it's directory and the first
+	// element of it's RPC routes
+	Name  string
+	Quota Quota
+
+	// access control lists for the peers of the namespace, as in
+	// TCPAgent.AllowNetwork & TCPAgent.AllowPublicKey
+	AllowNetworks   []string
+	DenyNetworks    []string
+	AllowPublicKeys []*ecdsa.PublicKey
+	DenyPublicKeys  []*ecdsa.PublicKey
+}
+
+// VerifyConfig verifies the integrity of this config
+func (c *Config) VerifyConfig() error {
+	if !namespaceName.MatchString(c.Name) {
+		return ErrNamespaceName
+	}
+	q := c.Quota
+	if q.MaxStorageBytes < 0 || q.MaxPeers < 0 || q.MaxPeerLabels < 0 || q.MaxConcurrentRequests < 0 {
+		return ErrQuotaNegative
+	}
+	return nil
+}
+
+// Host hosts namespaces in the sub-directories of a root directory, and
+// routes the RPC requests of /<namespace>/ to them.
+type Host struct {
+	root       string
+	namespaces map[string]*Namespace
+	sync.Mutex
+}
+
+// NewHost creates a Host storing namespaces in root
+func NewHost(root string) *Host {
+	h := new(Host)
+	h.root = root
+	h.namespaces = make(map[string]*Namespace)
+	return h
+}
+
+// Add creates a namespace by config, it's directory is created if not
+// exists, and the data already in it counts towards the storage quota.
+// The directory is locked until Remove, ErrDirLocked is returned if another
+// process runs the namespace.
+func (h *Host) Add(config *Config) (*Namespace, error) {
+	if err := config.VerifyConfig(); err != nil {
+		return nil, err
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := h.namespaces[config.Name]; ok {
+		return nil, ErrNamespaceExists
+	}
+
+	dir := filepath.Join(h.root, config.Name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	lock, err := LockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	used, err := dirSize(dir)
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+
+	ns := new(Namespace)
+	ns.config = *config
+	ns.dir = dir
+	ns.lock = lock
+	ns.used = used
+	ns.telemetry = telemetry.NewControls()
+	if config.Quota.MaxPeerLabels > 0 {
+		ns.telemetry.Peers.SetMax(config.Quota.MaxPeerLabels)
+	}
+	if n := config.Quota.MaxConcurrentRequests; n > 0 {
+		ns.requests = make(chan struct{}, n)
+	}
+	ns.mux = http.NewServeMux()
+	h.namespaces[config.Name] = ns
+	return ns, nil
+}
+
+// Get returns the namespace of name, or nil if not exists
+func (h *Host) Get(name string) *Namespace {
+	h.Lock()
+	defer h.Unlock()
+	return h.namespaces[name]
+}
+
+// Names returns the names of the namespaces in order
+func (h *Host) Names() []string {
+	h.Lock()
+	defer h.Unlock()
+	var names []string
+	for name := range h.namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Remove removes the namespace of name from the host, closes it's logs and
+// unlocks it's directory, the data in it is kept.
+func (h *Host) Remove(name string) bool {
+	h.Lock()
+	defer h.Unlock()
+	ns, ok := h.namespaces[name]
+	if !ok {
+		return false
+	}
+	if err := ns.close(); err != nil {
+		log.Println("namespace", name, err)
+	}
+	delete(h.namespaces, name)
+	return true
+}
+
+// Close removes all namespaces, the logs are flushed and closed, it's the
+// storage stage of a Shutdown.
+func (h *Host) Close() error {
+	h.Lock()
+	defer h.Unlock()
+	var errs []error
+	for name, ns := range h.namespaces {
+		if err := ns.close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(h.namespaces, name)
+	}
+	return errors.Join(errs...)
+}
+
+// ServeHTTP routes /<namespace>/<route> to the route of the namespace
+func (h *Host) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	ns := h.Get(name)
+	if ns == nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.StripPrefix("/"+name, ns).ServeHTTP(w, r)
+}
+
+// Namespace is an isolated chain instance of a Host
+type Namespace struct {
+	config    Config
+	dir       string
+	lock      *DirLock // exclusive lock of dir
+	used      int64    // bytes of storage reserved
+	telemetry *telemetry.Controls
+	agent     *agent.TCPAgent
+	mux       *http.ServeMux
+	requests  chan struct{} // tokens of concurrent requests, nil if unlimited
+	wals      []*WAL        // the logs opened
+	sync.Mutex
+}
+
+// Name returns the name of the namespace
+func (ns *Namespace) Name() string { return ns.config.Name }
+
+// Dir returns the directory of the namespace
+func (ns *Namespace) Dir() string { return ns.dir }
+
+// Path returns the path of elem in the directory of the namespace,
+// ErrNamespacePath is returned if it's outside of the directory.
+func (ns *Namespace) Path(elem ...string) (string, error) {
+	path := filepath.Join(append([]string{ns.dir}, elem...)...)
+	rel, err := filepath.Rel(ns.dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrNamespacePath
+	}
+	return path, nil
+}
+
+// Labels returns the metrics labels to record the series of the namespace
+// with, so tenants sharing a metrics backend are told apart.
+func (ns *Namespace) Labels() map[string]string {
+	return map[string]string{NamespaceLabel: ns.config.Name}
+}
+
+// Telemetry returns the sampling and cardinality controls of the
+// namespace, the per-peer limit applies to the agent attached.
+func (ns *Namespace) Telemetry() *telemetry.Controls { return ns.telemetry }
+
+// Reserve accounts n bytes to be written to the storage of the namespace,
+// ErrStorageQuota is returned if it would exceed MaxStorageBytes.
+func (ns *Namespace) Reserve(n int64) error {
+	ns.Lock()
+	defer ns.Unlock()
+	if max := ns.config.Quota.MaxStorageBytes; max > 0 && ns.used+n > max {
+		return ErrStorageQuota
+	}
+	ns.used += n
+	return nil
+}
+
+// Release returns n bytes removed from the storage of the namespace
+func (ns *Namespace) Release(n int64) {
+	ns.Lock()
+	defer ns.Unlock()
+	ns.used -= n
+	if ns.used < 0 {
+		ns.used = 0
+	}
+}
+
+// Usage returns the bytes of storage accounted to the namespace
+func (ns *Namespace) Usage() int64 {
+	ns.Lock()
+	defer ns.Unlock()
+	return ns.used
+}
+
+// Attach sets the agent of the namespace's chain instance, it's peers are
+// filtered by the access control lists of the namespace, and it's per-peer
+// metrics are bounded by MaxPeerLabels.
+func (ns *Namespace) Attach(a *agent.TCPAgent) error {
+	a.ResetACL()
+	for _, network := range ns.config.AllowNetworks {
+		if err := a.AllowNetwork(network); err != nil {
+			return err
+		}
+	}
+	for _, network := range ns.config.DenyNetworks {
+		if err := a.DenyNetwork(network); err != nil {
+			return err
+		}
+	}
+	for _, key := range ns.config.AllowPublicKeys {
+		a.AllowPublicKey(key)
+	}
+	for _, key := range ns.config.DenyPublicKeys {
+		a.DenyPublicKey(key)
+	}
+	a.Telemetry().Peers.SetMax(ns.telemetry.Peers.Max())
+
+	ns.Lock()
+	ns.agent = a
+	ns.Unlock()
+	return nil
+}
+
+// Agent returns the attached agent
+func (ns *Namespace) Agent() *agent.TCPAgent {
+	ns.Lock()
+	defer ns.Unlock()
+	return ns.agent
+}
+
+// AddPeer adds p to the attached agent, unless the agent has MaxPeers
+// already.
+func (ns *Namespace) AddPeer(p *agent.TCPPeer) bool {
+	a := ns.Agent()
+	if a == nil {
+		return false
+	}
+	if max := ns.config.Quota.MaxPeers; max > 0 && a.NumPeers() >= max {
+		return false
+	}
+	return a.AddPeer(p)
+}
+
+// Handle registers the handler for the route pattern of the namespace,
+// it's served as /<namespace>/<pattern> by the Host. Requests beyond
+// MaxConcurrentRequests are answered with 429 Too Many Requests.
+func (ns *Namespace) Handle(pattern string, handler http.Handler) {
+	ns.mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ns.requests != nil {
+			select {
+			case ns.requests <- struct{}{}:
+				defer func() { <-ns.requests }()
+			default:
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// ServeHTTP serves the routes of the namespace, without the namespace
+// prefix.
+func (ns *Namespace) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ns.mux.ServeHTTP(w, r)
+}
+
+// WAL is a write-ahead log in a namespace, the records are accounted to
+// the storage quota of the namespace.
+type WAL struct {
+	*wal.WAL
+	ns *Namespace
+}
+
+// OpenWAL opens the write-ahead log in the sub-directory dir of the
+// namespace, as in wal.Open, config.Dir is ignored.
+func (ns *Namespace) OpenWAL(dir string, config wal.Config, fn func(data []byte) error) (*WAL, error) {
+	path, err := ns.Path(dir)
+	if err != nil {
+		return nil, err
+	}
+	config.Dir = path
+	w, err := wal.Open(&config, fn)
+	if err != nil {
+		return nil, err
+	}
+	ns.Lock()
+	defer ns.Unlock()
+	ns.wals = append(ns.wals, &WAL{WAL: w, ns: ns})
+	return ns.wals[len(ns.wals)-1], nil
+}
+
+// close closes the logs of the namespace, the appends have been synced on
+// return, then unlocks the directory.
+func (ns *Namespace) close() error {
+	ns.Lock()
+	wals := ns.wals
+	ns.wals = nil
+	ns.Unlock()
+
+	var errs []error
+	for _, w := range wals {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := ns.lock.Unlock(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Append appends a record to the log, ErrStorageQuota is returned if the
+// namespace is out of storage.
+func (w *WAL) Append(data []byte) error {
+	n := int64(len(data) + walRecordOverhead)
+	if err := w.ns.Reserve(n); err != nil {
+		return err
+	}
+	if err := w.WAL.Append(data); err != nil {
+		w.ns.Release(n)
+		return err
+	}
+	return nil
+}
+
+// dirSize returns the bytes of the regular files in dir, except the lock
+func dirSize(dir string) (int64, error) {
+	var size int64
+	lockPath := filepath.Join(dir, LockName)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && path != lockPath {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,210 @@
+package node
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	agent "github.com/yonggewang/bdls/agent-tcp"
+	"github.com/yonggewang/bdls/wal"
+)
+
+func newTestAgent(t *testing.T) *agent.TCPAgent {
+	var participants []bdls.Identity
+	var privateKey *ecdsa.PrivateKey
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+		privateKey = key
+	}
+
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = privateKey
+	config.Participants = participants
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	return agent.NewTCPAgent(consensus, privateKey)
+}
+
+func TestNamespaceConfig(t *testing.T) {
+	h := NewHost(t.TempDir())
+	for _, name := range []string{"", "Chain", "../x", "a/b", ".hidden"} {
+		_, err := h.Add(&Config{Name: name})
+		assert.Equal(t, ErrNamespaceName, err, name)
+	}
+	_, err := h.Add(&Config{Name: "chain", Quota: Quota{MaxPeers: -1}})
+	assert.Equal(t, ErrQuotaNegative, err)
+
+	_, err = h.Add(&Config{Name: "chain-a"})
+	assert.Nil(t, err)
+	_, err = h.Add(&Config{Name: "chain-a"})
+	assert.Equal(t, ErrNamespaceExists, err)
+	_, err = h.Add(&Config{Name: "chain_b"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"chain-a", "chain_b"}, h.Names())
+
+	assert.True(t, h.Remove("chain-a"))
+	assert.False(t, h.Remove("chain-a"))
+	assert.Nil(t, h.Get("chain-a"))
+}
+
+func TestNamespaceStorage(t *testing.T) {
+	root := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "a"), 0700))
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "a", "existing"), make([]byte, 100), 0600))
+
+	h := NewHost(root)
+	a, err := h.Add(&Config{Name: "a", Quota: Quota{MaxStorageBytes: 200}})
+	assert.Nil(t, err)
+	b, err := h.Add(&Config{Name: "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), a.Usage())
+	assert.Equal(t, filepath.Join(root, "a"), a.Dir())
+
+	path, err := a.Path("wal", "wal.log")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(root, "a", "wal", "wal.log"), path)
+	_, err = a.Path("..", "b")
+	assert.Equal(t, ErrNamespacePath, err)
+
+	// the quota of a doesn't affect b
+	w, err := a.OpenWAL("wal", wal.Config{}, nil)
+	assert.Nil(t, err)
+	defer w.Close()
+	assert.Nil(t, w.Append(make([]byte, 50)))
+	assert.Equal(t, ErrStorageQuota, w.Append(make([]byte, 50)))
+	assert.Equal(t, int64(158), a.Usage())
+
+	wb, err := b.OpenWAL("wal", wal.Config{}, nil)
+	assert.Nil(t, err)
+	defer wb.Close()
+	assert.Nil(t, wb.Append(make([]byte, 1000)))
+
+	a.Release(58)
+	assert.Nil(t, w.Append(make([]byte, 50)))
+}
+
+func TestNamespaceRoutes(t *testing.T) {
+	h := NewHost(t.TempDir())
+	a, err := h.Add(&Config{Name: "a", Quota: Quota{MaxConcurrentRequests: 1}})
+	assert.Nil(t, err)
+	b, err := h.Add(&Config{Name: "b"})
+	assert.Nil(t, err)
+
+	block := make(chan struct{})
+	entered := make(chan struct{})
+	a.Handle("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-block
+	}))
+	b.Handle("/stats", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	done := make(chan struct{})
+	go func() {
+		resp, err := http.Get(server.URL + "/a/slow")
+		assert.Nil(t, err)
+		resp.Body.Close()
+		close(done)
+	}()
+	<-entered
+
+	// a is at it's quota
+	resp, err := http.Get(server.URL + "/a/slow")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// b is not affected
+	resp, err = http.Get(server.URL + "/b/stats")
+	assert.Nil(t, err)
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/stats", body.String())
+
+	resp, err = http.Get(server.URL + "/c/stats")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	close(block)
+	<-done
+}
+
+func TestNamespacePeers(t *testing.T) {
+	h := NewHost(t.TempDir())
+	ns, err := h.Add(&Config{Name: "a", Quota: Quota{MaxPeers: 1, MaxPeerLabels: 3}, DenyNetworks: []string{"not a network"}})
+	assert.Nil(t, err)
+	a := newTestAgent(t)
+	defer a.Close()
+	assert.Equal(t, agent.ErrACLNetwork, ns.Attach(a))
+
+	ns, err = h.Add(&Config{Name: "b", Quota: Quota{MaxPeers: 1, MaxPeerLabels: 3}})
+	assert.Nil(t, err)
+	c1, _ := net.Pipe()
+	assert.False(t, ns.AddPeer(agent.NewTCPPeer(c1, a)))
+
+	assert.Nil(t, ns.Attach(a))
+	assert.Equal(t, a, ns.Agent())
+	assert.Equal(t, 3, a.Telemetry().Peers.Max())
+	assert.Equal(t, map[string]string{NamespaceLabel: "b"}, ns.Labels())
+
+	c1, _ = net.Pipe()
+	assert.True(t, ns.AddPeer(agent.NewTCPPeer(c1, a)))
+	c2, _ := net.Pipe()
+	assert.False(t, ns.AddPeer(agent.NewTCPPeer(c2, a)))
+	assert.Equal(t, 1, a.NumPeers())
+}
+
+func TestLockDir(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := LockDir(dir)
+	assert.Nil(t, err)
+	_, err = LockDir(dir)
+	assert.Equal(t, ErrDirLocked, err)
+	assert.Nil(t, lock.Unlock())
+
+	lock, err = LockDir(dir)
+	assert.Nil(t, err)
+	defer lock.Unlock()
+
+	// a namespace can't be run by two hosts
+	root := t.TempDir()
+	_, err = NewHost(root).Add(&Config{Name: "a"})
+	assert.Nil(t, err)
+	h := NewHost(root)
+	_, err = h.Add(&Config{Name: "a"})
+	assert.Equal(t, ErrDirLocked, err)
+	assert.Nil(t, h.Get("a"))
+
+	// until removed
+	h2 := NewHost(root)
+	_, err = h2.Add(&Config{Name: "b"})
+	assert.Nil(t, err)
+	assert.True(t, h2.Remove("b"))
+	_, err = h.Add(&Config{Name: "b"})
+	assert.Nil(t, err)
+}
+
+func TestDropPrivileges(t *testing.T) {
+	assert.NotNil(t, DropPrivileges("no-such-user-of-bdls"))
+}
@@ -0,0 +1,207 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultGracePeriod is the default time for the stages before storage to
+// stop, below the 30 seconds kubernetes waits before killing a pod.
+const DefaultGracePeriod = 25 * time.Second
+
+// Stage is a stage of the shutdown of a node, the stages are run in order,
+// each one stopping a component before the ones it depends on.
+type Stage int
+
+const (
+	StageRPC       Stage = iota // stop serving requests
+	StageMempool                // stop admitting transactions
+	StageConsensus              // stop proposing & voting, announce leaving
+	StageTransport              // close the peers & listeners
+	StageStorage                // flush & close the logs, unlock the directories
+	numStages
+)
+
+var stageNames = [numStages]string{"rpc", "mempool", "consensus", "transport", "storage"}
+
+// String returns the name of the stage
+func (s Stage) String() string {
+	if s < 0 || s >= numStages {
+		return fmt.Sprint("stage(", int(s), ")")
+	}
+	return stageNames[s]
+}
+
+// shutdownHook is a function to stop a component
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Shutdown stops the components of a node in the order of dependencies,
+// RPC, mempool, consensus, transport then storage, so no request is
+// admitted into a stopped consensus, no vote is signed after the peers are
+// gone, and the logs are flushed last.
+type Shutdown struct {
+	grace time.Duration
+	hooks [numStages][]shutdownHook
+	once  sync.Once
+	done  chan struct{}
+	err   error
+	sync.Mutex
+}
+
+// NewShutdown creates a Shutdown, the stages before storage must stop
+// within grace, storage is stopped regardless.
+func NewShutdown(grace time.Duration) *Shutdown {
+	s := new(Shutdown)
+	s.grace = grace
+	s.done = make(chan struct{})
+	return s
+}
+
+// Register adds a function to stop a component at stage, the functions of
+// a stage are run in the order registered, and should return once ctx is
+// done.
+func (s *Shutdown) Register(stage Stage, name string, fn func(ctx context.Context) error) {
+	if stage < 0 || stage >= numStages {
+		panic("unknown shutdown stage")
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.hooks[stage] = append(s.hooks[stage], shutdownHook{name: name, fn: fn})
+}
+
+// Run stops the components stage by stage, it runs once, the later calls
+// wait for the first one and return it's result. A failed function doesn't
+// stop the later stages, the errors are joined. The stages before storage
+// are abandoned once the grace period is over, while storage is always
+// waited for, so the logs are flushed.
+func (s *Shutdown) Run() error {
+	s.once.Do(func() {
+		defer close(s.done)
+		s.Lock()
+		hooks := s.hooks
+		s.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.grace)
+		defer cancel()
+
+		var errs []error
+		for stage := Stage(0); stage < numStages; stage++ {
+			stageCtx := ctx
+			if stage == StageStorage {
+				stageCtx = context.WithoutCancel(ctx)
+			}
+			for _, hook := range hooks[stage] {
+				log.Println("shutdown:", stage, hook.name)
+				if err := runHook(stageCtx, hook.fn); err != nil {
+					errs = append(errs, fmt.Errorf("%v %v: %w", stage, hook.name, err))
+				}
+			}
+		}
+		s.err = errors.Join(errs...)
+	})
+	<-s.done
+	return s.err
+}
+
+// runHook runs fn until it returns or ctx is done
+func runHook(ctx context.Context, fn func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done returns a channel closed once the shutdown has completed
+func (s *Shutdown) Done() <-chan struct{} { return s.done }
+
+// Err returns the result of Run once done
+func (s *Shutdown) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// HandleSignals runs the shutdown on the first of signals, SIGINT and
+// SIGTERM if none, a second one exits the process at once. The returned
+// function stops handling the signals.
+func (s *Shutdown) HandleSignals(signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, signals...)
+	die := make(chan struct{})
+
+	go func() {
+		select {
+		case received := <-sig:
+			log.Println("shutdown on", received)
+		case <-die:
+			return
+		}
+		go s.Run()
+
+		select {
+		case received := <-sig:
+			log.Println("exit on", received)
+			os.Exit(1)
+		case <-s.done:
+		case <-die:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sig)
+			close(die)
+		})
+	}
+}
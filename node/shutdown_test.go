@@ -0,0 +1,139 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package node
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls/wal"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	s := NewShutdown(100 * time.Millisecond)
+	var order []string
+	record := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+	s.Register(StageStorage, "wal", record("wal"))
+	s.Register(StageTransport, "peers", record("peers"))
+	s.Register(StageConsensus, "proposer", record("proposer"))
+	s.Register(StageRPC, "admin", record("admin"))
+	s.Register(StageRPC, "metrics", record("metrics"))
+	s.Register(StageMempool, "mempool", record("mempool"))
+
+	assert.Nil(t, s.Run())
+	assert.Equal(t, []string{"admin", "metrics", "mempool", "proposer", "peers", "wal"}, order)
+
+	// runs once
+	assert.Nil(t, s.Run())
+	assert.Equal(t, 6, len(order))
+	assert.Equal(t, "consensus", StageConsensus.String())
+	assert.Panics(t, func() { s.Register(numStages, "unknown", record("unknown")) })
+}
+
+func TestShutdownGrace(t *testing.T) {
+	s := NewShutdown(50 * time.Millisecond)
+	failed := errors.New("failed")
+	var flushed bool
+	s.Register(StageRPC, "failed", func(ctx context.Context) error { return failed })
+	s.Register(StageConsensus, "stuck", func(ctx context.Context) error {
+		select {}
+	})
+	s.Register(StageStorage, "wal", func(ctx context.Context) error {
+		// storage is waited for after the grace period
+		<-time.After(100 * time.Millisecond)
+		assert.Nil(t, ctx.Err())
+		flushed = true
+		return nil
+	})
+
+	assert.Nil(t, s.Err())
+	err := s.Run()
+	<-s.Done()
+	assert.True(t, errors.Is(err, failed))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, err, s.Err())
+	assert.True(t, flushed)
+}
+
+func TestShutdownSignals(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can't be sent to the process on windows")
+	}
+	s := NewShutdown(time.Second)
+	stop := s.HandleSignals(syscall.SIGHUP)
+	defer stop()
+
+	p, err := os.FindProcess(os.Getpid())
+	assert.Nil(t, err)
+	assert.Nil(t, p.Signal(syscall.SIGHUP))
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown not run on the signal")
+	}
+}
+
+func TestHostClose(t *testing.T) {
+	root := t.TempDir()
+	h := NewHost(root)
+	ns, err := h.Add(&Config{Name: "a"})
+	assert.Nil(t, err)
+	w, err := ns.OpenWAL("wal", wal.Config{}, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Append([]byte("decision")))
+
+	assert.Nil(t, h.Close())
+	assert.Equal(t, wal.ErrClosed, w.Append([]byte("decision")))
+	assert.Nil(t, h.Get("a"))
+
+	// unlocked, and the records are kept
+	var records int
+	ns, err = NewHost(root).Add(&Config{Name: "a"})
+	assert.Nil(t, err)
+	w, err = ns.OpenWAL("wal", wal.Config{}, func(data []byte) error {
+		records++
+		return nil
+	})
+	assert.Nil(t, err)
+	defer w.Close()
+	assert.Equal(t, 1, records)
+}
@@ -0,0 +1,117 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ProfilePhase is a phase of the hot path timed by a Profiler.
+type ProfilePhase int
+
+const (
+	// ProfileVerify is verifying the signatures of messages and proofs.
+	ProfileVerify ProfilePhase = iota
+	// ProfileTransition is processing messages and timeouts in the state
+	// machine, including the verification and marshalling within.
+	ProfileTransition
+	// ProfileMarshal is signing and marshalling outgoing messages, including
+	// the MessageOutCallback.
+	ProfileMarshal
+	// ProfileIO is reading and writing messages on connections, it's timed
+	// by the agent.
+	ProfileIO
+	numProfilePhases
+)
+
+var profilePhaseNames = [numProfilePhases]string{"verify", "transition", "marshal", "io"}
+
+func (phase ProfilePhase) String() string {
+	if phase < 0 || phase >= numProfilePhases {
+		return "unknown"
+	}
+	return profilePhaseNames[phase]
+}
+
+// PhaseProfile is the time spent in a phase.
+type PhaseProfile struct {
+	Phase string        `json:"phase"`
+	Count uint64        `json:"count"`    // the number of times timed
+	Total time.Duration `json:"total_ns"` // the total time spent
+}
+
+// Profiler accumulates the time spent in the phases of the hot path, so
+// performance regressions are visible in production rather than only in
+// benchmarks. It costs a clock reading at the start and the end of each
+// timing, and is safe for concurrent use. A nil Profiler times nothing.
+type Profiler struct {
+	phases [numProfilePhases]struct {
+		count uint64
+		nanos int64
+	}
+}
+
+// NewProfiler creates a Profiler to set in Config.Profiler.
+func NewProfiler() *Profiler { return new(Profiler) }
+
+// Now returns the start time of a timing, or a zero time if p is nil.
+func (p *Profiler) Now() time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// Since adds the time elapsed since start, returned by Now, to the phase.
+func (p *Profiler) Since(phase ProfilePhase, start time.Time) {
+	if p == nil || phase < 0 || phase >= numProfilePhases {
+		return
+	}
+	atomic.AddUint64(&p.phases[phase].count, 1)
+	atomic.AddInt64(&p.phases[phase].nanos, int64(time.Since(start)))
+}
+
+// Profile returns the time spent in each phase so far.
+func (p *Profiler) Profile() []PhaseProfile {
+	if p == nil {
+		return nil
+	}
+	profile := make([]PhaseProfile, numProfilePhases)
+	for k := range p.phases {
+		profile[k] = PhaseProfile{
+			Phase: ProfilePhase(k).String(),
+			Count: atomic.LoadUint64(&p.phases[k].count),
+			Total: time.Duration(atomic.LoadInt64(&p.phases[k].nanos)),
+		}
+	}
+	return profile
+}
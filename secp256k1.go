@@ -0,0 +1,81 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+
+	"github.com/yonggewang/bdls/crypto/btcec"
+)
+
+// ErrPrivateKey will be returned if error found while decoding a private key
+var ErrPrivateKey = errors.New("incorrect private key format")
+
+// ParseSecp256k1PublicKey parses a SEC1 encoded public key on secp256k1,
+// compressed in 33 bytes as used by Bitcoin, or uncompressed in 65 bytes
+// as used by Ethereum, so the validator keys managed by their tools can be
+// the participants.
+func ParseSecp256k1PublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	pubkey, err := btcec.ParsePubKey(data, btcec.S256())
+	if err != nil || pubkey.X.Cmp(S256Curve.Params().P) >= 0 || !S256Curve.IsOnCurve(pubkey.X, pubkey.Y) {
+		return nil, ErrPubKey
+	}
+	return &ecdsa.PublicKey{Curve: S256Curve, X: pubkey.X, Y: pubkey.Y}, nil
+}
+
+// Secp256k1Identity returns the identity of a SEC1 encoded public key on
+// secp256k1, see ParseSecp256k1PublicKey.
+func Secp256k1Identity(data []byte) (Identity, error) {
+	pubkey, err := ParseSecp256k1PublicKey(data)
+	if err != nil {
+		return Identity{}, err
+	}
+	return DefaultPubKeyToIdentity(pubkey), nil
+}
+
+// CompressSecp256k1PublicKey encodes a public key on secp256k1 in the 33
+// bytes of SEC1 compressed format.
+func CompressSecp256k1PublicKey(pubkey *ecdsa.PublicKey) []byte {
+	return (*btcec.PublicKey)(pubkey).SerializeCompressed()
+}
+
+// ParseSecp256k1PrivateKey parses a private key on secp256k1 of 32 bytes in
+// big-endian, the raw format of Bitcoin & Ethereum keys.
+func ParseSecp256k1PrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	d := new(big.Int).SetBytes(data)
+	if len(data) != 32 || d.Sign() == 0 || d.Cmp(S256Curve.Params().N) >= 0 {
+		return nil, ErrPrivateKey
+	}
+	priv, _ := btcec.PrivKeyFromBytes(S256Curve, data)
+	return (*ecdsa.PrivateKey)(priv), nil
+}
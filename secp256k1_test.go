@@ -0,0 +1,44 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecp256k1Keys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	// a raw private key, as exported by wallets
+	raw := make([]byte, 32)
+	key.D.FillBytes(raw)
+	parsed, err := ParseSecp256k1PrivateKey(raw)
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultPubKeyToIdentity(&key.PublicKey), DefaultPubKeyToIdentity(&parsed.PublicKey))
+	_, err = ParseSecp256k1PrivateKey(make([]byte, 32))
+	assert.Equal(t, ErrPrivateKey, err)
+	_, err = ParseSecp256k1PrivateKey(S256Curve.Params().N.Bytes())
+	assert.Equal(t, ErrPrivateKey, err)
+
+	// compressed & uncompressed public keys are the same identity
+	id := DefaultPubKeyToIdentity(&key.PublicKey)
+	compressed := CompressSecp256k1PublicKey(&key.PublicKey)
+	assert.Len(t, compressed, 33)
+	coord, err := Secp256k1Identity(compressed)
+	assert.Nil(t, err)
+	assert.Equal(t, id, coord)
+	coord, err = Secp256k1Identity(append([]byte{0x04}, id[:]...))
+	assert.Nil(t, err)
+	assert.Equal(t, id, coord)
+	_, err = Secp256k1Identity(id[:])
+	assert.Equal(t, ErrPubKey, err)
+
+	// the messages signed by the parsed key are verified by the identity
+	sp := new(SignedProto)
+	sp.Sign(&Message{Type: MessageType_RoundChange}, parsed)
+	assert.True(t, sp.Verify(S256Curve))
+	assert.Equal(t, id, DefaultPubKeyToIdentity(sp.PublicKey(S256Curve)))
+}
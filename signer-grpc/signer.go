@@ -0,0 +1,467 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package grpcsigner
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yonggewang/bdls"
+	"github.com/yonggewang/bdls/crypto/blake2b"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ServiceName is the gRPC service name of the remote signer
+	ServiceName = "bdls.Signer"
+	// PublicKeyMethod is the gRPC method returning the public key
+	PublicKeyMethod = "/" + ServiceName + "/PublicKey"
+	// SignMethod is the gRPC method signing a message
+	SignMethod = "/" + ServiceName + "/Sign"
+
+	// DefaultTimeout is the default timeout of a signing request
+	DefaultTimeout = time.Second
+
+	// codecName is the content-subtype of the signer requests, the messages
+	// are length prefixed fields instead of protobuf
+	codecName = "bdls-signer"
+)
+
+var (
+	// ErrHashOnly indicates a hash is requested to sign, the remote signer
+	// signs the messages only, as it checks them before signing
+	ErrHashOnly = errors.New("the remote signer signs messages, not hashes")
+	// ErrMessage indicates a malformed request or response
+	ErrMessage = errors.New("malformed signer message")
+	// ErrStaleVote indicates the message is of an earlier height or round
+	// than signed already
+	ErrStaleVote = errors.New("a message of a later height or round has been signed")
+	// ErrConflictingVote indicates the message votes on another state than
+	// signed already in the same height and round
+	ErrConflictingVote = errors.New("another state has been signed in the height and round")
+	// ErrWatermarkKey indicates the watermark file is of another key
+	ErrWatermarkKey = errors.New("the watermark file is of another key")
+)
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// message is a request or response of the signer
+type message interface {
+	marshal() []byte
+	unmarshal(data []byte) error
+}
+
+// codec encodes the messages as a sequence of |uvarint length|bytes|
+// fields, it's selected by content-subtype, so it won't affect other
+// services registered on the same grpc.Server.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "unexpected message type %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return status.Errorf(codes.Internal, "unexpected message type %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (codec) Name() string { return codecName }
+
+// appendField appends a length prefixed field
+func appendField(data []byte, field []byte) []byte {
+	data = binary.AppendUvarint(data, uint64(len(field)))
+	return append(data, field...)
+}
+
+// readFields reads exactly n length prefixed fields
+func readFields(data []byte, n int) ([][]byte, error) {
+	fields := make([][]byte, 0, n)
+	for len(fields) < n {
+		length, k := binary.Uvarint(data)
+		if k <= 0 || length > uint64(len(data)-k) {
+			return nil, ErrMessage
+		}
+		data = data[k:]
+		fields = append(fields, append([]byte(nil), data[:length]...))
+		data = data[length:]
+	}
+	if len(data) != 0 {
+		return nil, ErrMessage
+	}
+	return fields, nil
+}
+
+// publicKeyRequest requests the public key, it has no fields
+type publicKeyRequest struct{}
+
+func (*publicKeyRequest) marshal() []byte { return nil }
+func (*publicKeyRequest) unmarshal(data []byte) error {
+	_, err := readFields(data, 0)
+	return err
+}
+
+// publicKeyResponse is the public key as encoded in SignedProto.X & Y
+type publicKeyResponse struct {
+	X bdls.PubKeyAxis
+	Y bdls.PubKeyAxis
+}
+
+func (m *publicKeyResponse) marshal() []byte {
+	return appendField(appendField(nil, m.X[:]), m.Y[:])
+}
+
+func (m *publicKeyResponse) unmarshal(data []byte) error {
+	fields, err := readFields(data, 2)
+	if err != nil {
+		return err
+	}
+	if len(fields[0]) != bdls.SizeAxis || len(fields[1]) != bdls.SizeAxis {
+		return ErrMessage
+	}
+	copy(m.X[:], fields[0])
+	copy(m.Y[:], fields[1])
+	return nil
+}
+
+// signRequest requests the signature of a SignedProto, the fields are as
+// in SignedProto, the public key is the signer's
+type signRequest struct {
+	Version uint32
+	Message []byte
+}
+
+func (m *signRequest) marshal() []byte {
+	return appendField(appendField(nil, binary.LittleEndian.AppendUint32(nil, m.Version)), m.Message)
+}
+
+func (m *signRequest) unmarshal(data []byte) error {
+	fields, err := readFields(data, 2)
+	if err != nil {
+		return err
+	}
+	if len(fields[0]) != 4 {
+		return ErrMessage
+	}
+	m.Version = binary.LittleEndian.Uint32(fields[0])
+	m.Message = fields[1]
+	return nil
+}
+
+// signResponse is the signature as encoded in SignedProto.R & S
+type signResponse struct {
+	R []byte
+	S []byte
+}
+
+func (m *signResponse) marshal() []byte { return appendField(appendField(nil, m.R), m.S) }
+
+func (m *signResponse) unmarshal(data []byte) error {
+	fields, err := readFields(data, 2)
+	if err != nil {
+		return err
+	}
+	m.R, m.S = fields[0], fields[1]
+	return nil
+}
+
+// signerServer is the handler type of the signer service
+type signerServer interface {
+	publicKey(ctx context.Context, req *publicKeyRequest) (*publicKeyResponse, error)
+	sign(ctx context.Context, req *signRequest) (*signResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*signerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PublicKey",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(publicKeyRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(signerServer).publicKey(ctx, req.(*publicKeyRequest))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: PublicKeyMethod}, handler)
+			},
+		},
+		{
+			MethodName: "Sign",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(signRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(signerServer).sign(ctx, req.(*signRequest))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: SignMethod}, handler)
+			},
+		},
+	},
+}
+
+// watermark is the latest height and round signed by a key, with the hash
+// of the state voted by each type of message in it
+type watermark struct {
+	Key    string            `json:"key"` // hex of X & Y
+	Height uint64            `json:"height"`
+	Round  uint64            `json:"round"`
+	Votes  map[string]string `json:"votes,omitempty"`
+}
+
+// check checks the message against the watermark, the messages of an
+// earlier height or round are refused, so are the votes on another state
+// than voted in the same height and round. The watermark is advanced to
+// the message, true if it's changed.
+func (w *watermark) check(m *bdls.Message) (bool, error) {
+	vote := false
+	switch m.Type {
+	case bdls.MessageType_Resync:
+		// the proofs carried are signed by the others
+		return false, nil
+	case bdls.MessageType_RoundChange, bdls.MessageType_LockRelease:
+		// the states proposed may change in the round
+	case bdls.MessageType_Lock, bdls.MessageType_Select, bdls.MessageType_Commit, bdls.MessageType_Decide:
+		vote = true
+	default:
+		return false, ErrMessage
+	}
+
+	changed := false
+	switch {
+	case m.Height < w.Height || (m.Height == w.Height && m.Round < w.Round):
+		return false, ErrStaleVote
+	case m.Height > w.Height || m.Round > w.Round:
+		w.Height, w.Round, w.Votes = m.Height, m.Round, nil
+		changed = true
+	}
+	if !vote {
+		return changed, nil
+	}
+
+	hash := blake2b.Sum256(m.State)
+	state := hex.EncodeToString(hash[:])
+	if voted, ok := w.Votes[m.Type.String()]; ok {
+		if voted != state {
+			return false, ErrConflictingVote
+		}
+		return changed, nil
+	}
+	votes := make(map[string]string, len(w.Votes)+1)
+	for k, v := range w.Votes {
+		votes[k] = v
+	}
+	votes[m.Type.String()] = state
+	w.Votes = votes
+	return true, nil
+}
+
+// Server serves a bdls.Signer to remote clients, the messages are signed
+// only if they don't conflict with the watermark of the key.
+type Server struct {
+	signer    bdls.Signer
+	path      string
+	watermark watermark
+	sync.Mutex
+}
+
+// NewServer creates a Server of the signer, it's safe for concurrent use
+// if the signer is. The watermark is persisted to the file at path before
+// each signature advancing it, it must be kept with the key, so a restarted
+// signer won't sign a conflicting vote. An empty path keeps the watermark
+// in memory, for tests only.
+func NewServer(signer bdls.Signer, path string) (*Server, error) {
+	s := &Server{signer: signer, path: path}
+	X, Y := signer.PublicKey()
+	key := hex.EncodeToString(append(X[:], Y[:]...))
+	s.watermark.Key = key
+	if path == "" {
+		return s, nil
+	}
+
+	bts, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bts, &s.watermark); err != nil {
+		return nil, err
+	}
+	if s.watermark.Key != key {
+		return nil, ErrWatermarkKey
+	}
+	return s, nil
+}
+
+// Register registers the signer service on a grpc.Server
+func (s *Server) Register(gs *grpc.Server) {
+	gs.RegisterService(&serviceDesc, s)
+}
+
+func (s *Server) publicKey(ctx context.Context, req *publicKeyRequest) (*publicKeyResponse, error) {
+	resp := new(publicKeyResponse)
+	resp.X, resp.Y = s.signer.PublicKey()
+	return resp, nil
+}
+
+func (s *Server) sign(ctx context.Context, req *signRequest) (*signResponse, error) {
+	m := new(bdls.Message)
+	if err := m.Unmarshal(req.Message); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// the hash is of the message checked, with the signer's key
+	sp := &bdls.SignedProto{Version: req.Version, Message: req.Message}
+	sp.X, sp.Y = s.signer.PublicKey()
+
+	s.Lock()
+	defer s.Unlock()
+	next := s.watermark
+	changed, err := next.check(m)
+	switch err {
+	case nil:
+	case ErrMessage:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if changed && s.path != "" {
+		bts, err := json.Marshal(&next)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if err := writeFileAtomic(s.path, bts); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	s.watermark = next
+
+	R, S, err := s.signer.Sign(sp.Hash())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &signResponse{R: R, S: S}, nil
+}
+
+// writeFileAtomic replaces the file at path with data
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Client is a bdls.Signer signing by a remote Server
+type Client struct {
+	cc      grpc.ClientConnInterface
+	timeout time.Duration
+	x, y    bdls.PubKeyAxis
+}
+
+// NewClient creates a Client of the signer served on the connection, the
+// public key is requested once here, and each signature in timeout, or
+// DefaultTimeout if it's not positive.
+func NewClient(ctx context.Context, cc grpc.ClientConnInterface, timeout time.Duration) (*Client, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	resp := new(publicKeyResponse)
+	if err := cc.Invoke(ctx, PublicKeyMethod, new(publicKeyRequest), resp, grpc.CallContentSubtype(codecName)); err != nil {
+		return nil, err
+	}
+	return &Client{cc: cc, timeout: timeout, x: resp.X, y: resp.Y}, nil
+}
+
+// PublicKey implements bdls.Signer
+func (c *Client) PublicKey() (X bdls.PubKeyAxis, Y bdls.PubKeyAxis) { return c.x, c.y }
+
+// Sign implements bdls.Signer, it fails with ErrHashOnly as the server
+// checks the messages before signing, SignMessage is used instead.
+func (c *Client) Sign(hash []byte) (R []byte, S []byte, err error) {
+	return nil, nil, ErrHashOnly
+}
+
+// SignMessage implements bdls.MessageSigner, the message being signed is
+// dropped by the consensus core if the signer is unreachable in time, or
+// refuses it as it conflicts with the messages signed.
+func (c *Client) SignMessage(sp *bdls.SignedProto) (R []byte, S []byte, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	resp := new(signResponse)
+	if err := c.cc.Invoke(ctx, SignMethod, &signRequest{Version: sp.Version, Message: sp.Message}, resp, grpc.CallContentSubtype(codecName)); err != nil {
+		return nil, nil, err
+	}
+	return resp.R, resp.S, nil
+}
+
+var _ bdls.MessageSigner = (*Client)(nil)
@@ -0,0 +1,170 @@
+package grpcsigner
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// slowSigner takes a while to sign
+type slowSigner struct {
+	bdls.Signer
+	delay time.Duration
+}
+
+func (s slowSigner) Sign(hash []byte) ([]byte, []byte, error) {
+	time.Sleep(s.delay)
+	return s.Signer.Sign(hash)
+}
+
+// failedSigner fails to sign
+type failedSigner struct{ bdls.Signer }
+
+func (failedSigner) Sign(hash []byte) ([]byte, []byte, error) {
+	return nil, nil, errors.New("token removed")
+}
+
+// newTestServer starts a gRPC server of the signer, with the watermark
+// persisted at path
+func newTestServer(t *testing.T, signer bdls.Signer, path string) *grpc.ClientConn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	s := grpc.NewServer()
+	server, err := NewServer(signer, path)
+	assert.Nil(t, err)
+	server.Register(s)
+	go s.Serve(l)
+
+	cc, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+
+	t.Cleanup(func() {
+		cc.Close()
+		s.Stop()
+	})
+	return cc
+}
+
+func TestRemoteSigner(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	signer := bdls.NewECDSASigner(privateKey)
+
+	client, err := NewClient(context.Background(), newTestServer(t, signer, ""), 0)
+	assert.Nil(t, err)
+	X, Y := signer.PublicKey()
+	cX, cY := client.PublicKey()
+	assert.Equal(t, X, cX)
+	assert.Equal(t, Y, cY)
+
+	// the messages signed remotely are verified as signed locally
+	sp := new(bdls.SignedProto)
+	assert.Nil(t, sp.SignWith(&bdls.Message{Type: bdls.MessageType_RoundChange, Height: 1}, client))
+	assert.True(t, sp.Verify(bdls.S256Curve))
+
+	// the hashes can't be checked
+	_, _, err = client.Sign(sp.Hash())
+	assert.Equal(t, ErrHashOnly, err)
+
+	// a consensus signing by the client, it can't verify
+	var participants []bdls.Identity
+	participants = append(participants, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	for i := 1; i < bdls.ConfigMinimumParticipants; i++ {
+		key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&key.PublicKey))
+	}
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.Signer = client
+	config.Participants = participants
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+	assert.Equal(t, bdls.ErrConfigVerifier, bdls.VerifyConfig(config))
+	config.Verifier = bdls.ECDSAVerifier{Curve: bdls.S256Curve}
+	_, err = bdls.NewConsensus(config)
+	assert.Nil(t, err)
+}
+
+func TestRemoteSignerFailure(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	signer := bdls.NewECDSASigner(privateKey)
+	m := &bdls.Message{Type: bdls.MessageType_RoundChange, Height: 1}
+
+	// the signer errors are returned
+	client, err := NewClient(context.Background(), newTestServer(t, failedSigner{signer}, ""), 0)
+	assert.Nil(t, err)
+	err = new(bdls.SignedProto).SignWith(m, client)
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	// slow signatures time out
+	client, err = NewClient(context.Background(), newTestServer(t, slowSigner{signer, time.Second}, ""), 100*time.Millisecond)
+	assert.Nil(t, err)
+	err = new(bdls.SignedProto).SignWith(m, client)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// not a message
+	_, _, err = client.SignMessage(&bdls.SignedProto{Version: bdls.ProtocolVersion, Message: []byte{0xff}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRemoteSignerWatermark(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	signer := bdls.NewECDSASigner(privateKey)
+	path := filepath.Join(t.TempDir(), "watermark.json")
+
+	client, err := NewClient(context.Background(), newTestServer(t, signer, path), 0)
+	assert.Nil(t, err)
+	sign := func(client *Client, typ bdls.MessageType, height uint64, round uint64, state string) error {
+		return new(bdls.SignedProto).SignWith(&bdls.Message{Type: typ, Height: height, Round: round, State: []byte(state)}, client)
+	}
+
+	assert.Nil(t, sign(client, bdls.MessageType_RoundChange, 10, 1, "a"))
+	assert.Nil(t, sign(client, bdls.MessageType_Commit, 10, 1, "a"))
+	// signed again as retransmitted
+	assert.Nil(t, sign(client, bdls.MessageType_Commit, 10, 1, "a"))
+	// a conflicting vote in the same height and round is refused
+	err = sign(client, bdls.MessageType_Commit, 10, 1, "b")
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, ErrConflictingVote.Error(), status.Convert(err).Message())
+	// the proposals may change in the round
+	assert.Nil(t, sign(client, bdls.MessageType_RoundChange, 10, 1, "b"))
+	// earlier heights and rounds are refused
+	err = sign(client, bdls.MessageType_Commit, 10, 0, "b")
+	assert.Equal(t, ErrStaleVote.Error(), status.Convert(err).Message())
+	err = sign(client, bdls.MessageType_RoundChange, 9, 5, "b")
+	assert.Equal(t, ErrStaleVote.Error(), status.Convert(err).Message())
+	// not a consensus message
+	err = sign(client, bdls.MessageType_Nop, 10, 1, "b")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the watermark is kept by a restarted signer
+	client, err = NewClient(context.Background(), newTestServer(t, signer, path), 0)
+	assert.Nil(t, err)
+	err = sign(client, bdls.MessageType_Commit, 10, 1, "b")
+	assert.Equal(t, ErrConflictingVote.Error(), status.Convert(err).Message())
+	assert.Nil(t, sign(client, bdls.MessageType_Commit, 10, 2, "b"))
+	assert.Nil(t, sign(client, bdls.MessageType_Commit, 11, 0, "c"))
+
+	// the watermark of another key
+	otherKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	_, err = NewServer(bdls.NewECDSASigner(otherKey), path)
+	assert.Equal(t, ErrWatermarkKey, err)
+}
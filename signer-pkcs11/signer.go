@@ -0,0 +1,339 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package pkcs11signer
+
+import (
+	"crypto/elliptic"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/yonggewang/bdls"
+)
+
+const (
+	// DefaultTimeout is the default timeout of an HSM call
+	DefaultTimeout = 2 * time.Second
+)
+
+var (
+	// ErrCGO indicates the package is built without cgo to access tokens
+	ErrCGO = errors.New("PKCS#11 requires cgo")
+	// ErrModule indicates the PKCS#11 module can't be loaded
+	ErrModule = errors.New("cannot load the PKCS#11 module")
+	// ErrToken indicates no token has the label in the config
+	ErrToken = errors.New("no PKCS#11 token of the label")
+	// ErrKey indicates the EC key pair of the label is not found
+	ErrKey = errors.New("no EC key pair of the label in the token")
+	// ErrCurve indicates the key is not on secp256k1 or P-256
+	ErrCurve = errors.New("the curve of the key is not supported")
+	// ErrPublicKey indicates the EC point of the public key is invalid
+	ErrPublicKey = errors.New("invalid EC point of the public key")
+	// ErrSignature indicates the token returned a malformed signature
+	ErrSignature = errors.New("malformed signature from the token")
+	// ErrTimeout indicates the token didn't answer in Config.Timeout
+	ErrTimeout = errors.New("the PKCS#11 token timed out")
+	// ErrNotLoggedIn indicates the session is no longer logged in
+	ErrNotLoggedIn = errors.New("the PKCS#11 session is not logged in")
+)
+
+var (
+	oidSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+	oidP256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+)
+
+// Config is the token and key of a Signer
+type Config struct {
+	// Module is the path of the PKCS#11 library of the token vendor
+	Module string
+	// TokenLabel & PIN select the token and log in as the user
+	TokenLabel string
+	PIN        string
+	// KeyLabel is the CKA_LABEL of the private & public key
+	KeyLabel string
+
+	// Timeout bounds each HSM call, including the wait for the previous
+	// call on the session (optional). Default to DefaultTimeout.
+	Timeout time.Duration
+	// SlowThreshold is the latency of a signature to be reported as slow
+	// (optional). Default to a quarter of Timeout.
+	SlowThreshold time.Duration
+	// OnSlow is called after a signature took SlowThreshold or longer, or
+	// timed out, with the time it took (optional). It's called with the
+	// signature held back, so it must return quickly.
+	OnSlow func(latency time.Duration)
+}
+
+// Stats is the latency and errors of the signatures of a Signer
+type Stats struct {
+	Signatures uint64 // succeeded
+	Failures   uint64 // failed, timeouts included
+	Timeouts   uint64
+	Slow       uint64 // took SlowThreshold or longer
+
+	// the latency of the last signature, the moving average and the max
+	LastLatency    time.Duration
+	AverageLatency time.Duration
+	MaxLatency     time.Duration
+	LastError      string
+}
+
+// token signs by the key pair in a PKCS#11 token, it's only called by one
+// goroutine at a time.
+type token interface {
+	// publicKey returns CKA_EC_PARAMS & CKA_EC_POINT of the public key
+	publicKey() (params []byte, point []byte, err error)
+	// sign returns the r||s of CKM_ECDSA over the hash
+	sign(hash []byte) ([]byte, error)
+	// ping returns an error if the session is not usable
+	ping() error
+	close() error
+}
+
+// Signer signs by an ECDSA key in a PKCS#11 token, and verifies on the
+// curve of it.
+type Signer struct {
+	token token
+	curve elliptic.Curve
+	x, y  bdls.PubKeyAxis
+
+	timeout       time.Duration
+	slowThreshold time.Duration
+	onSlow        func(time.Duration)
+
+	// held by the HSM call in progress, which may outlive a timeout
+	busy chan struct{}
+
+	stats   Stats
+	statsMu sync.Mutex
+}
+
+// Open loads the module, logs in the token and finds the key pair.
+func Open(config *Config) (*Signer, error) {
+	t, err := openToken(config)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSigner(t, config)
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// newSigner creates a Signer of the token
+func newSigner(t token, config *Config) (*Signer, error) {
+	s := &Signer{token: t, busy: make(chan struct{}, 1)}
+	s.timeout = config.Timeout
+	if s.timeout <= 0 {
+		s.timeout = DefaultTimeout
+	}
+	s.slowThreshold = config.SlowThreshold
+	if s.slowThreshold <= 0 {
+		s.slowThreshold = s.timeout / 4
+	}
+	s.onSlow = config.OnSlow
+
+	var params, point []byte
+	err := s.call(func() (err error) {
+		params, point, err = t.publicKey()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.curve, err = parseCurve(params); err != nil {
+		return nil, err
+	}
+	X, Y, err := parsePoint(s.curve, point)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.x.Unmarshal(X.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := s.y.Unmarshal(Y.Bytes()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseCurve returns the curve of CKA_EC_PARAMS, a named curve OID
+func parseCurve(params []byte) (elliptic.Curve, error) {
+	var oid asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(params, &oid); err != nil || len(rest) > 0 {
+		return nil, ErrCurve
+	}
+	switch {
+	case oid.Equal(oidSecp256k1):
+		return bdls.S256Curve, nil
+	case oid.Equal(oidP256):
+		return elliptic.P256(), nil
+	}
+	return nil, ErrCurve
+}
+
+// parsePoint returns the coordinates of CKA_EC_POINT, an uncompressed point
+// in a DER OCTET STRING, or raw by some tokens.
+func parsePoint(curve elliptic.Curve, point []byte) (X *big.Int, Y *big.Int, err error) {
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err != nil || len(rest) > 0 {
+		raw = point
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	if len(raw) != 1+2*size || raw[0] != 4 {
+		return nil, nil, ErrPublicKey
+	}
+	X = new(big.Int).SetBytes(raw[1 : 1+size])
+	Y = new(big.Int).SetBytes(raw[1+size:])
+	if !curve.IsOnCurve(X, Y) {
+		return nil, nil, ErrPublicKey
+	}
+	return X, Y, nil
+}
+
+// call runs f on the session in timeout, the session is held until f
+// returns, so the calls after a timeout fail until the token answers.
+func (s *Signer) call(f func() error) error {
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	select {
+	case s.busy <- struct{}{}:
+	case <-timer.C:
+		return ErrTimeout
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-s.busy }()
+		done <- f()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrTimeout
+	}
+}
+
+// PublicKey implements bdls.Signer
+func (s *Signer) PublicKey() (X bdls.PubKeyAxis, Y bdls.PubKeyAxis) { return s.x, s.y }
+
+// Sign implements bdls.Signer, it fails with ErrTimeout if the token
+// doesn't answer in Config.Timeout.
+func (s *Signer) Sign(hash []byte) (R []byte, S []byte, err error) {
+	var sig []byte
+	start := time.Now()
+	err = s.call(func() (err error) {
+		sig, err = s.token.sign(hash)
+		return err
+	})
+	s.record(time.Since(start), err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(sig) == 0 || len(sig)%2 != 0 {
+		return nil, nil, ErrSignature
+	}
+	r := new(big.Int).SetBytes(sig[:len(sig)/2])
+	ss := new(big.Int).SetBytes(sig[len(sig)/2:])
+	return r.Bytes(), ss.Bytes(), nil
+}
+
+// Verify implements bdls.Verifier on the curve of the key
+func (s *Signer) Verify(X bdls.PubKeyAxis, Y bdls.PubKeyAxis, hash []byte, R []byte, S []byte) bool {
+	return bdls.ECDSAVerifier{Curve: s.curve}.Verify(X, Y, hash, R, S)
+}
+
+// Curve returns the curve of the key
+func (s *Signer) Curve() elliptic.Curve { return s.curve }
+
+// record records the latency & the error of a signature
+func (s *Signer) record(latency time.Duration, err error) {
+	s.statsMu.Lock()
+	stats := &s.stats
+	if err != nil {
+		stats.Failures++
+		stats.LastError = err.Error()
+		if err == ErrTimeout {
+			stats.Timeouts++
+		}
+	} else {
+		stats.Signatures++
+	}
+	stats.LastLatency = latency
+	if latency > stats.MaxLatency {
+		stats.MaxLatency = latency
+	}
+	if stats.AverageLatency == 0 {
+		stats.AverageLatency = latency
+	} else {
+		stats.AverageLatency += (latency - stats.AverageLatency) / 8
+	}
+	slow := latency >= s.slowThreshold
+	if slow {
+		stats.Slow++
+	}
+	s.statsMu.Unlock()
+
+	if slow && s.onSlow != nil {
+		s.onSlow(latency)
+	}
+}
+
+// Stats returns the latency and errors of the signatures so far
+func (s *Signer) Stats() Stats {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return s.stats
+}
+
+// Health returns nil if the session is logged in and answers in time
+func (s *Signer) Health() error {
+	return s.call(s.token.ping)
+}
+
+// Close logs out and closes the session, after the call in progress
+func (s *Signer) Close() error {
+	s.busy <- struct{}{}
+	return s.token.close()
+}
+
+var (
+	_ bdls.Signer   = (*Signer)(nil)
+	_ bdls.Verifier = (*Signer)(nil)
+)
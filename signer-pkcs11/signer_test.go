@@ -0,0 +1,123 @@
+package pkcs11signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+)
+
+// softToken is a token of a key in memory
+type softToken struct {
+	key      *ecdsa.PrivateKey
+	oid      asn1.ObjectIdentifier
+	delay    time.Duration
+	loggedIn int32
+}
+
+func newSoftToken(t *testing.T, curve elliptic.Curve, oid asn1.ObjectIdentifier) *softToken {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	assert.Nil(t, err)
+	return &softToken{key: key, oid: oid, loggedIn: 1}
+}
+
+func (t *softToken) publicKey() ([]byte, []byte, error) {
+	params, _ := asn1.Marshal(t.oid)
+	point, _ := asn1.Marshal(elliptic.Marshal(t.key.Curve, t.key.X, t.key.Y))
+	return params, point, nil
+}
+
+func (t *softToken) sign(hash []byte) ([]byte, error) {
+	time.Sleep(t.delay)
+	r, s, err := ecdsa.Sign(rand.Reader, t.key, hash)
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig, nil
+}
+
+func (t *softToken) ping() error {
+	if atomic.LoadInt32(&t.loggedIn) == 0 {
+		return ErrNotLoggedIn
+	}
+	return nil
+}
+
+func (t *softToken) close() error { return nil }
+
+func TestSigner(t *testing.T) {
+	for _, curve := range []struct {
+		curve elliptic.Curve
+		oid   asn1.ObjectIdentifier
+	}{{bdls.S256Curve, oidSecp256k1}, {elliptic.P256(), oidP256}} {
+		tk := newSoftToken(t, curve.curve, curve.oid)
+		signer, err := newSigner(tk, &Config{})
+		assert.Nil(t, err)
+		assert.Equal(t, curve.curve, signer.Curve())
+
+		// the signatures are of the key in the token
+		sp := new(bdls.SignedProto)
+		assert.Nil(t, sp.SignWith(&bdls.Message{Type: bdls.MessageType_RoundChange, Height: 1}, signer))
+		assert.True(t, sp.Verify(curve.curve))
+		assert.True(t, sp.VerifyWith(signer))
+		assert.Equal(t, bdls.DefaultPubKeyToIdentity(&tk.key.PublicKey), bdls.DefaultPubKeyToIdentity(sp.PublicKey(curve.curve)))
+
+		assert.Nil(t, signer.Health())
+		atomic.StoreInt32(&tk.loggedIn, 0)
+		assert.Equal(t, ErrNotLoggedIn, signer.Health())
+		assert.Equal(t, uint64(1), signer.Stats().Signatures)
+		assert.Nil(t, signer.Close())
+	}
+
+	// other curves are rejected
+	_, err := newSigner(newSoftToken(t, elliptic.P384(), asn1.ObjectIdentifier{1, 3, 132, 0, 34}), &Config{})
+	assert.Equal(t, ErrCurve, err)
+}
+
+func TestSignerTimeout(t *testing.T) {
+	tk := newSoftToken(t, bdls.S256Curve, oidSecp256k1)
+	var slow int32
+	signer, err := newSigner(tk, &Config{
+		Timeout:       200 * time.Millisecond,
+		SlowThreshold: 50 * time.Millisecond,
+		OnSlow:        func(time.Duration) { atomic.AddInt32(&slow, 1) },
+	})
+	assert.Nil(t, err)
+	hash := make([]byte, 32)
+
+	// slow, but in time
+	tk.delay = 100 * time.Millisecond
+	_, _, err = signer.Sign(hash)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slow))
+
+	// stuck, the session is held by the stuck call till it returns
+	tk.delay = 500 * time.Millisecond
+	_, _, err = signer.Sign(hash)
+	assert.Equal(t, ErrTimeout, err)
+	assert.Equal(t, ErrTimeout, signer.Health())
+	time.Sleep(400 * time.Millisecond)
+	assert.Nil(t, signer.Health())
+
+	stats := signer.Stats()
+	assert.Equal(t, uint64(1), stats.Signatures)
+	assert.Equal(t, uint64(1), stats.Timeouts)
+	assert.Equal(t, uint64(2), stats.Slow)
+	assert.Equal(t, ErrTimeout.Error(), stats.LastError)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&slow))
+}
+
+func TestOpenModule(t *testing.T) {
+	_, err := Open(&Config{Module: "/nonexistent/libpkcs11.so"})
+	assert.True(t, errors.Is(err, ErrModule) || errors.Is(err, ErrCGO))
+}
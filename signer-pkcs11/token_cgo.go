@@ -0,0 +1,168 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+//go:build cgo
+
+package pkcs11signer
+
+import (
+	"strings"
+
+	"github.com/miekg/pkcs11"
+)
+
+// p11token is a logged in session of a PKCS#11 token
+type p11token struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	private pkcs11.ObjectHandle
+	public  pkcs11.ObjectHandle
+}
+
+// openToken loads the module, logs in the token of the label and finds the
+// key pair of the label.
+func openToken(config *Config) (token, error) {
+	ctx := pkcs11.New(config.Module)
+	if ctx == nil {
+		return nil, ErrModule
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, err
+	}
+	t := &p11token{ctx: ctx}
+	if err := t.open(config); err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *p11token) open(config *Config) error {
+	slots, err := t.ctx.GetSlotList(true)
+	if err != nil {
+		return err
+	}
+	slot, found := uint(0), false
+	for _, id := range slots {
+		info, err := t.ctx.GetTokenInfo(id)
+		if err == nil && strings.TrimSpace(info.Label) == config.TokenLabel {
+			slot, found = id, true
+			break
+		}
+	}
+	if !found {
+		return ErrToken
+	}
+
+	if t.session, err = t.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION); err != nil {
+		return err
+	}
+	if err := t.ctx.Login(t.session, pkcs11.CKU_USER, config.PIN); err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		t.ctx.CloseSession(t.session)
+		return err
+	}
+	if t.private, err = t.find(pkcs11.CKO_PRIVATE_KEY, config.KeyLabel); err == nil {
+		t.public, err = t.find(pkcs11.CKO_PUBLIC_KEY, config.KeyLabel)
+	}
+	if err != nil {
+		t.ctx.Logout(t.session)
+		t.ctx.CloseSession(t.session)
+		return err
+	}
+	return nil
+}
+
+// find returns the only EC key of the class and the label
+func (t *p11token) find(class uint, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := t.ctx.FindObjectsInit(t.session, template); err != nil {
+		return 0, err
+	}
+	objects, _, err := t.ctx.FindObjects(t.session, 2)
+	t.ctx.FindObjectsFinal(t.session)
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) != 1 {
+		return 0, ErrKey
+	}
+	return objects[0], nil
+}
+
+func (t *p11token) publicKey() (params []byte, point []byte, err error) {
+	attrs, err := t.ctx.GetAttributeValue(t.session, t.public, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, attr := range attrs {
+		switch attr.Type {
+		case pkcs11.CKA_EC_PARAMS:
+			params = attr.Value
+		case pkcs11.CKA_EC_POINT:
+			point = attr.Value
+		}
+	}
+	return params, point, nil
+}
+
+func (t *p11token) sign(hash []byte) ([]byte, error) {
+	if err := t.ctx.SignInit(t.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, t.private); err != nil {
+		return nil, err
+	}
+	return t.ctx.Sign(t.session, hash)
+}
+
+func (t *p11token) ping() error {
+	info, err := t.ctx.GetSessionInfo(t.session)
+	if err != nil {
+		return err
+	}
+	if info.State != pkcs11.CKS_RO_USER_FUNCTIONS && info.State != pkcs11.CKS_RW_USER_FUNCTIONS {
+		return ErrNotLoggedIn
+	}
+	return nil
+}
+
+func (t *p11token) close() error {
+	t.ctx.Logout(t.session)
+	err := t.ctx.CloseSession(t.session)
+	t.ctx.Finalize()
+	t.ctx.Destroy()
+	return err
+}
@@ -0,0 +1,173 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+)
+
+// Signer signs the consensus messages of a participant, so the key can be
+// held in memory, by hardware, or by a remote signer.
+type Signer interface {
+	// PublicKey returns the public key as encoded in SignedProto.X & Y
+	PublicKey() (X PubKeyAxis, Y PubKeyAxis)
+
+	// Sign signs the hash of a SignedProto, the signature is returned as
+	// encoded in SignedProto.R & S.
+	Sign(hash []byte) (R []byte, S []byte, err error)
+}
+
+// MessageSigner is a Signer signing the SignedProto instead of it's hash, so
+// the signer can check the message before signing it, like a remote signer
+// refusing conflicting votes. SignWith prefers it to Sign.
+type MessageSigner interface {
+	Signer
+
+	// SignMessage signs the SignedProto with the version, message and
+	// public key set, the signature is returned as encoded in
+	// SignedProto.R & S.
+	SignMessage(sp *SignedProto) (R []byte, S []byte, err error)
+}
+
+// Verifier verifies the signatures of the SignedProto signed by a Signer of
+// the same scheme.
+type Verifier interface {
+	// Verify returns true if R & S is a valid signature of the hash by the
+	// public key X & Y.
+	Verify(X PubKeyAxis, Y PubKeyAxis, hash []byte, R []byte, S []byte) bool
+}
+
+// ECDSASigner signs with an ECDSA private key in memory, it's the signer
+// used for Config.PrivateKey.
+type ECDSASigner struct {
+	privateKey *ecdsa.PrivateKey
+}
+
+// NewECDSASigner creates a signer of the ECDSA private key
+func NewECDSASigner(privateKey *ecdsa.PrivateKey) *ECDSASigner {
+	return &ECDSASigner{privateKey: privateKey}
+}
+
+// PublicKey implements Signer, X & Y are the coordinates of the public key
+func (s *ECDSASigner) PublicKey() (X PubKeyAxis, Y PubKeyAxis) {
+	if err := X.Unmarshal(s.privateKey.PublicKey.X.Bytes()); err != nil {
+		panic(err)
+	}
+	if err := Y.Unmarshal(s.privateKey.PublicKey.Y.Bytes()); err != nil {
+		panic(err)
+	}
+	return
+}
+
+// Sign implements Signer, R & S are the big-endian r, s of the signature
+func (s *ECDSASigner) Sign(hash []byte) (R []byte, S []byte, err error) {
+	r, ss, err := ecdsa.Sign(rand.Reader, s.privateKey, hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.Bytes(), ss.Bytes(), nil
+}
+
+// Verify implements Verifier on the curve of the private key
+func (s *ECDSASigner) Verify(X PubKeyAxis, Y PubKeyAxis, hash []byte, R []byte, S []byte) bool {
+	return ECDSAVerifier{Curve: s.privateKey.Curve}.Verify(X, Y, hash, R, S)
+}
+
+// ECDSAVerifier verifies the ECDSA signatures on the curve
+type ECDSAVerifier struct {
+	Curve elliptic.Curve
+}
+
+// Verify implements Verifier
+func (v ECDSAVerifier) Verify(X PubKeyAxis, Y PubKeyAxis, hash []byte, R []byte, S []byte) bool {
+	pubkey := ecdsa.PublicKey{
+		Curve: v.Curve,
+		X:     new(big.Int).SetBytes(X[:]),
+		Y:     new(big.Int).SetBytes(Y[:]),
+	}
+	return ecdsa.Verify(&pubkey, hash, new(big.Int).SetBytes(R), new(big.Int).SetBytes(S))
+}
+
+// Ed25519Signer signs with an Ed25519 private key in memory. The public key
+// is encoded in SignedProto.X with Y zeroed, and the signature is split
+// into R & S, so the identity of the key is Ed25519Identity.
+type Ed25519Signer struct {
+	privateKey ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates a signer of the Ed25519 private key
+func NewEd25519Signer(privateKey ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{privateKey: privateKey}
+}
+
+// PublicKey implements Signer
+func (s *Ed25519Signer) PublicKey() (X PubKeyAxis, Y PubKeyAxis) {
+	copy(X[:], s.privateKey.Public().(ed25519.PublicKey))
+	return
+}
+
+// Sign implements Signer
+func (s *Ed25519Signer) Sign(hash []byte) (R []byte, S []byte, err error) {
+	sig := ed25519.Sign(s.privateKey, hash)
+	return sig[:ed25519.SignatureSize/2], sig[ed25519.SignatureSize/2:], nil
+}
+
+// Verify implements Verifier
+func (s *Ed25519Signer) Verify(X PubKeyAxis, Y PubKeyAxis, hash []byte, R []byte, S []byte) bool {
+	return Ed25519Verifier{}.Verify(X, Y, hash, R, S)
+}
+
+// Ed25519Verifier verifies the Ed25519 signatures of Ed25519Signer
+type Ed25519Verifier struct{}
+
+// Verify implements Verifier
+func (Ed25519Verifier) Verify(X PubKeyAxis, Y PubKeyAxis, hash []byte, R []byte, S []byte) bool {
+	// R & S must be split at the middle, or the same signature would verify
+	// in many encodings
+	if Y != (PubKeyAxis{}) || len(R) != ed25519.SignatureSize/2 || len(S) != ed25519.SignatureSize/2 {
+		return false
+	}
+	sig := make([]byte, 0, ed25519.SignatureSize)
+	sig = append(append(sig, R...), S...)
+	return ed25519.Verify(ed25519.PublicKey(X[:]), hash, sig)
+}
+
+// Ed25519Identity returns the identity of an Ed25519 public key as a
+// participant, the same as DefaultPubKeyToIdentity derives from the
+// messages signed by Ed25519Signer.
+func Ed25519Identity(pubkey ed25519.PublicKey) (ret Identity) {
+	copy(ret[:SizeAxis], pubkey)
+	return
+}
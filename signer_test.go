@@ -0,0 +1,103 @@
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEd25519Signer(t *testing.T) {
+	var signers []*Ed25519Signer
+	var coords []Identity
+	for i := 0; i < 4; i++ {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		assert.Nil(t, err)
+		signers = append(signers, NewEd25519Signer(priv))
+		coords = append(coords, Ed25519Identity(pub))
+	}
+
+	// a signed message is verified by the scheme of the signer only
+	sp := new(SignedProto)
+	assert.Nil(t, sp.SignWith(&Message{Type: MessageType_RoundChange}, signers[0]))
+	assert.True(t, sp.VerifyWith(Ed25519Verifier{}))
+	assert.False(t, sp.Verify(S256Curve))
+	assert.Equal(t, coords[0], DefaultPubKeyToIdentity(sp.PublicKey(S256Curve)))
+	// the signature split elsewhere is rejected
+	R, S := sp.R, sp.S
+	sp.R, sp.S = append(append([]byte{}, R...), S[0]), S[1:]
+	assert.False(t, sp.VerifyWith(Ed25519Verifier{}))
+	sp.R, sp.S = R, S
+	sp.Message[0] ^= 1
+	assert.False(t, sp.VerifyWith(Ed25519Verifier{}))
+
+	epoch := time.Now()
+	newConfig := func(signer Signer) *Config {
+		config := new(Config)
+		config.Epoch = epoch
+		config.Signer = signer
+		config.Participants = coords
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a State) bool { return true }
+		return config
+	}
+
+	var peers []*IPCPeer
+	for i := range signers {
+		consensus, err := NewConsensus(newConfig(signers[i]))
+		assert.Nil(t, err)
+		consensus.SetLatency(50 * time.Millisecond)
+		peers = append(peers, NewIPCPeer(consensus, 10*time.Millisecond))
+	}
+	for i := range peers {
+		for j := range peers {
+			if i != j {
+				assert.True(t, peers[i].c.Join(peers[j]))
+			}
+		}
+	}
+	for i := range peers {
+		peers[i].Update()
+		data := make([]byte, 1024)
+		io.ReadFull(rand.Reader, data)
+		peers[i].Propose(data)
+	}
+	defer func() {
+		for i := range peers {
+			peers[i].Close()
+		}
+	}()
+
+	for i := range peers {
+		assert.Eventually(t, func() bool { h, _, _ := peers[i].GetLatestState(); return h > 0 }, 20*time.Second, 20*time.Millisecond)
+	}
+
+	// the signatures of <decide> are not ECDSA
+	peers[0].Lock()
+	_, _, state := peers[0].c.CurrentState()
+	decide, err := peers[0].c.CurrentProof().Marshal()
+	peers[0].Unlock()
+	assert.Nil(t, err)
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	config := newConfig(nil)
+	config.PrivateKey = privateKey
+	verifier, err := NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrMessageSignature, verifier.ValidateDecideMessage(decide, state))
+	config.Verifier = Ed25519Verifier{}
+	verifier, err = NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Nil(t, verifier.ValidateDecideMessage(decide, state))
+
+	// a signer which can't verify requires a verifier
+	config = newConfig(struct{ Signer }{signers[0]})
+	assert.Equal(t, ErrConfigVerifier, VerifyConfig(config))
+	config.Verifier = Ed25519Verifier{}
+	assert.Nil(t, VerifyConfig(config))
+}
@@ -0,0 +1,333 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"encoding/json"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+)
+
+// snapshotVersion is the version of the encoding of Snapshot
+const snapshotVersion = 2
+
+// consensusSnapshot is the state of a Consensus, the messages are kept as
+// signed and encoded, so they're verified again while restoring, and the
+// states derived from them are recomputed.
+type consensusSnapshot struct {
+	Version  int    `json:"version"`
+	Identity []byte `json:"identity"`
+
+	LatestState  State  `json:"latest_state"`
+	LatestHeight uint64 `json:"latest_height"`
+	LatestRound  uint64 `json:"latest_round"`
+	LatestProof  []byte `json:"latest_proof,omitempty"`
+
+	Unconfirmed  []State         `json:"unconfirmed,omitempty"`
+	Rounds       []roundSnapshot `json:"rounds"`
+	CurrentRound *uint64         `json:"current_round,omitempty"`
+
+	RoundChangeTimeout time.Time `json:"roundchange_timeout"`
+	LockTimeout        time.Time `json:"lock_timeout"`
+	CommitTimeout      time.Time `json:"commit_timeout"`
+	LockReleaseTimeout time.Time `json:"lock_release_timeout"`
+
+	Locks                [][]byte      `json:"locks,omitempty"`
+	LastRoundChangeProof [][]byte      `json:"last_roundchange_proof,omitempty"`
+	Loopback             [][]byte      `json:"loopback,omitempty"`
+	GoneLeaders          [][]byte      `json:"gone_leaders,omitempty"`
+	Latency              time.Duration `json:"latency"`
+}
+
+// roundSnapshot is the state of a consensusRound, the max proposed state
+// is recomputed from the <roundchange> messages.
+type roundSnapshot struct {
+	Stage           consensusStage `json:"stage"`
+	RoundNumber     uint64         `json:"round"`
+	LockedState     State          `json:"locked_state,omitempty"`
+	RoundChangeSent bool           `json:"roundchange_sent"`
+	CommitSent      bool           `json:"commit_sent"`
+	RoundChanges    [][]byte       `json:"roundchanges,omitempty"`
+	Commits         [][]byte       `json:"commits,omitempty"`
+}
+
+// Snapshot serializes the state of the consensus, the decided height, the
+// rounds in progress with their locks, the messages collected and the
+// timeouts, so it can be restored by Restore on another host, or from a
+// backup. The private key and the config are not included.
+//
+// A validator must not run on both hosts, or restore a snapshot older than
+// the messages it has signed since, to avoid signing conflicting messages.
+func (c *Consensus) Snapshot() ([]byte, error) {
+	s := new(consensusSnapshot)
+	s.Version = snapshotVersion
+	s.Identity = c.identity[:]
+	s.LatestState = c.latestState
+	s.LatestHeight = c.latestHeight
+	s.LatestRound = c.latestRound
+	if c.latestProof != nil {
+		bts, err := proto.Marshal(c.latestProof)
+		if err != nil {
+			return nil, err
+		}
+		s.LatestProof = bts
+	}
+	s.Unconfirmed = c.unconfirmed
+
+	for elem := c.rounds.Front(); elem != nil; elem = elem.Next() {
+		r := elem.Value.(*consensusRound)
+		rs := roundSnapshot{
+			Stage:           r.Stage,
+			RoundNumber:     r.RoundNumber,
+			LockedState:     r.LockedState,
+			RoundChangeSent: r.RoundChangeSent,
+			CommitSent:      r.CommitSent,
+		}
+		var err error
+		if rs.RoundChanges, err = c.marshalTuples(r.roundChanges); err != nil {
+			return nil, err
+		}
+		if rs.Commits, err = c.marshalTuples(r.commits); err != nil {
+			return nil, err
+		}
+		s.Rounds = append(s.Rounds, rs)
+	}
+	if c.currentRound != nil {
+		round := c.currentRound.RoundNumber
+		s.CurrentRound = &round
+	}
+
+	s.RoundChangeTimeout = c.rcTimeout
+	s.LockTimeout = c.lockTimeout
+	s.CommitTimeout = c.commitTimeout
+	s.LockReleaseTimeout = c.lockReleaseTimeout
+
+	var err error
+	if s.Locks, err = c.marshalTuples(c.locks); err != nil {
+		return nil, err
+	}
+	for _, proof := range c.lastRoundChangeProof {
+		bts, err := proto.Marshal(proof)
+		if err != nil {
+			return nil, err
+		}
+		s.LastRoundChangeProof = append(s.LastRoundChangeProof, bts)
+	}
+	s.Loopback = c.loopback
+	for id := range c.goneLeaders {
+		id := id
+		s.GoneLeaders = append(s.GoneLeaders, id[:])
+	}
+	s.Latency = c.latency
+	return json.Marshal(s)
+}
+
+// marshalTuples encodes the signed messages of the tuples, the messages
+// accepted without their signatures verified are left out if invalid.
+func (c *Consensus) marshalTuples(tuples []messageTuple) ([][]byte, error) {
+	var out [][]byte
+	for k := range tuples {
+		if c.unverified[tuples[k].Signed] && !c.verifySignature(tuples[k].Signed) {
+			continue
+		}
+		bts, err := proto.Marshal(tuples[k].Signed)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, bts)
+	}
+	return out, nil
+}
+
+// Restore replaces the state of the consensus by a Snapshot of the same
+// participant, the consensus must be created by the config of it. All the
+// messages in the snapshot are verified, the latest state must be the one
+// decided by the <decide> message, and the max proposed & locked states of
+// the rounds are recomputed from the <roundchange> messages. The state is
+// unchanged if any of them is invalid.
+func (c *Consensus) Restore(bts []byte) error {
+	s := new(consensusSnapshot)
+	if err := json.Unmarshal(bts, s); err != nil {
+		return err
+	}
+	if s.Version != snapshotVersion {
+		return ErrSnapshotVersion
+	}
+	if string(s.Identity) != string(c.identity[:]) {
+		return ErrSnapshotIdentity
+	}
+
+	var latestProof *SignedProto
+	if len(s.LatestProof) > 0 {
+		tuple, err := c.restoreTuple(s.LatestProof)
+		if err != nil {
+			return err
+		}
+		m := tuple.Message
+		if m.Type != MessageType_Decide || m.Height != s.LatestHeight || m.Round != s.LatestRound || tuple.StateHash != c.stateHash(s.LatestState) {
+			return ErrSnapshotMessage
+		}
+		// the height is checked against the snapshot's above
+		latestHeight := c.latestHeight
+		c.latestHeight = 0
+		err = c.verifyDecideMessage(m, tuple.Signed)
+		c.latestHeight = latestHeight
+		if err != nil {
+			return err
+		}
+		latestProof = tuple.Signed
+	} else if s.LatestHeight != c.latestHeight || c.stateHash(s.LatestState) != c.stateHash(c.latestState) {
+		// the height & state can't change without a <decide> message
+		return ErrSnapshotMessage
+	}
+
+	for _, state := range s.Unconfirmed {
+		if !c.stateValidate(state) {
+			return ErrSnapshotMessage
+		}
+	}
+
+	var rounds []*consensusRound
+	var currentRound *consensusRound
+	for k, rs := range s.Rounds {
+		if rs.Stage > stageLockRelease || (k > 0 && rs.RoundNumber <= s.Rounds[k-1].RoundNumber) {
+			return ErrSnapshotMessage
+		}
+		r := newConsensusRound(rs.RoundNumber, c)
+		r.Stage = rs.Stage
+		r.RoundChangeSent = rs.RoundChangeSent
+		r.CommitSent = rs.CommitSent
+
+		var err error
+		if r.roundChanges, err = c.restoreTuples(rs.RoundChanges, MessageType_RoundChange, s.LatestHeight+1); err != nil {
+			return err
+		}
+		if r.commits, err = c.restoreTuples(rs.Commits, MessageType_Commit, s.LatestHeight+1); err != nil {
+			return err
+		}
+
+		// the leader tracks the max proposed state once it has 2t+1
+		// <roundchange>, and locks it, as in receiveMessage
+		if c.roundLeader(r.RoundNumber) == c.identity && r.RoundChangeWeight() >= 2*c.t()+1 {
+			r.MaxProposedState, r.MaxProposedWeight = r.GetMaxProposed()
+		}
+		if rs.LockedState != nil && r.MaxProposedWeight >= 2*c.t()+1 && c.stateHash(rs.LockedState) == c.stateHash(r.MaxProposedState) {
+			r.LockedState = r.MaxProposedState
+			r.LockedStateHash = c.stateHash(r.MaxProposedState)
+		}
+		rounds = append(rounds, r)
+		if s.CurrentRound != nil && *s.CurrentRound == r.RoundNumber {
+			currentRound = r
+		}
+	}
+	if s.CurrentRound != nil && currentRound == nil {
+		return ErrSnapshotMessage
+	}
+
+	locks, err := c.restoreTuples(s.Locks, MessageType_Lock, s.LatestHeight+1)
+	if err != nil {
+		return err
+	}
+
+	var lastRoundChangeProof []*SignedProto
+	for _, bts := range s.LastRoundChangeProof {
+		tuple, err := c.restoreTuple(bts)
+		if err != nil {
+			return err
+		}
+		lastRoundChangeProof = append(lastRoundChangeProof, tuple.Signed)
+	}
+
+	goneLeaders := make(map[Identity]bool)
+	for _, bts := range s.GoneLeaders {
+		var id Identity
+		if len(bts) != len(id) {
+			return ErrSnapshotMessage
+		}
+		copy(id[:], bts)
+		goneLeaders[id] = true
+	}
+
+	// all verified, replace the state
+	c.latestState = s.LatestState
+	c.latestHeight = s.LatestHeight
+	c.latestRound = s.LatestRound
+	c.latestProof = latestProof
+	c.unconfirmed = s.Unconfirmed
+	c.rounds.Init()
+	for _, r := range rounds {
+		c.rounds.PushBack(r)
+	}
+	c.currentRound = currentRound
+	c.rcTimeout = s.RoundChangeTimeout
+	c.lockTimeout = s.LockTimeout
+	c.commitTimeout = s.CommitTimeout
+	c.lockReleaseTimeout = s.LockReleaseTimeout
+	c.locks = locks
+	c.lastRoundChangeProof = lastRoundChangeProof
+	c.loopback = s.Loopback
+	c.unverified = make(map[*SignedProto]bool)
+	c.goneLeaders = goneLeaders
+	if s.Latency > 0 {
+		c.latency = s.Latency
+	}
+	return nil
+}
+
+// restoreTuple verifies & decodes a signed message of a snapshot
+func (c *Consensus) restoreTuple(bts []byte) (tuple messageTuple, err error) {
+	signed, err := DecodeSignedMessage(bts)
+	if err != nil {
+		return tuple, err
+	}
+	m, err := c.verifyMessage(signed)
+	if err != nil {
+		return tuple, err
+	}
+	return messageTuple{StateHash: c.stateHash(m.State), Message: m, Signed: signed, Weight: c.signerWeight(signed)}, nil
+}
+
+// restoreTuples restores the messages of the type at the height
+func (c *Consensus) restoreTuples(msgs [][]byte, typ MessageType, height uint64) ([]messageTuple, error) {
+	var tuples []messageTuple
+	for _, bts := range msgs {
+		tuple, err := c.restoreTuple(bts)
+		if err != nil {
+			return nil, err
+		}
+		if tuple.Message.Type != typ || tuple.Message.Height != height {
+			return nil, ErrSnapshotMessage
+		}
+		tuples = append(tuples, tuple)
+	}
+	return tuples, nil
+}
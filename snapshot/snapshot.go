@@ -0,0 +1,189 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/yonggewang/bdls"
+)
+
+const (
+	// LatestName is the object name pointing to the latest snapshot
+	LatestName = "latest"
+	// the suffix of snapshot object names
+	snapshotSuffix = ".decide"
+)
+
+// Name returns the object name of the snapshot at height, heights are zero
+// padded to list snapshots in order.
+func Name(height uint64) string {
+	return fmt.Sprintf("%020d%v", height, snapshotSuffix)
+}
+
+// Publish uploads a <decide> message as the snapshot of it's height, then
+// points LatestName to it.
+func Publish(ctx context.Context, store Store, proof *bdls.SignedProto) (height uint64, err error) {
+	m, err := bdls.DecodeMessage(proof.Message)
+	if err != nil {
+		return 0, err
+	}
+	if m.Type != bdls.MessageType_Decide {
+		return 0, ErrNotDecide
+	}
+
+	bts, err := proto.Marshal(proof)
+	if err != nil {
+		return 0, err
+	}
+
+	// the snapshot must be stored before the pointer
+	name := Name(m.Height)
+	if err := store.Put(ctx, name, bts); err != nil {
+		return 0, err
+	}
+	if err := store.Put(ctx, LatestName, []byte(name)); err != nil {
+		return 0, err
+	}
+	return m.Height, nil
+}
+
+// Bootstrap fetches the latest snapshot and feeds it to the consensus, the
+// certificate is verified against the participants of the consensus, which
+// will then continue from the height of the snapshot.
+//
+// The consensus is not thread-safe, Bootstrap must be called before it has
+// been handed to an agent.
+func Bootstrap(ctx context.Context, store Store, consensus *bdls.Consensus) (height uint64, err error) {
+	bts, err := store.Get(ctx, LatestName)
+	if err != nil {
+		return 0, err
+	}
+
+	name := strings.TrimSpace(string(bts))
+	var expected uint64
+	if _, err := fmt.Sscanf(name, "%020d"+snapshotSuffix, &expected); err != nil || Name(expected) != name {
+		return 0, ErrSnapshotName
+	}
+
+	bts, err = store.Get(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	signed, err := bdls.DecodeSignedMessage(bts)
+	if err != nil {
+		return 0, err
+	}
+	m, err := bdls.DecodeMessage(signed.Message)
+	if err != nil {
+		return 0, err
+	}
+	if m.Type != bdls.MessageType_Decide {
+		return 0, ErrNotDecide
+	}
+	if m.Height != expected {
+		return 0, ErrSnapshotHeight
+	}
+
+	if err := consensus.ReceiveMessage(bts, time.Now()); err != nil {
+		return 0, err
+	}
+
+	if height, _, _ := consensus.CurrentState(); height != m.Height {
+		return 0, ErrBootstrap
+	}
+	return m.Height, nil
+}
+
+// Publisher publishes the latest <decide> message periodically
+type Publisher struct {
+	store     Store
+	source    func() *bdls.SignedProto
+	published uint64 // the latest published height
+	sync.Mutex
+}
+
+// NewPublisher creates a Publisher, source returns the latest <decide>
+// message, like TCPAgent.GetLatestProof, or nil if there is none.
+func NewPublisher(store Store, source func() *bdls.SignedProto) *Publisher {
+	p := new(Publisher)
+	p.store = store
+	p.source = source
+	return p
+}
+
+// PublishLatest publishes the latest <decide> message if it's height is
+// higher than the published one.
+func (p *Publisher) PublishLatest(ctx context.Context) error {
+	p.Lock()
+	defer p.Unlock()
+
+	proof := p.source()
+	if proof == nil {
+		return nil
+	}
+
+	m, err := bdls.DecodeMessage(proof.Message)
+	if err != nil {
+		return err
+	}
+	if m.Height <= p.published {
+		return nil
+	}
+
+	height, err := Publish(ctx, p.store, proof)
+	if err != nil {
+		return err
+	}
+	p.published = height
+	return nil
+}
+
+// Run publishes the latest <decide> message at every interval until ctx is
+// done, failed uploads are retried at the next interval.
+func (p *Publisher) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = p.PublishLatest(ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	agent "github.com/yonggewang/bdls/agent-tcp"
+)
+
+func newTestConsensus(t *testing.T, privateKey *ecdsa.PrivateKey, participants []bdls.Identity) *bdls.Consensus {
+	config := new(bdls.Config)
+	config.Epoch = time.Now()
+	config.PrivateKey = privateKey
+	config.Participants = participants
+	config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+	config.StateValidate = func(a bdls.State) bool { return true }
+
+	consensus, err := bdls.NewConsensus(config)
+	assert.Nil(t, err)
+	consensus.SetLatency(200 * time.Millisecond)
+	return consensus
+}
+
+// decide runs consensus to height 1, returns the participants and the <decide> message
+func decide(t *testing.T) ([]bdls.Identity, *bdls.SignedProto) {
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	agents := make([]*agent.TCPAgent, len(keys))
+	for i := range keys {
+		agents[i] = agent.NewTCPAgent(newTestConsensus(t, keys[i], participants), keys[i])
+		defer agents[i].Close()
+	}
+
+	for i := 0; i < len(agents); i++ {
+		for j := i + 1; j < len(agents); j++ {
+			c1, c2 := net.Pipe()
+			p1 := agent.NewTCPPeer(c1, agents[i])
+			p2 := agent.NewTCPPeer(c2, agents[j])
+			assert.True(t, agents[i].AddPeer(p1))
+			assert.True(t, agents[j].AddPeer(p2))
+			p1.InitiatePublicKeyAuthentication()
+			p2.InitiatePublicKeyAuthentication()
+		}
+	}
+	<-time.After(time.Second)
+
+	for i := range agents {
+		agents[i].Update()
+		data := make([]byte, 1024)
+		io.ReadFull(rand.Reader, data)
+		assert.Nil(t, agents[i].Propose(data))
+	}
+
+	deadline := time.Now().Add(20 * time.Second)
+	for time.Now().Before(deadline) {
+		if proof := agents[0].GetLatestProof(); proof != nil {
+			return participants, proof
+		}
+		<-time.After(20 * time.Millisecond)
+	}
+	t.Fatal("consensus didn't decide")
+	return nil, nil
+}
+
+// memStore is an in-memory Store served over http
+type memStore struct {
+	objects map[string][]byte
+	sync.Mutex
+}
+
+func (s *memStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodPut:
+		bts, _ := io.ReadAll(r.Body)
+		s.objects[name] = bts
+	case http.MethodGet:
+		bts, ok := s.objects[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(bts)
+	}
+}
+
+func TestPublishBootstrap(t *testing.T) {
+	participants, proof := decide(t)
+
+	ms := &memStore{objects: make(map[string][]byte)}
+	ts := httptest.NewTLSServer(ms)
+	defer ts.Close()
+	store := &HTTPStore{BaseURL: ts.URL, Client: ts.Client()}
+
+	// nothing published
+	key, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	_, err = Bootstrap(context.Background(), store, newTestConsensus(t, key, participants))
+	assert.NotNil(t, err)
+
+	publisher := NewPublisher(store, func() *bdls.SignedProto { return proof })
+	assert.Nil(t, publisher.PublishLatest(context.Background()))
+	assert.Equal(t, []byte(Name(1)), ms.objects[LatestName])
+
+	// a new node with a key not in the participants
+	consensus := newTestConsensus(t, key, participants)
+	height, err := Bootstrap(context.Background(), store, consensus)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), height)
+
+	// the certificate is verified against participants
+	other, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	others := append([]bdls.Identity{bdls.DefaultPubKeyToIdentity(&other.PublicKey)}, participants[1:]...)
+	_, err = Bootstrap(context.Background(), store, newTestConsensus(t, key, others))
+	assert.NotNil(t, err)
+
+	// tampered snapshot
+	ms.objects[Name(1)][len(ms.objects[Name(1)])/2] ^= 0xff
+	_, err = Bootstrap(context.Background(), store, newTestConsensus(t, key, participants))
+	assert.NotNil(t, err)
+}
+
+func TestDirStore(t *testing.T) {
+	store := DirStore(t.TempDir())
+	assert.Nil(t, store.Put(context.Background(), LatestName, []byte("a")))
+	assert.Nil(t, store.Put(context.Background(), LatestName, []byte("b")))
+	bts, err := store.Get(context.Background(), LatestName)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), bts)
+
+	// malformed pointer
+	_, err = Bootstrap(context.Background(), store, nil)
+	assert.Equal(t, ErrSnapshotName, err)
+}
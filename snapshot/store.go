@@ -0,0 +1,173 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// MaxObjectSize is the max size of an object to get
+	MaxObjectSize = 32 << 20
+)
+
+// Store is an object storage for snapshots
+type Store interface {
+	// Put stores data as object name
+	Put(ctx context.Context, name string, data []byte) error
+	// Get retrieves the object name
+	Get(ctx context.Context, name string) ([]byte, error)
+}
+
+// DirStore stores objects as files in a directory, objects are replaced
+// atomically.
+type DirStore string
+
+// Put implements Store
+func (dir DirStore) Put(ctx context.Context, name string, data []byte) error {
+	file, err := os.CreateTemp(string(dir), ".snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filepath.Join(string(dir), filepath.Base(name)))
+}
+
+// Get implements Store
+func (dir DirStore) Get(ctx context.Context, name string) ([]byte, error) {
+	file, err := os.Open(filepath.Join(string(dir), filepath.Base(name)))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readObject(file)
+}
+
+// HTTPStore stores objects on a S3-compatible or plain HTTP(s) storage, with
+// PUT & GET requests to BaseURL/name.
+type HTTPStore struct {
+	BaseURL string
+	// Client to send requests, http.DefaultClient is used if nil
+	Client *http.Client
+	// (optional) Sign authorizes a request before being sent, like AWS
+	// signature V4, it's not required for presigned or public buckets.
+	Sign func(req *http.Request) error
+}
+
+// Put implements Store
+func (s *HTTPStore) Put(ctx context.Context, name string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.url(name), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get implements Store
+func (s *HTTPStore) Get(ctx context.Context, name string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url(name), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readObject(resp.Body)
+}
+
+func (s *HTTPStore) url(name string) string {
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + name
+}
+
+// do sends a signed request, non-2xx responses are returned as errors
+func (s *HTTPStore) do(req *http.Request) (*http.Response, error) {
+	if s.Sign != nil {
+		if err := s.Sign(req); err != nil {
+			return nil, err
+		}
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%v %v: %v", req.Method, req.URL, resp.Status)
+	}
+	return resp, nil
+}
+
+// readObject reads an object up to MaxObjectSize
+func readObject(r io.Reader) ([]byte, error) {
+	bts, err := io.ReadAll(io.LimitReader(r, MaxObjectSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(bts) > MaxObjectSize {
+		return nil, ErrObjectSize
+	}
+	return bts, nil
+}
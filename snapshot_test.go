@@ -0,0 +1,155 @@
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []Identity
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	epoch := time.Now()
+	newConfig := func(privateKey *ecdsa.PrivateKey) *Config {
+		config := new(Config)
+		config.Epoch = epoch
+		config.PrivateKey = privateKey
+		config.Participants = coords
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a State) bool { return true }
+		return config
+	}
+
+	var peers []*IPCPeer
+	for i := range participants {
+		consensus, err := NewConsensus(newConfig(participants[i]))
+		assert.Nil(t, err)
+		consensus.SetLatency(50 * time.Millisecond)
+		peers = append(peers, NewIPCPeer(consensus, 10*time.Millisecond))
+	}
+	for i := range peers {
+		for j := range peers {
+			if i != j {
+				assert.True(t, peers[i].c.Join(peers[j]))
+			}
+		}
+	}
+	for i := range peers {
+		peers[i].Update()
+		data := make([]byte, 1024)
+		io.ReadFull(rand.Reader, data)
+		peers[i].Propose(data)
+	}
+	defer func() {
+		for i := range peers {
+			peers[i].Close()
+		}
+	}()
+	assert.Eventually(t, func() bool { h, _, _ := peers[0].GetLatestState(); return h > 0 }, 20*time.Second, 20*time.Millisecond)
+
+	peers[0].Lock()
+	snapshot, err := peers[0].c.Snapshot()
+	height, round, state := peers[0].c.CurrentState()
+	peers[0].Unlock()
+	assert.Nil(t, err)
+
+	// restored on another host, with the same config
+	restored, err := NewConsensus(newConfig(participants[0]))
+	assert.Nil(t, err)
+	assert.Nil(t, restored.Restore(snapshot))
+	h, r, s := restored.CurrentState()
+	assert.Equal(t, height, h)
+	assert.Equal(t, round, r)
+	assert.Equal(t, state, s)
+	again, err := restored.Snapshot()
+	assert.Nil(t, err)
+	assert.Equal(t, snapshot, again)
+
+	// the snapshot of another participant
+	other, err := NewConsensus(newConfig(participants[1]))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrSnapshotIdentity, other.Restore(snapshot))
+
+	// a tampered snapshot leaves the state unchanged
+	fresh, err := NewConsensus(newConfig(participants[0]))
+	assert.Nil(t, err)
+	var tampered consensusSnapshot
+	assert.Nil(t, json.Unmarshal(snapshot, &tampered))
+	tampered.LatestHeight++
+	bts, err := json.Marshal(&tampered)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrSnapshotMessage, fresh.Restore(bts))
+	h, _, _ = fresh.CurrentState()
+	assert.Equal(t, uint64(0), h)
+
+	tampered.Version = 0
+	bts, err = json.Marshal(&tampered)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrSnapshotVersion, fresh.Restore(bts))
+
+	// the latest state must be the one decided
+	tampered = consensusSnapshot{}
+	assert.Nil(t, json.Unmarshal(snapshot, &tampered))
+	tampered.LatestState = []byte("forged")
+	bts, err = json.Marshal(&tampered)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrSnapshotMessage, fresh.Restore(bts))
+
+	// the locked states are not taken from the snapshot
+	tampered = consensusSnapshot{}
+	assert.Nil(t, json.Unmarshal(snapshot, &tampered))
+	for k := range tampered.Rounds {
+		tampered.Rounds[k].LockedState = []byte("forged")
+	}
+	bts, err = json.Marshal(&tampered)
+	assert.Nil(t, err)
+	assert.Nil(t, fresh.Restore(bts))
+	for elem := fresh.rounds.Front(); elem != nil; elem = elem.Next() {
+		assert.NotEqual(t, State("forged"), elem.Value.(*consensusRound).LockedState)
+	}
+}
+
+func TestSnapshotUnverified(t *testing.T) {
+	var signers []*ecdsa.PrivateKey
+	var quorum []*ecdsa.PublicKey
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		signers = append(signers, privateKey)
+		quorum = append(quorum, &privateKey.PublicKey)
+	}
+	consensus := createConsensus(t, 0, 0, quorum)
+
+	// a forged <roundchange> accepted without it's signature verified
+	_, signed, _ := createRoundChangeMessageSigner(t, 1, 1, []byte{1}, signers[0])
+	signed.S[0] ^= 0xff
+	bts, err := proto.Marshal(signed)
+	assert.Nil(t, err)
+	assert.Nil(t, consensus.ReceiveAuthenticatedMessage(bts, &signers[0].PublicKey, time.Now()))
+	assert.Equal(t, 1, consensus.getRound(1, false).NumRoundChanges())
+
+	// it's left out of the snapshot, which is restored
+	snapshot, err := consensus.Snapshot()
+	assert.Nil(t, err)
+	var s consensusSnapshot
+	assert.Nil(t, json.Unmarshal(snapshot, &s))
+	for _, rs := range s.Rounds {
+		assert.Equal(t, 0, len(rs.RoundChanges))
+	}
+	assert.Nil(t, consensus.Restore(snapshot))
+	assert.Equal(t, 0, consensus.getRound(1, false).NumRoundChanges())
+}
@@ -0,0 +1,146 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package telemetry
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// OtherLabel is the label value aggregating values beyond the limit
+	OtherLabel = "other"
+
+	// DefaultHeightSampleEvery samples per-height telemetry every 100 heights
+	DefaultHeightSampleEvery = 100
+	// DefaultMaxPeerLabels is the default max number of peers with their own series
+	DefaultMaxPeerLabels = 64
+)
+
+// Sampler samples per-height telemetry, heights are sampled if they are
+// multiples of the rate, so all validators sample the same heights and
+// their traces can be correlated.
+type Sampler struct {
+	every atomic.Uint64
+}
+
+// NewSampler creates a Sampler to sample every n heights
+func NewSampler(n uint64) *Sampler {
+	s := new(Sampler)
+	s.every.Store(n)
+	return s
+}
+
+// SetEvery sets the sample rate to every n heights, 1 samples all heights,
+// 0 disables sampling.
+func (s *Sampler) SetEvery(n uint64) { s.every.Store(n) }
+
+// Every returns the sample rate
+func (s *Sampler) Every() uint64 { return s.every.Load() }
+
+// Sample returns true if telemetry at height should be recorded
+func (s *Sampler) Sample(height uint64) bool {
+	n := s.every.Load()
+	return n != 0 && height%n == 0
+}
+
+// LabelLimiter bounds the distinct values of a label, like peer identities,
+// the first values up to the limit keep their own series, the others are
+// aggregated as OtherLabel.
+type LabelLimiter struct {
+	max  int
+	seen map[string]struct{}
+	sync.Mutex
+}
+
+// NewLabelLimiter creates a LabelLimiter allowing max distinct values
+func NewLabelLimiter(max int) *LabelLimiter {
+	l := new(LabelLimiter)
+	l.max = max
+	l.seen = make(map[string]struct{})
+	return l
+}
+
+// Label returns the label value to record v with
+func (l *LabelLimiter) Label(v string) string {
+	l.Lock()
+	defer l.Unlock()
+	if _, ok := l.seen[v]; ok {
+		return v
+	}
+
+	if len(l.seen) < l.max {
+		l.seen[v] = struct{}{}
+		return v
+	}
+	return OtherLabel
+}
+
+// Forget releases the value v, like a disconnected peer, to make room for
+// other values.
+func (l *LabelLimiter) Forget(v string) {
+	l.Lock()
+	defer l.Unlock()
+	delete(l.seen, v)
+}
+
+// SetMax sets the max distinct values, 0 aggregates all values. If the
+// limit shrinks below the values seen, all values are forgotten to be
+// admitted again.
+func (l *LabelLimiter) SetMax(max int) {
+	l.Lock()
+	defer l.Unlock()
+	l.max = max
+	if len(l.seen) > max {
+		l.seen = make(map[string]struct{})
+	}
+}
+
+// Max returns the max distinct values
+func (l *LabelLimiter) Max() int {
+	l.Lock()
+	defer l.Unlock()
+	return l.max
+}
+
+// Controls groups the sampling and cardinality controls of an agent
+type Controls struct {
+	Heights *Sampler      // per-height metrics & traces
+	Peers   *LabelLimiter // per-peer series
+}
+
+// NewControls creates Controls with safe defaults
+func NewControls() *Controls {
+	return &Controls{
+		Heights: NewSampler(DefaultHeightSampleEvery),
+		Peers:   NewLabelLimiter(DefaultMaxPeerLabels),
+	}
+}
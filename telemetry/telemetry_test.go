@@ -0,0 +1,51 @@
+package telemetry
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampler(t *testing.T) {
+	s := NewSampler(10)
+	assert.True(t, s.Sample(0))
+	assert.False(t, s.Sample(5))
+	assert.True(t, s.Sample(20))
+
+	s.SetEvery(1)
+	assert.True(t, s.Sample(5))
+
+	s.SetEvery(0)
+	assert.False(t, s.Sample(0))
+	assert.False(t, s.Sample(5))
+}
+
+func TestLabelLimiter(t *testing.T) {
+	l := NewLabelLimiter(2)
+	assert.Equal(t, "a", l.Label("a"))
+	assert.Equal(t, "b", l.Label("b"))
+	assert.Equal(t, OtherLabel, l.Label("c"))
+	assert.Equal(t, "a", l.Label("a"))
+
+	// released values make room
+	l.Forget("a")
+	assert.Equal(t, "c", l.Label("c"))
+	assert.Equal(t, OtherLabel, l.Label("a"))
+
+	// aggregate all
+	l.SetMax(0)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, OtherLabel, l.Label(fmt.Sprint(i)))
+	}
+
+	l.SetMax(1)
+	assert.Equal(t, "x", l.Label("x"))
+	assert.Equal(t, OtherLabel, l.Label("y"))
+}
+
+func TestDefaults(t *testing.T) {
+	c := NewControls()
+	assert.Equal(t, uint64(DefaultHeightSampleEvery), c.Heights.Every())
+	assert.Equal(t, DefaultMaxPeerLabels, c.Peers.Max())
+}
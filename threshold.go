@@ -0,0 +1,415 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"math/bits"
+
+	"golang.org/x/crypto/bn256"
+)
+
+// ErrThresholdKey will be returned if a threshold key or share is malformed
+var ErrThresholdKey = errors.New("incorrect threshold key format")
+
+// ThresholdPublicKey is the group public key of a t-of-n threshold BLS key,
+// along with the verification keys of the shares of the participants, see
+// Config.ThresholdPublicKey.
+type ThresholdPublicKey struct {
+	// Threshold is the number of shares required to sign
+	Threshold int
+
+	pk     *bn256.G2
+	shares []*bn256.G2
+}
+
+// ThresholdKeyShare is the share of a participant of a threshold BLS key,
+// see Config.ThresholdKey.
+type ThresholdKeyShare struct {
+	// Index is the 1-based index of the share, the share of k-th
+	// participant in Config.Participants is k+1.
+	Index int
+
+	x *big.Int
+}
+
+// GenerateThresholdKeys generates a threshold key of n shares by a trusted
+// dealer, any threshold of the shares can sign. Without a trusted dealer,
+// the participants shall run a distributed key generation with
+// NewThresholdDealing instead.
+func GenerateThresholdKeys(threshold int, n int, r io.Reader) (*ThresholdPublicKey, []*ThresholdKeyShare, error) {
+	dealing, err := NewThresholdDealing(threshold, n, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pk *ThresholdPublicKey
+	shares := make([]*ThresholdKeyShare, n)
+	for i := range shares {
+		shares[i], pk, err = CombineThresholdDealings(n, i+1, [][][]byte{dealing.Commitments}, [][]byte{dealing.Shares[i]})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return pk, shares, nil
+}
+
+// ThresholdDealing is the dealing of a participant in a distributed key
+// generation of Joint-Feldman, all the n participants deal a random secret
+// with NewThresholdDealing, the Commitments are broadcasted, and Shares[i]
+// is sent privately to the participant of index i+1, who verifies it with
+// VerifyThresholdShare. The participants agree on the dealers whose shares
+// are all valid, then everyone combines the dealings of these dealers with
+// CombineThresholdDealings into the same threshold key.
+//
+// The exchange of the dealings is left to the caller, so an external DKG
+// can drive the key generation too.
+type ThresholdDealing struct {
+	// Commitments is the polynomial of the dealing committed on G2
+	Commitments [][]byte
+	// Shares is the private share of each participant
+	Shares [][]byte
+}
+
+// NewThresholdDealing creates a dealing of a random secret to n participants
+func NewThresholdDealing(threshold int, n int, r io.Reader) (*ThresholdDealing, error) {
+	if threshold < 1 || threshold > n {
+		return nil, ErrThresholdKey
+	}
+	if r == nil {
+		r = rand.Reader
+	}
+
+	// f(x) = a0 + a1*x + ... + a(t-1)*x^(t-1)
+	dealing := new(ThresholdDealing)
+	poly := make([]*big.Int, threshold)
+	for j := range poly {
+		a, commitment, err := bn256.RandomG2(r)
+		if err != nil {
+			return nil, err
+		}
+		poly[j] = a
+		dealing.Commitments = append(dealing.Commitments, commitment.Marshal())
+	}
+	for i := 1; i <= n; i++ {
+		share := make([]byte, 32)
+		dealing.Shares = append(dealing.Shares, thresholdEvalPoly(poly, i).FillBytes(share))
+	}
+	return dealing, nil
+}
+
+// VerifyThresholdShare verifies the share of the participant of index from
+// a dealing with the commitments.
+func VerifyThresholdShare(commitments [][]byte, index int, share []byte) bool {
+	poly, err := thresholdUnmarshalCommitments(commitments)
+	if err != nil || len(share) != 32 {
+		return false
+	}
+	return string(new(bn256.G2).ScalarBaseMult(new(big.Int).SetBytes(share)).Marshal()) ==
+		string(thresholdEvalCommitments(poly, index).Marshal())
+}
+
+// CombineThresholdDealings combines the shares of the participant of index
+// from the agreed dealings into it's key share, and the threshold key of
+// n participants. The commitments and shares must have been verified by
+// VerifyThresholdShare.
+func CombineThresholdDealings(n int, index int, commitments [][][]byte, shares [][]byte) (*ThresholdKeyShare, *ThresholdPublicKey, error) {
+	if len(commitments) == 0 || len(commitments) != len(shares) || index < 1 || index > n {
+		return nil, nil, ErrThresholdKey
+	}
+
+	// the coefficients of the sum of the polynomials
+	var poly []*bn256.G2
+	x := new(big.Int)
+	for d := range commitments {
+		dealt, err := thresholdUnmarshalCommitments(commitments[d])
+		if err != nil || (poly != nil && len(dealt) != len(poly)) || len(shares[d]) != 32 {
+			return nil, nil, ErrThresholdKey
+		}
+		if poly == nil {
+			poly = dealt
+		} else {
+			for j := range poly {
+				poly[j] = new(bn256.G2).Add(poly[j], dealt[j])
+			}
+		}
+		x.Add(x, new(big.Int).SetBytes(shares[d]))
+	}
+	x.Mod(x, bn256.Order)
+
+	pk := &ThresholdPublicKey{Threshold: len(poly), pk: poly[0]}
+	for i := 1; i <= n; i++ {
+		pk.shares = append(pk.shares, thresholdEvalCommitments(poly, i))
+	}
+	return &ThresholdKeyShare{Index: index, x: x}, pk, nil
+}
+
+// Marshal encodes the threshold key as the threshold & the number of
+// shares in 32-bit big-endian, followed by the group public key & the
+// verification keys of the shares.
+func (pk *ThresholdPublicKey) Marshal() []byte {
+	data := make([]byte, 8, 8+128*(1+len(pk.shares)))
+	binary.BigEndian.PutUint32(data, uint32(pk.Threshold))
+	binary.BigEndian.PutUint32(data[4:], uint32(len(pk.shares)))
+	data = append(data, pk.pk.Marshal()...)
+	for _, share := range pk.shares {
+		data = append(data, share.Marshal()...)
+	}
+	return data
+}
+
+// UnmarshalThresholdPublicKey decodes a threshold key encoded by Marshal
+func UnmarshalThresholdPublicKey(data []byte) (*ThresholdPublicKey, error) {
+	if len(data) < 8 {
+		return nil, ErrThresholdKey
+	}
+	threshold := int(binary.BigEndian.Uint32(data))
+	n := int(binary.BigEndian.Uint32(data[4:]))
+	if threshold < 1 || threshold > n || len(data) != 8+128*(1+n) {
+		return nil, ErrThresholdKey
+	}
+
+	points, err := thresholdUnmarshalCommitments(splitBytes(data[8:], 128))
+	if err != nil {
+		return nil, err
+	}
+	return &ThresholdPublicKey{Threshold: threshold, pk: points[0], shares: points[1:]}, nil
+}
+
+// Marshal encodes the share as the index in 32-bit big-endian, followed by
+// the secret in 32 bytes.
+func (s *ThresholdKeyShare) Marshal() []byte {
+	data := make([]byte, 36)
+	binary.BigEndian.PutUint32(data, uint32(s.Index))
+	s.x.FillBytes(data[4:])
+	return data
+}
+
+// UnmarshalThresholdKeyShare decodes a share encoded by Marshal
+func UnmarshalThresholdKeyShare(data []byte) (*ThresholdKeyShare, error) {
+	if len(data) != 36 {
+		return nil, ErrThresholdKey
+	}
+	x := new(big.Int).SetBytes(data[4:])
+	index := int(binary.BigEndian.Uint32(data))
+	if index < 1 || x.Cmp(bn256.Order) >= 0 {
+		return nil, ErrThresholdKey
+	}
+	return &ThresholdKeyShare{Index: index, x: x}, nil
+}
+
+// sign signs the digest with the share, the partial signature is a point on G1
+func (s *ThresholdKeyShare) sign(digest []byte) []byte {
+	return new(bn256.G1).ScalarMult(blsHashToG1(digest), s.x).Marshal()
+}
+
+// combine interpolates the partial signatures of the shares of the indices
+// into the signature of the group key, which requires Threshold of them.
+func (pk *ThresholdPublicKey) combine(indices []int, sigs [][]byte) ([]byte, bool) {
+	if len(indices) < pk.Threshold {
+		return nil, false
+	}
+	indices, sigs = indices[:pk.Threshold], sigs[:pk.Threshold]
+
+	var sum *bn256.G1
+	for k, i := range indices {
+		p, ok := new(bn256.G1).Unmarshal(sigs[k])
+		if !ok {
+			return nil, false
+		}
+		p = new(bn256.G1).ScalarMult(p, thresholdLagrange(indices, i))
+		if sum == nil {
+			sum = p
+		} else {
+			sum = new(bn256.G1).Add(sum, p)
+		}
+	}
+	return sum.Marshal(), true
+}
+
+// thresholdLagrange returns the Lagrange coefficient at 0 of i in indices
+func thresholdLagrange(indices []int, i int) *big.Int {
+	num, den := big.NewInt(1), big.NewInt(1)
+	for _, j := range indices {
+		if j == i {
+			continue
+		}
+		num.Mul(num, big.NewInt(int64(j)))
+		num.Mod(num, bn256.Order)
+		den.Mul(den, big.NewInt(int64(j-i)))
+		den.Mod(den, bn256.Order)
+	}
+	return num.Mul(num, den.ModInverse(den, bn256.Order)).Mod(num, bn256.Order)
+}
+
+// thresholdEvalPoly evaluates the polynomial at x
+func thresholdEvalPoly(poly []*big.Int, x int) *big.Int {
+	y := new(big.Int)
+	bx := big.NewInt(int64(x))
+	for j := len(poly) - 1; j >= 0; j-- {
+		y.Mul(y, bx)
+		y.Add(y, poly[j])
+		y.Mod(y, bn256.Order)
+	}
+	return y
+}
+
+// thresholdEvalCommitments evaluates the polynomial committed on G2 at x
+func thresholdEvalCommitments(poly []*bn256.G2, x int) *bn256.G2 {
+	y := poly[len(poly)-1]
+	bx := big.NewInt(int64(x))
+	for j := len(poly) - 2; j >= 0; j-- {
+		y = new(bn256.G2).Add(new(bn256.G2).ScalarMult(y, bx), poly[j])
+	}
+	return y
+}
+
+// thresholdUnmarshalCommitments decodes the points on G2
+func thresholdUnmarshalCommitments(commitments [][]byte) ([]*bn256.G2, error) {
+	if len(commitments) == 0 {
+		return nil, ErrThresholdKey
+	}
+	points := make([]*bn256.G2, len(commitments))
+	for j := range commitments {
+		p, ok := new(bn256.G2).Unmarshal(commitments[j])
+		if !ok {
+			return nil, ErrThresholdKey
+		}
+		points[j] = p
+	}
+	return points, nil
+}
+
+// splitBytes splits data into chunks of size
+func splitBytes(data []byte, size int) [][]byte {
+	var chunks [][]byte
+	for len(data) >= size {
+		chunks = append(chunks, data[:size])
+		data = data[size:]
+	}
+	return chunks
+}
+
+// shareIndex returns the index of the share of a participant, 0 if it's
+// not a participant.
+func (c *Consensus) shareIndex(id Identity) int {
+	for k := range c.participants {
+		if c.participants[k] == id {
+			return k + 1
+		}
+	}
+	return 0
+}
+
+// decideWeight returns the weight of <commit> messages for the leader to
+// decide, which must be enough shares to combine in the threshold mode.
+func (c *Consensus) decideWeight() uint64 {
+	quorum := 2*c.t() + 1
+	if c.thresholdPublicKey != nil && uint64(c.thresholdPublicKey.Threshold) > quorum {
+		return uint64(c.thresholdPublicKey.Threshold)
+	}
+	return quorum
+}
+
+// signCommitThreshold returns the partial signature of this participant for
+// <commit>
+func (c *Consensus) signCommitThreshold(m *Message) []byte {
+	return c.thresholdKey.sign(blsCommitDigest(m.Height, m.Round, c.stateHash(m.State)))
+}
+
+// verifyCommitThreshold verifies the partial signature of a <commit>
+// message by the share of the signer.
+func (c *Consensus) verifyCommitThreshold(m *Message, signed *SignedProto) error {
+	id := c.pubKeyToIdentity(signed.PublicKey(c.curve))
+	i := c.shareIndex(id)
+	digest := blsCommitDigest(m.Height, m.Round, c.stateHash(m.State))
+	if c.preverified[shareKey(id, digest, m.BLSSignature)] && i > 0 {
+		return nil
+	}
+	if i == 0 || !blsVerify(c.thresholdPublicKey.shares[i-1], digest, m.BLSSignature) {
+		return ErrCommitBLSSignature
+	}
+	return nil
+}
+
+// combineCommitsThreshold combines the partial signatures of the <commit>
+// messages to the locked state in current round into the threshold
+// signature, along with the bitmap of the signers of the partials combined,
+// in the order of the participants.
+func (c *Consensus) combineCommitsThreshold() (sig []byte, signers []byte) {
+	var indices []int
+	var sigs [][]byte
+	for _, commit := range c.currentRound.commits {
+		if commit.StateHash != c.currentRound.LockedStateHash {
+			continue
+		}
+		if len(indices) == c.thresholdPublicKey.Threshold {
+			break
+		}
+		indices = append(indices, c.shareIndex(c.pubKeyToIdentity(commit.Signed.PublicKey(c.curve))))
+		sigs = append(sigs, commit.Message.BLSSignature)
+	}
+
+	signers = make([]byte, (len(c.participants)+7)/8)
+	for _, i := range indices {
+		signers[(i-1)/8] |= 1 << ((i - 1) % 8)
+	}
+	sig, _ = c.thresholdPublicKey.combine(indices, sigs)
+	return sig, signers
+}
+
+// verifyDecideThreshold verifies the threshold signature of a <decide>
+// message by the group key, the signers of the partials combined must be
+// enough participants for the threshold.
+func (c *Consensus) verifyDecideThreshold(m *Message) error {
+	if len(m.Signers) != (len(c.participants)+7)/8 {
+		return ErrDecideProofInsufficient
+	}
+	var signers int
+	for i := range m.Signers {
+		signers += bits.OnesCount8(m.Signers[i])
+	}
+	if last := len(c.participants) % 8; last != 0 && m.Signers[len(m.Signers)-1]>>last != 0 {
+		return ErrDecideProofInsufficient
+	}
+	if signers < c.thresholdPublicKey.Threshold {
+		return ErrDecideProofInsufficient
+	}
+
+	if !blsVerify(c.thresholdPublicKey.pk, blsCommitDigest(m.Height, m.Round, c.stateHash(m.State)), m.BLSSignature) {
+		return ErrDecideThresholdSignature
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"io"
+	"math/bits"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThresholdDKG(t *testing.T) {
+	const n, threshold = 4, 3
+
+	// everyone deals, and verifies the shares dealt to it
+	var dealings []*ThresholdDealing
+	for d := 0; d < n; d++ {
+		dealing, err := NewThresholdDealing(threshold, n, rand.Reader)
+		assert.Nil(t, err)
+		dealings = append(dealings, dealing)
+	}
+	var shares []*ThresholdKeyShare
+	var keys [][]byte
+	for i := 1; i <= n; i++ {
+		var commitments [][][]byte
+		var dealt [][]byte
+		for _, dealing := range dealings {
+			assert.True(t, VerifyThresholdShare(dealing.Commitments, i, dealing.Shares[i-1]))
+			assert.False(t, VerifyThresholdShare(dealing.Commitments, i%n+1, dealing.Shares[i-1]))
+			commitments = append(commitments, dealing.Commitments)
+			dealt = append(dealt, dealing.Shares[i-1])
+		}
+		share, pk, err := CombineThresholdDealings(n, i, commitments, dealt)
+		assert.Nil(t, err)
+		shares = append(shares, share)
+		keys = append(keys, pk.Marshal())
+	}
+	for i := range keys {
+		assert.Equal(t, keys[0], keys[i])
+	}
+
+	pk, err := UnmarshalThresholdPublicKey(keys[0])
+	assert.Nil(t, err)
+	assert.Equal(t, threshold, pk.Threshold)
+	share, err := UnmarshalThresholdKeyShare(shares[1].Marshal())
+	assert.Nil(t, err)
+	assert.Equal(t, shares[1].Marshal(), share.Marshal())
+
+	// any threshold of the shares signs for the group key
+	digest := blsCommitDigest(1, 0, StateHash{})
+	for _, indices := range [][]int{{1, 2, 3}, {2, 4, 1}, {4, 3, 2}} {
+		var sigs [][]byte
+		for _, i := range indices {
+			sigs = append(sigs, shares[i-1].sign(digest))
+			assert.True(t, blsVerify(pk.shares[i-1], digest, sigs[len(sigs)-1]))
+		}
+		sig, ok := pk.combine(indices, sigs)
+		assert.True(t, ok)
+		assert.True(t, blsVerify(pk.pk, digest, sig))
+	}
+	_, ok := pk.combine([]int{1, 2}, [][]byte{shares[0].sign(digest), shares[1].sign(digest)})
+	assert.False(t, ok)
+}
+
+func TestThresholdDecide(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []Identity
+	for i := 0; i < 4; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+	pk, shares, err := GenerateThresholdKeys(3, len(participants), rand.Reader)
+	assert.Nil(t, err)
+
+	epoch := time.Now()
+	newConfig := func(privateKey *ecdsa.PrivateKey, share *ThresholdKeyShare) *Config {
+		config := new(Config)
+		config.Epoch = epoch
+		config.PrivateKey = privateKey
+		config.Participants = coords
+		config.ExperimentalBN256 = true
+		config.ThresholdKey = share
+		config.ThresholdPublicKey = pk
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a State) bool { return true }
+		return config
+	}
+
+	var peers []*IPCPeer
+	for i := range participants {
+		consensus, err := NewConsensus(newConfig(participants[i], shares[i]))
+		assert.Nil(t, err)
+		consensus.SetLatency(50 * time.Millisecond)
+		peers = append(peers, NewIPCPeer(consensus, 10*time.Millisecond))
+	}
+	for i := range peers {
+		for j := range peers {
+			if i != j {
+				assert.True(t, peers[i].c.Join(peers[j]))
+			}
+		}
+	}
+	for i := range peers {
+		peers[i].Update()
+		data := make([]byte, 1024)
+		io.ReadFull(rand.Reader, data)
+		peers[i].Propose(data)
+	}
+	defer func() {
+		for i := range peers {
+			peers[i].Close()
+		}
+	}()
+
+	for i := range peers {
+		assert.Eventually(t, func() bool { h, _, _ := peers[i].GetLatestState(); return h > 0 }, 20*time.Second, 20*time.Millisecond)
+	}
+
+	// the decision certificate is a single threshold signature
+	peers[0].Lock()
+	_, _, state := peers[0].c.CurrentState()
+	signed := peers[0].c.CurrentProof()
+	peers[0].Unlock()
+	m, err := DecodeMessage(signed.Message)
+	assert.Nil(t, err)
+	assert.Empty(t, m.Proof)
+	assert.Len(t, m.BLSSignature, 64)
+	// the signers of the partials combined
+	assert.Len(t, m.Signers, 1)
+	assert.Equal(t, 3, bits.OnesCount8(m.Signers[0]))
+
+	observer, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	verifier, err := NewConsensus(newConfig(observer, nil))
+	assert.Nil(t, err)
+	decide, err := proto.Marshal(signed)
+	assert.Nil(t, err)
+	assert.Nil(t, verifier.ValidateDecideMessage(decide, state))
+
+	// the leader must name enough signers
+	var leader *ecdsa.PrivateKey
+	for _, key := range participants {
+		if DefaultPubKeyToIdentity(&key.PublicKey) == DefaultPubKeyToIdentity(signed.PublicKey(S256Curve)) {
+			leader = key
+		}
+	}
+	forged := *m
+	forged.Signers = []byte{0x01}
+	resigned := new(SignedProto)
+	resigned.Sign(&forged, leader)
+	bts, err := proto.Marshal(resigned)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrDecideProofInsufficient, verifier.ValidateDecideMessage(bts, state))
+
+	// a key of others doesn't verify
+	config := newConfig(observer, nil)
+	config.ThresholdPublicKey, _, err = GenerateThresholdKeys(3, len(participants), rand.Reader)
+	assert.Nil(t, err)
+	verifier, err = NewConsensus(config)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrDecideThresholdSignature, verifier.ValidateDecideMessage(decide, state))
+
+	// the threshold must be at least 2t+1, and not with the other modes
+	config.ThresholdPublicKey, _, err = GenerateThresholdKeys(2, len(participants), rand.Reader)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrConfigThreshold, VerifyConfig(config))
+	config = newConfig(observer, nil)
+	config.Weights = []uint64{1, 1, 1, 2}
+	assert.Equal(t, ErrConfigThresholdMode, VerifyConfig(config))
+}
@@ -0,0 +1,161 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/libp2p/go-reuseport"
+)
+
+var (
+	// ErrAddressInUse is returned by Memory.Listen if the name is taken
+	ErrAddressInUse = errors.New("memory transport address in use")
+	// ErrConnectionRefused is returned by Memory.Dial if nobody listens on the name
+	ErrConnectionRefused = errors.New("memory transport connection refused")
+)
+
+// TCP is the Transport over TCP
+type TCP struct {
+	Dialer net.Dialer // (optional) dialer options
+	// (optional) listen & dial with address and port reuse, so the
+	// connections dialed from the Dialer.LocalAddr of a listening port
+	// share it's mapping on NATs, as hole punching requires
+	ReusePort bool
+}
+
+// Dial implements Transport
+func (t *TCP) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	if t.ReusePort {
+		dialer := t.Dialer
+		dialer.Control = reuseport.Control
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+	return t.Dialer.DialContext(ctx, "tcp", addr)
+}
+
+// Listen implements Transport
+func (t *TCP) Listen(addr string) (net.Listener, error) {
+	if t.ReusePort {
+		lc := net.ListenConfig{Control: reuseport.Control}
+		return lc.Listen(context.Background(), "tcp", addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Memory is an in-process Transport, connections are synchronous pipes
+// between listeners and dialers of the same Memory, addressed by name. It's
+// for tests and simulations.
+type Memory struct {
+	listeners map[string]*memoryListener
+	sync.Mutex
+}
+
+// NewMemory creates an in-process network
+func NewMemory() *Memory {
+	return &Memory{listeners: make(map[string]*memoryListener)}
+}
+
+// Dial implements Transport
+func (m *Memory) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	m.Lock()
+	l, ok := m.listeners[addr]
+	m.Unlock()
+	if !ok {
+		return nil, ErrConnectionRefused
+	}
+
+	c1, c2 := net.Pipe()
+	select {
+	case l.chConns <- c2:
+		return c1, nil
+	case <-l.die:
+		return nil, ErrConnectionRefused
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Listen implements Transport
+func (m *Memory) Listen(addr string) (net.Listener, error) {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.listeners[addr]; ok {
+		return nil, ErrAddressInUse
+	}
+
+	l := &memoryListener{memory: m, addr: memoryAddr(addr), chConns: make(chan net.Conn), die: make(chan struct{})}
+	m.listeners[addr] = l
+	return l, nil
+}
+
+// memoryAddr is the address of a memory listener
+type memoryAddr string
+
+func (a memoryAddr) Network() string { return "memory" }
+func (a memoryAddr) String() string  { return string(a) }
+
+// memoryListener implements net.Listener for Memory
+type memoryListener struct {
+	memory  *Memory
+	addr    memoryAddr
+	chConns chan net.Conn
+
+	die     chan struct{}
+	dieOnce sync.Once
+}
+
+// Accept implements net.Listener
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.chConns:
+		return conn, nil
+	case <-l.die:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener
+func (l *memoryListener) Close() error {
+	l.dieOnce.Do(func() {
+		l.memory.Lock()
+		delete(l.memory.listeners, string(l.addr))
+		l.memory.Unlock()
+		close(l.die)
+	})
+	return nil
+}
+
+// Addr implements net.Listener
+func (l *memoryListener) Addr() net.Addr { return l.addr }
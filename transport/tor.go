@@ -0,0 +1,177 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrTorControl is returned by Tor.Listen if the control port replied an error
+	ErrTorControl = errors.New("tor control port rejected the command")
+)
+
+// Tor is the Transport over the Tor network, it dials .onion addresses as
+// well as regular ones through the SOCKS5 port of a Tor daemon, and
+// publishes listeners as onion services through the control port, so the
+// IP of a validator is hidden from the peers.
+type Tor struct {
+	SOCKS           string // the SOCKS5 port of the daemon, like 127.0.0.1:9050
+	Control         string // the control port of the daemon, like 127.0.0.1:9051
+	ControlPassword string // (optional) the password of the control port
+	// (optional) the onion service key like "ED25519-V3:<base64>" for a
+	// stable .onion address, a new key is generated by Tor if empty.
+	ServiceKey string
+}
+
+// Dial implements Transport, addr could be a .onion address
+func (t *Tor) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	socks := &SOCKS5{Proxy: t.SOCKS}
+	return socks.Dial(ctx, addr)
+}
+
+// Listen implements Transport, it listens on the local address addr, and
+// publishes it as an onion service with the same port, the Addr of the
+// listener returned is the onion address like xxx.onion:4680. The service
+// is removed when the listener is closed.
+func (t *Tor) Listen(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	onion, ctrl, err := t.addOnion(l.Addr().(*net.TCPAddr))
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &onionListener{Listener: l, addr: onion, ctrl: ctrl}, nil
+}
+
+// addOnion publishes the local address as an onion service, the service
+// lives as long as the control connection returned.
+func (t *Tor) addOnion(local *net.TCPAddr) (*onionAddr, *textproto.Conn, error) {
+	conn, err := net.Dial("tcp", t.Control)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctrl := textproto.NewConn(conn)
+
+	if _, err := torCommand(ctrl, "AUTHENTICATE %v", strconv.Quote(t.ControlPassword)); err != nil {
+		ctrl.Close()
+		return nil, nil, err
+	}
+
+	key := t.ServiceKey
+	flags := ""
+	if key == "" {
+		key = "NEW:ED25519-V3"
+		flags = " Flags=DiscardPK"
+	}
+	lines, err := torCommand(ctrl, "ADD_ONION %v%v Port=%v,%v", key, flags, local.Port, local.String())
+	if err != nil {
+		ctrl.Close()
+		return nil, nil, err
+	}
+
+	for _, line := range lines {
+		if id := strings.TrimPrefix(line, "ServiceID="); id != line {
+			return &onionAddr{id: id, port: local.Port}, ctrl, nil
+		}
+	}
+	ctrl.Close()
+	return nil, nil, ErrTorControl
+}
+
+// torCommand sends a command to the control port and returns the lines of
+// a 250 reply
+func torCommand(ctrl *textproto.Conn, format string, args ...interface{}) ([]string, error) {
+	if err := ctrl.PrintfLine(format, args...); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for {
+		line, err := ctrl.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 4 {
+			return nil, ErrTorControl
+		}
+		if line[:3] != "250" {
+			return nil, fmt.Errorf("%w: %v", ErrTorControl, line)
+		}
+		lines = append(lines, line[4:])
+		// a space after the status code marks the last line
+		if line[3] == ' ' {
+			return lines, nil
+		}
+	}
+}
+
+// onionAddr is the address of an onion service
+type onionAddr struct {
+	id   string // the service id without .onion
+	port int
+}
+
+func (a *onionAddr) Network() string { return "onion" }
+func (a *onionAddr) String() string {
+	return net.JoinHostPort(a.id+".onion", strconv.Itoa(a.port))
+}
+
+// onionListener is a local listener published as an onion service
+type onionListener struct {
+	net.Listener
+	addr      *onionAddr
+	ctrl      *textproto.Conn
+	closeOnce sync.Once
+}
+
+// Addr returns the onion address
+func (l *onionListener) Addr() net.Addr { return l.addr }
+
+// Close removes the onion service and closes the local listener
+func (l *onionListener) Close() error {
+	l.closeOnce.Do(func() {
+		torCommand(l.ctrl, "DEL_ONION %v", l.addr.id)
+		l.ctrl.Close()
+	})
+	return l.Listener.Close()
+}
@@ -0,0 +1,63 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package transport defines the Transport interface implemented by all the
+// agents of this module, so downstream code can switch between TCP, QUIC,
+// WebSocket, gRPC, libp2p, KCP and in-memory transports without changes.
+//
+// A Transport only carries the byte stream of |MessageLength|Message|
+// frames, peers are created on top of the connections with
+// agent.NewTCPPeer, which authenticates them and implements
+// bdls.PeerInterface for the consensus core, regardless of the transport:
+//
+//	l, _ := tr.Listen(addr)
+//	conn, _ := l.Accept()
+//	p := agent.NewTCPPeer(conn, tagent)
+//	tagent.AddPeer(p)
+//	p.InitiatePublicKeyAuthentication()
+//
+// The package transporttest contains the conformance test suite every
+// implementation must pass.
+package transport
+
+import (
+	"context"
+	"net"
+)
+
+// Transport dials and listens for consensus connections
+type Transport interface {
+	// Dial connects to addr, the address format is transport specific,
+	// and the String() of a listener's Addr() must be dialable. ctx only
+	// bounds the dialing, the connection outlives it.
+	Dial(ctx context.Context, addr string) (net.Conn, error)
+	// Listen listens for connections on addr
+	Listen(addr string) (net.Listener, error)
+}
@@ -0,0 +1,170 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls/transport"
+	"github.com/yonggewang/bdls/transport/transporttest"
+)
+
+func TestTCP(t *testing.T) {
+	suite := &transporttest.Suite{Transport: new(transport.TCP), Addr: "127.0.0.1:0"}
+	suite.Run(t)
+}
+
+func TestTCPReusePort(t *testing.T) {
+	suite := &transporttest.Suite{Transport: &transport.TCP{ReusePort: true}, Addr: "127.0.0.1:0"}
+	suite.Run(t)
+
+	// connections are dialed from the port of a listener
+	l, err := (&transport.TCP{ReusePort: true}).Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	remote, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer remote.Close()
+
+	tr := &transport.TCP{ReusePort: true, Dialer: net.Dialer{LocalAddr: l.Addr()}}
+	conn, err := tr.Dial(context.Background(), remote.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Equal(t, l.Addr().String(), conn.LocalAddr().String())
+}
+
+func TestMemory(t *testing.T) {
+	suite := &transporttest.Suite{Transport: transport.NewMemory(), Addr: "node0"}
+	suite.Run(t)
+}
+
+func TestMemoryAddress(t *testing.T) {
+	m := transport.NewMemory()
+	l, err := m.Listen("node0")
+	assert.Nil(t, err)
+	_, err = m.Listen("node0")
+	assert.Equal(t, transport.ErrAddressInUse, err)
+
+	_, err = m.Dial(context.Background(), "node1")
+	assert.Equal(t, transport.ErrConnectionRefused, err)
+
+	// the name is released on close
+	assert.Nil(t, l.Close())
+	_, err = m.Dial(context.Background(), "node0")
+	assert.Equal(t, transport.ErrConnectionRefused, err)
+	l, err = m.Listen("node0")
+	assert.Nil(t, err)
+	l.Close()
+}
+
+func TestSOCKS5(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	go transporttest.ServeSOCKS5(l, "validator", "secret")
+
+	proxy, err := transport.ParseSOCKS5("socks5://validator:secret@" + l.Addr().String())
+	assert.Nil(t, err)
+	suite := &transporttest.Suite{Transport: new(transport.TCP), Dialer: proxy, Addr: "127.0.0.1:0"}
+	suite.Run(t)
+
+	// wrong credentials
+	proxy.Auth.Password = "wrong"
+	_, err = proxy.Dial(context.Background(), l.Addr().String())
+	assert.NotNil(t, err)
+}
+
+func TestParseSOCKS5(t *testing.T) {
+	s, err := transport.ParseSOCKS5("socks5://127.0.0.1:1080")
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:1080", s.Proxy)
+	assert.Nil(t, s.Auth)
+
+	for _, rawurl := range []string{"http://127.0.0.1:1080", "socks5://", "127.0.0.1:1080", "%"} {
+		_, err := transport.ParseSOCKS5(rawurl)
+		assert.Equal(t, transport.ErrProxyURL, err, rawurl)
+	}
+}
+
+// fakeTorControl serves a single control connection, replying commands by
+// reply, and records the commands received.
+func fakeTorControl(t *testing.T, reply func(cmd string) string) (addr string, commands chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	commands = make(chan string, 16)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		ctrl := textproto.NewConn(conn)
+		for {
+			cmd, err := ctrl.ReadLine()
+			if err != nil {
+				close(commands)
+				return
+			}
+			commands <- cmd
+			ctrl.PrintfLine("%v", reply(cmd))
+		}
+	}()
+	return l.Addr().String(), commands
+}
+
+func TestTor(t *testing.T) {
+	control, commands := fakeTorControl(t, func(cmd string) string {
+		if strings.HasPrefix(cmd, "ADD_ONION") {
+			return "250-ServiceID=abcdefghijklmnop\r\n250 OK"
+		}
+		return "250 OK"
+	})
+	socks, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer socks.Close()
+	go transporttest.ServeSOCKS5(socks, "", "")
+
+	tor := &transport.Tor{SOCKS: socks.Addr().String(), Control: control, ControlPassword: "secret"}
+	l, err := tor.Listen("127.0.0.1:0")
+	assert.Nil(t, err)
+	assert.Equal(t, `AUTHENTICATE "secret"`, <-commands)
+
+	// published as an onion service at the same port
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	assert.Nil(t, err)
+	assert.Equal(t, net.JoinHostPort("abcdefghijklmnop.onion", port), l.Addr().String())
+	assert.Equal(t, "ADD_ONION NEW:ED25519-V3 Flags=DiscardPK Port="+port+",127.0.0.1:"+port, <-commands)
+
+	// dialed through the SOCKS port
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Write([]byte("onion"))
+			conn.Close()
+		}
+	}()
+	conn, err := tor.Dial(context.Background(), "127.0.0.1:"+port)
+	assert.Nil(t, err)
+	buf, err := io.ReadAll(conn)
+	assert.Nil(t, err)
+	assert.Equal(t, "onion", string(buf))
+	conn.Close()
+
+	// the service is removed on close
+	assert.Nil(t, l.Close())
+	assert.Equal(t, "DEL_ONION abcdefghijklmnop", <-commands)
+}
+
+func TestTorControlError(t *testing.T) {
+	control, _ := fakeTorControl(t, func(cmd string) string { return "515 Authentication failed" })
+	tor := &transport.Tor{Control: control}
+	_, err := tor.Listen("127.0.0.1:0")
+	assert.True(t, errors.Is(err, transport.ErrTorControl))
+}
@@ -0,0 +1,296 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package transporttest provides the conformance test suite for
+// implementations of transport.Transport.
+package transporttest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	agent "github.com/yonggewang/bdls/agent-tcp"
+	"github.com/yonggewang/bdls/transport"
+)
+
+// the timeout of each step of the suite
+const stepTimeout = 10 * time.Second
+
+// Suite is the conformance test suite of a Transport
+type Suite struct {
+	Transport transport.Transport
+	// Dialer (optional) is the Transport to dial with, defaults to
+	// Transport, for transports which can't dial themselves.
+	Dialer transport.Transport
+	// Addr is the address to listen on for each test, like "127.0.0.1:0"
+	Addr string
+	// SkipCloseNotify skips the test that closing a connection is noticed
+	// by the remote end, for transports without connection teardown like
+	// KCP, where peers rely on timeouts instead.
+	SkipCloseNotify bool
+}
+
+// Run runs all the conformance tests as subtests of t
+func (s *Suite) Run(t *testing.T) {
+	t.Run("Frames", s.testFrames)
+	t.Run("ReadDeadline", s.testReadDeadline)
+	if !s.SkipCloseNotify {
+		t.Run("CloseNotify", s.testCloseNotify)
+	}
+	t.Run("Authenticate", s.testAuthenticate)
+	t.Run("ListenerClose", s.testListenerClose)
+}
+
+// pair establishes a connection, onDial is called on the dialed connection
+// before waiting for the listener to accept, and must send some data, as
+// some transports only accept a connection once data arrives.
+func (s *Suite) pair(t *testing.T, onDial func(net.Conn)) (dialed net.Conn, accepted net.Conn, l net.Listener) {
+	l, err := s.Transport.Listen(s.Addr)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	chAccepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			chAccepted <- conn
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), stepTimeout)
+	defer cancel()
+	dialer := s.Dialer
+	if dialer == nil {
+		dialer = s.Transport
+	}
+	dialed, err = dialer.Dial(ctx, l.Addr().String())
+	if !assert.Nil(t, err) {
+		l.Close()
+		t.FailNow()
+	}
+
+	onDial(dialed)
+
+	select {
+	case accepted = <-chAccepted:
+	case <-time.After(stepTimeout):
+		dialed.Close()
+		l.Close()
+		t.Fatal("connection not accepted")
+	}
+	return dialed, accepted, l
+}
+
+// sendFrame returns an onDial function to send msg asynchronously
+func sendFrame(msg []byte) func(net.Conn) {
+	return func(conn net.Conn) { go writeFrame(conn, msg) }
+}
+
+// writeFrame writes a |MessageLength|Message| frame in one Write
+func writeFrame(conn net.Conn, msg []byte) error {
+	frame := make([]byte, 4+len(msg))
+	binary.LittleEndian.PutUint32(frame, uint32(len(msg)))
+	copy(frame[4:], msg)
+	_, err := conn.Write(frame)
+	return err
+}
+
+// readFrame reads a |MessageLength|Message| frame
+func readFrame(conn net.Conn) ([]byte, error) {
+	conn.SetReadDeadline(time.Now().Add(stepTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.LittleEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	bts := make([]byte, n)
+	_, err := io.ReadFull(rand.Reader, bts)
+	assert.Nil(t, err)
+	return bts
+}
+
+// testFrames sends frames of various sizes in both directions
+func (s *Suite) testFrames(t *testing.T) {
+	first := randomBytes(t, 16)
+	dialed, accepted, l := s.pair(t, sendFrame(first))
+	defer l.Close()
+	defer dialed.Close()
+	defer accepted.Close()
+
+	msg, err := readFrame(accepted)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(first, msg))
+
+	for _, size := range []int{0, 1, 1500, 64 << 10, 1 << 20} {
+		for _, dir := range [][2]net.Conn{{dialed, accepted}, {accepted, dialed}} {
+			sent := randomBytes(t, size)
+			chErr := make(chan error, 1)
+			go func(w net.Conn) { chErr <- writeFrame(w, sent) }(dir[0])
+
+			received, err := readFrame(dir[1])
+			assert.Nil(t, err, "frame size %v", size)
+			assert.True(t, bytes.Equal(sent, received), "frame size %v", size)
+			assert.Nil(t, <-chErr)
+		}
+	}
+}
+
+// testReadDeadline checks reads time out with a net.Error
+func (s *Suite) testReadDeadline(t *testing.T) {
+	dialed, accepted, l := s.pair(t, sendFrame(nil))
+	defer l.Close()
+	defer dialed.Close()
+	defer accepted.Close()
+
+	_, err := readFrame(accepted)
+	assert.Nil(t, err)
+
+	dialed.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = dialed.Read(make([]byte, 1))
+	var nerr net.Error
+	if assert.True(t, errors.As(err, &nerr), "read error %v is not a net.Error", err) {
+		assert.True(t, nerr.Timeout())
+	}
+}
+
+// testCloseNotify checks reads fail after the remote end closed
+func (s *Suite) testCloseNotify(t *testing.T) {
+	dialed, accepted, l := s.pair(t, sendFrame(nil))
+	defer l.Close()
+	defer accepted.Close()
+
+	_, err := readFrame(accepted)
+	assert.Nil(t, err)
+
+	dialed.Close()
+	_, err = readFrame(accepted)
+	assert.NotNil(t, err)
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		assert.False(t, nerr.Timeout(), "remote close not noticed")
+	}
+}
+
+// testListenerClose checks Accept returns after the listener closed
+func (s *Suite) testListenerClose(t *testing.T) {
+	l, err := s.Transport.Listen(s.Addr)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	chErr := make(chan error, 1)
+	go func() {
+		_, err := l.Accept()
+		chErr <- err
+	}()
+	<-time.After(20 * time.Millisecond)
+	assert.Nil(t, l.Close())
+
+	select {
+	case err := <-chErr:
+		assert.NotNil(t, err)
+	case <-time.After(stepTimeout):
+		t.Fatal("Accept not returned after Close")
+	}
+}
+
+// testAuthenticate runs the key authentication of agents over the transport
+func (s *Suite) testAuthenticate(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, bdls.ConfigMinimumParticipants)
+	var participants []bdls.Identity
+	for k := range keys {
+		var err error
+		keys[k], err = ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&keys[k].PublicKey))
+	}
+
+	newAgent := func(key *ecdsa.PrivateKey) *agent.TCPAgent {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = key
+		config.Participants = participants
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a bdls.State) bool { return true }
+		consensus, err := bdls.NewConsensus(config)
+		if !assert.Nil(t, err) {
+			t.FailNow()
+		}
+		return agent.NewTCPAgent(consensus, key)
+	}
+
+	client := newAgent(keys[0])
+	defer client.Close()
+	server := newAgent(keys[1])
+	defer server.Close()
+
+	// the dialer authenticates first, so the listener accepts
+	var p1 *agent.TCPPeer
+	_, accepted, l := s.pair(t, func(conn net.Conn) {
+		p1 = agent.NewTCPPeer(conn, client)
+		assert.Nil(t, p1.InitiatePublicKeyAuthentication())
+	})
+	defer l.Close()
+	defer p1.Close()
+
+	p2 := agent.NewTCPPeer(accepted, server)
+	assert.Nil(t, p2.InitiatePublicKeyAuthentication())
+	defer p2.Close()
+
+	deadline := time.Now().Add(stepTimeout)
+	for time.Now().Before(deadline) {
+		if p1.GetPublicKey() != nil && p2.GetPublicKey() != nil {
+			break
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+	assert.Equal(t, &keys[1].PublicKey, p1.GetPublicKey())
+	assert.Equal(t, &keys[0].PublicKey, p2.GetPublicKey())
+}
@@ -0,0 +1,163 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package typedconsensus
+
+import (
+	"context"
+
+	"github.com/yonggewang/bdls"
+	agent "github.com/yonggewang/bdls/agent-tcp"
+	"github.com/yonggewang/bdls/codec"
+)
+
+// Codec marshals values of type T into states, and back.
+type Codec[T any] struct {
+	Marshal   func(v T) ([]byte, error)
+	Unmarshal func(data []byte) (T, error)
+}
+
+// FromCodec adapts c to values of type T, the states are tagged with the
+// codec's name as by codec.Encode, so they can also be decoded with
+// agent.Decision.Decode.
+func FromCodec[T any](c codec.Codec) Codec[T] {
+	return Codec[T]{
+		Marshal: func(v T) ([]byte, error) { return codec.Encode(c, v) },
+		Unmarshal: func(data []byte) (T, error) {
+			var v T
+			err := codec.Decode(data, &v)
+			return v, err
+		},
+	}
+}
+
+// StateValidate returns a function for Config.StateValidate, the states
+// which can't be unmarshalled are invalid, others are validated by valid.
+func (c Codec[T]) StateValidate(valid func(v T) bool) func(bdls.State) bool {
+	return func(s bdls.State) bool {
+		v, err := c.Unmarshal(s)
+		return err == nil && valid(v)
+	}
+}
+
+// Decision is a decided height with the typed value
+type Decision[T any] struct {
+	Height uint64
+	Round  uint64
+	Value  T
+	Proof  []byte // marshalled SignedProto of the <decide> message
+
+	// the participants whose <commit> messages are in the proof
+	Participation agent.Bitmap
+}
+
+// Consensus proposes and decodes typed values through a TCPAgent.
+type Consensus[T any] struct {
+	agent *agent.TCPAgent
+	codec Codec[T]
+}
+
+// New wraps a TCPAgent with values marshalled by c.
+func New[T any](a *agent.TCPAgent, c Codec[T]) *Consensus[T] {
+	return &Consensus[T]{agent: a, codec: c}
+}
+
+// Agent returns the wrapped TCPAgent
+func (c *Consensus[T]) Agent() *agent.TCPAgent { return c.agent }
+
+// Propose marshals v and proposes it as the state of the next height.
+func (c *Consensus[T]) Propose(v T) error {
+	s, err := c.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.agent.Propose(s)
+}
+
+// Latest returns the latest decided value, or ErrNotDecided if nothing has
+// been decided.
+func (c *Consensus[T]) Latest() (height uint64, round uint64, v T, err error) {
+	height, round, s := c.agent.GetLatestState()
+	if s == nil {
+		return 0, 0, v, ErrNotDecided
+	}
+	v, err = c.codec.Unmarshal(s)
+	return height, round, v, err
+}
+
+// Decode unmarshals the state of a decision delivered by the agent.
+func (c *Consensus[T]) Decode(d *agent.Decision) (*Decision[T], error) {
+	v, err := c.codec.Unmarshal(d.State)
+	if err != nil {
+		return nil, err
+	}
+	return &Decision[T]{Height: d.Height, Round: d.Round, Value: v, Proof: d.Proof, Participation: d.Participation}, nil
+}
+
+// Subscription delivers typed decisions, see TCPAgent.SubscribeHeights.
+type Subscription[T any] struct {
+	consensus *Consensus[T]
+	sub       *agent.DecisionSubscription
+}
+
+// Subscribe delivers the decisions from fromHeight in order of height, as
+// TCPAgent.SubscribeHeights.
+func (c *Consensus[T]) Subscribe(fromHeight uint64) (*Subscription[T], error) {
+	sub, err := c.agent.SubscribeHeights(fromHeight)
+	if err != nil {
+		return nil, err
+	}
+	return &Subscription[T]{consensus: c, sub: sub}, nil
+}
+
+// Next waits for the next decision, a decision that can't be unmarshalled
+// is returned with the error, so the caller may skip it. Once the
+// subscription has ended, it returns why, or ErrSubscriptionClosed.
+func (s *Subscription[T]) Next(ctx context.Context) (*Decision[T], error) {
+	select {
+	case d, ok := <-s.sub.C:
+		if !ok {
+			if err := s.sub.Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrSubscriptionClosed
+		}
+		typed, err := s.consensus.Decode(d)
+		if err != nil {
+			return &Decision[T]{Height: d.Height, Round: d.Round, Proof: d.Proof}, err
+		}
+		return typed, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close ends the subscription
+func (s *Subscription[T]) Close() { s.sub.Close() }
@@ -0,0 +1,130 @@
+package typedconsensus
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yonggewang/bdls"
+	agent "github.com/yonggewang/bdls/agent-tcp"
+	"github.com/yonggewang/bdls/codec"
+)
+
+type transfer struct {
+	From, To string
+	Amount   uint64
+}
+
+// amountCodec marshals amounts as 8 bytes
+var amountCodec = Codec[uint64]{
+	Marshal: func(v uint64) ([]byte, error) { return binary.BigEndian.AppendUint64(nil, v), nil },
+	Unmarshal: func(data []byte) (uint64, error) {
+		if len(data) != 8 {
+			return 0, errors.New("invalid amount")
+		}
+		return binary.BigEndian.Uint64(data), nil
+	},
+}
+
+func TestFromCodec(t *testing.T) {
+	c := FromCodec[transfer](codec.JSON)
+	s, err := c.Marshal(transfer{"alice", "bob", 42})
+	assert.Nil(t, err)
+	v, err := c.Unmarshal(s)
+	assert.Nil(t, err)
+	assert.Equal(t, transfer{"alice", "bob", 42}, v)
+
+	// tagged for agent.Decision.Decode
+	var decoded transfer
+	assert.Nil(t, (&agent.Decision{State: s}).Decode(&decoded))
+	assert.Equal(t, v, decoded)
+
+	_, err = c.Unmarshal([]byte("\x04cbor{}"))
+	assert.Equal(t, codec.ErrUnknownCodec, err)
+}
+
+func TestStateValidate(t *testing.T) {
+	validate := amountCodec.StateValidate(func(v uint64) bool { return v > 0 })
+	assert.True(t, validate(binary.BigEndian.AppendUint64(nil, 1)))
+	assert.False(t, validate(binary.BigEndian.AppendUint64(nil, 0)))
+	assert.False(t, validate([]byte{1, 2, 3}))
+}
+
+func TestConsensus(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var participants []bdls.Identity
+	for i := 0; i < bdls.ConfigMinimumParticipants; i++ {
+		privateKey, err := ecdsa.GenerateKey(bdls.S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		keys = append(keys, privateKey)
+		participants = append(participants, bdls.DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	nodes := make([]*Consensus[uint64], len(keys))
+	for i := range keys {
+		config := new(bdls.Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = keys[i]
+		config.Participants = participants
+		config.StateCompare = func(a bdls.State, b bdls.State) int { return bytes.Compare(a, b) }
+		config.StateValidate = amountCodec.StateValidate(func(v uint64) bool { return v > 0 })
+		consensus, err := bdls.NewConsensus(config)
+		assert.Nil(t, err)
+		consensus.SetLatency(200 * time.Millisecond)
+		nodes[i] = New(agent.NewTCPAgent(consensus, keys[i]), amountCodec)
+		defer nodes[i].Agent().Close()
+	}
+
+	_, _, _, err := nodes[0].Latest()
+	assert.Equal(t, ErrNotDecided, err)
+	sub, err := nodes[0].Subscribe(0)
+	assert.Nil(t, err)
+	defer sub.Close()
+
+	for i := 0; i < len(nodes); i++ {
+		for j := i + 1; j < len(nodes); j++ {
+			c1, c2 := net.Pipe()
+			p1 := agent.NewTCPPeer(c1, nodes[i].Agent())
+			p2 := agent.NewTCPPeer(c2, nodes[j].Agent())
+			assert.True(t, nodes[i].Agent().AddPeer(p1))
+			assert.True(t, nodes[j].Agent().AddPeer(p2))
+			p1.InitiatePublicKeyAuthentication()
+			p2.InitiatePublicKeyAuthentication()
+		}
+	}
+	<-time.After(time.Second)
+
+	for i := range nodes {
+		nodes[i].Agent().Update()
+		assert.Nil(t, nodes[i].Propose(uint64(100+i)))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	d, err := sub.Next(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), d.Height)
+	assert.True(t, d.Value >= 100 && d.Value < 100+uint64(len(nodes)))
+	assert.NotEmpty(t, d.Proof)
+
+	height, _, v, err := nodes[0].Latest()
+	assert.Nil(t, err)
+	assert.True(t, height >= d.Height)
+	if height == d.Height {
+		assert.Equal(t, d.Value, v)
+	}
+
+	// ended by Close
+	sub.Close()
+	for err == nil {
+		_, err = sub.Next(ctx)
+	}
+	assert.Equal(t, ErrSubscriptionClosed, err)
+}
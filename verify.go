@@ -0,0 +1,311 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/bn256"
+)
+
+// verifyBatchSize is the number of signatures verified in a batch by a
+// BatchVerifier
+const verifyBatchSize = 64
+
+// Signature is a signature of a SignedProto to verify in a batch
+type Signature struct {
+	X    PubKeyAxis
+	Y    PubKeyAxis
+	Hash []byte
+	R    []byte
+	S    []byte
+}
+
+// key identifies the signature, the hash covers the signer & the message,
+// the fields are length prefixed so R & S can't be split elsewhere to match
+// the key of a valid signature.
+func (sig *Signature) key() string {
+	bts := make([]byte, 0, 3*binary.MaxVarintLen64+len(sig.Hash)+len(sig.R)+len(sig.S))
+	for _, field := range [][]byte{sig.Hash, sig.R, sig.S} {
+		bts = binary.AppendUvarint(bts, uint64(len(field)))
+		bts = append(bts, field...)
+	}
+	return string(bts)
+}
+
+// BatchVerifier is a Verifier of a scheme which verifies many signatures at
+// once faster than one by one, it's used by Consensus.VerifyMessages.
+type BatchVerifier interface {
+	Verifier
+
+	// VerifyBatch returns true if all the signatures are valid, the ones of
+	// a batch failed are verified one by one to find the invalid ones.
+	VerifyBatch(sigs []Signature) bool
+}
+
+// blsShare is a BLS signature or a partial threshold signature of a
+// <commit> to verify in a batch
+type blsShare struct {
+	pk     *bn256.G2
+	digest []byte
+	sig    []byte
+	key    string
+}
+
+// VerifyMessages verifies the signatures of the messages about to be
+// received, and of the proofs they carry, in parallel by
+// Config.VerifyWorkers, or in batches if the Verifier is a BatchVerifier,
+// or the <commit> messages carry BLS signatures. The valid signatures are
+// not verified again while receiving the messages, until the next call of
+// VerifyMessages. The messages are only decoded, the state is unchanged.
+// The Verifier must be safe for concurrent use.
+func (c *Consensus) VerifyMessages(msgs [][]byte) {
+	defer c.profiler.Since(ProfileVerify, c.profiler.Now())
+
+	c.preverified = make(map[string]bool)
+	var sigs []Signature
+	var shares []blsShare
+	seen := make(map[string]bool)
+	for _, bts := range msgs {
+		signed, err := DecodeSignedMessage(bts)
+		if err == nil {
+			c.collectSignatures(signed, seen, &sigs, &shares, true)
+		}
+	}
+
+	for k, valid := range c.verifySignatures(sigs) {
+		if valid {
+			c.preverified[sigs[k].key()] = true
+		}
+	}
+	for k, valid := range verifyShares(shares) {
+		if valid {
+			c.preverified[shares[k].key] = true
+		}
+	}
+}
+
+// collectSignatures collects the signature of the message, and of the
+// proofs embedded, the <commit> messages to this leader carry BLS
+// signatures too.
+func (c *Consensus) collectSignatures(signed *SignedProto, seen map[string]bool, sigs *[]Signature, shares *[]blsShare, outer bool) {
+	sig := Signature{X: signed.X, Y: signed.Y, Hash: signed.Hash(), R: signed.R, S: signed.S}
+	if seen[sig.key()] {
+		return
+	}
+	seen[sig.key()] = true
+	*sigs = append(*sigs, sig)
+
+	m, err := DecodeMessage(signed.Message)
+	if err != nil {
+		return
+	}
+	if outer && m.Type == MessageType_Commit && c.roundLeader(m.Round) == c.identity {
+		if share, ok := c.commitShare(m, signed); ok {
+			*shares = append(*shares, share)
+		}
+	}
+	if !outer {
+		return
+	}
+	for _, proof := range m.Proof {
+		c.collectSignatures(proof, seen, sigs, shares, false)
+	}
+	if m.LockRelease != nil {
+		c.collectSignatures(m.LockRelease, seen, sigs, shares, false)
+		if lock, err := DecodeMessage(m.LockRelease.Message); err == nil {
+			for _, proof := range lock.Proof {
+				c.collectSignatures(proof, seen, sigs, shares, false)
+			}
+		}
+	}
+}
+
+// VerifySignature verifies the signature of a message by the Verifier of
+// the config, unless it's been verified by VerifyMessages. The embedded
+// proofs are not verified.
+func (c *Consensus) VerifySignature(signed *SignedProto) bool {
+	return c.verifySignature(signed)
+}
+
+// verifySignature verifies the signature of a message, unless it's been
+// verified by VerifyMessages.
+func (c *Consensus) verifySignature(signed *SignedProto) bool {
+	sig := Signature{X: signed.X, Y: signed.Y, Hash: signed.Hash(), R: signed.R, S: signed.S}
+	if c.preverified[sig.key()] {
+		return true
+	}
+	return c.verifier.Verify(sig.X, sig.Y, sig.Hash, sig.R, sig.S)
+}
+
+// verifySignatures verifies the signatures by the workers, in batches if
+// the verifier supports.
+func (c *Consensus) verifySignatures(sigs []Signature) []bool {
+	valid := make([]bool, len(sigs))
+	batchVerifier, _ := c.verifier.(BatchVerifier)
+	size := 1
+	if batchVerifier != nil {
+		size = verifyBatchSize
+	}
+
+	// the workers pick up the chunks of signatures by index
+	var next int64
+	chunks := (len(sigs) + size - 1) / size
+	workers := c.verifyWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > chunks {
+		workers = chunks
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1) - 1)
+				if i >= chunks {
+					return
+				}
+				chunk := sigs[i*size:]
+				if len(chunk) > size {
+					chunk = chunk[:size]
+				}
+				if batchVerifier != nil && len(chunk) > 1 && batchVerifier.VerifyBatch(chunk) {
+					for k := range chunk {
+						valid[i*size+k] = true
+					}
+					continue
+				}
+				for k := range chunk {
+					sig := &chunk[k]
+					valid[i*size+k] = c.verifier.Verify(sig.X, sig.Y, sig.Hash, sig.R, sig.S)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return valid
+}
+
+// commitShare returns the BLS signature or the partial threshold signature
+// of a <commit> to verify, if either is enabled.
+func (c *Consensus) commitShare(m *Message, signed *SignedProto) (share blsShare, ok bool) {
+	id := c.pubKeyToIdentity(signed.PublicKey(c.curve))
+	share.digest = blsCommitDigest(m.Height, m.Round, c.stateHash(m.State))
+	share.sig = m.BLSSignature
+	share.key = shareKey(id, share.digest, share.sig)
+	if c.blsPublicKeys != nil {
+		if pk := c.blsPublicKeys[id]; pk != nil {
+			share.pk = pk.p
+			return share, true
+		}
+	}
+	if c.thresholdPublicKey != nil {
+		if i := c.shareIndex(id); i > 0 {
+			share.pk = c.thresholdPublicKey.shares[i-1]
+			return share, true
+		}
+	}
+	return share, false
+}
+
+// shareKey identifies the BLS signature of a participant over a digest
+func shareKey(id Identity, digest []byte, sig []byte) string {
+	return string(id[:]) + string(digest) + string(sig)
+}
+
+// verifyShares verifies the BLS signatures, the ones over the same digest
+// are verified at once by a random linear combination of them:
+//
+//	e(Σ rᵢσᵢ, g2) == e(H(m), Σ rᵢpkᵢ)
+//
+// which takes 2 pairings instead of 2 for each. The groups failed are
+// verified one by one to find the invalid signatures.
+func verifyShares(shares []blsShare) []bool {
+	valid := make([]bool, len(shares))
+	groups := make(map[string][]int)
+	var digests []string
+	for k := range shares {
+		digest := string(shares[k].digest)
+		if groups[digest] == nil {
+			digests = append(digests, digest)
+		}
+		groups[digest] = append(groups[digest], k)
+	}
+
+	for _, digest := range digests {
+		group := groups[digest]
+		if len(group) > 1 && verifySharesBatch(shares, group) {
+			for _, k := range group {
+				valid[k] = true
+			}
+			continue
+		}
+		for _, k := range group {
+			valid[k] = blsVerify(shares[k].pk, shares[k].digest, shares[k].sig)
+		}
+	}
+	return valid
+}
+
+// verifySharesBatch verifies the shares of the indices over the same digest
+func verifySharesBatch(shares []blsShare, indices []int) bool {
+	var sigSum *bn256.G1
+	var pkSum *bn256.G2
+	for _, k := range indices {
+		s, ok := new(bn256.G1).Unmarshal(shares[k].sig)
+		if !ok {
+			return false
+		}
+		// 128-bit random coefficients
+		coef := make([]byte, 16)
+		if _, err := rand.Read(coef); err != nil {
+			return false
+		}
+		r := new(big.Int).SetBytes(coef)
+		s = new(bn256.G1).ScalarMult(s, r)
+		pk := new(bn256.G2).ScalarMult(shares[k].pk, r)
+		if sigSum == nil {
+			sigSum, pkSum = s, pk
+		} else {
+			sigSum, pkSum = new(bn256.G1).Add(sigSum, s), new(bn256.G2).Add(pkSum, pk)
+		}
+	}
+	return blsVerify(pkSum, shares[indices[0]].digest, sigSum.Marshal())
+}
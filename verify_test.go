@@ -0,0 +1,104 @@
+package bdls
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	proto "github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingBatchVerifier verifies the batches one by one, and counts them
+type countingBatchVerifier struct {
+	ECDSAVerifier
+	batches int32
+}
+
+func (v *countingBatchVerifier) VerifyBatch(sigs []Signature) bool {
+	atomic.AddInt32(&v.batches, 1)
+	for k := range sigs {
+		if !v.Verify(sigs[k].X, sigs[k].Y, sigs[k].Hash, sigs[k].R, sigs[k].S) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestVerifyMessages(t *testing.T) {
+	var participants []*ecdsa.PrivateKey
+	var coords []Identity
+	for i := 0; i < 20; i++ {
+		privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+		assert.Nil(t, err)
+		participants = append(participants, privateKey)
+		coords = append(coords, DefaultPubKeyToIdentity(&privateKey.PublicKey))
+	}
+
+	batchVerifier := &countingBatchVerifier{ECDSAVerifier: ECDSAVerifier{Curve: S256Curve}}
+	for _, verifier := range []Verifier{nil, batchVerifier} {
+		config := new(Config)
+		config.Epoch = time.Now()
+		config.PrivateKey = participants[0]
+		config.Verifier = verifier
+		config.VerifyWorkers = 4
+		config.Participants = coords
+		config.StateCompare = func(a State, b State) int { return bytes.Compare(a, b) }
+		config.StateValidate = func(a State) bool { return true }
+		consensus, err := NewConsensus(config)
+		assert.Nil(t, err)
+
+		// <roundchange> messages from the others, the last one forged
+		var msgs [][]byte
+		for i := 1; i < len(participants); i++ {
+			sp := new(SignedProto)
+			sp.Sign(&Message{Type: MessageType_RoundChange, Height: 1, Round: 1, State: []byte{byte(i)}}, participants[i])
+			if i == len(participants)-1 {
+				sp.R[0] ^= 1
+			}
+			bts, err := proto.Marshal(sp)
+			assert.Nil(t, err)
+			msgs = append(msgs, bts)
+		}
+
+		consensus.VerifyMessages(msgs)
+		assert.Equal(t, len(msgs)-1, len(consensus.preverified))
+		for k, bts := range msgs {
+			if k == len(msgs)-1 {
+				assert.Equal(t, ErrMessageSignature, consensus.ReceiveMessage(bts, time.Now()))
+			} else {
+				assert.Nil(t, consensus.ReceiveMessage(bts, time.Now()))
+			}
+		}
+	}
+	// one batch failed, and verified one by one
+	assert.Equal(t, int32(1), batchVerifier.batches)
+
+	// the same bytes split elsewhere between R & S are another signature
+	sig := Signature{Hash: []byte{1, 2}, R: []byte{3, 4}, S: []byte{5, 6}}
+	resplit := Signature{Hash: []byte{1, 2}, R: []byte{3, 4, 5}, S: []byte{6}}
+	assert.NotEqual(t, sig.key(), resplit.key())
+}
+
+func TestVerifySharesBatch(t *testing.T) {
+	digest := blsCommitDigest(1, 1, defaultHash([]byte("state")))
+	var shares []blsShare
+	for i := 0; i < 8; i++ {
+		key, err := GenerateBLSKey(rand.Reader)
+		assert.Nil(t, err)
+		shares = append(shares, blsShare{pk: key.PublicKey().p, digest: digest, sig: key.sign(digest)})
+	}
+	for _, valid := range verifyShares(shares) {
+		assert.True(t, valid)
+	}
+
+	// an invalid signature fails the batch, but not the others
+	shares[3].sig = shares[4].sig
+	valid := verifyShares(shares)
+	for k := range shares {
+		assert.Equal(t, k != 3, valid[k])
+	}
+}
@@ -0,0 +1,249 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"math/big"
+)
+
+// A verifiable random function on secp256k1, after ECVRF of RFC 9381 with
+// SHA-256 and the try-and-increment hash to curve. A proof is the point
+// Gamma = x*H, where H is alpha hashed to the curve, along with a Schnorr
+// proof of the discrete log equality of Gamma to H and the public key to
+// the base point, so the output hashed from Gamma is unique to the key &
+// alpha, and can be verified without the private key.
+
+const (
+	// vrfSuite is the suite string of the VRF
+	vrfSuite = 0xfe
+
+	// sizes of a compressed point, the challenge & a scalar
+	vrfPointSize     = 33
+	vrfChallengeSize = 16
+	vrfScalarSize    = 32
+
+	// VRFProofSize is the size of a VRF proof
+	VRFProofSize = vrfPointSize + vrfChallengeSize + vrfScalarSize
+)
+
+// VRFProve computes the VRF output of alpha by the private key, along with
+// the proof for the holders of the public key to verify it. The output is
+// unique to the key & alpha, and unpredictable without the private key.
+func VRFProve(privateKey *ecdsa.PrivateKey, alpha []byte) (output [32]byte, proof []byte, err error) {
+	if privateKey.Curve != S256Curve {
+		return output, nil, ErrVRFCurve
+	}
+	curve := S256Curve
+	n := curve.Params().N
+
+	hx, hy, err := vrfHashToCurve(&privateKey.PublicKey, alpha)
+	if err != nil {
+		return output, nil, err
+	}
+
+	// Gamma = x*H, and the commitments U = k*B, V = k*H
+	gx, gy := curve.ScalarMult(hx, hy, privateKey.D.Bytes())
+	k := vrfNonce(privateKey.D, hx, hy)
+	ux, uy := curve.ScalarBaseMult(k.Bytes())
+	vx, vy := curve.ScalarMult(hx, hy, k.Bytes())
+
+	// s = k + c*x mod n
+	c := vrfChallenge(&privateKey.PublicKey, hx, hy, gx, gy, ux, uy, vx, vy)
+	s := new(big.Int).Mul(c, privateKey.D)
+	s.Add(s, k)
+	s.Mod(s, n)
+
+	proof = make([]byte, VRFProofSize)
+	copy(proof, vrfCompress(gx, gy))
+	c.FillBytes(proof[vrfPointSize : vrfPointSize+vrfChallengeSize])
+	s.FillBytes(proof[vrfPointSize+vrfChallengeSize:])
+	return vrfOutput(gx, gy), proof, nil
+}
+
+// VRFVerify verifies the VRF proof of alpha by the public key, and returns
+// the VRF output proved.
+func VRFVerify(pubkey *ecdsa.PublicKey, alpha []byte, proof []byte) (output [32]byte, err error) {
+	curve := S256Curve
+	params := curve.Params()
+	if pubkey == nil || pubkey.X == nil || pubkey.Y == nil || pubkey.X.Cmp(params.P) >= 0 || pubkey.Y.Cmp(params.P) >= 0 || !curve.IsOnCurve(pubkey.X, pubkey.Y) {
+		return output, ErrVRFPublicKey
+	}
+	if len(proof) != VRFProofSize {
+		return output, ErrVRFProof
+	}
+	gx, gy, err := vrfDecompress(proof[:vrfPointSize])
+	if err != nil {
+		return output, ErrVRFProof
+	}
+	c := new(big.Int).SetBytes(proof[vrfPointSize : vrfPointSize+vrfChallengeSize])
+	s := new(big.Int).SetBytes(proof[vrfPointSize+vrfChallengeSize:])
+	if s.Cmp(params.N) >= 0 {
+		return output, ErrVRFProof
+	}
+
+	hx, hy, err := vrfHashToCurve(pubkey, alpha)
+	if err != nil {
+		return output, err
+	}
+
+	// U = s*B - c*Y, V = s*H - c*Gamma
+	sbx, sby := curve.ScalarBaseMult(s.Bytes())
+	cyx, cyy := curve.ScalarMult(pubkey.X, pubkey.Y, c.Bytes())
+	ux, uy := curve.Add(sbx, sby, cyx, vrfNegate(cyy))
+	shx, shy := curve.ScalarMult(hx, hy, s.Bytes())
+	cgx, cgy := curve.ScalarMult(gx, gy, c.Bytes())
+	vx, vy := curve.Add(shx, shy, cgx, vrfNegate(cgy))
+
+	if vrfChallenge(pubkey, hx, hy, gx, gy, ux, uy, vx, vy).Cmp(c) != 0 {
+		return output, ErrVRFProof
+	}
+	return vrfOutput(gx, gy), nil
+}
+
+// vrfHashToCurve hashes alpha to a point of the curve by try-and-increment,
+// the candidates are taken as the x of points with an even y.
+func vrfHashToCurve(pubkey *ecdsa.PublicKey, alpha []byte) (x, y *big.Int, err error) {
+	p := S256Curve.Params().P
+	pk := vrfCompress(pubkey.X, pubkey.Y)
+	for ctr := 0; ctr < 256; ctr++ {
+		h := sha256.New()
+		h.Write([]byte{vrfSuite, 0x01})
+		h.Write(pk)
+		h.Write(alpha)
+		h.Write([]byte{byte(ctr), 0x00})
+		x = new(big.Int).SetBytes(h.Sum(nil))
+		if x.Cmp(p) >= 0 {
+			continue
+		}
+		if y, err = vrfCurveY(x, 0); err == nil {
+			return x, y, nil
+		}
+	}
+	return nil, nil, ErrVRFHashToCurve
+}
+
+// vrfNonce derives the nonce of a proof from the private key & H, like the
+// nonces of RFC 8032, so no randomness is required to prove.
+func vrfNonce(d *big.Int, hx, hy *big.Int) *big.Int {
+	n := S256Curve.Params().N
+	var key [vrfScalarSize]byte
+	d.FillBytes(key[:])
+	h := sha512.New()
+	h.Write([]byte{vrfSuite, 0x04})
+	h.Write(key[:])
+	h.Write(vrfCompress(hx, hy))
+	k := new(big.Int).SetBytes(h.Sum(nil))
+	// 1 <= k < n
+	k.Mod(k, new(big.Int).Sub(n, big.NewInt(1)))
+	return k.Add(k, big.NewInt(1))
+}
+
+// vrfChallenge hashes the points of a proof to the challenge
+func vrfChallenge(pubkey *ecdsa.PublicKey, hx, hy, gx, gy, ux, uy, vx, vy *big.Int) *big.Int {
+	h := sha256.New()
+	h.Write([]byte{vrfSuite, 0x02})
+	h.Write(vrfCompress(pubkey.X, pubkey.Y))
+	h.Write(vrfCompress(hx, hy))
+	h.Write(vrfCompress(gx, gy))
+	h.Write(vrfCompress(ux, uy))
+	h.Write(vrfCompress(vx, vy))
+	h.Write([]byte{0x00})
+	return new(big.Int).SetBytes(h.Sum(nil)[:vrfChallengeSize])
+}
+
+// vrfOutput hashes Gamma to the VRF output
+func vrfOutput(gx, gy *big.Int) (output [32]byte) {
+	h := sha256.New()
+	h.Write([]byte{vrfSuite, 0x03})
+	h.Write(vrfCompress(gx, gy))
+	h.Write([]byte{0x00})
+	copy(output[:], h.Sum(nil))
+	return output
+}
+
+// vrfCompress encodes a point in the compressed form of SEC 1, the point at
+// infinity is encoded as zeros.
+func vrfCompress(x, y *big.Int) []byte {
+	out := make([]byte, vrfPointSize)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return out
+	}
+	out[0] = 0x02 | byte(y.Bit(0))
+	x.FillBytes(out[1:])
+	return out
+}
+
+// vrfDecompress decodes a point in the compressed form of SEC 1
+func vrfDecompress(bts []byte) (x, y *big.Int, err error) {
+	if len(bts) != vrfPointSize || (bts[0] != 0x02 && bts[0] != 0x03) {
+		return nil, nil, ErrVRFProof
+	}
+	x = new(big.Int).SetBytes(bts[1:])
+	if x.Cmp(S256Curve.Params().P) >= 0 {
+		return nil, nil, ErrVRFProof
+	}
+	if y, err = vrfCurveY(x, uint(bts[0]&1)); err != nil {
+		return nil, nil, err
+	}
+	return x, y, nil
+}
+
+// vrfCurveY solves y^2 = x^3 + 7 for the y of the parity, the square root
+// is v^((p+1)/4) as p = 3 mod 4.
+func vrfCurveY(x *big.Int, parity uint) (*big.Int, error) {
+	params := S256Curve.Params()
+	p := params.P
+	v := new(big.Int).Exp(x, big.NewInt(3), p)
+	v.Add(v, params.B)
+	v.Mod(v, p)
+
+	e := new(big.Int).Add(p, big.NewInt(1))
+	e.Rsh(e, 2)
+	y := new(big.Int).Exp(v, e, p)
+	if new(big.Int).Exp(y, big.NewInt(2), p).Cmp(v) != 0 {
+		return nil, ErrVRFProof
+	}
+	if y.Bit(0) != parity {
+		y.Sub(p, y)
+	}
+	return y, nil
+}
+
+// vrfNegate returns the y of the negated point
+func vrfNegate(y *big.Int) *big.Int {
+	if y.Sign() == 0 {
+		return y
+	}
+	return new(big.Int).Sub(S256Curve.Params().P, y)
+}
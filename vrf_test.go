@@ -0,0 +1,59 @@
+package bdls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVRF(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+	other, err := ecdsa.GenerateKey(S256Curve, rand.Reader)
+	assert.Nil(t, err)
+
+	// the output is proved & unique to the key & input
+	output, proof, err := VRFProve(privateKey, []byte("alpha"))
+	assert.Nil(t, err)
+	assert.Equal(t, VRFProofSize, len(proof))
+	verified, err := VRFVerify(&privateKey.PublicKey, []byte("alpha"), proof)
+	assert.Nil(t, err)
+	assert.Equal(t, output, verified)
+
+	again, proofAgain, err := VRFProve(privateKey, []byte("alpha"))
+	assert.Nil(t, err)
+	assert.Equal(t, output, again)
+	assert.Equal(t, proof, proofAgain)
+
+	beta, _, err := VRFProve(privateKey, []byte("beta"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, output, beta)
+	otherOutput, _, err := VRFProve(other, []byte("alpha"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, output, otherOutput)
+
+	// proofs of other inputs, keys, or tampered are rejected
+	_, err = VRFVerify(&privateKey.PublicKey, []byte("beta"), proof)
+	assert.Equal(t, ErrVRFProof, err)
+	_, err = VRFVerify(&other.PublicKey, []byte("alpha"), proof)
+	assert.Equal(t, ErrVRFProof, err)
+	for _, i := range []int{0, 1, vrfPointSize, vrfPointSize + vrfChallengeSize, VRFProofSize - 1} {
+		tampered := append([]byte(nil), proof...)
+		tampered[i] ^= 1
+		_, err = VRFVerify(&privateKey.PublicKey, []byte("alpha"), tampered)
+		assert.NotNil(t, err, i)
+	}
+	_, err = VRFVerify(&privateKey.PublicKey, []byte("alpha"), proof[1:])
+	assert.Equal(t, ErrVRFProof, err)
+	_, err = VRFVerify(&ecdsa.PublicKey{Curve: S256Curve, X: privateKey.X, Y: privateKey.X}, []byte("alpha"), proof)
+	assert.Equal(t, ErrVRFPublicKey, err)
+
+	// only on secp256k1
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	_, _, err = VRFProve(p256, []byte("alpha"))
+	assert.Equal(t, ErrVRFCurve, err)
+}
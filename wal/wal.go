@@ -0,0 +1,319 @@
+// BSD 3-Clause License
+//
+// Copyright (c) 2020, Sperax
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation
+//    and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+//    contributors may be used to endorse or promote products derived from
+//    this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE
+// FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL
+// DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER
+// CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY,
+// OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// FileName is the name of the log file in Config.Dir
+	FileName = "wal.log"
+	// DefaultGroupCommitWindow is the default time to wait for more records
+	// to share a fsync.
+	DefaultGroupCommitWindow = 2 * time.Millisecond
+	// DefaultMaxBatchBytes is the default bytes of records to commit at once
+	DefaultMaxBatchBytes = 1 << 20
+	// MaxRecordSize is the max size of a record
+	MaxRecordSize = 32 << 20
+
+	// the header of a record, |Length(4)|CRC32C(4)|
+	headerSize = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Config is to config the write-ahead log
+type Config struct {
+	// Dir is the directory of the log file, it can be placed on a separate
+	// disk from the store to isolate their writes.
+	Dir string
+	// GroupCommitWindow is the max time to wait for more records after the
+	// first record of a batch, default to DefaultGroupCommitWindow if 0.
+	GroupCommitWindow time.Duration
+	// MaxBatchBytes commits a batch before the window elapsed once it reached
+	// the size, default to DefaultMaxBatchBytes if 0.
+	MaxBatchBytes int
+}
+
+// VerifyConfig verifies the integrity of this config
+func (c *Config) VerifyConfig() error {
+	if c.Dir == "" {
+		return ErrConfigDir
+	}
+	if c.GroupCommitWindow < 0 {
+		return ErrConfigWindow
+	}
+	if c.MaxBatchBytes < 0 {
+		return ErrConfigBatchBytes
+	}
+	return nil
+}
+
+// Stats is the statistics of the write path
+type Stats struct {
+	Records          uint64        // number of records committed
+	Bytes            uint64        // bytes written, including headers
+	Syncs            uint64        // number of fsyncs
+	TotalSyncLatency time.Duration // accumulated fsync latency
+	MaxSyncLatency   time.Duration // max fsync latency
+	LastSyncLatency  time.Duration // latest fsync latency
+}
+
+// appendRequest is a record waiting to be committed
+type appendRequest struct {
+	data []byte
+	done chan error
+}
+
+// WAL is a write-ahead log, it's safe for concurrent use.
+type WAL struct {
+	file          *os.File
+	window        time.Duration
+	maxBatchBytes int
+
+	chAppend chan appendRequest
+	stats    Stats
+	statsMu  sync.Mutex
+
+	die     chan struct{}
+	dieOnce sync.Once
+	wg      sync.WaitGroup
+}
+
+// Open opens the log in config.Dir, records are replayed to fn in order
+// before any new append, fn could be nil. A torn record at the tail will
+// be truncated.
+func Open(config *Config, fn func(data []byte) error) (*WAL, error) {
+	if err := config.VerifyConfig(); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(config.Dir, FileName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	end, err := replay(file, fn)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// drop the torn tail and continue appending from the last intact record
+	if err := file.Truncate(end); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	w := new(WAL)
+	w.file = file
+	w.window = config.GroupCommitWindow
+	if w.window == 0 {
+		w.window = DefaultGroupCommitWindow
+	}
+	w.maxBatchBytes = config.MaxBatchBytes
+	if w.maxBatchBytes == 0 {
+		w.maxBatchBytes = DefaultMaxBatchBytes
+	}
+	w.chAppend = make(chan appendRequest)
+	w.die = make(chan struct{})
+	w.wg.Add(1)
+	go w.commitLoop()
+	return w, nil
+}
+
+// replay reads records from file, returns the offset after the last intact record
+func replay(file *os.File, fn func(data []byte) error) (int64, error) {
+	r := bufio.NewReader(file)
+	var offset int64
+	var hdr [headerSize]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return offset, nil
+		}
+
+		length := binary.LittleEndian.Uint32(hdr[:])
+		if length > MaxRecordSize {
+			return offset, nil
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return offset, nil
+		}
+		if crc32.Checksum(data, crcTable) != binary.LittleEndian.Uint32(hdr[4:]) {
+			return offset, nil
+		}
+
+		if fn != nil {
+			if err := fn(data); err != nil {
+				return 0, err
+			}
+		}
+		offset += headerSize + int64(length)
+	}
+}
+
+// Append appends a record to the log, it returns after the record has been
+// synced to disk with the other records in the same batch.
+func (w *WAL) Append(data []byte) error {
+	if len(data) > MaxRecordSize {
+		return ErrRecordSize
+	}
+
+	req := appendRequest{data: data, done: make(chan error, 1)}
+	select {
+	case w.chAppend <- req:
+	case <-w.die:
+		return ErrClosed
+	}
+	return <-req.done
+}
+
+// commitLoop collects records into batches, each batch is written and
+// synced once.
+func (w *WAL) commitLoop() {
+	defer w.wg.Done()
+
+	var buf []byte
+	var batch []appendRequest
+	var failed error // a failed fsync can't be retried safely
+	timer := time.NewTimer(0)
+	<-timer.C
+
+	for {
+		// wait for the first record of a batch
+		select {
+		case req := <-w.chAppend:
+			batch = append(batch, req)
+			buf = appendRecord(buf, req.data)
+		case <-w.die:
+			return
+		}
+
+		// wait for more records within the window
+		timer.Reset(w.window)
+	COLLECT:
+		for len(buf) < w.maxBatchBytes {
+			select {
+			case req := <-w.chAppend:
+				batch = append(batch, req)
+				buf = appendRecord(buf, req.data)
+			case <-timer.C:
+				break COLLECT
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+
+		if failed == nil {
+			failed = w.commit(buf, len(batch))
+		}
+		for k := range batch {
+			batch[k].done <- failed
+			batch[k] = appendRequest{} // avoid memory leak
+		}
+		batch = batch[:0]
+		buf = buf[:0]
+	}
+}
+
+// commit writes and syncs a batch
+func (w *WAL) commit(buf []byte, records int) error {
+	if _, err := w.file.Write(buf); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	latency := time.Since(start)
+
+	w.statsMu.Lock()
+	w.stats.Records += uint64(records)
+	w.stats.Bytes += uint64(len(buf))
+	w.stats.Syncs++
+	w.stats.TotalSyncLatency += latency
+	w.stats.LastSyncLatency = latency
+	if latency > w.stats.MaxSyncLatency {
+		w.stats.MaxSyncLatency = latency
+	}
+	w.statsMu.Unlock()
+	return nil
+}
+
+// appendRecord encodes a record to buf
+func appendRecord(buf []byte, data []byte) []byte {
+	var hdr [headerSize]byte
+	binary.LittleEndian.PutUint32(hdr[:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(hdr[4:], crc32.Checksum(data, crcTable))
+	buf = append(buf, hdr[:]...)
+	return append(buf, data...)
+}
+
+// Stats returns the statistics of the write path
+func (w *WAL) Stats() Stats {
+	w.statsMu.Lock()
+	defer w.statsMu.Unlock()
+	return w.stats
+}
+
+// Close stops the log, pending appends will return ErrClosed.
+func (w *WAL) Close() error {
+	var err error
+	w.dieOnce.Do(func() {
+		close(w.die)
+		w.wg.Wait()
+		err = w.file.Close()
+	})
+	return err
+}
@@ -0,0 +1,92 @@
+package wal
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupCommit(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(&Config{Dir: dir, GroupCommitWindow: 10 * time.Millisecond}, nil)
+	assert.Nil(t, err)
+
+	const numRecords = 100
+	var wg sync.WaitGroup
+	wg.Add(numRecords)
+	for i := 0; i < numRecords; i++ {
+		go func(i int) {
+			defer wg.Done()
+			var bts [8]byte
+			binary.LittleEndian.PutUint64(bts[:], uint64(i))
+			assert.Nil(t, w.Append(bts[:]))
+		}(i)
+	}
+	wg.Wait()
+
+	// concurrent appends share fsyncs
+	stats := w.Stats()
+	assert.Equal(t, uint64(numRecords), stats.Records)
+	assert.Less(t, stats.Syncs, uint64(numRecords))
+	assert.Equal(t, uint64(numRecords*(headerSize+8)), stats.Bytes)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, ErrClosed, w.Append([]byte{1}))
+
+	// replay
+	seen := make(map[uint64]bool)
+	w, err = Open(&Config{Dir: dir}, func(data []byte) error {
+		seen[binary.LittleEndian.Uint64(data)] = true
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, numRecords, len(seen))
+	assert.Nil(t, w.Close())
+}
+
+func TestTornTail(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(&Config{Dir: dir}, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Append([]byte("first")))
+	assert.Nil(t, w.Append([]byte("second")))
+	assert.Nil(t, w.Close())
+
+	// a crash in the middle of the last record
+	path := filepath.Join(dir, FileName)
+	fi, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(path, fi.Size()-3))
+
+	var records []string
+	replay := func(data []byte) error {
+		records = append(records, string(data))
+		return nil
+	}
+	w, err = Open(&Config{Dir: dir}, replay)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first"}, records)
+
+	// appends continue after the last intact record
+	assert.Nil(t, w.Append([]byte("third")))
+	assert.Nil(t, w.Close())
+
+	records = nil
+	w, err = Open(&Config{Dir: dir}, replay)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first", "third"}, records)
+	assert.Nil(t, w.Close())
+}
+
+func TestConfig(t *testing.T) {
+	_, err := Open(&Config{}, nil)
+	assert.Equal(t, ErrConfigDir, err)
+	_, err = Open(&Config{Dir: t.TempDir(), GroupCommitWindow: -1}, nil)
+	assert.Equal(t, ErrConfigWindow, err)
+	_, err = Open(&Config{Dir: t.TempDir(), MaxBatchBytes: -1}, nil)
+	assert.Equal(t, ErrConfigBatchBytes, err)
+}